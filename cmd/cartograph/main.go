@@ -1,9 +1,13 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/TheHackerDev/cartograph/internal/apiHunter"
 
@@ -11,10 +15,15 @@ import (
 
 	"github.com/TheHackerDev/cartograph/internal/analyzer"
 	"github.com/TheHackerDev/cartograph/internal/config"
+	"github.com/TheHackerDev/cartograph/internal/crawler"
+	"github.com/TheHackerDev/cartograph/internal/dns"
+	"github.com/TheHackerDev/cartograph/internal/jsAnalyzer"
 	"github.com/TheHackerDev/cartograph/internal/mapper"
 	"github.com/TheHackerDev/cartograph/internal/proxy"
 	"github.com/TheHackerDev/cartograph/internal/proxy/injector"
 	"github.com/TheHackerDev/cartograph/internal/proxy/logger"
+	"github.com/TheHackerDev/cartograph/internal/shared/dispatch"
+	"github.com/TheHackerDev/cartograph/internal/shared/metrics"
 	"github.com/TheHackerDev/cartograph/internal/webui"
 )
 
@@ -31,6 +40,10 @@ func main() {
 
 	log.Info("cartograph started.")
 
+	// Cancel the context when an interrupt or termination signal is received, to begin a graceful shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// fatalErrChan is an error channel for use by all goroutines that send fatal error messages from the plugins.
 	fatalErrChan := make(chan error, 1)
 
@@ -40,11 +53,6 @@ func main() {
 	if configErr != nil {
 		log.WithError(configErr).Fatal("unable to initialize application configuration")
 	}
-	defer func() {
-		if closeErr := cfg.Close(); closeErr != nil {
-			log.WithError(closeErr).Error("error closing configuration")
-		}
-	}()
 
 	// Start injector
 	pluginInjector, injectorConfigErr := injector.NewInjector(cfg)
@@ -79,6 +87,28 @@ func main() {
 		}
 	}()
 
+	// Start DNS plugin, which resolves the hosts the proxy connects to
+	pluginDNS, dnsErr := dns.NewDNS(cfg)
+	if dnsErr != nil {
+		log.WithError(dnsErr).Fatal("unable to initialize DNS plugin")
+	}
+	go func() {
+		if err := pluginDNS.Run(); err != nil {
+			fatalErrChan <- fmt.Errorf("problem with DNS plugin: %w", err)
+		}
+	}()
+
+	// Start JavaScript analyzer
+	pluginJSAnalyzer, jsAnalyzerErr := jsAnalyzer.NewJSAnalyzer(cfg, pluginMapper, pluginDNS)
+	if jsAnalyzerErr != nil {
+		log.WithError(jsAnalyzerErr).Fatal("unable to initialize JavaScript analyzer plugin")
+	}
+	go func() {
+		if err := pluginJSAnalyzer.Run(); err != nil {
+			fatalErrChan <- fmt.Errorf("problem with JavaScript analyzer plugin: %w", err)
+		}
+	}()
+
 	// Start analyzer
 	pluginAnalyzer, analyzerErr := analyzer.NewAnalyzer(cfg)
 	if analyzerErr != nil {
@@ -91,16 +121,30 @@ func main() {
 	}()
 
 	// Start API Hunter
-	pluginAPIHunter := apiHunter.NewAPIHunter()
+	pluginAPIHunter, apiHunterErr := apiHunter.NewAPIHunter(cfg)
+	if apiHunterErr != nil {
+		log.WithError(apiHunterErr).Fatal("unable to initialize API hunter plugin")
+	}
 
 	// Start proxy
-	pluginProxy := proxy.NewProxy(cfg, pluginInjector, pluginLogger, pluginMapper, pluginAnalyzer, pluginAPIHunter)
+	pluginProxy := proxy.NewProxy(cfg, pluginInjector, pluginLogger, pluginMapper, pluginAnalyzer, pluginAPIHunter, pluginJSAnalyzer, pluginDNS)
 	go func() {
 		if proxyErr := pluginProxy.Run(); proxyErr != nil {
 			fatalErrChan <- fmt.Errorf("problem with proxy server: %w", proxyErr)
 		}
 	}()
 
+	// Start crawler, which sends its requests through the proxy
+	pluginCrawler, crawlerErr := crawler.NewCrawler(cfg)
+	if crawlerErr != nil {
+		log.WithError(crawlerErr).Fatal("unable to initialize crawler plugin")
+	}
+	go func() {
+		if err := pluginCrawler.Run(); err != nil {
+			fatalErrChan <- fmt.Errorf("problem with crawler plugin: %w", err)
+		}
+	}()
+
 	// Create API server
 	mux := http.NewServeMux()
 
@@ -109,27 +153,72 @@ func main() {
 
 	// Injector API
 	mux.Handle("/api/v1/injector/config/payloads/javascript/", injector.NewPayloadsJavaScriptAPIHandler(pluginInjector))
+	mux.Handle("/api/v1/injector/rules/", injector.NewRulesAPIHandler(pluginInjector))
+	mux.HandleFunc("/api/v1/injector/settings/", pluginInjector.SettingsAPIHandler)
+	mux.HandleFunc("/api/v1/injector/coverage/", pluginInjector.CoverageAPIHandler)
+
+	// API Hunter API
+	mux.HandleFunc("/api/v1/api-hunter/grpc/descriptors/", pluginAPIHunter.GrpcDescriptorsAPIHandler)
+
+	// Plugin input queue statistics API
+	mux.Handle("/api/v1/plugins/queues/", dispatch.NewStatsAPIHandler(pluginLogger, pluginMapper, pluginAnalyzer, pluginJSAnalyzer, pluginDNS))
+
+	// Prometheus metrics
+	if registerErr := dispatch.RegisterMetrics(pluginLogger, pluginMapper, pluginAnalyzer, pluginJSAnalyzer, pluginDNS); registerErr != nil {
+		log.WithError(registerErr).Fatal("unable to register plugin queue metrics")
+	}
+	mux.Handle("/metrics", metrics.Handler())
 
 	// Logger data API
 	// mux.Handle("/api/v1/logger/data/", logger.DataAPIHandler(pluginLogger))
+	mux.HandleFunc("/api/v1/logger/paths/tree/", logger.PathTreeAPIHandler(pluginLogger))
+	mux.HandleFunc("/api/v1/logger/paths/parameters/", logger.ParametersAPIHandler(pluginLogger))
 
 	// Mapper API
 	mux.HandleFunc("/api/v1/mapper/data/hosts/", pluginMapper.HostsDataAPIHandler)
 	mux.HandleFunc("/api/v1/mapper/data/paths/", pluginMapper.PathsDataAPIHandler)
-	mux.HandleFunc("/api/v1/mapper/data/hosts/all/gexf/", pluginMapper.AllHostsGexf)
-	mux.HandleFunc("/api/v1/mapper/data/hosts/two-degrees/gexf/", pluginMapper.HostTwoDegreesGexf)
-	mux.HandleFunc("/api/v1/mapper/data/hosts/one-degree/gexf/", pluginMapper.HostsOneDegreeGexf)
-	mux.HandleFunc("/api/v1/mapper/data/paths-hosts/gexf/", pluginMapper.PathsAndConnectionsForHostsGexf)
+	mux.HandleFunc("/api/v1/mapper/data/routes/", pluginMapper.RoutesAPIHandler)
+	// Graph exports, in the format given by the "format" query parameter or the Accept header.
+	// The "gexf" routes are kept for existing clients, and default to GEXF like the "graph" routes.
+	for _, prefix := range []string{"gexf", "graph"} {
+		mux.HandleFunc("/api/v1/mapper/data/hosts/all/"+prefix+"/", pluginMapper.AllHostsGraph)
+		mux.HandleFunc("/api/v1/mapper/data/hosts/two-degrees/"+prefix+"/", pluginMapper.HostTwoDegreesGraph)
+		mux.HandleFunc("/api/v1/mapper/data/hosts/one-degree/"+prefix+"/", pluginMapper.HostsOneDegreeGraph)
+		mux.HandleFunc("/api/v1/mapper/data/paths-hosts/"+prefix+"/", pluginMapper.PathsAndConnectionsForHostsGraph)
+	}
+	mux.HandleFunc("/api/v1/mapper/data/hosts/neighbourhood/graph/", pluginMapper.HostNeighbourhoodGraph)
+	mux.HandleFunc("/api/v1/mapper/organisations/", pluginMapper.OrganisationsAPIHandler)
+	mux.HandleFunc("/api/v1/mapper/instrumentation/", pluginMapper.InstrumentationAPIHandler)
+	mux.HandleFunc("/api/v1/mapper/analytics/ranking/", pluginMapper.RankingAPIHandler)
+	mux.HandleFunc("/api/v1/mapper/snapshots/", pluginMapper.SnapshotsAPIHandler)
+	mux.HandleFunc("/api/v1/mapper/snapshots/diff/", pluginMapper.SnapshotsDiffAPIHandler)
+	mux.HandleFunc("/api/v1/mapper/snapshots/diff/graph/", pluginMapper.SnapshotsDiffGraph)
+
+	// Crawler API
+	mux.Handle("/api/v1/crawler/jobs/", crawler.NewJobsAPIHandler(pluginCrawler))
+	mux.HandleFunc("/api/v1/crawler/settings/", pluginCrawler.SettingsAPIHandler)
+
+	// JavaScript analyzer API
+	mux.HandleFunc("/api/v1/js-analyzer/endpoints/", pluginJSAnalyzer.EndpointsAPIHandler)
+	mux.HandleFunc("/api/v1/js-analyzer/sourcemaps/", pluginJSAnalyzer.SourceMapsAPIHandler)
+
+	// DNS API
+	mux.HandleFunc("/api/v1/dns/resolutions/", pluginDNS.ResolutionsAPIHandler)
+	mux.HandleFunc("/api/v1/dns/candidates/", pluginDNS.CandidatesAPIHandler)
+	mux.HandleFunc("/api/v1/dns/passive/", pluginDNS.PassiveAPIHandler)
+	mux.HandleFunc("/api/v1/dns/settings/", pluginDNS.SettingsAPIHandler)
+	mux.Handle("/api/v1/dns/overrides/", dns.NewOverridesAPIHandler(pluginDNS))
 
 	// Start API server
+	apiServer := cfg.APIServer.NewHTTPServer(mux)
 	go func() {
-		if apiServerErr := http.ListenAndServe(":8000", mux); apiServerErr != nil {
+		if apiServerErr := apiServer.ListenAndServe(); apiServerErr != nil && !errors.Is(apiServerErr, http.ErrServerClosed) {
 			fatalErrChan <- fmt.Errorf("problem with API server: %w", apiServerErr)
 		}
 	}()
 
 	// Start web UI plugin
-	pluginWebUI, webUIErr := webui.NewWebUI(cfg)
+	pluginWebUI, webUIErr := webui.NewWebUI(cfg, pluginMapper, pluginLogger)
 	if webUIErr != nil {
 		log.WithError(webUIErr).Fatal("unable to initialize web UI plugin")
 	}
@@ -139,7 +228,48 @@ func main() {
 		}
 	}()
 
-	// Listen for fatal errors
-	fatalErr := <-fatalErrChan
-	log.WithError(fatalErr).Fatal("fatal error received. Exiting.")
+	// Wait for a fatal error or a shutdown signal
+	exitCode := 0
+	select {
+	case fatalErr := <-fatalErrChan:
+		log.WithError(fatalErr).Error("fatal error received. Shutting down.")
+		exitCode = 1
+	case <-ctx.Done():
+		log.Info("shutdown signal received. Shutting down.")
+	}
+	stop()
+
+	// Pause any running crawl jobs first, as their requests go through the proxy
+	pluginCrawler.Stop()
+
+	// Stop accepting new connections, and drain in-flight requests and tunnels
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	if shutdownErr := pluginProxy.Shutdown(shutdownCtx); shutdownErr != nil {
+		log.WithError(shutdownErr).Error("unable to gracefully shut down proxy server")
+	}
+	if shutdownErr := apiServer.Shutdown(shutdownCtx); shutdownErr != nil {
+		log.WithError(shutdownErr).Error("unable to gracefully shut down API server")
+	}
+	if shutdownErr := pluginWebUI.Shutdown(shutdownCtx); shutdownErr != nil {
+		log.WithError(shutdownErr).Error("unable to gracefully shut down web UI servers")
+	}
+	cancel()
+
+	// Flush any cached plugin data to the database, now that no more data is being received
+	// The JavaScript analyzer is stopped before the DNS plugin and the mapper, as it sends the host names and endpoints it
+	// finds to them.
+	pluginLogger.Stop()
+	pluginJSAnalyzer.Stop()
+	pluginDNS.Stop()
+	pluginMapper.Stop()
+	pluginAnalyzer.Stop()
+	pluginInjector.Stop()
+
+	// Close the database connections
+	if closeErr := cfg.Close(); closeErr != nil {
+		log.WithError(closeErr).Error("error closing configuration")
+	}
+
+	log.Info("cartograph stopped.")
+	os.Exit(exitCode)
 }
@@ -54,6 +54,35 @@ comment on column data_logger.cookie_key_vals is 'Cookies sent in either HTTP re
 
 comment on column data_logger.last_seen is 'Timestamp when this asset was last observed.';
 
+create table if not exists data_logger_streams
+(
+    url_scheme    text                     not null,
+    url_host      text                     not null,
+    url_path      text                     not null,
+    req_method    text                     not null,
+    resp_code     integer                  not null,
+    req_timestamp timestamp with time zone not null,
+    stream_type   text                     not null,
+    sequence      integer                  not null,
+    event_name    text default ''::text    not null,
+    event_id      text default ''::text    not null,
+    data_shape    jsonb                    not null,
+    data_size     integer                  not null,
+    timestamp     timestamp with time zone not null,
+    constraint data_logger_streams_pk
+        primary key (url_scheme, url_host, url_path, req_method, req_timestamp, sequence)
+);
+
+comment on table data_logger_streams is 'Events parsed from streaming (Server-Sent Events and NDJSON) HTTP responses. Linked to the originating request in data_logger by URL scheme, host, path, request method, and response code.';
+
+comment on column data_logger_streams.req_timestamp is 'Timestamp of the originating request, identifying the individual stream.';
+
+comment on column data_logger_streams.stream_type is 'Type of stream (e.g. "sse", "ndjson").';
+
+comment on column data_logger_streams.sequence is 'Position of the event in the stream, starting from 0.';
+
+comment on column data_logger_streams.data_shape is 'Structure of the event data (JSON types only, no values).';
+
 create table if not exists config_logger
 (
     enabled boolean default true             not null,
@@ -72,14 +101,32 @@ create table if not exists data_api_hunter
     resp_body_json  jsonb,
     resp_body_plain text,
     resp_code       integer default 0        not null,
-    timestamp       timestamp with time zone not null
+    timestamp       timestamp with time zone not null,
+    grpc_service    text    default ''::text not null,
+    grpc_method     text    default ''::text not null
 );
 
 comment on table data_api_hunter is 'API data observed in HTTP requests and responses.';
 
+comment on column data_api_hunter.grpc_service is 'Fully-qualified gRPC service name (e.g. "helloworld.Greeter"), if the request was a gRPC or gRPC-Web call.';
+
+comment on column data_api_hunter.grpc_method is 'gRPC method name (e.g. "SayHello"), if the request was a gRPC or gRPC-Web call.';
+
 create index if not exists data_api_hunter_index
     on data_api_hunter (url_scheme, url_host, url_path, req_method, resp_code);
 
+create table if not exists api_hunter_grpc_descriptors
+(
+    id             uuid                     not null
+        constraint api_hunter_grpc_descriptors_pk
+            primary key,
+    name           text                     not null,
+    descriptor_set bytea                    not null,
+    uploaded       timestamp with time zone not null default now()
+);
+
+comment on table api_hunter_grpc_descriptors is 'Protobuf FileDescriptorSet uploads, used to fully decode gRPC messages.';
+
 create table if not exists data_injector
 (
 );
@@ -102,20 +149,204 @@ create table if not exists data_analyzer
 
 create table if not exists config_crawler
 (
+    max_depth           integer          default 3                        not null,
+    max_pages           integer          default 1000                     not null,
+    requests_per_second double precision default 2                        not null,
+    concurrency         integer          default 4                        not null,
+    respect_robots      boolean          default true                     not null,
+    user_agent          text             default 'Cartograph Crawler'::text not null,
+    mode                text             default 'http'::text             not null
 );
 
+comment on column config_crawler.max_depth is 'Maximum number of links followed from the start of a crawl.';
+
+comment on column config_crawler.max_pages is 'Maximum number of URLs requested by a single crawl job.';
+
+comment on column config_crawler.requests_per_second is 'Maximum number of requests sent to each host every second.';
+
+comment on column config_crawler.concurrency is 'Maximum number of requests a single crawl job has in flight at once.';
+
+comment on column config_crawler.mode is 'Crawl mode: "http" (plain HTTP requests), or "browser" (a headless Chromium driven over the DevTools protocol).';
+
+insert into config_crawler select where not exists (select 1 from config_crawler);
+
 create table if not exists data_crawler
 (
+    id       uuid                          not null
+        constraint data_crawler_pk
+            primary key,
+    status   text                          not null,
+    hosts    text[]  default '{}'::text[]  not null,
+    settings jsonb                         not null,
+    visited  integer default 0             not null,
+    skipped  integer default 0             not null,
+    errors   integer default 0             not null,
+    error    text    default ''::text      not null,
+    created  timestamp with time zone      not null,
+    updated  timestamp with time zone      not null,
+    finished timestamp with time zone
 );
 
+comment on table data_crawler is 'Crawl jobs started by the crawler plugin, and their progress.';
+
+comment on column data_crawler.status is 'Job status: "running", "paused" (stopped by a shutdown, and resumed on the next start), "finished", "cancelled", or "failed".';
+
+comment on column data_crawler.hosts is 'Target hosts the crawl started from.';
+
+comment on column data_crawler.settings is 'Crawler settings the job was started with.';
+
+create table if not exists data_crawler_urls
+(
+    job_id     uuid                          not null
+        constraint data_crawler_urls_job_id_fk
+            references data_crawler
+            on delete cascade,
+    template   text                          not null,
+    url        text                          not null,
+    referer    text    default ''::text      not null,
+    depth      integer                       not null,
+    status     text                          not null,
+    resp_code  integer default 0             not null,
+    error      text    default ''::text      not null,
+    discovered timestamp with time zone      not null,
+    visited    timestamp with time zone,
+    constraint data_crawler_urls_pk
+        primary key (job_id, template)
+);
+
+comment on table data_crawler_urls is 'URLs found by each crawl job, deduplicated on their templated path and query parameter names.';
+
+comment on column data_crawler_urls.template is 'URL with numeric, UUID, hexadecimal, and token path segments replaced by placeholders, and only the query parameter names kept.';
+
+comment on column data_crawler_urls.status is 'URL status: "queued", "visited", "robots" (disallowed by robots.txt), or "error".';
+
+create table if not exists data_crawler_navigation
+(
+    job_id     uuid                      not null
+        constraint data_crawler_navigation_job_id_fk
+            references data_crawler
+            on delete cascade,
+    from_url   text                      not null,
+    to_url     text                      not null,
+    action     text                      not null,
+    element    text default ''::text     not null,
+    discovered timestamp with time zone  not null,
+    constraint data_crawler_navigation_pk
+        primary key (job_id, from_url, to_url, action)
+);
+
+comment on table data_crawler_navigation is 'Navigation graph of the pages rendered by browser crawl jobs.';
+
+comment on column data_crawler_navigation.action is 'How the page led to the URL: "link", "click", "form", or "redirect".';
+
+comment on column data_crawler_navigation.element is 'Element the navigation started from, such as "button#save".';
+
+create table if not exists data_crawler_screenshots
+(
+    job_id     uuid                     not null
+        constraint data_crawler_screenshots_job_id_fk
+            references data_crawler
+            on delete cascade,
+    template   text                     not null,
+    url        text                     not null,
+    screenshot bytea                    not null,
+    taken      timestamp with time zone not null,
+    constraint data_crawler_screenshots_pk
+        primary key (job_id, template)
+);
+
+comment on table data_crawler_screenshots is 'PNG screenshots of the pages rendered by browser crawl jobs, once loaded.';
+
 create table if not exists config_dns
 (
+    log_resolutions    boolean default true not null,
+    collect_candidates boolean default true not null
 );
 
+comment on column config_dns.log_resolutions is 'Whether the records of every DNS resolution are saved to the data_dns table.';
+
+comment on column config_dns.collect_candidates is 'Whether the host names found in proxied traffic and DNS data are saved as candidate hosts.';
+
+insert into config_dns select where not exists (select 1 from config_dns);
+
 create table if not exists data_dns
 (
+    host        text                          not null,
+    name        text                          not null,
+    record_type text                          not null,
+    value       text    default ''::text      not null,
+    ttl         bigint  default 0             not null,
+    resolver    text    default ''::text      not null,
+    rcode       text    default ''::text      not null,
+    source      text                          not null,
+    timestamp   timestamp with time zone      not null
 );
 
+comment on table data_dns is 'DNS records of the resolutions performed by the proxy, seen by the DNS listener, or imported from passive DNS data.';
+
+comment on column data_dns.name is 'Owner name of the record, which differs from the host for records following a CNAME.';
+
+comment on column data_dns.value is 'Address, or canonical name for CNAME records; empty if the resolution had no answer.';
+
+comment on column data_dns.resolver is 'DNS server that answered, "/etc/hosts", or the passive DNS input the record was read from.';
+
+comment on column data_dns.source is 'Where the resolution was seen: "proxy", "listener", or "passive".';
+
+create index if not exists data_dns_host_index
+    on data_dns (host, timestamp);
+
+create table if not exists data_dns_candidates
+(
+    host       text                          not null,
+    source     text                          not null,
+    found_in   text default ''::text         not null,
+    first_seen timestamp with time zone      not null,
+    last_seen  timestamp with time zone      not null,
+    constraint data_dns_candidates_pk
+        primary key (host, source)
+);
+
+comment on table data_dns_candidates is 'Host names found in proxied traffic and DNS data, which may be worth adding to the targets.';
+
+comment on column data_dns_candidates.source is 'Where the host name was found: "san" (certificate subject alternative names), "csp" (Content-Security-Policy headers), "js" (script bodies), "listener", or "passive".';
+
+comment on column data_dns_candidates.found_in is 'URL or resolver the host name was first found in.';
+
+create table if not exists dns_overrides
+(
+    id      uuid        default uuid_generate_v4() not null
+        constraint dns_overrides_pk
+            primary key,
+    target  uuid                                   not null,
+    host    text                                   not null,
+    address text                                   not null,
+    enabled boolean     default true               not null,
+    created timestamptz default now()              not null
+);
+
+comment on table dns_overrides is 'Addresses connected to by the proxy instead of resolving target host names, such as to test staging servers.';
+
+comment on column dns_overrides.target is 'UUID value referencing the ID of the target rule set in the "targets" table the override applies to.';
+
+comment on column dns_overrides.host is 'Host name overridden, or a wildcard such as "*.example.com" for every subdomain.';
+
+create table if not exists data_dns_overrides
+(
+    override_id uuid                     not null,
+    host        text                     not null,
+    address     text                     not null,
+    method      text                     not null,
+    url         text                     not null,
+    timestamp   timestamp with time zone not null
+);
+
+comment on table data_dns_overrides is 'Requests sent by the proxy to the address of a DNS override.';
+
+comment on column data_dns_overrides.override_id is 'UUID value referencing the ID of the override applied in the "dns_overrides" table.';
+
+create index if not exists data_dns_overrides_override_id_index
+    on data_dns_overrides (override_id, timestamp);
+
 create table if not exists config_injector
 (
     enabled     boolean default true not null,
@@ -141,6 +372,63 @@ create table if not exists injector_script_urls
 create unique index if not exists injector_script_urls_id_uindex
     on injector_script_urls (id);
 
+create table if not exists injector_rules
+(
+    id            uuid        default uuid_generate_v4() not null
+        constraint injector_rules_pk
+            primary key,
+    name          text        default ''                 not null,
+    enabled       boolean     default true               not null,
+    priority      integer     default 0                  not null,
+    type          text                                   not null,
+    content       text        default ''                 not null,
+    header_name   text        default ''                 not null,
+    header_action text        default ''                 not null,
+    targets       uuid[]      default ARRAY []::uuid[]   not null,
+    ignored       uuid[]      default ARRAY []::uuid[]   not null,
+    created       timestamptz default now()              not null
+);
+
+comment on table injector_rules is 'Content injected into the responses of target hosts by the injector.';
+
+comment on column injector_rules.type is 'One of "script", "inline_script", "stylesheet", "inline_style", or "header".';
+
+comment on column injector_rules.content is 'The script or stylesheet URL, the inline script or style body, or the header value.';
+
+comment on column injector_rules.header_action is 'One of "add", "set", or "delete", for header rules.';
+
+comment on column injector_rules.targets is 'An array of UUID values referencing the IDs in the "targets" table. Empty for all targets.';
+
+comment on column injector_rules.ignored is 'An array of UUID values referencing the IDs in the "targets" table.';
+
+create table if not exists data_injection_coverage
+(
+    url_scheme text                         not null,
+    url_host   text                         not null,
+    url_path   text                         not null,
+    plugin     text                         not null,
+    status     text                         not null,
+    directives text[]  default '{}'::text[] not null,
+    policy     text    default ''::text     not null,
+    first_seen timestamp with time zone     not null,
+    last_seen  timestamp with time zone     not null,
+    constraint data_injection_coverage_pk
+        primary key (url_scheme, url_host, url_path, plugin)
+);
+
+comment on table data_injection_coverage is 'Whether content injected into each page by the mapper and injector plugins is allowed by its Content-Security-Policy.';
+
+comment on column data_injection_coverage.plugin is 'The plugin that injected content into the page: "mapper" or "injector".';
+
+comment on column data_injection_coverage.status is 'One of "injected" (allowed as served), "csp_modified" (allowed by rewriting the policy), or "blocked".';
+
+comment on column data_injection_coverage.directives is 'The directives that were rewritten, or that block the injected content.';
+
+comment on column data_injection_coverage.policy is 'The enforced policies, as rewritten, joined with commas.';
+
+create index if not exists data_injection_coverage_status_index
+    on data_injection_coverage (status, url_host);
+
 create table if not exists targets
 (
     id     uuid    not null,
@@ -165,10 +453,13 @@ create table if not exists data_mapper
     destination_scheme text                     not null,
     destination_host   text                     not null,
     destination_path   text                     not null,
+    edge_type          text default 'link'::text not null,
+    element            text default ''::text    not null,
+    attribute          text default ''::text    not null,
     first_seen         timestamp with time zone not null,
     last_seen          timestamp with time zone not null,
     constraint data_mapper_pk
-        primary key (referer_scheme, referer_host, referer_path, destination_scheme, destination_host, destination_path)
+        primary key (referer_scheme, referer_host, referer_path, destination_scheme, destination_host, destination_path, edge_type)
 );
 
 comment on table data_mapper is 'Data for the mapper plugin';
@@ -185,12 +476,152 @@ comment on column data_mapper.destination_host is 'URL host for the destination.
 
 comment on column data_mapper.destination_path is 'URL path for the destination.';
 
+comment on column data_mapper.edge_type is 'How the referer led to the destination: "link", "redirect", "script", "iframe", "fetch", "form", "image", "media", "resource", or "discovered".';
+
+comment on column data_mapper.element is 'HTML element the destination was found in (e.g. "script"), or the script API used to request it (e.g. "fetch"). Contains empty text if unknown.';
+
+comment on column data_mapper.attribute is 'HTML attribute the destination was found in (e.g. "src"). Contains empty text if unknown.';
+
 comment on column data_mapper.first_seen is 'Time when this data was first seen.';
 
 comment on column data_mapper.last_seen is 'Time when this data was most recently seen.';
 
 comment on constraint data_mapper_pk on data_mapper is 'Primary, unique key for mapper plugin data.';
 
+create index if not exists data_mapper_referer_host_index
+    on data_mapper (referer_host);
+
+create index if not exists data_mapper_destination_host_index
+    on data_mapper (destination_host);
+
+create index if not exists data_mapper_last_seen_index
+    on data_mapper (last_seen);
+
+create table if not exists mapper_organisations
+(
+    domain       text                     not null
+        constraint mapper_organisations_pk
+            primary key,
+    organisation text                     not null,
+    source       text                     not null default 'user',
+    updated      timestamp with time zone not null default now()
+);
+
+comment on table mapper_organisations is 'Organisations that own registrable domains, used to tell first-party from third-party connections.';
+
+comment on column mapper_organisations.source is 'Where the mapping came from: "user" for user-supplied mappings, or "certificate" for mappings derived from TLS certificate subjects.';
+
+create table if not exists mapper_snapshots
+(
+    name        text                     not null
+        constraint mapper_snapshots_pk
+            primary key,
+    description text default ''::text    not null,
+    since       timestamp with time zone,
+    until       timestamp with time zone,
+    created     timestamp with time zone not null default now()
+);
+
+comment on table mapper_snapshots is 'Named copies of the mapper data, used to compare the map over time.';
+
+comment on column mapper_snapshots.since is 'Start of the time window the snapshot was limited to, or null if unbounded.';
+
+comment on column mapper_snapshots.until is 'End of the time window the snapshot was limited to, or null if unbounded.';
+
+create table if not exists mapper_snapshot_edges
+(
+    snapshot           text                     not null
+        constraint mapper_snapshot_edges_snapshot_fk
+            references mapper_snapshots
+            on delete cascade,
+    referer_scheme     text                     not null,
+    referer_host       text                     not null,
+    referer_path       text                     not null,
+    destination_scheme text                     not null,
+    destination_host   text                     not null,
+    destination_path   text                     not null,
+    edge_type          text                     not null,
+    first_seen         timestamp with time zone not null,
+    last_seen          timestamp with time zone not null,
+    constraint mapper_snapshot_edges_pk
+        primary key (snapshot, referer_scheme, referer_host, referer_path, destination_scheme, destination_host, destination_path, edge_type)
+);
+
+comment on table mapper_snapshot_edges is 'The mapper data (data_mapper rows) copied into each snapshot.';
+
+create table if not exists data_js_endpoints
+(
+    script_url  text                     not null,
+    url_scheme  text                     not null,
+    url_host    text                     not null,
+    url_path    text                     not null,
+    kind        text                     not null,
+    method      text default ''::text    not null,
+    source_file text default ''::text    not null,
+    first_seen  timestamp with time zone not null,
+    last_seen   timestamp with time zone not null,
+    constraint data_js_endpoints_pk
+        primary key (script_url, url_scheme, url_host, url_path, kind)
+);
+
+comment on table data_js_endpoints is 'Endpoints referenced in JavaScript responses, which may not have been visited yet.';
+
+comment on column data_js_endpoints.kind is 'How the endpoint was found: "literal", "fetch", "axios", "jquery", "xhr", or "route".';
+
+comment on column data_js_endpoints.method is 'HTTP method of the call the endpoint was found in, if known.';
+
+comment on column data_js_endpoints.source_file is 'Original source file the endpoint was found in, if it was found through a source map.';
+
+create index if not exists data_js_endpoints_url_index
+    on data_js_endpoints (url_host, url_path);
+
+create table if not exists data_js_sourcemaps
+(
+    map_url    text                         not null
+        constraint data_js_sourcemaps_pk
+            primary key,
+    script_url text                         not null,
+    sources    text[]  default '{}'::text[] not null,
+    endpoints  integer default 0            not null,
+    fetched    timestamp with time zone     not null
+);
+
+comment on table data_js_sourcemaps is 'Source maps fetched for JavaScript responses, and the original source files they contain.';
+
+comment on column data_js_sourcemaps.endpoints is 'Number of endpoints found in the original source files.';
+
+create table if not exists data_browser_events
+(
+    page_scheme text                     not null,
+    page_host   text                     not null,
+    page_path   text                     not null,
+    kind        text                     not null,
+    method      text default ''::text    not null,
+    url         text default ''::text    not null,
+    script      text default ''::text    not null,
+    detail      text default ''::text    not null,
+    count       bigint default 1         not null,
+    first_seen  timestamp with time zone not null,
+    last_seen   timestamp with time zone not null,
+    constraint data_browser_events_pk
+        primary key (page_scheme, page_host, page_path, kind, method, url, script, detail)
+);
+
+comment on table data_browser_events is 'Client-side API calls made on target pages, recorded by the mapper instrumentation script.';
+
+comment on column data_browser_events.kind is 'The API called: "fetch", "xhr", "websocket", "postmessage", or "storage".';
+
+comment on column data_browser_events.method is 'The HTTP method of requests, or the action for other kinds, such as "SEND" or "SET".';
+
+comment on column data_browser_events.url is 'The URL called, the origin of the sender of a received message, or the page origin for storage writes.';
+
+comment on column data_browser_events.script is 'The URL of the script that made the call, or the page URL for inline scripts.';
+
+comment on column data_browser_events.detail is 'The storage key written, or the top-level keys of a received message.';
+
+create index if not exists data_browser_events_url_index
+    on data_browser_events (url);
+
 create table if not exists config_mapper
 (
     enabled boolean default true             not null,
@@ -729,6 +1160,43 @@ create trigger injector_script_urls_trigger
     for each row
 execute procedure notify_change_on_injector_script_urls();
 
+create or replace function notify_change_on_injector_rules() returns trigger
+    language plpgsql
+as
+$$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        PERFORM pg_notify('injector_rules_channel', 'DELETE,' || OLD.id::text);
+        RETURN OLD;
+    END IF;
+
+    PERFORM pg_notify('injector_rules_channel', 'UPDATE,' || NEW.id::text);
+    RETURN NEW;
+END;
+$$;
+
+create trigger injector_rules_trigger
+    after insert or update or delete
+    on injector_rules
+    for each row
+execute procedure notify_change_on_injector_rules();
+
+create or replace function notify_change_on_config_injector() returns trigger
+    language plpgsql
+as
+$$
+BEGIN
+    PERFORM pg_notify('injector_config_channel', 'UPDATE');
+    RETURN NEW;
+END;
+$$;
+
+create trigger config_injector_trigger
+    after update
+    on config_injector
+    for each row
+execute procedure notify_change_on_config_injector();
+
 create or replace function notify_change_on_targets() returns trigger
     language plpgsql
 as
@@ -764,250 +1232,140 @@ create trigger targets_trigger
     for each row
 execute procedure notify_change_on_targets();
 
-create or replace function get_hosts_within_three_degrees(p_host text)
-    returns TABLE
-            (
-                host text
-            )
-    language sql
-as
-$$
-WITH RECURSIVE cte(host, depth) AS (
-    -- Base case: 1st degree hosts
-    SELECT destination_host, 1
-    FROM data_mapper
-    WHERE referer_host = p_host
-
-    UNION
-
-    -- Recursive case: up to 3rd degree hosts
-    SELECT CASE
-               WHEN cte.depth % 2 = 1 THEN dm.destination_host
-               ELSE dm.referer_host
-               END,
-           cte.depth + 1
-    FROM data_mapper dm
-             JOIN cte ON (
-        (cte.depth % 2 = 1 AND cte.host = dm.referer_host) OR
-        (cte.depth % 2 = 0 AND cte.host = dm.destination_host)
-        )
-    WHERE cte.depth < 4)
-SELECT DISTINCT host
-FROM cte
-where host != '';
-$$;
-
-create or replace function get_referer_destination_pairs_within_four_degrees(p_host text)
-    returns TABLE
-            (
-                referer_host     text,
-                destination_host text
-            )
-    language sql
-as
-$$
-WITH RECURSIVE cte(referer_host, destination_host, depth) AS (
-    -- Base case: 1st degree hosts
-    SELECT referer_host, destination_host, 1
-    FROM data_mapper
-    WHERE referer_host = p_host
-
-    UNION
-
-    -- Recursive case: up to 4th degree hosts
-    SELECT CASE
-               WHEN cte.depth % 2 = 1 THEN cte.destination_host
-               ELSE cte.referer_host
-               END,
-           CASE
-               WHEN cte.depth % 2 = 1 THEN dm.destination_host
-               ELSE dm.referer_host
-               END,
-           cte.depth + 1
-    FROM data_mapper dm
-             JOIN cte ON (
-        (cte.depth % 2 = 1 AND cte.destination_host = dm.referer_host) OR
-        (cte.depth % 2 = 0 AND cte.referer_host = dm.destination_host)
-        )
-    WHERE cte.depth < 4)
-SELECT DISTINCT referer_host, destination_host
-FROM cte
-where referer_host != ''
-  and destination_host != ''
-  and referer_host != destination_host;
-$$;
-
-create or replace function get_referer_destination_host_pairs_within_three_degrees(p_host text)
-    returns TABLE
-            (
-                referer_host          text,
-                destination_host      text,
-                degrees_of_separation integer
-            )
-    language sql
-as
-$$
-WITH RECURSIVE cte(referer_host, destination_host, depth) AS (
-    -- Base case: 1st degree hosts
-    SELECT referer_host, destination_host, 1
-    FROM data_mapper
-    WHERE referer_host = p_host
-       OR destination_host = p_host
-
-    UNION
-
-    -- Recursive case: up to 3rd degree hosts
-    SELECT dm.referer_host,
-           dm.destination_host,
-           cte.depth + 1
-    FROM data_mapper dm
-             JOIN cte ON (
-        cte.destination_host = dm.referer_host OR cte.destination_host = dm.destination_host OR
-        cte.referer_host = dm.referer_host OR cte.referer_host = dm.destination_host
-        )
-    WHERE cte.depth < 3)
-SELECT DISTINCT referer_host, destination_host, depth as degrees_of_separation
-FROM cte
-where referer_host != ''
-  and destination_host != ''
-  and referer_host != destination_host;
-$$;
-
-create or replace function get_referer_destination_host_pairs_within_two_degrees(p_host text)
-    returns TABLE
-            (
-                referer_host          text,
-                destination_host      text,
-                degrees_of_separation integer
-            )
-    language sql
-as
-$$
-WITH RECURSIVE cte(referer_host, destination_host, depth) AS (
-    -- Base case: 1st degree hosts
-    SELECT referer_host, destination_host, 1
-    FROM data_mapper
-    WHERE referer_host = p_host
-       OR destination_host = p_host
-
-    UNION
-
-    -- Recursive case: up to 3rd degree hosts
-    SELECT dm.referer_host,
-           dm.destination_host,
-           cte.depth + 1
-    FROM data_mapper dm
-             JOIN cte ON (
-        cte.destination_host = dm.referer_host OR cte.destination_host = dm.destination_host OR
-        cte.referer_host = dm.referer_host OR cte.referer_host = dm.destination_host
-        )
-    WHERE cte.depth < 2)
-SELECT DISTINCT referer_host, destination_host, depth as degrees_of_separation
-FROM cte
-where referer_host != ''
-  and destination_host != ''
-  and referer_host != destination_host;
-$$;
-
-create or replace function get_referer_destination_host_pairs_within_four_degrees(p_host text)
+create or replace function get_host_neighbourhood(p_host text, p_depth integer, p_direction text,
+                                                  p_since timestamp with time zone,
+                                                  p_until timestamp with time zone,
+                                                  p_max_hosts integer)
     returns TABLE
             (
                 referer_host          text,
                 destination_host      text,
-                degrees_of_separation integer
+                degrees_of_separation integer,
+                first_seen            timestamp with time zone,
+                last_seen             timestamp with time zone
             )
+    stable
     language sql
 as
 $$
-WITH RECURSIVE cte(referer_host, destination_host, depth) AS (
-    -- Base case: 1st degree hosts
-    SELECT referer_host, destination_host, 1
-    FROM data_mapper
-    WHERE referer_host = p_host
-       OR destination_host = p_host
-
-    UNION
-
-    -- Recursive case: up to 3rd degree hosts
-    SELECT dm.referer_host,
-           dm.destination_host,
-           cte.depth + 1
-    FROM data_mapper dm
-             JOIN cte ON (
-        cte.destination_host = dm.referer_host OR cte.destination_host = dm.destination_host OR
-        cte.referer_host = dm.referer_host OR cte.referer_host = dm.destination_host
-        )
-    WHERE cte.depth < 4)
-SELECT DISTINCT referer_host, destination_host, depth as degrees_of_separation
-FROM cte
-where referer_host != ''
-  and destination_host != ''
-  and referer_host != destination_host;
+WITH RECURSIVE levels(depth, frontier, reached) AS (
+    -- Base case: the given host
+    SELECT 0, ARRAY [p_host], ARRAY [p_host]
+
+    UNION ALL
+
+    -- Recursive case: the hosts connected to the previous degree in the given direction that have not been reached
+    -- yet, up to the maximum number of hosts
+    SELECT l.depth + 1, n.hosts, l.reached || n.hosts
+    FROM levels l
+             CROSS JOIN LATERAL (
+        SELECT array_agg(c.host ORDER BY c.host) AS hosts
+        FROM (SELECT connected.host
+              FROM (SELECT DISTINCT CASE
+                                        WHEN p_direction IN ('outbound', 'both') AND dm.referer_host = ANY (l.frontier)
+                                            THEN dm.destination_host
+                                        ELSE dm.referer_host END AS host
+                    FROM data_mapper dm
+                    WHERE ((p_direction IN ('outbound', 'both') AND dm.referer_host = ANY (l.frontier)) OR
+                           (p_direction IN ('inbound', 'both') AND dm.destination_host = ANY (l.frontier)))
+                      AND dm.referer_host != ''
+                      AND dm.destination_host != ''
+                      AND dm.referer_host != dm.destination_host
+                      AND (p_since IS NULL OR dm.last_seen >= p_since)
+                      AND (p_until IS NULL OR dm.first_seen <= p_until)) connected
+              WHERE connected.host != ALL (l.reached)
+              ORDER BY connected.host
+              LIMIT p_max_hosts - cardinality(l.reached)) c) n
+    WHERE l.depth < p_depth
+      AND cardinality(l.reached) < p_max_hosts
+      AND n.hosts IS NOT NULL),
+hosts AS (SELECT unnest(frontier) AS host, depth FROM levels)
+SELECT dm.referer_host,
+       dm.destination_host,
+       CASE p_direction
+           WHEN 'outbound' THEN r.depth
+           WHEN 'inbound' THEN d.depth
+           ELSE least(r.depth, d.depth) END + 1,
+       min(dm.first_seen),
+       max(dm.last_seen)
+FROM data_mapper dm
+         JOIN hosts r ON r.host = dm.referer_host
+         JOIN hosts d ON d.host = dm.destination_host
+WHERE dm.referer_host != dm.destination_host
+  AND (p_since IS NULL OR dm.last_seen >= p_since)
+  AND (p_until IS NULL OR dm.first_seen <= p_until)
+  AND ((p_direction IN ('outbound', 'both') AND r.depth < p_depth) OR
+       (p_direction IN ('inbound', 'both') AND d.depth < p_depth))
+GROUP BY dm.referer_host, dm.destination_host, r.depth, d.depth
+ORDER BY 3, 1, 2;
 $$;
 
-create or replace function get_connected_hosts(p_hosts text[])
+create or replace function get_connected_hosts(p_hosts text[], p_since timestamp with time zone,
+                                               p_until timestamp with time zone)
     returns TABLE
             (
-                ref_host  text,
-                dest_host text
+                ref_host   text,
+                dest_host  text,
+                first_seen timestamp with time zone,
+                last_seen  timestamp with time zone
             )
     language plpgsql
 as
 $$
 BEGIN
     RETURN QUERY
-        (
-            -- When the given host is the referer_host
-            SELECT referer_host     AS ref_host,
-                   destination_host AS dest_host
-            FROM data_mapper
-            WHERE referer_host = ANY (p_hosts)
-              AND destination_host <> ''
-              AND referer_host <> destination_host)
-        UNION
-        (
-            -- When the given host is the destination_host
-            SELECT referer_host     AS ref_host,
-                   destination_host AS dest_host
-            FROM data_mapper
-            WHERE destination_host = ANY (p_hosts)
-              AND referer_host <> ''
-              AND referer_host <> destination_host)
-        ORDER BY ref_host, dest_host;
+        SELECT dm.referer_host     AS ref_host,
+               dm.destination_host AS dest_host,
+               min(dm.first_seen),
+               max(dm.last_seen)
+        FROM data_mapper dm
+        WHERE (dm.referer_host = ANY (p_hosts) OR dm.destination_host = ANY (p_hosts))
+          AND dm.referer_host <> ''
+          AND dm.destination_host <> ''
+          AND dm.referer_host <> dm.destination_host
+          AND (p_since IS NULL OR dm.last_seen >= p_since)
+          AND (p_until IS NULL OR dm.first_seen <= p_until)
+        GROUP BY dm.referer_host, dm.destination_host
+        ORDER BY 1, 2;
 END;
 $$;
 
-create or replace function get_paths_and_connected_hosts(p_hosts text[])
+create or replace function get_paths_and_connected_hosts(p_hosts text[], p_since timestamp with time zone,
+                                                         p_until timestamp with time zone)
     returns TABLE
             (
                 source      text,
-                destination text
+                destination text,
+                first_seen  timestamp with time zone,
+                last_seen   timestamp with time zone
             )
     language plpgsql
 as
 $$
 BEGIN
     RETURN QUERY
-        -- When the given host is the referer_host
-        SELECT DISTINCT ON (source, destination) CASE
-                                                     WHEN referer_host = ANY (p_hosts)
-                                                         THEN referer_host || CASE WHEN referer_path = '/' THEN '' ELSE referer_path END
-                                                     ELSE referer_host
-                                                     END AS source,
-                                                 CASE
-                                                     WHEN destination_host = ANY (p_hosts) THEN destination_host || CASE
-                                                                                                                        WHEN destination_path = '/'
-                                                                                                                            THEN ''
-                                                                                                                        ELSE destination_path END
-                                                     ELSE destination_host
-                                                     END AS destination
-        FROM data_mapper
-        WHERE referer_host = ANY (p_hosts)
-           OR destination_host = ANY (p_hosts)
-            AND referer_host != destination_host
-            AND destination != ''
-            AND source != ''
-        ORDER BY source, destination;
+        SELECT sub.source, sub.destination, min(sub.first_seen), max(sub.last_seen)
+        FROM (SELECT CASE
+                         WHEN dm.referer_host = ANY (p_hosts)
+                             THEN dm.referer_host || CASE WHEN dm.referer_path = '/' THEN '' ELSE dm.referer_path END
+                         ELSE dm.referer_host
+                         END AS source,
+                     CASE
+                         WHEN dm.destination_host = ANY (p_hosts)
+                             THEN dm.destination_host || CASE WHEN dm.destination_path = '/' THEN '' ELSE dm.destination_path END
+                         ELSE dm.destination_host
+                         END AS destination,
+                     dm.first_seen,
+                     dm.last_seen
+              FROM data_mapper dm
+              WHERE (dm.referer_host = ANY (p_hosts) OR dm.destination_host = ANY (p_hosts))
+                AND dm.referer_host != ''
+                AND dm.destination_host != ''
+                AND (p_since IS NULL OR dm.last_seen >= p_since)
+                AND (p_until IS NULL OR dm.first_seen <= p_until)) AS sub
+        WHERE sub.source != sub.destination
+        GROUP BY sub.source, sub.destination
+        ORDER BY sub.source, sub.destination;
 END;
 $$;
 
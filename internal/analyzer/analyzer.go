@@ -8,15 +8,17 @@ import (
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	log "github.com/sirupsen/logrus"
 
 	"github.com/TheHackerDev/cartograph/internal/config"
 	"github.com/TheHackerDev/cartograph/internal/shared/database"
 	"github.com/TheHackerDev/cartograph/internal/shared/datatypes"
+	"github.com/TheHackerDev/cartograph/internal/shared/dispatch"
+	"github.com/TheHackerDev/cartograph/internal/shared/metrics"
 )
 
 const (
-	corpusDataBufferSize int = 100
-	corpusDataCacheSize  int = 40
+	corpusDataCacheSize int = 40
 )
 
 // Namespace value used for all UUIDv5 functions in database, for analyzer-related data.
@@ -31,8 +33,9 @@ func NewAnalyzer(cfg *config.Config) (*Analyzer, error) {
 		mu:              sync.RWMutex{},
 		enabled:         true,
 		training:        cfg.TrainingMode,
-		corpusDataInput: make(chan *datatypes.HttpReqResp, corpusDataBufferSize),
 		corpusDataCache: make([]*datatypes.CorpusData, 0, corpusDataCacheSize),
+		stop:            make(chan struct{}),
+		stopped:         make(chan struct{}),
 	}
 
 	// Get database connections
@@ -40,6 +43,7 @@ func NewAnalyzer(cfg *config.Config) (*Analyzer, error) {
 	if dbConnPoolErr != nil {
 		return nil, fmt.Errorf("unable to get database connection pool: %w", dbConnPoolErr)
 	}
+	metrics.RegisterDbPool("analyzer", dbConnPool)
 	listenDbConn, listenDbConnErr := database.GetDbConn(cfg.DbConnString)
 	if listenDbConnErr != nil {
 		return nil, fmt.Errorf("unable to get listen database connection: %w", listenDbConnErr)
@@ -49,6 +53,12 @@ func NewAnalyzer(cfg *config.Config) (*Analyzer, error) {
 	analyzer.dbConnPool = dbConnPool
 	analyzer.listenDbConn = listenDbConn
 
+	// Create the input queue
+	var queueErr error
+	if analyzer.corpusDataInput, queueErr = dispatch.NewQueue[*datatypes.HttpReqResp]("analyzer", cfg.AnalyzerQueue); queueErr != nil {
+		return nil, fmt.Errorf("unable to create corpus data input queue: %w", queueErr)
+	}
+
 	return analyzer, nil
 }
 
@@ -72,15 +82,27 @@ type Analyzer struct {
 	listenDbConn *pgx.Conn
 
 	// corpusDataInput is used to accept corpus data that will be saved to the database for training.
-	corpusDataInput chan *datatypes.HttpReqResp
+	corpusDataInput *dispatch.Queue[*datatypes.HttpReqResp]
 
 	// corpusDataCache is used to temporarily cache corpus data before sending it to the database in a batch copy.
 	corpusDataCache []*datatypes.CorpusData
+
+	// stop is closed to signal the Run loop to flush its cache and return.
+	stop chan struct{}
+
+	// stopped is closed by the Run loop once its cache has been flushed.
+	stopped chan struct{}
+
+	// stopOnce ensures the stop channel is only closed once.
+	stopOnce sync.Once
 }
 
 // Run runs the analyzer plugin.
 // Any errors returned should be considered fatal.
 func (a *Analyzer) Run() error {
+	// Signal Stop once the loop has returned
+	defer close(a.stopped)
+
 	// Create a ticker for flushing out the local caches.
 	// Use a random interval to prevent bottlenecks in the database by competing services.
 	// The random time is anywhere between 40 and 120 seconds.
@@ -89,26 +111,69 @@ func (a *Analyzer) Run() error {
 	// Handle referred data sent to the analyzer
 	for {
 		select {
-		case httpReqResp := <-a.corpusDataInput:
-			// Make a deep copy of the http request/response data, so we can safely modify it,
-			// as this same data is referenced elsewhere.
-			data := httpReqResp.DeepCopy()
-
-			// Convert to proper corpus data type
-			corpusData := datatypes.CorpusDataFromReqResp(&data)
-
-			// Add the corpus data to the cache
-			a.saveToCorpusCache(corpusData)
-
-			// If the cache is full, flush it to the database, then clear the cache
-			if len(a.corpusDataCache) >= corpusDataCacheSize {
-				a.saveCorpusCacheToDatabase()
-				a.clearCorpusCache()
+		case <-a.stop:
+			// Stop reading spilled data back into the input queue, handle any data still waiting in memory, then
+			// flush the cache to the database
+			if closeErr := a.corpusDataInput.Close(); closeErr != nil {
+				log.WithError(closeErr).Error("unable to close corpus data input queue")
 			}
+			for drained := false; !drained; {
+				select {
+				case httpReqResp := <-a.corpusDataInput.Items():
+					a.handleCorpusData(httpReqResp)
+				default:
+					drained = true
+				}
+			}
+			a.flushCorpusCache()
+			return nil
+		case httpReqResp := <-a.corpusDataInput.Items():
+			a.handleCorpusData(httpReqResp)
 		case <-cacheFlushTicker.C:
 			// Flush the cache to the database, then clear the cache
-			a.saveCorpusCacheToDatabase()
-			a.clearCorpusCache()
+			a.flushCorpusCache()
 		}
 	}
 }
+
+// Stop signals the analyzer plugin to stop, and blocks until all cached data has been saved to the database.
+// It must only be called after Run has been started.
+func (a *Analyzer) Stop() {
+	a.stopOnce.Do(func() {
+		close(a.stop)
+	})
+	<-a.stopped
+}
+
+// handleCorpusData converts the given HTTP data to corpus data and adds it to the cache, saving the cache to the
+// database once it is full.
+func (a *Analyzer) handleCorpusData(httpReqResp *datatypes.HttpReqResp) {
+	// Make a deep copy of the http request/response data, so we can safely modify it,
+	// as this same data is referenced elsewhere.
+	data := httpReqResp.DeepCopy()
+
+	// Convert to proper corpus data type
+	corpusData := datatypes.CorpusDataFromReqResp(&data)
+
+	// Add the corpus data to the cache
+	a.saveToCorpusCache(corpusData)
+
+	// If the cache is full, flush it to the database, then clear the cache
+	if len(a.corpusDataCache) >= corpusDataCacheSize {
+		a.flushCorpusCache()
+	}
+}
+
+// flushCorpusCache saves the corpus data cache to the database, records the flush in the input queue statistics,
+// then clears the cache.
+func (a *Analyzer) flushCorpusCache() {
+	start := time.Now()
+	saveErr := a.saveCorpusCacheToDatabase()
+	a.corpusDataInput.RecordFlush(len(a.corpusDataCache), time.Since(start), saveErr)
+	a.clearCorpusCache()
+}
+
+// QueueStats returns the statistics for the analyzer's input queue.
+func (a *Analyzer) QueueStats() []dispatch.Stats {
+	return []dispatch.Stats{a.corpusDataInput.Stats()}
+}
@@ -2,6 +2,7 @@ package analyzer
 
 import (
 	"context"
+	"fmt"
 
 	log "github.com/sirupsen/logrus"
 
@@ -15,8 +16,8 @@ func (a *Analyzer) LogCorpusData(httpReqResp *datatypes.HttpReqResp) {
 		return
 	}
 
-	// Send the corpus data to the input channel
-	a.corpusDataInput <- httpReqResp
+	// Send the corpus data to the input queue, which does not block
+	a.corpusDataInput.Enqueue(httpReqResp)
 }
 
 // saveToCorpusCache saves the given corpus data to the cache.
@@ -28,7 +29,8 @@ func (a *Analyzer) saveToCorpusCache(corpusData *datatypes.CorpusData) {
 }
 
 // saveCorpusCacheToDatabase saves the corpus data cache to the database.
-func (a *Analyzer) saveCorpusCacheToDatabase() {
+// All errors are logged by this function. An error is returned if any corpus data could not be fully saved.
+func (a *Analyzer) saveCorpusCacheToDatabase() error {
 	ctx := context.Background()
 
 	// Lock the mutex, so we can safely access the cache
@@ -36,6 +38,7 @@ func (a *Analyzer) saveCorpusCacheToDatabase() {
 	defer a.mu.RUnlock()
 
 	// Iterate through the cache and save the data to the database
+	failed := 0
 	for _, corpusData := range a.corpusDataCache {
 		// Save the URL path parts to the database
 		_, saveUrlPathPartsErr := a.dbConnPool.Exec(ctx, `INSERT INTO corpus_url_path_parts (name, count)
@@ -90,7 +93,17 @@ func (a *Analyzer) saveCorpusCacheToDatabase() {
 		if saveCookieKeysErr != nil {
 			log.WithError(saveCookieKeysErr).WithField("keys", corpusData.CookieKeys).Error("unable to save cookie keys to database")
 		}
+
+		if saveUrlPathPartsErr != nil || saveHeaderKeysErr != nil || saveUrlQueryKeysErr != nil || saveServerHeaderValueErr != nil || saveCookieKeysErr != nil {
+			failed++
+		}
 	}
+
+	if failed > 0 {
+		return fmt.Errorf("unable to fully save %d of %d corpus data items to database", failed, len(a.corpusDataCache))
+	}
+
+	return nil
 }
 
 func (a *Analyzer) clearCorpusCache() {
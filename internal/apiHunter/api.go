@@ -0,0 +1,111 @@
+package apiHunter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	internalHttp "github.com/TheHackerDev/cartograph/internal/shared/http"
+)
+
+// grpcDescriptorsPathRegex matches the gRPC descriptors API path, with an optional descriptor set UUID.
+var grpcDescriptorsPathRegex = regexp.MustCompile(`(?i)/grpc/descriptors/?(?P<uuid>[0-9a-zA-Z]{8}-[0-9a-zA-Z]{4}-[0-9a-zA-Z]{4}-[0-9a-zA-Z]{4}-[0-9a-zA-Z]{12})?/?$`)
+
+// GrpcDescriptorsAPIHandler is an HTTP handler for managing the protobuf descriptor sets used to fully decode gRPC
+// messages. Requests are expected to be sent to a path ending in "/grpc/descriptors/[uuid]", where the "[uuid]" is
+// an optional descriptor set identifier.
+//
+// GET requests return the metadata for all uploaded descriptor sets.
+// POST requests upload a serialized FileDescriptorSet in the request body (e.g. from "protoc --descriptor_set_out
+// --include_imports"), named by the "name" URL query parameter.
+// DELETE requests remove the descriptor set with the given UUID.
+func (ah *APIHunter) GrpcDescriptorsAPIHandler(w http.ResponseWriter, r *http.Request) {
+	// Get the UUID from the request path, if one is provided
+	matches := grpcDescriptorsPathRegex.FindStringSubmatch(r.URL.Path)
+	if matches == nil {
+		http.Error(w, fmt.Sprintf("invalid path provided: %q", r.URL.Path), http.StatusBadRequest)
+		return
+	}
+	id := matches[grpcDescriptorsPathRegex.SubexpIndex("uuid")]
+
+	switch r.Method {
+	case http.MethodGet:
+		// Marshal values to JSON to send in the response
+		descriptorSetsJson, marshalErr := json.Marshal(ah.getGrpcDescriptorSets())
+		if marshalErr != nil {
+			http.Error(w, fmt.Sprintf("unable to convert gRPC descriptor sets to JSON: %s", marshalErr), http.StatusInternalServerError)
+			return
+		}
+
+		// Set the appropriate header for the content type in the response
+		w.Header().Set("Content-Type", "application/json")
+
+		// Write the response
+		if _, writeErr := w.Write(descriptorSetsJson); writeErr != nil {
+			http.Error(w, fmt.Sprintf("problem writing JSON response back: %s", writeErr), http.StatusInternalServerError)
+			return
+		}
+	case http.MethodPost:
+		// Ensure a name was provided for the descriptor set
+		name := strings.TrimSpace(r.URL.Query().Get("name"))
+		if name == "" {
+			http.Error(w, "no descriptor set name provided in \"name\" query parameter", http.StatusBadRequest)
+			return
+		}
+
+		// Read the serialized descriptor set
+		reqBody, bodyCopy, bodyReadErr := internalHttp.ReadBody(r.Body)
+		r.Body = bodyCopy
+		if bodyReadErr != nil {
+			http.Error(w, fmt.Sprintf("unable to read request body: %s", bodyReadErr), http.StatusInternalServerError)
+			return
+		}
+		if len(reqBody) == 0 {
+			http.Error(w, "no descriptor set provided in request body", http.StatusBadRequest)
+			return
+		}
+
+		// Save the descriptor set
+		descriptorSetID, addErr := ah.addGrpcDescriptorSet(name, reqBody)
+		if addErr != nil {
+			http.Error(w, fmt.Sprintf("unable to add gRPC descriptor set: %s", addErr), http.StatusBadRequest)
+			return
+		}
+
+		// Marshal the new descriptor set ID into JSON
+		jResponse, responseMarshalErr := json.Marshal(map[string]string{"id": descriptorSetID})
+		if responseMarshalErr != nil {
+			http.Error(w, fmt.Sprintf("unable to convert response to JSON: %s", responseMarshalErr), http.StatusInternalServerError)
+			return
+		}
+
+		// Set the appropriate headers in the response
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+
+		// Write the response
+		if _, writeErr := w.Write(jResponse); writeErr != nil {
+			http.Error(w, fmt.Sprintf("problem writing JSON response back: %s", writeErr), http.StatusInternalServerError)
+			return
+		}
+	case http.MethodDelete:
+		// Check for empty ID value
+		if id == "" {
+			http.Error(w, "no descriptor set ID provided in request URL path", http.StatusBadRequest)
+			return
+		}
+
+		if removeErr := ah.removeGrpcDescriptorSet(id); removeErr != nil {
+			http.Error(w, fmt.Sprintf("unable to remove gRPC descriptor set with ID %q: %s", id, removeErr), http.StatusInternalServerError)
+			return
+		}
+	case http.MethodOptions:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "invalid HTTP request method: "+r.Method, http.StatusMethodNotAllowed)
+	}
+}
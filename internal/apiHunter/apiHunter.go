@@ -5,23 +5,61 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"sync"
 
+	"github.com/jackc/pgx/v5/pgxpool"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	"github.com/TheHackerDev/cartograph/internal/config"
+	"github.com/TheHackerDev/cartograph/internal/shared/database"
 	"github.com/TheHackerDev/cartograph/internal/shared/datatypes"
 	internalHttp "github.com/TheHackerDev/cartograph/internal/shared/http"
+	"github.com/TheHackerDev/cartograph/internal/shared/metrics"
 )
 
-// NewAPIHunter returns a new APIHunter object.
-func NewAPIHunter() *APIHunter {
-	return &APIHunter{
+// NewAPIHunter returns a new APIHunter object using the given configuration.
+//
+// Any errors returned should be considered fatal.
+func NewAPIHunter(cfg *config.Config) (*APIHunter, error) {
+	apiHunter := &APIHunter{
+		mu: sync.RWMutex{},
 		// TODO: Add this to the config database table, and pull this value from there.
 		enabled: true,
 	}
+
+	// Get a database connection pool
+	dbConnPool, dbConnPoolErr := database.GetDbConnPool(cfg.DbConnString)
+	if dbConnPoolErr != nil {
+		return nil, fmt.Errorf("unable to get database connection pool: %w", dbConnPoolErr)
+	}
+	metrics.RegisterDbPool("api-hunter", dbConnPool)
+	apiHunter.dbConnPool = dbConnPool
+
+	// Load the uploaded gRPC descriptor sets
+	if loadErr := apiHunter.loadGrpcDescriptors(); loadErr != nil {
+		return nil, fmt.Errorf("unable to load gRPC descriptor sets: %w", loadErr)
+	}
+
+	return apiHunter, nil
 }
 
 // APIHunter is a module that is responsible for hunting for API endpoints.
 // An APIHunter object should *always* be instantiated via the NewAPIHunter function.
 type APIHunter struct {
+	// mu is a RWMutex to control concurrent access.
+	mu sync.RWMutex
+
 	enabled bool
+
+	// dbConnPool is a database connection pool used for concurrency-safe database connections.
+	dbConnPool *pgxpool.Pool
+
+	// grpcFiles is the registry of protobuf files from all uploaded descriptor sets, used to fully decode
+	// gRPC messages.
+	grpcFiles *protoregistry.Files
+
+	// grpcDescriptorSets holds the metadata for all uploaded descriptor sets.
+	grpcDescriptorSets []GrpcDescriptorSet
 }
 
 // Run starts the APIHunter module.
@@ -36,6 +74,28 @@ func (ah *APIHunter) AddAPIRequestData(reqResp *datatypes.HttpReqResp, request *
 		return nil
 	}
 
+	// Look for gRPC and gRPC-Web request bodies
+	if ct, isGrpc := parseGrpcContentType(request.Header.Get("Content-Type")); isGrpc {
+		service, method, pathOk := grpcMethodFromPath(request.URL.Path)
+		if pathOk {
+			reqResp.Request.GrpcService = service
+			reqResp.Request.GrpcMethod = method
+		}
+
+		body, bodyCopy, readErr := internalHttp.ReadBody(request.Body)
+		request.Body = bodyCopy
+		if readErr != nil {
+			return fmt.Errorf("unable to read body of HTTP request: %w", readErr)
+		}
+
+		bodyJson, decodeErr := ah.decodeGrpcBody(body, ct, request.Header.Get("Grpc-Encoding"), service, method, true)
+		if decodeErr != nil {
+			return fmt.Errorf("unable to decode gRPC request body: %w", decodeErr)
+		}
+		reqResp.Request.BodyJson = bodyJson
+		return nil
+	}
+
 	// Look for text/plain request body
 	for _, val := range request.Header.Values("Content-Type") {
 		if strings.EqualFold(val, "text/plain") {
@@ -75,6 +135,27 @@ func (ah *APIHunter) AddAPIResponseData(reqResp *datatypes.HttpReqResp, response
 		return nil
 	}
 
+	// Look for gRPC and gRPC-Web response bodies
+	if ct, isGrpc := parseGrpcContentType(response.Header.Get("Content-Type")); isGrpc {
+		body, bodyCopy, readErr := internalHttp.ReadBody(response.Body)
+		response.Body = bodyCopy
+		if readErr != nil {
+			return fmt.Errorf("unable to read body of HTTP response: %w", readErr)
+		}
+
+		// Trailers-only responses have no body
+		if len(body) == 0 {
+			return nil
+		}
+
+		bodyJson, decodeErr := ah.decodeGrpcBody(body, ct, response.Header.Get("Grpc-Encoding"), reqResp.Request.GrpcService, reqResp.Request.GrpcMethod, false)
+		if decodeErr != nil {
+			return fmt.Errorf("unable to decode gRPC response body: %w", decodeErr)
+		}
+		reqResp.Response.BodyJson = bodyJson
+		return nil
+	}
+
 	// Look for text/plain response body
 	for _, val := range response.Header.Values("Content-Type") {
 		if strings.EqualFold(val, "text/plain") {
@@ -0,0 +1,239 @@
+package apiHunter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Namespace value used for all UUIDv5 functions in database, for API hunter-related data.
+const uuidNameSpace string = "6b1f3d0e-94a4-4c55-8d0f-3c1f5e2a7b9d"
+
+// GrpcDescriptorSet holds the metadata for an uploaded protobuf descriptor set.
+type GrpcDescriptorSet struct {
+	ID       string    `json:"id"`
+	Name     string    `json:"name"`
+	Uploaded time.Time `json:"uploaded"`
+
+	// Services holds the fully-qualified names of all services defined in the descriptor set.
+	Services []string `json:"services"`
+}
+
+// loadGrpcDescriptors loads all uploaded descriptor sets from the database, and rebuilds the registry used to
+// fully decode gRPC messages.
+func (ah *APIHunter) loadGrpcDescriptors() error {
+	rows, queryErr := ah.dbConnPool.Query(context.Background(), `SELECT id::text, name, descriptor_set, uploaded FROM api_hunter_grpc_descriptors ORDER BY uploaded;`)
+	if queryErr != nil {
+		return fmt.Errorf("unable to query gRPC descriptor sets from database: %w", queryErr)
+	}
+	defer rows.Close()
+
+	files := new(protoregistry.Files)
+	var descriptorSets []GrpcDescriptorSet
+	for rows.Next() {
+		var set GrpcDescriptorSet
+		var raw []byte
+		if scanErr := rows.Scan(&set.ID, &set.Name, &raw, &set.Uploaded); scanErr != nil {
+			return fmt.Errorf("unable to scan gRPC descriptor set from database: %w", scanErr)
+		}
+
+		// A single bad descriptor set should not prevent the others from being used
+		services, registerErr := registerDescriptorSet(files, raw)
+		if registerErr != nil {
+			log.WithError(registerErr).WithField("name", set.Name).Error("unable to register gRPC descriptor set")
+		}
+		set.Services = services
+		descriptorSets = append(descriptorSets, set)
+	}
+	if rowsErr := rows.Err(); rowsErr != nil {
+		return fmt.Errorf("unable to read gRPC descriptor sets from database: %w", rowsErr)
+	}
+
+	ah.mu.Lock()
+	ah.grpcFiles = files
+	ah.grpcDescriptorSets = descriptorSets
+	ah.mu.Unlock()
+
+	return nil
+}
+
+// registerDescriptorSet parses the given serialized FileDescriptorSet and adds its files to the given registry.
+// Files that are already registered are skipped. The names of all services defined in the set are returned.
+func registerDescriptorSet(files *protoregistry.Files, raw []byte) ([]string, error) {
+	var set descriptorpb.FileDescriptorSet
+	if unmarshalErr := proto.Unmarshal(raw, &set); unmarshalErr != nil {
+		return nil, fmt.Errorf("unable to parse FileDescriptorSet: %w", unmarshalErr)
+	}
+
+	// Resolve the files in this set against each other first, so the order of files within the set does not matter
+	setFiles, newFilesErr := protodesc.NewFiles(&set)
+	if newFilesErr != nil {
+		return nil, fmt.Errorf("unable to resolve files in FileDescriptorSet: %w", newFilesErr)
+	}
+
+	services := []string{}
+	var registerErr error
+	setFiles.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		for i := 0; i < fd.Services().Len(); i++ {
+			services = append(services, string(fd.Services().Get(i).FullName()))
+		}
+		if _, findErr := files.FindFileByPath(fd.Path()); findErr == nil {
+			return true
+		}
+		if err := files.RegisterFile(fd); err != nil {
+			registerErr = fmt.Errorf("unable to register file %q: %w", fd.Path(), err)
+		}
+		return true
+	})
+
+	return services, registerErr
+}
+
+// decodeGrpcMessageWithDescriptor decodes a single gRPC message using the uploaded descriptor sets.
+// The input value is true for request messages, and false for response messages.
+// The second return value is false if there is no descriptor for the given method, or decoding failed.
+func (ah *APIHunter) decodeGrpcMessageWithDescriptor(service string, method string, input bool, data []byte) (json.RawMessage, bool) {
+	ah.mu.RLock()
+	files := ah.grpcFiles
+	ah.mu.RUnlock()
+	if files == nil || service == "" {
+		return nil, false
+	}
+
+	// Find the method descriptor
+	desc, findErr := files.FindDescriptorByName(protoreflect.FullName(service))
+	if findErr != nil {
+		return nil, false
+	}
+	serviceDesc, ok := desc.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, false
+	}
+	methodDesc := serviceDesc.Methods().ByName(protoreflect.Name(method))
+	if methodDesc == nil {
+		return nil, false
+	}
+
+	// Decode the message using the input or output type of the method
+	messageDesc := methodDesc.Output()
+	if input {
+		messageDesc = methodDesc.Input()
+	}
+	message := dynamicpb.NewMessage(messageDesc)
+	if unmarshalErr := (proto.UnmarshalOptions{Resolver: dynamicResolver{files: files}}).Unmarshal(data, message); unmarshalErr != nil {
+		return nil, false
+	}
+	messageJson, marshalErr := (protojson.MarshalOptions{Resolver: dynamicResolver{files: files}}).Marshal(message)
+	if marshalErr != nil {
+		return nil, false
+	}
+
+	return messageJson, true
+}
+
+// addGrpcDescriptorSet validates and saves the given serialized FileDescriptorSet, returning its ID.
+func (ah *APIHunter) addGrpcDescriptorSet(name string, raw []byte) (string, error) {
+	// Ensure the descriptor set is valid before saving it
+	if _, registerErr := registerDescriptorSet(new(protoregistry.Files), raw); registerErr != nil {
+		return "", registerErr
+	}
+
+	var id string
+	if insertErr := ah.dbConnPool.QueryRow(context.Background(), `INSERT INTO api_hunter_grpc_descriptors (id, name, descriptor_set)
+		VALUES (uuid_generate_v5($1, $2), $2, $3)
+		ON CONFLICT (id) DO UPDATE SET descriptor_set = excluded.descriptor_set, uploaded = now()
+		RETURNING id::text;`, uuidNameSpace, name, raw).Scan(&id); insertErr != nil {
+		return "", fmt.Errorf("unable to save gRPC descriptor set to database: %w", insertErr)
+	}
+
+	if loadErr := ah.loadGrpcDescriptors(); loadErr != nil {
+		return id, fmt.Errorf("unable to reload gRPC descriptor sets: %w", loadErr)
+	}
+
+	return id, nil
+}
+
+// removeGrpcDescriptorSet removes the descriptor set with the given ID.
+func (ah *APIHunter) removeGrpcDescriptorSet(id string) error {
+	if _, deleteErr := ah.dbConnPool.Exec(context.Background(), `DELETE FROM api_hunter_grpc_descriptors WHERE id = $1;`, id); deleteErr != nil {
+		return fmt.Errorf("unable to delete gRPC descriptor set from database: %w", deleteErr)
+	}
+
+	if loadErr := ah.loadGrpcDescriptors(); loadErr != nil {
+		return fmt.Errorf("unable to reload gRPC descriptor sets: %w", loadErr)
+	}
+
+	return nil
+}
+
+// getGrpcDescriptorSets returns the metadata for all uploaded descriptor sets.
+func (ah *APIHunter) getGrpcDescriptorSets() []GrpcDescriptorSet {
+	ah.mu.RLock()
+	defer ah.mu.RUnlock()
+
+	descriptorSets := make([]GrpcDescriptorSet, len(ah.grpcDescriptorSets))
+	copy(descriptorSets, ah.grpcDescriptorSets)
+
+	return descriptorSets
+}
+
+// dynamicResolver resolves message and extension types from a descriptor registry, using dynamic messages.
+// This is needed to decode and print google.protobuf.Any fields and extensions defined in uploaded descriptors.
+type dynamicResolver struct {
+	files *protoregistry.Files
+}
+
+// FindMessageByName conforms to the protoregistry.MessageTypeResolver interface.
+func (r dynamicResolver) FindMessageByName(name protoreflect.FullName) (protoreflect.MessageType, error) {
+	desc, findErr := r.files.FindDescriptorByName(name)
+	if findErr != nil {
+		return protoregistry.GlobalTypes.FindMessageByName(name)
+	}
+	messageDesc, ok := desc.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, protoregistry.NotFound
+	}
+
+	return dynamicpb.NewMessageType(messageDesc), nil
+}
+
+// FindMessageByURL conforms to the protoregistry.MessageTypeResolver interface.
+func (r dynamicResolver) FindMessageByURL(url string) (protoreflect.MessageType, error) {
+	name := url
+	if i := strings.LastIndexByte(url, '/'); i >= 0 {
+		name = url[i+1:]
+	}
+
+	return r.FindMessageByName(protoreflect.FullName(name))
+}
+
+// FindExtensionByName conforms to the protoregistry.ExtensionTypeResolver interface.
+func (r dynamicResolver) FindExtensionByName(field protoreflect.FullName) (protoreflect.ExtensionType, error) {
+	desc, findErr := r.files.FindDescriptorByName(field)
+	if findErr != nil {
+		return protoregistry.GlobalTypes.FindExtensionByName(field)
+	}
+	extensionDesc, ok := desc.(protoreflect.ExtensionDescriptor)
+	if !ok {
+		return nil, protoregistry.NotFound
+	}
+
+	return dynamicpb.NewExtensionType(extensionDesc), nil
+}
+
+// FindExtensionByNumber conforms to the protoregistry.ExtensionTypeResolver interface.
+// Extensions are rare in gRPC APIs, so only the global registry is searched by number.
+func (r dynamicResolver) FindExtensionByNumber(message protoreflect.FullName, field protoreflect.FieldNumber) (protoreflect.ExtensionType, error) {
+	return protoregistry.GlobalTypes.FindExtensionByNumber(message, field)
+}
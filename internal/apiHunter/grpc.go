@@ -0,0 +1,402 @@
+package apiHunter
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// grpcFrameHeaderSize is the size of the header before every length-prefixed gRPC message: one flags byte,
+// followed by a four-byte big-endian message length.
+const grpcFrameHeaderSize int = 5
+
+// Flag bits set in the first byte of a gRPC frame header.
+const (
+	grpcFlagCompressed byte = 0x01
+	grpcFlagTrailer    byte = 0x80
+)
+
+// grpcMaxMessageSize is the size of the largest gRPC message that is decoded, in bytes, before or after
+// decompression. It matches the default maximum received message size of the gRPC implementations.
+const grpcMaxMessageSize int = 4 << 20
+
+// errGrpcMessageTooLarge is returned when a decompressed gRPC message is larger than the maximum message size.
+var errGrpcMessageTooLarge = errors.New("decompressed gRPC message is larger than the maximum message size")
+
+// grpcMaxNestingDepth limits how deeply the schemaless decoder will attempt to decode nested messages.
+const grpcMaxNestingDepth int = 32
+
+// grpcContentType describes the gRPC variant indicated by a Content-Type header.
+type grpcContentType struct {
+	// web is true for gRPC-Web, which carries trailers in a final frame in the body.
+	web bool
+
+	// text is true for the base64-encoded gRPC-Web variant (application/grpc-web-text).
+	text bool
+}
+
+// parseGrpcContentType returns the gRPC variant for the given Content-Type header value.
+// The second return value is false if the content type is not a protobuf-encoded gRPC or gRPC-Web type.
+func parseGrpcContentType(contentType string) (grpcContentType, bool) {
+	mediaType, _, parseErr := mime.ParseMediaType(contentType)
+	if parseErr != nil {
+		return grpcContentType{}, false
+	}
+
+	switch mediaType {
+	case "application/grpc", "application/grpc+proto":
+		return grpcContentType{}, true
+	case "application/grpc-web", "application/grpc-web+proto":
+		return grpcContentType{web: true}, true
+	case "application/grpc-web-text", "application/grpc-web-text+proto":
+		return grpcContentType{web: true, text: true}, true
+	default:
+		return grpcContentType{}, false
+	}
+}
+
+// grpcMethodFromPath extracts the service and method names from a gRPC request path, which always takes the
+// form "/package.Service/Method".
+// The third return value is false if the path does not match that form.
+func grpcMethodFromPath(path string) (service string, method string, ok bool) {
+	service, method, found := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	if !found || service == "" || method == "" || strings.Contains(method, "/") {
+		return "", "", false
+	}
+
+	return service, method, true
+}
+
+// grpcFrame is a single length-prefixed message in a gRPC or gRPC-Web body.
+type grpcFrame struct {
+	// compressed is true if the message payload is compressed using the algorithm in the grpc-encoding header.
+	compressed bool
+
+	// trailer is true for gRPC-Web trailer frames, whose payload is a block of HTTP/1-style headers.
+	trailer bool
+
+	// data is the frame payload.
+	data []byte
+}
+
+// parseGrpcFrames splits the given body into its length-prefixed gRPC frames.
+// An error is returned if the body is truncated or otherwise malformed.
+func parseGrpcFrames(body []byte) ([]grpcFrame, error) {
+	var frames []grpcFrame
+
+	for len(body) > 0 {
+		if len(body) < grpcFrameHeaderSize {
+			return frames, fmt.Errorf("truncated gRPC frame header: %d bytes remaining", len(body))
+		}
+
+		flags := body[0]
+		length := binary.BigEndian.Uint32(body[1:grpcFrameHeaderSize])
+		body = body[grpcFrameHeaderSize:]
+		if uint64(length) > uint64(grpcMaxMessageSize) {
+			return frames, fmt.Errorf("gRPC frame of %d bytes is larger than the maximum message size of %d bytes", length, grpcMaxMessageSize)
+		}
+		if uint64(length) > uint64(len(body)) {
+			return frames, fmt.Errorf("truncated gRPC frame: expected %d bytes, found %d", length, len(body))
+		}
+
+		frames = append(frames, grpcFrame{
+			compressed: flags&grpcFlagCompressed != 0,
+			trailer:    flags&grpcFlagTrailer != 0,
+			data:       body[:length],
+		})
+		body = body[length:]
+	}
+
+	return frames, nil
+}
+
+// decodeGrpcWebText decodes a gRPC-Web text body. Each message may have been base64-encoded separately by the
+// server, so the body can contain several padded base64 chunks concatenated together.
+func decodeGrpcWebText(body []byte) ([]byte, error) {
+	// Remove any whitespace inserted between chunks
+	body = bytes.Join(bytes.Fields(body), nil)
+
+	var decoded []byte
+	for len(body) > 0 {
+		// Find the end of the current chunk, which is either the end of the padding or the end of the body
+		end := bytes.IndexByte(body, '=')
+		if end == -1 {
+			end = len(body)
+		} else {
+			for end < len(body) && body[end] == '=' {
+				end++
+			}
+		}
+
+		chunk := make([]byte, base64.StdEncoding.DecodedLen(end))
+		n, decodeErr := base64.StdEncoding.Decode(chunk, body[:end])
+		if decodeErr != nil {
+			return nil, fmt.Errorf("unable to decode base64 gRPC-Web text chunk: %w", decodeErr)
+		}
+		decoded = append(decoded, chunk[:n]...)
+		body = body[end:]
+	}
+
+	return decoded, nil
+}
+
+// grpcBody is the JSON structure stored for gRPC and gRPC-Web request and response bodies.
+type grpcBody struct {
+	Service string `json:"service"`
+	Method  string `json:"method"`
+
+	// Decoding is "descriptor" when the messages were decoded using an uploaded descriptor set, and "schemaless"
+	// when they were decoded into field-number trees.
+	Decoding string `json:"decoding"`
+
+	Messages []json.RawMessage `json:"messages"`
+
+	// Trailers holds the trailers from a gRPC-Web trailer frame, if present.
+	Trailers map[string]string `json:"trailers,omitempty"`
+
+	// Errors holds any problems found while decoding individual messages.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// decodeGrpcBody decodes the given gRPC or gRPC-Web body into its JSON representation.
+// The input value is true when decoding a request message, and false when decoding a response message.
+// Messages are decoded using the uploaded descriptor sets when the method is known, and schemalessly otherwise.
+func (ah *APIHunter) decodeGrpcBody(body []byte, ct grpcContentType, encoding string, service string, method string, input bool) (json.RawMessage, error) {
+	if ct.text {
+		var decodeErr error
+		body, decodeErr = decodeGrpcWebText(body)
+		if decodeErr != nil {
+			return nil, decodeErr
+		}
+	}
+
+	frames, framesErr := parseGrpcFrames(body)
+	if framesErr != nil && len(frames) == 0 {
+		return nil, framesErr
+	}
+
+	result := grpcBody{
+		Service:  service,
+		Method:   method,
+		Decoding: "schemaless",
+		Messages: []json.RawMessage{},
+	}
+	if framesErr != nil {
+		result.Errors = append(result.Errors, framesErr.Error())
+	}
+
+	for _, frame := range frames {
+		data := frame.data
+
+		// Decompress the frame payload, if needed
+		if frame.compressed {
+			switch strings.ToLower(encoding) {
+			case "gzip":
+				decompressed, decompressErr := decodeGrpcGzip(data)
+				if decompressErr != nil {
+					result.Errors = append(result.Errors, fmt.Sprintf("unable to decompress gzip gRPC message: %s", decompressErr))
+					continue
+				}
+				data = decompressed
+			case "deflate":
+				decompressed, decompressErr := decodeGrpcDeflate(data)
+				if decompressErr != nil {
+					result.Errors = append(result.Errors, fmt.Sprintf("unable to decompress deflate gRPC message: %s", decompressErr))
+					continue
+				}
+				data = decompressed
+			default:
+				result.Errors = append(result.Errors, fmt.Sprintf("unsupported grpc-encoding for compressed message: %q", encoding))
+				continue
+			}
+		}
+
+		// gRPC-Web trailers are sent as a block of HTTP/1-style headers
+		if frame.trailer && ct.web {
+			result.Trailers = parseGrpcWebTrailers(data)
+			continue
+		}
+
+		// Prefer decoding with an uploaded descriptor, falling back to a schemaless decode
+		if decoded, ok := ah.decodeGrpcMessageWithDescriptor(service, method, input, data); ok {
+			result.Decoding = "descriptor"
+			result.Messages = append(result.Messages, decoded)
+			continue
+		}
+		decoded, decodeErr := json.Marshal(decodeProtoSchemaless(data))
+		if decodeErr != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("unable to convert gRPC message to JSON: %s", decodeErr))
+			continue
+		}
+		result.Messages = append(result.Messages, decoded)
+	}
+
+	resultJson, marshalErr := json.Marshal(result)
+	if marshalErr != nil {
+		return nil, fmt.Errorf("unable to convert decoded gRPC body to JSON: %w", marshalErr)
+	}
+
+	return resultJson, nil
+}
+
+// parseGrpcWebTrailers parses the header block from a gRPC-Web trailer frame.
+func parseGrpcWebTrailers(data []byte) map[string]string {
+	trailers := make(map[string]string)
+	for _, line := range strings.Split(string(data), "\r\n") {
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		trailers[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+	}
+
+	return trailers
+}
+
+// decodeProtoSchemaless decodes the given protobuf message without a schema, into a tree keyed by field number.
+// Each field maps to a list of values, as any field may be repeated.
+// Values are decoded as follows:
+//   - varint, fixed32, and fixed64 fields are returned as unsigned integers.
+//   - Length-delimited fields are returned as strings if they are printable text, as nested trees if they are
+//     valid messages, and as base64-encoded bytes otherwise.
+//
+// If the message cannot be parsed, the raw bytes are returned base64-encoded.
+func decodeProtoSchemaless(data []byte) interface{} {
+	if tree, ok := decodeProtoTree(data, 0); ok {
+		return tree
+	}
+
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+// decodeProtoTree attempts to decode the given data as a protobuf message.
+// The second return value is false if the data is not a valid message.
+func decodeProtoTree(data []byte, depth int) (map[string][]interface{}, bool) {
+	if depth > grpcMaxNestingDepth {
+		return nil, false
+	}
+
+	tree := make(map[string][]interface{})
+	for len(data) > 0 {
+		number, wireType, tagLen := protowire.ConsumeTag(data)
+		if tagLen < 0 || !number.IsValid() {
+			return nil, false
+		}
+		data = data[tagLen:]
+
+		var value interface{}
+		var valueLen int
+		switch wireType {
+		case protowire.VarintType:
+			value, valueLen = protowire.ConsumeVarint(data)
+		case protowire.Fixed32Type:
+			value, valueLen = protowire.ConsumeFixed32(data)
+		case protowire.Fixed64Type:
+			value, valueLen = protowire.ConsumeFixed64(data)
+		case protowire.BytesType:
+			var bytesValue []byte
+			bytesValue, valueLen = protowire.ConsumeBytes(data)
+			if valueLen >= 0 {
+				value = decodeProtoBytes(bytesValue, depth)
+			}
+		default:
+			// Groups are deprecated, and are not decoded
+			return nil, false
+		}
+		if valueLen < 0 {
+			return nil, false
+		}
+		data = data[valueLen:]
+
+		key := strconv.Itoa(int(number))
+		tree[key] = append(tree[key], value)
+	}
+
+	return tree, true
+}
+
+// decodeProtoBytes decodes the value of a length-delimited field, which may be a string, a nested message, or raw
+// bytes.
+func decodeProtoBytes(data []byte, depth int) interface{} {
+	if isPrintableText(data) {
+		return string(data)
+	}
+	if tree, ok := decodeProtoTree(data, depth+1); ok && len(tree) > 0 {
+		return tree
+	}
+
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+// isPrintableText returns true if the given data is valid UTF-8 made up only of printable characters and
+// common whitespace.
+func isPrintableText(data []byte) bool {
+	if !utf8.Valid(data) {
+		return false
+	}
+	for _, r := range string(data) {
+		if !unicode.IsPrint(r) && r != '\t' && r != '\n' && r != '\r' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// decodeGrpcGzip returns a decoded version of the given gzip-compressed gRPC message.
+// An error is returned if the decoded message is larger than the maximum message size.
+func decodeGrpcGzip(data []byte) ([]byte, error) {
+	gzipReader, gzipErr := gzip.NewReader(bytes.NewReader(data))
+	if gzipErr != nil {
+		return nil, fmt.Errorf("unable to create new gzip reader: %w", gzipErr)
+	}
+	defer gzipReader.Close()
+
+	return readGrpcMessage(gzipReader)
+}
+
+// decodeGrpcDeflate returns a decoded version of the given deflate-compressed gRPC message. gRPC implementations
+// compress "deflate" messages in the zlib format (RFC 1950), but raw deflate data is also accepted.
+// An error is returned if the decoded message is larger than the maximum message size.
+func decodeGrpcDeflate(data []byte) ([]byte, error) {
+	if zlibReader, zlibErr := zlib.NewReader(bytes.NewReader(data)); zlibErr == nil {
+		decompressed, readErr := readGrpcMessage(zlibReader)
+		_ = zlibReader.Close()
+		if readErr == nil || errors.Is(readErr, errGrpcMessageTooLarge) {
+			return decompressed, readErr
+		}
+	}
+
+	flateReader := flate.NewReader(bytes.NewReader(data))
+	defer flateReader.Close()
+
+	return readGrpcMessage(flateReader)
+}
+
+// readGrpcMessage returns the decompressed message read from the given reader, or an error if it is larger than the
+// maximum message size.
+func readGrpcMessage(r io.Reader) ([]byte, error) {
+	decompressed, readErr := io.ReadAll(io.LimitReader(r, int64(grpcMaxMessageSize)+1))
+	if readErr != nil {
+		return nil, fmt.Errorf("unable to read message: %w", readErr)
+	}
+	if len(decompressed) > grpcMaxMessageSize {
+		return nil, errGrpcMessageTooLarge
+	}
+
+	return decompressed, nil
+}
@@ -0,0 +1,160 @@
+package apiHunter
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGrpcMethodFromPath(t *testing.T) {
+	tests := []struct {
+		input       string
+		wantService string
+		wantMethod  string
+		wantOk      bool
+	}{
+		{input: "/helloworld.Greeter/SayHello", wantService: "helloworld.Greeter", wantMethod: "SayHello", wantOk: true},
+		{input: "/Greeter/SayHello", wantService: "Greeter", wantMethod: "SayHello", wantOk: true},
+		{input: "/helloworld.Greeter/", wantOk: false},
+		{input: "/helloworld.Greeter", wantOk: false},
+		{input: "/a/b/c", wantOk: false},
+	}
+
+	for _, test := range tests {
+		service, method, ok := grpcMethodFromPath(test.input)
+		if service != test.wantService || method != test.wantMethod || ok != test.wantOk {
+			t.Errorf("grpcMethodFromPath(%q) = %q, %q, %v, want %q, %q, %v", test.input, service, method, ok, test.wantService, test.wantMethod, test.wantOk)
+		}
+	}
+}
+
+func TestDecodeGrpcBody(t *testing.T) {
+	// Message with field 1 = "hi" (string), field 2 = 150 (varint), and field 3 = nested message {1: 1}
+	message := []byte{0x0a, 0x02, 'h', 'i', 0x10, 0x96, 0x01, 0x1a, 0x02, 0x08, 0x01}
+	frame := append([]byte{0x00, 0x00, 0x00, 0x00, byte(len(message))}, message...)
+	trailers := []byte("grpc-status: 0\r\ngrpc-message: OK\r\n")
+	trailerFrame := append([]byte{0x80, 0x00, 0x00, 0x00, byte(len(trailers))}, trailers...)
+
+	// gRPC-Web text bodies may contain separately-encoded chunks
+	textBody := base64.StdEncoding.EncodeToString(frame) + base64.StdEncoding.EncodeToString(trailerFrame)
+
+	ah := &APIHunter{}
+	got, err := ah.decodeGrpcBody([]byte(textBody), grpcContentType{web: true, text: true}, "", "helloworld.Greeter", "SayHello", true)
+	if err != nil {
+		t.Fatalf("decodeGrpcBody() returned error: %s", err)
+	}
+
+	var body grpcBody
+	if unmarshalErr := json.Unmarshal(got, &body); unmarshalErr != nil {
+		t.Fatalf("unable to unmarshal decoded body: %s", unmarshalErr)
+	}
+	if len(body.Messages) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(body.Messages))
+	}
+
+	var tree map[string]interface{}
+	if unmarshalErr := json.Unmarshal(body.Messages[0], &tree); unmarshalErr != nil {
+		t.Fatalf("unable to unmarshal decoded message: %s", unmarshalErr)
+	}
+	want := map[string]interface{}{
+		"1": []interface{}{"hi"},
+		"2": []interface{}{float64(150)},
+		"3": []interface{}{map[string]interface{}{"1": []interface{}{float64(1)}}},
+	}
+	if !reflect.DeepEqual(tree, want) {
+		t.Errorf("decoded message = %v, want %v", tree, want)
+	}
+	if body.Trailers["grpc-status"] != "0" {
+		t.Errorf("grpc-status trailer = %q, want %q", body.Trailers["grpc-status"], "0")
+	}
+	if body.Decoding != "schemaless" {
+		t.Errorf("decoding = %q, want %q", body.Decoding, "schemaless")
+	}
+}
+
+func TestDecodeGrpcBodyDeflate(t *testing.T) {
+	// Message with field 1 = "hi" (string)
+	message := []byte{0x0a, 0x02, 'h', 'i'}
+	want := map[string]interface{}{"1": []interface{}{"hi"}}
+
+	var zlibData, flateData bytes.Buffer
+	zlibWriter := zlib.NewWriter(&zlibData)
+	_, _ = zlibWriter.Write(message)
+	_ = zlibWriter.Close()
+	flateWriter, _ := flate.NewWriter(&flateData, flate.DefaultCompression)
+	_, _ = flateWriter.Write(message)
+	_ = flateWriter.Close()
+
+	// gRPC implementations send zlib data, but raw deflate data is also decoded
+	ah := &APIHunter{}
+	for name, compressed := range map[string][]byte{"zlib": zlibData.Bytes(), "raw": flateData.Bytes()} {
+		frame := append([]byte{0x01, 0x00, 0x00, 0x00, byte(len(compressed))}, compressed...)
+		got, err := ah.decodeGrpcBody(frame, grpcContentType{}, "deflate", "helloworld.Greeter", "SayHello", true)
+		if err != nil {
+			t.Fatalf("%s: decodeGrpcBody() returned error: %s", name, err)
+		}
+
+		var body grpcBody
+		if unmarshalErr := json.Unmarshal(got, &body); unmarshalErr != nil {
+			t.Fatalf("%s: unable to unmarshal decoded body: %s", name, unmarshalErr)
+		}
+		if len(body.Messages) != 1 || len(body.Errors) != 0 {
+			t.Fatalf("%s: expected 1 message and no errors, got %d messages and errors %q", name, len(body.Messages), body.Errors)
+		}
+		var tree map[string]interface{}
+		if unmarshalErr := json.Unmarshal(body.Messages[0], &tree); unmarshalErr != nil {
+			t.Fatalf("%s: unable to unmarshal decoded message: %s", name, unmarshalErr)
+		}
+		if !reflect.DeepEqual(tree, want) {
+			t.Errorf("%s: decoded message = %v, want %v", name, tree, want)
+		}
+	}
+}
+
+func TestDecodeGrpcBodyTooLarge(t *testing.T) {
+	message := make([]byte, grpcMaxMessageSize+1)
+
+	var gzipData, zlibData bytes.Buffer
+	gzipWriter := gzip.NewWriter(&gzipData)
+	_, _ = gzipWriter.Write(message)
+	_ = gzipWriter.Close()
+	zlibWriter := zlib.NewWriter(&zlibData)
+	_, _ = zlibWriter.Write(message)
+	_ = zlibWriter.Close()
+
+	// Small compressed messages that decompress beyond the maximum message size are not decoded
+	ah := &APIHunter{}
+	for encoding, compressed := range map[string][]byte{"gzip": gzipData.Bytes(), "deflate": zlibData.Bytes()} {
+		frame := binary.BigEndian.AppendUint32([]byte{0x01}, uint32(len(compressed)))
+		got, err := ah.decodeGrpcBody(append(frame, compressed...), grpcContentType{}, encoding, "helloworld.Greeter", "SayHello", true)
+		if err != nil {
+			t.Fatalf("%s: decodeGrpcBody() returned error: %s", encoding, err)
+		}
+
+		var body grpcBody
+		if unmarshalErr := json.Unmarshal(got, &body); unmarshalErr != nil {
+			t.Fatalf("%s: unable to unmarshal decoded body: %s", encoding, unmarshalErr)
+		}
+		if len(body.Messages) != 0 || len(body.Errors) != 1 || !strings.Contains(body.Errors[0], errGrpcMessageTooLarge.Error()) {
+			t.Errorf("%s: expected no messages and a message size error, got %d messages and errors %q", encoding, len(body.Messages), body.Errors)
+		}
+	}
+
+	// Uncompressed frames are limited to the same size
+	if _, err := parseGrpcFrames(binary.BigEndian.AppendUint32([]byte{0x00}, uint32(grpcMaxMessageSize+1))); err == nil {
+		t.Error("expected error for frame larger than the maximum message size")
+	}
+}
+
+func TestParseGrpcFramesTruncated(t *testing.T) {
+	if _, err := parseGrpcFrames([]byte{0x00, 0x00, 0x00, 0x00, 0x05, 0x01}); err == nil {
+		t.Error("expected error for truncated frame")
+	}
+}
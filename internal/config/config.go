@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"net"
 	"net/url"
 	"os"
 	"strings"
@@ -19,6 +20,7 @@ import (
 
 	"github.com/TheHackerDev/cartograph/internal/shared/database"
 	"github.com/TheHackerDev/cartograph/internal/shared/datatypes"
+	"github.com/TheHackerDev/cartograph/internal/shared/metrics"
 )
 
 // NewConfig initializes the program and returns a new instance of the Config object.
@@ -36,6 +38,51 @@ func NewConfig() (*Config, error) {
 	// Mapper injection scripts directory
 	mapperScriptDir := flag.String("mapper-script-dir", "/mapper-injection-scripts", "Directory containing mapper injection scripts")
 
+	// Browser instrumentation script
+	instrument := flag.Bool("instrument", false, "Inject a script that records the fetch, XMLHttpRequest, WebSocket, postMessage and localStorage calls made by pages, alongside the mapper script")
+
+	// Content-Security-Policy rewriting for injected scripts and styles
+	cspRewrite := flag.Bool("csp-rewrite", true, "Rewrite Content-Security-Policy headers and meta tags to allow injected scripts and styles")
+
+	// Re-encoding of compressed responses after injection
+	injectionReencode := flag.Bool("injection-reencode", false, "Re-encode compressed HTML responses after injection, instead of sending them uncompressed")
+
+	// Crawler browser settings
+	crawlerBrowser := flag.String("crawler-browser", "chromium", "Chromium binary launched for browser crawl jobs")
+	crawlerCDPURL := flag.String("crawler-cdp-url", "", "DevTools endpoint of an already running Chromium to use for browser crawl jobs, instead of launching one (e.g. http://chromium:9222)")
+	crawlerBrowserProxy := flag.String("crawler-browser-proxy", "", "Proxy address the browser used for browser crawl jobs reaches Cartograph at, if it differs from the proxy listener address (e.g. cartograph:8080)")
+
+	// DNS plugin settings
+	dnsListenAddr := flag.String("dns-listen-addr", "", "Address to serve DNS on, forwarding A, AAAA and CNAME queries and recording the answers as passive DNS data (e.g. 127.0.0.1:5353); disabled if empty")
+	dnsServer := flag.String("dns-server", "", "DNS server the proxy resolves hosts with, instead of those in /etc/resolv.conf (e.g. 10.0.0.2:53)")
+	dnsDoHURL := flag.String("dns-doh-url", "", "DNS over HTTPS endpoint the proxy resolves hosts with, instead of a DNS server (e.g. https://cloudflare-dns.com/dns-query)")
+	dnsPassiveFile := flag.String("dns-passive-file", "", "File of passive DNS records to import at startup, in Passive DNS Common Output Format JSON lines or zone file format")
+
+	// Server listener settings
+	setProxyServer := serverFlags("proxy", "forward proxy server", ServerConfig{
+		Addr:            ":8080",
+		ReadTimeout:     10 * time.Second,
+		WriteTimeout:    30 * time.Second, // Gives us time to send a request to the remote server and receive a response
+		IdleTimeout:     40 * time.Second,
+		UpstreamTimeout: 2 * time.Minute,
+	})
+	setAPIServer := serverFlags("api", "API server", ServerConfig{Addr: ":8000"})
+	setWebUIHTTPServer := serverFlags("webui-http", "web UI HTTP (redirect) server", ServerConfig{Addr: ":80"})
+	setWebUIHTTPSServer := serverFlags("webui-https", "web UI HTTPS server", ServerConfig{Addr: ":443"})
+
+	// Plugin input queue settings
+	queueDefaults := QueueConfig{Size: 100, Policy: QueuePolicySpill}
+	setLoggerQueue := queueFlags("logger", "logger plugin", queueDefaults)
+	setMapperQueue := queueFlags("mapper", "mapper plugin", queueDefaults)
+	setAnalyzerQueue := queueFlags("analyzer", "analyzer plugin", queueDefaults)
+	setJSAnalyzerQueue := queueFlags("js-analyzer", "JavaScript analyzer plugin", queueDefaults)
+	setDNSQueue := queueFlags("dns", "DNS plugin", queueDefaults)
+	spillDir := flag.String("spill-dir", "/tmp/cartograph-spill", "Directory for plugin input queue spill files")
+	spillMaxBytes := flag.Int64("spill-max-bytes", 256<<20, "Maximum size of each plugin input queue spill file, in bytes")
+
+	// Graceful shutdown timeout
+	shutdownTimeout := flag.Duration("shutdown-timeout", 30*time.Second, "Maximum time to wait for in-flight connections to drain on shutdown")
+
 	// Add custom usage function with comprehensive help text
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Cartograph HTTP Proxy for Internet Mapping\n\n")
@@ -66,11 +113,70 @@ func NewConfig() (*Config, error) {
 	// Set mapper script directory
 	config.MapperScriptDir = *mapperScriptDir
 
+	// Set browser instrumentation
+	config.Instrument = *instrument
+
+	// Set Content-Security-Policy rewriting
+	config.CSPRewrite = *cspRewrite
+
+	// Set re-encoding of compressed responses after injection
+	config.InjectionReencode = *injectionReencode
+
+	// Set crawler browser settings
+	config.CrawlerBrowser = *crawlerBrowser
+	config.CrawlerCDPURL = *crawlerCDPURL
+	config.CrawlerBrowserProxy = *crawlerBrowserProxy
+
+	// Set DNS plugin settings
+	config.DNSListenAddr = *dnsListenAddr
+	config.DNSPassiveFile = *dnsPassiveFile
+	if *dnsServer != "" && *dnsDoHURL != "" {
+		return nil, fmt.Errorf("only one of the -dns-server and -dns-doh-url flags can be set")
+	}
+	config.DNSServer = *dnsServer
+	if _, _, splitErr := net.SplitHostPort(config.DNSServer); config.DNSServer != "" && splitErr != nil {
+		// Use the default DNS port
+		config.DNSServer = net.JoinHostPort(strings.Trim(config.DNSServer, "[]"), "53")
+	}
+	if config.DNSDoHURL = *dnsDoHURL; config.DNSDoHURL != "" {
+		if dohURL, parseErr := url.Parse(config.DNSDoHURL); parseErr != nil || dohURL.Scheme != "https" || dohURL.Host == "" {
+			return nil, fmt.Errorf("invalid DNS over HTTPS endpoint %q; must be an HTTPS URL", config.DNSDoHURL)
+		}
+	}
+
+	// Set server listener settings
+	setProxyServer(&config.ProxyServer)
+	setAPIServer(&config.APIServer)
+	setWebUIHTTPServer(&config.WebUIHTTPServer)
+	setWebUIHTTPSServer(&config.WebUIHTTPSServer)
+	config.ShutdownTimeout = *shutdownTimeout
+
+	// Set plugin input queue settings
+	for _, queue := range []struct {
+		name string
+		cfg  *QueueConfig
+		set  func(*QueueConfig)
+	}{
+		{"logger", &config.LoggerQueue, setLoggerQueue},
+		{"mapper", &config.MapperQueue, setMapperQueue},
+		{"analyzer", &config.AnalyzerQueue, setAnalyzerQueue},
+		{"js-analyzer", &config.JSAnalyzerQueue, setJSAnalyzerQueue},
+		{"dns", &config.DNSQueue, setDNSQueue},
+	} {
+		queue.set(queue.cfg)
+		queue.cfg.SpillDir = *spillDir
+		queue.cfg.SpillMaxBytes = *spillMaxBytes
+		if validateErr := queue.cfg.validate(); validateErr != nil {
+			return nil, fmt.Errorf("invalid %s queue settings: %w", queue.name, validateErr)
+		}
+	}
+
 	// Get a database connection pool
 	conn, connErr := database.GetDbConnPool(config.DbConnString)
 	if connErr != nil {
 		return nil, fmt.Errorf("unable to get database connection pool: %w", connErr)
 	}
+	metrics.RegisterDbPool("config", conn)
 	config.dbConnPool = conn
 
 	// Validate the database; retry every 5 seconds, for a maximum of 30 seconds
@@ -208,6 +314,73 @@ type Config struct {
 	// MapperScriptDir is the directory where mapper injection scripts are stored.
 	MapperScriptDir string
 
+	// Instrument is true if the instrumentation script is injected alongside the mapper script, to record the
+	// client-side API calls made by pages.
+	Instrument bool
+
+	// CSPRewrite is true if page policies may be rewritten to allow injected scripts and styles. If false, pages
+	// whose policy blocks injected content are only recorded as blocked.
+	CSPRewrite bool
+
+	// InjectionReencode is true if compressed HTML responses are compressed again with the same encoding after
+	// scripts and styles are injected. If false, they are sent uncompressed.
+	InjectionReencode bool
+
+	// CrawlerBrowser is the Chromium binary launched for browser crawl jobs, if CrawlerCDPURL is empty.
+	CrawlerBrowser string
+
+	// CrawlerCDPURL is the DevTools endpoint of an already running Chromium, used for browser crawl jobs instead of
+	// launching one.
+	CrawlerCDPURL string
+
+	// CrawlerBrowserProxy is the address the crawl browser reaches the proxy at. If empty, the proxy listener address
+	// is used, on the loopback interface if it listens on all of them.
+	CrawlerBrowserProxy string
+
+	// DNSListenAddr is the address the DNS plugin serves DNS on, if it isn't empty.
+	DNSListenAddr string
+
+	// DNSServer is the address of the DNS server the DNS plugin resolves hosts with, if it isn't empty, instead of those
+	// in the resolver configuration file.
+	DNSServer string
+
+	// DNSDoHURL is the DNS over HTTPS endpoint the DNS plugin resolves hosts with, if it isn't empty.
+	DNSDoHURL string
+
+	// DNSPassiveFile is a file of passive DNS records imported by the DNS plugin at startup, if it isn't empty.
+	DNSPassiveFile string
+
+	// ProxyServer holds the listener settings for the forward proxy server.
+	ProxyServer ServerConfig
+
+	// APIServer holds the listener settings for the API server.
+	APIServer ServerConfig
+
+	// WebUIHTTPServer holds the listener settings for the web UI's HTTP server, which redirects to HTTPS.
+	WebUIHTTPServer ServerConfig
+
+	// WebUIHTTPSServer holds the listener settings for the web UI's HTTPS server.
+	WebUIHTTPSServer ServerConfig
+
+	// LoggerQueue holds the input queue settings for the logger plugin.
+	LoggerQueue QueueConfig
+
+	// MapperQueue holds the input queue settings for the mapper plugin.
+	MapperQueue QueueConfig
+
+	// AnalyzerQueue holds the input queue settings for the analyzer plugin.
+	AnalyzerQueue QueueConfig
+
+	// JSAnalyzerQueue holds the input queue settings for the JavaScript analyzer plugin.
+	JSAnalyzerQueue QueueConfig
+
+	// DNSQueue holds the input queue settings for the DNS plugin.
+	DNSQueue QueueConfig
+
+	// ShutdownTimeout is the maximum time to wait for in-flight connections to drain on shutdown, before they are
+	// closed forcefully.
+	ShutdownTimeout time.Duration
+
 	// uuidNamespace is the UUID namespace used for generating UUIDv5 keys.
 	uuidNamespace uuid.UUID
 
@@ -449,3 +622,32 @@ func (c *Config) IsTarget(srcHost, dstHost string) bool {
 
 	return false
 }
+
+// HasTargetRule returns true if a target or ignored rule set exists with the given ID.
+func (c *Config) HasTargetRule(id string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	_, isTarget := c.targets[id]
+	_, isIgnored := c.ignored[id]
+
+	return isTarget || isIgnored
+}
+
+// MatchesTargetRules returns true if any of the target or ignored rule sets with the given IDs match the given source
+// or destination hosts. IDs that do not belong to a rule set are skipped.
+func (c *Config) MatchesTargetRules(ids []string, srcHost, dstHost string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, id := range ids {
+		if target, ok := c.targets[id]; ok && target.MatchesHost(srcHost, dstHost) {
+			return true
+		}
+		if ignored, ok := c.ignored[id]; ok && ignored.MatchesHost(srcHost, dstHost) {
+			return true
+		}
+	}
+
+	return false
+}
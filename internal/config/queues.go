@@ -0,0 +1,60 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+)
+
+// Queue policies, which determine what happens when an item is sent to a full plugin input queue.
+const (
+	// QueuePolicyBlock blocks the sender until there is room in the queue.
+	QueuePolicyBlock string = "block"
+
+	// QueuePolicyDrop discards the item, and counts it as dropped.
+	QueuePolicyDrop string = "drop"
+
+	// QueuePolicySpill writes the item to a file on disk, from which it is read back into the queue once there is room.
+	QueuePolicySpill string = "spill"
+)
+
+// QueueConfig holds the settings for a plugin's input queue.
+type QueueConfig struct {
+	// Size is the number of items held in memory before the queue is considered full.
+	Size int
+
+	// Policy is one of the QueuePolicy constants.
+	Policy string
+
+	// SpillDir is the directory where spill files are stored, when using QueuePolicySpill.
+	SpillDir string
+
+	// SpillMaxBytes is the maximum size of a single spill file. Items are dropped once it is reached.
+	SpillMaxBytes int64
+}
+
+// validate returns an error if the queue settings are invalid.
+func (q QueueConfig) validate() error {
+	if q.Size < 1 {
+		return fmt.Errorf("queue size must be at least 1, got %d", q.Size)
+	}
+	switch q.Policy {
+	case QueuePolicyBlock, QueuePolicyDrop, QueuePolicySpill:
+	default:
+		return fmt.Errorf("unknown queue policy %q; must be one of %q, %q, or %q", q.Policy, QueuePolicyBlock, QueuePolicyDrop, QueuePolicySpill)
+	}
+
+	return nil
+}
+
+// queueFlags registers the command-line flags for a plugin's input queue settings, using the given flag name prefix
+// and defaults. The returned function sets the parsed values on the given QueueConfig, and must be called after
+// flag.Parse. The spill settings are shared between all queues, and are set separately.
+func queueFlags(prefix string, description string, defaults QueueConfig) func(*QueueConfig) {
+	size := flag.Int(prefix+"-queue-size", defaults.Size, "Input queue size for the "+description)
+	policy := flag.String(prefix+"-queue-policy", defaults.Policy, "Policy when the "+description+" input queue is full (block, drop, or spill)")
+
+	return func(q *QueueConfig) {
+		q.Size = *size
+		q.Policy = *policy
+	}
+}
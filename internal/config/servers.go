@@ -0,0 +1,61 @@
+package config
+
+import (
+	"flag"
+	"net/http"
+	"time"
+)
+
+// ServerConfig holds the listener settings for a single HTTP server.
+// Zero timeout values mean no timeout, matching the http.Server defaults.
+type ServerConfig struct {
+	// Addr is the TCP address the server listens on (e.g. ":8080", "127.0.0.1:8000").
+	Addr string
+
+	// ReadTimeout is the maximum duration for reading an entire request, including the body.
+	ReadTimeout time.Duration
+
+	// WriteTimeout is the maximum duration before timing out writes of a response.
+	WriteTimeout time.Duration
+
+	// IdleTimeout is the maximum amount of time to wait for the next request on a keep-alive connection.
+	IdleTimeout time.Duration
+
+	// UpstreamTimeout is the maximum duration of a request forwarded to a remote server, for servers that forward
+	// requests. Only the wait for the response headers is bounded for streaming responses.
+	UpstreamTimeout time.Duration
+}
+
+// NewHTTPServer returns a new HTTP server using these listener settings and the given handler.
+func (s ServerConfig) NewHTTPServer(handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:         s.Addr,
+		Handler:      handler,
+		ReadTimeout:  s.ReadTimeout,
+		WriteTimeout: s.WriteTimeout,
+		IdleTimeout:  s.IdleTimeout,
+	}
+}
+
+// serverFlags registers the command-line flags for a server's listener settings, using the given flag name
+// prefix and defaults. The upstream timeout flag is only registered for servers with a default upstream timeout,
+// which are those that forward requests. The returned function sets the parsed values on the given ServerConfig, and
+// must be called after flag.Parse.
+func serverFlags(prefix string, description string, defaults ServerConfig) func(*ServerConfig) {
+	addr := flag.String(prefix+"-addr", defaults.Addr, "Listen address for the "+description)
+	readTimeout := flag.Duration(prefix+"-read-timeout", defaults.ReadTimeout, "Read timeout for the "+description+" (0 for none)")
+	writeTimeout := flag.Duration(prefix+"-write-timeout", defaults.WriteTimeout, "Write timeout for the "+description+" (0 for none)")
+	idleTimeout := flag.Duration(prefix+"-idle-timeout", defaults.IdleTimeout, "Idle keep-alive timeout for the "+description+" (0 for none)")
+	upstreamTimeout := &defaults.UpstreamTimeout
+	if defaults.UpstreamTimeout != 0 {
+		upstreamTimeout = flag.Duration(prefix+"-upstream-timeout", defaults.UpstreamTimeout, "Timeout for requests the "+description+" forwards to remote servers (0 for none)")
+	}
+
+	return func(s *ServerConfig) {
+		s.Addr = *addr
+		s.ReadTimeout = *readTimeout
+		s.WriteTimeout = *writeTimeout
+		s.IdleTimeout = *idleTimeout
+		s.UpstreamTimeout = *upstreamTimeout
+	}
+}
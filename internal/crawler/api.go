@@ -1 +1,322 @@
 package crawler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	internalHttp "github.com/TheHackerDev/cartograph/internal/shared/http"
+)
+
+// defaultJobURLsLimit is the maximum number of URLs returned for a crawl job, unless another limit is given.
+const defaultJobURLsLimit = 1000
+
+// NewJobsAPIHandler returns a new instance of the crawl jobs API handler, using the provided crawler object.
+func NewJobsAPIHandler(crawler *Crawler) *JobsAPIHandler {
+	return &JobsAPIHandler{
+		crawler:   crawler,
+		pathRegex: regexp.MustCompile(`(?i)(?P<jobs>/jobs)/?(?P<uuid>[0-9a-zA-Z]{8}-[0-9a-zA-Z]{4}-[0-9a-zA-Z]{4}-[0-9a-zA-Z]{4}-[0-9a-zA-Z]{12})?(?P<resource>/urls|/navigation|/screenshot)?/?$`),
+	}
+}
+
+// JobsAPIHandler performs the routing for the crawl jobs API.
+//
+// It conforms to the http.Handler interface, and should thus be used in a http.ServeMux instance as the handler for
+// all crawl jobs API functions, starting at a single top-level URL path.
+type JobsAPIHandler struct {
+	// The plugin config.
+	crawler *Crawler
+
+	// Regular expression to find a job UUID, and whether the job's URLs, navigation graph, or a screenshot are
+	// requested, if provided in the path
+	pathRegex *regexp.Regexp
+}
+
+// startJobRequest is the request body used to start a crawl job.
+type startJobRequest struct {
+	// Hosts are the target hosts to start crawling from. If empty, every target host that isn't a wildcard is used.
+	Hosts []string `json:"hosts"`
+
+	// Mode is the crawl mode used for the job, overriding the crawler-wide setting if it isn't empty.
+	Mode string `json:"mode"`
+}
+
+// ServeHTTP conforms to the http.Handler interface, allowing this method to handle HTTP requests
+// for the crawler plugin's jobs API.
+// Requests are expected to be sent to a path ending in "/jobs/[uuid]", where the "[uuid]" is an optional value
+// representing an individual crawl job, "/jobs/[uuid]/urls" for the URLs found by a crawl job, "/jobs/[uuid]/navigation"
+// for the navigation graph of a browser crawl job, or "/jobs/[uuid]/screenshot" for a screenshot of one of its pages.
+func (h JobsAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Get the UUID from the request path, if one is provided
+	matches := h.pathRegex.FindStringSubmatch(r.URL.Path)
+	if matches == nil {
+		http.Error(w, fmt.Sprintf("invalid path provided: %q", r.URL.Path), http.StatusBadRequest)
+		return
+	}
+	jobID := strings.ToLower(matches[h.pathRegex.SubexpIndex("uuid")])
+	resource := strings.ToLower(matches[h.pathRegex.SubexpIndex("resource")])
+	if resource != "" && jobID == "" {
+		http.Error(w, "no job ID provided in request URL path", http.StatusBadRequest)
+		return
+	}
+
+	// Check for a valid request method, and send to the appropriate handler function
+	switch r.Method {
+	case http.MethodGet:
+		switch resource {
+		case "/urls":
+			h.getJobURLs(jobID).ServeHTTP(w, r)
+		case "/navigation":
+			h.getJobNavigation(jobID).ServeHTTP(w, r)
+		case "/screenshot":
+			h.getJobScreenshot(jobID).ServeHTTP(w, r)
+		default:
+			h.getJobs(jobID).ServeHTTP(w, r)
+		}
+		return
+	case http.MethodPost:
+		if jobID != "" {
+			http.Error(w, "crawl jobs can't be changed once started", http.StatusBadRequest)
+			return
+		}
+		h.startJob().ServeHTTP(w, r)
+		return
+	case http.MethodDelete:
+		if resource != "" {
+			http.Error(w, "invalid path provided: "+r.URL.Path, http.StatusBadRequest)
+			return
+		}
+		h.cancelJob(jobID).ServeHTTP(w, r)
+		return
+	case http.MethodOptions:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "invalid HTTP request method: "+r.Method, http.StatusMethodNotAllowed)
+		return
+	}
+}
+
+// getJobs is an HTTP handler function that returns either:
+// - One crawl job, if the provided UUID is a valid ID.
+// - All crawl jobs, most recently created first, if the provided UUID is an empty string.
+func (h JobsAPIHandler) getJobs(id string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if id == "" {
+			jobs, getErr := h.crawler.getJobs(r.Context())
+			if getErr != nil {
+				http.Error(w, fmt.Sprintf("unable to get crawl jobs: %s", getErr), http.StatusInternalServerError)
+				return
+			}
+			internalHttp.WriteJSON(w, http.StatusOK, jobs)
+			return
+		}
+
+		jobData, getErr := h.crawler.getJob(r.Context(), id)
+		if errors.Is(getErr, errJobNotFound) {
+			http.Error(w, "no crawl job with provided id: "+id, http.StatusNotFound)
+			return
+		} else if getErr != nil {
+			http.Error(w, fmt.Sprintf("unable to get crawl job: %s", getErr), http.StatusInternalServerError)
+			return
+		}
+		internalHttp.WriteJSON(w, http.StatusOK, jobData)
+	}
+}
+
+// getJobURLs is an HTTP handler function that returns the URLs found by the crawl job with the provided UUID, in the
+// order they were found. The optional "status" query parameter filters the URLs by their status, and "limit" sets
+// the maximum number of URLs returned.
+func (h JobsAPIHandler) getJobURLs(id string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := r.URL.Query().Get("status")
+		switch status {
+		case "", urlStatusQueued, urlStatusVisited, urlStatusRobots, urlStatusError:
+			break
+		default:
+			http.Error(w, fmt.Sprintf("invalid status %q; must be one of %q, %q, %q, or %q", status, urlStatusQueued, urlStatusVisited, urlStatusRobots, urlStatusError), http.StatusBadRequest)
+			return
+		}
+
+		limit := defaultJobURLsLimit
+		if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+			var parseErr error
+			if limit, parseErr = strconv.Atoi(limitParam); parseErr != nil || limit < 1 {
+				http.Error(w, fmt.Sprintf("invalid limit %q; must be a positive integer", limitParam), http.StatusBadRequest)
+				return
+			}
+		}
+
+		urls, getErr := h.crawler.getJobURLs(r.Context(), id, status, limit)
+		if getErr != nil {
+			http.Error(w, fmt.Sprintf("unable to get crawl job URLs: %s", getErr), http.StatusInternalServerError)
+			return
+		}
+		internalHttp.WriteJSON(w, http.StatusOK, urls)
+	}
+}
+
+// getJobNavigation is an HTTP handler function that returns the navigation graph recorded by the browser crawl job
+// with the provided UUID, as a list of edges in the order they were found. The optional "limit" query parameter sets
+// the maximum number of edges returned.
+func (h JobsAPIHandler) getJobNavigation(id string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit := defaultJobURLsLimit
+		if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+			var parseErr error
+			if limit, parseErr = strconv.Atoi(limitParam); parseErr != nil || limit < 1 {
+				http.Error(w, fmt.Sprintf("invalid limit %q; must be a positive integer", limitParam), http.StatusBadRequest)
+				return
+			}
+		}
+
+		navigation, getErr := h.crawler.getJobNavigation(r.Context(), id, limit)
+		if getErr != nil {
+			http.Error(w, fmt.Sprintf("unable to get crawl job navigation: %s", getErr), http.StatusInternalServerError)
+			return
+		}
+		internalHttp.WriteJSON(w, http.StatusOK, navigation)
+	}
+}
+
+// getJobScreenshot is an HTTP handler function that returns the PNG screenshot taken by the browser crawl job with
+// the provided UUID of the page given in the "url" query parameter.
+func (h JobsAPIHandler) getJobScreenshot(id string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rawURL := r.URL.Query().Get("url")
+		if rawURL == "" {
+			http.Error(w, "no page URL provided in url query parameter", http.StatusBadRequest)
+			return
+		}
+		pageURL, parseErr := url.Parse(rawURL)
+		if parseErr != nil {
+			http.Error(w, fmt.Sprintf("invalid page URL %q: %s", rawURL, parseErr), http.StatusBadRequest)
+			return
+		}
+
+		screenshot, getErr := h.crawler.getJobScreenshot(r.Context(), id, pageURL)
+		if errors.Is(getErr, errScreenshotNotFound) {
+			http.Error(w, "no screenshot for provided URL: "+rawURL, http.StatusNotFound)
+			return
+		} else if getErr != nil {
+			http.Error(w, fmt.Sprintf("unable to get screenshot: %s", getErr), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "image/png")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(screenshot)
+	}
+}
+
+// startJob is an HTTP handler function that starts a new crawl job, from the hosts in the request body, or every
+// target host if there are none.
+func (h JobsAPIHandler) startJob() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request startJobRequest
+		reqBody, bodyCopy, bodyReadErr := internalHttp.ReadBody(r.Body)
+		r.Body = bodyCopy
+		if bodyReadErr != nil {
+			http.Error(w, fmt.Sprintf("unable to read request body: %s", bodyReadErr.Error()), http.StatusInternalServerError)
+			return
+		}
+		if len(strings.TrimSpace(string(reqBody))) > 0 {
+			// Ensure the content-type in the request is correct
+			if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+				http.Error(w, fmt.Sprintf("Content-Type must be %q", "application/json"), http.StatusBadRequest)
+				return
+			}
+			if jsonUnmarshalErr := json.Unmarshal(reqBody, &request); jsonUnmarshalErr != nil {
+				http.Error(w, fmt.Sprintf("unable to parse JSON request body into crawl job: %s", jsonUnmarshalErr.Error()), http.StatusBadRequest)
+				return
+			}
+		}
+
+		jobData, startErr := h.crawler.startJob(request.Hosts, request.Mode)
+		if errors.Is(startErr, errNoSeeds) || errors.Is(startErr, errNotTarget) || errors.Is(startErr, errInvalidMode) {
+			http.Error(w, fmt.Sprintf("unable to start crawl job: %s", startErr), http.StatusBadRequest)
+			return
+		} else if startErr != nil {
+			http.Error(w, fmt.Sprintf("unable to start crawl job: %s", startErr), http.StatusInternalServerError)
+			return
+		}
+		internalHttp.WriteJSON(w, http.StatusCreated, jobData)
+	}
+}
+
+// cancelJob is an HTTP handler function that cancels the running crawl job with the provided UUID, or removes it and
+// the URLs it found if it is not running.
+func (h JobsAPIHandler) cancelJob(id string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Check for empty ID value
+		if id == "" {
+			http.Error(w, "no job ID provided in request URL path", http.StatusBadRequest)
+			return
+		}
+
+		if cancelErr := h.crawler.cancelJob(id); errors.Is(cancelErr, errJobNotFound) {
+			http.Error(w, "no crawl job with provided id: "+id, http.StatusNotFound)
+			return
+		} else if cancelErr != nil {
+			http.Error(w, fmt.Sprintf("unable to cancel crawl job with ID %q: %s", id, cancelErr.Error()), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// SettingsAPIHandler is an HTTP handler function for the crawler-wide settings new crawl jobs are started with.
+// GET requests return the settings, and PUT requests replace them.
+func (crawler *Crawler) SettingsAPIHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		internalHttp.WriteJSON(w, http.StatusOK, crawler.getSettings())
+		return
+	case http.MethodPut:
+		// Ensure the content-type in the request is correct
+		if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+			http.Error(w, fmt.Sprintf("Content-Type must be %q", "application/json"), http.StatusBadRequest)
+			return
+		}
+
+		reqBody, bodyCopy, bodyReadErr := internalHttp.ReadBody(r.Body)
+		r.Body = bodyCopy
+		if bodyReadErr != nil {
+			http.Error(w, fmt.Sprintf("unable to read request body: %s", bodyReadErr.Error()), http.StatusInternalServerError)
+			return
+		}
+		settings := crawler.getSettings()
+		if jsonUnmarshalErr := json.Unmarshal(reqBody, &settings); jsonUnmarshalErr != nil {
+			http.Error(w, fmt.Sprintf("unable to parse JSON request body into crawler settings: %s", jsonUnmarshalErr.Error()), http.StatusBadRequest)
+			return
+		}
+
+		if validateErr := settings.validate(); validateErr != nil {
+			http.Error(w, fmt.Sprintf("invalid crawler settings: %s", validateErr.Error()), http.StatusBadRequest)
+			return
+		}
+
+		if saveErr := crawler.saveSettings(settings); saveErr != nil {
+			http.Error(w, fmt.Sprintf("unable to save crawler settings: %s", saveErr.Error()), http.StatusInternalServerError)
+			return
+		}
+		internalHttp.WriteJSON(w, http.StatusOK, crawler.getSettings())
+		return
+	case http.MethodOptions:
+		w.Header().Set("Allow", "GET, PUT")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		http.Error(w, "invalid HTTP request method: "+r.Method, http.StatusMethodNotAllowed)
+		return
+	}
+}
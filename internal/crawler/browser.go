@@ -0,0 +1,366 @@
+package crawler
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Navigation actions, recording how a rendered page led to a URL.
+const (
+	navigationLink     string = "link"
+	navigationClick    string = "click"
+	navigationForm     string = "form"
+	navigationRedirect string = "redirect"
+)
+
+const (
+	// pageLoadTimeout is the maximum time to wait for a page's load event, after which it is crawled as it is.
+	pageLoadTimeout = 30 * time.Second
+
+	// pageSettleDelay is how long a page is given after its load event to finish rendering, as single page
+	// applications usually fetch their content once loaded.
+	pageSettleDelay = time.Second
+
+	// actionNavigationTimeout is how long to wait for a click or form submission to navigate away from the page.
+	actionNavigationTimeout = 2 * time.Second
+
+	// maxPageActions is the maximum number of elements clicked and forms submitted on each page.
+	maxPageActions = 10
+)
+
+// actionablesScript defines the actionables function in page scripts, which returns the elements that are clicked
+// or submitted by the crawler, in document order. Links are followed by URL instead, and only GET forms are
+// submitted, as in HTTP crawls.
+const actionablesScript = `const actionables = () => Array.from(document.querySelectorAll('button, input[type=button], input[type=submit], [role=button], [role=link], [onclick], form'))
+	.filter(el => el.tagName === 'FORM' ? (el.getAttribute('method') || 'get').toLowerCase() === 'get' : !el.closest('a, form'));
+const describe = el => el.tagName.toLowerCase() + (el.id ? '#' + el.id : '');`
+
+// collectScript returns the rendered page's state: its URL, navigation response status, links, and
+// the elements that can be clicked or submitted.
+const collectScript = `(() => {
+` + actionablesScript + `
+const nav = performance.getEntriesByType('navigation')[0];
+return {
+	url: location.href,
+	status: nav && nav.responseStatus ? nav.responseStatus : 0,
+	links: Array.from(document.querySelectorAll('a[href], area[href]')).map(el => ({url: el.href, element: describe(el)})),
+	actions: actionables().map(el => ({kind: el.tagName === 'FORM' ? 'form' : 'click', element: describe(el)})),
+};
+})()`
+
+// actionScriptFormat clicks, or fills in and submits, the actionable element with the index given by the format
+// verb, returning false if there is no such element.
+const actionScriptFormat = `(() => {
+` + actionablesScript + `
+const el = actionables()[%d];
+if (!el) return false;
+if (el.tagName !== 'FORM') {
+	el.click();
+	return true;
+}
+for (const input of el.querySelectorAll('input:not([type]), input[type=text], input[type=search], input[type=email], input[type=number], textarea')) {
+	if (!input.value) input.value = input.type === 'number' ? '1' : input.type === 'email' ? 'crawler@example.com' : 'cartograph';
+}
+el.requestSubmit ? el.requestSubmit() : el.submit();
+return true;
+})()`
+
+// locationScript returns the page's current URL.
+const locationScript = `location.href`
+
+// pageLink is a URL a crawled page leads to, and how it does.
+type pageLink struct {
+	url *url.URL
+
+	// action is the navigation action leading to the URL, or empty for links that weren't found in the page itself.
+	action string
+
+	// element describes the element the navigation started from.
+	element string
+}
+
+// pageResult is the result of crawling a single page.
+type pageResult struct {
+	// respCode is the status code of the page's response, or 0 if it isn't known.
+	respCode int
+
+	// links are the URLs the page leads to.
+	links []pageLink
+
+	// screenshot is a PNG screenshot of the rendered page, in browser crawls.
+	screenshot []byte
+}
+
+// pageState is the state of a rendered page, as returned by collectScript.
+type pageState struct {
+	URL    string `json:"url"`
+	Status int    `json:"status"`
+	Links  []struct {
+		URL     string `json:"url"`
+		Element string `json:"element"`
+	} `json:"links"`
+	Actions []struct {
+		Kind    string `json:"kind"`
+		Element string `json:"element"`
+	} `json:"actions"`
+}
+
+// browser is a Chromium instance driven over the DevTools protocol for a browser crawl job. Each job gets its own
+// browser context, so that cookies and storage aren't shared between jobs, with all of its traffic sent through the
+// proxy.
+type browser struct {
+	client *cdpClient
+
+	// contextID is the ID of the job's browser context.
+	contextID string
+
+	// stopBrowser kills the browser, if it was launched for the job.
+	stopBrowser func()
+}
+
+// openBrowser connects to the browser at the given DevTools endpoint, or launches the given binary if the endpoint
+// is empty, and creates a browser context that sends its traffic through the proxy at the given address.
+func openBrowser(ctx context.Context, endpoint, binary, proxyAddr string) (*browser, error) {
+	b := &browser{}
+
+	var wsURL string
+	if endpoint == "" {
+		var launchErr error
+		if wsURL, b.stopBrowser, launchErr = launchBrowser(ctx, binary, proxyAddr); launchErr != nil {
+			return nil, launchErr
+		}
+	} else {
+		var wsURLErr error
+		if wsURL, wsURLErr = cdpWebSocketURL(ctx, endpoint); wsURLErr != nil {
+			return nil, wsURLErr
+		}
+	}
+
+	var dialErr error
+	if b.client, dialErr = dialCDP(ctx, wsURL); dialErr != nil {
+		b.close()
+		return nil, dialErr
+	}
+
+	// The proxy is set on the context too, as browsers that weren't launched for the job may not use it otherwise
+	var created struct {
+		BrowserContextID string `json:"browserContextId"`
+	}
+	contextParams := map[string]any{"disposeOnDetach": true, "proxyServer": "http://" + proxyAddr, "proxyBypassList": "<-loopback>"}
+	if createErr := b.client.call(ctx, "", "Target.createBrowserContext", contextParams, &created); createErr != nil {
+		b.close()
+		return nil, fmt.Errorf("unable to create browser context: %w", createErr)
+	}
+	b.contextID = created.BrowserContextID
+
+	// The proxy generates its own certificates for every host
+	if ignoreErr := b.client.call(ctx, "", "Security.setIgnoreCertificateErrors", map[string]any{"ignore": true}, nil); ignoreErr != nil {
+		b.close()
+		return nil, fmt.Errorf("unable to ignore certificate errors in browser: %w", ignoreErr)
+	}
+
+	return b, nil
+}
+
+// close disposes of the job's browser context, and stops the browser if it was launched for the job.
+func (b *browser) close() {
+	if b.client != nil {
+		if b.contextID != "" {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			_ = b.client.call(ctx, "", "Target.disposeBrowserContext", map[string]any{"browserContextId": b.contextID}, nil)
+			cancel()
+		}
+		_ = b.client.close()
+	}
+	if b.stopBrowser != nil {
+		b.stopBrowser()
+	}
+}
+
+// visit renders the page at the given URL in a new tab, then takes a screenshot of it, and collects the URLs its
+// links lead to, and those its clickable elements and forms navigate to.
+func (b *browser) visit(ctx context.Context, u *url.URL, referer, userAgent string) (*pageResult, error) {
+	var target struct {
+		TargetID string `json:"targetId"`
+	}
+	if createErr := b.client.call(ctx, "", "Target.createTarget", map[string]any{"url": "about:blank", "browserContextId": b.contextID}, &target); createErr != nil {
+		return nil, fmt.Errorf("unable to open browser tab: %w", createErr)
+	}
+	defer func() {
+		closeCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		_ = b.client.call(closeCtx, "", "Target.closeTarget", map[string]any{"targetId": target.TargetID}, nil)
+		cancel()
+	}()
+
+	var attached struct {
+		SessionID string `json:"sessionId"`
+	}
+	if attachErr := b.client.call(ctx, "", "Target.attachToTarget", map[string]any{"targetId": target.TargetID, "flatten": true}, &attached); attachErr != nil {
+		return nil, fmt.Errorf("unable to attach to browser tab: %w", attachErr)
+	}
+	session := attached.SessionID
+	if enableErr := b.client.call(ctx, session, "Page.enable", nil, nil); enableErr != nil {
+		return nil, fmt.Errorf("unable to enable page events: %w", enableErr)
+	}
+	if userAgentErr := b.client.call(ctx, session, "Emulation.setUserAgentOverride", map[string]any{"userAgent": userAgent}, nil); userAgentErr != nil {
+		return nil, fmt.Errorf("unable to set user agent: %w", userAgentErr)
+	}
+
+	if navigateErr := b.navigate(ctx, session, u.String(), referer); navigateErr != nil {
+		return nil, navigateErr
+	}
+	var state pageState
+	if evaluateErr := b.evaluate(ctx, session, collectScript, &state); evaluateErr != nil {
+		return nil, fmt.Errorf("unable to collect page links: %w", evaluateErr)
+	}
+
+	result := &pageResult{respCode: state.Status}
+	var screenshot struct {
+		Data string `json:"data"`
+	}
+	if screenshotErr := b.client.call(ctx, session, "Page.captureScreenshot", map[string]any{"format": "png"}, &screenshot); screenshotErr != nil {
+		return nil, fmt.Errorf("unable to take screenshot: %w", screenshotErr)
+	}
+	var decodeErr error
+	if result.screenshot, decodeErr = base64.StdEncoding.DecodeString(screenshot.Data); decodeErr != nil {
+		return nil, fmt.Errorf("unable to decode screenshot: %w", decodeErr)
+	}
+
+	if state.URL != u.String() {
+		result.addLink(state.URL, navigationRedirect, "")
+	}
+	for _, link := range state.Links {
+		result.addLink(link.URL, navigationLink, link.Element)
+	}
+
+	// Click each element and submit each form in turn, reloading the page whenever one navigates away from it
+	pageURL := state.URL
+	for i, action := range state.Actions {
+		if i == maxPageActions {
+			break
+		}
+
+		var performed bool
+		if evaluateErr := b.evaluate(ctx, session, fmt.Sprintf(actionScriptFormat, i), &performed); evaluateErr != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			continue
+		}
+		if !performed {
+			continue
+		}
+
+		destination, waitErr := b.waitForNavigation(ctx, session, pageURL)
+		if waitErr != nil {
+			return nil, waitErr
+		}
+		if destination == "" {
+			continue
+		}
+		kind := navigationClick
+		if action.Kind == navigationForm {
+			kind = navigationForm
+		}
+		result.addLink(destination, kind, action.Element)
+		if navigateErr := b.navigate(ctx, session, pageURL, referer); navigateErr != nil {
+			return nil, navigateErr
+		}
+	}
+
+	return result, nil
+}
+
+// addLink adds the given raw URL to the page's links, if it can be parsed.
+func (r *pageResult) addLink(rawURL, action, element string) {
+	if link, parseErr := url.Parse(rawURL); parseErr == nil {
+		r.links = append(r.links, pageLink{url: link, action: action, element: element})
+	}
+}
+
+// navigate navigates the tab with the given session to the given URL, and waits for the page to load and settle.
+// Pages that don't fire their load event in time are crawled as they are.
+func (b *browser) navigate(ctx context.Context, session, rawURL, referer string) error {
+	loaded := b.client.waitFor(session, "Page.loadEventFired")
+
+	var navigated struct {
+		ErrorText string `json:"errorText"`
+	}
+	params := map[string]any{"url": rawURL}
+	if referer != "" {
+		// The referer lets the mapper record the connection the crawler followed
+		params["referrer"] = referer
+	}
+	if navigateErr := b.client.call(ctx, session, "Page.navigate", params, &navigated); navigateErr != nil {
+		return fmt.Errorf("unable to navigate to %s: %w", rawURL, navigateErr)
+	}
+	if navigated.ErrorText != "" {
+		return fmt.Errorf("unable to navigate to %s: %s", rawURL, navigated.ErrorText)
+	}
+
+	loadCtx, cancel := context.WithTimeout(ctx, pageLoadTimeout)
+	_, waitErr := b.client.wait(loadCtx, loaded)
+	cancel()
+	if waitErr != nil && !errors.Is(waitErr, context.DeadlineExceeded) {
+		return fmt.Errorf("unable to wait for %s to load: %w", rawURL, waitErr)
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(pageSettleDelay):
+		return nil
+	}
+}
+
+// waitForNavigation waits for the tab with the given session to leave the given URL, including by changing its
+// history within the page, returning the new URL. An empty URL is returned if the tab stays on the page.
+func (b *browser) waitForNavigation(ctx context.Context, session, pageURL string) (string, error) {
+	deadline := time.Now().Add(actionNavigationTimeout)
+	for {
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(200 * time.Millisecond):
+		}
+
+		var location string
+		// Evaluating fails while the tab is between documents
+		if evaluateErr := b.evaluate(ctx, session, locationScript, &location); evaluateErr == nil && location != pageURL && location != "" {
+			return location, nil
+		}
+		if time.Now().After(deadline) {
+			return "", nil
+		}
+	}
+}
+
+// evaluate runs the given script in the tab with the given session, and decodes its result into the given value.
+func (b *browser) evaluate(ctx context.Context, session, script string, result any) error {
+	var evaluated struct {
+		Result struct {
+			Value json.RawMessage `json:"value"`
+		} `json:"result"`
+		ExceptionDetails *struct {
+			Text string `json:"text"`
+		} `json:"exceptionDetails"`
+	}
+	params := map[string]any{"expression": script, "returnByValue": true, "awaitPromise": true}
+	if evaluateErr := b.client.call(ctx, session, "Runtime.evaluate", params, &evaluated); evaluateErr != nil {
+		return evaluateErr
+	}
+	if evaluated.ExceptionDetails != nil {
+		return fmt.Errorf("script threw an exception: %s", evaluated.ExceptionDetails.Text)
+	}
+
+	if unmarshalErr := json.Unmarshal(evaluated.Result.Value, result); unmarshalErr != nil {
+		return fmt.Errorf("unable to parse script result: %w", unmarshalErr)
+	}
+
+	return nil
+}
@@ -0,0 +1,159 @@
+package crawler
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// stubCDP is a DevTools endpoint that renders pages from a static site without running their scripts. Clicking any
+// element navigates to the site's "/clicked" page.
+type stubCDP struct {
+	t    *testing.T
+	site *httptest.Server
+
+	// location holds the current URL of each session.
+	location map[string]string
+}
+
+func (s *stubCDP) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/json/version" {
+		_ = json.NewEncoder(w).Encode(map[string]string{"webSocketDebuggerUrl": "ws://" + r.Host + "/devtools/browser/stub"})
+		return
+	}
+
+	conn, upgradeErr := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+	if upgradeErr != nil {
+		s.t.Errorf("unable to upgrade DevTools connection: %s", upgradeErr)
+		return
+	}
+	defer conn.Close()
+
+	for {
+		var request struct {
+			ID        int64                      `json:"id"`
+			SessionID string                     `json:"sessionId"`
+			Method    string                     `json:"method"`
+			Params    map[string]json.RawMessage `json:"params"`
+		}
+		if readErr := conn.ReadJSON(&request); readErr != nil {
+			return
+		}
+
+		var result any = map[string]any{}
+		var event string
+		switch request.Method {
+		case "Target.createBrowserContext":
+			result = map[string]string{"browserContextId": "context"}
+		case "Target.createTarget":
+			result = map[string]string{"targetId": "target"}
+		case "Target.attachToTarget":
+			result = map[string]string{"sessionId": "session"}
+		case "Page.navigate":
+			var rawURL string
+			_ = json.Unmarshal(request.Params["url"], &rawURL)
+			s.location[request.SessionID] = rawURL
+			result = map[string]string{"frameId": "frame"}
+			event = "Page.loadEventFired"
+		case "Page.captureScreenshot":
+			result = map[string]string{"data": base64.StdEncoding.EncodeToString([]byte("png"))}
+		case "Runtime.evaluate":
+			var expression string
+			_ = json.Unmarshal(request.Params["expression"], &expression)
+			result = map[string]any{"result": map[string]any{"value": s.evaluate(request.SessionID, expression)}}
+		}
+
+		if writeErr := conn.WriteJSON(map[string]any{"id": request.ID, "sessionId": request.SessionID, "result": result}); writeErr != nil {
+			return
+		}
+		if event != "" {
+			_ = conn.WriteJSON(map[string]any{"sessionId": request.SessionID, "method": event, "params": map[string]any{"timestamp": 1}})
+		}
+	}
+}
+
+// evaluate returns the result of the given crawler script on the session's current page.
+func (s *stubCDP) evaluate(session, expression string) any {
+	location := s.location[session]
+	switch {
+	case expression == locationScript:
+		return location
+	case expression == collectScript:
+		response, getErr := http.Get(location)
+		if getErr != nil {
+			s.t.Errorf("unable to get %s: %s", location, getErr)
+			return nil
+		}
+		defer response.Body.Close()
+		body, _ := io.ReadAll(response.Body)
+		pageURL, _ := url.Parse(location)
+
+		links := make([]map[string]string, 0)
+		for _, link := range extractLinks(pageURL, body) {
+			links = append(links, map[string]string{"url": link.String(), "element": "a"})
+		}
+		return map[string]any{
+			"url":     location,
+			"status":  response.StatusCode,
+			"links":   links,
+			"actions": []map[string]string{{"kind": "click", "element": "button#next"}},
+		}
+	case strings.Contains(expression, "actionables()[0]"):
+		s.location[session] = s.site.URL + "/clicked"
+		return true
+	default:
+		return false
+	}
+}
+
+func TestBrowserVisit(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = io.WriteString(w, `<html><body><a href="/about">About</a><button id="next">Next</button></body></html>`)
+	}))
+	defer site.Close()
+	cdp := httptest.NewServer(&stubCDP{t: t, site: site, location: make(map[string]string)})
+	defer cdp.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	b, openErr := openBrowser(ctx, cdp.URL, "", "127.0.0.1:8080")
+	if openErr != nil {
+		t.Fatalf("openBrowser() error = %s", openErr)
+	}
+	defer b.close()
+
+	pageURL, _ := url.Parse(site.URL + "/")
+	page, visitErr := b.visit(ctx, pageURL, "", "Cartograph Crawler")
+	if visitErr != nil {
+		t.Fatalf("visit() error = %s", visitErr)
+	}
+	if page.respCode != http.StatusOK {
+		t.Errorf("visit() respCode = %d, want %d", page.respCode, http.StatusOK)
+	}
+	if string(page.screenshot) != "png" {
+		t.Errorf("visit() screenshot = %q, want %q", page.screenshot, "png")
+	}
+
+	want := []pageLink{
+		{url: &url.URL{Path: "/about"}, action: navigationLink, element: "a"},
+		{url: &url.URL{Path: "/clicked"}, action: navigationClick, element: "button#next"},
+	}
+	if len(page.links) != len(want) {
+		t.Fatalf("visit() links = %v, want %v", page.links, want)
+	}
+	for i, link := range page.links {
+		if link.url.String() != site.URL+want[i].url.Path || link.action != want[i].action || link.element != want[i].element {
+			t.Errorf("visit() links[%d] = {%s %s %s}, want {%s %s %s}", i, link.url, link.action, link.element, site.URL+want[i].url.Path, want[i].action, want[i].element)
+		}
+	}
+}
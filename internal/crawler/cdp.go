@@ -0,0 +1,339 @@
+package crawler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// browserStartTimeout is the maximum time to wait for a launched browser to start its DevTools endpoint.
+const browserStartTimeout = 30 * time.Second
+
+// errCDPClosed is returned for calls that are waiting when the DevTools connection is closed.
+var errCDPClosed = errors.New("DevTools connection closed")
+
+// cdpRequest is a method call sent over the Chrome DevTools Protocol.
+type cdpRequest struct {
+	ID        int64  `json:"id"`
+	SessionID string `json:"sessionId,omitempty"`
+	Method    string `json:"method"`
+	Params    any    `json:"params"`
+}
+
+// cdpMessage is a message received over the Chrome DevTools Protocol. Responses have an ID, and events have a method
+// without an ID.
+type cdpMessage struct {
+	ID        int64           `json:"id"`
+	SessionID string          `json:"sessionId"`
+	Method    string          `json:"method"`
+	Params    json.RawMessage `json:"params"`
+	Result    json.RawMessage `json:"result"`
+	Error     *cdpError       `json:"error"`
+}
+
+// cdpError is an error returned by a Chrome DevTools Protocol call.
+type cdpError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error returns the error message.
+func (e *cdpError) Error() string {
+	return fmt.Sprintf("%s (%d)", e.Message, e.Code)
+}
+
+// cdpWaiter waits for the first event with a method, on a session.
+type cdpWaiter struct {
+	sessionID string
+	method    string
+	events    chan json.RawMessage
+}
+
+// cdpClient is a minimal Chrome DevTools Protocol client, connected to a browser's DevTools WebSocket endpoint.
+// Pages are driven through flattened sessions, so that a single connection is shared by all of them.
+type cdpClient struct {
+	conn *websocket.Conn
+
+	// writeMu serializes writes to the connection.
+	writeMu sync.Mutex
+
+	// mu protects nextID, pending, waiters and closeErr.
+	mu      sync.Mutex
+	nextID  int64
+	pending map[int64]chan *cdpMessage
+	waiters map[*cdpWaiter]bool
+
+	// closeErr is set once the connection is closed.
+	closeErr error
+
+	// done is closed once the connection is closed.
+	done chan struct{}
+}
+
+// dialCDP connects to the browser DevTools WebSocket endpoint at the given URL, and starts reading from it.
+func dialCDP(ctx context.Context, wsURL string) (*cdpClient, error) {
+	dialer := websocket.Dialer{HandshakeTimeout: 10 * time.Second}
+	conn, _, dialErr := dialer.DialContext(ctx, wsURL, nil)
+	if dialErr != nil {
+		return nil, fmt.Errorf("unable to connect to DevTools endpoint %s: %w", wsURL, dialErr)
+	}
+	// Screenshots are sent in a single message
+	conn.SetReadLimit(64 << 20)
+
+	client := &cdpClient{
+		conn:    conn,
+		pending: make(map[int64]chan *cdpMessage),
+		waiters: make(map[*cdpWaiter]bool),
+		done:    make(chan struct{}),
+	}
+	go client.readLoop()
+
+	return client, nil
+}
+
+// readLoop reads messages from the connection until it is closed, handing responses to their calls and events to
+// their waiters.
+func (c *cdpClient) readLoop() {
+	var readErr error
+	for {
+		var message cdpMessage
+		if readErr = c.conn.ReadJSON(&message); readErr != nil {
+			break
+		}
+
+		c.mu.Lock()
+		if message.ID != 0 {
+			if response, ok := c.pending[message.ID]; ok {
+				delete(c.pending, message.ID)
+				response <- &message
+			}
+		} else if message.Method != "" {
+			for waiter := range c.waiters {
+				if waiter.sessionID == message.SessionID && waiter.method == message.Method {
+					delete(c.waiters, waiter)
+					waiter.events <- message.Params
+				}
+			}
+		}
+		c.mu.Unlock()
+	}
+
+	c.mu.Lock()
+	c.closeErr = fmt.Errorf("%w: %w", errCDPClosed, readErr)
+	for id, response := range c.pending {
+		delete(c.pending, id)
+		close(response)
+	}
+	c.mu.Unlock()
+	close(c.done)
+}
+
+// call calls the given method with the given parameters on a session, or on the browser if the session ID is empty,
+// and decodes the result into the given value, if it isn't nil.
+func (c *cdpClient) call(ctx context.Context, sessionID, method string, params, result any) error {
+	if params == nil {
+		params = struct{}{}
+	}
+
+	c.mu.Lock()
+	if c.closeErr != nil {
+		c.mu.Unlock()
+		return c.closeErr
+	}
+	c.nextID++
+	id := c.nextID
+	response := make(chan *cdpMessage, 1)
+	c.pending[id] = response
+	c.mu.Unlock()
+
+	c.writeMu.Lock()
+	writeErr := c.conn.WriteJSON(&cdpRequest{ID: id, SessionID: sessionID, Method: method, Params: params})
+	c.writeMu.Unlock()
+	if writeErr != nil {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+		return fmt.Errorf("unable to send %s call: %w", method, writeErr)
+	}
+
+	select {
+	case <-ctx.Done():
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+		return ctx.Err()
+	case message, ok := <-response:
+		if !ok {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			return c.closeErr
+		}
+		if message.Error != nil {
+			return fmt.Errorf("%s call failed: %w", method, message.Error)
+		}
+		if result != nil {
+			if unmarshalErr := json.Unmarshal(message.Result, result); unmarshalErr != nil {
+				return fmt.Errorf("unable to parse %s result: %w", method, unmarshalErr)
+			}
+		}
+		return nil
+	}
+}
+
+// waitFor registers a waiter for the next event with the given method on a session. It must be registered before
+// the call that causes the event, so that the event is not missed.
+func (c *cdpClient) waitFor(sessionID, method string) *cdpWaiter {
+	waiter := &cdpWaiter{sessionID: sessionID, method: method, events: make(chan json.RawMessage, 1)}
+	c.mu.Lock()
+	c.waiters[waiter] = true
+	c.mu.Unlock()
+
+	return waiter
+}
+
+// wait blocks until the waiter's event is received, and returns its parameters.
+func (c *cdpClient) wait(ctx context.Context, waiter *cdpWaiter) (json.RawMessage, error) {
+	defer func() {
+		c.mu.Lock()
+		delete(c.waiters, waiter)
+		c.mu.Unlock()
+	}()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.done:
+		return nil, errCDPClosed
+	case params := <-waiter.events:
+		return params, nil
+	}
+}
+
+// close closes the connection to the browser.
+func (c *cdpClient) close() error {
+	return c.conn.Close()
+}
+
+// cdpWebSocketURL returns the browser DevTools WebSocket URL for the given DevTools endpoint, which is either the
+// WebSocket URL itself, or the HTTP address the browser serves its version information on.
+func cdpWebSocketURL(ctx context.Context, endpoint string) (string, error) {
+	endpointURL, parseErr := url.Parse(endpoint)
+	if parseErr != nil {
+		return "", fmt.Errorf("unable to parse DevTools endpoint: %w", parseErr)
+	}
+	if endpointURL.Scheme == "ws" || endpointURL.Scheme == "wss" {
+		return endpoint, nil
+	}
+
+	versionURL := endpointURL.JoinPath("/json/version")
+	request, requestErr := http.NewRequestWithContext(ctx, http.MethodGet, versionURL.String(), nil)
+	if requestErr != nil {
+		return "", fmt.Errorf("unable to create DevTools version request: %w", requestErr)
+	}
+	response, responseErr := http.DefaultClient.Do(request)
+	if responseErr != nil {
+		return "", fmt.Errorf("unable to get DevTools version: %w", responseErr)
+	}
+	defer response.Body.Close()
+
+	var version struct {
+		WebSocketDebuggerURL string `json:"webSocketDebuggerUrl"`
+	}
+	if decodeErr := json.NewDecoder(response.Body).Decode(&version); decodeErr != nil {
+		return "", fmt.Errorf("unable to parse DevTools version: %w", decodeErr)
+	}
+	if version.WebSocketDebuggerURL == "" {
+		return "", fmt.Errorf("no WebSocket URL in DevTools version from %s", versionURL)
+	}
+
+	return version.WebSocketDebuggerURL, nil
+}
+
+// launchBrowser starts a headless Chromium from the given binary, sending all of its traffic through the proxy at the
+// given address, and returns its DevTools WebSocket URL. The browser is killed, and its profile directory removed,
+// when the returned stop function is called.
+func launchBrowser(ctx context.Context, binary, proxyAddr string) (string, func(), error) {
+	profileDir, tempErr := os.MkdirTemp("", "cartograph-crawler-")
+	if tempErr != nil {
+		return "", nil, fmt.Errorf("unable to create browser profile directory: %w", tempErr)
+	}
+
+	browserCtx, cancel := context.WithCancel(context.Background())
+	command := exec.CommandContext(browserCtx, binary,
+		"--headless=new",
+		"--remote-debugging-port=0",
+		"--user-data-dir="+profileDir,
+		"--proxy-server=http://"+proxyAddr,
+		// Loopback hosts bypass the proxy by default
+		"--proxy-bypass-list=<-loopback>",
+		// The proxy generates its own certificates for every host
+		"--ignore-certificate-errors",
+		// The sandbox needs privileges that containers usually don't have
+		"--no-sandbox",
+		"--no-first-run",
+		"--no-default-browser-check",
+		"--disable-gpu",
+		"--disable-dev-shm-usage",
+		"--hide-scrollbars",
+		"--mute-audio",
+		"about:blank",
+	)
+	stderr, pipeErr := command.StderrPipe()
+	if pipeErr != nil {
+		cancel()
+		_ = os.RemoveAll(profileDir)
+		return "", nil, fmt.Errorf("unable to read browser output: %w", pipeErr)
+	}
+	if startErr := command.Start(); startErr != nil {
+		cancel()
+		_ = os.RemoveAll(profileDir)
+		return "", nil, fmt.Errorf("unable to start browser %q: %w", binary, startErr)
+	}
+	stop := func() {
+		cancel()
+		_ = command.Wait()
+		_ = os.RemoveAll(profileDir)
+	}
+
+	// The browser prints its DevTools WebSocket URL once it is listening
+	found := make(chan string, 1)
+	go func() {
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			if _, wsURL, ok := strings.Cut(scanner.Text(), "DevTools listening on "); ok {
+				found <- strings.TrimSpace(wsURL)
+				break
+			}
+		}
+		close(found)
+		// Keep draining the output, so that the browser never blocks writing to it
+		_, _ = io.Copy(io.Discard, stderr)
+	}()
+
+	select {
+	case wsURL, ok := <-found:
+		if !ok {
+			stop()
+			return "", nil, fmt.Errorf("browser %q exited before starting its DevTools endpoint", binary)
+		}
+		return wsURL, stop, nil
+	case <-time.After(browserStartTimeout):
+		stop()
+		return "", nil, fmt.Errorf("browser %q did not start its DevTools endpoint within %s", binary, browserStartTimeout)
+	case <-ctx.Done():
+		stop()
+		return "", nil, ctx.Err()
+	}
+}
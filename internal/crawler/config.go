@@ -1 +1,108 @@
 package crawler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Crawl modes.
+const (
+	// ModeHTTP crawls with plain HTTP requests, following the links in each response.
+	ModeHTTP string = "http"
+
+	// ModeBrowser crawls with a headless Chromium, so that pages are rendered and their scripts run.
+	ModeBrowser string = "browser"
+)
+
+// Settings holds the crawler-wide settings saved in the config_crawler table. Each crawl job keeps a copy of the
+// settings it was started with.
+type Settings struct {
+	// MaxDepth is the maximum number of links followed from the start of the crawl.
+	MaxDepth int `json:"max_depth"`
+
+	// MaxPages is the maximum number of URLs requested by a single crawl job.
+	MaxPages int `json:"max_pages"`
+
+	// RequestsPerSecond is the maximum number of requests sent to each host every second.
+	RequestsPerSecond float64 `json:"requests_per_second"`
+
+	// Concurrency is the maximum number of requests a single crawl job has in flight at once.
+	Concurrency int `json:"concurrency"`
+
+	// RespectRobots is true if URLs disallowed by a host's robots.txt file are skipped, and its crawl delay is
+	// honoured.
+	RespectRobots bool `json:"respect_robots"`
+
+	// UserAgent is sent in the User-Agent header of every request, and is used to pick the robots.txt rules.
+	UserAgent string `json:"user_agent"`
+
+	// Mode is how pages are crawled: ModeHTTP or ModeBrowser. Jobs saved before modes were added have an empty mode,
+	// and are crawled with ModeHTTP.
+	Mode string `json:"mode"`
+}
+
+// validate returns an error if any of the settings are out of range.
+func (s *Settings) validate() error {
+	switch {
+	case s.MaxDepth < 0:
+		return fmt.Errorf("max_depth must not be negative")
+	case s.MaxPages < 1:
+		return fmt.Errorf("max_pages must be at least 1")
+	case s.RequestsPerSecond <= 0:
+		return fmt.Errorf("requests_per_second must be greater than 0")
+	case s.Concurrency < 1 || s.Concurrency > 64:
+		return fmt.Errorf("concurrency must be between 1 and 64")
+	case strings.TrimSpace(s.UserAgent) == "":
+		return fmt.Errorf("user_agent must not be empty")
+	case s.Mode != ModeHTTP && s.Mode != ModeBrowser:
+		return fmt.Errorf("mode must be %q or %q", ModeHTTP, ModeBrowser)
+	}
+
+	return nil
+}
+
+// getSettings returns the crawler-wide settings.
+func (crawler *Crawler) getSettings() Settings {
+	crawler.mu.RLock()
+	defer crawler.mu.RUnlock()
+
+	return crawler.settings
+}
+
+// saveSettings validates the given settings, then saves them to the database and the local crawler. Running crawl
+// jobs keep the settings they were started with.
+// If an error is returned, the settings are unchanged.
+func (crawler *Crawler) saveSettings(settings Settings) error {
+	if validateErr := settings.validate(); validateErr != nil {
+		return validateErr
+	}
+
+	crawler.mu.Lock()
+	defer crawler.mu.Unlock()
+
+	sqlUpdateSettings := `update config_crawler set max_depth = $1, max_pages = $2, requests_per_second = $3, concurrency = $4, respect_robots = $5, user_agent = $6, mode = $7;`
+	if _, updateErr := crawler.dbConnPool.Exec(context.Background(), sqlUpdateSettings, settings.MaxDepth, settings.MaxPages, settings.RequestsPerSecond, settings.Concurrency, settings.RespectRobots, settings.UserAgent, settings.Mode); updateErr != nil {
+		return fmt.Errorf("unable to save crawler settings to database: %w", updateErr)
+	}
+
+	crawler.settings = settings
+
+	return nil
+}
+
+// loadSettings updates the local crawler-wide settings from the database.
+func (crawler *Crawler) loadSettings(ctx context.Context) error {
+	var settings Settings
+	sqlSelectSettings := `select max_depth, max_pages, requests_per_second, concurrency, respect_robots, user_agent, mode from config_crawler limit 1;`
+	if scanErr := crawler.dbConnPool.QueryRow(ctx, sqlSelectSettings).Scan(&settings.MaxDepth, &settings.MaxPages, &settings.RequestsPerSecond, &settings.Concurrency, &settings.RespectRobots, &settings.UserAgent, &settings.Mode); scanErr != nil {
+		return fmt.Errorf("unable to get crawler settings from database: %w", scanErr)
+	}
+
+	crawler.mu.Lock()
+	defer crawler.mu.Unlock()
+
+	crawler.settings = settings
+
+	return nil
+}
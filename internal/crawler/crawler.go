@@ -1 +1,497 @@
 package crawler
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/TheHackerDev/cartograph/internal/config"
+	"github.com/TheHackerDev/cartograph/internal/shared/database"
+	"github.com/TheHackerDev/cartograph/internal/shared/metrics"
+)
+
+// Crawl job statuses.
+const (
+	JobStatusRunning   string = "running"
+	JobStatusPaused    string = "paused"
+	JobStatusFinished  string = "finished"
+	JobStatusCancelled string = "cancelled"
+	JobStatusFailed    string = "failed"
+)
+
+var (
+	// errJobNotFound is returned when no crawl job exists with a given ID.
+	errJobNotFound = errors.New("no crawl job found")
+
+	// errNoSeeds is returned when a crawl job has no target hosts to start from.
+	errNoSeeds = errors.New("no target hosts to crawl")
+
+	// errNotTarget is returned when a crawl job is asked to start from a host that is not a target.
+	errNotTarget = errors.New("host is not a target")
+
+	// errInvalidMode is returned when a crawl job is asked to start with an unknown crawl mode.
+	errInvalidMode = errors.New("invalid crawl mode")
+
+	// errScreenshotNotFound is returned when a crawl job has no screenshot of a page.
+	errScreenshotNotFound = errors.New("no screenshot found")
+)
+
+// NewCrawler returns a new, properly instantiated Crawler object.
+// Any errors returned should be considered fatal.
+func NewCrawler(cfg *config.Config) (*Crawler, error) {
+	crawler := &Crawler{
+		cfg:     cfg,
+		jobs:    make(map[string]*job),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	// Get a database connection pool
+	dbConnPool, dbConnPoolErr := database.GetDbConnPool(cfg.DbConnString)
+	if dbConnPoolErr != nil {
+		return nil, fmt.Errorf("unable to get database connection pool: %w", dbConnPoolErr)
+	}
+	metrics.RegisterDbPool("crawler", dbConnPool)
+	crawler.dbConnPool = dbConnPool
+
+	if settingsErr := crawler.loadSettings(context.Background()); settingsErr != nil {
+		return nil, fmt.Errorf("unable to set the crawler configuration from the database: %w", settingsErr)
+	}
+
+	// Send every request through the proxy, so that the logger, mapper and analyzer plugins see the crawled traffic
+	proxyURL := &url.URL{Scheme: "http", Host: proxyHost(cfg.ProxyServer.Addr)}
+	crawler.proxyAddr = proxyURL.Host
+	crawler.client = &http.Client{
+		Transport: &http.Transport{
+			Proxy: http.ProxyURL(proxyURL),
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true, // The proxy generates its own certificates for every host
+			},
+			MaxIdleConnsPerHost: 64,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		// Redirects are followed as links, so that they are checked against the scope and the limits.
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+		Timeout: time.Minute,
+	}
+
+	return crawler, nil
+}
+
+// Crawler is the configuration object for the crawler plugin, which actively expands the map by crawling the
+// proxy's targets through the proxy.
+// A Crawler object should *always* be instantiated via the NewCrawler method.
+type Crawler struct {
+	// RWMutex to control concurrent access
+	mu sync.RWMutex
+
+	// cfg is the configuration object for the program.
+	cfg *config.Config
+
+	// settings holds the settings new crawl jobs are started with.
+	settings Settings
+
+	// Database connection pool used for concurrency-safe connections.
+	dbConnPool *pgxpool.Pool
+
+	// client sends the crawler's requests through the proxy.
+	client *http.Client
+
+	// proxyAddr is the address of the proxy the crawler's requests are sent through.
+	proxyAddr string
+
+	// jobs holds the running crawl jobs, mapped to their ID.
+	jobs map[string]*job
+
+	// jobsWg tracks the running crawl jobs, so that they can be paused on shutdown.
+	jobsWg sync.WaitGroup
+
+	// stop is closed to signal the Run loop to pause all running crawl jobs and return.
+	stop chan struct{}
+
+	// stopped is closed by the Run loop once it has returned.
+	stopped chan struct{}
+
+	// stopOnce ensures the stop channel is only closed once.
+	stopOnce sync.Once
+}
+
+// Job is a crawl job, as saved in the data_crawler table.
+type Job struct {
+	ID       string     `json:"id"`
+	Status   string     `json:"status"`
+	Hosts    []string   `json:"hosts"`
+	Settings Settings   `json:"settings"`
+	Visited  int        `json:"visited"`
+	Skipped  int        `json:"skipped"`
+	Errors   int        `json:"errors"`
+	Error    string     `json:"error"`
+	Created  time.Time  `json:"created"`
+	Updated  time.Time  `json:"updated"`
+	Finished *time.Time `json:"finished"`
+}
+
+// JobNavigation is an edge in the navigation graph of a browser crawl job, as saved in the data_crawler_navigation
+// table.
+type JobNavigation struct {
+	From       string    `json:"from"`
+	To         string    `json:"to"`
+	Action     string    `json:"action"`
+	Element    string    `json:"element"`
+	Discovered time.Time `json:"discovered"`
+}
+
+// proxyHost returns the host the proxy can be reached at on this machine, given its listen address.
+func proxyHost(addr string) string {
+	host, port, splitErr := net.SplitHostPort(addr)
+	if splitErr != nil {
+		return addr
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+
+	return net.JoinHostPort(host, port)
+}
+
+// Run resumes the crawl jobs that were running when the program last stopped, then waits for the crawler to be
+// stopped.
+// Any errors returned should be considered fatal.
+func (crawler *Crawler) Run() error {
+	// Signal Stop once the loop has returned
+	defer close(crawler.stopped)
+
+	if resumeErr := crawler.resumeJobs(context.Background()); resumeErr != nil {
+		return fmt.Errorf("unable to resume crawl jobs: %w", resumeErr)
+	}
+
+	<-crawler.stop
+
+	// Pause the running jobs, to be resumed on the next start
+	crawler.mu.Lock()
+	for _, j := range crawler.jobs {
+		j.finish(JobStatusPaused)
+	}
+	crawler.mu.Unlock()
+	crawler.jobsWg.Wait()
+
+	return nil
+}
+
+// Stop signals the crawler plugin to stop, and blocks until all running crawl jobs have been paused and their state
+// saved to the database.
+// It must only be called after Run has been started.
+func (crawler *Crawler) Stop() {
+	crawler.stopOnce.Do(func() {
+		close(crawler.stop)
+	})
+	<-crawler.stopped
+}
+
+// seedHosts returns the target hosts a crawl job starts from: the given hosts, or if there are none, every target
+// host that isn't a wildcard. An error is returned if any of the given hosts are not targets.
+func (crawler *Crawler) seedHosts(hosts []string) ([]string, error) {
+	if len(hosts) == 0 {
+		for _, target := range crawler.cfg.GetTargetsAndIgnoredAll() {
+			if target.IsIgnore {
+				continue
+			}
+			for host := range target.Hosts {
+				if !strings.Contains(host, "*") {
+					hosts = append(hosts, host)
+				}
+			}
+		}
+	}
+
+	seeds := make([]string, 0, len(hosts))
+	seen := make(map[string]bool)
+	for _, host := range hosts {
+		host = strings.ToLower(strings.TrimSpace(host))
+		if host == "" || seen[host] {
+			continue
+		}
+		if !crawler.cfg.IsTarget(host, host) {
+			return nil, fmt.Errorf("%w: %q", errNotTarget, host)
+		}
+		seen[host] = true
+		seeds = append(seeds, host)
+	}
+	if len(seeds) == 0 {
+		return nil, errNoSeeds
+	}
+	sort.Strings(seeds)
+
+	return seeds, nil
+}
+
+// startJob saves a new crawl job for the given hosts to the database, and starts it. If no hosts are given, every
+// target host is crawled. The job is crawled in the given mode, or the crawler-wide one if it is empty.
+func (crawler *Crawler) startJob(hosts []string, mode string) (*Job, error) {
+	seeds, seedsErr := crawler.seedHosts(hosts)
+	if seedsErr != nil {
+		return nil, seedsErr
+	}
+
+	settings := crawler.getSettings()
+	if mode != "" {
+		if mode != ModeHTTP && mode != ModeBrowser {
+			return nil, fmt.Errorf("%w: %q", errInvalidMode, mode)
+		}
+		settings.Mode = mode
+	}
+
+	now := time.Now()
+	jobData := &Job{
+		ID:       uuid.Must(uuid.NewV4()).String(),
+		Status:   JobStatusRunning,
+		Hosts:    seeds,
+		Settings: settings,
+		Created:  now,
+		Updated:  now,
+	}
+	sqlInsertJob := `insert into data_crawler (id, status, hosts, settings, created, updated) values ($1, $2, $3, $4, $5, $6);`
+	if _, insertErr := crawler.dbConnPool.Exec(context.Background(), sqlInsertJob, jobData.ID, jobData.Status, jobData.Hosts, jobData.Settings, jobData.Created, jobData.Updated); insertErr != nil {
+		return nil, fmt.Errorf("unable to save crawl job to database: %w", insertErr)
+	}
+
+	// Return a copy, as the running job updates its own
+	started := *jobData
+	crawler.runJob(newJob(crawler, jobData), false)
+
+	return &started, nil
+}
+
+// resumeJobs starts the crawl jobs that were running or paused when the program last stopped, from where they left
+// off.
+func (crawler *Crawler) resumeJobs(ctx context.Context) error {
+	jobs, getErr := crawler.queryJobs(ctx, `where status = any($1)`, []string{JobStatusRunning, JobStatusPaused})
+	if getErr != nil {
+		return getErr
+	}
+
+	for _, jobData := range jobs {
+		log.WithField("job", jobData.ID).Info("resuming crawl job")
+		jobData.Status = JobStatusRunning
+		crawler.runJob(newJob(crawler, jobData), true)
+	}
+
+	return nil
+}
+
+// runJob runs the given crawl job in the background, until it is finished, cancelled, or paused.
+// Jobs started once the crawler is stopping are left running in the database, to be resumed on the next start.
+func (crawler *Crawler) runJob(j *job, resume bool) {
+	crawler.mu.Lock()
+	select {
+	case <-crawler.stop:
+		crawler.mu.Unlock()
+		return
+	default:
+	}
+	crawler.jobs[j.data.ID] = j
+	crawler.jobsWg.Add(1)
+	crawler.mu.Unlock()
+
+	go func() {
+		defer crawler.jobsWg.Done()
+		defer func() {
+			crawler.mu.Lock()
+			delete(crawler.jobs, j.data.ID)
+			crawler.mu.Unlock()
+		}()
+
+		if runErr := j.run(resume); runErr != nil {
+			log.WithError(runErr).WithField("job", j.data.ID).Error("crawl job failed")
+		}
+	}()
+}
+
+// cancelJob cancels the running crawl job with the given ID, or if it is not running, removes it from the database.
+func (crawler *Crawler) cancelJob(id string) error {
+	crawler.mu.RLock()
+	j, running := crawler.jobs[id]
+	crawler.mu.RUnlock()
+	if running {
+		j.finish(JobStatusCancelled)
+		return nil
+	}
+
+	result, deleteErr := crawler.dbConnPool.Exec(context.Background(), `delete from data_crawler where id = $1;`, id)
+	if deleteErr != nil {
+		return fmt.Errorf("unable to delete crawl job from database: %w", deleteErr)
+	}
+	if result.RowsAffected() == 0 {
+		return errJobNotFound
+	}
+
+	return nil
+}
+
+// getJobs returns all crawl jobs, most recently created first.
+func (crawler *Crawler) getJobs(ctx context.Context) ([]*Job, error) {
+	return crawler.queryJobs(ctx, "")
+}
+
+// getJob returns the crawl job with the given ID.
+func (crawler *Crawler) getJob(ctx context.Context, id string) (*Job, error) {
+	jobs, queryErr := crawler.queryJobs(ctx, `where id = $1`, id)
+	if queryErr != nil {
+		return nil, queryErr
+	}
+	if len(jobs) == 0 {
+		return nil, errJobNotFound
+	}
+
+	return jobs[0], nil
+}
+
+// queryJobs returns the crawl jobs matching the given where clause and arguments, most recently created first.
+func (crawler *Crawler) queryJobs(ctx context.Context, where string, args ...any) ([]*Job, error) {
+	rows, queryErr := crawler.dbConnPool.Query(ctx, `select id::text, status, hosts, settings, visited, skipped, errors, error, created, updated, finished from data_crawler `+where+` order by created desc;`, args...)
+	if queryErr != nil {
+		return nil, fmt.Errorf("unable to query database: %w", queryErr)
+	}
+	defer rows.Close()
+
+	jobs := make([]*Job, 0)
+	for rows.Next() {
+		jobData := &Job{}
+		if scanErr := rows.Scan(&jobData.ID, &jobData.Status, &jobData.Hosts, &jobData.Settings, &jobData.Visited, &jobData.Skipped, &jobData.Errors, &jobData.Error, &jobData.Created, &jobData.Updated, &jobData.Finished); scanErr != nil {
+			return nil, fmt.Errorf("unable to scan row: %w", scanErr)
+		}
+		jobs = append(jobs, jobData)
+	}
+	if rowsErr := rows.Err(); rowsErr != nil {
+		return nil, fmt.Errorf("unable to iterate over rows: %w", rowsErr)
+	}
+
+	return jobs, nil
+}
+
+// getJobURLs returns up to the given number of URLs found by the crawl job with the given ID, in the order they were
+// found, filtered by the given status if it is not empty.
+func (crawler *Crawler) getJobURLs(ctx context.Context, id, status string, limit int) ([]JobURL, error) {
+	rows, queryErr := crawler.dbConnPool.Query(ctx, `select template, url, referer, depth, status, resp_code, error, discovered, visited from data_crawler_urls where job_id = $1 and ($2 = '' or status = $2) order by discovered, depth limit $3;`,
+		id, status, limit)
+	if queryErr != nil {
+		return nil, fmt.Errorf("unable to query database: %w", queryErr)
+	}
+	defer rows.Close()
+
+	urls := make([]JobURL, 0)
+	for rows.Next() {
+		var jobURL JobURL
+		if scanErr := rows.Scan(&jobURL.Template, &jobURL.URL, &jobURL.Referer, &jobURL.Depth, &jobURL.Status, &jobURL.RespCode, &jobURL.Error, &jobURL.Discovered, &jobURL.Visited); scanErr != nil {
+			return nil, fmt.Errorf("unable to scan row: %w", scanErr)
+		}
+		urls = append(urls, jobURL)
+	}
+	if rowsErr := rows.Err(); rowsErr != nil {
+		return nil, fmt.Errorf("unable to iterate over rows: %w", rowsErr)
+	}
+
+	return urls, nil
+}
+
+// getJobNavigation returns up to the given number of navigation graph edges recorded by the crawl job with the given
+// ID, in the order they were found.
+func (crawler *Crawler) getJobNavigation(ctx context.Context, id string, limit int) ([]JobNavigation, error) {
+	rows, queryErr := crawler.dbConnPool.Query(ctx, `select from_url, to_url, action, element, discovered from data_crawler_navigation where job_id = $1 order by discovered, from_url, to_url limit $2;`,
+		id, limit)
+	if queryErr != nil {
+		return nil, fmt.Errorf("unable to query database: %w", queryErr)
+	}
+	defer rows.Close()
+
+	navigation := make([]JobNavigation, 0)
+	for rows.Next() {
+		var edge JobNavigation
+		if scanErr := rows.Scan(&edge.From, &edge.To, &edge.Action, &edge.Element, &edge.Discovered); scanErr != nil {
+			return nil, fmt.Errorf("unable to scan row: %w", scanErr)
+		}
+		navigation = append(navigation, edge)
+	}
+	if rowsErr := rows.Err(); rowsErr != nil {
+		return nil, fmt.Errorf("unable to iterate over rows: %w", rowsErr)
+	}
+
+	return navigation, nil
+}
+
+// getJobScreenshot returns the PNG screenshot taken by the crawl job with the given ID of the given page, or of
+// another page with the same URL template.
+func (crawler *Crawler) getJobScreenshot(ctx context.Context, id string, pageURL *url.URL) ([]byte, error) {
+	var screenshot []byte
+	scanErr := crawler.dbConnPool.QueryRow(ctx, `select screenshot from data_crawler_screenshots where job_id = $1 and template = $2;`, id, templateURL(pageURL)).Scan(&screenshot)
+	if errors.Is(scanErr, pgx.ErrNoRows) {
+		return nil, errScreenshotNotFound
+	} else if scanErr != nil {
+		return nil, fmt.Errorf("unable to query database: %w", scanErr)
+	}
+
+	return screenshot, nil
+}
+
+// openBrowser opens the browser for a browser crawl job, which sends its traffic through the proxy.
+func (crawler *Crawler) openBrowser(ctx context.Context) (*browser, error) {
+	proxyAddr := crawler.cfg.CrawlerBrowserProxy
+	if proxyAddr == "" {
+		proxyAddr = crawler.proxyAddr
+	}
+
+	return openBrowser(ctx, crawler.cfg.CrawlerCDPURL, crawler.cfg.CrawlerBrowser, proxyAddr)
+}
+
+// waitForProxy waits until the proxy accepts connections, as crawl jobs may be resumed before it has started.
+func (crawler *Crawler) waitForProxy(ctx context.Context) error {
+	for i := 0; ; i++ {
+		conn, dialErr := (&net.Dialer{Timeout: time.Second}).DialContext(ctx, "tcp", crawler.proxyAddr)
+		if dialErr == nil {
+			return conn.Close()
+		}
+		if i == 30 {
+			return fmt.Errorf("unable to connect to proxy at %s: %w", crawler.proxyAddr, dialErr)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// queueURLs saves the given newly found URLs for the crawl job with the given ID to the database, in a single batch.
+func (crawler *Crawler) queueURLs(ctx context.Context, jobID string, urls []*crawlURL) error {
+	if len(urls) == 0 {
+		return nil
+	}
+
+	batch := &pgx.Batch{}
+	now := time.Now()
+	for _, u := range urls {
+		batch.Queue(`insert into data_crawler_urls (job_id, template, url, referer, depth, status, discovered) values ($1, $2, $3, $4, $5, $6, $7) on conflict on constraint data_crawler_urls_pk do nothing;`,
+			jobID, u.template, u.url.String(), u.referer, u.depth, urlStatusQueued, now)
+	}
+	if batchErr := crawler.dbConnPool.SendBatch(ctx, batch).Close(); batchErr != nil {
+		return fmt.Errorf("unable to insert %d crawl URLs into database: %w", len(urls), batchErr)
+	}
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package crawler
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestTemplateURL(t *testing.T) {
+	tests := []struct {
+		rawURL   string
+		template string
+	}{
+		{"https://Example.com", "https://example.com/"},
+		{"https://example.com/users/42/profile", "https://example.com/users/{int}/profile"},
+		{"https://example.com/orders/3f2504e0-4f89-11d3-9a0c-0305e82c3301.json", "https://example.com/orders/{uuid}.json"},
+		{"https://example.com/blog/2024-01-31/hello-world", "https://example.com/blog/{date}/hello-world"},
+		{"https://example.com/assets/5d41402abc4b2a76b9719d911017c592.js", "https://example.com/assets/{hex}.js"},
+		{"https://example.com/s/aB3dE5fG7hJ9kL1mN3pQ?b=2&a=1&a=3#top", "https://example.com/s/{token}?a&b"},
+		{"https://example.com/very-long-article-slug-about-things", "https://example.com/very-long-article-slug-about-things"},
+	}
+	for _, test := range tests {
+		u, _ := url.Parse(test.rawURL)
+		if got := templateURL(u); got != test.template {
+			t.Errorf("templateURL(%q) = %q, want %q", test.rawURL, got, test.template)
+		}
+	}
+}
+
+func TestParseRobots(t *testing.T) {
+	robots := []byte(`
+User-agent: *
+Disallow: /
+
+User-agent: cartograph
+User-agent: other
+Disallow: /private
+Allow: /private/public$
+Disallow: /*.php$
+Crawl-delay: 2
+`)
+	rules := parseRobots(robots, "Cartograph Crawler")
+	if rules.crawlDelay != 2*time.Second {
+		t.Errorf("crawlDelay = %s, want 2s", rules.crawlDelay)
+	}
+
+	tests := map[string]bool{
+		"https://example.com/":                  true,
+		"https://example.com/private/keys":      false,
+		"https://example.com/private/public":    true,
+		"https://example.com/private/public/no": false,
+		"https://example.com/index.php":         false,
+		"https://example.com/index.php?x=1":     true,
+	}
+	for rawURL, want := range tests {
+		u, _ := url.Parse(rawURL)
+		if got := rules.allowed(u); got != want {
+			t.Errorf("allowed(%q) = %t, want %t", rawURL, got, want)
+		}
+	}
+
+	// Other user agents get the "*" group
+	u, _ := url.Parse("https://example.com/")
+	if parseRobots(robots, "SomeBot").allowed(u) {
+		t.Errorf("allowed(%q) = true for the \"*\" group, want false", u)
+	}
+}
+
+func TestExtractLinks(t *testing.T) {
+	pageURL, _ := url.Parse("https://example.com/app/index.html")
+	document := []byte(`<html><head><base href="/base/"><script src="main.js"></script></head>
+<body><a href="page?id=1#section">Page</a><a href="#top">Top</a><a href="mailto:a@example.com">Mail</a>
+<form method="post" action="/login"></form><form action="/search"></form></body></html>`)
+
+	want := []string{"https://example.com/base/main.js", "https://example.com/base/page?id=1#section", "mailto:a@example.com", "https://example.com/search"}
+	links := extractLinks(pageURL, document)
+	if len(links) != len(want) {
+		t.Fatalf("extractLinks() = %v, want %v", links, want)
+	}
+	for i, link := range links {
+		if link.String() != want[i] {
+			t.Errorf("extractLinks()[%d] = %q, want %q", i, link, want[i])
+		}
+	}
+}
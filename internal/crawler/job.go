@@ -0,0 +1,802 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/html"
+
+	internalHttp "github.com/TheHackerDev/cartograph/internal/shared/http"
+)
+
+// Crawl URL statuses.
+const (
+	urlStatusQueued  string = "queued"
+	urlStatusVisited string = "visited"
+	urlStatusRobots  string = "robots"
+	urlStatusError   string = "error"
+)
+
+const (
+	// maxBodySize is the maximum number of bytes of each response read for links.
+	maxBodySize = 5 << 20
+
+	// progressInterval is how often the progress of a running crawl job is saved to the database.
+	progressInterval = 10 * time.Second
+)
+
+// JobURL is a URL found by a crawl job, as saved in the data_crawler_urls table.
+type JobURL struct {
+	Template   string     `json:"template"`
+	URL        string     `json:"url"`
+	Referer    string     `json:"referer"`
+	Depth      int        `json:"depth"`
+	Status     string     `json:"status"`
+	RespCode   int        `json:"resp_code"`
+	Error      string     `json:"error"`
+	Discovered time.Time  `json:"discovered"`
+	Visited    *time.Time `json:"visited"`
+}
+
+// crawlURL is a URL waiting to be crawled.
+type crawlURL struct {
+	url      *url.URL
+	template string
+	referer  string
+	depth    int
+}
+
+// job is a running crawl job.
+type job struct {
+	// mu protects data, reserved, seen, robots and finalStatus.
+	mu sync.Mutex
+
+	crawler *Crawler
+
+	// data is the job as saved in the database.
+	data *Job
+
+	// ctx is cancelled when the job is cancelled or paused.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// finalStatus is the status the job is saved with once it stops, if it is stopped before running out of URLs.
+	finalStatus string
+
+	// reserved is the number of URLs being crawled, which count towards the page limit until they are saved.
+	reserved int
+
+	// frontier holds the URLs waiting to be crawled.
+	frontier *frontier
+
+	// seen holds the templates of all URLs found by the job, so that each is only crawled once.
+	seen map[string]bool
+
+	// robots holds the robots.txt rules of each origin, fetched the first time a URL on the origin is crawled.
+	robots map[string]*robotsEntry
+
+	// limiter spaces out the requests sent to each host.
+	limiter *hostLimiter
+
+	// browser renders the job's pages, in browser crawls.
+	browser *browser
+}
+
+// robotsEntry holds the robots.txt rules for an origin, once they have been fetched.
+type robotsEntry struct {
+	once  sync.Once
+	rules *robotsRules
+}
+
+// newJob returns a new running crawl job for the given job data.
+func newJob(crawler *Crawler, data *Job) *job {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &job{
+		crawler:  crawler,
+		data:     data,
+		ctx:      ctx,
+		cancel:   cancel,
+		frontier: newFrontier(),
+		seen:     make(map[string]bool),
+		robots:   make(map[string]*robotsEntry),
+		limiter:  newHostLimiter(time.Duration(float64(time.Second) / data.Settings.RequestsPerSecond)),
+	}
+}
+
+// finish stops the job, which is saved with the given status.
+func (j *job) finish(status string) {
+	j.mu.Lock()
+	if j.finalStatus == "" {
+		j.finalStatus = status
+	}
+	j.mu.Unlock()
+	j.cancel()
+}
+
+// run crawls until there are no more URLs within the limits, or the job is stopped, then saves the job's final
+// status. If resume is true, the URLs found before the job was paused are loaded from the database; otherwise the
+// job starts from its seed hosts.
+func (j *job) run(resume bool) error {
+	defer j.cancel()
+
+	// Close the frontier once the job is stopped, so that the workers return
+	go func() {
+		<-j.ctx.Done()
+		j.frontier.close()
+	}()
+
+	runErr := j.crawl(resume)
+
+	// Save the final state, even if the job has been stopped
+	j.mu.Lock()
+	status := j.finalStatus
+	switch {
+	case status != "":
+	case runErr != nil:
+		status = JobStatusFailed
+		j.data.Error = runErr.Error()
+	default:
+		status = JobStatusFinished
+	}
+	j.data.Status = status
+	j.data.Updated = time.Now()
+	if status != JobStatusPaused {
+		finished := j.data.Updated
+		j.data.Finished = &finished
+	}
+	j.mu.Unlock()
+	if saveErr := j.saveProgress(context.Background()); saveErr != nil {
+		return errors.Join(runErr, saveErr)
+	}
+
+	return runErr
+}
+
+// crawl loads or seeds the frontier, then crawls it with the job's concurrency, saving progress periodically.
+func (j *job) crawl(resume bool) error {
+	if proxyErr := j.crawler.waitForProxy(j.ctx); proxyErr != nil {
+		if j.ctx.Err() != nil {
+			return nil
+		}
+		return proxyErr
+	}
+
+	if j.data.Settings.Mode == ModeBrowser {
+		var browserErr error
+		if j.browser, browserErr = j.crawler.openBrowser(j.ctx); browserErr != nil {
+			if j.ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("unable to open browser: %w", browserErr)
+		}
+		defer j.browser.close()
+	}
+
+	var loadErr error
+	if resume {
+		loadErr = j.loadQueued(j.ctx)
+	} else {
+		loadErr = j.seed(j.ctx)
+	}
+	if loadErr != nil {
+		if j.ctx.Err() != nil {
+			return nil
+		}
+		return loadErr
+	}
+
+	// Save the progress periodically
+	progressDone := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-progressDone:
+				return
+			case <-ticker.C:
+				if saveErr := j.saveProgress(j.ctx); saveErr != nil && j.ctx.Err() == nil {
+					log.WithError(saveErr).WithField("job", j.data.ID).Error("unable to save crawl job progress")
+				}
+			}
+		}
+	}()
+	defer close(progressDone)
+
+	var wg sync.WaitGroup
+	for i := 0; i < j.data.Settings.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				next, ok := j.frontier.next()
+				if !ok {
+					return
+				}
+				j.visit(next)
+				j.frontier.done()
+			}
+		}()
+	}
+	wg.Wait()
+
+	return nil
+}
+
+// seed queues the root of each of the job's hosts, at depth 0, with each URL scheme the logger has seen the host
+// use, or HTTPS if it hasn't seen the host yet.
+func (j *job) seed(ctx context.Context) error {
+	seeds := make([]*crawlURL, 0, len(j.data.Hosts))
+	for _, host := range j.data.Hosts {
+		schemes, schemesErr := j.hostSchemes(ctx, host)
+		if schemesErr != nil {
+			return schemesErr
+		}
+		for _, scheme := range schemes {
+			seeds = append(seeds, &crawlURL{url: &url.URL{Scheme: scheme, Host: host, Path: "/"}})
+		}
+	}
+
+	return j.enqueue(ctx, seeds)
+}
+
+// hostSchemes returns the URL schemes the logger has seen requested for the given host, or only "https" if there
+// are none.
+func (j *job) hostSchemes(ctx context.Context, host string) ([]string, error) {
+	rows, queryErr := j.crawler.dbConnPool.Query(ctx, `select distinct url_scheme from data_logger where url_host = $1 and url_scheme in ('http', 'https') order by url_scheme desc;`, host)
+	if queryErr != nil {
+		return nil, fmt.Errorf("unable to query database: %w", queryErr)
+	}
+	defer rows.Close()
+
+	schemes := make([]string, 0, 2)
+	for rows.Next() {
+		var scheme string
+		if scanErr := rows.Scan(&scheme); scanErr != nil {
+			return nil, fmt.Errorf("unable to scan row: %w", scanErr)
+		}
+		schemes = append(schemes, scheme)
+	}
+	if rowsErr := rows.Err(); rowsErr != nil {
+		return nil, fmt.Errorf("unable to iterate over rows: %w", rowsErr)
+	}
+	if len(schemes) == 0 {
+		schemes = append(schemes, "https")
+	}
+
+	return schemes, nil
+}
+
+// loadQueued loads the URLs already found by a paused job, queueing those that have not been crawled yet.
+func (j *job) loadQueued(ctx context.Context) error {
+	rows, queryErr := j.crawler.dbConnPool.Query(ctx, `select template, url, referer, depth, status from data_crawler_urls where job_id = $1 order by discovered, depth;`, j.data.ID)
+	if queryErr != nil {
+		return fmt.Errorf("unable to query database: %w", queryErr)
+	}
+	defer rows.Close()
+
+	queued := make([]*crawlURL, 0)
+	for rows.Next() {
+		var template, rawURL, referer, status string
+		var depth int
+		if scanErr := rows.Scan(&template, &rawURL, &referer, &depth, &status); scanErr != nil {
+			return fmt.Errorf("unable to scan row: %w", scanErr)
+		}
+		j.seen[template] = true
+		if status != urlStatusQueued {
+			continue
+		}
+		u, parseErr := url.Parse(rawURL)
+		if parseErr != nil {
+			continue
+		}
+		queued = append(queued, &crawlURL{url: u, template: template, referer: referer, depth: depth})
+	}
+	if rowsErr := rows.Err(); rowsErr != nil {
+		return fmt.Errorf("unable to iterate over rows: %w", rowsErr)
+	}
+
+	j.frontier.push(queued)
+
+	return nil
+}
+
+// enqueue queues the given URLs, skipping any that are out of scope or have already been found, and saves them to
+// the database.
+func (j *job) enqueue(ctx context.Context, urls []*crawlURL) error {
+	queued := make([]*crawlURL, 0, len(urls))
+	j.mu.Lock()
+	for _, u := range urls {
+		if u.url.Scheme != "http" && u.url.Scheme != "https" {
+			continue
+		}
+		if !j.crawler.cfg.IsTarget(u.url.Host, u.url.Host) {
+			continue
+		}
+		u.url.Fragment = ""
+		u.template = templateURL(u.url)
+		if j.seen[u.template] {
+			continue
+		}
+		j.seen[u.template] = true
+		queued = append(queued, u)
+	}
+	j.mu.Unlock()
+
+	if queueErr := j.crawler.queueURLs(ctx, j.data.ID, queued); queueErr != nil {
+		return queueErr
+	}
+	j.frontier.push(queued)
+
+	return nil
+}
+
+// visit crawls a single URL, then queues the links found in it and the connections from it already known to the
+// mapper and JavaScript analyzer.
+func (j *job) visit(next *crawlURL) {
+	// Stop once the page limit is reached, leaving the rest of the URLs queued. Otherwise, reserve a page within the
+	// limit, so that concurrent workers can't crawl past it; if the other workers hold the rest of the limit, the URL
+	// is left queued, in case their pages are left uncrawled by the job being paused.
+	j.mu.Lock()
+	if j.data.Visited+j.data.Errors >= j.data.Settings.MaxPages {
+		j.mu.Unlock()
+		j.cancel()
+		return
+	}
+	if j.data.Visited+j.data.Errors+j.reserved >= j.data.Settings.MaxPages {
+		j.mu.Unlock()
+		return
+	}
+	j.reserved++
+	j.mu.Unlock()
+
+	if j.data.Settings.RespectRobots {
+		rules := j.robotsRules(next.url)
+		if !rules.allowed(next.url) {
+			j.saveVisit(next, urlStatusRobots, 0, "")
+			return
+		}
+		j.limiter.setDelay(next.url.Host, rules.crawlDelay)
+	}
+
+	var page *pageResult
+	var pageErr error
+	if j.browser != nil {
+		page, pageErr = j.render(next)
+	} else {
+		page, pageErr = j.fetchPage(next)
+	}
+	if pageErr != nil {
+		if j.ctx.Err() != nil {
+			// Leave the URL queued, to be crawled when the job is resumed
+			j.mu.Lock()
+			j.reserved--
+			j.mu.Unlock()
+			return
+		}
+		j.saveVisit(next, urlStatusError, 0, pageErr.Error())
+		return
+	}
+	j.saveVisit(next, urlStatusVisited, page.respCode, "")
+	if page.screenshot != nil {
+		j.saveScreenshot(next, page.screenshot)
+	}
+
+	if next.depth >= j.data.Settings.MaxDepth {
+		return
+	}
+
+	// Collect the links from the page and the mapper data
+	links := page.links
+	if j.browser != nil {
+		j.saveNavigation(next.url, links)
+	}
+	knownLinks, knownErr := j.knownLinks(next.url)
+	if knownErr != nil && j.ctx.Err() == nil {
+		log.WithError(knownErr).WithField("url", next.url.String()).Warn("unable to get known links for crawled URL")
+	}
+	for _, link := range knownLinks {
+		links = append(links, pageLink{url: link})
+	}
+
+	children := make([]*crawlURL, 0, len(links))
+	for _, link := range links {
+		children = append(children, &crawlURL{url: link.url, referer: next.url.String(), depth: next.depth + 1})
+	}
+	if enqueueErr := j.enqueue(j.ctx, children); enqueueErr != nil && j.ctx.Err() == nil {
+		log.WithError(enqueueErr).WithField("job", j.data.ID).Error("unable to queue crawled links")
+	}
+}
+
+// fetchPage requests a single URL, and collects the links from its redirect location and, for HTML responses, its
+// body.
+func (j *job) fetchPage(next *crawlURL) (*pageResult, error) {
+	response, body, fetchErr := j.fetch(next.url, next.referer)
+	if fetchErr != nil {
+		return nil, fetchErr
+	}
+
+	page := &pageResult{respCode: response.StatusCode}
+	if location, locationErr := response.Location(); locationErr == nil {
+		page.links = append(page.links, pageLink{url: location, action: navigationRedirect})
+	}
+	if strings.Contains(response.Header.Get("Content-Type"), "html") {
+		for _, link := range extractLinks(next.url, body) {
+			page.links = append(page.links, pageLink{url: link, action: navigationLink})
+		}
+	}
+
+	return page, nil
+}
+
+// render renders a single URL in the job's browser, once the host's rate limit allows it.
+func (j *job) render(next *crawlURL) (*pageResult, error) {
+	if waitErr := j.limiter.wait(j.ctx, next.url.Host); waitErr != nil {
+		return nil, waitErr
+	}
+
+	return j.browser.visit(j.ctx, next.url, next.referer, j.data.Settings.UserAgent)
+}
+
+// fetch sends a GET request for the given URL through the proxy, returning the response and up to maxBodySize bytes
+// of its body.
+func (j *job) fetch(u *url.URL, referer string) (*http.Response, []byte, error) {
+	if waitErr := j.limiter.wait(j.ctx, u.Host); waitErr != nil {
+		return nil, nil, waitErr
+	}
+
+	request, requestErr := http.NewRequestWithContext(j.ctx, http.MethodGet, u.String(), nil)
+	if requestErr != nil {
+		return nil, nil, fmt.Errorf("unable to create request: %w", requestErr)
+	}
+	request.Header.Set("User-Agent", j.data.Settings.UserAgent)
+	request.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+	if referer != "" {
+		// The referer lets the mapper record the connection the crawler followed
+		request.Header.Set("Referer", referer)
+	}
+
+	response, responseErr := j.crawler.client.Do(request)
+	if responseErr != nil {
+		return nil, nil, fmt.Errorf("unable to send request: %w", responseErr)
+	}
+	defer response.Body.Close()
+
+	body, readErr := io.ReadAll(io.LimitReader(response.Body, maxBodySize))
+	if readErr != nil {
+		return nil, nil, fmt.Errorf("unable to read response body: %w", readErr)
+	}
+
+	// Bodies are decoded transparently, unless the proxy passed on an encoding the client didn't ask for
+	if contentEncoding := response.Header.Get("Content-Encoding"); contentEncoding != "" {
+		if decoded, decodeErr := internalHttp.DecodeBody(body, contentEncoding); decodeErr == nil {
+			body = decoded
+		}
+	}
+
+	return response, body, nil
+}
+
+// robotsRules returns the robots.txt rules for the origin of the given URL, fetching them the first time.
+// If the robots.txt file can't be fetched, everything is allowed.
+func (j *job) robotsRules(u *url.URL) *robotsRules {
+	origin := u.Scheme + "://" + u.Host
+	j.mu.Lock()
+	entry, ok := j.robots[origin]
+	if !ok {
+		entry = &robotsEntry{}
+		j.robots[origin] = entry
+	}
+	j.mu.Unlock()
+
+	entry.once.Do(func() {
+		entry.rules = &robotsRules{}
+		response, body, fetchErr := j.fetch(&url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/robots.txt"}, "")
+		if fetchErr != nil {
+			log.WithError(fetchErr).WithField("origin", origin).Debug("unable to fetch robots.txt")
+			return
+		}
+		if response.StatusCode == http.StatusOK {
+			entry.rules = parseRobots(body, j.data.Settings.UserAgent)
+		}
+	})
+
+	return entry.rules
+}
+
+// knownLinks returns the URLs the mapper has already seen requested from the given URL, and the endpoints the
+// JavaScript analyzer found in it if it is a script.
+func (j *job) knownLinks(u *url.URL) ([]*url.URL, error) {
+	rows, queryErr := j.crawler.dbConnPool.Query(j.ctx, `select destination_scheme, destination_host, destination_path from data_mapper where referer_scheme = $1 and referer_host = $2 and referer_path = $3
+		union
+		select url_scheme, url_host, url_path from data_js_endpoints where script_url = $4;`,
+		u.Scheme, u.Host, u.Path, u.String())
+	if queryErr != nil {
+		return nil, fmt.Errorf("unable to query database: %w", queryErr)
+	}
+	defer rows.Close()
+
+	links := make([]*url.URL, 0)
+	for rows.Next() {
+		link := &url.URL{}
+		if scanErr := rows.Scan(&link.Scheme, &link.Host, &link.Path); scanErr != nil {
+			return nil, fmt.Errorf("unable to scan row: %w", scanErr)
+		}
+		if link.Scheme == "" {
+			link.Scheme = u.Scheme
+		}
+		if link.Host == "" {
+			link.Host = u.Host
+		}
+		links = append(links, link)
+	}
+	if rowsErr := rows.Err(); rowsErr != nil {
+		return nil, fmt.Errorf("unable to iterate over rows: %w", rowsErr)
+	}
+
+	return links, nil
+}
+
+// saveVisit saves the result of crawling the given URL to the database, and counts it in the job's progress in place
+// of its reserved page.
+func (j *job) saveVisit(visited *crawlURL, status string, respCode int, errMsg string) {
+	j.mu.Lock()
+	j.reserved--
+	switch status {
+	case urlStatusVisited:
+		j.data.Visited++
+	case urlStatusRobots:
+		j.data.Skipped++
+	case urlStatusError:
+		j.data.Errors++
+	}
+	j.mu.Unlock()
+
+	sqlUpdateURL := `update data_crawler_urls set status = $3, resp_code = $4, error = $5, visited = $6 where job_id = $1 and template = $2;`
+	if _, updateErr := j.crawler.dbConnPool.Exec(context.Background(), sqlUpdateURL, j.data.ID, visited.template, status, respCode, errMsg, time.Now()); updateErr != nil {
+		log.WithError(updateErr).WithField("job", j.data.ID).Error("unable to save crawled URL to database")
+	}
+}
+
+// saveScreenshot saves the screenshot of the given rendered URL to the database.
+func (j *job) saveScreenshot(visited *crawlURL, screenshot []byte) {
+	sqlInsertScreenshot := `insert into data_crawler_screenshots (job_id, template, url, screenshot, taken) values ($1, $2, $3, $4, $5) on conflict on constraint data_crawler_screenshots_pk do update set url = excluded.url, screenshot = excluded.screenshot, taken = excluded.taken;`
+	if _, insertErr := j.crawler.dbConnPool.Exec(context.Background(), sqlInsertScreenshot, j.data.ID, visited.template, visited.url.String(), screenshot, time.Now()); insertErr != nil {
+		log.WithError(insertErr).WithField("job", j.data.ID).Error("unable to save screenshot to database")
+	}
+}
+
+// saveNavigation saves the navigation from the given rendered URL to each of the given in-scope links to the
+// database, in a single batch.
+func (j *job) saveNavigation(from *url.URL, links []pageLink) {
+	batch := &pgx.Batch{}
+	now := time.Now()
+	for _, link := range links {
+		if link.action == "" || (link.url.Scheme != "http" && link.url.Scheme != "https") || !j.crawler.cfg.IsTarget(link.url.Host, link.url.Host) {
+			continue
+		}
+		batch.Queue(`insert into data_crawler_navigation (job_id, from_url, to_url, action, element, discovered) values ($1, $2, $3, $4, $5, $6) on conflict on constraint data_crawler_navigation_pk do nothing;`,
+			j.data.ID, from.String(), link.url.String(), link.action, link.element, now)
+	}
+	if batch.Len() == 0 {
+		return
+	}
+	if batchErr := j.crawler.dbConnPool.SendBatch(context.Background(), batch).Close(); batchErr != nil {
+		log.WithError(batchErr).WithField("job", j.data.ID).Error("unable to save page navigation to database")
+	}
+}
+
+// saveProgress saves the job's status and counters to the database.
+func (j *job) saveProgress(ctx context.Context) error {
+	j.mu.Lock()
+	data := *j.data
+	j.mu.Unlock()
+	if data.Status == JobStatusRunning {
+		data.Updated = time.Now()
+	}
+
+	sqlUpdateJob := `update data_crawler set status = $2, visited = $3, skipped = $4, errors = $5, error = $6, updated = $7, finished = $8 where id = $1;`
+	if _, updateErr := j.crawler.dbConnPool.Exec(ctx, sqlUpdateJob, data.ID, data.Status, data.Visited, data.Skipped, data.Errors, data.Error, data.Updated, data.Finished); updateErr != nil {
+		return fmt.Errorf("unable to save crawl job progress to database: %w", updateErr)
+	}
+
+	return nil
+}
+
+// linkAttributes maps the elements links are extracted from to the attribute holding the link.
+var linkAttributes = map[string]string{
+	"a":      "href",
+	"area":   "href",
+	"link":   "href",
+	"script": "src",
+	"iframe": "src",
+	"frame":  "src",
+	"form":   "action",
+}
+
+// extractLinks returns the absolute URLs linked to by the given HTML document, resolved against the page URL and any
+// <base> element. Forms are only followed if they are sent with GET.
+func extractLinks(pageURL *url.URL, document []byte) []*url.URL {
+	base := pageURL
+	links := make([]*url.URL, 0)
+	tokenizer := html.NewTokenizer(bytes.NewReader(document))
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			return links
+		}
+		if tokenType != html.StartTagToken && tokenType != html.SelfClosingTagToken {
+			continue
+		}
+
+		name, hasAttributes := tokenizer.TagName()
+		if !hasAttributes {
+			continue
+		}
+		attributes := make(map[string]string)
+		for {
+			key, value, more := tokenizer.TagAttr()
+			attributes[string(key)] = string(value)
+			if !more {
+				break
+			}
+		}
+
+		element := string(name)
+		if element == "base" {
+			if href, parseErr := pageURL.Parse(strings.TrimSpace(attributes["href"])); parseErr == nil && attributes["href"] != "" {
+				base = href
+			}
+			continue
+		}
+		attribute, ok := linkAttributes[element]
+		if !ok {
+			continue
+		}
+		if element == "form" && attributes["method"] != "" && !strings.EqualFold(attributes["method"], http.MethodGet) {
+			continue
+		}
+		rawLink := strings.TrimSpace(attributes[attribute])
+		if rawLink == "" || strings.HasPrefix(rawLink, "#") {
+			continue
+		}
+		if link, parseErr := base.Parse(rawLink); parseErr == nil {
+			links = append(links, link)
+		}
+	}
+}
+
+// frontier is the queue of URLs waiting to be crawled by a job's workers, in the order they were found, so that
+// the crawl is breadth-first.
+type frontier struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	queue    []*crawlURL
+	inFlight int
+	closed   bool
+}
+
+// newFrontier returns a new, empty frontier.
+func newFrontier() *frontier {
+	f := &frontier{}
+	f.cond = sync.NewCond(&f.mu)
+
+	return f
+}
+
+// push adds the given URLs to the end of the queue.
+func (f *frontier) push(urls []*crawlURL) {
+	if len(urls) == 0 {
+		return
+	}
+
+	f.mu.Lock()
+	f.queue = append(f.queue, urls...)
+	f.mu.Unlock()
+	f.cond.Broadcast()
+}
+
+// next blocks until a URL is available, and returns it. It returns false once the queue is empty with no URLs being
+// crawled, as no more can be found, or once the frontier is closed. Every URL returned must be marked as done.
+func (f *frontier) next() (*crawlURL, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for len(f.queue) == 0 && f.inFlight > 0 && !f.closed {
+		f.cond.Wait()
+	}
+	if len(f.queue) == 0 || f.closed {
+		return nil, false
+	}
+
+	next := f.queue[0]
+	f.queue[0] = nil
+	f.queue = f.queue[1:]
+	f.inFlight++
+
+	return next, true
+}
+
+// done marks a URL returned by next as crawled.
+func (f *frontier) done() {
+	f.mu.Lock()
+	f.inFlight--
+	f.mu.Unlock()
+	f.cond.Broadcast()
+}
+
+// close wakes all waiting workers, and stops any more URLs from being returned.
+func (f *frontier) close() {
+	f.mu.Lock()
+	f.closed = true
+	f.mu.Unlock()
+	f.cond.Broadcast()
+}
+
+// hostLimiter spaces out the requests sent to each host by at least a minimum delay.
+type hostLimiter struct {
+	mu sync.Mutex
+
+	// delay is the minimum time between requests to each host.
+	delay time.Duration
+
+	// hostDelays holds longer delays for some hosts, such as those asked for by their robots.txt file.
+	hostDelays map[string]time.Duration
+
+	// next holds the earliest time the next request may be sent to each host.
+	next map[string]time.Time
+}
+
+// newHostLimiter returns a new host limiter with the given minimum delay between requests to each host.
+func newHostLimiter(delay time.Duration) *hostLimiter {
+	return &hostLimiter{
+		delay:      delay,
+		hostDelays: make(map[string]time.Duration),
+		next:       make(map[string]time.Time),
+	}
+}
+
+// setDelay sets a longer delay between requests to the given host. Delays shorter than the minimum are ignored.
+func (l *hostLimiter) setDelay(host string, delay time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if delay > l.delay {
+		l.hostDelays[host] = delay
+	}
+}
+
+// wait blocks until a request may be sent to the given host, reserving its slot, or until the context is done.
+func (l *hostLimiter) wait(ctx context.Context, host string) error {
+	l.mu.Lock()
+	delay := l.delay
+	if hostDelay, ok := l.hostDelays[host]; ok {
+		delay = hostDelay
+	}
+	now := time.Now()
+	slot := l.next[host]
+	if slot.Before(now) {
+		slot = now
+	}
+	l.next[host] = slot.Add(delay)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(time.Until(slot))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,150 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxCrawlDelay is the longest robots.txt crawl delay honoured, so that a single host can't stall a crawl job.
+const maxCrawlDelay = 30 * time.Second
+
+// robotsRule is a single "Allow" or "Disallow" rule from a robots.txt file.
+type robotsRule struct {
+	allow   bool
+	pattern string
+}
+
+// robotsRules are the robots.txt rules that apply to the crawler on a single host.
+// The zero value allows everything.
+type robotsRules struct {
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+// robotsGroup is a group of rules in a robots.txt file, for the user agents listed at its start.
+type robotsGroup struct {
+	agents     []string
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+// parseRobots parses the given robots.txt file, returning the rules for the given user agent. The rules of the group
+// with the longest user agent token found in the user agent are used, or else those of the "*" group, as described
+// in RFC 9309.
+func parseRobots(contents []byte, userAgent string) *robotsRules {
+	var groups []*robotsGroup
+	var group *robotsGroup
+	inAgents := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			// Consecutive user-agent lines share a group
+			if !inAgents {
+				group = &robotsGroup{}
+				groups = append(groups, group)
+			}
+			group.agents = append(group.agents, strings.ToLower(value))
+			inAgents = true
+		case "allow", "disallow":
+			inAgents = false
+			if group == nil || value == "" {
+				// An empty disallow rule allows everything
+				continue
+			}
+			group.rules = append(group.rules, robotsRule{allow: key == "allow", pattern: value})
+		case "crawl-delay":
+			inAgents = false
+			if group == nil {
+				continue
+			}
+			if seconds, parseErr := strconv.ParseFloat(value, 64); parseErr == nil && seconds > 0 {
+				group.crawlDelay = min(time.Duration(seconds*float64(time.Second)), maxCrawlDelay)
+			}
+		}
+	}
+
+	// Pick the most specific group for the user agent
+	userAgent = strings.ToLower(userAgent)
+	var matched *robotsGroup
+	matchedLength := -1
+	for _, g := range groups {
+		for _, agent := range g.agents {
+			switch {
+			case agent == "*" && matchedLength < 0:
+				matched, matchedLength = g, 0
+			case agent != "*" && agent != "" && strings.Contains(userAgent, agent) && len(agent) > matchedLength:
+				matched, matchedLength = g, len(agent)
+			}
+		}
+	}
+	if matched == nil {
+		return &robotsRules{}
+	}
+
+	return &robotsRules{rules: matched.rules, crawlDelay: matched.crawlDelay}
+}
+
+// allowed returns true if the given URL may be crawled. The longest matching rule wins, and "Allow" rules win ties.
+func (r *robotsRules) allowed(u *url.URL) bool {
+	target := u.EscapedPath()
+	if target == "" {
+		target = "/"
+	}
+	if u.RawQuery != "" {
+		target += "?" + u.RawQuery
+	}
+
+	allow, matchedLength := true, -1
+	for _, rule := range r.rules {
+		if !robotsPatternMatches(rule.pattern, target) {
+			continue
+		}
+		if len(rule.pattern) > matchedLength || (len(rule.pattern) == matchedLength && rule.allow) {
+			allow, matchedLength = rule.allow, len(rule.pattern)
+		}
+	}
+
+	return allow
+}
+
+// robotsPatternMatches returns true if the given robots.txt path pattern matches the start of the given path, where
+// "*" matches any characters and a trailing "$" matches the end of the path.
+func robotsPatternMatches(pattern, target string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(target, parts[0]) {
+		return false
+	}
+	rest := target[len(parts[0]):]
+	for _, part := range parts[1:] {
+		index := strings.Index(rest, part)
+		if index == -1 {
+			return false
+		}
+		rest = rest[index+len(part):]
+	}
+
+	if anchored && rest != "" {
+		// The last part must match the end of the path, which may not be its first match
+		last := parts[len(parts)-1]
+		return len(parts) > 1 && strings.HasSuffix(target, last)
+	}
+
+	return true
+}
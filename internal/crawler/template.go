@@ -0,0 +1,92 @@
+package crawler
+
+import (
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	// uuidSegmentRegex matches path segments that are UUIDs.
+	uuidSegmentRegex = regexp.MustCompile(`(?i)^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+	// hexSegmentRegex matches path segments that are long hexadecimal values, such as hashes and object IDs.
+	hexSegmentRegex = regexp.MustCompile(`(?i)^[0-9a-f]{16,}$`)
+
+	// dateSegmentRegex matches path segments that are dates, such as "2024-01-31".
+	dateSegmentRegex = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+
+	// tokenSegmentRegex matches path segments that are long random-looking tokens, made of letters and numbers.
+	tokenSegmentRegex = regexp.MustCompile(`^[0-9A-Za-z_-]{20,}$`)
+)
+
+// templateURL returns the template of the given URL, which is used to deduplicate URLs that are likely to return the
+// same kind of page, such as "/users/1" and "/users/2".
+//
+// Path segments that are numbers, UUIDs, hexadecimal values, dates, or tokens are replaced by a placeholder, keeping
+// any file extension. Only the names of query parameters are kept, sorted, and the fragment is dropped.
+func templateURL(u *url.URL) string {
+	segments := strings.Split(u.EscapedPath(), "/")
+	for i, segment := range segments {
+		segments[i] = templateSegment(segment)
+	}
+
+	template := strings.ToLower(u.Scheme) + "://" + strings.ToLower(u.Host) + strings.Join(segments, "/")
+	if template == strings.ToLower(u.Scheme)+"://"+strings.ToLower(u.Host) {
+		template += "/"
+	}
+
+	query := u.Query()
+	if len(query) > 0 {
+		names := make([]string, 0, len(query))
+		for name := range query {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		template += "?" + strings.Join(names, "&")
+	}
+
+	return template
+}
+
+// templateSegment returns the placeholder for the given path segment, or the segment itself if it does not look like
+// a value.
+func templateSegment(segment string) string {
+	name, extension := segment, path.Ext(segment)
+	if extension != "" && extension != segment {
+		name = strings.TrimSuffix(segment, extension)
+	} else {
+		extension = ""
+	}
+
+	switch {
+	case name == "":
+		return segment
+	case isDigits(name):
+		return "{int}" + extension
+	case uuidSegmentRegex.MatchString(name):
+		return "{uuid}" + extension
+	case dateSegmentRegex.MatchString(name):
+		return "{date}" + extension
+	case hexSegmentRegex.MatchString(name) && strings.ContainsAny(name, "0123456789"):
+		return "{hex}" + extension
+	case tokenSegmentRegex.MatchString(name) && strings.ContainsAny(name, "0123456789") && strings.ToLower(name) != name && strings.ToUpper(name) != name:
+		// Mixed case letters and numbers, unlike most words and slugs
+		return "{token}" + extension
+	}
+
+	return segment
+}
+
+// isDigits returns true if the given string is made only of decimal digits.
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return s != ""
+}
@@ -1 +1,412 @@
 package dns
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+
+	internalHttp "github.com/TheHackerDev/cartograph/internal/shared/http"
+)
+
+// defaultResolutionsLimit is the maximum number of DNS records returned, unless another limit is given.
+const defaultResolutionsLimit = 1000
+
+// CandidateHost is a candidate host as returned by the candidates API, combining everywhere the host was found.
+type CandidateHost struct {
+	// Host is the host name.
+	Host string `json:"host"`
+
+	// Sources are the sources the host was found in, such as SourceCertificate or SourcePassive.
+	Sources []string `json:"sources"`
+
+	// FoundIn are the URLs or resolvers the host was first found in, one for each source.
+	FoundIn []string `json:"found_in"`
+
+	// FirstSeen is the first time the host was found.
+	FirstSeen time.Time `json:"first_seen"`
+
+	// LastSeen is the last time the host was found.
+	LastSeen time.Time `json:"last_seen"`
+
+	// IsTarget is true if the host is already a target.
+	IsTarget bool `json:"is_target"`
+
+	// Related is true if the host is a subdomain of the registrable domain of a target.
+	Related bool `json:"related"`
+}
+
+// ResolutionsAPIHandler is an HTTP handler that returns the logged DNS records as a JSON array, most recent first.
+// The results can be limited to a single resolved host with the "host" query parameter, and the "limit" query
+// parameter sets the maximum number of records returned.
+func (dns *DNS) ResolutionsAPIHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET requests (or OPTIONS)
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Allow", "GET, OPTIONS")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	} else if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET, OPTIONS")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	host := strings.ToLower(r.URL.Query().Get("host"))
+	limit := defaultResolutionsLimit
+	if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+		var parseErr error
+		if limit, parseErr = strconv.Atoi(limitParam); parseErr != nil || limit < 1 {
+			http.Error(w, fmt.Sprintf("invalid limit %q; must be a positive integer", limitParam), http.StatusBadRequest)
+			return
+		}
+	}
+
+	sqlSelect := `select host, name, record_type, value, ttl, resolver, rcode, source, timestamp
+		from data_dns
+		where ($1 = '' or host = $1)
+		order by timestamp desc
+		limit $2;`
+	rows, queryErr := dns.dbConnPool.Query(r.Context(), sqlSelect, host, limit)
+	if queryErr != nil {
+		http.Error(w, fmt.Sprintf("unable to get DNS records: %s", queryErr), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	records := make([]Record, 0)
+	for rows.Next() {
+		var record Record
+		var ttl int64
+		if scanErr := rows.Scan(&record.Host, &record.Name, &record.Type, &record.Value, &ttl, &record.Resolver, &record.RCode, &record.Source, &record.Timestamp); scanErr != nil {
+			http.Error(w, fmt.Sprintf("unable to scan DNS records: %s", scanErr), http.StatusInternalServerError)
+			return
+		}
+		record.TTL = uint32(ttl)
+		records = append(records, record)
+	}
+	if rowsErr := rows.Err(); rowsErr != nil {
+		http.Error(w, fmt.Sprintf("unable to get DNS records: %s", rowsErr), http.StatusInternalServerError)
+		return
+	}
+
+	internalHttp.WriteJSON(w, http.StatusOK, records)
+}
+
+// CandidatesAPIHandler is an HTTP handler that returns the candidate hosts as a JSON array, sorted by host.
+// By default, only the hosts that are subdomains of a target's registrable domain, but not yet targets themselves,
+// are returned. Setting the "all" query parameter to "true" returns every candidate host.
+func (dns *DNS) CandidatesAPIHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET requests (or OPTIONS)
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Allow", "GET, OPTIONS")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	} else if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET, OPTIONS")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	all := r.URL.Query().Get("all") == "true"
+
+	sqlSelect := `select host, array_agg(source order by source), array_agg(found_in order by source), min(first_seen), max(last_seen)
+		from data_dns_candidates
+		group by host
+		order by host;`
+	rows, queryErr := dns.dbConnPool.Query(r.Context(), sqlSelect)
+	if queryErr != nil {
+		http.Error(w, fmt.Sprintf("unable to get candidate hosts: %s", queryErr), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	domains := make(map[string]bool)
+	for _, domain := range targetDomains(dns.cfg) {
+		domains[domain] = true
+	}
+
+	candidates := make([]CandidateHost, 0)
+	for rows.Next() {
+		var candidate CandidateHost
+		if scanErr := rows.Scan(&candidate.Host, &candidate.Sources, &candidate.FoundIn, &candidate.FirstSeen, &candidate.LastSeen); scanErr != nil {
+			http.Error(w, fmt.Sprintf("unable to scan candidate hosts: %s", scanErr), http.StatusInternalServerError)
+			return
+		}
+		candidate.IsTarget = dns.cfg.IsTarget("", candidate.Host)
+		if domain, domainErr := publicsuffix.EffectiveTLDPlusOne(candidate.Host); domainErr == nil {
+			candidate.Related = domains[domain]
+		}
+		if !all && (candidate.IsTarget || !candidate.Related) {
+			continue
+		}
+		candidates = append(candidates, candidate)
+	}
+	if rowsErr := rows.Err(); rowsErr != nil {
+		http.Error(w, fmt.Sprintf("unable to get candidate hosts: %s", rowsErr), http.StatusInternalServerError)
+		return
+	}
+
+	internalHttp.WriteJSON(w, http.StatusOK, candidates)
+}
+
+// PassiveAPIHandler is an HTTP handler that imports the passive DNS records in the request body, in the same formats
+// as the passive DNS file, and returns the number of records imported.
+func (dns *DNS) PassiveAPIHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow POST requests (or OPTIONS)
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Allow", "POST, OPTIONS")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	} else if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST, OPTIONS")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	records, parseErr := parsePassive(r.Body, "api", time.Now())
+	if parseErr != nil {
+		http.Error(w, fmt.Sprintf("unable to import passive DNS records: %s", parseErr), http.StatusBadRequest)
+		return
+	}
+	dns.logRecords(records, SourcePassive)
+
+	internalHttp.WriteJSON(w, http.StatusOK, map[string]int{"imported": len(records)})
+}
+
+// SettingsAPIHandler is an HTTP handler function for the DNS plugin settings.
+// GET requests return the settings, and PUT requests replace them.
+func (dns *DNS) SettingsAPIHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		internalHttp.WriteJSON(w, http.StatusOK, dns.getSettings())
+		return
+	case http.MethodPut:
+		// Ensure the content-type in the request is correct
+		if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+			http.Error(w, fmt.Sprintf("Content-Type must be %q", "application/json"), http.StatusBadRequest)
+			return
+		}
+
+		reqBody, bodyCopy, bodyReadErr := internalHttp.ReadBody(r.Body)
+		r.Body = bodyCopy
+		if bodyReadErr != nil {
+			http.Error(w, fmt.Sprintf("unable to read request body: %s", bodyReadErr.Error()), http.StatusInternalServerError)
+			return
+		}
+		settings := dns.getSettings()
+		if jsonUnmarshalErr := json.Unmarshal(reqBody, &settings); jsonUnmarshalErr != nil {
+			http.Error(w, fmt.Sprintf("unable to parse JSON request body into DNS settings: %s", jsonUnmarshalErr.Error()), http.StatusBadRequest)
+			return
+		}
+
+		if saveErr := dns.saveSettings(settings); saveErr != nil {
+			http.Error(w, fmt.Sprintf("unable to save DNS settings: %s", saveErr.Error()), http.StatusInternalServerError)
+			return
+		}
+		internalHttp.WriteJSON(w, http.StatusOK, dns.getSettings())
+		return
+	case http.MethodOptions:
+		w.Header().Set("Allow", "GET, PUT")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		http.Error(w, "invalid HTTP request method: "+r.Method, http.StatusMethodNotAllowed)
+		return
+	}
+}
+
+// NewOverridesAPIHandler returns a new instance of the DNS overrides API handler, using the provided DNS object.
+func NewOverridesAPIHandler(dns *DNS) *OverridesAPIHandler {
+	return &OverridesAPIHandler{
+		dns:       dns,
+		pathRegex: regexp.MustCompile(`(?i)(?P<overrides>/overrides)/?(?P<uuid>[0-9a-zA-Z]{8}-[0-9a-zA-Z]{4}-[0-9a-zA-Z]{4}-[0-9a-zA-Z]{4}-[0-9a-zA-Z]{12})?(?P<requests>/requests)?/?$`),
+	}
+}
+
+// OverridesAPIHandler performs the routing for the DNS overrides API.
+//
+// It conforms to the http.Handler interface, and should thus be used in a http.ServeMux instance as the handler for
+// all DNS overrides API functions, starting at a single top-level URL path.
+type OverridesAPIHandler struct {
+	// The plugin config.
+	dns *DNS
+
+	// Regular expression to find an override UUID, and whether the requests it was applied to are requested, if
+	// provided in the path
+	pathRegex *regexp.Regexp
+}
+
+// ServeHTTP conforms to the http.Handler interface, allowing this method to handle HTTP requests
+// for the DNS plugin's overrides API.
+// Requests are expected to be sent to a path ending in "/overrides/[uuid]", where the "[uuid]" is an optional value
+// representing an individual override, or "/overrides/[uuid]/requests" for the requests the override was applied to.
+func (h OverridesAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Get the UUID from the request path, if one is provided
+	matches := h.pathRegex.FindStringSubmatch(r.URL.Path)
+	if matches == nil {
+		http.Error(w, fmt.Sprintf("invalid path provided: %q", r.URL.Path), http.StatusBadRequest)
+		return
+	}
+	overrideID := strings.ToLower(matches[h.pathRegex.SubexpIndex("uuid")])
+	requests := matches[h.pathRegex.SubexpIndex("requests")] != ""
+	if requests && overrideID == "" {
+		http.Error(w, "no override ID provided in request URL path", http.StatusBadRequest)
+		return
+	}
+
+	// Check for a valid request method, and send to the appropriate handler function
+	switch r.Method {
+	case http.MethodGet:
+		if requests {
+			h.getOverrideRequests(overrideID).ServeHTTP(w, r)
+			return
+		}
+		h.getOverrides(overrideID).ServeHTTP(w, r)
+		return
+	case http.MethodPost:
+		if overrideID != "" {
+			http.Error(w, "use PUT to replace an existing override", http.StatusBadRequest)
+			return
+		}
+		h.saveOverride("").ServeHTTP(w, r)
+		return
+	case http.MethodPut:
+		if overrideID == "" || requests {
+			http.Error(w, "no override ID provided in request URL path", http.StatusBadRequest)
+			return
+		}
+		h.saveOverride(overrideID).ServeHTTP(w, r)
+		return
+	case http.MethodDelete:
+		if requests {
+			http.Error(w, "invalid path provided: "+r.URL.Path, http.StatusBadRequest)
+			return
+		}
+		h.removeOverride(overrideID).ServeHTTP(w, r)
+		return
+	case http.MethodOptions:
+		w.Header().Set("Allow", "GET, POST, PUT, DELETE")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		w.Header().Set("Allow", "GET, POST, PUT, DELETE")
+		http.Error(w, "invalid HTTP request method: "+r.Method, http.StatusMethodNotAllowed)
+		return
+	}
+}
+
+// getOverrides is an HTTP handler function that returns either:
+// - One DNS override, if the provided UUID is a valid ID.
+// - All DNS overrides, sorted by host, if the provided UUID is an empty string.
+func (h OverridesAPIHandler) getOverrides(id string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if id == "" {
+			internalHttp.WriteJSON(w, http.StatusOK, h.dns.getOverrides())
+			return
+		}
+
+		override := h.dns.getOverride(id)
+		if override == nil {
+			http.Error(w, "no DNS override with provided id: "+id, http.StatusNotFound)
+			return
+		}
+		internalHttp.WriteJSON(w, http.StatusOK, override)
+	}
+}
+
+// getOverrideRequests is an HTTP handler function that returns the requests sent to the address of the DNS override
+// with the provided UUID, most recent first. The optional "limit" query parameter sets the maximum number of requests
+// returned.
+func (h OverridesAPIHandler) getOverrideRequests(id string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit := defaultResolutionsLimit
+		if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+			var parseErr error
+			if limit, parseErr = strconv.Atoi(limitParam); parseErr != nil || limit < 1 {
+				http.Error(w, fmt.Sprintf("invalid limit %q; must be a positive integer", limitParam), http.StatusBadRequest)
+				return
+			}
+		}
+
+		requests, getErr := h.dns.getOverrideRequests(r.Context(), id, limit)
+		if getErr != nil {
+			http.Error(w, fmt.Sprintf("unable to get DNS override requests: %s", getErr), http.StatusInternalServerError)
+			return
+		}
+		internalHttp.WriteJSON(w, http.StatusOK, requests)
+	}
+}
+
+// saveOverride is an HTTP handler function that saves the DNS override in the request body, as a new override if the
+// provided UUID is an empty string, or replacing the override with the provided UUID.
+func (h OverridesAPIHandler) saveOverride(id string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Ensure the content-type in the request is correct
+		if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+			http.Error(w, fmt.Sprintf("Content-Type must be %q", "application/json"), http.StatusBadRequest)
+			return
+		}
+
+		// Attempt to parse the override in the request, with overrides enabled unless stated otherwise
+		reqBody, bodyCopy, bodyReadErr := internalHttp.ReadBody(r.Body)
+		r.Body = bodyCopy
+		if bodyReadErr != nil {
+			http.Error(w, fmt.Sprintf("unable to read request body: %s", bodyReadErr.Error()), http.StatusInternalServerError)
+			return
+		}
+		override := &Override{Enabled: true}
+		if jsonUnmarshalErr := json.Unmarshal(reqBody, override); jsonUnmarshalErr != nil {
+			http.Error(w, fmt.Sprintf("unable to parse JSON request body into DNS override: %s", jsonUnmarshalErr.Error()), http.StatusBadRequest)
+			return
+		}
+		override.ID = id
+		if validateErr := override.validate(h.dns.cfg); validateErr != nil {
+			http.Error(w, fmt.Sprintf("invalid DNS override: %s", validateErr.Error()), http.StatusBadRequest)
+			return
+		}
+
+		// Save the override
+		saved, saveErr := h.dns.saveOverride(override)
+		if errors.Is(saveErr, errOverrideNotFound) {
+			http.Error(w, "no DNS override with provided id: "+id, http.StatusNotFound)
+			return
+		} else if saveErr != nil {
+			http.Error(w, fmt.Sprintf("unable to save DNS override: %s", saveErr.Error()), http.StatusInternalServerError)
+			return
+		}
+
+		status := http.StatusOK
+		if id == "" {
+			status = http.StatusCreated
+		}
+		internalHttp.WriteJSON(w, status, saved)
+	}
+}
+
+// removeOverride is an HTTP handler function that removes the DNS override with the provided UUID.
+func (h OverridesAPIHandler) removeOverride(id string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Check for empty ID value
+		if id == "" {
+			http.Error(w, "no override ID provided in request URL path", http.StatusBadRequest)
+			return
+		}
+
+		if removeErr := h.dns.removeOverride(id); errors.Is(removeErr, errOverrideNotFound) {
+			http.Error(w, "no DNS override with provided id: "+id, http.StatusNotFound)
+			return
+		} else if removeErr != nil {
+			http.Error(w, fmt.Sprintf("unable to remove DNS override with ID %q: %s", id, removeErr.Error()), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -1 +1,55 @@
 package dns
+
+import (
+	"context"
+	"fmt"
+)
+
+// Settings holds the DNS plugin settings saved in the config_dns table.
+type Settings struct {
+	// LogResolutions is true if the records of every resolution are saved to the data_dns table.
+	LogResolutions bool `json:"log_resolutions"`
+
+	// CollectCandidates is true if the host names found in proxied traffic and DNS data are saved as candidate hosts.
+	CollectCandidates bool `json:"collect_candidates"`
+}
+
+// getSettings returns the DNS plugin settings.
+func (dns *DNS) getSettings() Settings {
+	dns.mu.RLock()
+	defer dns.mu.RUnlock()
+
+	return dns.settings
+}
+
+// saveSettings saves the given settings to the database and the local plugin.
+// If an error is returned, the settings are unchanged.
+func (dns *DNS) saveSettings(settings Settings) error {
+	dns.mu.Lock()
+	defer dns.mu.Unlock()
+
+	sqlUpdateSettings := `update config_dns set log_resolutions = $1, collect_candidates = $2;`
+	if _, updateErr := dns.dbConnPool.Exec(context.Background(), sqlUpdateSettings, settings.LogResolutions, settings.CollectCandidates); updateErr != nil {
+		return fmt.Errorf("unable to save DNS settings to database: %w", updateErr)
+	}
+
+	dns.settings = settings
+
+	return nil
+}
+
+// loadSettings updates the local DNS plugin settings from the database.
+func (dns *DNS) loadSettings(ctx context.Context) error {
+	var settings Settings
+	sqlSelectSettings := `select log_resolutions, collect_candidates from config_dns limit 1;`
+	if scanErr := dns.dbConnPool.QueryRow(ctx, sqlSelectSettings).Scan(&settings.LogResolutions, &settings.CollectCandidates); scanErr != nil {
+		return fmt.Errorf("unable to get DNS settings from database: %w", scanErr)
+	}
+
+	dns.mu.Lock()
+	defer dns.mu.Unlock()
+
+	dns.settings = settings
+
+	return nil
+}
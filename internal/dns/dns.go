@@ -1 +1,631 @@
 package dns
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	log "github.com/sirupsen/logrus"
+	netProxy "golang.org/x/net/proxy"
+	"golang.org/x/net/publicsuffix"
+
+	"github.com/TheHackerDev/cartograph/internal/config"
+	"github.com/TheHackerDev/cartograph/internal/shared/database"
+	"github.com/TheHackerDev/cartograph/internal/shared/datatypes"
+	"github.com/TheHackerDev/cartograph/internal/shared/dispatch"
+	"github.com/TheHackerDev/cartograph/internal/shared/metrics"
+)
+
+// Sources of DNS records.
+const (
+	SourceProxy    string = "proxy"
+	SourceListener string = "listener"
+	SourcePassive  string = "passive"
+)
+
+// Sources of candidate hosts, in addition to the DNS listener and passive DNS input.
+const (
+	SourceCertificate string = "san"
+	SourceCSP         string = "csp"
+	SourceJavaScript  string = "js"
+)
+
+const (
+	// recordCacheSize is the number of DNS records cached before they are saved to the database.
+	recordCacheSize int = 500
+
+	// candidateCacheSize is the number of candidate hosts cached before they are saved to the database.
+	candidateCacheSize int = 200
+
+	// overrideCacheSize is the number of requests sent to DNS override addresses cached before they are saved to the
+	// database.
+	overrideCacheSize int = 200
+
+	// maxSeenCandidates is the number of candidate hosts remembered, to avoid sending the same host from the same
+	// source to the database again. The memory is cleared once it is full.
+	maxSeenCandidates int = 50000
+)
+
+// hostLabelPattern matches one or more DNS labels, each followed by a dot, as found before a domain in a host name.
+const hostLabelPattern = `(?:[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?\.)+`
+
+// NewDNS returns a new, properly instantiated DNS object.
+// Any errors returned should be considered fatal.
+func NewDNS(cfg *config.Config) (*DNS, error) {
+	dns := &DNS{
+		cfg:            cfg,
+		recordCache:    make([]*Record, 0, recordCacheSize),
+		candidateCache: make([]*Candidate, 0, candidateCacheSize),
+		overrideCache:  make([]*AppliedOverride, 0, overrideCacheSize),
+		seenCandidates: make(map[Candidate]bool),
+		stop:           make(chan struct{}),
+		stopped:        make(chan struct{}),
+	}
+
+	// Get a database connection pool
+	dbConnPool, dbConnPoolErr := database.GetDbConnPool(cfg.DbConnString)
+	if dbConnPoolErr != nil {
+		return nil, fmt.Errorf("unable to get database connection pool: %w", dbConnPoolErr)
+	}
+	metrics.RegisterDbPool("dns", dbConnPool)
+	dns.dbConnPool = dbConnPool
+
+	if settingsErr := dns.loadSettings(context.Background()); settingsErr != nil {
+		return nil, fmt.Errorf("unable to set the DNS configuration from the database: %w", settingsErr)
+	}
+	overrides, overridesErr := dns.loadOverrides(context.Background())
+	if overridesErr != nil {
+		return nil, fmt.Errorf("unable to set the DNS overrides from the database: %w", overridesErr)
+	}
+	dns.overrides = overrides
+
+	// Create the input queues
+	var queueErr error
+	if dns.recordInput, queueErr = dispatch.NewQueue[*Record]("dns-records", cfg.DNSQueue); queueErr != nil {
+		return nil, fmt.Errorf("unable to create DNS record input queue: %w", queueErr)
+	}
+	if dns.candidateInput, queueErr = dispatch.NewQueue[*Candidate]("dns-candidates", cfg.DNSQueue); queueErr != nil {
+		return nil, fmt.Errorf("unable to create candidate host input queue: %w", queueErr)
+	}
+	if dns.overrideInput, queueErr = dispatch.NewQueue[*AppliedOverride]("dns-overrides", cfg.DNSQueue); queueErr != nil {
+		return nil, fmt.Errorf("unable to create DNS override input queue: %w", queueErr)
+	}
+
+	var servers []string
+	if cfg.DNSServer != "" {
+		servers = []string{cfg.DNSServer}
+	}
+	dns.resolver = newResolver(servers, cfg.DNSDoHURL, func(records []Record) { dns.logRecords(records, SourceProxy) })
+	dns.resolver.override = dns.matchOverride
+
+	return dns, nil
+}
+
+// DNS is the configuration object for the DNS plugin, which resolves the hosts the proxy connects to, logging every
+// resolution, and collects passive DNS data and the host names found in proxied traffic as candidate hosts for
+// targets.
+// A DNS object should *always* be instantiated via the NewDNS function.
+type DNS struct {
+	// mu is a RWMutex to control concurrent access.
+	mu sync.RWMutex
+
+	// cfg is the configuration object for the program.
+	cfg *config.Config
+
+	// settings holds the plugin settings.
+	settings Settings
+
+	// dbConnPool is a database connection pool used for concurrency-safe database connections.
+	dbConnPool *pgxpool.Pool
+
+	// resolver resolves the hosts the proxy connects to.
+	resolver *resolver
+
+	// recordInput is used to accept the DNS records to be logged to the database.
+	recordInput *dispatch.Queue[*Record]
+
+	// recordCache is used to temporarily cache DNS records before sending them to the database in a batch copy.
+	recordCache []*Record
+
+	// candidateInput is used to accept the candidate hosts to be saved to the database.
+	candidateInput *dispatch.Queue[*Candidate]
+
+	// candidateCache is used to temporarily cache candidate hosts before sending them to the database in a batch.
+	candidateCache []*Candidate
+
+	// seenCandidates holds the candidate hosts already sent to the database from each source, with an empty
+	// FoundIn value.
+	seenCandidates map[Candidate]bool
+
+	// overrides holds the DNS overrides, mapped by their IDs.
+	overrides map[string]*Override
+
+	// overrideInput is used to accept the requests sent to DNS override addresses, to be logged to the database.
+	overrideInput *dispatch.Queue[*AppliedOverride]
+
+	// overrideCache is used to temporarily cache requests sent to DNS override addresses before sending them to the
+	// database in a batch copy.
+	overrideCache []*AppliedOverride
+
+	// domainsRegex matches the subdomains of domainsKey, the registrable domains of the targets, when it was built.
+	domainsRegex *regexp.Regexp
+	domainsKey   string
+
+	// stop is closed to signal the Run loop to flush its caches and return.
+	stop chan struct{}
+
+	// stopped is closed by the Run loop once its caches have been flushed.
+	stopped chan struct{}
+
+	// stopOnce ensures the stop channel is only closed once.
+	stopOnce sync.Once
+}
+
+// Record is a single DNS record from a resolution, as saved in the data_dns table.
+type Record struct {
+	// Host is the host that was resolved.
+	Host string `json:"host"`
+
+	// Name is the owner name of the record, which differs from the host for records following a CNAME.
+	Name string `json:"name"`
+
+	// Type is the record type: "A", "AAAA", or "CNAME".
+	Type string `json:"type"`
+
+	// Value is the address, or the canonical name for CNAME records. It is empty if the resolution had no answer.
+	Value string `json:"value"`
+
+	// TTL is the record's time to live, in seconds.
+	TTL uint32 `json:"ttl"`
+
+	// Resolver is the DNS server that answered, the hosts file, or the passive DNS input the record was read from.
+	Resolver string `json:"resolver"`
+
+	// RCode is the response code of the resolution, such as "NOERROR" or "NXDOMAIN", if known.
+	RCode string `json:"rcode"`
+
+	// Source is where the resolution was seen: SourceProxy, SourceListener, or SourcePassive.
+	Source string `json:"source"`
+
+	// Timestamp is the time the resolution was performed.
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Candidate is a host name found in proxied traffic or DNS data, which may be worth adding to the targets.
+type Candidate struct {
+	// Host is the host name.
+	Host string `json:"host"`
+
+	// Source is where the host name was found, such as SourceCertificate or SourcePassive.
+	Source string `json:"source"`
+
+	// FoundIn is the URL or resolver the host name was found in.
+	FoundIn string `json:"found_in"`
+
+	// Timestamp is the time the host name was found.
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Run runs the DNS plugin, and the DNS listener if one is configured.
+// Any errors returned should be considered fatal.
+func (dns *DNS) Run() error {
+	// Signal Stop once the loop has returned
+	defer close(dns.stopped)
+
+	// Serve DNS to clients, if configured
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fatalErrChan := make(chan error, 1)
+	if dns.cfg.DNSListenAddr != "" {
+		listener, listenErr := newListener(dns.cfg.DNSListenAddr, dns.resolver, func(records []Record) { dns.logRecords(records, SourceListener) })
+		if listenErr != nil {
+			return fmt.Errorf("unable to start DNS listener: %w", listenErr)
+		}
+		go func() {
+			if serveErr := listener.serve(ctx); serveErr != nil {
+				fatalErrChan <- fmt.Errorf("problem with DNS listener: %w", serveErr)
+			}
+		}()
+	}
+
+	// Import the passive DNS file, if configured
+	if dns.cfg.DNSPassiveFile != "" {
+		go func() {
+			count, importErr := dns.importPassiveFile(dns.cfg.DNSPassiveFile)
+			if importErr != nil {
+				log.WithError(importErr).WithField("file", dns.cfg.DNSPassiveFile).Error("unable to import passive DNS file")
+				return
+			}
+			log.WithField("file", dns.cfg.DNSPassiveFile).Infof("imported %d passive DNS records", count)
+		}()
+	}
+
+	// Create a ticker for flushing out the local caches.
+	// Use a random interval to prevent bottlenecks in the database by competing services.
+	// The random time is anywhere between 10 and 30 seconds.
+	cacheFlushTicker := time.NewTicker(time.Second * time.Duration(rand.Intn(20)+10))
+	defer cacheFlushTicker.Stop()
+
+	for {
+		select {
+		case err := <-fatalErrChan:
+			dns.flushCaches()
+			return err
+		case <-dns.stop:
+			// Stop reading spilled data back into the input queues, handle any data still waiting in memory, then
+			// flush the local caches to the database
+			dns.closeInputs()
+			dns.drainInputs()
+			dns.flushCaches()
+			return nil
+		case record := <-dns.recordInput.Items():
+			dns.handleRecord(record)
+		case candidate := <-dns.candidateInput.Items():
+			dns.handleCandidate(candidate)
+		case applied := <-dns.overrideInput.Items():
+			dns.handleAppliedOverride(applied)
+		case <-cacheFlushTicker.C:
+			dns.flushCaches()
+		}
+	}
+}
+
+// Stop signals the DNS plugin to stop, and blocks until all cached data has been saved to the database.
+// It must only be called after Run has been started.
+func (dns *DNS) Stop() {
+	dns.stopOnce.Do(func() {
+		close(dns.stop)
+	})
+	<-dns.stopped
+}
+
+// QueueStats returns the statistics for the DNS plugin's input queues.
+func (dns *DNS) QueueStats() []dispatch.Stats {
+	return []dispatch.Stats{dns.recordInput.Stats(), dns.candidateInput.Stats(), dns.overrideInput.Stats()}
+}
+
+// DialContext connects to the given address, resolving its host with the DNS plugin's resolver, which logs the
+// resolution. It is used by the proxy for all connections to remote servers.
+func (dns *DNS) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return dns.resolver.DialContext(ctx, network, address)
+}
+
+// ProxyDialContext returns a function connecting to addresses through the given proxy dialer, such as a SOCKS5
+// proxy, for the proxy's HTTP client when an upstream proxy is configured. Hosts with an override are sent to the
+// upstream proxy as the override's address; the others are resolved by the upstream proxy, so their resolutions
+// aren't logged.
+func (dns *DNS) ProxyDialContext(dialer netProxy.ContextDialer) func(ctx context.Context, network, address string) (net.Conn, error) {
+	return dns.resolver.proxyDialContext(dialer)
+}
+
+// ObserveResponse collects the host names in the certificate and Content-Security-Policy headers of the given
+// response as candidate hosts, if it is a response from a target.
+func (dns *DNS) ObserveResponse(response *http.Response, referredData *datatypes.ReferrerData) {
+	if !dns.getSettings().CollectCandidates || !dns.cfg.IsTarget(referredData.Referer.Host, referredData.Destination.Host) {
+		return
+	}
+
+	foundIn := referredData.Destination.String()
+	if response.TLS != nil {
+		dns.ObserveCertificates(response.TLS, foundIn)
+	}
+	for _, header := range []string{"Content-Security-Policy", "Content-Security-Policy-Report-Only"} {
+		for _, policy := range response.Header.Values(header) {
+			dns.addCandidates(cspHosts(policy), SourceCSP, foundIn)
+		}
+	}
+}
+
+// ObserveCertificates collects the host names in the subject alternative names of the leaf certificate of the given
+// TLS connection as candidate hosts.
+func (dns *DNS) ObserveCertificates(state *tls.ConnectionState, foundIn string) {
+	if !dns.getSettings().CollectCandidates || len(state.PeerCertificates) == 0 {
+		return
+	}
+
+	dns.addCandidates(state.PeerCertificates[0].DNSNames, SourceCertificate, foundIn)
+}
+
+// ObserveScript collects the subdomains of the targets' registrable domains found in the given script body as
+// candidate hosts.
+func (dns *DNS) ObserveScript(scriptURL url.URL, body []byte) {
+	if !dns.getSettings().CollectCandidates {
+		return
+	}
+
+	domainsRegex := dns.targetDomainsRegex()
+	if domainsRegex == nil {
+		return
+	}
+	dns.addCandidates(domainsRegex.FindAllString(strings.ToLower(string(body)), -1), SourceJavaScript, scriptURL.String())
+}
+
+// logRecords sends the given DNS records from the given source to be logged to the database, and the hosts of
+// those seen by the DNS listener as candidate hosts.
+// It does not block; if the input queue is full, the records are handled according to the queue policy.
+func (dns *DNS) logRecords(records []Record, source string) {
+	settings := dns.getSettings()
+	for i := range records {
+		record := records[i]
+		record.Source = source
+		if settings.LogResolutions {
+			dns.recordInput.Enqueue(&record)
+		}
+		if settings.CollectCandidates && source != SourceProxy {
+			dns.addCandidates([]string{record.Name}, source, record.Resolver)
+		}
+	}
+}
+
+// addCandidates sends the given host names from the given source to be saved as candidate hosts, skipping those that
+// have already been sent from the same source.
+func (dns *DNS) addCandidates(hosts []string, source, foundIn string) {
+	now := time.Now()
+	for _, host := range hosts {
+		host = normalizeHost(host)
+		if host == "" {
+			continue
+		}
+
+		key := Candidate{Host: host, Source: source}
+		dns.mu.Lock()
+		seen := dns.seenCandidates[key]
+		if !seen {
+			if len(dns.seenCandidates) >= maxSeenCandidates {
+				dns.seenCandidates = make(map[Candidate]bool)
+			}
+			dns.seenCandidates[key] = true
+		}
+		dns.mu.Unlock()
+		if seen {
+			continue
+		}
+
+		dns.candidateInput.Enqueue(&Candidate{Host: host, Source: source, FoundIn: foundIn, Timestamp: now})
+	}
+}
+
+// normalizeHost returns the given host name in lower case, without any wildcard label, port, or trailing dot, or an
+// empty string if it isn't a valid host name with at least two labels.
+func normalizeHost(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	host = strings.TrimPrefix(host, "*.")
+	if h, _, splitErr := net.SplitHostPort(host); splitErr == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(host, ".")
+	if net.ParseIP(host) != nil || !strings.Contains(host, ".") || len(host) > 253 {
+		return ""
+	}
+	for _, label := range strings.Split(host, ".") {
+		if label == "" || len(label) > 63 || strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return ""
+		}
+		for _, c := range label {
+			if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' && c != '_' {
+				return ""
+			}
+		}
+	}
+
+	return host
+}
+
+// cspHosts returns the hosts in the source expressions of the given Content-Security-Policy.
+func cspHosts(policy string) []string {
+	hosts := make([]string, 0)
+	for _, directive := range strings.Split(policy, ";") {
+		fields := strings.Fields(directive)
+		if len(fields) < 2 {
+			continue
+		}
+		for _, source := range fields[1:] {
+			// Skip keywords, nonces, hashes, and scheme sources like "https:"
+			if strings.HasPrefix(source, "'") || strings.HasSuffix(source, ":") {
+				continue
+			}
+			if _, rest, ok := strings.Cut(source, "://"); ok {
+				source = rest
+			}
+			host, _, _ := strings.Cut(source, "/")
+			hosts = append(hosts, host)
+		}
+	}
+
+	return hosts
+}
+
+// targetDomains returns the registrable domains of the hosts of all targets, such as "example.com" for a
+// "*.api.example.com" target.
+func targetDomains(cfg *config.Config) []string {
+	domains := make(map[string]bool)
+	for _, target := range cfg.GetTargetsAndIgnoredAll() {
+		if target.IsIgnore {
+			continue
+		}
+		for host := range target.Hosts {
+			host = strings.TrimPrefix(strings.ToLower(host), "*.")
+			if domain, domainErr := publicsuffix.EffectiveTLDPlusOne(host); domainErr == nil && !strings.Contains(domain, "*") {
+				domains[domain] = true
+			}
+		}
+	}
+
+	sorted := make([]string, 0, len(domains))
+	for domain := range domains {
+		sorted = append(sorted, domain)
+	}
+	sort.Strings(sorted)
+
+	return sorted
+}
+
+// targetDomainsRegex returns a regular expression matching the subdomains of the targets' registrable domains, or
+// nil if there are none. It is only rebuilt when the domains change.
+func (dns *DNS) targetDomainsRegex() *regexp.Regexp {
+	domains := targetDomains(dns.cfg)
+	if len(domains) == 0 {
+		return nil
+	}
+	key := strings.Join(domains, ",")
+
+	dns.mu.Lock()
+	defer dns.mu.Unlock()
+
+	if key != dns.domainsKey {
+		quoted := make([]string, 0, len(domains))
+		for _, domain := range domains {
+			quoted = append(quoted, regexp.QuoteMeta(domain))
+		}
+		dns.domainsRegex = regexp.MustCompile(hostLabelPattern + `(?:` + strings.Join(quoted, "|") + `)\b`)
+		dns.domainsKey = key
+	}
+
+	return dns.domainsRegex
+}
+
+// handleRecord adds the given DNS record to the cache, and saves the cache to the database once it is full.
+func (dns *DNS) handleRecord(record *Record) {
+	dns.recordCache = append(dns.recordCache, record)
+	if len(dns.recordCache) >= recordCacheSize {
+		dns.flushRecordCache()
+	}
+}
+
+// handleCandidate adds the given candidate host to the cache, and saves the cache to the database once it is full.
+func (dns *DNS) handleCandidate(candidate *Candidate) {
+	dns.candidateCache = append(dns.candidateCache, candidate)
+	if len(dns.candidateCache) >= candidateCacheSize {
+		dns.flushCandidateCache()
+	}
+}
+
+// handleAppliedOverride adds the given request sent to a DNS override address to the cache, and saves the cache to the
+// database once it is full.
+func (dns *DNS) handleAppliedOverride(applied *AppliedOverride) {
+	dns.overrideCache = append(dns.overrideCache, applied)
+	if len(dns.overrideCache) >= overrideCacheSize {
+		dns.flushOverrideCache()
+	}
+}
+
+// drainInputs handles all data still waiting in the input queues.
+func (dns *DNS) drainInputs() {
+	for {
+		select {
+		case record := <-dns.recordInput.Items():
+			dns.handleRecord(record)
+		case candidate := <-dns.candidateInput.Items():
+			dns.handleCandidate(candidate)
+		case applied := <-dns.overrideInput.Items():
+			dns.handleAppliedOverride(applied)
+		default:
+			return
+		}
+	}
+}
+
+// closeInputs closes the input queues, keeping any spilled data on disk for the next run.
+func (dns *DNS) closeInputs() {
+	if closeErr := dns.recordInput.Close(); closeErr != nil {
+		log.WithError(closeErr).Error("unable to close DNS record input queue")
+	}
+	if closeErr := dns.candidateInput.Close(); closeErr != nil {
+		log.WithError(closeErr).Error("unable to close candidate host input queue")
+	}
+	if closeErr := dns.overrideInput.Close(); closeErr != nil {
+		log.WithError(closeErr).Error("unable to close DNS override input queue")
+	}
+}
+
+// flushCaches saves all local caches to the database, then clears them.
+func (dns *DNS) flushCaches() {
+	dns.flushRecordCache()
+	dns.flushCandidateCache()
+	dns.flushOverrideCache()
+}
+
+// flushRecordCache saves the DNS record cache to the database, records the flush in the input queue statistics, then
+// clears the cache.
+func (dns *DNS) flushRecordCache() {
+	if len(dns.recordCache) == 0 {
+		return
+	}
+
+	start := time.Now()
+	rows := make([][]any, 0, len(dns.recordCache))
+	for _, record := range dns.recordCache {
+		rows = append(rows, []any{record.Host, record.Name, record.Type, record.Value, int64(record.TTL), record.Resolver, record.RCode, record.Source, record.Timestamp})
+	}
+	_, copyErr := dns.dbConnPool.CopyFrom(context.Background(), pgx.Identifier{"data_dns"},
+		[]string{"host", "name", "record_type", "value", "ttl", "resolver", "rcode", "source", "timestamp"}, pgx.CopyFromRows(rows))
+	if copyErr != nil {
+		copyErr = fmt.Errorf("unable to copy %d DNS records into database: %w", len(rows), copyErr)
+		log.WithError(copyErr).Error("unable to save DNS records")
+	}
+	dns.recordInput.RecordFlush(len(rows), time.Since(start), copyErr)
+
+	// Clear the cache, while keeping the allocated memory
+	dns.recordCache = dns.recordCache[:0]
+}
+
+// flushCandidateCache saves the candidate host cache to the database, records the flush in the input queue
+// statistics, then clears the cache.
+func (dns *DNS) flushCandidateCache() {
+	if len(dns.candidateCache) == 0 {
+		return
+	}
+
+	start := time.Now()
+	batch := &pgx.Batch{}
+	for _, candidate := range dns.candidateCache {
+		batch.Queue(`insert into data_dns_candidates (host, source, found_in, first_seen, last_seen) values ($1, $2, $3, $4, $4)
+			on conflict on constraint data_dns_candidates_pk do update set last_seen = greatest(data_dns_candidates.last_seen, excluded.last_seen);`,
+			candidate.Host, candidate.Source, candidate.FoundIn, candidate.Timestamp)
+	}
+	batchErr := dns.dbConnPool.SendBatch(context.Background(), batch).Close()
+	if batchErr != nil {
+		batchErr = fmt.Errorf("unable to insert %d candidate hosts into database: %w", len(dns.candidateCache), batchErr)
+		log.WithError(batchErr).Error("unable to save candidate hosts")
+	}
+	dns.candidateInput.RecordFlush(len(dns.candidateCache), time.Since(start), batchErr)
+
+	// Clear the cache, while keeping the allocated memory
+	dns.candidateCache = dns.candidateCache[:0]
+}
+
+// flushOverrideCache saves the cache of requests sent to DNS override addresses to the database, records the flush in
+// the input queue statistics, then clears the cache.
+func (dns *DNS) flushOverrideCache() {
+	if len(dns.overrideCache) == 0 {
+		return
+	}
+
+	start := time.Now()
+	rows := make([][]any, 0, len(dns.overrideCache))
+	for _, applied := range dns.overrideCache {
+		rows = append(rows, []any{uuid.FromStringOrNil(applied.OverrideID), applied.Host, applied.Address, applied.Method, applied.URL, applied.Timestamp})
+	}
+	_, copyErr := dns.dbConnPool.CopyFrom(context.Background(), pgx.Identifier{"data_dns_overrides"},
+		[]string{"override_id", "host", "address", "method", "url", "timestamp"}, pgx.CopyFromRows(rows))
+	if copyErr != nil {
+		copyErr = fmt.Errorf("unable to copy %d DNS override requests into database: %w", len(rows), copyErr)
+		log.WithError(copyErr).Error("unable to save DNS override requests")
+	}
+	dns.overrideInput.RecordFlush(len(rows), time.Since(start), copyErr)
+
+	// Clear the cache, while keeping the allocated memory
+	dns.overrideCache = dns.overrideCache[:0]
+}
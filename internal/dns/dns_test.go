@@ -0,0 +1,337 @@
+package dns
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// serveStubDNS answers DNS queries on a local UDP port with a CNAME from www.example.com to web.example.net, and an
+// A record for web.example.net, returning the server's address. Each answer also holds an A record off the CNAME
+// chain, and is sent after a response with the wrong ID.
+func serveStubDNS(t *testing.T) string {
+	t.Helper()
+
+	conn, listenErr := net.ListenPacket("udp", "127.0.0.1:0")
+	if listenErr != nil {
+		t.Fatalf("unable to listen: %v", listenErr)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	go func() {
+		buffer := make([]byte, maxMessageSize)
+		for {
+			n, addr, readErr := conn.ReadFrom(buffer)
+			if readErr != nil {
+				return
+			}
+			var query dnsmessage.Message
+			if query.Unpack(buffer[:n]) != nil || len(query.Questions) != 1 {
+				continue
+			}
+			question := query.Questions[0]
+			response := dnsmessage.Message{
+				Header:    dnsmessage.Header{ID: query.ID, Response: true, RecursionAvailable: true},
+				Questions: query.Questions,
+			}
+			if question.Name.String() != "www.example.com." {
+				response.RCode = dnsmessage.RCodeNameError
+			} else {
+				target := dnsmessage.MustNewName("web.example.net.")
+				response.Answers = append(response.Answers, dnsmessage.Resource{
+					Header: dnsmessage.ResourceHeader{Name: question.Name, Type: dnsmessage.TypeCNAME, Class: dnsmessage.ClassINET, TTL: 300},
+					Body:   &dnsmessage.CNAMEResource{CNAME: target},
+				})
+				if question.Type == dnsmessage.TypeA {
+					response.Answers = append(response.Answers, dnsmessage.Resource{
+						Header: dnsmessage.ResourceHeader{Name: target, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 60},
+						Body:   &dnsmessage.AResource{A: [4]byte{192, 0, 2, 10}},
+					}, dnsmessage.Resource{
+						Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName("other.example.org."), Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 60},
+						Body:   &dnsmessage.AResource{A: [4]byte{198, 51, 100, 1}},
+					})
+				}
+			}
+			spoofed := response
+			spoofed.ID++
+			for _, message := range []dnsmessage.Message{spoofed, response} {
+				packed, packErr := message.Pack()
+				if packErr != nil {
+					continue
+				}
+				_, _ = conn.WriteTo(packed, addr)
+			}
+		}
+	}()
+
+	return conn.LocalAddr().String()
+}
+
+func TestResolverQuery(t *testing.T) {
+	server := serveStubDNS(t)
+	r := &resolver{servers: []string{server}, ndots: 1, cache: make(map[string]*cacheEntry)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ips, ttl, records, queryErr := r.query(ctx, "www.example.com")
+	if queryErr != nil {
+		t.Fatalf("query() error = %v", queryErr)
+	}
+	if len(ips) != 1 || !ips[0].Equal(net.IPv4(192, 0, 2, 10)) {
+		t.Errorf("query() addresses = %v, want [192.0.2.10]", ips)
+	}
+	if ttl != 60 {
+		t.Errorf("query() TTL = %d, want 60", ttl)
+	}
+
+	// Each query answers the CNAME, and only the A query answers an address
+	var got []string
+	for _, record := range records {
+		if record.Host != "www.example.com" || record.Resolver != server || record.RCode != "NOERROR" {
+			t.Errorf("unexpected record %+v", record)
+		}
+		got = append(got, record.Type+" "+record.Name+" "+record.Value)
+	}
+	want := []string{
+		"CNAME www.example.com web.example.net",
+		"A web.example.net 192.0.2.10",
+		"CNAME www.example.com web.example.net",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("query() records = %q, want %q", got, want)
+	}
+
+	// Names that don't exist are recorded with their response code, and no value
+	_, _, records, queryErr = r.query(ctx, "missing.example.com")
+	if queryErr == nil {
+		t.Error("query() for missing name returned no error")
+	}
+	if len(records) != 2 || records[0].RCode != "NXDOMAIN" || records[0].Value != "" {
+		t.Errorf("query() records for missing name = %+v, want two empty NXDOMAIN records", records)
+	}
+}
+
+func TestResolverDoH(t *testing.T) {
+	server := serveStubDNS(t)
+	doh := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query, _ := io.ReadAll(r.Body)
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != dohContentType {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		response, exchangeErr := exchangeWith(r.Context(), "udp", server, query)
+		if exchangeErr != nil {
+			http.Error(w, exchangeErr.Error(), http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", dohContentType)
+		_, _ = w.Write(response)
+	}))
+	defer doh.Close()
+
+	// The DNS servers are ignored when a DNS over HTTPS endpoint is set
+	r := &resolver{servers: []string{"127.0.0.1:1"}, dohURL: doh.URL, dohClient: doh.Client(), ndots: 1, cache: make(map[string]*cacheEntry)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ips, _, records, queryErr := r.query(ctx, "www.example.com")
+	if queryErr != nil {
+		t.Fatalf("query() error = %v", queryErr)
+	}
+	if len(ips) != 1 || !ips[0].Equal(net.IPv4(192, 0, 2, 10)) {
+		t.Errorf("query() addresses = %v, want [192.0.2.10]", ips)
+	}
+	if len(records) == 0 || records[0].Resolver != doh.URL {
+		t.Errorf("query() records = %+v, want records answered by %s", records, doh.URL)
+	}
+}
+
+func TestOverride(t *testing.T) {
+	exact := &Override{ID: "b", Host: "api.example.com", Address: "127.0.0.1", Enabled: true}
+	wildcard := &Override{ID: "a", Host: "*.example.com", Address: "192.0.2.1", Enabled: true}
+
+	for host, want := range map[string]bool{"api.example.com": true, "www.api.example.com": false, "example.com": false} {
+		if got := exact.matches(host); got != want {
+			t.Errorf("%s matches(%q) = %v, want %v", exact.Host, host, got, want)
+		}
+	}
+	for host, want := range map[string]bool{"api.example.com": true, "a.b.example.com": true, "example.com": false, "badexample.com": false} {
+		if got := wildcard.matches(host); got != want {
+			t.Errorf("%s matches(%q) = %v, want %v", wildcard.Host, host, got, want)
+		}
+	}
+	if !exact.moreSpecific(wildcard) || wildcard.moreSpecific(exact) {
+		t.Error("exact host override does not take precedence over wildcard override")
+	}
+
+	// Hosts with an override are connected to at its address, without being resolved
+	listener, listenErr := net.Listen("tcp", "127.0.0.1:0")
+	if listenErr != nil {
+		t.Fatalf("unable to listen: %v", listenErr)
+	}
+	defer listener.Close()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+
+	var observed []Record
+	r := &resolver{
+		servers: []string{"127.0.0.1:1"},
+		cache:   make(map[string]*cacheEntry),
+		observe: func(records []Record) { observed = append(observed, records...) },
+		override: func(host string) *Override {
+			if exact.matches(strings.ToLower(host)) {
+				return exact
+			}
+			return nil
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, dialErr := r.DialContext(ctx, "tcp", net.JoinHostPort("API.example.com", port))
+	if dialErr != nil {
+		t.Fatalf("DialContext() error = %v", dialErr)
+	}
+	defer conn.Close()
+	if overridden, ok := conn.(*overrideConn); !ok || overridden.override != exact {
+		t.Errorf("DialContext() = %T, want connection with override %s", conn, exact.Host)
+	}
+	want := []Record{{Host: "api.example.com", Name: "api.example.com", Type: "A", Value: "127.0.0.1", Resolver: "override:b"}}
+	if len(observed) == 1 {
+		observed[0].Timestamp = time.Time{}
+	}
+	if !reflect.DeepEqual(observed, want) {
+		t.Errorf("observed records = %+v, want %+v", observed, want)
+	}
+
+	// Through an upstream proxy, hosts with an override are sent to it as the override's address, and other hosts
+	// are left for it to resolve
+	var dialed []string
+	proxyDial := r.proxyDialContext(dialerFunc(func(ctx context.Context, network, address string) (net.Conn, error) {
+		dialed = append(dialed, address)
+		return net.Dial(network, listener.Addr().String())
+	}))
+	for _, host := range []string{"api.example.com", "www.example.com"} {
+		proxyConn, proxyDialErr := proxyDial(ctx, "tcp", net.JoinHostPort(host, port))
+		if proxyDialErr != nil {
+			t.Fatalf("proxyDialContext() error = %v", proxyDialErr)
+		}
+		proxyConn.Close()
+		if _, ok := proxyConn.(*overrideConn); ok != (host == "api.example.com") {
+			t.Errorf("proxyDialContext(%q) = %T", host, proxyConn)
+		}
+	}
+	if wantDialed := []string{net.JoinHostPort("127.0.0.1", port), net.JoinHostPort("www.example.com", port)}; !reflect.DeepEqual(dialed, wantDialed) {
+		t.Errorf("proxy dialed %q, want %q", dialed, wantDialed)
+	}
+}
+
+// dialerFunc is a proxy dialer that connects with the function itself.
+type dialerFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+func (f dialerFunc) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return f(ctx, network, address)
+}
+
+func TestParsePassive(t *testing.T) {
+	input := strings.Join([]string{
+		`# exported from passive DNS`,
+		`{"rrname": "API.Example.com.", "rrtype": "A", "rdata": ["192.0.2.1", "192.0.2.2"], "ttl": 300, "time_last": 1700000000}`,
+		`{"rrname": "mail.example.com", "rrtype": "MX", "rdata": "10 mx.example.com"}`,
+		`cdn.example.com. 3600 IN CNAME edge.example.net.`,
+		`ipv6.example.com AAAA 2001:db8::1`,
+		`not a record`,
+	}, "\n")
+	now := time.Now()
+
+	records, parseErr := parsePassive(strings.NewReader(input), "export.jsonl", now)
+	if parseErr != nil {
+		t.Fatalf("parsePassive() error = %v", parseErr)
+	}
+
+	want := []Record{
+		{Host: "api.example.com", Name: "api.example.com", Type: "A", Value: "192.0.2.1", TTL: 300, Resolver: "export.jsonl", Timestamp: time.Unix(1700000000, 0)},
+		{Host: "api.example.com", Name: "api.example.com", Type: "A", Value: "192.0.2.2", TTL: 300, Resolver: "export.jsonl", Timestamp: time.Unix(1700000000, 0)},
+		{Host: "cdn.example.com", Name: "cdn.example.com", Type: "CNAME", Value: "edge.example.net", TTL: 3600, Resolver: "export.jsonl", Timestamp: now},
+		{Host: "ipv6.example.com", Name: "ipv6.example.com", Type: "AAAA", Value: "2001:db8::1", Resolver: "export.jsonl", Timestamp: now},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("parsePassive() = %+v, want %+v", records, want)
+	}
+}
+
+func TestCandidateHosts(t *testing.T) {
+	policy := "default-src 'self'; script-src 'nonce-abc' https://cdn.example.com *.static.example.com; connect-src wss://ws.example.com:8443/socket https:; report-uri /csp"
+	want := []string{"cdn.example.com", "static.example.com", "ws.example.com"}
+
+	var got []string
+	for _, host := range cspHosts(policy) {
+		if host = normalizeHost(host); host != "" {
+			got = append(got, host)
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("CSP hosts = %q, want %q", got, want)
+	}
+
+	for _, host := range []string{"localhost", "192.0.2.1", "-bad.example.com", "bad..example.com", "bad host.example.com"} {
+		if normalized := normalizeHost(host); normalized != "" {
+			t.Errorf("normalizeHost(%q) = %q, want empty", host, normalized)
+		}
+	}
+}
+
+func TestListenerAnswer(t *testing.T) {
+	server := serveStubDNS(t)
+	var observed []Record
+	l := &listener{
+		resolver: &resolver{servers: []string{server}, ndots: 1, cache: make(map[string]*cacheEntry)},
+		observe:  func(records []Record) { observed = append(observed, records...) },
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	answer := func(queryType dnsmessage.Type) *dnsmessage.Message {
+		query := dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: 7, RecursionDesired: true},
+			Questions: []dnsmessage.Question{{Name: dnsmessage.MustNewName("www.example.com."), Type: queryType, Class: dnsmessage.ClassINET}},
+		}
+		packed, packErr := query.Pack()
+		if packErr != nil {
+			t.Fatalf("unable to pack query: %v", packErr)
+		}
+		var response dnsmessage.Message
+		if unpackErr := response.Unpack(l.answer(ctx, "udp", packed)); unpackErr != nil {
+			t.Fatalf("unable to unpack answer: %v", unpackErr)
+		}
+		return &response
+	}
+
+	// A queries are forwarded as they are answered, and only the answers on the CNAME chain recorded
+	if response := answer(dnsmessage.TypeA); response.ID != 7 || response.RCode != dnsmessage.RCodeSuccess || len(response.Answers) != 3 {
+		t.Errorf("answer() for A query = %+v, want the forwarded answer", response)
+	}
+	if len(observed) != 2 {
+		t.Errorf("observed %d records, want 2", len(observed))
+	}
+
+	// Other query types are refused without being forwarded
+	observed = nil
+	if response := answer(dnsmessage.TypeTXT); response.ID != 7 || response.RCode != dnsmessage.RCodeRefused || len(response.Answers) != 0 {
+		t.Errorf("answer() for TXT query = %+v, want refused", response)
+	}
+	if len(observed) != 0 {
+		t.Errorf("observed %d records for refused query, want none", len(observed))
+	}
+}
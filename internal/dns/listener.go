@@ -0,0 +1,188 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// maxListenerQueries is the maximum number of queries the listener forwards at once. Queries over UDP beyond this are
+// dropped, to be retried by their clients, and queries over TCP wait.
+const maxListenerQueries = 256
+
+// listenerQueryTypes holds the query types the listener forwards. Other queries are refused, so that the listener
+// can't be used to amplify large answers, such as for ANY or TXT queries.
+var listenerQueryTypes = map[dnsmessage.Type]bool{
+	dnsmessage.TypeA:     true,
+	dnsmessage.TypeAAAA:  true,
+	dnsmessage.TypeCNAME: true,
+}
+
+// listener is a DNS server for clients such as browsers and devices under test, which forwards their A, AAAA and
+// CNAME queries to the resolver's DNS servers or DNS over HTTPS endpoint, and records the answers as passive DNS data.
+type listener struct {
+	udpConn     net.PacketConn
+	tcpListener net.Listener
+
+	resolver *resolver
+
+	// queries holds a value for each query being forwarded, limiting them to maxListenerQueries.
+	queries chan struct{}
+
+	// observe is called with the records of every answer sent to a client.
+	observe func([]Record)
+}
+
+// newListener starts listening for DNS queries over UDP and TCP on the given address.
+func newListener(addr string, resolver *resolver, observe func([]Record)) (*listener, error) {
+	udpConn, udpErr := net.ListenPacket("udp", addr)
+	if udpErr != nil {
+		return nil, fmt.Errorf("unable to listen on UDP address %s: %w", addr, udpErr)
+	}
+	// Listen on the same port over TCP, which matters when the UDP port was chosen by the system
+	tcpListener, tcpErr := net.Listen("tcp", udpConn.LocalAddr().String())
+	if tcpErr != nil {
+		_ = udpConn.Close()
+		return nil, fmt.Errorf("unable to listen on TCP address %s: %w", addr, tcpErr)
+	}
+
+	// Anyone who can reach the listener can use it to resolve names, so warn when it isn't only reachable locally
+	if udpAddr, ok := udpConn.LocalAddr().(*net.UDPAddr); ok && !udpAddr.IP.IsLoopback() {
+		log.WithField("address", udpAddr.String()).Warn("DNS listener is reachable from other hosts; only expose it to trusted networks")
+	}
+
+	return &listener{udpConn: udpConn, tcpListener: tcpListener, resolver: resolver, queries: make(chan struct{}, maxListenerQueries), observe: observe}, nil
+}
+
+// serve answers queries until the given context is done.
+func (l *listener) serve(ctx context.Context) error {
+	go func() {
+		<-ctx.Done()
+		_ = l.udpConn.Close()
+		_ = l.tcpListener.Close()
+	}()
+
+	go func() {
+		if tcpErr := l.serveTCP(ctx); tcpErr != nil {
+			log.WithError(tcpErr).Error("problem with DNS listener over TCP")
+		}
+	}()
+
+	buffer := make([]byte, maxMessageSize)
+	for {
+		n, clientAddr, readErr := l.udpConn.ReadFrom(buffer)
+		if readErr != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if errors.Is(readErr, net.ErrClosed) {
+				return readErr
+			}
+			continue
+		}
+
+		// Drop queries beyond the limit, which their clients will retry
+		select {
+		case l.queries <- struct{}{}:
+		default:
+			continue
+		}
+
+		query := append([]byte(nil), buffer[:n]...)
+		go func() {
+			defer func() { <-l.queries }()
+			if response := l.answer(ctx, "udp", query); response != nil {
+				_, _ = l.udpConn.WriteTo(response, clientAddr)
+			}
+		}()
+	}
+}
+
+// serveTCP answers queries sent over TCP until the given context is done.
+func (l *listener) serveTCP(ctx context.Context) error {
+	for {
+		conn, acceptErr := l.tcpListener.Accept()
+		if acceptErr != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return acceptErr
+		}
+
+		go func() {
+			defer conn.Close()
+			for {
+				_ = conn.SetDeadline(time.Now().Add(30 * time.Second))
+				query, readErr := readTCPMessage(conn)
+				if readErr != nil {
+					return
+				}
+				select {
+				case l.queries <- struct{}{}:
+				case <-ctx.Done():
+					return
+				}
+				response := l.answer(ctx, "tcp", query)
+				<-l.queries
+				if response == nil || writeTCPMessage(conn, response) != nil {
+					return
+				}
+			}
+		}()
+	}
+}
+
+// answer forwards the given packed query to the resolver's upstreams, using the given network for DNS servers, and
+// returns the packed response. Queries that can't be parsed get no answer, those for other types than A, AAAA and
+// CNAME records are refused, and those that can't be forwarded get a server failure.
+func (l *listener) answer(ctx context.Context, network string, query []byte) []byte {
+	var parser dnsmessage.Parser
+	header, parseErr := parser.Start(query)
+	if parseErr != nil || header.Response {
+		return nil
+	}
+	questions, questionsErr := parser.AllQuestions()
+	if questionsErr != nil || len(questions) != 1 {
+		return nil
+	}
+	if header.OpCode != 0 || !listenerQueryTypes[questions[0].Type] {
+		return reply(header, questions, dnsmessage.RCodeRefused)
+	}
+
+	var forwardErr error
+	for _, server := range l.resolver.upstreams() {
+		var response []byte
+		if response, forwardErr = l.resolver.exchangeServer(ctx, network, server, query); forwardErr != nil {
+			continue
+		}
+
+		var message dnsmessage.Message
+		if unpackErr := message.Unpack(response); unpackErr == nil && !message.Truncated {
+			l.observe(messageRecords(&message, server, time.Now()))
+		}
+		return response
+	}
+	log.WithError(forwardErr).Debug("unable to forward DNS query from listener")
+
+	return reply(header, questions, dnsmessage.RCodeServerFailure)
+}
+
+// reply returns a packed response to the query with the given header and questions, with no answers and the given
+// response code.
+func reply(header dnsmessage.Header, questions []dnsmessage.Question, rcode dnsmessage.RCode) []byte {
+	response := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: header.ID, Response: true, OpCode: header.OpCode, RecursionDesired: header.RecursionDesired, RecursionAvailable: true, RCode: rcode},
+		Questions: questions,
+	}
+	packed, packErr := response.Pack()
+	if packErr != nil {
+		return nil
+	}
+
+	return packed
+}
@@ -0,0 +1,322 @@
+package dns
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/TheHackerDev/cartograph/internal/config"
+)
+
+// errOverrideNotFound is returned when no DNS override exists with a given ID.
+var errOverrideNotFound = errors.New("no DNS override found")
+
+// Override points a host, or every subdomain of a domain, at an address instead of resolving it, such as to test a
+// staging server under its production host name. It only applies to the hosts of its target rule set.
+type Override struct {
+	// ID is the UUID of the override.
+	ID string `json:"id"`
+
+	// Target is the ID of the target rule set the override applies to.
+	Target string `json:"target"`
+
+	// Host is the host name overridden, such as "api.example.com", or a wildcard such as "*.example.com", which
+	// matches every subdomain of "example.com" but not "example.com" itself.
+	Host string `json:"host"`
+
+	// Address is the IP address connected to instead.
+	Address string `json:"address"`
+
+	// Enabled is false if the override is saved but not applied.
+	Enabled bool `json:"enabled"`
+}
+
+// AppliedOverride is a request sent to the address of a DNS override, as saved in the data_dns_overrides table.
+type AppliedOverride struct {
+	// OverrideID is the ID of the override applied.
+	OverrideID string `json:"override_id"`
+
+	// Host is the host the request was sent to.
+	Host string `json:"host"`
+
+	// Address is the IP address the request was sent to instead of the host's own.
+	Address string `json:"address"`
+
+	// Method is the HTTP request method.
+	Method string `json:"method"`
+
+	// URL is the request URL.
+	URL string `json:"url"`
+
+	// Timestamp is the time the request was sent.
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// overrideConn is a connection to the address of a DNS override, which keeps the override for logging the requests
+// sent on it.
+type overrideConn struct {
+	net.Conn
+
+	override *Override
+}
+
+// validate checks the override's fields, and normalizes them for saving.
+func (o *Override) validate(cfg *config.Config) error {
+	o.Target = strings.ToLower(strings.TrimSpace(o.Target))
+	if rule, ok := cfg.GetTargetsAndIgnoredAll()[o.Target]; !ok || rule.IsIgnore {
+		return fmt.Errorf("no target rule set found with ID %q", o.Target)
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(o.Host)), ".")
+	domain, wildcard := strings.CutPrefix(host, "*.")
+	if normalizeHost(domain) != domain || domain == "" {
+		return fmt.Errorf("invalid host %q; must be a host name, or a wildcard such as \"*.example.com\"", o.Host)
+	}
+	if wildcard {
+		o.Host = "*." + domain
+	} else {
+		o.Host = domain
+	}
+
+	ip := net.ParseIP(strings.TrimSpace(o.Address))
+	if ip == nil {
+		return fmt.Errorf("invalid address %q; must be an IP address", o.Address)
+	}
+	o.Address = ip.String()
+
+	return nil
+}
+
+// matches returns true if the given lower case host name matches the override's host.
+func (o *Override) matches(host string) bool {
+	if domain, wildcard := strings.CutPrefix(o.Host, "*."); wildcard {
+		return strings.HasSuffix(host, "."+domain)
+	}
+
+	return host == o.Host
+}
+
+// moreSpecific returns true if the override takes precedence over the other override: exact host names over
+// wildcards, then longer wildcards, then the lowest ID.
+func (o *Override) moreSpecific(other *Override) bool {
+	oWildcard, otherWildcard := strings.HasPrefix(o.Host, "*."), strings.HasPrefix(other.Host, "*.")
+	if oWildcard != otherWildcard {
+		return !oWildcard
+	}
+	if len(o.Host) != len(other.Host) {
+		return len(o.Host) > len(other.Host)
+	}
+
+	return o.ID < other.ID
+}
+
+// record returns the DNS record of the override being applied to the given host.
+func (o *Override) record(host string, timestamp time.Time) Record {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	return Record{
+		Host:      host,
+		Name:      host,
+		Type:      recordType(net.ParseIP(o.Address)),
+		Value:     o.Address,
+		Resolver:  "override:" + o.ID,
+		Timestamp: timestamp,
+	}
+}
+
+// sortOverrides sorts the given overrides by host, then ID.
+func sortOverrides(overrides []*Override) {
+	sort.Slice(overrides, func(i, j int) bool {
+		if overrides[i].Host != overrides[j].Host {
+			return overrides[i].Host < overrides[j].Host
+		}
+		return overrides[i].ID < overrides[j].ID
+	})
+}
+
+// sqlSelectOverrides selects every column of the dns_overrides table, in the order scanned by scanOverride.
+const sqlSelectOverrides string = `select id::text, target::text, host, address, enabled from dns_overrides`
+
+// scanOverride scans a single row selected with sqlSelectOverrides.
+func scanOverride(row pgx.Row) (*Override, error) {
+	var override Override
+	if scanErr := row.Scan(&override.ID, &override.Target, &override.Host, &override.Address, &override.Enabled); scanErr != nil {
+		return nil, scanErr
+	}
+
+	return &override, nil
+}
+
+// loadOverrides returns every DNS override saved in the database.
+func (dns *DNS) loadOverrides(ctx context.Context) (map[string]*Override, error) {
+	rows, queryErr := dns.dbConnPool.Query(ctx, sqlSelectOverrides+`;`)
+	if queryErr != nil {
+		return nil, fmt.Errorf("unable to get DNS overrides from database: %w", queryErr)
+	}
+
+	// Ensure the rows are closed; it's safe to close rows multiple times.
+	defer rows.Close()
+
+	overrides := make(map[string]*Override)
+	for rows.Next() {
+		override, scanErr := scanOverride(rows)
+		if scanErr != nil {
+			return nil, fmt.Errorf("unable to scan DNS override from database: %w", scanErr)
+		}
+		overrides[override.ID] = override
+	}
+
+	// One final check for errors encountered by rows.Next or rows.Scan
+	if rowsErr := rows.Err(); rowsErr != nil {
+		return nil, fmt.Errorf("unexpected error returned from database rows: %w", rowsErr)
+	}
+
+	return overrides, nil
+}
+
+// getOverrides returns all DNS overrides, sorted by host.
+func (dns *DNS) getOverrides() []*Override {
+	dns.mu.RLock()
+	defer dns.mu.RUnlock()
+
+	overrides := make([]*Override, 0, len(dns.overrides))
+	for _, override := range dns.overrides {
+		overrides = append(overrides, override)
+	}
+	sortOverrides(overrides)
+
+	return overrides
+}
+
+// getOverride returns the DNS override with the given ID, or nil if it does not exist.
+func (dns *DNS) getOverride(id string) *Override {
+	dns.mu.RLock()
+	defer dns.mu.RUnlock()
+
+	return dns.overrides[strings.ToLower(id)]
+}
+
+// saveOverride validates the given override, then inserts it into the database if it has no ID, or replaces the
+// existing override with its ID. It returns the saved override.
+func (dns *DNS) saveOverride(override *Override) (*Override, error) {
+	if validateErr := override.validate(dns.cfg); validateErr != nil {
+		return nil, validateErr
+	}
+
+	ctx := context.Background()
+	var saveErr error
+	if override.ID == "" {
+		sqlInsertOverride := `insert into dns_overrides (target, host, address, enabled) values ($1::uuid, $2, $3, $4) returning id::text;`
+		saveErr = dns.dbConnPool.QueryRow(ctx, sqlInsertOverride, override.Target, override.Host, override.Address, override.Enabled).Scan(&override.ID)
+	} else {
+		sqlUpdateOverride := `update dns_overrides set target = $2::uuid, host = $3, address = $4, enabled = $5 where id = $1::uuid returning id::text;`
+		saveErr = dns.dbConnPool.QueryRow(ctx, sqlUpdateOverride, override.ID, override.Target, override.Host, override.Address, override.Enabled).Scan(&override.ID)
+	}
+	if errors.Is(saveErr, pgx.ErrNoRows) {
+		return nil, errOverrideNotFound
+	} else if saveErr != nil {
+		return nil, fmt.Errorf("unable to save DNS override to database: %w", saveErr)
+	}
+
+	dns.mu.Lock()
+	dns.overrides[override.ID] = override
+	dns.mu.Unlock()
+
+	return override, nil
+}
+
+// removeOverride removes the DNS override with the given ID.
+func (dns *DNS) removeOverride(id string) error {
+	result, deleteErr := dns.dbConnPool.Exec(context.Background(), `delete from dns_overrides where id = $1::uuid;`, id)
+	if deleteErr != nil {
+		return fmt.Errorf("unable to delete DNS override from database: %w", deleteErr)
+	}
+	if result.RowsAffected() == 0 {
+		return errOverrideNotFound
+	}
+
+	dns.mu.Lock()
+	delete(dns.overrides, strings.ToLower(id))
+	dns.mu.Unlock()
+
+	return nil
+}
+
+// matchOverride returns the enabled DNS override for the given host that takes precedence, among those whose target
+// rule set includes the host, or nil if there is none.
+func (dns *DNS) matchOverride(host string) *Override {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+
+	dns.mu.RLock()
+	defer dns.mu.RUnlock()
+
+	var match *Override
+	for _, override := range dns.overrides {
+		if !override.Enabled || !override.matches(host) || (match != nil && !override.moreSpecific(match)) {
+			continue
+		}
+		if dns.cfg.MatchesTargetRules([]string{override.Target}, "", host) {
+			match = override
+		}
+	}
+
+	return match
+}
+
+// LogOverride sends the request with the given method and URL to be logged as an applied DNS override, if the given
+// connection it was sent on was connected to the address of an override.
+// It does not block; if the input queue is full, the request is handled according to the queue policy.
+func (dns *DNS) LogOverride(conn net.Conn, method string, u *url.URL) {
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		conn = tlsConn.NetConn()
+	}
+	overridden, ok := conn.(*overrideConn)
+	if !ok {
+		return
+	}
+
+	dns.overrideInput.Enqueue(&AppliedOverride{
+		OverrideID: overridden.override.ID,
+		Host:       strings.ToLower(u.Hostname()),
+		Address:    overridden.override.Address,
+		Method:     method,
+		URL:        u.String(),
+		Timestamp:  time.Now(),
+	})
+}
+
+// getOverrideRequests returns the most recent requests sent to the address of the DNS override with the given ID, up
+// to the given limit.
+func (dns *DNS) getOverrideRequests(ctx context.Context, id string, limit int) ([]AppliedOverride, error) {
+	sqlSelectRequests := `select override_id::text, host, address, method, url, timestamp
+		from data_dns_overrides
+		where override_id = $1::uuid
+		order by timestamp desc
+		limit $2;`
+	rows, queryErr := dns.dbConnPool.Query(ctx, sqlSelectRequests, id, limit)
+	if queryErr != nil {
+		return nil, fmt.Errorf("unable to get DNS override requests from database: %w", queryErr)
+	}
+	defer rows.Close()
+
+	requests := make([]AppliedOverride, 0)
+	for rows.Next() {
+		var request AppliedOverride
+		if scanErr := rows.Scan(&request.OverrideID, &request.Host, &request.Address, &request.Method, &request.URL, &request.Timestamp); scanErr != nil {
+			return nil, fmt.Errorf("unable to scan DNS override request from database: %w", scanErr)
+		}
+		requests = append(requests, request)
+	}
+	if rowsErr := rows.Err(); rowsErr != nil {
+		return nil, fmt.Errorf("unexpected error returned from database rows: %w", rowsErr)
+	}
+
+	return requests, nil
+}
@@ -0,0 +1,175 @@
+package dns
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// passiveRecordTypes holds the record types read from passive DNS input.
+var passiveRecordTypes = map[string]bool{
+	"A":     true,
+	"AAAA":  true,
+	"CNAME": true,
+}
+
+// cofRecord is a passive DNS record in the Passive DNS Common Output Format, as exported by most passive DNS
+// services.
+type cofRecord struct {
+	RRName    string          `json:"rrname"`
+	RRType    string          `json:"rrtype"`
+	RData     json.RawMessage `json:"rdata"`
+	TTL       uint32          `json:"ttl"`
+	TimeFirst int64           `json:"time_first"`
+	TimeLast  int64           `json:"time_last"`
+}
+
+// importPassiveFile reads the passive DNS records in the given file, and sends them to be logged to the database,
+// returning the number of records read.
+func (dns *DNS) importPassiveFile(path string) (int, error) {
+	file, openErr := os.Open(path)
+	if openErr != nil {
+		return 0, fmt.Errorf("unable to open passive DNS file: %w", openErr)
+	}
+	defer file.Close()
+
+	records, parseErr := parsePassive(file, path, time.Now())
+	if parseErr != nil {
+		return 0, parseErr
+	}
+	dns.logRecords(records, SourcePassive)
+
+	return len(records), nil
+}
+
+// parsePassive reads the A, AAAA, and CNAME records in the given passive DNS input, read from the given resolver or
+// file. Each line holds either a JSON object in the Passive DNS Common Output Format, or a record in zone file
+// format, as output by most DNS tools: "name [ttl] [class] type value". Records without a time are given the
+// provided timestamp, and lines that can't be parsed are skipped.
+func parsePassive(r io.Reader, resolver string, timestamp time.Time) ([]Record, error) {
+	records := make([]Record, 0)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "{") {
+			records = append(records, parseCOFLine(line, resolver, timestamp)...)
+			continue
+		}
+		if record, ok := parseZoneLine(line, resolver, timestamp); ok {
+			records = append(records, record)
+		}
+	}
+	if scanErr := scanner.Err(); scanErr != nil {
+		return nil, fmt.Errorf("unable to read passive DNS input: %w", scanErr)
+	}
+
+	return records, nil
+}
+
+// parseCOFLine returns the records in the given Passive DNS Common Output Format line.
+func parseCOFLine(line, resolver string, timestamp time.Time) []Record {
+	var cof cofRecord
+	if unmarshalErr := json.Unmarshal([]byte(line), &cof); unmarshalErr != nil {
+		return nil
+	}
+	recordType := strings.ToUpper(cof.RRType)
+	name := normalizeName(cof.RRName)
+	if !passiveRecordTypes[recordType] || name == "" {
+		return nil
+	}
+	if cof.TimeLast > 0 {
+		timestamp = time.Unix(cof.TimeLast, 0)
+	} else if cof.TimeFirst > 0 {
+		timestamp = time.Unix(cof.TimeFirst, 0)
+	}
+
+	// The record data is either a single value or a list of them
+	var values []string
+	if unmarshalErr := json.Unmarshal(cof.RData, &values); unmarshalErr != nil {
+		var value string
+		if unmarshalErr = json.Unmarshal(cof.RData, &value); unmarshalErr != nil {
+			return nil
+		}
+		values = []string{value}
+	}
+
+	records := make([]Record, 0, len(values))
+	for _, value := range values {
+		if recordType == "CNAME" {
+			value = normalizeName(value)
+		}
+		if !validRecordValue(recordType, value) {
+			continue
+		}
+		records = append(records, Record{Host: name, Name: name, Type: recordType, Value: value, TTL: cof.TTL, Resolver: resolver, Timestamp: timestamp})
+	}
+
+	return records
+}
+
+// parseZoneLine returns the record in the given zone file format line, which may omit the TTL and class.
+func parseZoneLine(line, resolver string, timestamp time.Time) (Record, bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 3 {
+		return Record{}, false
+	}
+	record := Record{Host: normalizeName(fields[0]), Resolver: resolver, Timestamp: timestamp}
+	record.Name = record.Host
+
+	// Skip the optional TTL and class, in either order
+	rest := fields[1:]
+	for len(rest) > 2 {
+		if ttl, atoiErr := strconv.ParseUint(rest[0], 10, 32); atoiErr == nil {
+			record.TTL = uint32(ttl)
+		} else if !strings.EqualFold(rest[0], "IN") {
+			break
+		}
+		rest = rest[1:]
+	}
+	if len(rest) != 2 {
+		return Record{}, false
+	}
+	record.Type = strings.ToUpper(rest[0])
+	record.Value = rest[1]
+	if record.Type == "CNAME" {
+		record.Value = normalizeName(record.Value)
+	}
+	if !passiveRecordTypes[record.Type] || record.Host == "" || !validRecordValue(record.Type, record.Value) {
+		return Record{}, false
+	}
+
+	return record, true
+}
+
+// validRecordValue returns true if the given value is valid for the given record type: an IPv4 address for A
+// records, an IPv6 address for AAAA records, or a host name for CNAME records.
+func validRecordValue(recordType, value string) bool {
+	switch recordType {
+	case "A":
+		ip := net.ParseIP(value)
+		return ip != nil && ip.To4() != nil
+	case "AAAA":
+		ip := net.ParseIP(value)
+		return ip != nil && ip.To4() == nil
+	case "CNAME":
+		return normalizeHost(value) != ""
+	default:
+		return false
+	}
+}
+
+// normalizeName returns the given DNS name in lower case, without its trailing dot.
+func normalizeName(name string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+}
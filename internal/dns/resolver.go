@@ -0,0 +1,702 @@
+package dns
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+	netProxy "golang.org/x/net/proxy"
+)
+
+const (
+	// hostsFile is the hosts file checked before any DNS server is queried.
+	hostsFile = "/etc/hosts"
+
+	// resolvConfFile is the resolver configuration file the DNS servers and search domains are read from.
+	resolvConfFile = "/etc/resolv.conf"
+
+	// queryTimeout is the maximum time to wait for a DNS server to answer a single query.
+	queryTimeout = 5 * time.Second
+
+	// maxCacheTTL is the longest time a resolution is cached for, whatever its TTL.
+	maxCacheTTL = 5 * time.Minute
+
+	// negativeCacheTTL is how long failed resolutions are cached for, so that the DNS servers aren't queried for
+	// every request to a host that doesn't resolve.
+	negativeCacheTTL = 30 * time.Second
+
+	// maxCacheEntries is the number of hosts cached. The cache is cleared once it is full.
+	maxCacheEntries = 10000
+
+	// maxMessageSize is the size of the largest DNS message read, in bytes.
+	maxMessageSize = 65535
+
+	// dohContentType is the media type of DNS messages sent to and received from DNS over HTTPS endpoints.
+	dohContentType = "application/dns-message"
+)
+
+// errNoAnswer is returned when a host has no A or AAAA records.
+var errNoAnswer = errors.New("no addresses found")
+
+// resolver is a stub DNS resolver, which records the records of every resolution it performs, including their TTLs
+// and the server that answered, none of which the standard library resolver exposes.
+// Hosts in the hosts file are resolved from it, as the standard library resolver would.
+type resolver struct {
+	// mu protects hosts, hostsModTime, and cache.
+	mu sync.Mutex
+
+	// servers are the addresses of the DNS servers queried, in order.
+	servers []string
+
+	// dohURL is the DNS over HTTPS endpoint queried instead of the DNS servers, if it isn't empty.
+	dohURL    string
+	dohClient *http.Client
+
+	// search holds the search domains tried for hosts with fewer dots than ndots.
+	search []string
+	ndots  int
+
+	// hosts holds the addresses of each host in the hosts file, as of hostsModTime.
+	hosts        map[string][]net.IP
+	hostsModTime time.Time
+
+	// cache holds the addresses of recently resolved hosts.
+	cache map[string]*cacheEntry
+
+	// observe is called with the records of every resolution performed.
+	observe func([]Record)
+
+	// override returns the DNS override for the given host, or nil if it has none. Hosts with an override are
+	// connected to at its address, without being resolved.
+	override func(host string) *Override
+}
+
+// cacheEntry is a cached resolution.
+type cacheEntry struct {
+	ips     []net.IP
+	err     error
+	expires time.Time
+}
+
+// newResolver returns a new resolver using the search domains in the resolver configuration file, which calls the
+// given function with the records of every resolution it performs. Hosts are resolved with the given DNS over HTTPS
+// endpoint if it isn't empty, or else the given DNS servers, or the DNS servers in the resolver configuration file if
+// there are none.
+func newResolver(servers []string, dohURL string, observe func([]Record)) *resolver {
+	r := &resolver{
+		ndots:   1,
+		cache:   make(map[string]*cacheEntry),
+		observe: observe,
+	}
+	r.readResolvConf(resolvConfFile)
+	if len(servers) > 0 {
+		r.servers = servers
+	} else if len(r.servers) == 0 {
+		// The same default as the standard library resolver
+		r.servers = []string{"127.0.0.1:53", "[::1]:53"}
+	}
+	if dohURL != "" {
+		r.dohURL = dohURL
+		r.dohClient = &http.Client{Timeout: queryTimeout}
+	}
+
+	return r
+}
+
+// readResolvConf reads the DNS servers, search domains, and ndots option from the given resolver configuration file.
+// A missing or unreadable file leaves the defaults in place.
+func (r *resolver) readResolvConf(path string) {
+	file, openErr := os.Open(path)
+	if openErr != nil {
+		return
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], ";") {
+			continue
+		}
+		switch fields[0] {
+		case "nameserver":
+			if ip := net.ParseIP(strings.SplitN(fields[1], "%", 2)[0]); ip != nil {
+				r.servers = append(r.servers, net.JoinHostPort(fields[1], "53"))
+			}
+		case "domain", "search":
+			r.search = r.search[:0]
+			for _, domain := range fields[1:] {
+				r.search = append(r.search, strings.TrimSuffix(strings.ToLower(domain), "."))
+			}
+		case "options":
+			for _, option := range fields[1:] {
+				if value, ok := strings.CutPrefix(option, "ndots:"); ok {
+					if ndots, atoiErr := strconv.Atoi(value); atoiErr == nil && ndots >= 0 {
+						r.ndots = min(ndots, 15)
+					}
+				}
+			}
+		}
+	}
+}
+
+// DialContext connects to the given address, resolving its host with the resolver. The addresses of a host are tried
+// in turn, IPv4 addresses first, until one connects. Connections to a host with an override are returned as an
+// overrideConn.
+func (r *resolver) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, splitErr := net.SplitHostPort(address)
+	if splitErr != nil {
+		return nil, splitErr
+	}
+
+	// Connect to the address of the host's override instead of resolving it, if it has one
+	var override *Override
+	if r.override != nil {
+		override = r.override(host)
+	}
+	var ips []net.IP
+	if override != nil {
+		ips = []net.IP{net.ParseIP(override.Address)}
+		r.observe([]Record{override.record(host, time.Now())})
+	} else {
+		var lookupErr error
+		if ips, lookupErr = r.lookup(ctx, host); lookupErr != nil {
+			return nil, &net.OpError{Op: "dial", Net: network, Err: &net.DNSError{Err: lookupErr.Error(), Name: host, IsNotFound: errors.Is(lookupErr, errNoAnswer)}}
+		}
+	}
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	var dialErr error
+	for _, ip := range ips {
+		var conn net.Conn
+		if conn, dialErr = dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port)); dialErr == nil {
+			if override != nil {
+				return &overrideConn{Conn: conn, override: override}, nil
+			}
+			return conn, nil
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	return nil, dialErr
+}
+
+// proxyDialContext returns a function connecting to addresses through the given proxy dialer, such as a SOCKS5 proxy,
+// which resolves their hosts itself. Hosts with an override are sent to the proxy as the override's address instead,
+// and their connections returned as an overrideConn, as with DialContext.
+func (r *resolver) proxyDialContext(dialer netProxy.ContextDialer) func(ctx context.Context, network, address string) (net.Conn, error) {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, port, splitErr := net.SplitHostPort(address)
+		if splitErr != nil {
+			return nil, splitErr
+		}
+
+		var override *Override
+		if r.override != nil {
+			override = r.override(host)
+		}
+		if override == nil {
+			return dialer.DialContext(ctx, network, address)
+		}
+
+		r.observe([]Record{override.record(host, time.Now())})
+		conn, dialErr := dialer.DialContext(ctx, network, net.JoinHostPort(override.Address, port))
+		if dialErr != nil {
+			return nil, dialErr
+		}
+
+		return &overrideConn{Conn: conn, override: override}, nil
+	}
+}
+
+// lookup returns the addresses of the given host, IPv4 addresses first, from the hosts file, the cache, or the DNS
+// servers.
+func (r *resolver) lookup(ctx context.Context, host string) ([]net.IP, error) {
+	if ip := net.ParseIP(strings.SplitN(host, "%", 2)[0]); ip != nil {
+		return []net.IP{ip}, nil
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+
+	r.mu.Lock()
+	if entry, ok := r.cache[host]; ok && time.Now().Before(entry.expires) {
+		r.mu.Unlock()
+		return entry.ips, entry.err
+	}
+	r.mu.Unlock()
+
+	if ips := r.lookupHostsFile(host); len(ips) > 0 {
+		now := time.Now()
+		records := make([]Record, 0, len(ips))
+		for _, ip := range ips {
+			records = append(records, Record{Host: host, Name: host, Type: recordType(ip), Value: ip.String(), Resolver: hostsFile, Timestamp: now})
+		}
+		r.observe(records)
+		r.cacheResult(host, ips, nil, maxCacheTTL)
+		return ips, nil
+	}
+
+	var ips []net.IP
+	var ttl uint32
+	var lookupErr error
+	for _, name := range r.searchNames(host) {
+		var records []Record
+		ips, ttl, records, lookupErr = r.query(ctx, name)
+		if len(records) > 0 {
+			for i := range records {
+				records[i].Host = host
+			}
+			r.observe(records)
+		}
+		if lookupErr == nil {
+			break
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+	if lookupErr != nil {
+		r.cacheResult(host, nil, lookupErr, negativeCacheTTL)
+		return nil, lookupErr
+	}
+	r.cacheResult(host, ips, nil, time.Duration(ttl)*time.Second)
+
+	return ips, nil
+}
+
+// cacheResult caches the result of resolving the given host for the given duration, up to the maximum.
+func (r *resolver) cacheResult(host string, ips []net.IP, err error, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.cache) >= maxCacheEntries {
+		r.cache = make(map[string]*cacheEntry)
+	}
+	r.cache[host] = &cacheEntry{ips: ips, err: err, expires: time.Now().Add(min(ttl, maxCacheTTL))}
+}
+
+// lookupHostsFile returns the addresses of the given host in the hosts file, reading it again if it has changed.
+func (r *resolver) lookupHostsFile(host string) []net.IP {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if info, statErr := os.Stat(hostsFile); statErr == nil && !info.ModTime().Equal(r.hostsModTime) {
+		r.hostsModTime = info.ModTime()
+		r.hosts = readHostsFile(hostsFile)
+	}
+
+	return r.hosts[host]
+}
+
+// readHostsFile returns the addresses of each host in the given hosts file.
+func readHostsFile(path string) map[string][]net.IP {
+	hosts := make(map[string][]net.IP)
+	file, openErr := os.Open(path)
+	if openErr != nil {
+		return hosts
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		ip := net.ParseIP(strings.SplitN(fields[0], "%", 2)[0])
+		if ip == nil {
+			continue
+		}
+		for _, name := range fields[1:] {
+			name = strings.TrimSuffix(strings.ToLower(name), ".")
+			hosts[name] = append(hosts[name], ip)
+		}
+	}
+
+	return hosts
+}
+
+// searchNames returns the names tried when resolving the given host, in order: the host itself first if it has at
+// least ndots dots, then the host in each search domain, then the host itself if it wasn't tried first.
+func (r *resolver) searchNames(host string) []string {
+	if strings.Count(host, ".") >= r.ndots {
+		names := []string{host}
+		for _, domain := range r.search {
+			names = append(names, host+"."+domain)
+		}
+		return names
+	}
+
+	names := make([]string, 0, len(r.search)+1)
+	for _, domain := range r.search {
+		names = append(names, host+"."+domain)
+	}
+
+	return append(names, host)
+}
+
+// query queries the DNS servers for the A and AAAA records of the given name, returning its addresses, IPv4
+// addresses first, the lowest TTL of the records followed, and the records answered.
+func (r *resolver) query(ctx context.Context, name string) ([]net.IP, uint32, []Record, error) {
+	type answer struct {
+		message *dnsmessage.Message
+		server  string
+		err     error
+	}
+	answers := make([]answer, 2)
+	var wg sync.WaitGroup
+	for i, queryType := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			answers[i].message, answers[i].server, answers[i].err = r.exchange(ctx, name, queryType)
+		}()
+	}
+	wg.Wait()
+
+	ips := make([]net.IP, 0)
+	records := make([]Record, 0)
+	ttl := uint32(maxCacheTTL / time.Second)
+	var queryErr error
+	now := time.Now()
+	for _, answer := range answers {
+		if answer.err != nil {
+			queryErr = answer.err
+			continue
+		}
+		answerRecords := messageRecords(answer.message, answer.server, now)
+		records = append(records, answerRecords...)
+		for _, record := range answerRecords {
+			ttl = min(ttl, record.TTL)
+			if (record.Type == "A" || record.Type == "AAAA") && record.Value != "" {
+				ips = append(ips, net.ParseIP(record.Value))
+			}
+		}
+	}
+
+	if len(ips) == 0 {
+		if queryErr != nil {
+			return nil, 0, records, queryErr
+		}
+		return nil, 0, records, fmt.Errorf("%w for %s", errNoAnswer, name)
+	}
+
+	return ips, ttl, records, nil
+}
+
+// messageRecords returns the A, AAAA, and CNAME records in the answers of the given response from the given server,
+// keeping only those on the CNAME chain from the queried name, as any others were not asked for.
+// Responses without any are returned as a single record with an empty value, holding the response code.
+func messageRecords(message *dnsmessage.Message, server string, timestamp time.Time) []Record {
+	records := make([]Record, 0, len(message.Answers))
+	host := ""
+	if len(message.Questions) > 0 {
+		host = strings.TrimSuffix(strings.ToLower(message.Questions[0].Name.String()), ".")
+	}
+	for _, answer := range message.Answers {
+		record := Record{
+			Host:      host,
+			Name:      strings.TrimSuffix(strings.ToLower(answer.Header.Name.String()), "."),
+			TTL:       answer.Header.TTL,
+			Resolver:  server,
+			RCode:     rcodeName(message.RCode),
+			Timestamp: timestamp,
+		}
+		switch body := answer.Body.(type) {
+		case *dnsmessage.AResource:
+			record.Type, record.Value = "A", net.IP(body.A[:]).String()
+		case *dnsmessage.AAAAResource:
+			record.Type, record.Value = "AAAA", net.IP(body.AAAA[:]).String()
+		case *dnsmessage.CNAMEResource:
+			record.Type, record.Value = "CNAME", strings.TrimSuffix(strings.ToLower(body.CNAME.String()), ".")
+		default:
+			continue
+		}
+		records = append(records, record)
+	}
+	records = cnameChain(records, host)
+
+	if len(records) == 0 && len(message.Questions) > 0 {
+		records = append(records, Record{
+			Host:      host,
+			Name:      host,
+			Type:      strings.TrimPrefix(message.Questions[0].Type.String(), "Type"),
+			Resolver:  server,
+			RCode:     rcodeName(message.RCode),
+			Timestamp: timestamp,
+		})
+	}
+
+	return records
+}
+
+// cnameChain returns the given records on the CNAME chain from the given host: the records of the host, and of each
+// name that a name on the chain is an alias for.
+func cnameChain(records []Record, host string) []Record {
+	names := map[string]bool{host: true}
+	for added := true; added; {
+		added = false
+		for _, record := range records {
+			if record.Type == "CNAME" && names[record.Name] && !names[record.Value] {
+				names[record.Value] = true
+				added = true
+			}
+		}
+	}
+
+	chain := make([]Record, 0, len(records))
+	for _, record := range records {
+		if names[record.Name] {
+			chain = append(chain, record)
+		}
+	}
+
+	return chain
+}
+
+// rcodeName returns the name of the given DNS response code, such as "NOERROR" or "NXDOMAIN".
+func rcodeName(rcode dnsmessage.RCode) string {
+	switch rcode {
+	case dnsmessage.RCodeSuccess:
+		return "NOERROR"
+	case dnsmessage.RCodeFormatError:
+		return "FORMERR"
+	case dnsmessage.RCodeServerFailure:
+		return "SERVFAIL"
+	case dnsmessage.RCodeNameError:
+		return "NXDOMAIN"
+	case dnsmessage.RCodeNotImplemented:
+		return "NOTIMP"
+	case dnsmessage.RCodeRefused:
+		return "REFUSED"
+	default:
+		return strconv.Itoa(int(rcode))
+	}
+}
+
+// recordType returns the type of the address record for the given IP address.
+func recordType(ip net.IP) string {
+	if ip.To4() != nil {
+		return "A"
+	}
+
+	return "AAAA"
+}
+
+// exchange queries the DNS servers or DNS over HTTPS endpoint in turn for the records of the given name and type,
+// until one answers.
+// Responses with a server failure are treated as no answer, so that the next server is tried.
+func (r *resolver) exchange(ctx context.Context, name string, queryType dnsmessage.Type) (*dnsmessage.Message, string, error) {
+	queryName, nameErr := dnsmessage.NewName(name + ".")
+	if nameErr != nil {
+		return nil, "", fmt.Errorf("invalid host name %q: %w", name, nameErr)
+	}
+	// Use an unpredictable query ID, so that responses are harder to spoof
+	var id [2]byte
+	if _, randErr := rand.Read(id[:]); randErr != nil {
+		return nil, "", fmt.Errorf("unable to generate DNS query ID: %w", randErr)
+	}
+	query := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: binary.BigEndian.Uint16(id[:]), RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: queryName, Type: queryType, Class: dnsmessage.ClassINET}},
+	}
+	packed, packErr := query.Pack()
+	if packErr != nil {
+		return nil, "", fmt.Errorf("unable to pack DNS query: %w", packErr)
+	}
+
+	var exchangeErr error
+	for _, server := range r.upstreams() {
+		var response []byte
+		if response, exchangeErr = r.exchangeServer(ctx, "udp", server, packed); exchangeErr != nil {
+			continue
+		}
+		if !responseMatches(packed, response) {
+			exchangeErr = fmt.Errorf("DNS response from %s does not match query", server)
+			continue
+		}
+
+		var message dnsmessage.Message
+		if exchangeErr = message.Unpack(response); exchangeErr != nil {
+			exchangeErr = fmt.Errorf("unable to parse DNS response from %s: %w", server, exchangeErr)
+			continue
+		}
+		if message.Truncated {
+			if response, exchangeErr = r.exchangeServer(ctx, "tcp", server, packed); exchangeErr != nil {
+				continue
+			}
+			if !responseMatches(packed, response) {
+				exchangeErr = fmt.Errorf("DNS response from %s does not match query", server)
+				continue
+			}
+			if exchangeErr = message.Unpack(response); exchangeErr != nil {
+				exchangeErr = fmt.Errorf("unable to parse DNS response from %s: %w", server, exchangeErr)
+				continue
+			}
+		}
+		if message.RCode == dnsmessage.RCodeServerFailure || message.RCode == dnsmessage.RCodeRefused {
+			exchangeErr = fmt.Errorf("DNS server %s answered %s", server, rcodeName(message.RCode))
+			continue
+		}
+
+		return &message, server, nil
+	}
+
+	return nil, "", exchangeErr
+}
+
+// upstreams returns the DNS servers queried, in order, or the DNS over HTTPS endpoint if one is set.
+func (r *resolver) upstreams() []string {
+	if r.dohURL != "" {
+		return []string{r.dohURL}
+	}
+
+	return r.servers
+}
+
+// exchangeServer sends the given packed DNS query to the given upstream, as returned by upstreams, and returns the
+// packed response. Queries to DNS servers are sent over the given network ("udp" or "tcp").
+func (r *resolver) exchangeServer(ctx context.Context, network, server string, query []byte) ([]byte, error) {
+	if r.dohURL != "" && server == r.dohURL {
+		return r.exchangeDoH(ctx, query)
+	}
+
+	return exchangeWith(ctx, network, server, query)
+}
+
+// exchangeDoH sends the given packed DNS query to the DNS over HTTPS endpoint, as described in RFC 8484, and returns
+// the packed response.
+func (r *resolver) exchangeDoH(ctx context.Context, query []byte) ([]byte, error) {
+	request, requestErr := http.NewRequestWithContext(ctx, http.MethodPost, r.dohURL, bytes.NewReader(query))
+	if requestErr != nil {
+		return nil, fmt.Errorf("unable to create DNS over HTTPS request: %w", requestErr)
+	}
+	request.Header.Set("Content-Type", dohContentType)
+	request.Header.Set("Accept", dohContentType)
+
+	response, doErr := r.dohClient.Do(request)
+	if doErr != nil {
+		return nil, fmt.Errorf("unable to send DNS query to %s: %w", r.dohURL, doErr)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DNS over HTTPS endpoint %s answered with status %d", r.dohURL, response.StatusCode)
+	}
+
+	body, readErr := io.ReadAll(io.LimitReader(response.Body, maxMessageSize))
+	if readErr != nil {
+		return nil, fmt.Errorf("unable to read DNS response from %s: %w", r.dohURL, readErr)
+	}
+
+	return body, nil
+}
+
+// exchangeWith sends the given packed DNS query to the given server over the given network ("udp" or "tcp"), and
+// returns the packed response.
+func exchangeWith(ctx context.Context, network, server string, query []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	conn, dialErr := (&net.Dialer{}).DialContext(ctx, network, server)
+	if dialErr != nil {
+		return nil, fmt.Errorf("unable to connect to DNS server %s: %w", server, dialErr)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	if network == "udp" {
+		if _, writeErr := conn.Write(query); writeErr != nil {
+			return nil, fmt.Errorf("unable to send DNS query to %s: %w", server, writeErr)
+		}
+		// Skip packets that aren't a response to the query, such as late or spoofed responses, until the deadline
+		response := make([]byte, maxMessageSize)
+		for {
+			n, readErr := conn.Read(response)
+			if readErr != nil {
+				return nil, fmt.Errorf("unable to read DNS response from %s: %w", server, readErr)
+			}
+			if responseMatches(query, response[:n]) {
+				return response[:n], nil
+			}
+		}
+	}
+
+	// Messages sent over TCP are prefixed with their length
+	if writeErr := writeTCPMessage(conn, query); writeErr != nil {
+		return nil, fmt.Errorf("unable to send DNS query to %s: %w", server, writeErr)
+	}
+	response, readErr := readTCPMessage(conn)
+	if readErr != nil {
+		return nil, fmt.Errorf("unable to read DNS response from %s: %w", server, readErr)
+	}
+
+	return response, nil
+}
+
+// responseMatches returns true if the given packed DNS message is a response to the given packed query: it has the
+// response bit set, and the same ID and single question as the query.
+func responseMatches(query []byte, response []byte) bool {
+	var queryParser, responseParser dnsmessage.Parser
+	queryHeader, queryErr := queryParser.Start(query)
+	responseHeader, responseErr := responseParser.Start(response)
+	if queryErr != nil || responseErr != nil || !responseHeader.Response || responseHeader.ID != queryHeader.ID {
+		return false
+	}
+
+	queryQuestion, queryErr := queryParser.Question()
+	responseQuestion, responseErr := responseParser.Question()
+	if queryErr != nil || responseErr != nil {
+		return false
+	}
+	if _, moreErr := responseParser.Question(); !errors.Is(moreErr, dnsmessage.ErrSectionDone) {
+		return false
+	}
+
+	return strings.EqualFold(responseQuestion.Name.String(), queryQuestion.Name.String()) &&
+		responseQuestion.Type == queryQuestion.Type && responseQuestion.Class == queryQuestion.Class
+}
+
+// writeTCPMessage writes the given DNS message to the given stream, prefixed with its length.
+func writeTCPMessage(w io.Writer, message []byte) error {
+	framed := make([]byte, 2+len(message))
+	binary.BigEndian.PutUint16(framed, uint16(len(message)))
+	copy(framed[2:], message)
+	_, writeErr := w.Write(framed)
+
+	return writeErr
+}
+
+// readTCPMessage reads a DNS message prefixed with its length from the given stream.
+func readTCPMessage(r io.Reader) ([]byte, error) {
+	var length [2]byte
+	if _, readErr := io.ReadFull(r, length[:]); readErr != nil {
+		return nil, readErr
+	}
+	message := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, readErr := io.ReadFull(r, message); readErr != nil {
+		return nil, readErr
+	}
+
+	return message, nil
+}
@@ -0,0 +1,129 @@
+package jsAnalyzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Endpoint is an endpoint found in a script, as returned by the endpoints API.
+type Endpoint struct {
+	ScriptURL  string    `json:"script_url"`
+	URL        string    `json:"url"`
+	Kind       string    `json:"kind"`
+	Method     string    `json:"method"`
+	SourceFile string    `json:"source_file"`
+	FirstSeen  time.Time `json:"first_seen"`
+	LastSeen   time.Time `json:"last_seen"`
+
+	// Visited is true if the logger has seen a request to the endpoint.
+	Visited bool `json:"visited"`
+}
+
+// SourceMap is the index of a fetched source map, as returned by the source maps API.
+type SourceMap struct {
+	MapURL    string    `json:"map_url"`
+	ScriptURL string    `json:"script_url"`
+	Sources   []string  `json:"sources"`
+	Endpoints int       `json:"endpoints"`
+	Fetched   time.Time `json:"fetched"`
+}
+
+// EndpointsAPIHandler is an HTTP handler that returns the endpoints found in scripts as a JSON array.
+// The results can be limited to a single host with the "host" query parameter, and to endpoints that the logger has
+// not seen a request to (candidates for further mapping) by setting the "unvisited" query parameter to "true".
+func (ja *JSAnalyzer) EndpointsAPIHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET requests (or OPTIONS)
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Allow", "GET, OPTIONS")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	} else if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET, OPTIONS")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	host := r.URL.Query().Get("host")
+	unvisited := r.URL.Query().Get("unvisited") == "true"
+
+	sqlSelect := `select e.script_url, e.url_scheme || '://' || e.url_host || e.url_path, e.kind, e.method, e.source_file,
+			   e.first_seen, e.last_seen,
+			   exists(select 1 from data_logger dl where dl.url_host = e.url_host and dl.url_path = e.url_path) as visited
+		from data_js_endpoints e
+		where ($1 = '' or e.url_host = $1)
+		order by e.url_host, e.url_path, e.kind;`
+	rows, queryErr := ja.dbConnPool.Query(r.Context(), sqlSelect, host)
+	if queryErr != nil {
+		http.Error(w, fmt.Sprintf("unable to get endpoints: %s", queryErr), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	endpoints := make([]Endpoint, 0)
+	for rows.Next() {
+		var e Endpoint
+		if scanErr := rows.Scan(&e.ScriptURL, &e.URL, &e.Kind, &e.Method, &e.SourceFile, &e.FirstSeen, &e.LastSeen, &e.Visited); scanErr != nil {
+			http.Error(w, fmt.Sprintf("unable to scan endpoints: %s", scanErr), http.StatusInternalServerError)
+			return
+		}
+		if unvisited && e.Visited {
+			continue
+		}
+		endpoints = append(endpoints, e)
+	}
+	if rowsErr := rows.Err(); rowsErr != nil {
+		http.Error(w, fmt.Sprintf("unable to get endpoints: %s", rowsErr), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the endpoints as JSON
+	w.Header().Set("Content-Type", "application/json")
+	if jsonMarshalErr := json.NewEncoder(w).Encode(endpoints); jsonMarshalErr != nil {
+		http.Error(w, fmt.Sprintf("unable to encode endpoints to JSON: %s", jsonMarshalErr), http.StatusInternalServerError)
+		return
+	}
+}
+
+// SourceMapsAPIHandler is an HTTP handler that returns the index of all fetched source maps as a JSON array.
+func (ja *JSAnalyzer) SourceMapsAPIHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET requests (or OPTIONS)
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Allow", "GET, OPTIONS")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	} else if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET, OPTIONS")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	rows, queryErr := ja.dbConnPool.Query(r.Context(), `SELECT map_url, script_url, sources, endpoints, fetched FROM data_js_sourcemaps ORDER BY map_url;`)
+	if queryErr != nil {
+		http.Error(w, fmt.Sprintf("unable to get source maps: %s", queryErr), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	sourceMaps := make([]SourceMap, 0)
+	for rows.Next() {
+		var sm SourceMap
+		if scanErr := rows.Scan(&sm.MapURL, &sm.ScriptURL, &sm.Sources, &sm.Endpoints, &sm.Fetched); scanErr != nil {
+			http.Error(w, fmt.Sprintf("unable to scan source maps: %s", scanErr), http.StatusInternalServerError)
+			return
+		}
+		sourceMaps = append(sourceMaps, sm)
+	}
+	if rowsErr := rows.Err(); rowsErr != nil {
+		http.Error(w, fmt.Sprintf("unable to get source maps: %s", rowsErr), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the source maps as JSON
+	w.Header().Set("Content-Type", "application/json")
+	if jsonMarshalErr := json.NewEncoder(w).Encode(sourceMaps); jsonMarshalErr != nil {
+		http.Error(w, fmt.Sprintf("unable to encode source maps to JSON: %s", jsonMarshalErr), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,200 @@
+package jsAnalyzer
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Endpoint kinds, describing how an endpoint was found in a script.
+const (
+	kindLiteral string = "literal"
+	kindFetch   string = "fetch"
+	kindAxios   string = "axios"
+	kindJQuery  string = "jquery"
+	kindXHR     string = "xhr"
+	kindRoute   string = "route"
+)
+
+// maxLiteralLength is the length of the longest string literal that is considered as an endpoint.
+const maxLiteralLength int = 2000
+
+// stringLiteral matches a single, double, or backtick-quoted JavaScript string literal. The contents are captured in
+// one of three groups, depending on the quote used.
+const stringLiteral string = `(?:"((?:[^"\\\n]|\\.)*)"|'((?:[^'\\\n]|\\.)*)'|` + "`" + `((?:[^` + "`" + `\\]|\\.)*)` + "`" + `)`
+
+var (
+	// literalRegex matches any string literal.
+	literalRegex = regexp.MustCompile(stringLiteral)
+
+	// fetchRegex matches calls to fetch with a string literal URL.
+	fetchRegex = regexp.MustCompile(`\bfetch\s*\(\s*` + stringLiteral)
+
+	// axiosRegex matches calls to axios and its method shortcuts with a string literal URL.
+	axiosRegex = regexp.MustCompile(`\baxios(?:\.(get|post|put|patch|delete|head|options|request))?\s*\(\s*` + stringLiteral)
+
+	// jQueryRegex matches calls to the jQuery AJAX functions with a string literal URL.
+	jQueryRegex = regexp.MustCompile(`[$\w]\.(get|post|ajax|getJSON|getScript|load)\s*\(\s*` + stringLiteral)
+
+	// xhrRegex matches calls to XMLHttpRequest.open with a string literal method and URL.
+	xhrRegex = regexp.MustCompile(`(?i)\.open\s*\(\s*["'](get|post|put|patch|delete|head|options)["']\s*,\s*` + stringLiteral)
+
+	// urlPropertyRegex matches "url" properties with a string literal value, as used in axios and jQuery settings.
+	urlPropertyRegex = regexp.MustCompile(`\b(?:url|endpoint|baseURL)["']?\s*:\s*` + stringLiteral)
+
+	// routeRegex matches "path" properties with a string literal value, as used in the route tables of client-side
+	// routers (React Router, Vue Router, and Angular).
+	routeRegex = regexp.MustCompile(`\bpath["']?\s*:\s*` + stringLiteral)
+
+	// sourceMapRegex matches source map comments.
+	sourceMapRegex = regexp.MustCompile(`//[#@]\s*sourceMappingURL=(\S+)`)
+
+	// absoluteURLRegex matches absolute and protocol-relative HTTP URLs with a plausible host.
+	absoluteURLRegex = regexp.MustCompile(`^(?:https?:)?//(?:localhost|[a-zA-Z0-9-]+(?:\.[a-zA-Z0-9-]+)*\.[a-zA-Z]{2,})(?::\d+)?(?:[/?#]\S*)?$`)
+
+	// pathRegex matches absolute paths, which must contain at least one letter.
+	pathRegex = regexp.MustCompile(`^/[a-zA-Z0-9_\-.~%:@!$&'()*+,;=/?#\[\]{}]*[a-zA-Z][a-zA-Z0-9_\-.~%:@!$&'()*+,;=/?#\[\]{}]*$`)
+)
+
+// foundEndpoint is a single endpoint found in a script, before it is resolved against the script's URL.
+type foundEndpoint struct {
+	// URL is the endpoint as written in the script.
+	URL string
+
+	// Kind is one of the endpoint kind constants.
+	Kind string
+
+	// Method is the HTTP method of the call the endpoint was found in, in upper case, if known.
+	Method string
+}
+
+// extractEndpoints returns the endpoints referenced in the given JavaScript source. Endpoints found in calls (such as
+// fetch) and route tables are returned first, and string literals that were not already found in a call are returned
+// after them. Each endpoint is only returned once.
+func extractEndpoints(source string) []foundEndpoint {
+	found := make([]foundEndpoint, 0)
+	seen := make(map[string]bool)
+	add := func(value string, kind string, method string) {
+		if value == "" || seen[value] {
+			return
+		}
+		seen[value] = true
+		found = append(found, foundEndpoint{URL: value, Kind: kind, Method: strings.ToUpper(method)})
+	}
+
+	// Calls that make requests, where any URL (including relative URLs) is accepted
+	for _, match := range fetchRegex.FindAllStringSubmatch(source, -1) {
+		add(callTarget(literalValue(match[1:])), kindFetch, "")
+	}
+	for _, match := range axiosRegex.FindAllStringSubmatch(source, -1) {
+		method := match[1]
+		if method == "request" {
+			method = ""
+		}
+		add(callTarget(literalValue(match[2:])), kindAxios, method)
+	}
+	for _, match := range jQueryRegex.FindAllStringSubmatch(source, -1) {
+		method := ""
+		if match[1] == "post" {
+			method = "post"
+		} else if match[1] != "ajax" {
+			method = "get"
+		}
+		add(callTarget(literalValue(match[2:])), kindJQuery, method)
+	}
+	for _, match := range xhrRegex.FindAllStringSubmatch(source, -1) {
+		add(callTarget(literalValue(match[2:])), kindXHR, match[1])
+	}
+	for _, match := range urlPropertyRegex.FindAllStringSubmatch(source, -1) {
+		if value := literalValue(match[1:]); isEndpoint(value) {
+			add(value, kindFetch, "")
+		}
+	}
+
+	// Client-side routes, which may be written without a leading slash
+	for _, match := range routeRegex.FindAllStringSubmatch(source, -1) {
+		add(routePath(literalValue(match[1:])), kindRoute, "")
+	}
+
+	// Any other string literals that look like URLs or paths
+	for _, match := range literalRegex.FindAllStringSubmatch(source, -1) {
+		if value := literalValue(match[1:]); isEndpoint(value) {
+			add(value, kindLiteral, "")
+		}
+	}
+
+	return found
+}
+
+// extractSourceMapURL returns the URL in the last source map comment of the given JavaScript source, or an empty
+// string if there is none.
+func extractSourceMapURL(source string) string {
+	matches := sourceMapRegex.FindAllStringSubmatch(source, -1)
+	if len(matches) == 0 {
+		return ""
+	}
+
+	return matches[len(matches)-1][1]
+}
+
+// literalValue returns the unescaped contents of a string literal matched by stringLiteral, given the three content
+// groups. Template literals are cut off at their first substitution.
+func literalValue(groups []string) string {
+	value := groups[0]
+	if value == "" {
+		value = groups[1]
+	}
+	if value == "" {
+		value = groups[2]
+		if i := strings.Index(value, "${"); i >= 0 {
+			value = value[:i]
+		}
+	}
+	if len(value) > maxLiteralLength {
+		return ""
+	}
+
+	// Unescape the most common escaped characters in URLs
+	value = strings.NewReplacer(`\/`, "/", `\u002F`, "/", `\u002f`, "/", `\x2F`, "/", `\x2f`, "/").Replace(value)
+
+	return strings.TrimSpace(value)
+}
+
+// callTarget returns the given call argument if it could be a URL, or an empty string otherwise.
+func callTarget(value string) string {
+	if value == "" || strings.ContainsAny(value, " \t\r\n\\<>\"") || strings.HasPrefix(value, "data:") || strings.HasPrefix(value, "blob:") {
+		return ""
+	}
+
+	return value
+}
+
+// routePath returns the given client-side route as an absolute path, or an empty string if it is not a concrete route.
+func routePath(value string) string {
+	if value == "" || value == "*" || value == "**" || strings.ContainsAny(value, " \t\r\n\\<>\"") {
+		return ""
+	}
+	if !strings.HasPrefix(value, "/") {
+		value = "/" + value
+	}
+	if !pathRegex.MatchString(value) {
+		return ""
+	}
+
+	return value
+}
+
+// isEndpoint returns true if the given string literal looks like an absolute URL, or an absolute path to an endpoint.
+func isEndpoint(value string) bool {
+	if len(value) < 2 {
+		return false
+	}
+	if absoluteURLRegex.MatchString(value) {
+		return true
+	}
+	if strings.HasPrefix(value, "//") || !pathRegex.MatchString(value) {
+		return false
+	}
+
+	// Skip glob patterns and comment markers
+	return !strings.HasPrefix(value, "/*") && !strings.Contains(value, "/*")
+}
@@ -0,0 +1,55 @@
+package jsAnalyzer
+
+import (
+	"testing"
+)
+
+func TestExtractEndpoints(t *testing.T) {
+	source := `
+		const api = "https://api.example.com/v1";
+		fetch("/api/users").then(r => r.json());
+		fetch(` + "`/api/users/${id}/posts`" + `);
+		axios.post('/api/login', creds);
+		$.getJSON("/api/config");
+		xhr.open("DELETE", "/api/sessions/current");
+		const routes = [{path: "dashboard", component: D}, {path: "/settings/:tab"}, {path: "**"}];
+		const type = "text/html";
+		const regex = "/*";
+		const escaped = "\/api\/escaped";
+		//# sourceMappingURL=app.js.map
+	`
+
+	want := map[string]foundEndpoint{
+		"https://api.example.com/v1": {Kind: kindLiteral},
+		"/api/users":                 {Kind: kindFetch},
+		"/api/users/":                {Kind: kindFetch},
+		"/api/login":                 {Kind: kindAxios, Method: "POST"},
+		"/api/config":                {Kind: kindJQuery, Method: "GET"},
+		"/api/sessions/current":      {Kind: kindXHR, Method: "DELETE"},
+		"/dashboard":                 {Kind: kindRoute},
+		"/settings/:tab":             {Kind: kindRoute},
+		"/api/escaped":               {Kind: kindLiteral},
+	}
+
+	found := extractEndpoints(source)
+	got := make(map[string]foundEndpoint, len(found))
+	for _, endpoint := range found {
+		got[endpoint.URL] = foundEndpoint{Kind: endpoint.Kind, Method: endpoint.Method}
+	}
+	for url, wantEndpoint := range want {
+		if gotEndpoint, ok := got[url]; !ok {
+			t.Errorf("endpoint %q not found", url)
+		} else if gotEndpoint != wantEndpoint {
+			t.Errorf("endpoint %q = %+v, want %+v", url, gotEndpoint, wantEndpoint)
+		}
+	}
+	for url := range got {
+		if _, ok := want[url]; !ok {
+			t.Errorf("unexpected endpoint %q", url)
+		}
+	}
+
+	if sourceMapURL := extractSourceMapURL(source); sourceMapURL != "app.js.map" {
+		t.Errorf("extractSourceMapURL() = %q, want %q", sourceMapURL, "app.js.map")
+	}
+}
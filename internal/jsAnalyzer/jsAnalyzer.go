@@ -0,0 +1,415 @@
+package jsAnalyzer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	log "github.com/sirupsen/logrus"
+	netProxy "golang.org/x/net/proxy"
+
+	"github.com/TheHackerDev/cartograph/internal/config"
+	"github.com/TheHackerDev/cartograph/internal/dns"
+	"github.com/TheHackerDev/cartograph/internal/mapper"
+	"github.com/TheHackerDev/cartograph/internal/shared/database"
+	"github.com/TheHackerDev/cartograph/internal/shared/datatypes"
+	"github.com/TheHackerDev/cartograph/internal/shared/dispatch"
+	internalHttp "github.com/TheHackerDev/cartograph/internal/shared/http"
+	"github.com/TheHackerDev/cartograph/internal/shared/metrics"
+)
+
+const (
+	// maxScriptSize is the size of the largest script body that is analyzed, in bytes.
+	maxScriptSize int = 10 << 20
+
+	// maxSeen is the number of analyzed scripts and fetched source maps remembered, to avoid analyzing them again.
+	// The memory is cleared once it is full.
+	maxSeen int = 10000
+)
+
+// javaScriptMediaTypes holds the media types of JavaScript responses.
+var javaScriptMediaTypes = map[string]bool{
+	"application/javascript":   true,
+	"application/x-javascript": true,
+	"application/ecmascript":   true,
+	"text/javascript":          true,
+	"text/ecmascript":          true,
+}
+
+// NewJSAnalyzer returns a new JSAnalyzer object using the given configuration, which sends the endpoints it finds to
+// the given mapper plugin, and the host names it finds to the given DNS plugin.
+//
+// Any errors returned should be considered fatal.
+func NewJSAnalyzer(cfg *config.Config, pluginMapper *mapper.Mapper, pluginDNS *dns.DNS) (*JSAnalyzer, error) {
+	jsAnalyzer := &JSAnalyzer{
+		mu:             sync.RWMutex{},
+		enabled:        true,
+		cfg:            cfg,
+		pluginMapper:   pluginMapper,
+		pluginDNS:      pluginDNS,
+		httpClient:     newSourceMapClient(cfg, pluginDNS.DialContext, pluginDNS.ProxyDialContext),
+		seenScripts:    make(map[[sha256.Size]byte]bool),
+		seenSourceMaps: make(map[string]bool),
+		stop:           make(chan struct{}),
+		stopped:        make(chan struct{}),
+	}
+
+	// Get a database connection pool
+	dbConnPool, dbConnPoolErr := database.GetDbConnPool(cfg.DbConnString)
+	if dbConnPoolErr != nil {
+		return nil, fmt.Errorf("unable to get database connection pool: %w", dbConnPoolErr)
+	}
+	metrics.RegisterDbPool("js-analyzer", dbConnPool)
+	jsAnalyzer.dbConnPool = dbConnPool
+
+	// Create the input queue
+	var queueErr error
+	if jsAnalyzer.scriptInput, queueErr = dispatch.NewQueue[*scriptData]("js-analyzer", cfg.JSAnalyzerQueue); queueErr != nil {
+		return nil, fmt.Errorf("unable to create script input queue: %w", queueErr)
+	}
+
+	return jsAnalyzer, nil
+}
+
+// newSourceMapClient returns the HTTP client used to fetch source maps, which connects to remote servers in the same
+// way as the proxy: through the SOCKS5 proxy if one is set, with the dial function returned by proxyDial, or with the
+// given dial function otherwise. The DNS plugin's functions apply DNS overrides and log every resolution.
+func newSourceMapClient(cfg *config.Config, dial func(ctx context.Context, network, address string) (net.Conn, error), proxyDial func(dialer netProxy.ContextDialer) func(ctx context.Context, network, address string) (net.Conn, error)) *http.Client {
+	transport, transportErr := internalHttp.NewUpstreamTransport(cfg.Socks5ProxyString, dial, proxyDial)
+	if transportErr != nil {
+		log.WithError(transportErr).Error("unable to use SOCKS5 proxy for source maps")
+	}
+
+	return &http.Client{Timeout: 30 * time.Second, Transport: transport}
+}
+
+// JSAnalyzer is a plugin that finds the endpoints referenced in JavaScript responses, including those that are never
+// requested while browsing, and records them as discovered mapper edges.
+// A JSAnalyzer object should *always* be instantiated via the NewJSAnalyzer function.
+type JSAnalyzer struct {
+	// mu is a RWMutex to control concurrent access.
+	mu sync.RWMutex
+
+	// enabled is true if the JSAnalyzer plugin is enabled.
+	enabled bool
+
+	// cfg is the configuration for the program.
+	cfg *config.Config
+
+	// dbConnPool is a database connection pool used for concurrency-safe database connections.
+	dbConnPool *pgxpool.Pool
+
+	// pluginMapper receives the discovered endpoints as mapper edges.
+	pluginMapper *mapper.Mapper
+
+	// pluginDNS receives the target subdomains found in scripts as candidate hosts.
+	pluginDNS *dns.DNS
+
+	// httpClient is used to fetch source maps.
+	httpClient *http.Client
+
+	// scriptInput is used to accept scripts to be analyzed.
+	scriptInput *dispatch.Queue[*scriptData]
+
+	// seenScripts holds the SHA-256 hashes of the scripts that have been analyzed, so that the same script served at
+	// many URLs (or many times) is only analyzed once.
+	seenScripts map[[sha256.Size]byte]bool
+
+	// seenSourceMaps holds the URLs of the source maps that have been fetched.
+	seenSourceMaps map[string]bool
+
+	// stop is closed to signal the Run loop to handle any queued scripts and return.
+	stop chan struct{}
+
+	// stopped is closed by the Run loop once it has returned.
+	stopped chan struct{}
+
+	// stopOnce ensures the stop channel is only closed once.
+	stopOnce sync.Once
+}
+
+// scriptData is a single JavaScript response to be analyzed.
+type scriptData struct {
+	// ScriptURL is the URL the script was loaded from.
+	ScriptURL url.URL
+
+	// PageURL is the URL of the page that loaded the script, from the Referer header, if known. Paths in the script
+	// are resolved against it, as they are requested by the page.
+	PageURL url.URL
+
+	// Body is the decoded script body.
+	Body []byte
+
+	// SourceMapURL is the source map URL from the SourceMap or X-SourceMap response header, if present.
+	SourceMapURL string
+
+	// Timestamp is the time the script was seen.
+	Timestamp time.Time
+}
+
+// MarshalJSON encodes the script as JSON, with its URLs as strings, as the user information of a url.URL is lost when
+// it is encoded as a struct.
+func (script scriptData) MarshalJSON() ([]byte, error) {
+	type encodedScript scriptData
+	return json.Marshal(struct {
+		encodedScript
+		ScriptURL string
+		PageURL   string
+	}{encodedScript(script), script.ScriptURL.String(), script.PageURL.String()})
+}
+
+// UnmarshalJSON decodes the script from the JSON encoding produced by MarshalJSON.
+func (script *scriptData) UnmarshalJSON(data []byte) error {
+	type encodedScript scriptData
+	decoded := struct {
+		*encodedScript
+		ScriptURL string
+		PageURL   string
+	}{encodedScript: (*encodedScript)(script)}
+	if unmarshalErr := json.Unmarshal(data, &decoded); unmarshalErr != nil {
+		return unmarshalErr
+	}
+
+	for _, u := range []struct {
+		raw string
+		url *url.URL
+	}{{decoded.ScriptURL, &script.ScriptURL}, {decoded.PageURL, &script.PageURL}} {
+		if u.raw == "" {
+			continue
+		}
+		parsed, parseErr := url.Parse(u.raw)
+		if parseErr != nil {
+			return fmt.Errorf("unable to parse URL %q: %w", u.raw, parseErr)
+		}
+		*u.url = *parsed
+	}
+
+	return nil
+}
+
+// Run runs the JSAnalyzer plugin.
+// Any errors returned should be considered fatal.
+func (ja *JSAnalyzer) Run() error {
+	// Signal Stop once the loop has returned
+	defer close(ja.stopped)
+
+	// Cancel source map requests when stopping
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for {
+		select {
+		case <-ja.stop:
+			// Stop reading spilled data back into the input queue, then handle any scripts still waiting in memory,
+			// without fetching their source maps
+			cancel()
+			if closeErr := ja.scriptInput.Close(); closeErr != nil {
+				log.WithError(closeErr).Error("unable to close script input queue")
+			}
+			for drained := false; !drained; {
+				select {
+				case script := <-ja.scriptInput.Items():
+					ja.handleScript(ctx, script)
+				default:
+					drained = true
+				}
+			}
+			return nil
+		case script := <-ja.scriptInput.Items():
+			ja.handleScript(ctx, script)
+		}
+	}
+}
+
+// Stop signals the JSAnalyzer plugin to stop, and blocks until all queued scripts have been analyzed.
+// It must only be called after Run has been started.
+func (ja *JSAnalyzer) Stop() {
+	ja.stopOnce.Do(func() {
+		close(ja.stop)
+	})
+	<-ja.stopped
+}
+
+// Enabled returns true if the JSAnalyzer plugin is enabled.
+func (ja *JSAnalyzer) Enabled() bool {
+	return ja.enabled
+}
+
+// QueueStats returns the statistics for the JSAnalyzer's input queue.
+func (ja *JSAnalyzer) QueueStats() []dispatch.Stats {
+	return []dispatch.Stats{ja.scriptInput.Stats()}
+}
+
+// AnalyzeResponse sends the given HTTP response to the JSAnalyzer plugin for analysis, if it is a JavaScript response
+// for a target. The referred data holds the URL of the script and the page that loaded it.
+// It does not block; if the input queue is full, the script is handled according to the queue policy.
+func (ja *JSAnalyzer) AnalyzeResponse(response *http.Response, referredData *datatypes.ReferrerData) error {
+	// Check if enabled first
+	if !ja.Enabled() {
+		return nil
+	}
+
+	// Only analyze JavaScript responses for targets
+	mediaType, _, _ := mime.ParseMediaType(response.Header.Get("Content-Type"))
+	if !javaScriptMediaTypes[strings.ToLower(mediaType)] {
+		return nil
+	}
+	if !ja.cfg.IsTarget(referredData.Referer.Host, referredData.Destination.Host) {
+		return nil
+	}
+	if response.Body == nil || response.Body == http.NoBody || response.ContentLength > int64(maxScriptSize) {
+		return nil
+	}
+
+	// Read and decode the response body
+	body, bodyCopy, readErr := internalHttp.ReadBody(response.Body)
+	response.Body = bodyCopy
+	if readErr != nil {
+		return fmt.Errorf("unable to read response body: %w", readErr)
+	}
+	body, decodeErr := internalHttp.DecodeBody(body, response.Header.Get("Content-Encoding"))
+	if decodeErr != nil {
+		return fmt.Errorf("unable to decode response body: %w", decodeErr)
+	}
+	if len(body) == 0 || len(body) > maxScriptSize {
+		return nil
+	}
+
+	// Get the source map URL from the headers, if present
+	sourceMapURL := response.Header.Get("SourceMap")
+	if sourceMapURL == "" {
+		sourceMapURL = response.Header.Get("X-SourceMap")
+	}
+
+	ja.scriptInput.Enqueue(&scriptData{
+		ScriptURL:    referredData.Destination,
+		PageURL:      referredData.Referer,
+		Body:         body,
+		SourceMapURL: sourceMapURL,
+		Timestamp:    time.Now(),
+	})
+
+	return nil
+}
+
+// handleScript analyzes the given script and its source map, then saves the endpoints found to the database and
+// sends them to the mapper.
+func (ja *JSAnalyzer) handleScript(ctx context.Context, script *scriptData) {
+	// Skip scripts that have already been analyzed
+	hash := sha256.Sum256(script.Body)
+	ja.mu.Lock()
+	if ja.seenScripts[hash] {
+		ja.mu.Unlock()
+		return
+	}
+	if len(ja.seenScripts) >= maxSeen {
+		ja.seenScripts = make(map[[sha256.Size]byte]bool)
+	}
+	ja.seenScripts[hash] = true
+	ja.mu.Unlock()
+
+	// Send the target subdomains in the script to the DNS plugin as candidate hosts
+	ja.pluginDNS.ObserveScript(script.ScriptURL, script.Body)
+
+	source := string(script.Body)
+	endpoints := ja.resolveEndpoints(script, extractEndpoints(source), "")
+
+	// Analyze the original source files in the script's source map, if it has one
+	sourceMapURL := script.SourceMapURL
+	if sourceMapURL == "" {
+		sourceMapURL = extractSourceMapURL(source)
+	}
+	if sourceMapURL != "" {
+		sourceMapEndpoints, sourceMapErr := ja.handleSourceMap(ctx, script, sourceMapURL)
+		if sourceMapErr != nil {
+			log.WithError(sourceMapErr).WithField("script", script.ScriptURL.String()).Debug("unable to analyze source map")
+		}
+		endpoints = append(endpoints, sourceMapEndpoints...)
+	}
+
+	// Save the endpoints, and send them to the mapper as discovered edges
+	start := time.Now()
+	saveErr := ja.saveEndpointsToDatabase(endpoints)
+	ja.scriptInput.RecordFlush(len(endpoints), time.Since(start), saveErr)
+	if saveErr != nil {
+		log.WithError(saveErr).WithField("script", script.ScriptURL.String()).Error("unable to save script endpoints to database")
+	}
+	for _, endpoint := range endpoints {
+		ja.pluginMapper.LogReferredData(&datatypes.ReferrerData{
+			Referer:     endpoint.ScriptURL,
+			Destination: endpoint.URL,
+			Timestamp:   endpoint.Timestamp,
+			Type:        datatypes.EdgeTypeDiscovered,
+			Element:     "script",
+			Attribute:   endpoint.Kind,
+		})
+	}
+}
+
+// endpoint is a single endpoint found in a script, resolved to an absolute URL.
+type endpoint struct {
+	ScriptURL  url.URL
+	URL        url.URL
+	Kind       string
+	Method     string
+	SourceFile string
+	Timestamp  time.Time
+}
+
+// resolveEndpoints resolves the given endpoints found in the given script (or in the given original source file of
+// the script) to absolute HTTP URLs. Paths are resolved against the page that loaded the script, if known, as that is
+// where the requests will be sent from. Endpoints that cannot be resolved are skipped.
+func (ja *JSAnalyzer) resolveEndpoints(script *scriptData, found []foundEndpoint, sourceFile string) []endpoint {
+	base := script.ScriptURL
+	if script.PageURL.Host != "" {
+		base = script.PageURL
+	}
+
+	endpoints := make([]endpoint, 0, len(found))
+	for _, fe := range found {
+		resolved, parseErr := base.Parse(fe.URL)
+		if parseErr != nil || resolved.Host == "" || (resolved.Scheme != "http" && resolved.Scheme != "https") {
+			continue
+		}
+		resolved.Fragment = ""
+
+		endpoints = append(endpoints, endpoint{
+			ScriptURL:  script.ScriptURL,
+			URL:        *resolved,
+			Kind:       fe.Kind,
+			Method:     fe.Method,
+			SourceFile: sourceFile,
+			Timestamp:  script.Timestamp,
+		})
+	}
+
+	return endpoints
+}
+
+// saveEndpointsToDatabase saves the given endpoints to the database in a single batch.
+func (ja *JSAnalyzer) saveEndpointsToDatabase(endpoints []endpoint) error {
+	if len(endpoints) == 0 {
+		return nil
+	}
+
+	batch := &pgx.Batch{}
+	for _, e := range endpoints {
+		batch.Queue(`INSERT INTO data_js_endpoints (script_url, url_scheme, url_host, url_path, kind, method, source_file, first_seen, last_seen) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $8) ON CONFLICT ON CONSTRAINT data_js_endpoints_pk DO UPDATE SET last_seen = $8, method = coalesce(nullif(excluded.method, ''), data_js_endpoints.method), source_file = coalesce(nullif(excluded.source_file, ''), data_js_endpoints.source_file);`,
+			e.ScriptURL.String(), e.URL.Scheme, e.URL.Host, e.URL.Path, e.Kind, e.Method, e.SourceFile, e.Timestamp)
+	}
+	if batchErr := ja.dbConnPool.SendBatch(context.Background(), batch).Close(); batchErr != nil {
+		return fmt.Errorf("unable to insert %d endpoints into database: %w", len(endpoints), batchErr)
+	}
+
+	return nil
+}
@@ -0,0 +1,148 @@
+package jsAnalyzer
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// maxSourceMapSize is the size of the largest source map that is fetched, in bytes.
+const maxSourceMapSize int64 = 50 << 20
+
+// sourceMap holds the fields of a source map (revision 3) that are used to find endpoints.
+type sourceMap struct {
+	Version        int       `json:"version"`
+	SourceRoot     string    `json:"sourceRoot"`
+	Sources        []string  `json:"sources"`
+	SourcesContent []*string `json:"sourcesContent"`
+}
+
+// handleSourceMap fetches the source map at the given URL (relative to the given script), saves an index of its
+// original source files to the database, and returns the endpoints found in them.
+// Source maps are only fetched once, and only if they are for a target. Inline source maps (data: URLs) are decoded
+// directly.
+func (ja *JSAnalyzer) handleSourceMap(ctx context.Context, script *scriptData, rawURL string) ([]endpoint, error) {
+	// Get the source map contents
+	var contents []byte
+	mapURL := rawURL
+	if strings.HasPrefix(rawURL, "data:") {
+		// Inline source maps are indexed under the script's URL
+		mapURL = script.ScriptURL.String() + "#inline"
+		var decodeErr error
+		if contents, decodeErr = decodeDataURL(rawURL); decodeErr != nil {
+			return nil, fmt.Errorf("unable to decode inline source map: %w", decodeErr)
+		}
+	} else {
+		resolved, parseErr := script.ScriptURL.Parse(rawURL)
+		if parseErr != nil {
+			return nil, fmt.Errorf("unable to parse source map URL %q: %w", rawURL, parseErr)
+		}
+		mapURL = resolved.String()
+		if !ja.cfg.IsTarget(script.ScriptURL.Host, resolved.Host) {
+			return nil, nil
+		}
+	}
+
+	// Skip source maps that have already been fetched
+	ja.mu.Lock()
+	if ja.seenSourceMaps[mapURL] {
+		ja.mu.Unlock()
+		return nil, nil
+	}
+	if len(ja.seenSourceMaps) >= maxSeen {
+		ja.seenSourceMaps = make(map[string]bool)
+	}
+	ja.seenSourceMaps[mapURL] = true
+	ja.mu.Unlock()
+
+	if contents == nil {
+		var fetchErr error
+		if contents, fetchErr = ja.fetchSourceMap(ctx, mapURL); fetchErr != nil {
+			return nil, fmt.Errorf("unable to fetch source map %s: %w", mapURL, fetchErr)
+		}
+	}
+
+	// Parse the source map
+	var sm sourceMap
+	if unmarshalErr := json.Unmarshal(contents, &sm); unmarshalErr != nil {
+		return nil, fmt.Errorf("unable to parse source map %s: %w", mapURL, unmarshalErr)
+	}
+
+	// Find the endpoints in each original source file
+	endpoints := make([]endpoint, 0)
+	sources := make([]string, 0, len(sm.Sources))
+	for i, source := range sm.Sources {
+		source = sm.SourceRoot + source
+		sources = append(sources, source)
+		if i >= len(sm.SourcesContent) || sm.SourcesContent[i] == nil {
+			continue
+		}
+		endpoints = append(endpoints, ja.resolveEndpoints(script, extractEndpoints(*sm.SourcesContent[i]), source)...)
+	}
+
+	// Save the index of the source map
+	if _, upsertErr := ja.dbConnPool.Exec(ctx, `INSERT INTO data_js_sourcemaps (map_url, script_url, sources, endpoints, fetched) VALUES ($1, $2, $3, $4, $5) ON CONFLICT ON CONSTRAINT data_js_sourcemaps_pk DO UPDATE SET script_url = excluded.script_url, sources = excluded.sources, endpoints = excluded.endpoints, fetched = excluded.fetched;`,
+		mapURL, script.ScriptURL.String(), sources, len(endpoints), time.Now()); upsertErr != nil {
+		return endpoints, fmt.Errorf("unable to save source map %s to database: %w", mapURL, upsertErr)
+	}
+
+	return endpoints, nil
+}
+
+// fetchSourceMap returns the contents of the source map at the given URL.
+func (ja *JSAnalyzer) fetchSourceMap(ctx context.Context, mapURL string) ([]byte, error) {
+	request, requestErr := http.NewRequestWithContext(ctx, http.MethodGet, mapURL, nil)
+	if requestErr != nil {
+		return nil, fmt.Errorf("unable to create request: %w", requestErr)
+	}
+
+	// Log the request if it's sent on a connection to the address of a DNS override, as with proxied requests
+	requestURL := request.URL
+	request = request.WithContext(httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			ja.pluginDNS.LogOverride(info.Conn, http.MethodGet, requestURL)
+		},
+	}))
+
+	response, responseErr := ja.httpClient.Do(request)
+	if responseErr != nil {
+		return nil, fmt.Errorf("unable to send request: %w", responseErr)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response status: %s", response.Status)
+	}
+
+	contents, readErr := io.ReadAll(io.LimitReader(response.Body, maxSourceMapSize))
+	if readErr != nil {
+		return nil, fmt.Errorf("unable to read response body: %w", readErr)
+	}
+
+	return contents, nil
+}
+
+// decodeDataURL returns the contents of the given data: URL.
+func decodeDataURL(dataURL string) ([]byte, error) {
+	header, data, found := strings.Cut(strings.TrimPrefix(dataURL, "data:"), ",")
+	if !found {
+		return nil, fmt.Errorf("missing data in data URL")
+	}
+	if strings.HasSuffix(header, ";base64") {
+		return base64.StdEncoding.DecodeString(data)
+	}
+
+	unescaped, unescapeErr := url.PathUnescape(data)
+	if unescapeErr != nil {
+		return nil, fmt.Errorf("unable to unescape data URL: %w", unescapeErr)
+	}
+
+	return []byte(unescaped), nil
+}
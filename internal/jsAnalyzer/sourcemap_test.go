@@ -0,0 +1,128 @@
+package jsAnalyzer
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	netProxy "golang.org/x/net/proxy"
+
+	"github.com/TheHackerDev/cartograph/internal/config"
+)
+
+func TestFetchSourceMapUpstream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `{"version":3}`)
+	}))
+	defer server.Close()
+
+	// Count the connections made through a SOCKS5 proxy
+	listener, listenErr := net.Listen("tcp", "127.0.0.1:0")
+	if listenErr != nil {
+		t.Fatalf("unable to listen: %v", listenErr)
+	}
+	defer listener.Close()
+	var socks5Connections atomic.Int32
+	go func() {
+		for {
+			conn, acceptErr := listener.Accept()
+			if acceptErr != nil {
+				return
+			}
+			socks5Connections.Add(1)
+			go serveSocks5(conn)
+		}
+	}()
+
+	cfg := &config.Config{Socks5ProxyString: "socks5://" + listener.Addr().String()}
+	dial := func(ctx context.Context, network, address string) (net.Conn, error) {
+		t.Errorf("source map fetched directly from %s", address)
+		return nil, errors.New("direct connection")
+	}
+	proxyDial := func(dialer netProxy.ContextDialer) func(ctx context.Context, network, address string) (net.Conn, error) {
+		return dialer.DialContext
+	}
+	ja := &JSAnalyzer{httpClient: newSourceMapClient(cfg, dial, proxyDial)}
+
+	contents, fetchErr := ja.fetchSourceMap(context.Background(), server.URL+"/app.js.map")
+	if fetchErr != nil {
+		t.Fatalf("fetchSourceMap() error = %v", fetchErr)
+	}
+	if string(contents) != `{"version":3}` {
+		t.Errorf("fetchSourceMap() = %q", contents)
+	}
+	if socks5Connections.Load() == 0 {
+		t.Errorf("source map was not fetched through the SOCKS5 proxy")
+	}
+}
+
+// serveSocks5 handles a single SOCKS5 connection without authentication, connecting it to the requested address.
+func serveSocks5(conn net.Conn) {
+	defer conn.Close()
+
+	// Greeting: version, number of methods, and methods
+	greeting := make([]byte, 2)
+	if _, readErr := io.ReadFull(conn, greeting); readErr != nil {
+		return
+	}
+	if _, readErr := io.ReadFull(conn, make([]byte, greeting[1])); readErr != nil {
+		return
+	}
+	if _, writeErr := conn.Write([]byte{5, 0}); writeErr != nil {
+		return
+	}
+
+	// Request: version, command, reserved, address type, address, and port
+	request := make([]byte, 4)
+	if _, readErr := io.ReadFull(conn, request); readErr != nil {
+		return
+	}
+	var host []byte
+	switch request[3] {
+	case 1:
+		host = make([]byte, net.IPv4len)
+	case 4:
+		host = make([]byte, net.IPv6len)
+	case 3:
+		length := make([]byte, 1)
+		if _, readErr := io.ReadFull(conn, length); readErr != nil {
+			return
+		}
+		host = make([]byte, length[0])
+	default:
+		return
+	}
+	port := make([]byte, 2)
+	if _, readErr := io.ReadFull(conn, host); readErr != nil {
+		return
+	}
+	if _, readErr := io.ReadFull(conn, port); readErr != nil {
+		return
+	}
+	address := string(host)
+	if request[3] != 3 {
+		address = net.IP(host).String()
+	}
+
+	target, dialErr := net.Dial("tcp", net.JoinHostPort(address, strconv.Itoa(int(binary.BigEndian.Uint16(port)))))
+	if dialErr != nil {
+		_, _ = conn.Write([]byte{5, 1, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer target.Close()
+	if _, writeErr := conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0}); writeErr != nil {
+		return
+	}
+
+	go func() {
+		_, _ = io.Copy(target, conn)
+	}()
+	_, _ = io.Copy(conn, target)
+}
@@ -0,0 +1,353 @@
+// Package analytics computes centrality scores, connected components and communities over mapper graphs.
+package analytics
+
+import (
+	"math"
+	"sort"
+
+	"github.com/TheHackerDev/cartograph/internal/shared/datatypes/graph"
+)
+
+const (
+	// pageRankDamping is the probability that the PageRank random surfer follows an edge, rather than jumping to a
+	// random node.
+	pageRankDamping float64 = 0.85
+
+	// pageRankIterations is the maximum number of PageRank iterations.
+	pageRankIterations int = 100
+
+	// pageRankTolerance is the total change in scores below which PageRank has converged.
+	pageRankTolerance float64 = 1e-9
+
+	// maxBetweennessSources is the number of source nodes used to estimate betweenness centrality. Graphs with more
+	// nodes than this use an evenly spaced sample of source nodes, with the scores scaled up to match.
+	maxBetweennessSources int = 1000
+)
+
+// Node attribute keys, as written to graph exports.
+const (
+	AttributeInDegree    string = "in_degree"
+	AttributeOutDegree   string = "out_degree"
+	AttributePageRank    string = "pagerank"
+	AttributeBetweenness string = "betweenness"
+	AttributeComponent   string = "component"
+	AttributeCommunity   string = "community"
+)
+
+// Scores holds the analytics for a single node.
+type Scores struct {
+	// InDegree and OutDegree are the number of distinct nodes with edges to and from the node.
+	InDegree  int `json:"in_degree"`
+	OutDegree int `json:"out_degree"`
+
+	// PageRank is the node's PageRank, following edges in their direction. The scores of all nodes sum to 1.
+	PageRank float64 `json:"pagerank"`
+
+	// Betweenness is the node's normalized betweenness centrality: the share of shortest directed paths between other
+	// nodes that pass through it, from 0 to 1. Nodes with a high betweenness are chokepoints in the graph.
+	Betweenness float64 `json:"betweenness"`
+
+	// Component is the index of the node's weakly connected component, where 0 is the largest component.
+	Component int `json:"component"`
+
+	// Community is the index of the node's community, found with the Louvain method, where 0 is the largest
+	// community.
+	Community int `json:"community"`
+}
+
+// Result holds the analytics for every node in a graph.
+type Result struct {
+	// Scores holds the scores of each node, by node ID.
+	Scores map[string]*Scores
+
+	// Components and Communities are the number of weakly connected components and communities.
+	Components  int
+	Communities int
+
+	// Modularity is the modularity of the communities, from -0.5 to 1. Higher values mean more distinct communities.
+	Modularity float64
+}
+
+// adjacency is a graph in index form, used by the algorithms.
+type adjacency struct {
+	ids []string
+	out [][]int
+	in  [][]int
+}
+
+// newAdjacency returns the given graph in index form. Self loops are dropped. Nodes are indexed in ID order, and
+// the edges of each node sorted, so that the same graph gives the same analytics whatever order it was built in.
+func newAdjacency(g *graph.Graph) *adjacency {
+	nodes := g.Nodes()
+	a := &adjacency{
+		ids: make([]string, len(nodes)),
+		out: make([][]int, len(nodes)),
+		in:  make([][]int, len(nodes)),
+	}
+	for i, node := range nodes {
+		a.ids[i] = node.ID
+	}
+	sort.Strings(a.ids)
+	index := make(map[string]int, len(nodes))
+	for i, id := range a.ids {
+		index[id] = i
+	}
+	for _, edge := range g.Edges() {
+		source, target := index[edge.Source], index[edge.Target]
+		if source == target {
+			continue
+		}
+		a.out[source] = append(a.out[source], target)
+		a.in[target] = append(a.in[target], source)
+	}
+	for i := range a.ids {
+		sort.Ints(a.out[i])
+		sort.Ints(a.in[i])
+	}
+
+	return a
+}
+
+// Compute returns the analytics for every node in the given graph.
+func Compute(g *graph.Graph) *Result {
+	return newAdjacency(g).compute()
+}
+
+// compute returns the analytics for every node in the graph.
+func (a *adjacency) compute() *Result {
+	n := len(a.ids)
+
+	pageRank := a.pageRank()
+	betweenness := a.betweenness()
+	components, componentCount := a.components()
+	communities, communityCount, modularity := a.louvain()
+
+	result := &Result{
+		Scores:      make(map[string]*Scores, n),
+		Components:  componentCount,
+		Communities: communityCount,
+		Modularity:  modularity,
+	}
+	for i, id := range a.ids {
+		result.Scores[id] = &Scores{
+			InDegree:    len(a.in[i]),
+			OutDegree:   len(a.out[i]),
+			PageRank:    pageRank[i],
+			Betweenness: betweenness[i],
+			Component:   components[i],
+			Community:   communities[i],
+		}
+	}
+
+	return result
+}
+
+// Annotate computes the analytics for the given graph, and writes them to it as node attributes.
+func Annotate(g *graph.Graph) *Result {
+	result := Compute(g)
+	annotate(g, result)
+
+	return result
+}
+
+// annotate writes the given analytics to the given graph as node attributes.
+func annotate(g *graph.Graph, result *Result) {
+	g.DeclareNodeAttribute(graph.AttributeDef{Key: AttributeInDegree, Title: "In-degree", Type: graph.AttributeInteger, Default: 0})
+	g.DeclareNodeAttribute(graph.AttributeDef{Key: AttributeOutDegree, Title: "Out-degree", Type: graph.AttributeInteger, Default: 0})
+	g.DeclareNodeAttribute(graph.AttributeDef{Key: AttributePageRank, Title: "PageRank", Type: graph.AttributeDouble, Default: 0.0})
+	g.DeclareNodeAttribute(graph.AttributeDef{Key: AttributeBetweenness, Title: "Betweenness centrality", Type: graph.AttributeDouble, Default: 0.0})
+	g.DeclareNodeAttribute(graph.AttributeDef{Key: AttributeComponent, Title: "Connected component", Type: graph.AttributeInteger, Default: 0})
+	g.DeclareNodeAttribute(graph.AttributeDef{Key: AttributeCommunity, Title: "Community", Type: graph.AttributeInteger, Default: 0})
+	for id, scores := range result.Scores {
+		g.SetNodeAttribute(id, AttributeInDegree, scores.InDegree)
+		g.SetNodeAttribute(id, AttributeOutDegree, scores.OutDegree)
+		g.SetNodeAttribute(id, AttributePageRank, scores.PageRank)
+		g.SetNodeAttribute(id, AttributeBetweenness, scores.Betweenness)
+		g.SetNodeAttribute(id, AttributeComponent, scores.Component)
+		g.SetNodeAttribute(id, AttributeCommunity, scores.Community)
+	}
+}
+
+// pageRank returns the PageRank of each node, found by power iteration. The rank of nodes without outgoing edges is
+// spread evenly over all nodes.
+func (a *adjacency) pageRank() []float64 {
+	n := len(a.ids)
+	rank := make([]float64, n)
+	if n == 0 {
+		return rank
+	}
+	for i := range rank {
+		rank[i] = 1 / float64(n)
+	}
+
+	next := make([]float64, n)
+	for iteration := 0; iteration < pageRankIterations; iteration++ {
+		dangling := 0.0
+		for i := range a.ids {
+			if len(a.out[i]) == 0 {
+				dangling += rank[i]
+			}
+		}
+		base := (1-pageRankDamping)/float64(n) + pageRankDamping*dangling/float64(n)
+		for i := range next {
+			next[i] = base
+		}
+		for i, targets := range a.out {
+			share := pageRankDamping * rank[i] / float64(len(targets))
+			for _, target := range targets {
+				next[target] += share
+			}
+		}
+
+		change := 0.0
+		for i := range rank {
+			change += math.Abs(next[i] - rank[i])
+		}
+		rank, next = next, rank
+		if change < pageRankTolerance {
+			break
+		}
+	}
+
+	return rank
+}
+
+// betweenness returns the normalized betweenness centrality of each node, using Brandes' algorithm over unweighted,
+// directed edges. Large graphs are estimated from a sample of source nodes.
+func (a *adjacency) betweenness() []float64 {
+	n := len(a.ids)
+	centrality := make([]float64, n)
+	if n < 3 {
+		return centrality
+	}
+
+	// Choose the source nodes
+	sources := make([]int, 0, min(n, maxBetweennessSources))
+	step := 1.0
+	if n > maxBetweennessSources {
+		step = float64(n) / float64(maxBetweennessSources)
+	}
+	for s := 0.0; int(s) < n && len(sources) < maxBetweennessSources; s += step {
+		sources = append(sources, int(s))
+	}
+
+	sigma := make([]float64, n)
+	distance := make([]int, n)
+	delta := make([]float64, n)
+	predecessors := make([][]int, n)
+	stack := make([]int, 0, n)
+	queue := make([]int, 0, n)
+	for _, s := range sources {
+		// Count the shortest paths from the source with a breadth-first search
+		for i := range sigma {
+			sigma[i] = 0
+			distance[i] = -1
+			delta[i] = 0
+			predecessors[i] = predecessors[i][:0]
+		}
+		sigma[s] = 1
+		distance[s] = 0
+		stack = stack[:0]
+		queue = append(queue[:0], s)
+		for len(queue) > 0 {
+			v := queue[0]
+			queue = queue[1:]
+			stack = append(stack, v)
+			for _, w := range a.out[v] {
+				if distance[w] < 0 {
+					distance[w] = distance[v] + 1
+					queue = append(queue, w)
+				}
+				if distance[w] == distance[v]+1 {
+					sigma[w] += sigma[v]
+					predecessors[w] = append(predecessors[w], v)
+				}
+			}
+		}
+
+		// Accumulate the dependencies of the source on each node, furthest first
+		for i := len(stack) - 1; i >= 0; i-- {
+			w := stack[i]
+			for _, v := range predecessors[w] {
+				delta[v] += sigma[v] / sigma[w] * (1 + delta[w])
+			}
+			if w != s {
+				centrality[w] += delta[w]
+			}
+		}
+	}
+
+	// Scale sampled scores up to the full graph, then normalize by the number of ordered pairs of other nodes
+	scale := float64(n) / float64(len(sources)) / float64((n-1)*(n-2))
+	for i := range centrality {
+		centrality[i] *= scale
+	}
+
+	return centrality
+}
+
+// components returns the index of the weakly connected component of each node, numbered from the largest component
+// down, and the number of components.
+func (a *adjacency) components() ([]int, int) {
+	n := len(a.ids)
+	parent := make([]int, n)
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		for parent[i] != i {
+			parent[i] = parent[parent[i]]
+			i = parent[i]
+		}
+		return i
+	}
+	for source, targets := range a.out {
+		for _, target := range targets {
+			if rootSource, rootTarget := find(source), find(target); rootSource != rootTarget {
+				parent[rootTarget] = rootSource
+			}
+		}
+	}
+
+	labels := make([]int, n)
+	for i := range labels {
+		labels[i] = find(i)
+	}
+
+	return renumberBySize(labels)
+}
+
+// renumberBySize renumbers the given labels from 0, with the most common label first (ties are broken by the first
+// node with the label), and returns the new labels and the number of distinct labels.
+func renumberBySize(labels []int) ([]int, int) {
+	sizes := make(map[int]int)
+	first := make(map[int]int)
+	for i, label := range labels {
+		if _, ok := sizes[label]; !ok {
+			first[label] = i
+		}
+		sizes[label]++
+	}
+	order := make([]int, 0, len(sizes))
+	for label := range sizes {
+		order = append(order, label)
+	}
+	sort.Slice(order, func(i, j int) bool {
+		if sizes[order[i]] != sizes[order[j]] {
+			return sizes[order[i]] > sizes[order[j]]
+		}
+		return first[order[i]] < first[order[j]]
+	})
+	newLabels := make(map[int]int, len(order))
+	for i, label := range order {
+		newLabels[label] = i
+	}
+
+	renumbered := make([]int, len(labels))
+	for i, label := range labels {
+		renumbered[i] = newLabels[label]
+	}
+
+	return renumbered, len(order)
+}
@@ -0,0 +1,93 @@
+package analytics
+
+import (
+	"math"
+	"testing"
+
+	"github.com/TheHackerDev/cartograph/internal/shared/datatypes/graph"
+)
+
+func TestCompute(t *testing.T) {
+	// Two triangles of sites joined through a single CDN, plus a separate pair
+	g := graph.NewGraph("test", "test")
+	for _, edge := range [][2]string{
+		{"a.example", "b.example"}, {"b.example", "c.example"}, {"c.example", "a.example"},
+		{"x.example", "y.example"}, {"y.example", "z.example"}, {"z.example", "x.example"},
+		{"a.example", "cdn.example"}, {"x.example", "cdn.example"},
+		{"cdn.example", "a.example"}, {"cdn.example", "x.example"},
+		{"lonely.example", "friend.example"},
+	} {
+		g.AddEdge(edge[0], edge[1])
+	}
+
+	result := Compute(g)
+
+	total := 0.0
+	for _, scores := range result.Scores {
+		total += scores.PageRank
+	}
+	if math.Abs(total-1) > 1e-6 {
+		t.Errorf("PageRank scores sum to %f, want 1", total)
+	}
+
+	// The CDN is the only link between the triangles
+	for id, scores := range result.Scores {
+		if id != "cdn.example" && scores.Betweenness >= result.Scores["cdn.example"].Betweenness {
+			t.Errorf("betweenness of %s = %f, want less than the CDN's %f", id, scores.Betweenness, result.Scores["cdn.example"].Betweenness)
+		}
+	}
+	if cdn := result.Scores["cdn.example"]; cdn.InDegree != 2 || cdn.OutDegree != 2 {
+		t.Errorf("CDN degree = %d in, %d out; want 2 and 2", cdn.InDegree, cdn.OutDegree)
+	}
+
+	if result.Components != 2 || result.Scores["a.example"].Component != 0 || result.Scores["lonely.example"].Component != 1 {
+		t.Errorf("components = %d, with a in %d and lonely in %d; want 2, 0 and 1", result.Components, result.Scores["a.example"].Component, result.Scores["lonely.example"].Component)
+	}
+
+	if result.Scores["a.example"].Community != result.Scores["b.example"].Community || result.Scores["a.example"].Community == result.Scores["y.example"].Community {
+		t.Errorf("communities = %+v, want each triangle in its own community", result.Scores)
+	}
+	if result.Communities < 3 || result.Modularity <= 0 {
+		t.Errorf("found %d communities with modularity %f, want at least 3 with positive modularity", result.Communities, result.Modularity)
+	}
+}
+
+func TestAnnotate(t *testing.T) {
+	g := graph.NewGraph("test", "test")
+	g.AddEdge("a", "b")
+	Annotate(g)
+
+	for _, node := range g.Nodes() {
+		if _, ok := node.Attributes[AttributePageRank]; !ok {
+			t.Errorf("node %s has no %s attribute", node.ID, AttributePageRank)
+		}
+	}
+}
+
+func TestCache(t *testing.T) {
+	cache := NewCache(1)
+
+	// The same graph built in a different order shares the cached result
+	first := graph.NewGraph("test", "test")
+	first.AddEdge("a", "b")
+	first.AddEdge("b", "c")
+	second := graph.NewGraph("test", "test")
+	second.AddEdge("b", "c")
+	second.AddEdge("a", "b")
+	result := cache.Compute(first)
+	if cache.Annotate(second) != result {
+		t.Error("Annotate() of the same graph did not return the cached result")
+	}
+	if _, ok := second.Nodes()[0].Attributes[AttributePageRank]; !ok {
+		t.Errorf("node %s has no %s attribute", second.Nodes()[0].ID, AttributePageRank)
+	}
+
+	// A changed graph is computed again, replacing the oldest result
+	first.AddEdge("c", "a")
+	if changed := cache.Compute(first); changed == result || changed.Scores["c"].OutDegree != 1 {
+		t.Errorf("Compute() of a changed graph = %+v, want a new result", changed)
+	}
+	if len(cache.results) != 1 {
+		t.Errorf("cache holds %d results, want 1", len(cache.results))
+	}
+}
@@ -0,0 +1,92 @@
+package analytics
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"sync"
+
+	"github.com/TheHackerDev/cartograph/internal/shared/datatypes/graph"
+)
+
+// Cache holds the analytics of the most recently analysed graphs, keyed by their nodes and edges, so that repeated
+// requests for the same graph share a single computation. It is safe for concurrent use.
+// It should be created via the NewCache function.
+type Cache struct {
+	mu sync.Mutex
+
+	// size is the maximum number of results held.
+	size int
+
+	// results holds the analytics of each graph, by graph fingerprint.
+	results map[[sha256.Size]byte]*Result
+
+	// keys holds the fingerprints of the graphs in results, oldest first.
+	keys [][sha256.Size]byte
+}
+
+// NewCache returns a new cache holding the analytics of up to the given number of graphs.
+func NewCache(size int) *Cache {
+	return &Cache{
+		size:    size,
+		results: make(map[[sha256.Size]byte]*Result, size),
+	}
+}
+
+// Compute returns the analytics for every node in the given graph, computing them only if the same graph isn't
+// already in the cache. The result is shared, and must not be modified.
+func (c *Cache) Compute(g *graph.Graph) *Result {
+	a := newAdjacency(g)
+	key := a.fingerprint()
+
+	c.mu.Lock()
+	result, ok := c.results[key]
+	c.mu.Unlock()
+	if ok {
+		return result
+	}
+
+	result = a.compute()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok = c.results[key]; !ok {
+		if len(c.keys) >= c.size {
+			delete(c.results, c.keys[0])
+			c.keys = c.keys[1:]
+		}
+		c.results[key] = result
+		c.keys = append(c.keys, key)
+	}
+
+	return result
+}
+
+// Annotate returns the analytics for the given graph, as with Compute, and writes them to it as node attributes.
+func (c *Cache) Annotate(g *graph.Graph) *Result {
+	result := c.Compute(g)
+	annotate(g, result)
+
+	return result
+}
+
+// fingerprint returns a hash of the graph's nodes and edges, which is the same for every graph with the same
+// analytics.
+func (a *adjacency) fingerprint() [sha256.Size]byte {
+	hash := sha256.New()
+	buf := make([]byte, 0, binary.MaxVarintLen64)
+	for _, id := range a.ids {
+		hash.Write(binary.AppendUvarint(buf[:0], uint64(len(id))))
+		hash.Write([]byte(id))
+	}
+	for _, targets := range a.out {
+		hash.Write(binary.AppendUvarint(buf[:0], uint64(len(targets))))
+		for _, target := range targets {
+			hash.Write(binary.AppendUvarint(buf[:0], uint64(target)))
+		}
+	}
+
+	var sum [sha256.Size]byte
+	hash.Sum(sum[:0])
+
+	return sum
+}
@@ -0,0 +1,197 @@
+package analytics
+
+import (
+	"sort"
+)
+
+// louvainMinGain is the smallest modularity gain that moves a node to another community, so that rounding errors do
+// not move nodes back and forth.
+const louvainMinGain float64 = 1e-12
+
+// weightedEdge is an edge in an undirected, weighted graph.
+type weightedEdge struct {
+	node   int
+	weight float64
+}
+
+// weightedGraph is an undirected, weighted graph, as a list of edges for each node sorted by neighbour. Each edge
+// appears in the lists of both of its nodes, and self loops appear once with their weight counted twice.
+type weightedGraph [][]weightedEdge
+
+// louvain returns the community of each node found with the Louvain method, treating edges as undirected, along
+// with the number of communities and their modularity. Communities are numbered from the largest down.
+func (a *adjacency) louvain() ([]int, int, float64) {
+	n := len(a.ids)
+
+	// Build the undirected graph, where edges in both directions between two nodes have a weight of 2
+	weights := make([]map[int]float64, n)
+	for i := range weights {
+		weights[i] = make(map[int]float64)
+	}
+	for source, targets := range a.out {
+		for _, target := range targets {
+			weights[source][target]++
+			weights[target][source]++
+		}
+	}
+	original := newWeightedGraph(weights)
+
+	// Move nodes between communities, then merge each community into a single node, until nothing moves
+	membership := make([]int, n)
+	for i := range membership {
+		membership[i] = i
+	}
+	current := original
+	for {
+		communities, count, moved := current.localMoves()
+		if !moved {
+			break
+		}
+		for i := range membership {
+			membership[i] = communities[membership[i]]
+		}
+		current = current.aggregate(communities, count)
+	}
+
+	labels, count := renumberBySize(membership)
+
+	return labels, count, original.modularity(labels)
+}
+
+// newWeightedGraph returns the weighted graph with the given edge weights for each node.
+func newWeightedGraph(weights []map[int]float64) weightedGraph {
+	g := make(weightedGraph, len(weights))
+	for i, neighbours := range weights {
+		g[i] = make([]weightedEdge, 0, len(neighbours))
+		for node, weight := range neighbours {
+			g[i] = append(g[i], weightedEdge{node: node, weight: weight})
+		}
+		sort.Slice(g[i], func(x, y int) bool {
+			return g[i][x].node < g[i][y].node
+		})
+	}
+
+	return g
+}
+
+// degrees returns the weighted degree of each node, and twice the total edge weight of the graph.
+func (g weightedGraph) degrees() ([]float64, float64) {
+	degrees := make([]float64, len(g))
+	total := 0.0
+	for i, edges := range g {
+		for _, edge := range edges {
+			degrees[i] += edge.weight
+		}
+		total += degrees[i]
+	}
+
+	return degrees, total
+}
+
+// localMoves runs the first phase of the Louvain method: each node is moved to the neighbouring community that gives
+// the largest gain in modularity, until no node moves. It returns the community of each node, numbered from 0 in
+// order of first appearance, the number of communities, and whether any node moved.
+func (g weightedGraph) localMoves() ([]int, int, bool) {
+	n := len(g)
+	community := make([]int, n)
+	for i := range community {
+		community[i] = i
+	}
+
+	degrees, total := g.degrees()
+	if total == 0 {
+		return community, n, false
+	}
+	communityDegree := append([]float64(nil), degrees...)
+
+	moved := false
+	linkWeights := make(map[int]float64)
+	for changed := true; changed; {
+		changed = false
+		for i := 0; i < n; i++ {
+			// Sum the weights of the links from the node to each neighbouring community
+			clear(linkWeights)
+			neighbourCommunities := make([]int, 0, len(g[i]))
+			for _, edge := range g[i] {
+				if edge.node == i {
+					continue
+				}
+				c := community[edge.node]
+				if _, ok := linkWeights[c]; !ok {
+					neighbourCommunities = append(neighbourCommunities, c)
+				}
+				linkWeights[c] += edge.weight
+			}
+			sort.Ints(neighbourCommunities)
+
+			// Take the node out of its community, then find the best community to put it in
+			own := community[i]
+			communityDegree[own] -= degrees[i]
+			best, bestGain := own, linkWeights[own]-communityDegree[own]*degrees[i]/total
+			for _, c := range neighbourCommunities {
+				if gain := linkWeights[c] - communityDegree[c]*degrees[i]/total; gain > bestGain+louvainMinGain {
+					best, bestGain = c, gain
+				}
+			}
+			communityDegree[best] += degrees[i]
+			if best != own {
+				community[i] = best
+				changed = true
+				moved = true
+			}
+		}
+	}
+
+	// Number the communities from 0
+	numbers := make(map[int]int)
+	for i, c := range community {
+		if _, ok := numbers[c]; !ok {
+			numbers[c] = len(numbers)
+		}
+		community[i] = numbers[c]
+	}
+
+	return community, len(numbers), moved
+}
+
+// aggregate runs the second phase of the Louvain method, returning a new graph with one node for each of the given
+// communities. Links between communities are merged, and links within a community become self loops.
+func (g weightedGraph) aggregate(community []int, count int) weightedGraph {
+	weights := make([]map[int]float64, count)
+	for i := range weights {
+		weights[i] = make(map[int]float64)
+	}
+	for i, edges := range g {
+		for _, edge := range edges {
+			weights[community[i]][community[edge.node]] += edge.weight
+		}
+	}
+
+	return newWeightedGraph(weights)
+}
+
+// modularity returns the modularity of the given communities of the graph's nodes.
+func (g weightedGraph) modularity(community []int) float64 {
+	degrees, total := g.degrees()
+	if total == 0 {
+		return 0
+	}
+
+	internal := make(map[int]float64)
+	communityDegree := make(map[int]float64)
+	for i, edges := range g {
+		communityDegree[community[i]] += degrees[i]
+		for _, edge := range edges {
+			if community[edge.node] == community[i] {
+				internal[community[i]] += edge.weight
+			}
+		}
+	}
+
+	q := 0.0
+	for c, degree := range communityDegree {
+		q += internal[c]/total - (degree/total)*(degree/total)
+	}
+
+	return q
+}
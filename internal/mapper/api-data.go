@@ -1,6 +1,7 @@
 package mapper
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -10,9 +11,10 @@ import (
 
 	"github.com/jackc/pgx/v5"
 	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
 	"golang.org/x/sync/errgroup"
 
-	"github.com/TheHackerDev/cartograph/internal/shared/datatypes/gexf"
+	"github.com/TheHackerDev/cartograph/internal/shared/datatypes/graph"
 	internalHttp "github.com/TheHackerDev/cartograph/internal/shared/http"
 )
 
@@ -41,10 +43,14 @@ type Connection struct {
 	URL       string    `json:"url"`
 	FirstSeen time.Time `json:"first_seen"`
 	LastSeen  time.Time `json:"last_seen"`
+
+	// Types are the edge types of the connection, such as "link" or "redirect".
+	Types []string `json:"types"`
 }
 
 // HostsDataAPIHandler handles requests to the mapper data API for all connecting hosts to and from a given URL.
 // Only POST requests are allowed, as we need the source URL data in the request body.
+// Connections can be limited to a time window with the "since", "until" and "as_of" query parameters.
 func (m *Mapper) HostsDataAPIHandler(w http.ResponseWriter, r *http.Request) {
 	// Only allow POST requests (or OPTIONS)
 	if r.Method == http.MethodOptions {
@@ -57,6 +63,13 @@ func (m *Mapper) HostsDataAPIHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Parse the time window from the query string
+	window, windowErr := parseTimeWindow(r.URL.Query(), time.Now())
+	if windowErr != nil {
+		http.Error(w, windowErr.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Attempt to parse the source URL from the request
 	reqBody, bodyCopy, bodyReadErr := internalHttp.ReadBody(r.Body)
 	r.Body = bodyCopy
@@ -71,7 +84,7 @@ func (m *Mapper) HostsDataAPIHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get the host connections data
-	data, getErr := m.getConnectingHosts(&sourceURL)
+	data, getErr := m.getConnectingHosts(&sourceURL, window)
 	if getErr != nil {
 		http.Error(w, fmt.Sprintf("unable to get data for given source URL: %s", getErr.Error()), http.StatusInternalServerError)
 		return
@@ -94,16 +107,16 @@ func (m *Mapper) HostsDataAPIHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// getConnectingHosts gets the data for connections to and from a given source URL.
+// getConnectingHosts gets the data for connections to and from a given source URL, seen within the given time window.
 // The source URL must include a host, but can optionally include a scheme and path.
-func (m *Mapper) getConnectingHosts(sourceURL *SourceURL) (*ConnectionsOutput, error) {
+func (m *Mapper) getConnectingHosts(sourceURL *SourceURL, window timeWindow) (*ConnectionsOutput, error) {
 	eg := new(errgroup.Group)
 
 	// Get the connections to the source URL
 	connectionsTo := new(ConnectionsToFrom)
 	eg.Go(func() error {
 		var getToErr error
-		connectionsTo, getToErr = m.getHostConnectionsTo(sourceURL)
+		connectionsTo, getToErr = m.getHostConnectionsTo(sourceURL, window)
 		if getToErr != nil {
 			return fmt.Errorf("unable to get connections to source URL: %w", getToErr)
 		}
@@ -115,7 +128,7 @@ func (m *Mapper) getConnectingHosts(sourceURL *SourceURL) (*ConnectionsOutput, e
 	connectionsFrom := new(ConnectionsToFrom)
 	eg.Go(func() error {
 		var getFromErr error
-		connectionsFrom, getFromErr = m.getHostConnectionsFrom(sourceURL)
+		connectionsFrom, getFromErr = m.getHostConnectionsFrom(sourceURL, window)
 		if getFromErr != nil {
 			return fmt.Errorf("unable to get connections from source URL: %w", getFromErr)
 		}
@@ -137,7 +150,7 @@ func (m *Mapper) getConnectingHosts(sourceURL *SourceURL) (*ConnectionsOutput, e
 }
 
 // getHostConnectionsTo gets the host data for connections to a given source URL.
-func (m *Mapper) getHostConnectionsTo(sourceURL *SourceURL) (*ConnectionsToFrom, error) {
+func (m *Mapper) getHostConnectionsTo(sourceURL *SourceURL, window timeWindow) (*ConnectionsToFrom, error) {
 	// Check for empty source URL host value first (only required field)
 	if sourceURL.Host == "" {
 		return nil, fmt.Errorf("source URL host is required")
@@ -149,33 +162,33 @@ func (m *Mapper) getHostConnectionsTo(sourceURL *SourceURL) (*ConnectionsToFrom,
 	// data is provided (i.e. combinations of scheme, host, and path)
 	if sourceURL.Scheme != "" && sourceURL.Host != "" && sourceURL.Path != "" {
 		// Source URL scheme, host, and path are provided, use all three in the query
-		sqlSelect := `select distinct referer_host, min(first_seen), max(last_seen) from data_mapper where destination_scheme = $1 and destination_host = $2 and destination_path = $3 group by referer_host order by referer_host;`
+		sqlSelect := `select distinct referer_host, min(first_seen), max(last_seen), array_agg(distinct edge_type order by edge_type) from data_mapper where destination_scheme = $1 and destination_host = $2 and destination_path = $3 and ($4::timestamptz is null or last_seen >= $4) and ($5::timestamptz is null or first_seen <= $5) group by referer_host order by referer_host;`
 		var queryErr error
-		rows, queryErr = m.dbConnPool.Query(context.Background(), sqlSelect, sourceURL.Scheme, sourceURL.Host, sourceURL.Path)
+		rows, queryErr = m.dbConnPool.Query(context.Background(), sqlSelect, sourceURL.Scheme, sourceURL.Host, sourceURL.Path, window.Since, window.Until)
 		if queryErr != nil {
 			return nil, fmt.Errorf("unable to query database: %w", queryErr)
 		}
 	} else if sourceURL.Scheme != "" && sourceURL.Host != "" {
 		// Source URL scheme and host are provided, use both in the query
-		sqlSelect := `select distinct referer_host, min(first_seen), max(last_seen) from data_mapper where destination_scheme = $1 and destination_host = $2 group by referer_host  order by referer_host;`
+		sqlSelect := `select distinct referer_host, min(first_seen), max(last_seen), array_agg(distinct edge_type order by edge_type) from data_mapper where destination_scheme = $1 and destination_host = $2 and ($3::timestamptz is null or last_seen >= $3) and ($4::timestamptz is null or first_seen <= $4) group by referer_host  order by referer_host;`
 		var queryErr error
-		rows, queryErr = m.dbConnPool.Query(context.Background(), sqlSelect, sourceURL.Scheme, sourceURL.Host)
+		rows, queryErr = m.dbConnPool.Query(context.Background(), sqlSelect, sourceURL.Scheme, sourceURL.Host, window.Since, window.Until)
 		if queryErr != nil {
 			return nil, fmt.Errorf("unable to query database: %w", queryErr)
 		}
 	} else if sourceURL.Host != "" && sourceURL.Path != "" {
 		// Source URL host and path are provided, use both in the query
-		sqlSelect := `select distinct referer_host, min(first_seen), max(last_seen) from data_mapper where destination_host = $1 and destination_path = $2 group by referer_host order by referer_host;`
+		sqlSelect := `select distinct referer_host, min(first_seen), max(last_seen), array_agg(distinct edge_type order by edge_type) from data_mapper where destination_host = $1 and destination_path = $2 and ($3::timestamptz is null or last_seen >= $3) and ($4::timestamptz is null or first_seen <= $4) group by referer_host order by referer_host;`
 		var queryErr error
-		rows, queryErr = m.dbConnPool.Query(context.Background(), sqlSelect, sourceURL.Host, sourceURL.Path)
+		rows, queryErr = m.dbConnPool.Query(context.Background(), sqlSelect, sourceURL.Host, sourceURL.Path, window.Since, window.Until)
 		if queryErr != nil {
 			return nil, fmt.Errorf("unable to query database: %w", queryErr)
 		}
 	} else {
 		// Only source URL host is provided, use it in the query
-		sqlSelect := `select distinct referer_host, min(first_seen), max(last_seen) from data_mapper where destination_host = $1 group by referer_host  order by referer_host;`
+		sqlSelect := `select distinct referer_host, min(first_seen), max(last_seen), array_agg(distinct edge_type order by edge_type) from data_mapper where destination_host = $1 and ($2::timestamptz is null or last_seen >= $2) and ($3::timestamptz is null or first_seen <= $3) group by referer_host  order by referer_host;`
 		var queryErr error
-		rows, queryErr = m.dbConnPool.Query(context.Background(), sqlSelect, sourceURL.Host)
+		rows, queryErr = m.dbConnPool.Query(context.Background(), sqlSelect, sourceURL.Host, window.Since, window.Until)
 		if queryErr != nil {
 			return nil, fmt.Errorf("unable to query database: %w", queryErr)
 		}
@@ -196,7 +209,8 @@ func (m *Mapper) getHostConnectionsTo(sourceURL *SourceURL) (*ConnectionsToFrom,
 		var destinationHost string
 		var firstSeen time.Time
 		var lastSeen time.Time
-		if scanErr := rows.Scan(&destinationHost, &firstSeen, &lastSeen); scanErr != nil {
+		var types []string
+		if scanErr := rows.Scan(&destinationHost, &firstSeen, &lastSeen, &types); scanErr != nil {
 			return nil, fmt.Errorf("unable to scan row: %w", scanErr)
 		}
 
@@ -205,6 +219,7 @@ func (m *Mapper) getHostConnectionsTo(sourceURL *SourceURL) (*ConnectionsToFrom,
 			URL:       destinationHost,
 			FirstSeen: firstSeen,
 			LastSeen:  lastSeen,
+			Types:     types,
 		})
 	}
 
@@ -221,7 +236,7 @@ func (m *Mapper) getHostConnectionsTo(sourceURL *SourceURL) (*ConnectionsToFrom,
 }
 
 // getHostConnectionsFrom gets the host data for connections from a given source URL.
-func (m *Mapper) getHostConnectionsFrom(sourceURL *SourceURL) (*ConnectionsToFrom, error) {
+func (m *Mapper) getHostConnectionsFrom(sourceURL *SourceURL, window timeWindow) (*ConnectionsToFrom, error) {
 	// Check for empty source URL host value first (only required field)
 	if sourceURL.Host == "" {
 		return nil, fmt.Errorf("source URL host is required")
@@ -233,33 +248,33 @@ func (m *Mapper) getHostConnectionsFrom(sourceURL *SourceURL) (*ConnectionsToFro
 	// data is provided (i.e. combinations of scheme, host, and path, with host being the only required value).
 	if sourceURL.Scheme != "" && sourceURL.Host != "" && sourceURL.Path != "" {
 		// Source URL scheme, host, and path are provided, use all three in the query
-		sqlSelect := `select distinct destination_host, min(first_seen), max(last_seen) from data_mapper where referer_scheme = $1 and referer_host = $2 and referer_path = $3 group by destination_host order by destination_host;`
+		sqlSelect := `select distinct destination_host, min(first_seen), max(last_seen), array_agg(distinct edge_type order by edge_type) from data_mapper where referer_scheme = $1 and referer_host = $2 and referer_path = $3 and ($4::timestamptz is null or last_seen >= $4) and ($5::timestamptz is null or first_seen <= $5) group by destination_host order by destination_host;`
 		var queryErr error
-		rows, queryErr = m.dbConnPool.Query(context.Background(), sqlSelect, sourceURL.Scheme, sourceURL.Host, sourceURL.Path)
+		rows, queryErr = m.dbConnPool.Query(context.Background(), sqlSelect, sourceURL.Scheme, sourceURL.Host, sourceURL.Path, window.Since, window.Until)
 		if queryErr != nil {
 			return nil, fmt.Errorf("unable to query database: %w", queryErr)
 		}
 	} else if sourceURL.Scheme != "" && sourceURL.Host != "" {
 		// Source URL scheme and host are provided, use both in the query
-		sqlSelect := `select distinct destination_host, min(first_seen), max(last_seen) from data_mapper where referer_scheme = $1 and referer_host = $2 group by destination_host order by destination_host;`
+		sqlSelect := `select distinct destination_host, min(first_seen), max(last_seen), array_agg(distinct edge_type order by edge_type) from data_mapper where referer_scheme = $1 and referer_host = $2 and ($3::timestamptz is null or last_seen >= $3) and ($4::timestamptz is null or first_seen <= $4) group by destination_host order by destination_host;`
 		var queryErr error
-		rows, queryErr = m.dbConnPool.Query(context.Background(), sqlSelect, sourceURL.Scheme, sourceURL.Host)
+		rows, queryErr = m.dbConnPool.Query(context.Background(), sqlSelect, sourceURL.Scheme, sourceURL.Host, window.Since, window.Until)
 		if queryErr != nil {
 			return nil, fmt.Errorf("unable to query database: %w", queryErr)
 		}
 	} else if sourceURL.Host != "" && sourceURL.Path != "" {
 		// Source URL host and path are provided, use both in the query
-		sqlSelect := `select distinct destination_host, min(first_seen), max(last_seen) from data_mapper where referer_host = $1 and referer_path = $2 group by destination_host order by destination_host;`
+		sqlSelect := `select distinct destination_host, min(first_seen), max(last_seen), array_agg(distinct edge_type order by edge_type) from data_mapper where referer_host = $1 and referer_path = $2 and ($3::timestamptz is null or last_seen >= $3) and ($4::timestamptz is null or first_seen <= $4) group by destination_host order by destination_host;`
 		var queryErr error
-		rows, queryErr = m.dbConnPool.Query(context.Background(), sqlSelect, sourceURL.Host, sourceURL.Path)
+		rows, queryErr = m.dbConnPool.Query(context.Background(), sqlSelect, sourceURL.Host, sourceURL.Path, window.Since, window.Until)
 		if queryErr != nil {
 			return nil, fmt.Errorf("unable to query database: %w", queryErr)
 		}
 	} else {
 		// Only source URL host is provided, use it in the query
-		sqlSelect := `select distinct destination_host, min(first_seen), max(last_seen) from data_mapper where referer_host = $1 group by destination_host order by destination_host;`
+		sqlSelect := `select distinct destination_host, min(first_seen), max(last_seen), array_agg(distinct edge_type order by edge_type) from data_mapper where referer_host = $1 and ($2::timestamptz is null or last_seen >= $2) and ($3::timestamptz is null or first_seen <= $3) group by destination_host order by destination_host;`
 		var queryErr error
-		rows, queryErr = m.dbConnPool.Query(context.Background(), sqlSelect, sourceURL.Host)
+		rows, queryErr = m.dbConnPool.Query(context.Background(), sqlSelect, sourceURL.Host, window.Since, window.Until)
 		if queryErr != nil {
 			return nil, fmt.Errorf("unable to query database: %w", queryErr)
 		}
@@ -280,7 +295,8 @@ func (m *Mapper) getHostConnectionsFrom(sourceURL *SourceURL) (*ConnectionsToFro
 		var destinationHost string
 		var firstSeen time.Time
 		var lastSeen time.Time
-		if scanErr := rows.Scan(&destinationHost, &firstSeen, &lastSeen); scanErr != nil {
+		var types []string
+		if scanErr := rows.Scan(&destinationHost, &firstSeen, &lastSeen, &types); scanErr != nil {
 			return nil, fmt.Errorf("unable to scan row: %w", scanErr)
 		}
 
@@ -289,6 +305,7 @@ func (m *Mapper) getHostConnectionsFrom(sourceURL *SourceURL) (*ConnectionsToFro
 			URL:       destinationHost,
 			FirstSeen: firstSeen,
 			LastSeen:  lastSeen,
+			Types:     types,
 		})
 	}
 
@@ -307,6 +324,7 @@ func (m *Mapper) getHostConnectionsFrom(sourceURL *SourceURL) (*ConnectionsToFro
 // PathsDataAPIHandler handles requests to the mapper data API for all connecting paths (full URL,
 // including scheme, host, and path) to and from a given URL.
 // Only POST requests are allowed, as we need the source URL data in the request body.
+// Connections can be limited to a time window with the "since", "until" and "as_of" query parameters.
 func (m *Mapper) PathsDataAPIHandler(w http.ResponseWriter, r *http.Request) {
 	// Only allow POST requests (or OPTIONS)
 	if r.Method == http.MethodOptions {
@@ -318,6 +336,13 @@ func (m *Mapper) PathsDataAPIHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Parse the time window from the query string
+	window, windowErr := parseTimeWindow(r.URL.Query(), time.Now())
+	if windowErr != nil {
+		http.Error(w, windowErr.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Attempt to parse the source URL from the request
 	reqBody, bodyCopy, bodyReadErr := internalHttp.ReadBody(r.Body)
 	r.Body = bodyCopy
@@ -332,7 +357,7 @@ func (m *Mapper) PathsDataAPIHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get the paths connections data from the database
-	pathsData, pathsDataErr := m.getConnectingPaths(&sourceURL)
+	pathsData, pathsDataErr := m.getConnectingPaths(&sourceURL, window)
 	if pathsDataErr != nil {
 		http.Error(w, fmt.Sprintf("unable to get paths connections data: %s", pathsDataErr.Error()), http.StatusInternalServerError)
 		return
@@ -346,16 +371,17 @@ func (m *Mapper) PathsDataAPIHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// getConnectingPasts gets the paths data for connections from a given source URL.
+// getConnectingPaths gets the paths data for connections to and from a given source URL, seen within the given time
+// window.
 // The source URL must include a host, but can optionally include a scheme and path.
-func (m *Mapper) getConnectingPaths(sourceURL *SourceURL) (*ConnectionsOutput, error) {
+func (m *Mapper) getConnectingPaths(sourceURL *SourceURL, window timeWindow) (*ConnectionsOutput, error) {
 	eg := new(errgroup.Group)
 
 	// Get the connections to the source URL
 	connectionsTo := new(ConnectionsToFrom)
 	eg.Go(func() error {
 		var err error
-		connectionsTo, err = m.getPathConnectionsTo(sourceURL)
+		connectionsTo, err = m.getPathConnectionsTo(sourceURL, window)
 		if err != nil {
 			return fmt.Errorf("unable to get connections to source URL: %w", err)
 		}
@@ -367,7 +393,7 @@ func (m *Mapper) getConnectingPaths(sourceURL *SourceURL) (*ConnectionsOutput, e
 	connectionsFrom := new(ConnectionsToFrom)
 	eg.Go(func() error {
 		var err error
-		connectionsFrom, err = m.getPathConnectionsFrom(sourceURL)
+		connectionsFrom, err = m.getPathConnectionsFrom(sourceURL, window)
 		if err != nil {
 			return fmt.Errorf("unable to get connections from source URL: %w", err)
 		}
@@ -390,7 +416,7 @@ func (m *Mapper) getConnectingPaths(sourceURL *SourceURL) (*ConnectionsOutput, e
 
 // getPathConnectionsTo gets the paths data for connections to a given source URL.
 // The source URL must include a host, but can optionally include a scheme and path.
-func (m *Mapper) getPathConnectionsTo(sourceURL *SourceURL) (*ConnectionsToFrom, error) {
+func (m *Mapper) getPathConnectionsTo(sourceURL *SourceURL, window timeWindow) (*ConnectionsToFrom, error) {
 	// Check for empty source URL host value first (only required field)
 	if sourceURL.Host == "" {
 		return nil, fmt.Errorf("source URL host is required")
@@ -400,33 +426,33 @@ func (m *Mapper) getPathConnectionsTo(sourceURL *SourceURL) (*ConnectionsToFrom,
 	var rows pgx.Rows
 	if sourceURL.Scheme != "" && sourceURL.Host != "" && sourceURL.Path != "" {
 		// Source URL scheme, host and path are provided, use all in the query
-		sqlSelect := `select distinct referer_scheme || '://' || referer_host || referer_path as referer_url, min(first_seen), max(last_seen) from data_mapper where destination_scheme = $1 and destination_host = $2 and destination_path = $3 and referer_host != '' group by referer_scheme, referer_host, referer_path order by referer_url;`
+		sqlSelect := `select distinct referer_scheme || '://' || referer_host || referer_path as referer_url, min(first_seen), max(last_seen), array_agg(distinct edge_type order by edge_type) from data_mapper where destination_scheme = $1 and destination_host = $2 and destination_path = $3 and referer_host != '' and ($4::timestamptz is null or last_seen >= $4) and ($5::timestamptz is null or first_seen <= $5) group by referer_scheme, referer_host, referer_path order by referer_url;`
 		var queryErr error
-		rows, queryErr = m.dbConnPool.Query(context.Background(), sqlSelect, sourceURL.Scheme, sourceURL.Host, sourceURL.Path)
+		rows, queryErr = m.dbConnPool.Query(context.Background(), sqlSelect, sourceURL.Scheme, sourceURL.Host, sourceURL.Path, window.Since, window.Until)
 		if queryErr != nil {
 			return nil, fmt.Errorf("unable to query database: %w", queryErr)
 		}
 	} else if sourceURL.Scheme != "" && sourceURL.Host != "" {
 		// Source URL scheme and host are provided, use both in the query
-		sqlSelect := `select distinct referer_scheme || '://' || referer_host || referer_path as referer_url, min(first_seen), max(last_seen) from data_mapper where destination_scheme = $1 and destination_host = $2 and referer_host != '' group by referer_scheme, referer_host, referer_path order by referer_url;`
+		sqlSelect := `select distinct referer_scheme || '://' || referer_host || referer_path as referer_url, min(first_seen), max(last_seen), array_agg(distinct edge_type order by edge_type) from data_mapper where destination_scheme = $1 and destination_host = $2 and referer_host != '' and ($3::timestamptz is null or last_seen >= $3) and ($4::timestamptz is null or first_seen <= $4) group by referer_scheme, referer_host, referer_path order by referer_url;`
 		var queryErr error
-		rows, queryErr = m.dbConnPool.Query(context.Background(), sqlSelect, sourceURL.Scheme, sourceURL.Host)
+		rows, queryErr = m.dbConnPool.Query(context.Background(), sqlSelect, sourceURL.Scheme, sourceURL.Host, window.Since, window.Until)
 		if queryErr != nil {
 			return nil, fmt.Errorf("unable to query database: %w", queryErr)
 		}
 	} else if sourceURL.Host != "" && sourceURL.Path != "" {
 		// Source URL host and path are provided, use both in the query
-		sqlSelect := `select distinct referer_scheme || '://' || referer_host || referer_path as referer_url, min(first_seen), max(last_seen) from data_mapper where destination_host = $1 and destination_path = $2 and referer_host != '' group by referer_scheme, referer_host, referer_path order by referer_url;`
+		sqlSelect := `select distinct referer_scheme || '://' || referer_host || referer_path as referer_url, min(first_seen), max(last_seen), array_agg(distinct edge_type order by edge_type) from data_mapper where destination_host = $1 and destination_path = $2 and referer_host != '' and ($3::timestamptz is null or last_seen >= $3) and ($4::timestamptz is null or first_seen <= $4) group by referer_scheme, referer_host, referer_path order by referer_url;`
 		var queryErr error
-		rows, queryErr = m.dbConnPool.Query(context.Background(), sqlSelect, sourceURL.Host, sourceURL.Path)
+		rows, queryErr = m.dbConnPool.Query(context.Background(), sqlSelect, sourceURL.Host, sourceURL.Path, window.Since, window.Until)
 		if queryErr != nil {
 			return nil, fmt.Errorf("unable to query database: %w", queryErr)
 		}
 	} else {
 		// Source URL host is provided, use only host in the query
-		sqlSelect := `select distinct referer_scheme || '://' || referer_host || referer_path as referer_url, min(first_seen), max(last_seen) from data_mapper where destination_host = $1 and referer_host != '' group by referer_scheme, referer_host, referer_path order by referer_url;`
+		sqlSelect := `select distinct referer_scheme || '://' || referer_host || referer_path as referer_url, min(first_seen), max(last_seen), array_agg(distinct edge_type order by edge_type) from data_mapper where destination_host = $1 and referer_host != '' and ($2::timestamptz is null or last_seen >= $2) and ($3::timestamptz is null or first_seen <= $3) group by referer_scheme, referer_host, referer_path order by referer_url;`
 		var queryErr error
-		rows, queryErr = m.dbConnPool.Query(context.Background(), sqlSelect, sourceURL.Host)
+		rows, queryErr = m.dbConnPool.Query(context.Background(), sqlSelect, sourceURL.Host, window.Since, window.Until)
 		if queryErr != nil {
 			return nil, fmt.Errorf("unable to query database: %w", queryErr)
 		}
@@ -446,7 +472,8 @@ func (m *Mapper) getPathConnectionsTo(sourceURL *SourceURL) (*ConnectionsToFrom,
 		var refererURL string
 		var firstSeen time.Time
 		var lastSeen time.Time
-		if scanErr := rows.Scan(&refererURL, &firstSeen, &lastSeen); scanErr != nil {
+		var types []string
+		if scanErr := rows.Scan(&refererURL, &firstSeen, &lastSeen, &types); scanErr != nil {
 			return nil, fmt.Errorf("unable to scan row: %w", scanErr)
 		}
 
@@ -455,6 +482,7 @@ func (m *Mapper) getPathConnectionsTo(sourceURL *SourceURL) (*ConnectionsToFrom,
 			URL:       refererURL,
 			FirstSeen: firstSeen,
 			LastSeen:  lastSeen,
+			Types:     types,
 		})
 	}
 
@@ -472,7 +500,7 @@ func (m *Mapper) getPathConnectionsTo(sourceURL *SourceURL) (*ConnectionsToFrom,
 
 // getPathConnectionsFrom gets the paths data for connections from a given source URL.
 // The source URL must include a host, but can optionally include a scheme and path.
-func (m *Mapper) getPathConnectionsFrom(sourceURL *SourceURL) (*ConnectionsToFrom, error) {
+func (m *Mapper) getPathConnectionsFrom(sourceURL *SourceURL, window timeWindow) (*ConnectionsToFrom, error) {
 	// Check for empty source URL host value first (only required field)
 	if sourceURL.Host == "" {
 		return nil, fmt.Errorf("source URL host is required")
@@ -482,33 +510,33 @@ func (m *Mapper) getPathConnectionsFrom(sourceURL *SourceURL) (*ConnectionsToFro
 	var rows pgx.Rows
 	if sourceURL.Scheme != "" && sourceURL.Host != "" && sourceURL.Path != "" {
 		// Source URL scheme, host and path are provided, use all in the query
-		sqlSelect := `select distinct destination_scheme || '://' || destination_host || destination_path as destination_url, min(first_seen), max(last_seen) from data_mapper where referer_scheme = $1 and referer_host = $2 and referer_path = $3 group by destination_scheme, destination_host, destination_path order by destination_url;`
+		sqlSelect := `select distinct destination_scheme || '://' || destination_host || destination_path as destination_url, min(first_seen), max(last_seen), array_agg(distinct edge_type order by edge_type) from data_mapper where referer_scheme = $1 and referer_host = $2 and referer_path = $3 and ($4::timestamptz is null or last_seen >= $4) and ($5::timestamptz is null or first_seen <= $5) group by destination_scheme, destination_host, destination_path order by destination_url;`
 		var queryErr error
-		rows, queryErr = m.dbConnPool.Query(context.Background(), sqlSelect, sourceURL.Scheme, sourceURL.Host, sourceURL.Path)
+		rows, queryErr = m.dbConnPool.Query(context.Background(), sqlSelect, sourceURL.Scheme, sourceURL.Host, sourceURL.Path, window.Since, window.Until)
 		if queryErr != nil {
 			return nil, fmt.Errorf("unable to query database: %w", queryErr)
 		}
 	} else if sourceURL.Scheme != "" && sourceURL.Host != "" {
 		// Source URL scheme and host are provided, use both in the query
-		sqlSelect := `select distinct destination_scheme || '://' || destination_host || destination_path as destination_url, min(first_seen), max(last_seen) from data_mapper where referer_scheme = $1 and referer_host = $2 group by destination_scheme, destination_host, destination_path order by destination_url;`
+		sqlSelect := `select distinct destination_scheme || '://' || destination_host || destination_path as destination_url, min(first_seen), max(last_seen), array_agg(distinct edge_type order by edge_type) from data_mapper where referer_scheme = $1 and referer_host = $2 and ($3::timestamptz is null or last_seen >= $3) and ($4::timestamptz is null or first_seen <= $4) group by destination_scheme, destination_host, destination_path order by destination_url;`
 		var queryErr error
-		rows, queryErr = m.dbConnPool.Query(context.Background(), sqlSelect, sourceURL.Scheme, sourceURL.Host)
+		rows, queryErr = m.dbConnPool.Query(context.Background(), sqlSelect, sourceURL.Scheme, sourceURL.Host, window.Since, window.Until)
 		if queryErr != nil {
 			return nil, fmt.Errorf("unable to query database: %w", queryErr)
 		}
 	} else if sourceURL.Host != "" && sourceURL.Path != "" {
 		// Source URL host and path are provided, use both in the query
-		sqlSelect := `select distinct destination_scheme || '://' || destination_host || destination_path as destination_url, min(first_seen), max(last_seen) from data_mapper where referer_host = $1 and referer_path = $2 group by destination_scheme, destination_host, destination_path order by destination_url;`
+		sqlSelect := `select distinct destination_scheme || '://' || destination_host || destination_path as destination_url, min(first_seen), max(last_seen), array_agg(distinct edge_type order by edge_type) from data_mapper where referer_host = $1 and referer_path = $2 and ($3::timestamptz is null or last_seen >= $3) and ($4::timestamptz is null or first_seen <= $4) group by destination_scheme, destination_host, destination_path order by destination_url;`
 		var queryErr error
-		rows, queryErr = m.dbConnPool.Query(context.Background(), sqlSelect, sourceURL.Host, sourceURL.Path)
+		rows, queryErr = m.dbConnPool.Query(context.Background(), sqlSelect, sourceURL.Host, sourceURL.Path, window.Since, window.Until)
 		if queryErr != nil {
 			return nil, fmt.Errorf("unable to query database: %w", queryErr)
 		}
 	} else {
 		// Source URL host is provided, use only host in the query
-		sqlSelect := `select distinct destination_scheme || '://' || destination_host || destination_path as destination_url, min(first_seen), max(last_seen) from data_mapper where referer_host = $1 group by destination_scheme, destination_host, destination_path order by destination_url;`
+		sqlSelect := `select distinct destination_scheme || '://' || destination_host || destination_path as destination_url, min(first_seen), max(last_seen), array_agg(distinct edge_type order by edge_type) from data_mapper where referer_host = $1 and ($2::timestamptz is null or last_seen >= $2) and ($3::timestamptz is null or first_seen <= $3) group by destination_scheme, destination_host, destination_path order by destination_url;`
 		var queryErr error
-		rows, queryErr = m.dbConnPool.Query(context.Background(), sqlSelect, sourceURL.Host)
+		rows, queryErr = m.dbConnPool.Query(context.Background(), sqlSelect, sourceURL.Host, window.Since, window.Until)
 		if queryErr != nil {
 			return nil, fmt.Errorf("unable to query database: %w", queryErr)
 		}
@@ -528,7 +556,8 @@ func (m *Mapper) getPathConnectionsFrom(sourceURL *SourceURL) (*ConnectionsToFro
 		var destinationURL string
 		var firstSeen time.Time
 		var lastSeen time.Time
-		if scanErr := rows.Scan(&destinationURL, &firstSeen, &lastSeen); scanErr != nil {
+		var types []string
+		if scanErr := rows.Scan(&destinationURL, &firstSeen, &lastSeen, &types); scanErr != nil {
 			return nil, fmt.Errorf("unable to scan row: %w", scanErr)
 		}
 
@@ -537,6 +566,7 @@ func (m *Mapper) getPathConnectionsFrom(sourceURL *SourceURL) (*ConnectionsToFro
 			URL:       destinationURL,
 			FirstSeen: firstSeen,
 			LastSeen:  lastSeen,
+			Types:     types,
 		})
 	}
 
@@ -552,9 +582,12 @@ func (m *Mapper) getPathConnectionsFrom(sourceURL *SourceURL) (*ConnectionsToFro
 	}, nil
 }
 
-// AllHostsGexf is an HTTP handler function that returns a GEXF file containing all hosts and their connections
-// to the client.
-func (m *Mapper) AllHostsGexf(w http.ResponseWriter, r *http.Request) {
+// AllHostsGraph is an HTTP handler function that returns a graph file containing all hosts and their connections
+// to the client. The format is chosen by the "format" query parameter or the Accept header, and defaults to GEXF.
+// Hosts can be grouped by registrable domain or organisation with the "group" query parameter.
+// Connections are limited to the time window given by the "since", "until" and "as_of" query parameters, which
+// defaults to the last 30 days.
+func (m *Mapper) AllHostsGraph(w http.ResponseWriter, r *http.Request) {
 	// Only allow GET requests (or OPTIONS)
 	if r.Method == http.MethodOptions {
 		w.WriteHeader(http.StatusNoContent)
@@ -566,57 +599,59 @@ func (m *Mapper) AllHostsGexf(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get all source and destination hosts from the database that were seen no more than 30 days ago
-	sqlSelect := `with all_hosts as (select distinct referer_host as referer, destination_host as destination
-						   from data_mapper
-						   where last_seen > now() - interval '30 days')
-		select referer, destination
-		from all_hosts
-		where referer != ''
-		  and destination != ''
-		  and referer != destination
-		order by referer, destination;`
-	rows, queryErr := m.dbConnPool.Query(r.Context(), sqlSelect)
-	if queryErr != nil {
-		http.Error(w, fmt.Sprintf("problem getting hosts: %s", queryErr), http.StatusInternalServerError)
+	// Choose the output format before doing any work
+	serializer, formatErr := graph.SerializerForRequest(r, graph.FormatGEXF)
+	if formatErr != nil {
+		http.Error(w, formatErr.Error(), graphFormatErrorStatus(r))
 		return
 	}
 
-	// Create the GEXF host map structure
-	gexfHostMap := gexf.CreateHostMapGexf()
-
-	// Iterate through the results and add the connections to the GEXF host map structure
-	for rows.Next() {
-		var referer, destination string
-		if scanErr := rows.Scan(&referer, &destination); scanErr != nil {
-			http.Error(w, fmt.Sprintf("problem scanning hosts: %s", scanErr), http.StatusInternalServerError)
-			return
-		}
-		gexfHostMap.AddConnection(referer, destination)
+	// Choose how to group the hosts
+	grouping, groupingErr := parseHostGrouping(r)
+	if groupingErr != nil {
+		http.Error(w, groupingErr.Error(), http.StatusBadRequest)
+		return
 	}
 
-	// Check for any errors
-	if rowsErr := rows.Err(); rowsErr != nil {
-		http.Error(w, fmt.Sprintf("problem getting hosts: %s", rowsErr), http.StatusInternalServerError)
+	// Parse the time window from the query string, showing the last 30 days by default
+	window, windowErr := parseTimeWindow(r.URL.Query(), time.Now())
+	if windowErr != nil {
+		http.Error(w, windowErr.Error(), http.StatusBadRequest)
 		return
 	}
+	window = window.withDefaultSince(30 * 24 * time.Hour)
 
-	// Set the content type
-	w.Header().Set("Content-Type", "application/gexf+xml")
+	// Get all source and destination hosts from the database that were seen within the time window
+	hostMap, hostsErr := m.allHostsGraph(r.Context(), window)
+	if hostsErr != nil {
+		http.Error(w, fmt.Sprintf("problem getting hosts: %s", hostsErr), http.StatusInternalServerError)
+		return
+	}
 
-	// Set the filename
-	w.Header().Set("Content-Disposition", "attachment; filename=hosts.gexf")
+	// Describe how the hosts are connected
+	if typesErr := m.setHostEdgeTypes(r.Context(), hostMap, window); typesErr != nil {
+		http.Error(w, fmt.Sprintf("problem getting edge types: %s", typesErr), http.StatusInternalServerError)
+		return
+	}
 
-	// Write the GEXF host map structure to the response
-	if _, writeErr := gexfHostMap.Write(w); writeErr != nil {
-		http.Error(w, fmt.Sprintf("problem writing GEXF host map structure: %s", writeErr), http.StatusInternalServerError)
+	// Group the hosts and mark first-party and third-party connections
+	hostMap, groupErr := m.groupHostGraph(r.Context(), hostMap, grouping)
+	if groupErr != nil {
+		http.Error(w, fmt.Sprintf("problem grouping hosts: %s", groupErr), http.StatusInternalServerError)
 		return
 	}
+
+	// Write the host map graph to the response
+	m.writeGraph(w, serializer, hostMap, "hosts")
 }
 
-// HostTwoDegreesGexf is an HTTP handler function that returns a GEXF file to the client containing the
+// HostTwoDegreesGraph is an HTTP handler function that returns a graph file to the client containing the
 // connecting hosts from the provided host, including connections up to two degrees away.
-func (m *Mapper) HostTwoDegreesGexf(w http.ResponseWriter, r *http.Request) {
+// It is equivalent to HostNeighbourhoodGraph with a depth of 2, in both directions.
+// The format is chosen by the "format" query parameter or the Accept header, and defaults to GEXF.
+// Hosts can be grouped by registrable domain or organisation with the "group" query parameter.
+// Connections can be limited to a time window with the "since", "until" and "as_of" query parameters.
+func (m *Mapper) HostTwoDegreesGraph(w http.ResponseWriter, r *http.Request) {
 	// Only allow GET requests (or OPTIONS)
 	if r.Method == http.MethodOptions {
 		w.WriteHeader(http.StatusNoContent)
@@ -628,6 +663,20 @@ func (m *Mapper) HostTwoDegreesGexf(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Choose the output format before doing any work
+	serializer, formatErr := graph.SerializerForRequest(r, graph.FormatGEXF)
+	if formatErr != nil {
+		http.Error(w, formatErr.Error(), graphFormatErrorStatus(r))
+		return
+	}
+
+	// Choose how to group the hosts
+	grouping, groupingErr := parseHostGrouping(r)
+	if groupingErr != nil {
+		http.Error(w, groupingErr.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Get the host from the query string
 	host := r.URL.Query().Get("host")
 	if host == "" {
@@ -635,50 +684,52 @@ func (m *Mapper) HostTwoDegreesGexf(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Create the GEXF host map structure
-	gexfHostMap := gexf.CreateHostMapGexf()
-
-	// Query the database for all connecting hosts up to two degrees away from the provided host
-	sqlSelect := `select referer_host, destination_host, degrees_of_separation from get_referer_destination_host_pairs_within_two_degrees($1);`
-	rows, queryErr := m.dbConnPool.Query(r.Context(), sqlSelect, host)
-	if queryErr != nil {
-		http.Error(w, fmt.Sprintf("problem getting hosts: %s", queryErr), http.StatusInternalServerError)
+	// Parse the time window from the query string
+	window, windowErr := parseTimeWindow(r.URL.Query(), time.Now())
+	if windowErr != nil {
+		http.Error(w, windowErr.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Iterate through the results and add the connections to the GEXF host map structure
-	for rows.Next() {
-		var referer, destination string
-		var degreesOfSeparation int
-		if scanErr := rows.Scan(&referer, &destination, &degreesOfSeparation); scanErr != nil {
-			http.Error(w, fmt.Sprintf("problem scanning hosts: %s", scanErr), http.StatusInternalServerError)
-			return
-		}
-		gexfHostMap.AddConnection(referer, destination)
+	// Get all connecting hosts up to two degrees away from the provided host, in either direction
+	hostMap, truncated, neighbourhoodErr := m.hostNeighbourhood(r.Context(), &neighbourhoodQuery{
+		Host:      host,
+		Depth:     2,
+		Direction: directionBoth,
+		Window:    window,
+		MaxNodes:  neighbourhoodMaxNodes,
+	})
+	if neighbourhoodErr != nil {
+		http.Error(w, fmt.Sprintf("problem getting hosts: %s", neighbourhoodErr), http.StatusInternalServerError)
+		return
+	}
+	if truncated {
+		w.Header().Set("X-Graph-Truncated", "true")
 	}
 
-	// Check for any errors
-	if rowsErr := rows.Err(); rowsErr != nil {
-		http.Error(w, fmt.Sprintf("problem getting hosts: %s", rowsErr), http.StatusInternalServerError)
+	// Describe how the hosts are connected
+	if typesErr := m.setHostEdgeTypes(r.Context(), hostMap, window); typesErr != nil {
+		http.Error(w, fmt.Sprintf("problem getting edge types: %s", typesErr), http.StatusInternalServerError)
 		return
 	}
 
-	// Set the content type
-	w.Header().Set("Content-Type", "application/gexf+xml")
-
-	// Set the filename
-	w.Header().Set("Content-Disposition", "attachment; filename=host_connections_two_degrees.gexf")
-
-	// Write the GEXF host map structure to the response
-	if _, writeErr := gexfHostMap.Write(w); writeErr != nil {
-		http.Error(w, fmt.Sprintf("problem writing GEXF host map structure: %s", writeErr), http.StatusInternalServerError)
+	// Group the hosts and mark first-party and third-party connections
+	hostMap, groupErr := m.groupHostGraph(r.Context(), hostMap, grouping)
+	if groupErr != nil {
+		http.Error(w, fmt.Sprintf("problem grouping hosts: %s", groupErr), http.StatusInternalServerError)
 		return
 	}
+
+	// Write the host map graph to the response
+	m.writeGraph(w, serializer, hostMap, "host_connections_two_degrees")
 }
 
-// HostsOneDegreeGexf is an HTTP handler function that returns a GEXF file to the client containing the
+// HostsOneDegreeGraph is an HTTP handler function that returns a graph file to the client containing the
 // connecting hosts from the provided list of hosts (comma-separated), including connections up to one degree away.
-func (m *Mapper) HostsOneDegreeGexf(w http.ResponseWriter, r *http.Request) {
+// The format is chosen by the "format" query parameter or the Accept header, and defaults to GEXF.
+// Hosts can be grouped by registrable domain or organisation with the "group" query parameter.
+// Connections can be limited to a time window with the "since", "until" and "as_of" query parameters.
+func (m *Mapper) HostsOneDegreeGraph(w http.ResponseWriter, r *http.Request) {
 	// Only allow GET requests (or OPTIONS)
 	if r.Method == http.MethodOptions {
 		w.WriteHeader(http.StatusNoContent)
@@ -690,6 +741,20 @@ func (m *Mapper) HostsOneDegreeGexf(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Choose the output format before doing any work
+	serializer, formatErr := graph.SerializerForRequest(r, graph.FormatGEXF)
+	if formatErr != nil {
+		http.Error(w, formatErr.Error(), graphFormatErrorStatus(r))
+		return
+	}
+
+	// Choose how to group the hosts
+	grouping, groupingErr := parseHostGrouping(r)
+	if groupingErr != nil {
+		http.Error(w, groupingErr.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Get the hosts from the query string
 	hosts := r.URL.Query().Get("hosts")
 	if hosts == "" {
@@ -699,25 +764,33 @@ func (m *Mapper) HostsOneDegreeGexf(w http.ResponseWriter, r *http.Request) {
 	// Turn into a slice
 	hostSlice := strings.Split(hosts, ",")
 
-	// Create the GEXF host map structure
-	gexfHostMap := gexf.CreateHostMapGexf()
+	// Parse the time window from the query string
+	window, windowErr := parseTimeWindow(r.URL.Query(), time.Now())
+	if windowErr != nil {
+		http.Error(w, windowErr.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Create the host map graph
+	hostMap := graph.NewGraph("Connections between hosts", "connections, hosts")
 
 	// Query the database for all connecting hosts up to one degree away from the provided hosts
-	sqlSelect := `select ref_host, dest_host from get_connected_hosts($1);`
-	rows, queryErr := m.dbConnPool.Query(r.Context(), sqlSelect, pq.Array(hostSlice))
+	sqlSelect := `select ref_host, dest_host, first_seen, last_seen from get_connected_hosts($1, $2, $3);`
+	rows, queryErr := m.dbConnPool.Query(r.Context(), sqlSelect, pq.Array(hostSlice), window.Since, window.Until)
 	if queryErr != nil {
 		http.Error(w, fmt.Sprintf("problem getting hosts: %s", queryErr), http.StatusInternalServerError)
 		return
 	}
 
-	// Iterate through the results and add the connections to the GEXF host map structure
+	// Iterate through the results and add the connections to the host map graph
 	for rows.Next() {
 		var referer, destination string
-		if scanErr := rows.Scan(&referer, &destination); scanErr != nil {
+		var firstSeen, lastSeen time.Time
+		if scanErr := rows.Scan(&referer, &destination, &firstSeen, &lastSeen); scanErr != nil {
 			http.Error(w, fmt.Sprintf("problem scanning hosts: %s", scanErr), http.StatusInternalServerError)
 			return
 		}
-		gexfHostMap.AddConnection(referer, destination)
+		hostMap.AddEdgeSpell(referer, destination, firstSeen, lastSeen)
 	}
 
 	// Check for any errors
@@ -726,22 +799,28 @@ func (m *Mapper) HostsOneDegreeGexf(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Set the content type
-	w.Header().Set("Content-Type", "application/gexf+xml")
-
-	// Set the filename
-	w.Header().Set("Content-Disposition", "attachment; filename=hosts.gexf")
+	// Describe how the hosts are connected
+	if typesErr := m.setHostEdgeTypes(r.Context(), hostMap, window); typesErr != nil {
+		http.Error(w, fmt.Sprintf("problem getting edge types: %s", typesErr), http.StatusInternalServerError)
+		return
+	}
 
-	// Write the GEXF host map structure to the response
-	if _, writeErr := gexfHostMap.Write(w); writeErr != nil {
-		http.Error(w, fmt.Sprintf("problem writing GEXF host map structure: %s", writeErr), http.StatusInternalServerError)
+	// Group the hosts and mark first-party and third-party connections
+	hostMap, groupErr := m.groupHostGraph(r.Context(), hostMap, grouping)
+	if groupErr != nil {
+		http.Error(w, fmt.Sprintf("problem grouping hosts: %s", groupErr), http.StatusInternalServerError)
 		return
 	}
+
+	// Write the host map graph to the response
+	m.writeGraph(w, serializer, hostMap, "hosts")
 }
 
-// PathsAndConnectionsForHostsGexf is an HTTP handler function that returns a GEXF file to the client containing the
-// paths and connections for the provided hosts.
-func (m *Mapper) PathsAndConnectionsForHostsGexf(w http.ResponseWriter, r *http.Request) {
+// PathsAndConnectionsForHostsGraph is an HTTP handler function that returns a graph file to the client containing the
+// paths and connections for the provided hosts, with the classification of each path as a node attribute.
+// The format is chosen by the "format" query parameter or the Accept header, and defaults to GEXF.
+// Connections can be limited to a time window with the "since", "until" and "as_of" query parameters.
+func (m *Mapper) PathsAndConnectionsForHostsGraph(w http.ResponseWriter, r *http.Request) {
 	// Only allow GET requests (or OPTIONS)
 	if r.Method == http.MethodOptions {
 		w.WriteHeader(http.StatusNoContent)
@@ -753,6 +832,13 @@ func (m *Mapper) PathsAndConnectionsForHostsGexf(w http.ResponseWriter, r *http.
 		return
 	}
 
+	// Choose the output format before doing any work
+	serializer, formatErr := graph.SerializerForRequest(r, graph.FormatGEXF)
+	if formatErr != nil {
+		http.Error(w, formatErr.Error(), graphFormatErrorStatus(r))
+		return
+	}
+
 	// Get the hosts from the query string
 	hosts := r.URL.Query().Get("hosts")
 	if hosts == "" {
@@ -762,25 +848,39 @@ func (m *Mapper) PathsAndConnectionsForHostsGexf(w http.ResponseWriter, r *http.
 	// Turn into a slice
 	hostSlice := strings.Split(hosts, ",")
 
-	// Create the GEXF host map structure
-	gexfHostMap := gexf.CreatePathHostsMapGexf()
+	// Parse the time window from the query string
+	window, windowErr := parseTimeWindow(r.URL.Query(), time.Now())
+	if windowErr != nil {
+		http.Error(w, windowErr.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Create the path hosts map graph, with the classification of each path as a node attribute
+	hostMap := graph.NewGraph("Connections from paths to hosts", "connections, hosts, paths")
+	hostMap.DeclareNodeAttribute(graph.AttributeDef{
+		Key:     "classification",
+		Title:   "Classification",
+		Type:    graph.AttributeInteger,
+		Default: -1,
+	})
 
 	// Query the database for all connecting hosts up to one degree away from the provided hosts
-	sqlSelect := `select source, destination from get_paths_and_connected_hosts($1) where source != destination;`
-	rows, queryErr := m.dbConnPool.Query(r.Context(), sqlSelect, pq.Array(hostSlice))
+	sqlSelect := `select source, destination, first_seen, last_seen from get_paths_and_connected_hosts($1, $2, $3);`
+	rows, queryErr := m.dbConnPool.Query(r.Context(), sqlSelect, pq.Array(hostSlice), window.Since, window.Until)
 	if queryErr != nil {
 		http.Error(w, fmt.Sprintf("problem getting hosts: %s", queryErr), http.StatusInternalServerError)
 		return
 	}
 
-	// Iterate through the results and add the connections to the GEXF host map structure
+	// Iterate through the results and add the connections to the host map graph
 	for rows.Next() {
 		var referer, destination string
-		if scanErr := rows.Scan(&referer, &destination); scanErr != nil {
+		var firstSeen, lastSeen time.Time
+		if scanErr := rows.Scan(&referer, &destination, &firstSeen, &lastSeen); scanErr != nil {
 			http.Error(w, fmt.Sprintf("problem scanning hosts: %s", scanErr), http.StatusInternalServerError)
 			return
 		}
-		gexfHostMap.AddConnection(referer, destination)
+		hostMap.AddEdgeSpell(referer, destination, firstSeen, lastSeen)
 	}
 
 	// Check for any errors
@@ -800,7 +900,7 @@ func (m *Mapper) PathsAndConnectionsForHostsGexf(w http.ResponseWriter, r *http.
 		return
 	}
 
-	// Iterate through the results and add the classifications to the GEXF host map structure
+	// Iterate through the results and add the classifications to the host map graph
 	for classificationRows.Next() {
 		var path string
 		var classification int
@@ -808,7 +908,7 @@ func (m *Mapper) PathsAndConnectionsForHostsGexf(w http.ResponseWriter, r *http.
 			http.Error(w, fmt.Sprintf("problem scanning classifications: %s", scanErr), http.StatusInternalServerError)
 			return
 		}
-		gexfHostMap.AddClassification(path, classification)
+		hostMap.SetNodeAttribute(path, "classification", classification)
 	}
 
 	// Check for any errors
@@ -820,15 +920,114 @@ func (m *Mapper) PathsAndConnectionsForHostsGexf(w http.ResponseWriter, r *http.
 	// Close the rows
 	classificationRows.Close()
 
-	// Set the content type
-	w.Header().Set("Content-Type", "application/gexf+xml")
+	// Write the path hosts map graph to the response
+	m.writeGraph(w, serializer, hostMap, "paths_and_connections_for_hosts")
+}
 
-	// Set the filename
-	w.Header().Set("Content-Disposition", "attachment; filename=paths_and_connections_for_hosts.gexf")
+// allHostsGraph returns a graph of all hosts and their connections that were seen within the given time window.
+func (m *Mapper) allHostsGraph(ctx context.Context, window timeWindow) (*graph.Graph, error) {
+	sqlSelect := `select referer_host, destination_host, min(first_seen), max(last_seen)
+		from data_mapper
+		where referer_host != ''
+		  and destination_host != ''
+		  and referer_host != destination_host
+		  and ($1::timestamptz is null or last_seen >= $1)
+		  and ($2::timestamptz is null or first_seen <= $2)
+		group by referer_host, destination_host
+		order by referer_host, destination_host;`
+	rows, queryErr := m.dbConnPool.Query(ctx, sqlSelect, window.Since, window.Until)
+	if queryErr != nil {
+		return nil, fmt.Errorf("unable to query database: %w", queryErr)
+	}
+	defer rows.Close()
 
-	// Write the GEXF host map
-	if _, writeErr := gexfHostMap.Write(w); writeErr != nil {
-		http.Error(w, fmt.Sprintf("problem writing GEXF host map structure: %s", writeErr), http.StatusInternalServerError)
+	// Create the host map graph
+	hostMap := graph.NewGraph("Connections between hosts", "connections, hosts")
+
+	// Iterate through the results and add the connections to the host map graph
+	for rows.Next() {
+		var referer, destination string
+		var firstSeen, lastSeen time.Time
+		if scanErr := rows.Scan(&referer, &destination, &firstSeen, &lastSeen); scanErr != nil {
+			return nil, fmt.Errorf("unable to scan row: %w", scanErr)
+		}
+		hostMap.AddEdgeSpell(referer, destination, firstSeen, lastSeen)
+	}
+	if rowsErr := rows.Err(); rowsErr != nil {
+		return nil, fmt.Errorf("unable to iterate over rows: %w", rowsErr)
+	}
+
+	return hostMap, nil
+}
+
+// setHostEdgeTypes sets the "types" attribute of each edge in the given host graph to the comma-separated edge types
+// (such as "link,redirect") of the connections between its hosts within the given time window.
+func (m *Mapper) setHostEdgeTypes(ctx context.Context, hostMap *graph.Graph, window timeWindow) error {
+	nodes := hostMap.Nodes()
+	hosts := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		hosts = append(hosts, node.ID)
+	}
+
+	sqlSelect := `select referer_host, destination_host, array_agg(distinct edge_type order by edge_type)
+		from data_mapper
+		where referer_host = any($1)
+		  and destination_host = any($1)
+		  and ($2::timestamptz is null or last_seen >= $2)
+		  and ($3::timestamptz is null or first_seen <= $3)
+		group by referer_host, destination_host;`
+	rows, queryErr := m.dbConnPool.Query(ctx, sqlSelect, hosts, window.Since, window.Until)
+	if queryErr != nil {
+		return fmt.Errorf("unable to query database: %w", queryErr)
+	}
+	defer rows.Close()
+
+	hostMap.DeclareEdgeAttribute(graph.AttributeDef{Key: "types", Title: "Edge types", Type: graph.AttributeString})
+	for rows.Next() {
+		var referer, destination string
+		var types []string
+		if scanErr := rows.Scan(&referer, &destination, &types); scanErr != nil {
+			return fmt.Errorf("unable to scan row: %w", scanErr)
+		}
+		hostMap.SetEdgeAttribute(referer, destination, "types", strings.Join(types, ","))
+	}
+	if rowsErr := rows.Err(); rowsErr != nil {
+		return fmt.Errorf("unable to iterate over rows: %w", rowsErr)
+	}
+
+	return nil
+}
+
+// writeGraph serializes the given graph and writes it to the response as a file download, using the given base
+// filename and the serializer's file extension. The graph analytics (degrees, PageRank, betweenness, components and
+// communities) of each node are added as node attributes first, from the analytics cache if the graph is unchanged.
+func (m *Mapper) writeGraph(w http.ResponseWriter, serializer graph.Serializer, g *graph.Graph, filename string) {
+	m.analytics.Annotate(g)
+
+	// Serialize into a buffer first, so that errors can still be returned to the client
+	buf := new(bytes.Buffer)
+	if serializeErr := serializer.Serialize(buf, g); serializeErr != nil {
+		http.Error(w, fmt.Sprintf("problem writing %s graph: %s", serializer.Format(), serializeErr), http.StatusInternalServerError)
 		return
 	}
+
+	// Set the content type and filename
+	w.Header().Set("Content-Type", serializer.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.%s", filename, serializer.Extension()))
+
+	// Write the graph
+	if _, writeErr := buf.WriteTo(w); writeErr != nil {
+		log.WithError(writeErr).Error("unable to write graph to response")
+	}
+}
+
+// graphFormatErrorStatus returns the HTTP status code for an unsupported graph format in the given request:
+// 400 (Bad Request) if it was given in the "format" query parameter, or 406 (Not Acceptable) if it came from the
+// Accept header.
+func graphFormatErrorStatus(r *http.Request) int {
+	if r.URL.Query().Get("format") != "" {
+		return http.StatusBadRequest
+	}
+
+	return http.StatusNotAcceptable
 }
@@ -0,0 +1,334 @@
+package mapper
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/TheHackerDev/cartograph/internal/shared/datatypes/graph"
+	"github.com/TheHackerDev/cartograph/internal/shared/domains"
+)
+
+// Diff levels, as used in the "level" query parameter. They set what each node in a diff represents.
+const (
+	diffLevelHost   string = "host"
+	diffLevelDomain string = "domain"
+	diffLevelPath   string = "path"
+)
+
+// Diff statuses of nodes and edges.
+const (
+	diffAdded     string = "added"
+	diffRemoved   string = "removed"
+	diffChanged   string = "changed"
+	diffUnchanged string = "unchanged"
+)
+
+// Edge colors for each diff status. Unchanged edges use the viewer's default color.
+var diffColors = map[string]string{
+	diffAdded:   "#4caf50",
+	diffRemoved: "#f44336",
+	diffChanged: "#ff9800",
+}
+
+// mapState is the map at one point in time, at a single diff level, which is compared with another to find what
+// changed.
+type mapState struct {
+	level string
+	nodes map[string]*nodeState
+	edges map[[2]string]*edgeState
+}
+
+// nodeState is a single node in a mapState.
+type nodeState struct {
+	// paths holds the URLs (host and path, without the scheme) seen at the node.
+	paths     map[string]bool
+	firstSeen time.Time
+	lastSeen  time.Time
+}
+
+// edgeState is a single edge in a mapState.
+type edgeState struct {
+	// types holds the edge types of the connections merged into the edge.
+	types     map[string]bool
+	firstSeen time.Time
+	lastSeen  time.Time
+}
+
+// newMapState returns a new, empty map state at the given diff level.
+func newMapState(level string) *mapState {
+	return &mapState{
+		level: level,
+		nodes: make(map[string]*nodeState),
+		edges: make(map[[2]string]*edgeState),
+	}
+}
+
+// nodeID returns the ID of the node for the given host and path at the state's diff level.
+func (s *mapState) nodeID(host string, path string) string {
+	if host == "" {
+		return ""
+	}
+	switch s.level {
+	case diffLevelDomain:
+		return domains.Registrable(host)
+	case diffLevelPath:
+		return host + path
+	default:
+		return host
+	}
+}
+
+// add adds a single mapper connection to the state. Connections with no referer, and connections within a single
+// node, are skipped.
+func (s *mapState) add(refererHost string, refererPath string, destinationHost string, destinationPath string, edgeType string, firstSeen time.Time, lastSeen time.Time) {
+	source, target := s.nodeID(refererHost, refererPath), s.nodeID(destinationHost, destinationPath)
+	if source == "" || target == "" || source == target {
+		return
+	}
+
+	s.addNode(source, refererHost+refererPath, firstSeen, lastSeen)
+	s.addNode(target, destinationHost+destinationPath, firstSeen, lastSeen)
+
+	key := [2]string{source, target}
+	edge, ok := s.edges[key]
+	if !ok {
+		edge = &edgeState{types: make(map[string]bool)}
+		s.edges[key] = edge
+	}
+	edge.types[edgeType] = true
+	graph.WidenSpell(&edge.firstSeen, &edge.lastSeen, firstSeen, lastSeen)
+}
+
+// addNode adds the given path to the node with the given ID, adding the node if it does not exist.
+func (s *mapState) addNode(id string, path string, firstSeen time.Time, lastSeen time.Time) {
+	node, ok := s.nodes[id]
+	if !ok {
+		node = &nodeState{paths: make(map[string]bool)}
+		s.nodes[id] = node
+	}
+	node.paths[path] = true
+	graph.WidenSpell(&node.firstSeen, &node.lastSeen, firstSeen, lastSeen)
+}
+
+// MapDiff holds the changes to the map between two snapshots or time ranges.
+type MapDiff struct {
+	// From and To describe the compared snapshots or time ranges.
+	From string `json:"from"`
+	To   string `json:"to"`
+
+	// Level is what each node represents: a host, a registrable domain, or a path.
+	Level string `json:"level"`
+
+	Summary DiffSummary `json:"summary"`
+	Nodes   []NodeDiff  `json:"nodes"`
+	Edges   []EdgeDiff  `json:"edges"`
+}
+
+// DiffSummary counts the nodes and edges with each diff status.
+type DiffSummary struct {
+	NodesAdded   int `json:"nodes_added"`
+	NodesRemoved int `json:"nodes_removed"`
+	NodesChanged int `json:"nodes_changed"`
+	EdgesAdded   int `json:"edges_added"`
+	EdgesRemoved int `json:"edges_removed"`
+	EdgesChanged int `json:"edges_changed"`
+}
+
+// NodeDiff is the change to a single node. Nodes are changed if paths were added to or removed from them, or if any
+// of their edges were added or removed.
+type NodeDiff struct {
+	ID           string    `json:"id"`
+	Status       string    `json:"status"`
+	FirstSeen    time.Time `json:"first_seen"`
+	LastSeen     time.Time `json:"last_seen"`
+	AddedPaths   []string  `json:"added_paths,omitempty"`
+	RemovedPaths []string  `json:"removed_paths,omitempty"`
+}
+
+// EdgeDiff is the change to a single edge. Edges are changed if the types of connection between their nodes changed.
+type EdgeDiff struct {
+	Source       string    `json:"source"`
+	Target       string    `json:"target"`
+	Status       string    `json:"status"`
+	Types        []string  `json:"types"`
+	FirstSeen    time.Time `json:"first_seen"`
+	LastSeen     time.Time `json:"last_seen"`
+	AddedTypes   []string  `json:"added_types,omitempty"`
+	RemovedTypes []string  `json:"removed_types,omitempty"`
+}
+
+// diffMapStates returns the changes from one map state to another, which must be at the same diff level. Nodes and
+// edges are sorted by ID. Times are taken from the later state where possible.
+func diffMapStates(from *mapState, to *mapState) *MapDiff {
+	diff := &MapDiff{
+		Level: to.level,
+		Nodes: make([]NodeDiff, 0),
+		Edges: make([]EdgeDiff, 0),
+	}
+
+	// Compare the edges first, as nodes are changed if their edges are added or removed
+	touched := make(map[string]bool)
+	for _, key := range sortedEdgeKeys(from.edges, to.edges) {
+		fromEdge, inFrom := from.edges[key]
+		toEdge, inTo := to.edges[key]
+		edgeDiff := EdgeDiff{Source: key[0], Target: key[1]}
+		switch {
+		case !inFrom:
+			edgeDiff.Status = diffAdded
+			edgeDiff.Types = sortedKeys(toEdge.types)
+			edgeDiff.FirstSeen, edgeDiff.LastSeen = toEdge.firstSeen, toEdge.lastSeen
+			diff.Summary.EdgesAdded++
+		case !inTo:
+			edgeDiff.Status = diffRemoved
+			edgeDiff.Types = sortedKeys(fromEdge.types)
+			edgeDiff.FirstSeen, edgeDiff.LastSeen = fromEdge.firstSeen, fromEdge.lastSeen
+			diff.Summary.EdgesRemoved++
+		default:
+			edgeDiff.Types = sortedKeys(toEdge.types)
+			edgeDiff.FirstSeen, edgeDiff.LastSeen = toEdge.firstSeen, toEdge.lastSeen
+			edgeDiff.AddedTypes = missingKeys(toEdge.types, fromEdge.types)
+			edgeDiff.RemovedTypes = missingKeys(fromEdge.types, toEdge.types)
+			edgeDiff.Status = diffUnchanged
+			if len(edgeDiff.AddedTypes) > 0 || len(edgeDiff.RemovedTypes) > 0 {
+				edgeDiff.Status = diffChanged
+				diff.Summary.EdgesChanged++
+			}
+		}
+		if edgeDiff.Status == diffAdded || edgeDiff.Status == diffRemoved {
+			touched[key[0]] = true
+			touched[key[1]] = true
+		}
+		diff.Edges = append(diff.Edges, edgeDiff)
+	}
+
+	for _, id := range sortedNodeIDs(from.nodes, to.nodes) {
+		fromNode, inFrom := from.nodes[id]
+		toNode, inTo := to.nodes[id]
+		nodeDiff := NodeDiff{ID: id}
+		switch {
+		case !inFrom:
+			nodeDiff.Status = diffAdded
+			nodeDiff.FirstSeen, nodeDiff.LastSeen = toNode.firstSeen, toNode.lastSeen
+			diff.Summary.NodesAdded++
+		case !inTo:
+			nodeDiff.Status = diffRemoved
+			nodeDiff.FirstSeen, nodeDiff.LastSeen = fromNode.firstSeen, fromNode.lastSeen
+			diff.Summary.NodesRemoved++
+		default:
+			nodeDiff.FirstSeen, nodeDiff.LastSeen = toNode.firstSeen, toNode.lastSeen
+			nodeDiff.AddedPaths = missingKeys(toNode.paths, fromNode.paths)
+			nodeDiff.RemovedPaths = missingKeys(fromNode.paths, toNode.paths)
+			nodeDiff.Status = diffUnchanged
+			if touched[id] || len(nodeDiff.AddedPaths) > 0 || len(nodeDiff.RemovedPaths) > 0 {
+				nodeDiff.Status = diffChanged
+				diff.Summary.NodesChanged++
+			}
+		}
+		diff.Nodes = append(diff.Nodes, nodeDiff)
+	}
+
+	return diff
+}
+
+// withoutUnchanged returns a copy of the diff without its unchanged nodes and edges.
+func (d *MapDiff) withoutUnchanged() *MapDiff {
+	changed := *d
+	changed.Nodes = make([]NodeDiff, 0)
+	for _, node := range d.Nodes {
+		if node.Status != diffUnchanged {
+			changed.Nodes = append(changed.Nodes, node)
+		}
+	}
+	changed.Edges = make([]EdgeDiff, 0)
+	for _, edge := range d.Edges {
+		if edge.Status != diffUnchanged {
+			changed.Edges = append(changed.Edges, edge)
+		}
+	}
+
+	return &changed
+}
+
+// Graph returns the diff as a graph, with the diff status of each node and edge in its "diff" attribute. Added,
+// removed and changed edges are colored green, red and orange.
+func (d *MapDiff) Graph() *graph.Graph {
+	diffGraph := graph.NewGraph("Changes to the map from "+d.From+" to "+d.To, "changes, diff, "+d.Level)
+	diffGraph.DeclareNodeAttribute(graph.AttributeDef{Key: "diff", Title: "Diff", Type: graph.AttributeString})
+	diffGraph.DeclareEdgeAttribute(graph.AttributeDef{Key: "diff", Title: "Diff", Type: graph.AttributeString})
+	diffGraph.DeclareEdgeAttribute(graph.AttributeDef{Key: "types", Title: "Edge types", Type: graph.AttributeString})
+
+	for _, node := range d.Nodes {
+		diffGraph.SetNodeAttribute(node.ID, "diff", node.Status)
+	}
+	for _, edge := range d.Edges {
+		diffGraph.AddEdgeSpell(edge.Source, edge.Target, edge.FirstSeen, edge.LastSeen)
+		diffGraph.SetEdgeAttribute(edge.Source, edge.Target, "diff", edge.Status)
+		diffGraph.SetEdgeAttribute(edge.Source, edge.Target, "types", strings.Join(edge.Types, ","))
+		if color, ok := diffColors[edge.Status]; ok {
+			diffGraph.SetEdgeColor(edge.Source, edge.Target, color)
+		}
+	}
+
+	return diffGraph
+}
+
+// sortedEdgeKeys returns the keys of both edge maps, sorted by source then target.
+func sortedEdgeKeys(a map[[2]string]*edgeState, b map[[2]string]*edgeState) [][2]string {
+	keySet := make(map[[2]string]bool, len(a)+len(b))
+	for key := range a {
+		keySet[key] = true
+	}
+	for key := range b {
+		keySet[key] = true
+	}
+	keys := make([][2]string, 0, len(keySet))
+	for key := range keySet {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+
+	return keys
+}
+
+// sortedNodeIDs returns the IDs in both node maps, sorted.
+func sortedNodeIDs(a map[string]*nodeState, b map[string]*nodeState) []string {
+	idSet := make(map[string]bool, len(a)+len(b))
+	for id := range a {
+		idSet[id] = true
+	}
+	for id := range b {
+		idSet[id] = true
+	}
+
+	return sortedKeys(idSet)
+}
+
+// sortedKeys returns the keys of the given set, sorted.
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// missingKeys returns the keys of set a that are not in set b, sorted, or nil if there are none.
+func missingKeys(a map[string]bool, b map[string]bool) []string {
+	var missing []string
+	for key := range a {
+		if !b[key] {
+			missing = append(missing, key)
+		}
+	}
+	sort.Strings(missing)
+
+	return missing
+}
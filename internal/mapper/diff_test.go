@@ -0,0 +1,83 @@
+package mapper
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiffMapStates(t *testing.T) {
+	january := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	february := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	from := newMapState(diffLevelHost)
+	from.add("www.example.com", "/", "cdn.example.com", "/app.js", "script", january, january)
+	from.add("www.example.com", "/", "ads.tracker.net", "/pixel", "image", january, january)
+	from.add("www.example.com", "/", "www.example.com", "/about", "link", january, january)
+
+	to := newMapState(diffLevelHost)
+	to.add("www.example.com", "/", "cdn.example.com", "/app.js", "script", january, february)
+	to.add("www.example.com", "/", "cdn.example.com", "/data.json", "fetch", february, february)
+	to.add("www.example.com", "/", "new.analytics.io", "/collect", "fetch", february, february)
+
+	diff := diffMapStates(from, to)
+
+	want := DiffSummary{NodesAdded: 1, NodesRemoved: 1, NodesChanged: 2, EdgesAdded: 1, EdgesRemoved: 1, EdgesChanged: 1}
+	if diff.Summary != want {
+		t.Errorf("summary = %+v, want %+v", diff.Summary, want)
+	}
+
+	statuses := make(map[string]string)
+	for _, node := range diff.Nodes {
+		statuses[node.ID] = node.Status
+	}
+	wantStatuses := map[string]string{
+		"ads.tracker.net":  diffRemoved,
+		"cdn.example.com":  diffChanged,
+		"new.analytics.io": diffAdded,
+		"www.example.com":  diffChanged,
+	}
+	if !reflect.DeepEqual(statuses, wantStatuses) {
+		t.Errorf("node statuses = %v, want %v", statuses, wantStatuses)
+	}
+
+	for _, edge := range diff.Edges {
+		if edge.Target != "cdn.example.com" {
+			continue
+		}
+		if !reflect.DeepEqual(edge.AddedTypes, []string{"fetch"}) || !edge.LastSeen.Equal(february) {
+			t.Errorf("cdn edge = %+v, want fetch added and last seen in February", edge)
+		}
+	}
+
+	if changed := diff.withoutUnchanged(); len(changed.Nodes) != 4 || len(changed.Edges) != 3 {
+		t.Errorf("withoutUnchanged() kept %d nodes and %d edges, want 4 and 3", len(changed.Nodes), len(changed.Edges))
+	}
+	if g := diff.Graph(); len(g.Nodes()) != 4 || len(g.Edges()) != 3 {
+		t.Errorf("Graph() has %d nodes and %d edges, want 4 and 3", len(g.Nodes()), len(g.Edges()))
+	}
+}
+
+func TestParseDiffQuery(t *testing.T) {
+	now := time.Date(2024, 6, 30, 12, 0, 0, 0, time.UTC)
+
+	dq, err := parseDiffQuery(url.Values{"from": {"may"}, "to_since": {"7d"}, "level": {"domain"}}, now)
+	if err != nil {
+		t.Fatalf("parseDiffQuery() returned error: %s", err)
+	}
+	if dq.from.snapshot != "may" || dq.to.snapshot != "" || !dq.to.window.Since.Equal(now.AddDate(0, 0, -7)) || dq.level != diffLevelDomain {
+		t.Errorf("parseDiffQuery() = %+v, want snapshot to the last week by domain", dq)
+	}
+
+	for _, query := range []url.Values{
+		{},
+		{"to": {"june"}},
+		{"from": {"may"}, "from_since": {"7d"}},
+		{"from": {"may"}, "level": {"organisation"}},
+	} {
+		if _, err := parseDiffQuery(query, now); err == nil {
+			t.Errorf("parseDiffQuery(%v) returned no error", query)
+		}
+	}
+}
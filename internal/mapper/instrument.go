@@ -0,0 +1,212 @@
+package mapper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/TheHackerDev/cartograph/internal/shared/datatypes"
+)
+
+// defaultInstrumentEventsLimit is the maximum number of events returned by the instrumentation API, unless another
+// limit is given.
+const defaultInstrumentEventsLimit = 1000
+
+// instrumentEventKey identifies an instrumentation event, so that identical calls from a page are saved once, with a
+// count.
+type instrumentEventKey struct {
+	pageScheme, pageHost, pagePath string
+	kind, method, url, script      string
+	detail                         string
+}
+
+// instrumentEvent is an instrumentation event waiting to be saved to the database.
+type instrumentEvent struct {
+	count     int
+	firstSeen time.Time
+	lastSeen  time.Time
+}
+
+// InstrumentEvent is a client-side API call observed by the instrumentation script, as returned by the
+// instrumentation API.
+type InstrumentEvent struct {
+	Page      string    `json:"page"`
+	Kind      string    `json:"kind"`
+	Method    string    `json:"method"`
+	URL       string    `json:"url"`
+	Script    string    `json:"script"`
+	Detail    string    `json:"detail"`
+	Count     int       `json:"count"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+}
+
+// InstrumentEnabled returns true if the instrumentation script is injected alongside the mapper script.
+func (m *Mapper) InstrumentEnabled() bool {
+	return m.enabled && m.cfg.Instrument
+}
+
+// GetInstrumentScriptName returns the name of the instrumentation script file.
+func (m *Mapper) GetInstrumentScriptName() string {
+	return m.instrumentScriptName
+}
+
+// LogInstrumentData records the client-side API calls observed by the instrumentation script, to be saved to the
+// database with the rest of the mapper data. Events of an unknown kind are skipped.
+// An error is returned if the page URL cannot be parsed.
+func (m *Mapper) LogInstrumentData(instrumentData *datatypes.InstrumentBrowserData) error {
+	// Check if enabled first
+	if !m.InstrumentEnabled() {
+		return nil
+	}
+
+	// Parse the page URL
+	pageURL, pageParseErr := url.Parse(instrumentData.Page)
+	if pageParseErr != nil {
+		return fmt.Errorf("unable to parse page URL from instrumentation data: %w", pageParseErr)
+	}
+
+	// Only record calls made on target pages
+	if !m.cfg.IsTarget(pageURL.Host, pageURL.Host) {
+		return nil
+	}
+
+	m.recordInstrumentEvents(pageURL, instrumentData.Events, time.Now())
+
+	return nil
+}
+
+// recordInstrumentEvents adds the given events observed on the page to the events waiting to be saved, adding up the
+// counts of identical events.
+func (m *Mapper) recordInstrumentEvents(pageURL *url.URL, events []datatypes.InstrumentBrowserEvent, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, event := range events {
+		if !datatypes.IsInstrumentKind(event.Kind) {
+			continue
+		}
+
+		key := instrumentEventKey{
+			pageScheme: pageURL.Scheme,
+			pageHost:   pageURL.Host,
+			pagePath:   pageURL.Path,
+			kind:       event.Kind,
+			method:     event.Method,
+			url:        event.URL,
+			script:     event.Script,
+			detail:     event.Detail,
+		}
+		pending, ok := m.pendingInstrumentEvents[key]
+		if !ok {
+			pending = &instrumentEvent{firstSeen: now}
+			m.pendingInstrumentEvents[key] = pending
+		}
+		pending.count += max(event.Count, 1)
+		pending.lastSeen = now
+	}
+}
+
+// saveInstrumentEventsToDatabase saves the instrumentation events recorded since the last save to the database, in
+// a single batch. The counts of events already in the database are added to.
+func (m *Mapper) saveInstrumentEventsToDatabase() error {
+	m.mu.Lock()
+	pending := m.pendingInstrumentEvents
+	m.pendingInstrumentEvents = make(map[instrumentEventKey]*instrumentEvent)
+	m.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	batch := &pgx.Batch{}
+	for key, event := range pending {
+		batch.Queue(`INSERT INTO data_browser_events (page_scheme, page_host, page_path, kind, method, url, script, detail, count, first_seen, last_seen) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) ON CONFLICT ON CONSTRAINT data_browser_events_pk DO UPDATE SET count = data_browser_events.count + excluded.count, last_seen = excluded.last_seen;`,
+			key.pageScheme, key.pageHost, key.pagePath, key.kind, key.method, key.url, key.script, key.detail, event.count, event.firstSeen, event.lastSeen)
+	}
+	if batchErr := m.dbConnPool.SendBatch(context.Background(), batch).Close(); batchErr != nil {
+		return fmt.Errorf("unable to insert %d instrumentation events into database: %w", len(pending), batchErr)
+	}
+
+	return nil
+}
+
+// InstrumentationAPIHandler is an HTTP handler that returns the client-side API calls observed by the
+// instrumentation script, most recently seen first.
+//
+// The optional "host" query parameter limits the events to pages on that host, "kind" to one of the event kinds
+// ("fetch", "xhr", "websocket", "postmessage", or "storage"), and "script" to calls made by that script URL. The
+// "limit" parameter sets the maximum number of events returned.
+func (m *Mapper) InstrumentationAPIHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		break
+	case http.MethodOptions:
+		w.Header().Set("Allow", "GET")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "invalid HTTP request method: "+r.Method, http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	if kind := query.Get("kind"); kind != "" && !datatypes.IsInstrumentKind(kind) {
+		http.Error(w, fmt.Sprintf("invalid kind: %q", kind), http.StatusBadRequest)
+		return
+	}
+	limit := defaultInstrumentEventsLimit
+	if limitParam := query.Get("limit"); limitParam != "" {
+		var parseErr error
+		if limit, parseErr = strconv.Atoi(limitParam); parseErr != nil || limit < 1 {
+			http.Error(w, fmt.Sprintf("invalid limit %q; must be a positive integer", limitParam), http.StatusBadRequest)
+			return
+		}
+	}
+
+	events, getErr := m.getInstrumentEvents(r.Context(), query.Get("host"), query.Get("kind"), query.Get("script"), limit)
+	if getErr != nil {
+		http.Error(w, fmt.Sprintf("unable to get instrumentation events: %s", getErr), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the events as JSON
+	w.Header().Set("Content-Type", "application/json")
+	if jsonMarshalErr := json.NewEncoder(w).Encode(events); jsonMarshalErr != nil {
+		http.Error(w, fmt.Sprintf("unable to encode instrumentation events to JSON: %s", jsonMarshalErr), http.StatusInternalServerError)
+		return
+	}
+}
+
+// getInstrumentEvents returns up to the given number of instrumentation events, most recently seen first, filtered
+// by the given page host, kind, and script where they are not empty.
+func (m *Mapper) getInstrumentEvents(ctx context.Context, host, kind, script string, limit int) ([]InstrumentEvent, error) {
+	rows, queryErr := m.dbConnPool.Query(ctx, `SELECT page_scheme, page_host, page_path, kind, method, url, script, detail, count, first_seen, last_seen FROM data_browser_events WHERE ($1 = '' OR page_host = $1) AND ($2 = '' OR kind = $2) AND ($3 = '' OR script = $3) ORDER BY last_seen DESC LIMIT $4;`,
+		host, kind, script, limit)
+	if queryErr != nil {
+		return nil, fmt.Errorf("unable to query database: %w", queryErr)
+	}
+	defer rows.Close()
+
+	events := make([]InstrumentEvent, 0)
+	for rows.Next() {
+		var event InstrumentEvent
+		var page url.URL
+		if scanErr := rows.Scan(&page.Scheme, &page.Host, &page.Path, &event.Kind, &event.Method, &event.URL, &event.Script, &event.Detail, &event.Count, &event.FirstSeen, &event.LastSeen); scanErr != nil {
+			return nil, fmt.Errorf("unable to scan row: %w", scanErr)
+		}
+		event.Page = page.String()
+		events = append(events, event)
+	}
+	if rowsErr := rows.Err(); rowsErr != nil {
+		return nil, fmt.Errorf("unable to iterate over rows: %w", rowsErr)
+	}
+
+	return events, nil
+}
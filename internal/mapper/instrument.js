@@ -0,0 +1,159 @@
+(function () {
+    const currentUrl = window.location.href;
+
+    // Keep the original APIs, so that reports to Cartograph are not recorded themselves
+    const originalFetch = window.fetch;
+
+    // Events waiting to be sent to Cartograph, keyed by everything but their count, so that repeated calls are only
+    // sent once
+    let pendingEvents = new Map();
+
+    // Matches the script URLs in a stack trace, in both the Chrome ("at f (url:1:2)") and Firefox ("f@url:1:2")
+    // formats
+    const stackUrlRegex = /(https?:\/\/[^\s()]+?):\d+:\d+/g;
+
+    // callingScript returns the URL of the script that called the hooked API, or the page URL for inline scripts
+    function callingScript() {
+        const stack = new Error().stack || "";
+        for (const match of stack.matchAll(stackUrlRegex)) {
+            const url = match[1];
+            if (!url.endsWith("instrument.js") && !url.endsWith("mapper.js")) {
+                return url;
+            }
+        }
+        return document.currentScript && document.currentScript.src ? document.currentScript.src : currentUrl;
+    }
+
+    // absoluteUrl resolves the given URL against the page, returning an empty string if it is not a URL
+    function absoluteUrl(rawUrl) {
+        try {
+            return new URL(String(rawUrl), currentUrl).href;
+        } catch (e) {
+            return "";
+        }
+    }
+
+    // record queues a single event to be sent to Cartograph
+    function record(kind, method, url, detail) {
+        try {
+            // Do not record requests for our own scripts
+            if (url.endsWith("mapper-worker.js") || url.endsWith("instrument.js")) {
+                return;
+            }
+            const event = {kind, method: String(method || "").toUpperCase(), url, script: callingScript(), detail: detail || ""};
+            const key = JSON.stringify(event);
+            const pending = pendingEvents.get(key);
+            if (pending) {
+                pending.count++;
+            } else {
+                event.count = 1;
+                pendingEvents.set(key, event);
+            }
+            scheduleSend();
+        } catch (e) {
+            // Never break the page
+        }
+    }
+
+    // Send queued events to Cartograph in batches, rather than once per event
+    let sendTimer = null;
+
+    function scheduleSend() {
+        if (sendTimer === null) {
+            sendTimer = setTimeout(send, 2000);
+        }
+    }
+
+    function send() {
+        sendTimer = null;
+        if (pendingEvents.size === 0 || typeof originalFetch !== "function") {
+            return;
+        }
+        const data = {page: currentUrl, events: Array.from(pendingEvents.values())};
+        pendingEvents = new Map();
+        originalFetch.call(window, currentUrl, {
+            method: "POST",
+            headers: {
+                "Content-Type": "application/json",
+                "X-Cartograph": "instrument-data",
+            },
+            body: JSON.stringify(data),
+            keepalive: true,
+        }).catch(() => {
+            // Never break the page
+        });
+    }
+
+    // Send anything left when the page is hidden, as it may not come back
+    window.addEventListener("pagehide", send);
+
+    // fetch
+    if (typeof originalFetch === "function") {
+        window.fetch = function (input, init) {
+            const isRequest = typeof Request !== "undefined" && input instanceof Request;
+            const method = (init && init.method) || (isRequest ? input.method : "GET");
+            record("fetch", method, absoluteUrl(isRequest ? input.url : input), "");
+            return originalFetch.apply(this, arguments);
+        };
+    }
+
+    // XMLHttpRequest, recorded when the request is sent
+    const requests = new WeakMap();
+    const originalOpen = XMLHttpRequest.prototype.open;
+    XMLHttpRequest.prototype.open = function (method, url) {
+        requests.set(this, {method, url: absoluteUrl(url)});
+        return originalOpen.apply(this, arguments);
+    };
+    const originalSend = XMLHttpRequest.prototype.send;
+    XMLHttpRequest.prototype.send = function () {
+        const request = requests.get(this);
+        if (request) {
+            record("xhr", request.method, request.url, "");
+        }
+        return originalSend.apply(this, arguments);
+    };
+
+    // WebSocket connections, and the messages sent on them
+    if (typeof WebSocket === "function") {
+        const OriginalWebSocket = WebSocket;
+        window.WebSocket = new Proxy(OriginalWebSocket, {
+            construct(target, args, newTarget) {
+                record("websocket", "CONNECT", absoluteUrl(args[0]), "");
+                return Reflect.construct(target, args, newTarget);
+            },
+        });
+        const originalWebSocketSend = OriginalWebSocket.prototype.send;
+        OriginalWebSocket.prototype.send = function () {
+            record("websocket", "SEND", this.url, "");
+            return originalWebSocketSend.apply(this, arguments);
+        };
+    }
+
+    // Messages received from other windows and frames, with the keys of their data
+    window.addEventListener("message", (event) => {
+        let keys = "";
+        if (event.data && typeof event.data === "object") {
+            keys = Object.keys(event.data).sort().slice(0, 20).join(",");
+        }
+        record("postmessage", "RECEIVE", event.origin, keys);
+    }, true);
+
+    // localStorage writes, with their keys but never their values
+    if (typeof Storage === "function") {
+        const storageHook = function (method, original) {
+            return function (key) {
+                try {
+                    if (this === window.localStorage) {
+                        record("storage", method, window.location.origin, method === "CLEAR" ? "" : String(key));
+                    }
+                } catch (e) {
+                    // Never break the page
+                }
+                return original.apply(this, arguments);
+            };
+        };
+        Storage.prototype.setItem = storageHook("SET", Storage.prototype.setItem);
+        Storage.prototype.removeItem = storageHook("REMOVE", Storage.prototype.removeItem);
+        Storage.prototype.clear = storageHook("CLEAR", Storage.prototype.clear);
+    }
+})();
@@ -0,0 +1,36 @@
+package mapper
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/TheHackerDev/cartograph/internal/shared/datatypes"
+)
+
+func TestRecordInstrumentEvents(t *testing.T) {
+	m := &Mapper{pendingInstrumentEvents: make(map[instrumentEventKey]*instrumentEvent)}
+	pageURL, _ := url.Parse("https://app.example.com/dashboard?tab=1")
+	first := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	login := datatypes.InstrumentBrowserEvent{Kind: datatypes.InstrumentKindFetch, Method: "POST", URL: "https://api.example.com/login", Script: "https://app.example.com/app.js", Count: 3}
+	m.recordInstrumentEvents(pageURL, []datatypes.InstrumentBrowserEvent{
+		login,
+		{Kind: "eval", URL: "https://app.example.com/"},
+		{Kind: datatypes.InstrumentKindStorage, Method: "SET", URL: "https://app.example.com", Detail: "token"},
+	}, first)
+	m.recordInstrumentEvents(pageURL, []datatypes.InstrumentBrowserEvent{login}, first.Add(time.Minute))
+
+	if len(m.pendingInstrumentEvents) != 2 {
+		t.Fatalf("recorded %d events, want 2 (unknown kinds are skipped)", len(m.pendingInstrumentEvents))
+	}
+	key := instrumentEventKey{pageScheme: "https", pageHost: "app.example.com", pagePath: "/dashboard", kind: "fetch", method: "POST", url: login.URL, script: login.Script}
+	event := m.pendingInstrumentEvents[key]
+	if event == nil || event.count != 6 || !event.firstSeen.Equal(first) || !event.lastSeen.Equal(first.Add(time.Minute)) {
+		t.Errorf("login event = %+v, want a count of 6 seen from %s to %s", event, first, first.Add(time.Minute))
+	}
+	storageKey := instrumentEventKey{pageScheme: "https", pageHost: "app.example.com", pagePath: "/dashboard", kind: "storage", method: "SET", url: "https://app.example.com", detail: "token"}
+	if event := m.pendingInstrumentEvents[storageKey]; event == nil || event.count != 1 {
+		t.Errorf("storage event = %+v, want a count of 1", event)
+	}
+}
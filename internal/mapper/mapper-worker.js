@@ -4,15 +4,15 @@
 // Listen for messages from the main thread
 self.addEventListener("message", (event) => {
     const currentUrl = event.data.currentUrl;
-    const urls = event.data.urls;
+    const edges = event.data.edges;
 
     // Return if there is no data left to send
-    if (urls.length === 0) {
+    if (!edges || edges.length === 0) {
         return;
     }
 
-    // Send the URLs to Cartograph Mapper
-    const data = {source: currentUrl, destinations: urls};
+    // Send the edges to Cartograph Mapper
+    const data = {source: currentUrl, edges};
     fetch(currentUrl, {
         method: "POST",
         headers: {
@@ -1,15 +1,14 @@
 package mapper
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"math/rand"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
-	"strings"
 	"sync"
 	"time"
 
@@ -18,14 +17,20 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"github.com/TheHackerDev/cartograph/internal/config"
+	"github.com/TheHackerDev/cartograph/internal/mapper/analytics"
+	"github.com/TheHackerDev/cartograph/internal/shared/csp"
 	"github.com/TheHackerDev/cartograph/internal/shared/database"
 	"github.com/TheHackerDev/cartograph/internal/shared/datatypes"
+	"github.com/TheHackerDev/cartograph/internal/shared/dispatch"
 	internalHttp "github.com/TheHackerDev/cartograph/internal/shared/http"
+	"github.com/TheHackerDev/cartograph/internal/shared/metrics"
 )
 
 const (
-	referredDataBufferSize int = 100
-	referredDataCacheSize  int = 40
+	referredDataCacheSize int = 40
+
+	// analyticsCacheSize is the number of graphs whose analytics are cached, for the rankings and graph exports.
+	analyticsCacheSize int = 16
 )
 
 // NewMapper returns a new mapper object using the given configuration.
@@ -34,13 +39,21 @@ const (
 func NewMapper(cfg *config.Config) (*Mapper, error) {
 	// Create a new mapper object
 	mapper := &Mapper{
-		mu:                     sync.RWMutex{},
-		cfg:                    cfg,
-		enabled:                true,
-		referredDataInput:      make(chan *datatypes.ReferrerData, referredDataBufferSize),
-		referredDataCache:      make([]*datatypes.ReferrerData, 0, referredDataCacheSize),
-		mapperScriptName:       "mapper.js",
-		mapperWorkerScriptName: "mapper-worker.js",
+		mu:                      sync.RWMutex{},
+		cfg:                     cfg,
+		enabled:                 true,
+		referredDataCache:       make([]*datatypes.ReferrerData, 0, referredDataCacheSize),
+		certOrganisations:       make(map[string]string),
+		pendingOrganisations:    make(map[string]string),
+		retryBatches:            retryQueue{max: maxRetryBatches},
+		coverage:                csp.NewRecorder("mapper"),
+		analytics:               analytics.NewCache(analyticsCacheSize),
+		mapperScriptName:        "mapper.js",
+		mapperWorkerScriptName:  "mapper-worker.js",
+		instrumentScriptName:    "instrument.js",
+		pendingInstrumentEvents: make(map[instrumentEventKey]*instrumentEvent),
+		stop:                    make(chan struct{}),
+		stopped:                 make(chan struct{}),
 	}
 
 	// Get database connections
@@ -48,6 +61,7 @@ func NewMapper(cfg *config.Config) (*Mapper, error) {
 	if dbConnPoolErr != nil {
 		return nil, fmt.Errorf("unable to get database connection pool: %w", dbConnPoolErr)
 	}
+	metrics.RegisterDbPool("mapper", dbConnPool)
 	insertDbConn, insertDbConnErr := database.GetDbConn(cfg.DbConnString)
 	if insertDbConnErr != nil {
 		return nil, fmt.Errorf("unable to get insert database connection: %w", insertDbConnErr)
@@ -57,6 +71,12 @@ func NewMapper(cfg *config.Config) (*Mapper, error) {
 	mapper.dbConnPool = dbConnPool
 	mapper.insertDbConn = insertDbConn
 
+	// Create the input queue
+	var queueErr error
+	if mapper.referredDataInput, queueErr = dispatch.NewQueue[*datatypes.ReferrerData]("mapper", cfg.MapperQueue); queueErr != nil {
+		return nil, fmt.Errorf("unable to create referred data input queue: %w", queueErr)
+	}
+
 	// Load the mapper JavaScript files from disk
 	if loadScriptsErr := mapper.loadScripts(cfg.MapperScriptDir); loadScriptsErr != nil {
 		return nil, fmt.Errorf("unable to load mapper scripts: %w", loadScriptsErr)
@@ -81,15 +101,32 @@ type Mapper struct {
 	dbConnPool *pgxpool.Pool
 
 	// insertDbConn is a single database connection, used to insert data into the database (which happens serially
-	// from this plugin).
+	// from this plugin's Run loop). It is replaced with a new connection if a batch fails to save.
 	insertDbConn *pgx.Conn
 
+	// retryBatches holds the batches of referred data that failed to save, to be retried with backoff.
+	retryBatches retryQueue
+
 	// referredDataInput is used to accept link data that will be logged to the database.
-	referredDataInput chan *datatypes.ReferrerData
+	referredDataInput *dispatch.Queue[*datatypes.ReferrerData]
 
 	// referredDataCache is used to temporarily cache link data before sending it to the database in a batch copy.
 	referredDataCache []*datatypes.ReferrerData
 
+	// certOrganisations holds the organisations observed in TLS certificates, by registrable domain.
+	certOrganisations map[string]string
+
+	// pendingOrganisations holds the organisations observed in TLS certificates that have not yet been saved to the
+	// database, by registrable domain.
+	pendingOrganisations map[string]string
+
+	// coverage records whether the mapper script was allowed by the policy of each page it was injected into.
+	coverage *csp.Recorder
+
+	// analytics caches the analytics of recently ranked or exported graphs, so that repeated requests for the same
+	// graph don't compute them again.
+	analytics *analytics.Cache
+
 	// MapperScript is a JavaScript file that is injected onto browser pages to find and save URLs found on the page.
 	MapperScript []byte
 
@@ -104,11 +141,35 @@ type Mapper struct {
 	// MapperWorkerScript is a web worker JavaScript file that sends the discovered URLs to the mapper plugin
 	// asynchronously, so as not to block the main thread.
 	MapperWorkerScript []byte
+
+	// instrumentScriptName is the name of the optional JavaScript file injected before the mapper script, which
+	// records the client-side API calls made on the page.
+	instrumentScriptName string
+
+	// InstrumentScript is the optional JavaScript file injected before the mapper script, which records the
+	// client-side API calls made on the page. It is only loaded if instrumentation is enabled.
+	InstrumentScript []byte
+
+	// pendingInstrumentEvents holds the client-side API calls observed by the instrumentation script that have not
+	// yet been saved to the database.
+	pendingInstrumentEvents map[instrumentEventKey]*instrumentEvent
+
+	// stop is closed to signal the Run loop to flush its cache and return.
+	stop chan struct{}
+
+	// stopped is closed by the Run loop once its cache has been flushed.
+	stopped chan struct{}
+
+	// stopOnce ensures the stop channel is only closed once.
+	stopOnce sync.Once
 }
 
 // Run runs the mapper plugin.
 // Any errors returned should be considered fatal.
 func (m *Mapper) Run() error {
+	// Signal Stop once the loop has returned
+	defer close(m.stopped)
+
 	// Create a ticker for flushing out the local caches.
 	// Use a random interval to prevent bottlenecks in the database by competing services.
 	// The random time is anywhere between 40 and 120 seconds.
@@ -117,35 +178,141 @@ func (m *Mapper) Run() error {
 	// Handle referred data sent to the mapper
 	for {
 		select {
-		case referredData := <-m.referredDataInput:
-			// Check that the referred data is a mapper target
-			if !m.cfg.IsTarget(referredData.Referer.Host, referredData.Destination.Host) {
-				continue
+		case <-m.stop:
+			// Stop reading spilled data back into the input queue, handle any data still waiting in memory, then
+			// flush the cache to the database
+			if closeErr := m.referredDataInput.Close(); closeErr != nil {
+				log.WithError(closeErr).Error("unable to close referred data input queue")
 			}
-
-			// Add the referred data to the cache
-			m.saveToCache(referredData)
-
-			// If the cache is full, flush it to the database, then clear the cache
-			if len(m.referredDataCache) >= referredDataCacheSize {
-				m.saveCacheToDatabase()
-				m.clearCache()
+			for drained := false; !drained; {
+				select {
+				case referredData := <-m.referredDataInput.Items():
+					m.handleReferredData(referredData)
+				default:
+					drained = true
+				}
 			}
+			m.flushCache()
+
+			// Make a final attempt to save any failed batches, as they are only held in memory, dropping those that
+			// still fail
+			m.retryFailedBatches(true)
+			return nil
+		case referredData := <-m.referredDataInput.Items():
+			m.handleReferredData(referredData)
 		case <-cacheFlushTicker.C:
 			// Flush the cache to the database, then clear the cache
-			m.saveCacheToDatabase()
-			m.clearCache()
+			m.flushCache()
 		}
 	}
 }
 
+// Stop signals the mapper plugin to stop, and blocks until all cached data has been saved to the database.
+// It must only be called after Run has been started.
+func (m *Mapper) Stop() {
+	m.stopOnce.Do(func() {
+		close(m.stop)
+	})
+	<-m.stopped
+}
+
+// handleReferredData adds the given referred data to the cache, and saves the cache to the database once it is full.
+func (m *Mapper) handleReferredData(referredData *datatypes.ReferrerData) {
+	// Check that the referred data is a mapper target
+	if !m.cfg.IsTarget(referredData.Referer.Host, referredData.Destination.Host) {
+		return
+	}
+
+	// Add the referred data to the cache
+	m.saveToCache(referredData)
+
+	// If the cache is full, flush it to the database, then clear the cache
+	if len(m.referredDataCache) >= referredDataCacheSize {
+		m.flushCache()
+	}
+}
+
+// flushCache saves the cache to the database, then clears the cache. Failed batches that are due to be retried are
+// saved first, so that data reaches the database in the order it was seen.
+func (m *Mapper) flushCache() {
+	m.retryFailedBatches(false)
+	batch := m.cacheBatch()
+	m.clearCache()
+	_ = m.saveBatch(batch, false)
+
+	if saveOrganisationsErr := m.saveOrganisationsToDatabase(); saveOrganisationsErr != nil {
+		log.WithError(saveOrganisationsErr).Error("unable to save certificate organisations to database")
+	}
+
+	if saveInstrumentEventsErr := m.saveInstrumentEventsToDatabase(); saveInstrumentEventsErr != nil {
+		log.WithError(saveInstrumentEventsErr).Error("unable to save instrumentation events to database")
+	}
+
+	if saveCoverageErr := m.coverage.Save(context.Background(), m.dbConnPool); saveCoverageErr != nil {
+		log.WithError(saveCoverageErr).Error("unable to save mapper injection coverage to database")
+	}
+}
+
+// QueueStats returns the statistics for the mapper's input queue.
+func (m *Mapper) QueueStats() []dispatch.Stats {
+	return []dispatch.Stats{m.referredDataInput.Stats()}
+}
+
 // LogReferredData is used to send a referred data object to the mapper plugin for processing.
+// It does not block; if the input queue is full, the data is handled according to the queue policy.
 func (m *Mapper) LogReferredData(referredData *datatypes.ReferrerData) {
 	// Check if enabled first
 	if !m.Enabled() {
 		return
 	}
-	m.referredDataInput <- referredData
+	m.referredDataInput.Enqueue(referredData)
+}
+
+// LogBrowserData sends the destinations found by the mapper browser scripts to the mapper plugin for processing.
+// Destinations with an unknown type are treated as links, and destinations that cannot be parsed are skipped.
+// An error is returned if the source URL cannot be parsed.
+func (m *Mapper) LogBrowserData(browserData *datatypes.MapperBrowserData) error {
+	// Check if enabled first
+	if !m.Enabled() {
+		return nil
+	}
+
+	// Parse the source URL
+	sourceURL, sourceParseErr := url.Parse(browserData.Source)
+	if sourceParseErr != nil {
+		return fmt.Errorf("unable to parse source URL from mapper data: %w", sourceParseErr)
+	}
+
+	// Older scripts only send untyped destinations
+	edges := browserData.Edges
+	for _, destination := range browserData.Destinations {
+		edges = append(edges, datatypes.MapperBrowserEdge{URL: destination, Type: datatypes.EdgeTypeLink})
+	}
+
+	for _, edge := range edges {
+		// Parse the destination URL
+		destinationURL, destinationParseErr := url.Parse(edge.URL)
+		if destinationParseErr != nil {
+			log.WithError(destinationParseErr).Error("unable to parse destination URL from mapper data")
+			continue
+		}
+
+		edgeType := edge.Type
+		if !datatypes.IsEdgeType(edgeType) {
+			edgeType = datatypes.EdgeTypeLink
+		}
+
+		m.LogReferredData(&datatypes.ReferrerData{
+			Referer:     *sourceURL,
+			Destination: *destinationURL,
+			Timestamp:   time.Now(),
+			Type:        edgeType,
+			Element:     edge.Element,
+			Attribute:   edge.Attribute,
+		})
+	}
+
+	return nil
 }
 
 // saveToCache saves the given referred data to the cache, which will eventually be saved to the database in a batch.
@@ -173,35 +340,6 @@ func (m *Mapper) clearCache() {
 	m.referredDataCache = m.referredDataCache[:0]
 }
 
-// saveCacheToDatabase saves the cache to the database.
-// All errors are logged by this function, but for sake of speed over accuracy, there is currently no retry
-// mechanism for any individual row being added.
-func (m *Mapper) saveCacheToDatabase() {
-	ctx := context.Background()
-
-	// Lock the mutex, so we can safely access the cache
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-
-	// Save the cache to the database, one element at a time
-	for _, referredData := range m.referredDataCache {
-		// Skip any ridiculously long URL paths in the source or destination (google search is prone to do this), as
-		// it will likely overflow the maximum btree v4 index size of 2704 bytes.
-		// We're only really concerned with the path, because the other parts of the btree index (source and
-		// destination scheme and host) are unlikely to ever come close to the maximum size.
-		if len(referredData.Referer.Path) > 1000 || len(referredData.Destination.Path) > 1000 {
-			continue
-		}
-
-		if _, insertErr := m.insertDbConn.Exec(ctx, `INSERT INTO data_mapper (referer_scheme, referer_host, referer_path, destination_scheme, destination_host, destination_path, first_seen, last_seen) VALUES ($1, $2, $3, $4, $5, $6, $7, $7) ON CONFLICT ON CONSTRAINT data_mapper_pk DO UPDATE SET last_seen = $7;`, referredData.Referer.Scheme, referredData.Referer.Host, referredData.Referer.Path, referredData.Destination.Scheme, referredData.Destination.Host, referredData.Destination.Path, referredData.Timestamp); insertErr != nil {
-			log.WithError(insertErr).WithFields(log.Fields{
-				"referer":     referredData.Referer.String(),
-				"destination": referredData.Destination.String(),
-			}).Error("unable to insert referred data into database")
-		}
-	}
-}
-
 // loadScripts loads the mapper script from the given directory and saves the bytes to the mapper plugin.
 func (m *Mapper) loadScripts(directory string) error {
 	// Load the mapper script (mapper.js) from the directory and save to the mapper plugin
@@ -248,6 +386,15 @@ func (m *Mapper) loadScripts(directory string) error {
 	// Save the mapper web worker script to the mapper plugin
 	m.MapperWorkerScript = mapperWorkerScriptBytes
 
+	// Load the instrumentation script (instrument.js), only if it is used
+	if m.cfg.Instrument {
+		instrumentScriptBytes, readInstrumentScriptErr := os.ReadFile(filepath.Join(directory, m.instrumentScriptName))
+		if readInstrumentScriptErr != nil {
+			return fmt.Errorf("unable to read instrumentation script file: %w", readInstrumentScriptErr)
+		}
+		m.InstrumentScript = instrumentScriptBytes
+	}
+
 	return nil
 }
 
@@ -256,105 +403,37 @@ func (m *Mapper) Enabled() bool {
 	return m.enabled
 }
 
-// InjectMapperScript injects the mapper script into the <head> field of the given HTTP response.
-// If an error is returned, JavaScript was not successfully injected into the response.
-func (m *Mapper) InjectMapperScript(response *http.Response, mapperData *datatypes.ReferrerData) error {
+// PrepareMapperScript returns the function preparing the mapper script for injection into the <head> field of the
+// given HTTP response, to be passed to internalHttp.InjectHTML, or nil if the script isn't injected into the response.
+func (m *Mapper) PrepareMapperScript(response *http.Response, mapperData *datatypes.ReferrerData) internalHttp.HTMLPrepareFunc {
 	// Only inject if the mapper plugin is enabled
 	if !m.enabled {
 		return nil
 	}
 
-	if response.Body == http.NoBody {
-		// This shouldn't happen with an HTML response content-type, but just in case...
-		return nil
-	}
-
 	// Check that this is for a valid target
 	if !m.cfg.IsTarget(mapperData.Referer.Host, mapperData.Destination.Host) {
 		return nil
 	}
 
-	// Read response body
-	respBody, bodyCopy, readErr := internalHttp.ReadBody(response.Body)
-	response.Body = bodyCopy
-	if readErr != nil {
-		return fmt.Errorf("unable to read response body: %w", readErr)
-	}
-
-	// Odd edge case, but it's happened
-	if len(respBody) == 0 {
-		return nil
-	}
-
-	switch strings.ToLower(response.Header.Get("content-encoding")) {
-	// No compression
-	case "":
-		break
-	// Gzip compression
-	case "gzip":
-		// Decode response body
-		var decodeErr error
-		respBody, decodeErr = internalHttp.DecodeGzip(respBody)
-		if decodeErr != nil {
-			return fmt.Errorf("unable to gzip-decode response body: %w", decodeErr)
-		}
-	case "br":
-		// Decode response body
-		var decodeErr error
-		respBody, decodeErr = internalHttp.DecodeBrotli(respBody)
-		if decodeErr != nil {
-			return fmt.Errorf("unable to brotli-decode response body: %w", decodeErr)
-		}
-	case "deflate":
-		// Decode response body
-		var decodeErr error
-		respBody, decodeErr = internalHttp.DecodeDeflate(respBody)
-		if decodeErr != nil {
-			return fmt.Errorf("unable to deflate-decode response body: %w", decodeErr)
+	return func(document []byte) ([]byte, string) {
+		// Allow the mapper script, the web worker it starts from a blob URL, and the requests it sends back to the
+		// page's origin, under the page's Content-Security-Policy
+		page := csp.NewPage(&mapperData.Destination, response.Header, document, m.cfg.CSPRewrite)
+		attributes := page.AllowScript(m.mapperScriptName, "")
+		page.AllowWorker("blob")
+		page.AllowConnect(mapperData.Destination.Path)
+
+		// The instrumentation script goes first, so that its hooks are in place before any of the page's scripts run
+		headInject := ""
+		if m.cfg.Instrument {
+			headInject = fmt.Sprintf(`<script type="text/javascript" src=%q%s></script>`, m.instrumentScriptName, page.AllowScript(m.instrumentScriptName, ""))
 		}
-	default:
-		return fmt.Errorf("unsupported content-encoding in response: %s", response.Header.Get("content-encoding"))
-	}
+		headInject += fmt.Sprintf(`<script type="text/javascript" src=%q%s></script>`, m.mapperScriptName, attributes)
+		m.coverage.Record(mapperData.Destination, page)
 
-	// Prepare the mapper script tag to inject into the response
-	jsHeadInject := fmt.Sprintf(`<script type="text/javascript" src=%q"></script>`, m.mapperScriptName)
-
-	// Find the head section of the HTML document within the first 1000 bytes (or the entire body, whichever is
-	// smaller)
-	headIndex := bytes.Index(respBody[:min(len(respBody), 1000)], []byte("<head>"))
-	if headIndex == -1 {
-		// Check for variations of the <head> tag to inject into
-		headIndex = bytes.Index(respBody[:min(len(respBody), 1000)], []byte("<HEAD>"))
-		if headIndex == -1 {
-			// "head" tag not found, so we can't inject.
-			// In many cases, this is because the response is not HTML, so we'll just ignore it.
-			return nil
-		}
+		return page.Apply(response.Header), headInject
 	}
-	// Create a new byte slice to hold the new response body
-	newBody := make([]byte, 0, len(respBody)+len(jsHeadInject))
-	// Copy over the response body up to and including the <head> tag
-	newBody = append(newBody, respBody[:headIndex+len("<head>")]...)
-	// Append the script elements after the <head> tag
-	newBody = append(newBody, []byte(jsHeadInject)...)
-	// Add the rest of the response body back on
-	newBody = append(newBody, respBody[headIndex+len("<head>"):]...)
-	// Replace the response body with the new one
-	respBody = newBody
-
-	// Save updated response body
-	response.Body = io.NopCloser(bytes.NewReader(respBody))
-
-	// Remove the "Content-Security-Policy" header, if present, to allow the injection of scripts
-	response.Header.Del("Content-Security-Policy")
-
-	// Modify headers
-	response.ContentLength = int64(len(respBody))
-	response.Header.Set("content-length", fmt.Sprintf("%d", len(respBody)))
-	response.Header.Set("content-type", "text/html; charset=utf-8")
-	response.Header.Del("content-encoding") // sending it uncompressed
-
-	return nil
 }
 
 // GetMapperScriptName returns the name of the mapper script file.
@@ -1,12 +1,21 @@
-
-function sendUrlsToCartographMapper() {
+(function () {
     const currentUrl = window.location.href;
-    const urlMap = new Map();
+
+    // Edges that have already been found, keyed by type and URL, so that each is only sent once
+    const edgeMap = new Map();
+
+    // Edges waiting to be sent to the web worker
+    let pendingEdges = [];
+
+    // The web worker that sends edges to Cartograph Mapper, once it has loaded
+    let worker = null;
 
     // Array of non-standard URL schemes
     const nonStandardSchemes = [
         "javascript:",
         "data:",
+        "blob:",
+        "about:",
         "mailto:",
         "tel:",
         "sms:",
@@ -23,142 +32,187 @@ function sendUrlsToCartographMapper() {
         "#", // This is a special case, since it's not a URL scheme, just a fragment
     ];
 
-    // Find all URLs in various HTML elements
-    Array.from(document.getElementsByTagName("a")).forEach((a) => {
-        // Remove any links using non-standard URL schemes
-        if (nonStandardSchemes.some((scheme) => a.href.startsWith(scheme))) {
-            return;
-        }
+    // The edge type for each element and URL attribute
+    const elementAttributes = [
+        {selector: "a[href]", attribute: "href", type: "link"},
+        {selector: "area[href]", attribute: "href", type: "link"},
+        {selector: "img[src]", attribute: "src", type: "image"},
+        {selector: "link[href]", attribute: "href", type: "resource"},
+        {selector: "script[src]", attribute: "src", type: "script"},
+        {selector: "iframe[src]", attribute: "src", type: "iframe"},
+        {selector: "frame[src]", attribute: "src", type: "iframe"},
+        {selector: "embed[src]", attribute: "src", type: "iframe"},
+        {selector: "object[data]", attribute: "data", type: "iframe"},
+        {selector: "video[src]", attribute: "src", type: "media"},
+        {selector: "audio[src]", attribute: "src", type: "media"},
+        {selector: "source[src]", attribute: "src", type: "media"},
+        {selector: "track[src]", attribute: "src", type: "media"},
+        {selector: "form", attribute: "action", type: "form"},
+    ];
 
-        const url = new URL(a.href, currentUrl);
-        urlMap.set(url.href, true);
-    });
-    Array.from(document.getElementsByTagName("img")).forEach((img) => {
-        // Don't add links that use the "data:" URL scheme
-        if (img.src.startsWith("data:")) {
+    // addEdge records a single edge, and queues it to be sent if it has not been seen before
+    function addEdge(rawUrl, type, element, attribute) {
+        if (!rawUrl) {
             return;
         }
+        rawUrl = String(rawUrl).trim();
 
-        const url = new URL(img.src, currentUrl);
-        urlMap.set(url.href, true);
-    });
-    Array.from(document.getElementsByTagName("link")).forEach((link) => {
-        const url = new URL(link.href, currentUrl);
-        urlMap.set(url.href, true);
-    });
-    Array.from(document.getElementsByTagName("script")).forEach((script) => {
-        // Do not add references to our own scripts
-        if (script.src.includes("mapper.js")) {
+        // Skip links using non-standard URL schemes
+        if (nonStandardSchemes.some((scheme) => rawUrl.startsWith(scheme))) {
             return;
         }
 
-        const url = new URL(script.src, currentUrl);
-        urlMap.set(url.href, true);
-    });
-    Array.from(document.getElementsByTagName("iframe")).forEach((iframe) => {
-        // Don't add links that use the "data:" URL scheme
-        if (iframe.src.startsWith("data:")) {
+        let url;
+        try {
+            url = new URL(rawUrl, currentUrl);
+        } catch (e) {
             return;
         }
 
-        const url = new URL(iframe.src, currentUrl);
-        urlMap.set(url.href, true);
-    });
-    Array.from(document.getElementsByTagName("embed")).forEach((embed) => {
-        // Don't add links that use the "data:" URL scheme
-        if (embed.src.startsWith("data:")) {
+        // Do not add references to our own scripts
+        if (url.pathname.endsWith("mapper.js") || url.pathname.endsWith("mapper-worker.js")) {
             return;
         }
 
-        const url = new URL(embed.src, currentUrl);
-        urlMap.set(url.href, true);
-    });
-    ["video", "audio"].forEach((tagName) => {
-        Array.from(document.getElementsByTagName(tagName)).forEach(
-            (mediaElement) => {
-                Array.from(mediaElement.getElementsByTagName("source")).forEach(
-                    (source) => {
-                        const url = new URL(source.src, currentUrl);
-                        urlMap.set(url.href, true);
-                    }
-                );
-            }
-        );
-    });
-    Array.from(document.getElementsByTagName("track")).forEach((track) => {
-        const url = new URL(track.src, currentUrl);
-        urlMap.set(url.href, true);
-    });
-    Array.from(document.getElementsByTagName("object")).forEach((obj) => {
-        // Don't add links that use the "data:" URL scheme
-        if (obj.data.startsWith("data:")) {
+        const key = `${type} ${url.href}`;
+        if (edgeMap.has(key)) {
             return;
         }
-
-        const url = new URL(obj.data, currentUrl);
-        urlMap.set(url.href, true);
-    });
-    Array.from(document.getElementsByTagName("form")).forEach((form) => {
-        const url = new URL(form.action || currentUrl, currentUrl);
-        urlMap.set(url.href, true);
-    });
-
-    // Fetch and create web worker as blob, so I can add a custom header to the
-    // request
-    const xhr = new XMLHttpRequest();
-    xhr.open("GET", "mapper-worker.js");
-    xhr.responseType = "blob";
-    xhr.onload = function () {
-        const workerBlob = this.response;
-        const worker = new Worker(URL.createObjectURL(workerBlob));
-
-        // Send a message to the web worker with the current URL and URLs to map
-        worker.postMessage({currentUrl, urls: Array.from(urlMap.keys())});
-
-        // Listen for messages from the web worker
-        worker.addEventListener("message", (event) => {
-            // console.log(event.data);
+        edgeMap.set(key, true);
+
+        pendingEdges.push({url: url.href, type, element, attribute});
+        scheduleSend();
+    }
+
+    // addElementEdges records the edges for the given element, if it holds a URL
+    function addElementEdges(element) {
+        elementAttributes.forEach(({selector, attribute, type}) => {
+            if (element.matches(selector)) {
+                // Forms without an action submit to the current page
+                const value = attribute === "action" ? element.getAttribute(attribute) || currentUrl : element.getAttribute(attribute);
+                addEdge(value, type, element.tagName.toLowerCase(), attribute);
+            }
         });
+    }
 
-        // Monitor the DOM for newly added URLs
-        const observer = new MutationObserver((mutationsList) => {
-            for (const mutation of mutationsList) {
-                for (const target of mutation.addedNodes) {
-                    if (target instanceof Element) {
-                        const urlAttributes = ["href", "src", "data", "action"];
-                        const urlValues = urlAttributes
-                            .map((attr) => target.getAttribute(attr))
-                            .filter(Boolean);
-
-                        urlValues.forEach((url) => {
-                            const absoluteUrl = new URL(url, currentUrl).href;
-                            if (!urlMap.has(absoluteUrl)) {
-                                // Add the URL to the list of URLs to map
-                                urlMap.set(absoluteUrl, true);
-
-                                // Send a message to the web worker with the current URL and new URL to map
-                                worker.postMessage({currentUrl, urls: [absoluteUrl]});
-                            }
-                        });
-                    }
-                }
-            }
+    // addTreeEdges records the edges for the given element and all of its descendants
+    function addTreeEdges(root) {
+        if (root instanceof Element) {
+            addElementEdges(root);
+        }
+        elementAttributes.forEach(({selector}) => {
+            root.querySelectorAll(selector).forEach(addElementEdges);
         });
+    }
 
-        // Start observing changes to the DOM tree
-        observer.observe(document.body, {childList: true, subtree: true});
-    };
+    // Send queued edges to the web worker in batches, rather than once per edge
+    let sendTimer = null;
 
-    xhr.send();
-}
+    function scheduleSend() {
+        if (worker === null || sendTimer !== null) {
+            return;
+        }
+        sendTimer = setTimeout(() => {
+            sendTimer = null;
+            if (pendingEdges.length === 0) {
+                return;
+            }
+            worker.postMessage({currentUrl, edges: pendingEdges});
+            pendingEdges = [];
+        }, 1000);
+    }
+
+    // Hook the script APIs that make requests, so that API calls become edges
+    const originalFetch = window.fetch;
+    if (typeof originalFetch === "function") {
+        window.fetch = function (input, init) {
+            try {
+                addEdge(input instanceof Request ? input.url : input, "fetch", "fetch", "");
+            } catch (e) {
+                // Never break the page
+            }
+            return originalFetch.apply(this, arguments);
+        };
+    }
+
+    const originalOpen = XMLHttpRequest.prototype.open;
+    XMLHttpRequest.prototype.open = function (method, url) {
+        try {
+            addEdge(url, "fetch", "xmlhttprequest", "");
+        } catch (e) {
+            // Never break the page
+        }
+        return originalOpen.apply(this, arguments);
+    };
 
-// Check if the window has loaded.
-// If it has, run the script.
-// If it hasn't, wait for the window to load and then run the script.
-if (document.readyState === "complete") {
-    sendUrlsToCartographMapper();
-} else {
-    window.addEventListener("load", function () {
+    if (navigator.sendBeacon) {
+        const originalSendBeacon = navigator.sendBeacon;
+        navigator.sendBeacon = function (url) {
+            try {
+                addEdge(url, "fetch", "sendbeacon", "");
+            } catch (e) {
+                // Never break the page
+            }
+            return originalSendBeacon.apply(this, arguments);
+        };
+    }
+
+    function sendUrlsToCartographMapper() {
+        // Find all URLs in the page
+        addTreeEdges(document);
+
+        // Fetch and create web worker as blob, so I can add a custom header to the
+        // request
+        const xhr = new XMLHttpRequest();
+        originalOpen.call(xhr, "GET", "mapper-worker.js");
+        xhr.responseType = "blob";
+        xhr.onload = function () {
+            const workerBlob = this.response;
+            worker = new Worker(URL.createObjectURL(workerBlob));
+
+            // Listen for messages from the web worker
+            worker.addEventListener("message", (event) => {
+                // console.log(event.data);
+            });
+
+            // Send the edges found so far
+            scheduleSend();
+
+            // Monitor the DOM for newly added elements, and for URLs changed on existing elements
+            const observer = new MutationObserver((mutationsList) => {
+                for (const mutation of mutationsList) {
+                    if (mutation.type === "attributes") {
+                        addElementEdges(mutation.target);
+                        continue;
+                    }
+                    for (const target of mutation.addedNodes) {
+                        if (target instanceof Element) {
+                            addTreeEdges(target);
+                        }
+                    }
+                }
+            });
+
+            // Start observing changes to the DOM tree
+            observer.observe(document.documentElement, {
+                childList: true,
+                subtree: true,
+                attributes: true,
+                attributeFilter: ["href", "src", "data", "action"],
+            });
+        };
+
+        xhr.send();
+    }
+
+    // Check if the window has loaded.
+    // If it has, run the script.
+    // If it hasn't, wait for the window to load and then run the script.
+    if (document.readyState === "complete") {
         sendUrlsToCartographMapper();
-    });
-}
+    } else {
+        window.addEventListener("load", function () {
+            sendUrlsToCartographMapper();
+        });
+    }
+})();
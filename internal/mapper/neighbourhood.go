@@ -0,0 +1,216 @@
+package mapper
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/TheHackerDev/cartograph/internal/shared/datatypes/graph"
+)
+
+// Traversal directions for neighbourhood queries.
+const (
+	directionOutbound string = "outbound"
+	directionInbound  string = "inbound"
+	directionBoth     string = "both"
+)
+
+// Neighbourhood query limits.
+const (
+	neighbourhoodDefaultDepth    int = 2
+	neighbourhoodMaxDepth        int = 6
+	neighbourhoodDefaultMaxNodes int = 1000
+	neighbourhoodMaxNodes        int = 10000
+)
+
+// neighbourhoodQuery describes a traversal of the host graph from a single host.
+type neighbourhoodQuery struct {
+	// Host is the host to start from.
+	Host string
+
+	// Depth is the maximum number of connections to follow from the host.
+	Depth int
+
+	// Direction is the direction of connections to follow: outbound (from referer to destination), inbound (from
+	// destination to referer), or both.
+	Direction string
+
+	// Window limits the traversal to connections seen within a period of time.
+	Window timeWindow
+
+	// MaxNodes is the maximum number of hosts to include in the result.
+	MaxNodes int
+}
+
+// parseNeighbourhoodQuery parses a neighbourhood query from the query parameters of the given request.
+func parseNeighbourhoodQuery(r *http.Request) (*neighbourhoodQuery, error) {
+	query := r.URL.Query()
+
+	nq := &neighbourhoodQuery{
+		Host:      query.Get("host"),
+		Depth:     neighbourhoodDefaultDepth,
+		Direction: directionBoth,
+		MaxNodes:  neighbourhoodDefaultMaxNodes,
+	}
+	if nq.Host == "" {
+		return nil, fmt.Errorf("host is required")
+	}
+
+	if depth := query.Get("depth"); depth != "" {
+		var atoiErr error
+		if nq.Depth, atoiErr = strconv.Atoi(depth); atoiErr != nil || nq.Depth < 1 || nq.Depth > neighbourhoodMaxDepth {
+			return nil, fmt.Errorf("depth must be between 1 and %d", neighbourhoodMaxDepth)
+		}
+	}
+
+	if direction := query.Get("direction"); direction != "" {
+		switch direction {
+		case directionOutbound, directionInbound, directionBoth:
+			nq.Direction = direction
+		default:
+			return nil, fmt.Errorf("direction must be one of %q, %q, or %q", directionOutbound, directionInbound, directionBoth)
+		}
+	}
+
+	if maxNodes := query.Get("max_nodes"); maxNodes != "" {
+		var atoiErr error
+		if nq.MaxNodes, atoiErr = strconv.Atoi(maxNodes); atoiErr != nil || nq.MaxNodes < 1 || nq.MaxNodes > neighbourhoodMaxNodes {
+			return nil, fmt.Errorf("max_nodes must be between 1 and %d", neighbourhoodMaxNodes)
+		}
+	}
+
+	var windowErr error
+	if nq.Window, windowErr = parseTimeWindow(query, time.Now()); windowErr != nil {
+		return nil, windowErr
+	}
+
+	return nq, nil
+}
+
+// HostNeighbourhoodGraph is an HTTP handler function that returns a graph file to the client containing the hosts
+// connected to the provided host, up to the requested depth, in the requested direction and time window.
+// Each node has a "depth" attribute holding its degrees of separation from the provided host.
+// If the number of hosts exceeds the maximum, the closest hosts are returned and the X-Graph-Truncated response
+// header is set to "true".
+// The format is chosen by the "format" query parameter or the Accept header, and defaults to GEXF.
+// Hosts can be grouped by registrable domain or organisation with the "group" query parameter.
+func (m *Mapper) HostNeighbourhoodGraph(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET requests (or OPTIONS)
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Allow", "GET, OPTIONS")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	} else if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET, OPTIONS")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Choose the output format before doing any work
+	serializer, formatErr := graph.SerializerForRequest(r, graph.FormatGEXF)
+	if formatErr != nil {
+		http.Error(w, formatErr.Error(), graphFormatErrorStatus(r))
+		return
+	}
+
+	// Choose how to group the hosts
+	grouping, groupingErr := parseHostGrouping(r)
+	if groupingErr != nil {
+		http.Error(w, groupingErr.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Parse the query
+	nq, queryErr := parseNeighbourhoodQuery(r)
+	if queryErr != nil {
+		http.Error(w, queryErr.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Traverse the host graph
+	hostMap, truncated, neighbourhoodErr := m.hostNeighbourhood(r.Context(), nq)
+	if neighbourhoodErr != nil {
+		http.Error(w, fmt.Sprintf("problem getting hosts: %s", neighbourhoodErr), http.StatusInternalServerError)
+		return
+	}
+	if truncated {
+		w.Header().Set("X-Graph-Truncated", "true")
+	}
+
+	// Describe how the hosts are connected
+	if typesErr := m.setHostEdgeTypes(r.Context(), hostMap, nq.Window); typesErr != nil {
+		http.Error(w, fmt.Sprintf("problem getting edge types: %s", typesErr), http.StatusInternalServerError)
+		return
+	}
+
+	// Group the hosts and mark first-party and third-party connections
+	hostMap, groupErr := m.groupHostGraph(r.Context(), hostMap, grouping)
+	if groupErr != nil {
+		http.Error(w, fmt.Sprintf("problem grouping hosts: %s", groupErr), http.StatusInternalServerError)
+		return
+	}
+
+	// Write the host map graph to the response
+	m.writeGraph(w, serializer, hostMap, "host_neighbourhood")
+}
+
+// hostNeighbourhood returns the graph of hosts connected to the query host. The second return value is true if hosts
+// were left out to stay within the query's maximum number of nodes.
+func (m *Mapper) hostNeighbourhood(ctx context.Context, nq *neighbourhoodQuery) (*graph.Graph, bool, error) {
+	hostMap := graph.NewGraph(fmt.Sprintf("Hosts within %d degrees of %s", nq.Depth, nq.Host), "connections, hosts")
+	hostMap.DeclareNodeAttribute(graph.AttributeDef{
+		Key:   "depth",
+		Title: "Degrees of separation",
+		Type:  graph.AttributeInteger,
+	})
+	hostMap.SetNodeAttribute(nq.Host, "depth", 0)
+
+	// The traversal stops once one more than the maximum number of hosts are reached, so that truncation can be
+	// detected. Connections are returned closest first, so that the closest hosts are kept when the result is
+	// truncated.
+	sqlSelect := `select referer_host, destination_host, degrees_of_separation, first_seen, last_seen from get_host_neighbourhood($1, $2, $3, $4, $5, $6);`
+	rows, queryErr := m.dbConnPool.Query(ctx, sqlSelect, nq.Host, nq.Depth, nq.Direction, nq.Window.Since, nq.Window.Until, nq.MaxNodes+1)
+	if queryErr != nil {
+		return nil, false, fmt.Errorf("unable to query host neighbourhood: %w", queryErr)
+	}
+	defer rows.Close()
+
+	// Track the depth of each host added to the graph
+	depths := map[string]int{nq.Host: 0}
+	truncated := false
+	for rows.Next() {
+		var referer, destination string
+		var degrees int
+		var firstSeen, lastSeen time.Time
+		if scanErr := rows.Scan(&referer, &destination, &degrees, &firstSeen, &lastSeen); scanErr != nil {
+			return nil, false, fmt.Errorf("unable to scan host connection: %w", scanErr)
+		}
+
+		// Skip connections that would add too many hosts
+		newHosts := 0
+		for _, host := range []string{referer, destination} {
+			if _, ok := depths[host]; !ok {
+				newHosts++
+			}
+		}
+		if len(depths)+newHosts > nq.MaxNodes {
+			truncated = true
+			continue
+		}
+
+		for _, host := range []string{referer, destination} {
+			if _, ok := depths[host]; !ok {
+				depths[host] = degrees
+				hostMap.SetNodeAttribute(host, "depth", degrees)
+			}
+		}
+		hostMap.AddEdgeSpell(referer, destination, firstSeen, lastSeen)
+	}
+	if rowsErr := rows.Err(); rowsErr != nil {
+		return nil, false, fmt.Errorf("unable to read host connections: %w", rowsErr)
+	}
+
+	return hostMap, truncated, nil
+}
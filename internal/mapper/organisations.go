@@ -0,0 +1,286 @@
+package mapper
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/TheHackerDev/cartograph/internal/shared/datatypes/graph"
+	"github.com/TheHackerDev/cartograph/internal/shared/domains"
+	internalHttp "github.com/TheHackerDev/cartograph/internal/shared/http"
+)
+
+// Organisation mapping sources.
+const (
+	organisationSourceUser        string = "user"
+	organisationSourceCertificate string = "certificate"
+)
+
+// Host graph groupings, as used in the "group" query parameter.
+const (
+	groupByHost         string = "host"
+	groupByDomain       string = "domain"
+	groupByOrganisation string = "organisation"
+)
+
+// Edge colors for first-party and third-party connections.
+const (
+	firstPartyColor string = "#4caf50"
+	thirdPartyColor string = "#e91e63"
+)
+
+// Organisation maps a registrable domain to the organisation that owns it.
+type Organisation struct {
+	Domain       string    `json:"domain"`
+	Organisation string    `json:"organisation"`
+	Source       string    `json:"source"`
+	Updated      time.Time `json:"updated"`
+}
+
+// ObserveCertificate records the organisation in the subject of the given host's TLS certificate, if it has one, as
+// the owner of the host's registrable domain. User-supplied mappings take precedence over those from certificates.
+// It does not block; mappings are saved to the database with the next cache flush.
+func (m *Mapper) ObserveCertificate(host string, state *tls.ConnectionState) {
+	if !m.Enabled() || state == nil || len(state.PeerCertificates) == 0 {
+		return
+	}
+	subject := state.PeerCertificates[0].Subject
+	if len(subject.Organization) == 0 || strings.TrimSpace(subject.Organization[0]) == "" {
+		return
+	}
+	organisation := strings.TrimSpace(subject.Organization[0])
+	domain := domains.Registrable(host)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Skip organisations that have already been recorded
+	if m.certOrganisations[domain] == organisation {
+		return
+	}
+	m.certOrganisations[domain] = organisation
+	m.pendingOrganisations[domain] = organisation
+}
+
+// saveOrganisationsToDatabase saves the organisations observed in TLS certificates since the last save to the
+// database, without replacing user-supplied mappings.
+func (m *Mapper) saveOrganisationsToDatabase() error {
+	m.mu.Lock()
+	pending := m.pendingOrganisations
+	m.pendingOrganisations = make(map[string]string)
+	m.mu.Unlock()
+
+	failed := 0
+	for domain, organisation := range pending {
+		if _, upsertErr := m.insertDbConn.Exec(context.Background(), `INSERT INTO mapper_organisations (domain, organisation, source) VALUES ($1, $2, $3) ON CONFLICT ON CONSTRAINT mapper_organisations_pk DO UPDATE SET organisation = excluded.organisation, updated = now() WHERE mapper_organisations.source = $3;`, domain, organisation, organisationSourceCertificate); upsertErr != nil {
+			log.WithError(upsertErr).WithField("domain", domain).Error("unable to save certificate organisation to database")
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("unable to save %d of %d certificate organisations to database", failed, len(pending))
+	}
+
+	return nil
+}
+
+// OrganisationsAPIHandler is an HTTP handler for managing the organisations that own registrable domains, which are
+// used to tell first-party from third-party connections in host graphs.
+//
+// GET requests return all organisation mappings.
+// POST requests add or replace a user-supplied mapping, given as a JSON object with "domain" and "organisation"
+// fields. Hosts are reduced to their registrable domain.
+// DELETE requests remove the mapping for the domain in the "domain" query parameter.
+func (m *Mapper) OrganisationsAPIHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		organisations, getErr := m.getOrganisations(r.Context())
+		if getErr != nil {
+			http.Error(w, fmt.Sprintf("unable to get organisations: %s", getErr), http.StatusInternalServerError)
+			return
+		}
+
+		// Return the organisations as JSON
+		w.Header().Set("Content-Type", "application/json")
+		if jsonMarshalErr := json.NewEncoder(w).Encode(organisations); jsonMarshalErr != nil {
+			http.Error(w, fmt.Sprintf("unable to encode organisations to JSON: %s", jsonMarshalErr), http.StatusInternalServerError)
+			return
+		}
+	case http.MethodPost:
+		reqBody, bodyCopy, bodyReadErr := internalHttp.ReadBody(r.Body)
+		r.Body = bodyCopy
+		if bodyReadErr != nil {
+			http.Error(w, fmt.Sprintf("unable to read request body: %s", bodyReadErr), http.StatusInternalServerError)
+			return
+		}
+		var organisation Organisation
+		if jsonUnmarshalErr := json.Unmarshal(reqBody, &organisation); jsonUnmarshalErr != nil {
+			http.Error(w, fmt.Sprintf("unable to parse JSON request body into organisation object: %s", jsonUnmarshalErr), http.StatusBadRequest)
+			return
+		}
+		organisation.Domain = domains.Registrable(organisation.Domain)
+		organisation.Organisation = strings.TrimSpace(organisation.Organisation)
+		if organisation.Domain == "" || organisation.Organisation == "" {
+			http.Error(w, "domain and organisation are required", http.StatusBadRequest)
+			return
+		}
+
+		if _, upsertErr := m.dbConnPool.Exec(r.Context(), `INSERT INTO mapper_organisations (domain, organisation, source) VALUES ($1, $2, $3) ON CONFLICT ON CONSTRAINT mapper_organisations_pk DO UPDATE SET organisation = excluded.organisation, source = excluded.source, updated = now();`, organisation.Domain, organisation.Organisation, organisationSourceUser); upsertErr != nil {
+			http.Error(w, fmt.Sprintf("unable to save organisation: %s", upsertErr), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		domain := domains.Registrable(r.URL.Query().Get("domain"))
+		if domain == "" {
+			http.Error(w, "no domain provided in \"domain\" query parameter", http.StatusBadRequest)
+			return
+		}
+
+		if _, deleteErr := m.dbConnPool.Exec(r.Context(), `DELETE FROM mapper_organisations WHERE domain = $1;`, domain); deleteErr != nil {
+			http.Error(w, fmt.Sprintf("unable to remove organisation for domain %q: %s", domain, deleteErr), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodOptions:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "invalid HTTP request method: "+r.Method, http.StatusMethodNotAllowed)
+	}
+}
+
+// getOrganisations returns all organisation mappings, ordered by domain.
+func (m *Mapper) getOrganisations(ctx context.Context) ([]Organisation, error) {
+	rows, queryErr := m.dbConnPool.Query(ctx, `SELECT domain, organisation, source, updated FROM mapper_organisations ORDER BY domain;`)
+	if queryErr != nil {
+		return nil, fmt.Errorf("unable to query database: %w", queryErr)
+	}
+	defer rows.Close()
+
+	organisations := make([]Organisation, 0)
+	for rows.Next() {
+		var organisation Organisation
+		if scanErr := rows.Scan(&organisation.Domain, &organisation.Organisation, &organisation.Source, &organisation.Updated); scanErr != nil {
+			return nil, fmt.Errorf("unable to scan row: %w", scanErr)
+		}
+		organisations = append(organisations, organisation)
+	}
+	if rowsErr := rows.Err(); rowsErr != nil {
+		return nil, fmt.Errorf("unable to iterate over rows: %w", rowsErr)
+	}
+
+	return organisations, nil
+}
+
+// getOrganisationsForDomains returns the organisations that own the given registrable domains, by domain.
+func (m *Mapper) getOrganisationsForDomains(ctx context.Context, domainSlice []string) (map[string]string, error) {
+	rows, queryErr := m.dbConnPool.Query(ctx, `SELECT domain, organisation FROM mapper_organisations WHERE domain = ANY($1);`, domainSlice)
+	if queryErr != nil {
+		return nil, fmt.Errorf("unable to query database: %w", queryErr)
+	}
+	defer rows.Close()
+
+	organisations := make(map[string]string)
+	for rows.Next() {
+		var domain, organisation string
+		if scanErr := rows.Scan(&domain, &organisation); scanErr != nil {
+			return nil, fmt.Errorf("unable to scan row: %w", scanErr)
+		}
+		organisations[domain] = organisation
+	}
+	if rowsErr := rows.Err(); rowsErr != nil {
+		return nil, fmt.Errorf("unable to iterate over rows: %w", rowsErr)
+	}
+
+	return organisations, nil
+}
+
+// parseHostGrouping returns the host grouping given in the "group" query parameter of the given request, or host
+// grouping if there is none.
+func parseHostGrouping(r *http.Request) (string, error) {
+	switch group := r.URL.Query().Get("group"); group {
+	case "", groupByHost:
+		return groupByHost, nil
+	case groupByDomain, groupByOrganisation:
+		return group, nil
+	default:
+		return "", fmt.Errorf("group must be one of %q, %q, or %q", groupByHost, groupByDomain, groupByOrganisation)
+	}
+}
+
+// groupHostGraph rolls the hosts in the given host graph up to their registrable domains or organisations, according
+// to the given grouping, and marks each connection as first-party or third-party.
+// Connections are first-party if both ends belong to the same organisation, or to the same registrable domain when
+// either has no known organisation. First-party connections are colored green, and third-party connections pink.
+func (m *Mapper) groupHostGraph(ctx context.Context, hostMap *graph.Graph, grouping string) (*graph.Graph, error) {
+	// Look up the organisations for every registrable domain in the graph
+	hostDomains := make(map[string]string)
+	domainSet := make(map[string]bool)
+	for _, node := range hostMap.Nodes() {
+		domain := domains.Registrable(node.ID)
+		hostDomains[node.ID] = domain
+		domainSet[domain] = true
+	}
+	domainSlice := make([]string, 0, len(domainSet))
+	for domain := range domainSet {
+		domainSlice = append(domainSlice, domain)
+	}
+	organisations, organisationsErr := m.getOrganisationsForDomains(ctx, domainSlice)
+	if organisationsErr != nil {
+		return nil, fmt.Errorf("unable to get organisations: %w", organisationsErr)
+	}
+
+	// Mark each connection as first-party or third-party, before any grouping
+	hostMap.DeclareEdgeAttribute(graph.AttributeDef{Key: "party", Title: "Party", Type: graph.AttributeString})
+	for _, edge := range hostMap.Edges() {
+		sourceDomain, targetDomain := hostDomains[edge.Source], hostDomains[edge.Target]
+		sourceOrganisation, targetOrganisation := organisations[sourceDomain], organisations[targetDomain]
+		party, color := "third", thirdPartyColor
+		if sourceDomain == targetDomain || (sourceOrganisation != "" && sourceOrganisation == targetOrganisation) {
+			party, color = "first", firstPartyColor
+		}
+		hostMap.SetEdgeAttribute(edge.Source, edge.Target, "party", party)
+		hostMap.SetEdgeColor(edge.Source, edge.Target, color)
+	}
+
+	// Group the hosts, then describe each resulting node
+	grouped := hostMap
+	switch grouping {
+	case groupByDomain:
+		grouped = hostMap.Group(func(host string) string {
+			return hostDomains[host]
+		})
+	case groupByOrganisation:
+		grouped = hostMap.Group(func(host string) string {
+			if organisation, ok := organisations[hostDomains[host]]; ok {
+				return organisation
+			}
+			return hostDomains[host]
+		})
+	}
+	if grouping == groupByHost {
+		grouped.DeclareNodeAttribute(graph.AttributeDef{Key: "domain", Title: "Registrable domain", Type: graph.AttributeString})
+	}
+	if grouping != groupByOrganisation {
+		grouped.DeclareNodeAttribute(graph.AttributeDef{Key: "organisation", Title: "Organisation", Type: graph.AttributeString})
+	}
+	for _, node := range grouped.Nodes() {
+		domain := domains.Registrable(node.ID)
+		if grouping == groupByHost {
+			grouped.SetNodeAttribute(node.ID, "domain", domain)
+		}
+		if organisation, ok := organisations[domain]; ok && grouping != groupByOrganisation {
+			grouped.SetNodeAttribute(node.ID, "organisation", organisation)
+		}
+	}
+
+	return grouped, nil
+}
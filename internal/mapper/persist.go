@@ -0,0 +1,246 @@
+package mapper
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/TheHackerDev/cartograph/internal/shared/database"
+	"github.com/TheHackerDev/cartograph/internal/shared/datatypes"
+)
+
+const (
+	// maxRetryBatches is the number of failed batches held in memory to be retried. Once it is full, the oldest batch
+	// is dropped to make room.
+	maxRetryBatches int = 50
+
+	// maxBatchAttempts is the number of times a batch is saved before it is dropped.
+	maxBatchAttempts int = 8
+
+	// retryBaseDelay is the delay before a failed batch is first retried. It doubles with each failed attempt, up to
+	// retryMaxDelay.
+	retryBaseDelay = 5 * time.Second
+
+	// retryMaxDelay is the longest delay between attempts to save a failed batch.
+	retryMaxDelay = 5 * time.Minute
+
+	// pingTimeout is how long to wait for the database to respond before reconnecting.
+	pingTimeout = 5 * time.Second
+)
+
+// referredDataColumns are the data_mapper columns copied from each referred data row.
+var referredDataColumns = []string{"referer_scheme", "referer_host", "referer_path", "destination_scheme", "destination_host", "destination_path", "edge_type", "element", "attribute", "seen"}
+
+// referredDataBatch is a batch of referred data rows, ready to be copied into the database.
+type referredDataBatch struct {
+	// rows holds the values for each of referredDataColumns.
+	rows [][]interface{}
+
+	// attempts is the number of times saving the batch has failed.
+	attempts int
+
+	// nextAttempt is the earliest time the batch will be retried.
+	nextAttempt time.Time
+}
+
+// retryQueue is a bounded queue of failed batches, waiting to be saved again.
+// It is not safe for concurrent use; it is only used by the mapper's Run loop.
+type retryQueue struct {
+	batches []*referredDataBatch
+	max     int
+}
+
+// push adds the given batch to the queue. If the queue is full, the oldest batch is removed and returned.
+func (q *retryQueue) push(batch *referredDataBatch) (dropped *referredDataBatch) {
+	if len(q.batches) >= q.max {
+		dropped = q.batches[0]
+		q.batches = q.batches[1:]
+	}
+	q.batches = append(q.batches, batch)
+
+	return dropped
+}
+
+// due removes and returns the batches that are due to be retried at the given time, oldest first. If force is true,
+// all batches are returned.
+func (q *retryQueue) due(now time.Time, force bool) []*referredDataBatch {
+	due := make([]*referredDataBatch, 0)
+	waiting := q.batches[:0]
+	for _, batch := range q.batches {
+		if force || !batch.nextAttempt.After(now) {
+			due = append(due, batch)
+		} else {
+			waiting = append(waiting, batch)
+		}
+	}
+	q.batches = waiting
+
+	return due
+}
+
+// retryDelay returns the delay before retrying a batch that has failed the given number of times, with up to 10%
+// jitter, so that many failed batches are not all retried at once.
+func retryDelay(attempts int) time.Duration {
+	delay := retryBaseDelay
+	for i := 1; i < attempts && delay < retryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > retryMaxDelay {
+		delay = retryMaxDelay
+	}
+
+	return delay + time.Duration(rand.Int63n(int64(delay/10)+1))
+}
+
+// cacheBatch returns the referred data in the cache as a batch of rows to be copied into the database.
+func (m *Mapper) cacheBatch() *referredDataBatch {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	rows := make([][]interface{}, 0, len(m.referredDataCache))
+	for _, referredData := range m.referredDataCache {
+		// Skip any ridiculously long URL paths in the source or destination (google search is prone to do this), as
+		// it will likely overflow the maximum btree v4 index size of 2704 bytes.
+		// We're only really concerned with the path, because the other parts of the btree index (source and
+		// destination scheme and host) are unlikely to ever come close to the maximum size.
+		if len(referredData.Referer.Path) > 1000 || len(referredData.Destination.Path) > 1000 {
+			continue
+		}
+
+		edgeType := referredData.Type
+		if edgeType == "" {
+			edgeType = datatypes.EdgeTypeLink
+		}
+
+		rows = append(rows, []interface{}{referredData.Referer.Scheme, referredData.Referer.Host, referredData.Referer.Path, referredData.Destination.Scheme, referredData.Destination.Host, referredData.Destination.Path, edgeType, referredData.Element, referredData.Attribute, referredData.Timestamp})
+	}
+
+	return &referredDataBatch{rows: rows}
+}
+
+// saveBatch saves the given batch to the database, recording the attempt in the input queue statistics.
+// If it fails, the database connection is re-established and the batch is queued to be retried with backoff, or
+// dropped once it has failed maxBatchAttempts times. If final is true, as the mapper is stopping and failed batches
+// are only held in memory, a failed batch is dropped instead of being queued. The returned error is only for
+// reporting; it has already been logged.
+func (m *Mapper) saveBatch(batch *referredDataBatch, final bool) error {
+	if len(batch.rows) == 0 {
+		return nil
+	}
+
+	start := time.Now()
+	saveErr := m.copyBatchToDatabase(batch.rows)
+	m.referredDataInput.RecordFlush(len(batch.rows), time.Since(start), saveErr)
+	if saveErr == nil {
+		return nil
+	}
+
+	batch.attempts++
+	logger := log.WithError(saveErr).WithFields(log.Fields{
+		"rows":     len(batch.rows),
+		"attempts": batch.attempts,
+	})
+
+	// The connection may have been lost; get a new one before the next attempt
+	if reconnectErr := m.reconnect(); reconnectErr != nil {
+		log.WithError(reconnectErr).Error("unable to reconnect mapper to database")
+	}
+
+	if batch.attempts >= maxBatchAttempts {
+		logger.Error("unable to save referred data to database; dropping batch")
+		return saveErr
+	}
+	if final {
+		logger.Error("unable to save referred data to database before stopping; dropping batch")
+		return saveErr
+	}
+
+	batch.nextAttempt = time.Now().Add(retryDelay(batch.attempts))
+	logger.WithField("retry", batch.nextAttempt).Warn("unable to save referred data to database; batch queued for retry")
+	if dropped := m.retryBatches.push(batch); dropped != nil {
+		log.WithField("rows", len(dropped.rows)).Error("mapper retry queue is full; dropping oldest batch of referred data")
+	}
+
+	return saveErr
+}
+
+// retryFailedBatches saves the failed batches that are due to be retried. If final is true, as the mapper is
+// stopping, all failed batches are retried regardless of their backoff, and dropped if they fail again.
+func (m *Mapper) retryFailedBatches(final bool) {
+	for _, batch := range m.retryBatches.due(time.Now(), final) {
+		_ = m.saveBatch(batch, final)
+	}
+}
+
+// copyBatchToDatabase copies the given rows into a temporary table, then merges them into the data_mapper table with
+// a single upsert, in one transaction.
+// Rows for the same connection are merged before the upsert, keeping the earliest and latest times seen, so that a
+// batch (including one that is being retried) never moves first_seen later or last_seen earlier.
+func (m *Mapper) copyBatchToDatabase(rows [][]interface{}) error {
+	ctx := context.Background()
+
+	tx, txErr := m.insertDbConn.Begin(ctx)
+	if txErr != nil {
+		return fmt.Errorf("unable to start database transaction: %w", txErr)
+	}
+	defer func() {
+		// Rolling back a committed transaction does nothing
+		_ = tx.Rollback(ctx)
+	}()
+
+	// Create a temporary table to copy the data into. It is dropped when the transaction ends.
+	if _, createErr := tx.Exec(ctx, `CREATE TEMPORARY TABLE tmp_data_mapper (referer_scheme TEXT NOT NULL, referer_host TEXT NOT NULL, referer_path TEXT NOT NULL, destination_scheme TEXT NOT NULL, destination_host TEXT NOT NULL, destination_path TEXT NOT NULL, edge_type TEXT NOT NULL, element TEXT NOT NULL, attribute TEXT NOT NULL, seen TIMESTAMP WITH TIME ZONE NOT NULL) ON COMMIT DROP;`); createErr != nil {
+		return fmt.Errorf("unable to create temporary database table: %w", createErr)
+	}
+
+	// Copy the data into the temporary table using postgresql's COPY FROM semantics
+	copyCount, copyErr := tx.CopyFrom(ctx, pgx.Identifier{"tmp_data_mapper"}, referredDataColumns, pgx.CopyFromRows(rows))
+	if copyErr != nil {
+		return fmt.Errorf("unable to copy data into temporary database table: %w", copyErr)
+	}
+	if int(copyCount) != len(rows) {
+		return fmt.Errorf("expected to copy %d rows, but only copied %d rows into temporary database table", len(rows), copyCount)
+	}
+
+	// Merge the data from the temporary table into the permanent table
+	if _, mergeErr := tx.Exec(ctx, `INSERT INTO data_mapper (referer_scheme, referer_host, referer_path, destination_scheme, destination_host, destination_path, edge_type, element, attribute, first_seen, last_seen)
+		SELECT referer_scheme, referer_host, referer_path, destination_scheme, destination_host, destination_path, edge_type, max(element), max(attribute), min(seen), max(seen)
+		FROM tmp_data_mapper
+		GROUP BY referer_scheme, referer_host, referer_path, destination_scheme, destination_host, destination_path, edge_type
+		ON CONFLICT ON CONSTRAINT data_mapper_pk DO UPDATE SET
+			first_seen = least(data_mapper.first_seen, excluded.first_seen),
+			last_seen = greatest(data_mapper.last_seen, excluded.last_seen),
+			element = coalesce(nullif(excluded.element, ''), data_mapper.element),
+			attribute = coalesce(nullif(excluded.attribute, ''), data_mapper.attribute);`); mergeErr != nil {
+		return fmt.Errorf("unable to merge temporary table data into database: %w", mergeErr)
+	}
+
+	if commitErr := tx.Commit(ctx); commitErr != nil {
+		return fmt.Errorf("unable to commit database transaction: %w", commitErr)
+	}
+
+	return nil
+}
+
+// reconnect replaces the insert database connection with a new one, unless the current connection still responds.
+func (m *Mapper) reconnect() error {
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+	if !m.insertDbConn.IsClosed() && m.insertDbConn.Ping(ctx) == nil {
+		return nil
+	}
+
+	dbConn, dbConnErr := database.GetDbConn(m.cfg.DbConnString)
+	if dbConnErr != nil {
+		return fmt.Errorf("unable to get insert database connection: %w", dbConnErr)
+	}
+	_ = m.insertDbConn.Close(ctx)
+	m.insertDbConn = dbConn
+	log.Info("mapper reconnected to database")
+
+	return nil
+}
@@ -0,0 +1,43 @@
+package mapper
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryQueue(t *testing.T) {
+	now := time.Date(2024, 6, 30, 12, 0, 0, 0, time.UTC)
+	q := retryQueue{max: 2}
+
+	first := &referredDataBatch{nextAttempt: now.Add(-time.Second)}
+	second := &referredDataBatch{nextAttempt: now.Add(time.Minute)}
+	if dropped := q.push(first); dropped != nil {
+		t.Errorf("push() dropped a batch from a queue with room")
+	}
+	q.push(second)
+
+	if due := q.due(now, false); len(due) != 1 || due[0] != first {
+		t.Errorf("due() = %v, want only the batch past its next attempt", due)
+	}
+	if len(q.batches) != 1 || q.batches[0] != second {
+		t.Errorf("batches = %v, want only the waiting batch", q.batches)
+	}
+
+	third := &referredDataBatch{nextAttempt: now}
+	q.push(third)
+	if dropped := q.push(&referredDataBatch{}); dropped != second {
+		t.Errorf("push() to a full queue dropped %v, want the oldest batch", dropped)
+	}
+
+	if due := q.due(now.Add(-time.Hour), true); len(due) != 2 || len(q.batches) != 0 {
+		t.Errorf("forced due() = %d batches with %d left, want all batches", len(due), len(q.batches))
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	for attempts, want := range map[int]time.Duration{1: retryBaseDelay, 2: 2 * retryBaseDelay, 3: 4 * retryBaseDelay, 20: retryMaxDelay} {
+		if delay := retryDelay(attempts); delay < want || delay > want+want/10 {
+			t.Errorf("retryDelay(%d) = %s, want %s plus up to 10%%", attempts, delay, want)
+		}
+	}
+}
@@ -0,0 +1,337 @@
+package mapper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TheHackerDev/cartograph/internal/mapper/analytics"
+	"github.com/TheHackerDev/cartograph/internal/shared/datatypes/graph"
+	"github.com/TheHackerDev/cartograph/internal/shared/domains"
+)
+
+// Ranking metrics, as used in the "metric" query parameter.
+const (
+	metricPageRank    string = "pagerank"
+	metricBetweenness string = "betweenness"
+	metricInDegree    string = "in_degree"
+	metricOutDegree   string = "out_degree"
+	metricDegree      string = "degree"
+)
+
+// Ranking levels, as used in the "level" query parameter.
+const (
+	rankingLevelHost string = "host"
+	rankingLevelPath string = "path"
+)
+
+const (
+	// defaultRankingLimit is the number of nodes returned by the ranking API, if no limit is given.
+	defaultRankingLimit int = 50
+
+	// maxRankingLimit is the largest number of nodes the ranking API returns.
+	maxRankingLimit int = 1000
+)
+
+// metricValues returns the value of each ranking metric from the given scores.
+var metricValues = map[string]func(s *analytics.Scores) float64{
+	metricPageRank:    func(s *analytics.Scores) float64 { return s.PageRank },
+	metricBetweenness: func(s *analytics.Scores) float64 { return s.Betweenness },
+	metricInDegree:    func(s *analytics.Scores) float64 { return float64(s.InDegree) },
+	metricOutDegree:   func(s *analytics.Scores) float64 { return float64(s.OutDegree) },
+	metricDegree:      func(s *analytics.Scores) float64 { return float64(s.InDegree + s.OutDegree) },
+}
+
+// Ranking is the output of the ranking API.
+type Ranking struct {
+	Metric string `json:"metric"`
+	Level  string `json:"level"`
+
+	// Components and Communities are the number of weakly connected components and communities in the whole graph,
+	// and Modularity is the modularity of the communities.
+	Components  int     `json:"components"`
+	Communities int     `json:"communities"`
+	Modularity  float64 `json:"modularity"`
+
+	Nodes []RankedNode `json:"nodes"`
+}
+
+// RankedNode is a single node in a ranking, with all of its scores.
+type RankedNode struct {
+	Rank int    `json:"rank"`
+	ID   string `json:"id"`
+
+	// Party is "first" or "third", relative to the first-party domains given in the request, or empty if none were.
+	Party string `json:"party,omitempty"`
+
+	analytics.Scores
+}
+
+// rankingQuery holds the parameters of a ranking request.
+type rankingQuery struct {
+	metric   string
+	level    string
+	grouping string
+	limit    int
+	window   timeWindow
+	hosts    []string
+
+	// party limits the ranking to first-party or third-party nodes, relative to firstParty.
+	party string
+
+	// firstParty holds the registrable domains of the ecosystem being ranked.
+	firstParty []string
+}
+
+// parseRankingQuery parses the parameters of a ranking request.
+func parseRankingQuery(r *http.Request) (*rankingQuery, error) {
+	query := r.URL.Query()
+	rq := &rankingQuery{metric: metricPageRank, level: rankingLevelHost, limit: defaultRankingLimit}
+
+	if metric := query.Get("metric"); metric != "" {
+		if _, ok := metricValues[metric]; !ok {
+			return nil, fmt.Errorf("metric must be one of %q, %q, %q, %q, or %q", metricPageRank, metricBetweenness, metricInDegree, metricOutDegree, metricDegree)
+		}
+		rq.metric = metric
+	}
+
+	switch level := query.Get("level"); level {
+	case "", rankingLevelHost:
+	case rankingLevelPath:
+		rq.level = level
+	default:
+		return nil, fmt.Errorf("level must be %q or %q", rankingLevelHost, rankingLevelPath)
+	}
+
+	var groupingErr error
+	if rq.grouping, groupingErr = parseHostGrouping(r); groupingErr != nil {
+		return nil, groupingErr
+	}
+	if rq.level == rankingLevelPath && rq.grouping != groupByHost {
+		return nil, fmt.Errorf("paths cannot be grouped")
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		n, atoiErr := strconv.Atoi(limit)
+		if atoiErr != nil || n < 1 || n > maxRankingLimit {
+			return nil, fmt.Errorf("limit must be a number from 1 to %d", maxRankingLimit)
+		}
+		rq.limit = n
+	}
+
+	window, windowErr := parseTimeWindow(query, time.Now())
+	if windowErr != nil {
+		return nil, windowErr
+	}
+	rq.window = window.withDefaultSince(30 * 24 * time.Hour)
+
+	if hosts := query.Get("hosts"); hosts != "" {
+		rq.hosts = strings.Split(hosts, ",")
+	}
+
+	for _, domain := range strings.Split(query.Get("domain"), ",") {
+		if domain = domains.Registrable(strings.TrimSpace(domain)); domain != "" {
+			rq.firstParty = append(rq.firstParty, domain)
+		}
+	}
+	switch party := query.Get("party"); party {
+	case "":
+	case "first", "third":
+		if len(rq.firstParty) == 0 {
+			return nil, fmt.Errorf("the first-party domains must be given in the \"domain\" query parameter to filter by party")
+		}
+		rq.party = party
+	default:
+		return nil, fmt.Errorf("party must be \"first\" or \"third\"")
+	}
+
+	return rq, nil
+}
+
+// RankingAPIHandler is an HTTP handler function that ranks the hosts (or paths) in the map by a centrality metric,
+// and returns the top nodes with all of their scores as JSON.
+//
+// The "metric" query parameter is one of "pagerank" (the default), "betweenness", "in_degree", "out_degree", or
+// "degree", and "limit" sets the number of nodes returned (50 by default). The "level" query parameter ranks "host"
+// nodes (the default), which can be grouped with the "group" query parameter, or "path" nodes, which can be limited to
+// those on the comma-separated hosts in the "hosts" query parameter.
+// To answer questions like "which third-party hosts are most central to this ecosystem", give the ecosystem's
+// registrable domains in the "domain" query parameter, and set the "party" query parameter to "third" (or "first").
+// Hosts owned by the same organisation as a first-party domain are first-party.
+// Connections are limited to the time window given by the "since", "until" and "as_of" query parameters, which
+// defaults to the last 30 days.
+func (m *Mapper) RankingAPIHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET requests (or OPTIONS)
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Allow", "GET, OPTIONS")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	} else if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET, OPTIONS")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	rq, parseErr := parseRankingQuery(r)
+	if parseErr != nil {
+		http.Error(w, parseErr.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ranking, rankErr := m.rank(r.Context(), rq)
+	if rankErr != nil {
+		http.Error(w, fmt.Sprintf("problem ranking nodes: %s", rankErr), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the ranking as JSON
+	w.Header().Set("Content-Type", "application/json")
+	if jsonMarshalErr := json.NewEncoder(w).Encode(ranking); jsonMarshalErr != nil {
+		http.Error(w, fmt.Sprintf("unable to encode ranking to JSON: %s", jsonMarshalErr), http.StatusInternalServerError)
+		return
+	}
+}
+
+// rank loads the graph for the given ranking query, computes its analytics, and returns the top nodes.
+func (m *Mapper) rank(ctx context.Context, rq *rankingQuery) (*Ranking, error) {
+	// Load the graph
+	var g *graph.Graph
+	var graphErr error
+	if rq.level == rankingLevelPath {
+		g, graphErr = m.allPathsGraph(ctx, rq.window, rq.hosts)
+	} else if g, graphErr = m.allHostsGraph(ctx, rq.window); graphErr == nil {
+		g, graphErr = m.groupHostGraph(ctx, g, rq.grouping)
+	}
+	if graphErr != nil {
+		return nil, fmt.Errorf("unable to get graph: %w", graphErr)
+	}
+
+	result := m.analytics.Compute(g)
+
+	// Work out which nodes are first-party
+	var party func(id string) string
+	if len(rq.firstParty) > 0 {
+		var partyErr error
+		if party, partyErr = m.partyClassifier(ctx, g, rq); partyErr != nil {
+			return nil, partyErr
+		}
+	}
+
+	// Rank the nodes, breaking ties by ID
+	value := metricValues[rq.metric]
+	nodes := make([]RankedNode, 0, len(result.Scores))
+	for id, scores := range result.Scores {
+		node := RankedNode{ID: id, Scores: *scores}
+		if party != nil {
+			node.Party = party(id)
+			if rq.party != "" && node.Party != rq.party {
+				continue
+			}
+		}
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		if vi, vj := value(&nodes[i].Scores), value(&nodes[j].Scores); vi != vj {
+			return vi > vj
+		}
+		return nodes[i].ID < nodes[j].ID
+	})
+	if len(nodes) > rq.limit {
+		nodes = nodes[:rq.limit]
+	}
+	for i := range nodes {
+		nodes[i].Rank = i + 1
+	}
+
+	return &Ranking{
+		Metric:      rq.metric,
+		Level:       rq.level,
+		Components:  result.Components,
+		Communities: result.Communities,
+		Modularity:  result.Modularity,
+		Nodes:       nodes,
+	}, nil
+}
+
+// partyClassifier returns a function that classifies the nodes of the given graph as "first" or "third" party,
+// relative to the first-party domains of the given ranking query. Nodes are first-party if their registrable domain
+// is a first-party domain, or is owned by the same organisation as one. Organisation nodes (from grouping) are
+// first-party if they own a first-party domain.
+func (m *Mapper) partyClassifier(ctx context.Context, g *graph.Graph, rq *rankingQuery) (func(id string) string, error) {
+	nodeDomains := make(map[string]string)
+	domainSet := make(map[string]bool)
+	for _, domain := range rq.firstParty {
+		domainSet[domain] = true
+	}
+	for _, node := range g.Nodes() {
+		host, _, _ := strings.Cut(node.ID, "/")
+		nodeDomains[node.ID] = domains.Registrable(host)
+		domainSet[nodeDomains[node.ID]] = true
+	}
+	domainSlice := make([]string, 0, len(domainSet))
+	for domain := range domainSet {
+		domainSlice = append(domainSlice, domain)
+	}
+	organisations, organisationsErr := m.getOrganisationsForDomains(ctx, domainSlice)
+	if organisationsErr != nil {
+		return nil, fmt.Errorf("unable to get organisations: %w", organisationsErr)
+	}
+
+	firstPartyDomains := make(map[string]bool)
+	firstPartyOrganisations := make(map[string]bool)
+	for _, domain := range rq.firstParty {
+		firstPartyDomains[domain] = true
+		if organisation, ok := organisations[domain]; ok {
+			firstPartyOrganisations[organisation] = true
+		}
+	}
+
+	return func(id string) string {
+		domain := nodeDomains[id]
+		if firstPartyDomains[domain] || firstPartyOrganisations[organisations[domain]] || (rq.grouping == groupByOrganisation && firstPartyOrganisations[id]) {
+			return "first"
+		}
+		return "third"
+	}, nil
+}
+
+// allPathsGraph returns a graph of all paths (as host and path, without the scheme) and their connections that were
+// seen within the given time window. If hosts are given, only connections to or from paths on those hosts are
+// included.
+func (m *Mapper) allPathsGraph(ctx context.Context, window timeWindow, hosts []string) (*graph.Graph, error) {
+	sqlSelect := `select referer_host || referer_path, destination_host || destination_path, min(first_seen), max(last_seen)
+		from data_mapper
+		where referer_host != ''
+		  and destination_host != ''
+		  and ($1::timestamptz is null or last_seen >= $1)
+		  and ($2::timestamptz is null or first_seen <= $2)
+		  and ($3::text[] is null or referer_host = any($3) or destination_host = any($3))
+		group by 1, 2;`
+	rows, queryErr := m.dbConnPool.Query(ctx, sqlSelect, window.Since, window.Until, hosts)
+	if queryErr != nil {
+		return nil, fmt.Errorf("unable to query database: %w", queryErr)
+	}
+	defer rows.Close()
+
+	pathMap := graph.NewGraph("Connections between paths", "connections, paths")
+	for rows.Next() {
+		var referer, destination string
+		var firstSeen, lastSeen time.Time
+		if scanErr := rows.Scan(&referer, &destination, &firstSeen, &lastSeen); scanErr != nil {
+			return nil, fmt.Errorf("unable to scan row: %w", scanErr)
+		}
+		if referer != destination {
+			pathMap.AddEdgeSpell(referer, destination, firstSeen, lastSeen)
+		}
+	}
+	if rowsErr := rows.Err(); rowsErr != nil {
+		return nil, fmt.Errorf("unable to iterate over rows: %w", rowsErr)
+	}
+
+	return pathMap, nil
+}
@@ -0,0 +1,174 @@
+package mapper
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/html"
+
+	"github.com/TheHackerDev/cartograph/internal/shared/datatypes"
+	internalHttp "github.com/TheHackerDev/cartograph/internal/shared/http"
+)
+
+// maxMetaRefreshBodySize is the maximum number of bytes of an HTML response read for meta refresh tags. Longer bodies
+// are only searched if they are not encoded, as a truncated encoded body cannot be decoded.
+const maxMetaRefreshBodySize int64 = 1 << 20
+
+// LogRedirects sends a redirect edge to the mapper plugin for each redirect in the given HTTP response: the Location
+// header of 3xx responses, the Refresh header, and meta refresh tags in HTML responses. Each edge runs from the
+// destination of the given referred data (the URL that was requested) to the redirect target. HTML responses are only
+// read for meta refresh tags if the requested host is a target.
+// It does not block; edges are queued like those sent to LogReferredData.
+func (m *Mapper) LogRedirects(response *http.Response, referredData *datatypes.ReferrerData) {
+	// Check if enabled first
+	if !m.Enabled() {
+		return
+	}
+
+	readBody := m.cfg.IsTarget(referredData.Destination.Host, referredData.Destination.Host)
+	for _, target := range redirectTargets(response, readBody) {
+		destination, parseErr := referredData.Destination.Parse(target)
+		if parseErr != nil {
+			log.WithError(parseErr).WithField("target", target).Debug("unable to parse redirect target")
+			continue
+		}
+		if destination.Host == "" {
+			continue
+		}
+
+		m.LogReferredData(&datatypes.ReferrerData{
+			Referer:     referredData.Destination,
+			Destination: *destination,
+			Timestamp:   time.Now(),
+			Type:        datatypes.EdgeTypeRedirect,
+		})
+	}
+}
+
+// redirectTargets returns the unresolved redirect targets in the given HTTP response, in the order of the Location
+// header, the Refresh header, then meta refresh tags. The body is only read for meta refresh tags if readBody is true.
+func redirectTargets(response *http.Response, readBody bool) []string {
+	targets := make([]string, 0)
+
+	// 3xx redirects
+	if response.StatusCode >= 300 && response.StatusCode < 400 {
+		if location := response.Header.Get("Location"); location != "" {
+			targets = append(targets, location)
+		}
+	}
+
+	// Refresh header, which browsers treat like a meta refresh tag
+	if target := refreshTarget(response.Header.Get("Refresh")); target != "" {
+		targets = append(targets, target)
+	}
+
+	// Meta refresh tags in HTML responses
+	if readBody && strings.Contains(response.Header.Get("Content-Type"), "text/html") && response.Body != nil && response.Body != http.NoBody {
+		targets = append(targets, bodyMetaRefreshTargets(response)...)
+	}
+
+	return targets
+}
+
+// bodyMetaRefreshTargets returns the targets of the meta refresh tags in the body of the given HTML response, reading
+// up to maxMetaRefreshBodySize bytes. The body is restored so that it can be read again.
+func bodyMetaRefreshTargets(response *http.Response) []string {
+	body := response.Body
+	contents, readErr := io.ReadAll(io.LimitReader(body, maxMetaRefreshBodySize+1))
+	response.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(contents), body), body}
+	if readErr != nil {
+		log.WithError(readErr).Error("unable to read response body for meta refresh tags")
+		return nil
+	}
+
+	contentEncoding := response.Header.Get("Content-Encoding")
+	if int64(len(contents)) > maxMetaRefreshBodySize {
+		if contentEncoding != "" && !strings.EqualFold(contentEncoding, "identity") {
+			log.WithField("contentEncoding", contentEncoding).Debug("encoded response body too large to search for meta refresh tags")
+			return nil
+		}
+		contents = contents[:maxMetaRefreshBodySize]
+	}
+
+	document, decodeErr := internalHttp.DecodeBody(contents, contentEncoding)
+	if decodeErr != nil {
+		log.WithError(decodeErr).Debug("unable to decode response body for meta refresh tags")
+		return nil
+	}
+
+	return metaRefreshTargets(bytes.NewReader(document))
+}
+
+// metaRefreshTargets returns the targets of the meta refresh tags in the given HTML document. Only the document head
+// is searched, as browsers ignore refresh tags elsewhere in practice.
+func metaRefreshTargets(document io.Reader) []string {
+	targets := make([]string, 0)
+
+	tokenizer := html.NewTokenizer(document)
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return targets
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := tokenizer.TagName()
+			switch string(name) {
+			case "body":
+				return targets
+			case "meta":
+				var httpEquiv, content string
+				for hasAttr {
+					var key, value []byte
+					key, value, hasAttr = tokenizer.TagAttr()
+					switch string(key) {
+					case "http-equiv":
+						httpEquiv = string(value)
+					case "content":
+						content = string(value)
+					}
+				}
+				if strings.EqualFold(strings.TrimSpace(httpEquiv), "refresh") {
+					if target := refreshTarget(content); target != "" {
+						targets = append(targets, target)
+					}
+				}
+			}
+		}
+	}
+}
+
+// refreshTarget returns the URL in the given Refresh header or meta refresh content value, such as
+// "5; url=https://example.com/". It returns an empty string if there is no URL, as the page only reloads itself.
+func refreshTarget(value string) string {
+	// Skip the delay
+	_, target, found := strings.Cut(value, ";")
+	if !found {
+		_, target, found = strings.Cut(value, ",")
+		if !found {
+			return ""
+		}
+	}
+	target = strings.TrimSpace(target)
+
+	// Remove the optional "url=" prefix, and any quotes around the URL
+	if len(target) >= 4 && strings.EqualFold(target[:3], "url") {
+		if rest := strings.TrimSpace(target[3:]); strings.HasPrefix(rest, "=") {
+			target = strings.TrimSpace(rest[1:])
+		}
+	}
+	if len(target) >= 2 && (target[0] == '\'' || target[0] == '"') {
+		if end := strings.IndexByte(target[1:], target[0]); end >= 0 {
+			target = target[1 : end+1]
+		} else {
+			target = target[1:]
+		}
+	}
+
+	return strings.TrimSpace(target)
+}
@@ -0,0 +1,80 @@
+package mapper
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRefreshTarget(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{value: "0; url=https://example.com/", want: "https://example.com/"},
+		{value: "5;URL='/next'", want: "/next"},
+		{value: `3; url="https://example.com/a b"`, want: "https://example.com/a b"},
+		{value: "0; https://example.com/", want: "https://example.com/"},
+		{value: "30", want: ""},
+	}
+	for _, tt := range tests {
+		if got := refreshTarget(tt.value); got != tt.want {
+			t.Errorf("refreshTarget(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestRedirectTargets(t *testing.T) {
+	body := `<html><head><meta http-equiv="Refresh" content="0; url=https://meta.example.com/"></head>
+		<body><meta http-equiv="refresh" content="0; url=https://ignored.example.com/"></body></html>`
+	response := &http.Response{
+		StatusCode: http.StatusFound,
+		Header: http.Header{
+			"Location":     []string{"/login"},
+			"Refresh":      []string{"10; url=https://refresh.example.com/"},
+			"Content-Type": []string{"text/html; charset=utf-8"},
+		},
+		Body: io.NopCloser(strings.NewReader(body)),
+	}
+
+	want := []string{"/login", "https://refresh.example.com/", "https://meta.example.com/"}
+	if got := redirectTargets(response, true); !reflect.DeepEqual(got, want) {
+		t.Errorf("redirectTargets() = %q, want %q", got, want)
+	}
+
+	// The body must still be readable after the meta refresh tags have been found
+	if remaining, _ := io.ReadAll(response.Body); string(remaining) != body {
+		t.Errorf("response body was not restored")
+	}
+}
+
+func TestRedirectTargetsEncoded(t *testing.T) {
+	var encoded bytes.Buffer
+	gzipWriter := gzip.NewWriter(&encoded)
+	_, _ = gzipWriter.Write([]byte(`<html><head><meta http-equiv="refresh" content="0; url=/next"></head></html>`))
+	_ = gzipWriter.Close()
+
+	newResponse := func() *http.Response {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header: http.Header{
+				"Content-Type":     []string{"text/html"},
+				"Content-Encoding": []string{"gzip"},
+			},
+			Body: io.NopCloser(bytes.NewReader(encoded.Bytes())),
+		}
+	}
+
+	if got, want := redirectTargets(newResponse(), true), []string{"/next"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("redirectTargets() = %q, want %q", got, want)
+	}
+
+	// Bodies of pages that are not targets are not read
+	if got := redirectTargets(newResponse(), false); len(got) != 0 {
+		t.Errorf("redirectTargets() without reading the body = %q, want none", got)
+	}
+}
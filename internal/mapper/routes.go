@@ -0,0 +1,573 @@
+package mapper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Route node modes, which set whether routes are found between hosts or between full URLs.
+const (
+	routeModeHost string = "host"
+	routeModeURL  string = "url"
+)
+
+// Route query limits.
+const (
+	routesDefaultK       int = 1
+	routesMaxK           int = 10
+	routesDefaultMaxHops int = 6
+	routesMaxHops        int = 8
+
+	// routesExtraHops is how many hops longer than the shortest route alternative routes may be.
+	routesExtraHops int = 2
+
+	// routesMaxNodes is the maximum number of nodes explored while searching for routes.
+	routesMaxNodes int = 50000
+
+	// routesMaxHopConnections is the maximum number of underlying connections returned for each hop.
+	routesMaxHopConnections int = 10
+)
+
+// RoutesOutput holds the routes found between two hosts or URLs.
+type RoutesOutput struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Mode string `json:"mode"`
+
+	// Reachable is true if at least one route was found.
+	Reachable bool `json:"reachable"`
+
+	// Truncated is true if the search stopped early because too many nodes were explored, in which case some routes
+	// may be missing.
+	Truncated bool `json:"truncated"`
+
+	// Routes are ordered from shortest to longest.
+	Routes []Route `json:"routes"`
+}
+
+// Route is a single route between two hosts or URLs.
+type Route struct {
+	Length int        `json:"length"`
+	Hops   []RouteHop `json:"hops"`
+}
+
+// RouteHop is a single connection in a route, from a referer to a destination.
+type RouteHop struct {
+	Referer     string    `json:"referer"`
+	Destination string    `json:"destination"`
+	FirstSeen   time.Time `json:"first_seen"`
+	LastSeen    time.Time `json:"last_seen"`
+
+	// Connections are the referer and destination URLs seen for this hop, most recently seen first.
+	// In host mode, only the first few connections are included.
+	Connections []RouteConnection `json:"connections"`
+}
+
+// RouteConnection is a single connection between two URLs, as recorded in the mapper data.
+type RouteConnection struct {
+	RefererURL     string    `json:"referer_url"`
+	DestinationURL string    `json:"destination_url"`
+	FirstSeen      time.Time `json:"first_seen"`
+	LastSeen       time.Time `json:"last_seen"`
+}
+
+// routesQuery describes a search for routes between two hosts or URLs.
+type routesQuery struct {
+	From    string
+	To      string
+	Mode    string
+	K       int
+	MaxHops int
+	Window  timeWindow
+}
+
+// parseRoutesQuery parses a routes query from the query parameters of the given request.
+func parseRoutesQuery(r *http.Request) (*routesQuery, error) {
+	query := r.URL.Query()
+
+	rq := &routesQuery{
+		From:    query.Get("from"),
+		To:      query.Get("to"),
+		Mode:    routeModeHost,
+		K:       routesDefaultK,
+		MaxHops: routesDefaultMaxHops,
+	}
+	if rq.From == "" || rq.To == "" {
+		return nil, fmt.Errorf("from and to are required")
+	}
+
+	if mode := query.Get("mode"); mode != "" {
+		if mode != routeModeHost && mode != routeModeURL {
+			return nil, fmt.Errorf("mode must be %q or %q", routeModeHost, routeModeURL)
+		}
+		rq.Mode = mode
+	}
+	if rq.Mode == routeModeURL {
+		var normalizeErr error
+		if rq.From, normalizeErr = normalizeRouteURL(rq.From); normalizeErr != nil {
+			return nil, fmt.Errorf("invalid from URL: %w", normalizeErr)
+		}
+		if rq.To, normalizeErr = normalizeRouteURL(rq.To); normalizeErr != nil {
+			return nil, fmt.Errorf("invalid to URL: %w", normalizeErr)
+		}
+	}
+
+	if k := query.Get("k"); k != "" {
+		var atoiErr error
+		if rq.K, atoiErr = strconv.Atoi(k); atoiErr != nil || rq.K < 1 || rq.K > routesMaxK {
+			return nil, fmt.Errorf("k must be between 1 and %d", routesMaxK)
+		}
+	}
+
+	if maxHops := query.Get("max_hops"); maxHops != "" {
+		var atoiErr error
+		if rq.MaxHops, atoiErr = strconv.Atoi(maxHops); atoiErr != nil || rq.MaxHops < 1 || rq.MaxHops > routesMaxHops {
+			return nil, fmt.Errorf("max_hops must be between 1 and %d", routesMaxHops)
+		}
+	}
+
+	var windowErr error
+	if rq.Window, windowErr = parseTimeWindow(query, time.Now()); windowErr != nil {
+		return nil, windowErr
+	}
+
+	return rq, nil
+}
+
+// normalizeRouteURL returns the given URL in the form used for URL route nodes: scheme://host/path, without the
+// query string or fragment.
+func normalizeRouteURL(rawURL string) (string, error) {
+	u, parseErr := url.Parse(rawURL)
+	if parseErr != nil {
+		return "", parseErr
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("%q must include a scheme and host", rawURL)
+	}
+	if u.Path == "" {
+		u.Path = "/"
+	}
+
+	return u.Scheme + "://" + u.Host + u.Path, nil
+}
+
+// RoutesAPIHandler handles requests to the mapper data API for the shortest routes between two hosts or two URLs,
+// following connections from referers to destinations.
+func (m *Mapper) RoutesAPIHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET requests (or OPTIONS)
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Allow", "GET, OPTIONS")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	} else if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET, OPTIONS")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Parse the query
+	rq, queryErr := parseRoutesQuery(r)
+	if queryErr != nil {
+		http.Error(w, queryErr.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Find the routes
+	routes, routesErr := m.findRoutes(r.Context(), rq)
+	if routesErr != nil {
+		http.Error(w, fmt.Sprintf("unable to find routes: %s", routesErr.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the routes as JSON
+	w.Header().Set("Content-Type", "application/json")
+	if jsonMarshalErr := json.NewEncoder(w).Encode(routes); jsonMarshalErr != nil {
+		http.Error(w, fmt.Sprintf("unable to encode routes to JSON: %s", jsonMarshalErr.Error()), http.StatusInternalServerError)
+		return
+	}
+}
+
+// findRoutes searches the mapper data for routes between the query's endpoints.
+func (m *Mapper) findRoutes(ctx context.Context, rq *routesQuery) (*RoutesOutput, error) {
+	output := &RoutesOutput{
+		From:   rq.From,
+		To:     rq.To,
+		Mode:   rq.Mode,
+		Routes: make([]Route, 0),
+	}
+
+	g, truncated, loadErr := m.loadRouteGraph(ctx, rq)
+	if loadErr != nil {
+		return nil, loadErr
+	}
+	output.Truncated = truncated
+
+	connections := make(map[[2]string][]RouteConnection)
+	for _, nodes := range g.kShortestPaths(rq.From, rq.To, rq.K) {
+		route := Route{Length: len(nodes) - 1, Hops: make([]RouteHop, 0, len(nodes)-1)}
+		for i := 0; i < len(nodes)-1; i++ {
+			key := [2]string{nodes[i], nodes[i+1]}
+			hop := *g.hops[key]
+
+			// Host edges are loaded without their connections, which are only read for the hops of each route
+			if rq.Mode == routeModeHost {
+				if _, loaded := connections[key]; !loaded {
+					var connectionsErr error
+					if connections[key], connectionsErr = m.loadHopConnections(ctx, rq, key[0], key[1]); connectionsErr != nil {
+						return nil, connectionsErr
+					}
+				}
+				hop.Connections = connections[key]
+			}
+			route.Hops = append(route.Hops, hop)
+		}
+		output.Routes = append(output.Routes, route)
+	}
+	output.Reachable = len(output.Routes) > 0
+
+	return output, nil
+}
+
+// routeNode is a node of the route graph: a host, or a URL without its query string or fragment.
+type routeNode struct {
+	scheme string
+	host   string
+	path   string
+}
+
+// name returns the name of the node used in routes for the given mode.
+func (n routeNode) name(mode string) string {
+	if mode == routeModeHost {
+		return n.host
+	}
+
+	return n.scheme + "://" + n.host + n.path
+}
+
+// loadRouteGraph loads the edges reachable from the query's starting node, one hop at a time, until the destination
+// node has been reached (plus routesExtraHops hops for alternative routes), or the maximum number of hops or explored
+// nodes has been reached. Only edges from the nodes of the current frontier are read, each edge as a single row, so
+// each row adds at most one node and each hop reads at most one more row than there are nodes left to explore.
+// The second return value is true if the maximum number of explored nodes was reached.
+func (m *Mapper) loadRouteGraph(ctx context.Context, rq *routesQuery) (*routeGraph, bool, error) {
+	g := newRouteGraph()
+
+	// Host edges are distinct pairs of hosts, and URL edges are distinct pairs of URLs without their query strings,
+	// both ordered so that the same edges are read when the limit is reached
+	sqlSelectHosts := `select referer_host, destination_host, min(first_seen), max(last_seen)
+		from data_mapper
+		where referer_host = any($1)
+		  and destination_host != ''
+		  and destination_host != referer_host
+		  and ($2::timestamptz is null or last_seen >= $2)
+		  and ($3::timestamptz is null or first_seen <= $3)
+		group by referer_host, destination_host
+		order by referer_host, destination_host
+		limit $4;`
+	sqlSelectURLs := `select d.referer_scheme, d.referer_host, d.referer_path, d.destination_scheme, d.destination_host, d.destination_path, min(d.first_seen), max(d.last_seen)
+		from data_mapper d
+		join unnest($1::text[], $2::text[], $3::text[]) as f(scheme, host, path)
+		  on d.referer_scheme = f.scheme and d.referer_host = f.host and d.referer_path = f.path
+		where d.destination_host != ''
+		  and (d.destination_scheme, d.destination_host, d.destination_path) != (d.referer_scheme, d.referer_host, d.referer_path)
+		  and ($4::timestamptz is null or d.last_seen >= $4)
+		  and ($5::timestamptz is null or d.first_seen <= $5)
+		group by d.referer_scheme, d.referer_host, d.referer_path, d.destination_scheme, d.destination_host, d.destination_path
+		order by d.referer_scheme, d.referer_host, d.referer_path, d.destination_scheme, d.destination_host, d.destination_path
+		limit $6;`
+
+	start := routeNode{host: rq.From}
+	if rq.Mode == routeModeURL {
+		u, parseErr := url.Parse(rq.From)
+		if parseErr != nil {
+			return nil, false, fmt.Errorf("unable to parse starting URL: %w", parseErr)
+		}
+		start = routeNode{scheme: u.Scheme, host: u.Host, path: u.Path}
+	}
+
+	visited := map[string]bool{rq.From: true}
+	frontier := []routeNode{start}
+	maxHops := rq.MaxHops
+	for hop := 1; hop <= maxHops && len(frontier) > 0; hop++ {
+		// Query the edges from the nodes of the current frontier
+		limit := routesMaxNodes - len(visited) + 1
+		var sqlSelect string
+		var args []interface{}
+		if rq.Mode == routeModeHost {
+			hosts := make([]string, 0, len(frontier))
+			for _, node := range frontier {
+				hosts = append(hosts, node.host)
+			}
+			sqlSelect, args = sqlSelectHosts, []interface{}{hosts, rq.Window.Since, rq.Window.Until, limit}
+		} else {
+			schemes, hosts, paths := make([]string, 0, len(frontier)), make([]string, 0, len(frontier)), make([]string, 0, len(frontier))
+			for _, node := range frontier {
+				schemes = append(schemes, node.scheme)
+				hosts = append(hosts, node.host)
+				paths = append(paths, node.path)
+			}
+			sqlSelect, args = sqlSelectURLs, []interface{}{schemes, hosts, paths, rq.Window.Since, rq.Window.Until, limit}
+		}
+
+		rows, queryErr := m.dbConnPool.Query(ctx, sqlSelect, args...)
+		if queryErr != nil {
+			return nil, false, fmt.Errorf("unable to query connections: %w", queryErr)
+		}
+		var next []routeNode
+		edges := 0
+		for rows.Next() {
+			edges++
+			var source, target routeNode
+			var conn RouteConnection
+			var scanErr error
+			if rq.Mode == routeModeHost {
+				scanErr = rows.Scan(&source.host, &target.host, &conn.FirstSeen, &conn.LastSeen)
+			} else {
+				scanErr = rows.Scan(&source.scheme, &source.host, &source.path, &target.scheme, &target.host, &target.path, &conn.FirstSeen, &conn.LastSeen)
+			}
+			if scanErr != nil {
+				rows.Close()
+				return nil, false, fmt.Errorf("unable to scan connection: %w", scanErr)
+			}
+
+			sourceName, targetName := source.name(rq.Mode), target.name(rq.Mode)
+			if rq.Mode == routeModeHost {
+				g.addEdge(sourceName, targetName, conn.FirstSeen, conn.LastSeen)
+			} else {
+				conn.RefererURL, conn.DestinationURL = sourceName, targetName
+				g.addConnection(sourceName, targetName, conn)
+			}
+			if !visited[targetName] {
+				visited[targetName] = true
+				next = append(next, target)
+			}
+		}
+		rows.Close()
+		if rowsErr := rows.Err(); rowsErr != nil {
+			return nil, false, fmt.Errorf("unable to read connections: %w", rowsErr)
+		}
+
+		// Once the destination is reached, only look a few hops further for alternative routes
+		if visited[rq.To] && rq.K > 1 {
+			maxHops = min(maxHops, hop+routesExtraHops)
+		} else if visited[rq.To] {
+			break
+		}
+
+		if len(visited) > routesMaxNodes || edges >= limit {
+			return g, true, nil
+		}
+		frontier = next
+	}
+
+	return g, false, nil
+}
+
+// loadHopConnections loads the most recently seen connections between the given hosts, up to
+// routesMaxHopConnections.
+func (m *Mapper) loadHopConnections(ctx context.Context, rq *routesQuery, refererHost, destinationHost string) ([]RouteConnection, error) {
+	sqlSelect := `select referer_scheme, referer_path, destination_scheme, destination_path, min(first_seen), max(last_seen)
+		from data_mapper
+		where referer_host = $1
+		  and destination_host = $2
+		  and ($3::timestamptz is null or last_seen >= $3)
+		  and ($4::timestamptz is null or first_seen <= $4)
+		group by referer_scheme, referer_path, destination_scheme, destination_path
+		order by max(last_seen) desc, referer_scheme, referer_path, destination_scheme, destination_path
+		limit $5;`
+
+	rows, queryErr := m.dbConnPool.Query(ctx, sqlSelect, refererHost, destinationHost, rq.Window.Since, rq.Window.Until, routesMaxHopConnections)
+	if queryErr != nil {
+		return nil, fmt.Errorf("unable to query hop connections: %w", queryErr)
+	}
+	defer rows.Close()
+
+	connections := make([]RouteConnection, 0, routesMaxHopConnections)
+	for rows.Next() {
+		var refererScheme, refererPath, destinationScheme, destinationPath string
+		var conn RouteConnection
+		if scanErr := rows.Scan(&refererScheme, &refererPath, &destinationScheme, &destinationPath, &conn.FirstSeen, &conn.LastSeen); scanErr != nil {
+			return nil, fmt.Errorf("unable to scan hop connection: %w", scanErr)
+		}
+		conn.RefererURL = refererScheme + "://" + refererHost + refererPath
+		conn.DestinationURL = destinationScheme + "://" + destinationHost + destinationPath
+		connections = append(connections, conn)
+	}
+	if rowsErr := rows.Err(); rowsErr != nil {
+		return nil, fmt.Errorf("unable to read hop connections: %w", rowsErr)
+	}
+
+	return connections, nil
+}
+
+// routeGraph is an unweighted directed graph of connections, used to search for routes.
+type routeGraph struct {
+	// adjacent holds the targets of each node's outgoing edges, sorted once loading is done.
+	adjacent map[string][]string
+
+	// hops holds the details of each edge.
+	hops map[[2]string]*RouteHop
+
+	sorted bool
+}
+
+// newRouteGraph returns a new, empty route graph.
+func newRouteGraph() *routeGraph {
+	return &routeGraph{
+		adjacent: make(map[string][]string),
+		hops:     make(map[[2]string]*RouteHop),
+	}
+}
+
+// addEdge adds the edge between the given nodes if it does not exist, widening its first and last seen times to
+// include the given times, and returns it.
+func (g *routeGraph) addEdge(source, target string, firstSeen, lastSeen time.Time) *RouteHop {
+	key := [2]string{source, target}
+	hop, ok := g.hops[key]
+	if !ok {
+		hop = &RouteHop{
+			Referer:     source,
+			Destination: target,
+			FirstSeen:   firstSeen,
+			LastSeen:    lastSeen,
+		}
+		g.hops[key] = hop
+		g.adjacent[source] = append(g.adjacent[source], target)
+		g.sorted = false
+	}
+
+	if firstSeen.Before(hop.FirstSeen) {
+		hop.FirstSeen = firstSeen
+	}
+	if lastSeen.After(hop.LastSeen) {
+		hop.LastSeen = lastSeen
+	}
+
+	return hop
+}
+
+// addConnection adds a connection to the edge between the given nodes, adding the edge if it does not exist.
+func (g *routeGraph) addConnection(source, target string, conn RouteConnection) {
+	hop := g.addEdge(source, target, conn.FirstSeen, conn.LastSeen)
+
+	// Keep the most recently seen connections
+	i := sort.Search(len(hop.Connections), func(i int) bool {
+		return hop.Connections[i].LastSeen.Before(conn.LastSeen)
+	})
+	if i < routesMaxHopConnections {
+		hop.Connections = append(hop.Connections, RouteConnection{})
+		copy(hop.Connections[i+1:], hop.Connections[i:])
+		hop.Connections[i] = conn
+		if len(hop.Connections) > routesMaxHopConnections {
+			hop.Connections = hop.Connections[:routesMaxHopConnections]
+		}
+	}
+}
+
+// shortestPath returns the nodes of the shortest path between the given nodes, using a breadth-first search, or nil
+// if there is none. Nodes and edges in the given sets are not used.
+func (g *routeGraph) shortestPath(source, target string, removedNodes map[string]bool, removedEdges map[[2]string]bool) []string {
+	if !g.sorted {
+		for node := range g.adjacent {
+			sort.Strings(g.adjacent[node])
+		}
+		g.sorted = true
+	}
+
+	previous := map[string]string{source: ""}
+	queue := []string{source}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		if node == target {
+			break
+		}
+		for _, next := range g.adjacent[node] {
+			if _, seen := previous[next]; seen || removedNodes[next] || removedEdges[[2]string{node, next}] {
+				continue
+			}
+			previous[next] = node
+			queue = append(queue, next)
+		}
+	}
+	if _, reached := previous[target]; !reached {
+		return nil
+	}
+
+	var path []string
+	for node := target; node != ""; node = previous[node] {
+		path = append([]string{node}, path...)
+		if node == source {
+			break
+		}
+	}
+
+	return path
+}
+
+// kShortestPaths returns up to k loopless paths between the given nodes, shortest first, using Yen's algorithm.
+func (g *routeGraph) kShortestPaths(source, target string, k int) [][]string {
+	if source == target {
+		return nil
+	}
+	first := g.shortestPath(source, target, nil, nil)
+	if first == nil {
+		return nil
+	}
+
+	paths := [][]string{first}
+	var candidates [][]string
+	for len(paths) < k {
+		last := paths[len(paths)-1]
+		for i := 0; i < len(last)-1; i++ {
+			spur, root := last[i], last[:i+1]
+
+			// Remove the edges used by previous paths sharing the same root, and the root nodes themselves
+			removedEdges := make(map[[2]string]bool)
+			for _, path := range paths {
+				if len(path) > i+1 && slices.Equal(path[:i+1], root) {
+					removedEdges[[2]string{path[i], path[i+1]}] = true
+				}
+			}
+			removedNodes := make(map[string]bool, i)
+			for _, node := range root[:i] {
+				removedNodes[node] = true
+			}
+
+			spurPath := g.shortestPath(spur, target, removedNodes, removedEdges)
+			if spurPath == nil {
+				continue
+			}
+			candidate := append(append([]string{}, root[:i]...), spurPath...)
+			if !containsPath(candidates, candidate) && !containsPath(paths, candidate) {
+				candidates = append(candidates, candidate)
+			}
+		}
+		if len(candidates) == 0 {
+			break
+		}
+
+		// Take the shortest candidate, preferring the first found for equal lengths
+		sort.SliceStable(candidates, func(a, b int) bool {
+			return len(candidates[a]) < len(candidates[b])
+		})
+		paths = append(paths, candidates[0])
+		candidates = candidates[1:]
+	}
+
+	return paths
+}
+
+// containsPath returns true if the given path is in the given list of paths.
+func containsPath(paths [][]string, path []string) bool {
+	return slices.ContainsFunc(paths, func(p []string) bool {
+		return slices.Equal(p, path)
+	})
+}
@@ -0,0 +1,37 @@
+package mapper
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestKShortestPaths(t *testing.T) {
+	g := newRouteGraph()
+	for _, edge := range [][2]string{
+		{"a", "b"}, {"b", "d"},
+		{"a", "c"}, {"c", "d"},
+		{"a", "e"}, {"e", "f"}, {"f", "d"},
+		{"d", "a"},
+	} {
+		g.addConnection(edge[0], edge[1], RouteConnection{})
+	}
+
+	want := [][]string{
+		{"a", "b", "d"},
+		{"a", "c", "d"},
+		{"a", "e", "f", "d"},
+	}
+	got := g.kShortestPaths("a", "d", 5)
+	if len(got) != len(want) {
+		t.Fatalf("kShortestPaths() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if !slices.Equal(got[i], want[i]) {
+			t.Errorf("path %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+
+	if got := g.kShortestPaths("d", "x", 1); got != nil {
+		t.Errorf("kShortestPaths() to unknown node = %v, want nil", got)
+	}
+}
@@ -0,0 +1,439 @@
+package mapper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/TheHackerDev/cartograph/internal/shared/datatypes/graph"
+	internalHttp "github.com/TheHackerDev/cartograph/internal/shared/http"
+)
+
+// errSnapshotNotFound is returned when a diff refers to a snapshot that does not exist.
+var errSnapshotNotFound = errors.New("snapshot not found")
+
+// Snapshot is a named copy of the mapper data, taken at a point in time.
+type Snapshot struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+
+	// Since and Until are the bounds of the time window the snapshot was limited to, or nil if unbounded.
+	Since *time.Time `json:"since"`
+	Until *time.Time `json:"until"`
+
+	Created time.Time `json:"created"`
+
+	// Edges is the number of mapper connections in the snapshot.
+	Edges int `json:"edges"`
+}
+
+// snapshotRequest is the body of a request to take a snapshot. The time window bounds take the same values as the
+// "since", "until" and "as_of" query parameters of the other mapper APIs.
+type snapshotRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Since       string `json:"since"`
+	Until       string `json:"until"`
+	AsOf        string `json:"as_of"`
+}
+
+// SnapshotsAPIHandler is an HTTP handler for managing snapshots of the mapper data, which can be compared with each
+// other (or with time ranges of the live data) to see how the map changed.
+//
+// GET requests return all snapshots.
+// POST requests take a new snapshot, given as a JSON object with a "name" field, and optional "description",
+// "since", "until" and "as_of" fields to limit the snapshot to a time window.
+// DELETE requests remove the snapshot with the name in the "name" query parameter.
+func (m *Mapper) SnapshotsAPIHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		snapshots, getErr := m.getSnapshots(r.Context())
+		if getErr != nil {
+			http.Error(w, fmt.Sprintf("unable to get snapshots: %s", getErr), http.StatusInternalServerError)
+			return
+		}
+
+		// Return the snapshots as JSON
+		w.Header().Set("Content-Type", "application/json")
+		if jsonMarshalErr := json.NewEncoder(w).Encode(snapshots); jsonMarshalErr != nil {
+			http.Error(w, fmt.Sprintf("unable to encode snapshots to JSON: %s", jsonMarshalErr), http.StatusInternalServerError)
+			return
+		}
+	case http.MethodPost:
+		reqBody, bodyCopy, bodyReadErr := internalHttp.ReadBody(r.Body)
+		r.Body = bodyCopy
+		if bodyReadErr != nil {
+			http.Error(w, fmt.Sprintf("unable to read request body: %s", bodyReadErr), http.StatusInternalServerError)
+			return
+		}
+		var request snapshotRequest
+		if jsonUnmarshalErr := json.Unmarshal(reqBody, &request); jsonUnmarshalErr != nil {
+			http.Error(w, fmt.Sprintf("unable to parse JSON request body into snapshot object: %s", jsonUnmarshalErr), http.StatusBadRequest)
+			return
+		}
+		request.Name = strings.TrimSpace(request.Name)
+		if request.Name == "" {
+			http.Error(w, "name is required", http.StatusBadRequest)
+			return
+		}
+		window, windowErr := parseTimeWindow(url.Values{"since": {request.Since}, "until": {request.Until}, "as_of": {request.AsOf}}, time.Now())
+		if windowErr != nil {
+			http.Error(w, windowErr.Error(), http.StatusBadRequest)
+			return
+		}
+
+		snapshot, createErr := m.createSnapshot(r.Context(), request.Name, request.Description, window)
+		if createErr != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(createErr, &pgErr) && pgErr.Code == "23505" {
+				http.Error(w, fmt.Sprintf("snapshot %q already exists", request.Name), http.StatusConflict)
+				return
+			}
+			http.Error(w, fmt.Sprintf("unable to create snapshot: %s", createErr), http.StatusInternalServerError)
+			return
+		}
+
+		// Return the new snapshot as JSON
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		if jsonMarshalErr := json.NewEncoder(w).Encode(snapshot); jsonMarshalErr != nil {
+			http.Error(w, fmt.Sprintf("unable to encode snapshot to JSON: %s", jsonMarshalErr), http.StatusInternalServerError)
+			return
+		}
+	case http.MethodDelete:
+		name := r.URL.Query().Get("name")
+		if name == "" {
+			http.Error(w, "no snapshot name provided in \"name\" query parameter", http.StatusBadRequest)
+			return
+		}
+
+		tag, deleteErr := m.dbConnPool.Exec(r.Context(), `DELETE FROM mapper_snapshots WHERE name = $1;`, name)
+		if deleteErr != nil {
+			http.Error(w, fmt.Sprintf("unable to remove snapshot %q: %s", name, deleteErr), http.StatusInternalServerError)
+			return
+		}
+		if tag.RowsAffected() == 0 {
+			http.Error(w, fmt.Sprintf("snapshot %q not found", name), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodOptions:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "invalid HTTP request method: "+r.Method, http.StatusMethodNotAllowed)
+	}
+}
+
+// getSnapshots returns all snapshots, oldest first.
+func (m *Mapper) getSnapshots(ctx context.Context) ([]Snapshot, error) {
+	rows, queryErr := m.dbConnPool.Query(ctx, `SELECT s.name, s.description, s.since, s.until, s.created, (SELECT count(*) FROM mapper_snapshot_edges e WHERE e.snapshot = s.name) FROM mapper_snapshots s ORDER BY s.created, s.name;`)
+	if queryErr != nil {
+		return nil, fmt.Errorf("unable to query database: %w", queryErr)
+	}
+	defer rows.Close()
+
+	snapshots := make([]Snapshot, 0)
+	for rows.Next() {
+		var snapshot Snapshot
+		if scanErr := rows.Scan(&snapshot.Name, &snapshot.Description, &snapshot.Since, &snapshot.Until, &snapshot.Created, &snapshot.Edges); scanErr != nil {
+			return nil, fmt.Errorf("unable to scan row: %w", scanErr)
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	if rowsErr := rows.Err(); rowsErr != nil {
+		return nil, fmt.Errorf("unable to iterate over rows: %w", rowsErr)
+	}
+
+	return snapshots, nil
+}
+
+// createSnapshot copies the mapper connections seen within the given time window into a new snapshot with the given
+// name, in a single transaction, and returns the snapshot.
+func (m *Mapper) createSnapshot(ctx context.Context, name string, description string, window timeWindow) (*Snapshot, error) {
+	tx, txErr := m.dbConnPool.Begin(ctx)
+	if txErr != nil {
+		return nil, fmt.Errorf("unable to start database transaction: %w", txErr)
+	}
+	defer func() {
+		// Rolling back a committed transaction does nothing
+		_ = tx.Rollback(ctx)
+	}()
+
+	snapshot := &Snapshot{
+		Name:        name,
+		Description: description,
+		Since:       window.Since,
+		Until:       window.Until,
+	}
+	if insertErr := tx.QueryRow(ctx, `INSERT INTO mapper_snapshots (name, description, since, until) VALUES ($1, $2, $3, $4) RETURNING created;`, name, description, window.Since, window.Until).Scan(&snapshot.Created); insertErr != nil {
+		return nil, fmt.Errorf("unable to save snapshot: %w", insertErr)
+	}
+
+	tag, copyErr := tx.Exec(ctx, `INSERT INTO mapper_snapshot_edges (snapshot, referer_scheme, referer_host, referer_path, destination_scheme, destination_host, destination_path, edge_type, first_seen, last_seen)
+		SELECT $1, referer_scheme, referer_host, referer_path, destination_scheme, destination_host, destination_path, edge_type, first_seen, last_seen
+		FROM data_mapper
+		WHERE ($2::timestamptz is null or last_seen >= $2)
+		  AND ($3::timestamptz is null or first_seen <= $3);`, name, window.Since, window.Until)
+	if copyErr != nil {
+		return nil, fmt.Errorf("unable to copy mapper data into snapshot: %w", copyErr)
+	}
+	snapshot.Edges = int(tag.RowsAffected())
+
+	if commitErr := tx.Commit(ctx); commitErr != nil {
+		return nil, fmt.Errorf("unable to commit database transaction: %w", commitErr)
+	}
+
+	return snapshot, nil
+}
+
+// diffSource is one side of a diff: either a snapshot, or the live mapper data within a time window.
+type diffSource struct {
+	snapshot string
+	window   timeWindow
+}
+
+// String describes the source, for the diff output.
+func (s diffSource) String() string {
+	if s.snapshot != "" {
+		return "snapshot " + s.snapshot
+	}
+
+	since, until := "the beginning", "now"
+	if s.window.Since != nil {
+		since = s.window.Since.Format(time.RFC3339)
+	}
+	if s.window.Until != nil {
+		until = s.window.Until.Format(time.RFC3339)
+	}
+
+	return since + " to " + until
+}
+
+// diffQuery holds the parameters of a diff request.
+type diffQuery struct {
+	from  diffSource
+	to    diffSource
+	level string
+}
+
+// parseDiffQuery parses the parameters of a diff request from the given query string.
+// Each side of the diff is given either as a snapshot name in the "from" or "to" parameter, or as a time window of the
+// live data, using the "since", "until" and "as_of" parameters prefixed with "from_" or "to_" (such as "from_until").
+// The "from" side is required, and the "to" side defaults to all the live data.
+func parseDiffQuery(query url.Values, now time.Time) (*diffQuery, error) {
+	dq := &diffQuery{level: diffLevelHost}
+
+	switch level := query.Get("level"); level {
+	case "", diffLevelHost:
+	case diffLevelDomain, diffLevelPath:
+		dq.level = level
+	default:
+		return nil, fmt.Errorf("level must be one of %q, %q, or %q", diffLevelHost, diffLevelDomain, diffLevelPath)
+	}
+
+	var sourceErr error
+	if dq.from, sourceErr = parseDiffSource(query, "from", now, true); sourceErr != nil {
+		return nil, sourceErr
+	}
+	if dq.to, sourceErr = parseDiffSource(query, "to", now, false); sourceErr != nil {
+		return nil, sourceErr
+	}
+
+	return dq, nil
+}
+
+// parseDiffSource parses one side of a diff from the given query string, using the parameters with the given prefix.
+func parseDiffSource(query url.Values, prefix string, now time.Time, required bool) (diffSource, error) {
+	windowQuery := url.Values{}
+	for _, param := range []string{"since", "until", "as_of"} {
+		if value := query.Get(prefix + "_" + param); value != "" {
+			windowQuery.Set(param, value)
+		}
+	}
+
+	snapshot := query.Get(prefix)
+	if snapshot != "" {
+		if len(windowQuery) > 0 {
+			return diffSource{}, fmt.Errorf("%s cannot be used with a %s time window", prefix, prefix)
+		}
+		return diffSource{snapshot: snapshot}, nil
+	}
+	if required && len(windowQuery) == 0 {
+		return diffSource{}, fmt.Errorf("%s is required, as a snapshot name or a time window", prefix)
+	}
+
+	window, windowErr := parseTimeWindow(windowQuery, now)
+	if windowErr != nil {
+		return diffSource{}, fmt.Errorf("invalid %s time window: %w", prefix, windowErr)
+	}
+
+	return diffSource{window: window}, nil
+}
+
+// loadMapState returns the map state of the given diff source at the given diff level. Connections without a referer,
+// and connections within a single host or path at the host and path levels, are filtered out by the query, and the
+// connections are merged across schemes, so that only the rows used by the state are read.
+func (m *Mapper) loadMapState(ctx context.Context, source diffSource, level string) (*mapState, error) {
+	sqlWhere := `referer_host != '' AND destination_host != ''`
+	switch level {
+	case diffLevelHost:
+		sqlWhere += ` AND referer_host != destination_host`
+	case diffLevelPath:
+		sqlWhere += ` AND (referer_host, referer_path) != (destination_host, destination_path)`
+	}
+	sqlGroup := `GROUP BY referer_host, referer_path, destination_host, destination_path, edge_type`
+
+	var rows pgx.Rows
+	var queryErr error
+	if source.snapshot != "" {
+		var exists bool
+		if existsErr := m.dbConnPool.QueryRow(ctx, `SELECT exists(SELECT 1 FROM mapper_snapshots WHERE name = $1);`, source.snapshot).Scan(&exists); existsErr != nil {
+			return nil, fmt.Errorf("unable to query database: %w", existsErr)
+		}
+		if !exists {
+			return nil, fmt.Errorf("%w: %q", errSnapshotNotFound, source.snapshot)
+		}
+		rows, queryErr = m.dbConnPool.Query(ctx, `SELECT referer_host, referer_path, destination_host, destination_path, edge_type, min(first_seen), max(last_seen)
+			FROM mapper_snapshot_edges
+			WHERE snapshot = $1 AND `+sqlWhere+`
+			`+sqlGroup+`;`, source.snapshot)
+	} else {
+		rows, queryErr = m.dbConnPool.Query(ctx, `SELECT referer_host, referer_path, destination_host, destination_path, edge_type, min(first_seen), max(last_seen)
+			FROM data_mapper
+			WHERE ($1::timestamptz is null or last_seen >= $1)
+			  AND ($2::timestamptz is null or first_seen <= $2)
+			  AND `+sqlWhere+`
+			`+sqlGroup+`;`, source.window.Since, source.window.Until)
+	}
+	if queryErr != nil {
+		return nil, fmt.Errorf("unable to query database: %w", queryErr)
+	}
+	defer rows.Close()
+
+	state := newMapState(level)
+	for rows.Next() {
+		var refererHost, refererPath, destinationHost, destinationPath, edgeType string
+		var firstSeen, lastSeen time.Time
+		if scanErr := rows.Scan(&refererHost, &refererPath, &destinationHost, &destinationPath, &edgeType, &firstSeen, &lastSeen); scanErr != nil {
+			return nil, fmt.Errorf("unable to scan row: %w", scanErr)
+		}
+		state.add(refererHost, refererPath, destinationHost, destinationPath, edgeType, firstSeen, lastSeen)
+	}
+	if rowsErr := rows.Err(); rowsErr != nil {
+		return nil, fmt.Errorf("unable to iterate over rows: %w", rowsErr)
+	}
+
+	return state, nil
+}
+
+// diff returns the changes to the map between the two sides of the given diff query.
+func (m *Mapper) diff(ctx context.Context, dq *diffQuery) (*MapDiff, error) {
+	from, fromErr := m.loadMapState(ctx, dq.from, dq.level)
+	if fromErr != nil {
+		return nil, fmt.Errorf("unable to load %s: %w", dq.from, fromErr)
+	}
+	to, toErr := m.loadMapState(ctx, dq.to, dq.level)
+	if toErr != nil {
+		return nil, fmt.Errorf("unable to load %s: %w", dq.to, toErr)
+	}
+
+	diff := diffMapStates(from, to)
+	diff.From, diff.To = dq.from.String(), dq.to.String()
+
+	return diff, nil
+}
+
+// SnapshotsDiffAPIHandler is an HTTP handler function that returns the nodes and edges that were added, removed or
+// changed between two snapshots or time ranges, as JSON. The sides of the diff are given as described in
+// parseDiffQuery, and the "level" query parameter sets whether nodes are hosts (the default), registrable domains, or
+// paths. Unchanged nodes and edges are only included if the "unchanged" query parameter is "true".
+func (m *Mapper) SnapshotsDiffAPIHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET requests (or OPTIONS)
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Allow", "GET, OPTIONS")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	} else if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET, OPTIONS")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	diff, status, diffErr := m.diffForRequest(r)
+	if diffErr != nil {
+		http.Error(w, diffErr.Error(), status)
+		return
+	}
+	if r.URL.Query().Get("unchanged") != "true" {
+		diff = diff.withoutUnchanged()
+	}
+
+	// Return the diff as JSON
+	w.Header().Set("Content-Type", "application/json")
+	if jsonMarshalErr := json.NewEncoder(w).Encode(diff); jsonMarshalErr != nil {
+		http.Error(w, fmt.Sprintf("unable to encode diff to JSON: %s", jsonMarshalErr), http.StatusInternalServerError)
+		return
+	}
+}
+
+// SnapshotsDiffGraph is an HTTP handler function that returns a graph file of the changes between two snapshots or
+// time ranges, taking the same parameters as SnapshotsDiffAPIHandler. All nodes and edges are included, with their
+// diff status ("added", "removed", "changed" or "unchanged") in the "diff" attribute.
+// The format is chosen by the "format" query parameter or the Accept header, and defaults to GEXF.
+func (m *Mapper) SnapshotsDiffGraph(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET requests (or OPTIONS)
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Allow", "GET, OPTIONS")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	} else if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET, OPTIONS")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Choose the output format before doing any work
+	serializer, formatErr := graph.SerializerForRequest(r, graph.FormatGEXF)
+	if formatErr != nil {
+		http.Error(w, formatErr.Error(), graphFormatErrorStatus(r))
+		return
+	}
+
+	diff, status, diffErr := m.diffForRequest(r)
+	if diffErr != nil {
+		http.Error(w, diffErr.Error(), status)
+		return
+	}
+
+	// Write the diff graph to the response
+	m.writeGraph(w, serializer, diff.Graph(), "diff")
+}
+
+// diffForRequest returns the diff for the parameters of the given request. If there is an error, the HTTP status code
+// to return is given with it.
+func (m *Mapper) diffForRequest(r *http.Request) (*MapDiff, int, error) {
+	dq, parseErr := parseDiffQuery(r.URL.Query(), time.Now())
+	if parseErr != nil {
+		return nil, http.StatusBadRequest, parseErr
+	}
+
+	diff, diffErr := m.diff(r.Context(), dq)
+	if diffErr != nil {
+		if errors.Is(diffErr, errSnapshotNotFound) {
+			return nil, http.StatusNotFound, diffErr
+		}
+		return nil, http.StatusInternalServerError, fmt.Errorf("problem getting diff: %w", diffErr)
+	}
+
+	return diff, http.StatusOK, nil
+}
@@ -0,0 +1,97 @@
+package mapper
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timeWindow limits mapper queries to connections seen within a period of time.
+// A nil bound means the window is unbounded on that side.
+type timeWindow struct {
+	Since *time.Time
+	Until *time.Time
+
+	// reference is the time that durations are relative to: the "as of" time if one was given, or the current time.
+	reference time.Time
+}
+
+// parseTimeWindow parses the "since", "until" and "as_of" query parameters into a time window.
+// Each value may be an RFC 3339 timestamp, a date (2006-01-02), or a duration before now, such as "72h" or "30d".
+// The "as_of" time shows the data as it was at that time: it is the default for "until", and durations in "since"
+// are relative to it instead of now.
+func parseTimeWindow(query url.Values, now time.Time) (timeWindow, error) {
+	window := timeWindow{reference: now}
+
+	if asOf := query.Get("as_of"); asOf != "" {
+		if query.Get("until") != "" {
+			return timeWindow{}, fmt.Errorf("until and as_of cannot be used together")
+		}
+		t, parseErr := parseTimeBound(asOf, now)
+		if parseErr != nil {
+			return timeWindow{}, fmt.Errorf("invalid as_of value: %w", parseErr)
+		}
+		window.reference = t
+		window.Until = &t
+	}
+
+	if since := query.Get("since"); since != "" {
+		t, parseErr := parseTimeBound(since, window.reference)
+		if parseErr != nil {
+			return timeWindow{}, fmt.Errorf("invalid since value: %w", parseErr)
+		}
+		window.Since = &t
+	}
+
+	if until := query.Get("until"); until != "" {
+		t, parseErr := parseTimeBound(until, now)
+		if parseErr != nil {
+			return timeWindow{}, fmt.Errorf("invalid until value: %w", parseErr)
+		}
+		window.Until = &t
+	}
+
+	if window.Since != nil && window.Until != nil && window.Until.Before(*window.Since) {
+		return timeWindow{}, fmt.Errorf("until (%s) is before since (%s)", window.Until.Format(time.RFC3339), window.Since.Format(time.RFC3339))
+	}
+
+	return window, nil
+}
+
+// withDefaultSince returns the window with the given duration before its reference time as the lower bound, if it
+// does not already have one.
+func (w timeWindow) withDefaultSince(d time.Duration) timeWindow {
+	if w.Since == nil {
+		since := w.reference.Add(-d)
+		w.Since = &since
+	}
+
+	return w
+}
+
+// parseTimeBound parses a single time window bound, relative to the given time for durations.
+func parseTimeBound(value string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+
+	// Durations before now, with "d" for days in addition to the standard units
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return time.Time{}, fmt.Errorf("%q is not a valid number of days", value)
+		}
+		return now.AddDate(0, 0, -n), nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return time.Time{}, fmt.Errorf("%q is not an RFC 3339 timestamp, date, or duration", value)
+	}
+
+	return now.Add(-d), nil
+}
@@ -0,0 +1,44 @@
+package mapper
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestParseTimeWindow(t *testing.T) {
+	now := time.Date(2024, 6, 30, 12, 0, 0, 0, time.UTC)
+
+	window, err := parseTimeWindow(url.Values{"since": {"30d"}, "until": {"2024-06-29T00:00:00Z"}}, now)
+	if err != nil {
+		t.Fatalf("parseTimeWindow() returned error: %s", err)
+	}
+	if want := now.AddDate(0, 0, -30); !window.Since.Equal(want) {
+		t.Errorf("since = %s, want %s", window.Since, want)
+	}
+	if want := time.Date(2024, 6, 29, 0, 0, 0, 0, time.UTC); !window.Until.Equal(want) {
+		t.Errorf("until = %s, want %s", window.Until, want)
+	}
+
+	if window, err = parseTimeWindow(url.Values{}, now); err != nil || window.Since != nil || window.Until != nil {
+		t.Errorf("parseTimeWindow() with no bounds = %+v, %v; want unbounded window", window, err)
+	}
+
+	asOf := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	if window, err = parseTimeWindow(url.Values{"as_of": {"2024-01-01"}, "since": {"7d"}}, now); err != nil {
+		t.Fatalf("parseTimeWindow() with as_of returned error: %s", err)
+	}
+	if !window.Until.Equal(asOf) || !window.Since.Equal(asOf.AddDate(0, 0, -7)) {
+		t.Errorf("window = %s to %s, want a week before %s", window.Since, window.Until, asOf)
+	}
+
+	for _, query := range []url.Values{
+		{"since": {"yesterday"}},
+		{"since": {"1h"}, "until": {"2h"}},
+		{"as_of": {"2024-01-01"}, "until": {"2024-01-02"}},
+	} {
+		if _, err := parseTimeWindow(query, now); err == nil {
+			t.Errorf("parseTimeWindow(%v) returned no error", query)
+		}
+	}
+}
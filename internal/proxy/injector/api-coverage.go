@@ -0,0 +1,85 @@
+package injector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/TheHackerDev/cartograph/internal/shared/csp"
+	internalHttp "github.com/TheHackerDev/cartograph/internal/shared/http"
+)
+
+// defaultCoverageLimit is the maximum number of pages returned by the coverage API, unless another limit is given.
+const defaultCoverageLimit = 500
+
+// CoverageAPIHandler is an HTTP handler function that returns whether the content injected into each page by the
+// mapper and injector plugins was allowed by the page's Content-Security-Policy, most recently seen first.
+//
+// The optional "status", "plugin", and "host" query parameters filter the pages returned, and "limit" sets the
+// maximum number of pages returned.
+func (injector *Injector) CoverageAPIHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		break
+	case http.MethodOptions:
+		w.Header().Set("Allow", "GET")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "invalid HTTP request method: "+r.Method, http.StatusMethodNotAllowed)
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", csp.StatusInjected, csp.StatusModified, csp.StatusBlocked:
+		break
+	default:
+		http.Error(w, fmt.Sprintf("invalid status %q; must be one of %q, %q, or %q", status, csp.StatusInjected, csp.StatusModified, csp.StatusBlocked), http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultCoverageLimit
+	if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+		var parseErr error
+		if limit, parseErr = strconv.Atoi(limitParam); parseErr != nil || limit < 1 {
+			http.Error(w, fmt.Sprintf("invalid limit %q; must be a positive integer", limitParam), http.StatusBadRequest)
+			return
+		}
+	}
+
+	coverage, getErr := injector.getCoverage(r.Context(), status, r.URL.Query().Get("plugin"), r.URL.Query().Get("host"), limit)
+	if getErr != nil {
+		http.Error(w, fmt.Sprintf("unable to get injection coverage: %s", getErr), http.StatusInternalServerError)
+		return
+	}
+
+	internalHttp.WriteJSON(w, http.StatusOK, coverage)
+}
+
+// getCoverage returns the injection coverage of up to the given number of pages, most recently seen first, filtered
+// by the given status, plugin, and host where they are not empty.
+func (injector *Injector) getCoverage(ctx context.Context, status, plugin, host string, limit int) ([]csp.Coverage, error) {
+	rows, queryErr := injector.dbConnPool.Query(ctx, `SELECT url_scheme, url_host, url_path, plugin, status, directives, policy, first_seen, last_seen FROM data_injection_coverage WHERE ($1 = '' OR status = $1) AND ($2 = '' OR plugin = $2) AND ($3 = '' OR url_host = $3) ORDER BY last_seen DESC LIMIT $4;`,
+		status, plugin, host, limit)
+	if queryErr != nil {
+		return nil, fmt.Errorf("unable to query database: %w", queryErr)
+	}
+	defer rows.Close()
+
+	coverage := make([]csp.Coverage, 0)
+	for rows.Next() {
+		var c csp.Coverage
+		if scanErr := rows.Scan(&c.Scheme, &c.Host, &c.Path, &c.Plugin, &c.Status, &c.Directives, &c.Policy, &c.FirstSeen, &c.LastSeen); scanErr != nil {
+			return nil, fmt.Errorf("unable to scan row: %w", scanErr)
+		}
+		coverage = append(coverage, c)
+	}
+	if rowsErr := rows.Err(); rowsErr != nil {
+		return nil, fmt.Errorf("unable to iterate over rows: %w", rowsErr)
+	}
+
+	return coverage, nil
+}
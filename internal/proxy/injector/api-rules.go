@@ -0,0 +1,212 @@
+package injector
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	internalHttp "github.com/TheHackerDev/cartograph/internal/shared/http"
+)
+
+// NewRulesAPIHandler returns a new instance of the injection rules API handler, using the provided injector object.
+func NewRulesAPIHandler(config *Injector) *RulesAPIHandler {
+	return &RulesAPIHandler{
+		config:    config,
+		uuidRegex: regexp.MustCompile(`(?i)(?P<rules>/rules)/?(?P<uuid>[0-9a-zA-Z]{8}-[0-9a-zA-Z]{4}-[0-9a-zA-Z]{4}-[0-9a-zA-Z]{4}-[0-9a-zA-Z]{12})?/?$`),
+	}
+}
+
+// RulesAPIHandler performs the routing for the injection rules API.
+//
+// It conforms to the http.Handler interface, and should thus be used in a http.ServeMux instance as the handler for
+// all injection rules API functions, starting at a single top-level URL path.
+type RulesAPIHandler struct {
+	// The plugin config.
+	config *Injector
+
+	// Regular expression to find a UUID, if provided in the path
+	uuidRegex *regexp.Regexp
+}
+
+// ServeHTTP conforms to the http.Handler interface, allowing this method to handle HTTP requests
+// for the Injector plugin's rules API.
+// Requests are expected to be sent to a path ending in "/rules/[uuid]", where the "[uuid]" is
+// an optional value representing an individual rule identifier.
+func (h RulesAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Get the UUID from the request path, if one is provided
+	matches := h.uuidRegex.FindStringSubmatch(r.URL.Path)
+	if matches == nil {
+		http.Error(w, fmt.Sprintf("invalid path provided: %q", r.URL.Path), http.StatusBadRequest)
+		return
+	}
+	ruleID := strings.ToLower(matches[h.uuidRegex.SubexpIndex("uuid")])
+
+	// Check for a valid request method, and send to the appropriate handler function
+	switch r.Method {
+	case http.MethodGet:
+		h.getRules(ruleID).ServeHTTP(w, r)
+		return
+	case http.MethodPost:
+		if ruleID != "" {
+			http.Error(w, "use PUT to replace an existing rule", http.StatusBadRequest)
+			return
+		}
+		h.saveRule("").ServeHTTP(w, r)
+		return
+	case http.MethodPut:
+		if ruleID == "" {
+			http.Error(w, "no rule ID provided in request URL path", http.StatusBadRequest)
+			return
+		}
+		h.saveRule(ruleID).ServeHTTP(w, r)
+		return
+	case http.MethodDelete:
+		h.removeRule(ruleID).ServeHTTP(w, r)
+		return
+	case http.MethodOptions:
+		w.Header().Set("Allow", "GET, POST, PUT, DELETE")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		w.Header().Set("Allow", "GET, POST, PUT, DELETE")
+		http.Error(w, "invalid HTTP request method: "+r.Method, http.StatusMethodNotAllowed)
+		return
+	}
+}
+
+// getRules is an HTTP handler function that returns either:
+// - One injection rule, if the provided UUID is a valid ID.
+// - All injection rules, in the order they are applied, if the provided UUID is an empty string.
+func (h RulesAPIHandler) getRules(id string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if id == "" {
+			internalHttp.WriteJSON(w, http.StatusOK, h.config.getRules())
+			return
+		}
+
+		rule := h.config.getRule(id)
+		if rule == nil {
+			http.Error(w, "no injection rule with provided id: "+id, http.StatusNotFound)
+			return
+		}
+		internalHttp.WriteJSON(w, http.StatusOK, rule)
+	}
+}
+
+// saveRule is an HTTP handler function that saves the injection rule in the request body, as a new rule if the
+// provided UUID is an empty string, or replacing the rule with the provided UUID.
+func (h RulesAPIHandler) saveRule(id string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Ensure the content-type in the request is correct
+		if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+			http.Error(w, fmt.Sprintf("Content-Type must be %q", "application/json"), http.StatusBadRequest)
+			return
+		}
+
+		// Attempt to parse the rule in the request, with rules enabled unless stated otherwise
+		reqBody, bodyCopy, bodyReadErr := internalHttp.ReadBody(r.Body)
+		r.Body = bodyCopy
+		if bodyReadErr != nil {
+			http.Error(w, fmt.Sprintf("unable to read request body: %s", bodyReadErr.Error()), http.StatusInternalServerError)
+			return
+		}
+		rule := &Rule{Enabled: true}
+		if jsonUnmarshalErr := json.Unmarshal(reqBody, rule); jsonUnmarshalErr != nil {
+			http.Error(w, fmt.Sprintf("unable to parse JSON request body into injection rule: %s", jsonUnmarshalErr.Error()), http.StatusBadRequest)
+			return
+		}
+		rule.ID = id
+		if validateErr := rule.validate(h.config.cfg); validateErr != nil {
+			http.Error(w, fmt.Sprintf("invalid injection rule: %s", validateErr.Error()), http.StatusBadRequest)
+			return
+		}
+
+		// Save the rule
+		saved, saveErr := h.config.saveRule(rule)
+		if errors.Is(saveErr, errRuleNotFound) {
+			http.Error(w, "no injection rule with provided id: "+id, http.StatusNotFound)
+			return
+		} else if saveErr != nil {
+			http.Error(w, fmt.Sprintf("unable to save injection rule: %s", saveErr.Error()), http.StatusInternalServerError)
+			return
+		}
+
+		status := http.StatusOK
+		if id == "" {
+			status = http.StatusCreated
+		}
+		internalHttp.WriteJSON(w, status, saved)
+	}
+}
+
+// removeRule is an HTTP handler function that removes the injection rule with the provided UUID.
+func (h RulesAPIHandler) removeRule(id string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Check for empty ID value
+		if id == "" {
+			http.Error(w, "no rule ID provided in request URL path", http.StatusBadRequest)
+			return
+		}
+
+		if removeErr := h.config.removeRule(id); errors.Is(removeErr, errRuleNotFound) {
+			http.Error(w, "no injection rule with provided id: "+id, http.StatusNotFound)
+			return
+		} else if removeErr != nil {
+			http.Error(w, fmt.Sprintf("unable to remove injection rule with ID %q: %s", id, removeErr.Error()), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// SettingsAPIHandler is an HTTP handler function for the injector-wide settings: whether the injector is enabled, and
+// the target rule sets it is limited to. GET requests return the settings, and PUT requests replace them.
+func (injector *Injector) SettingsAPIHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		internalHttp.WriteJSON(w, http.StatusOK, injector.getSettings())
+		return
+	case http.MethodPut:
+		// Ensure the content-type in the request is correct
+		if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+			http.Error(w, fmt.Sprintf("Content-Type must be %q", "application/json"), http.StatusBadRequest)
+			return
+		}
+
+		reqBody, bodyCopy, bodyReadErr := internalHttp.ReadBody(r.Body)
+		r.Body = bodyCopy
+		if bodyReadErr != nil {
+			http.Error(w, fmt.Sprintf("unable to read request body: %s", bodyReadErr.Error()), http.StatusInternalServerError)
+			return
+		}
+		settings := injector.getSettings()
+		if jsonUnmarshalErr := json.Unmarshal(reqBody, &settings); jsonUnmarshalErr != nil {
+			http.Error(w, fmt.Sprintf("unable to parse JSON request body into injector settings: %s", jsonUnmarshalErr.Error()), http.StatusBadRequest)
+			return
+		}
+
+		if validateErr := settings.Scope.validate(injector.cfg); validateErr != nil {
+			http.Error(w, fmt.Sprintf("invalid injector settings: %s", validateErr.Error()), http.StatusBadRequest)
+			return
+		}
+
+		if saveErr := injector.saveSettings(settings); saveErr != nil {
+			http.Error(w, fmt.Sprintf("unable to save injector settings: %s", saveErr.Error()), http.StatusInternalServerError)
+			return
+		}
+		internalHttp.WriteJSON(w, http.StatusOK, injector.getSettings())
+		return
+	case http.MethodOptions:
+		w.Header().Set("Allow", "GET, PUT")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		http.Error(w, "invalid HTTP request method: "+r.Method, http.StatusMethodNotAllowed)
+		return
+	}
+}
@@ -1,23 +1,25 @@
 package injector
 
 import (
-	"bytes"
 	"context"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/jackc/pgtype"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	log "github.com/sirupsen/logrus"
 
 	"github.com/TheHackerDev/cartograph/internal/config"
+	"github.com/TheHackerDev/cartograph/internal/shared/csp"
 	"github.com/TheHackerDev/cartograph/internal/shared/database"
 	"github.com/TheHackerDev/cartograph/internal/shared/datatypes"
 	internalHttp "github.com/TheHackerDev/cartograph/internal/shared/http"
+	"github.com/TheHackerDev/cartograph/internal/shared/metrics"
 )
 
 // Namespace value used for all UUIDv5 functions in database, for Injector-related data.
@@ -32,6 +34,10 @@ func NewInjector(cfg *config.Config) (*Injector, error) {
 		cfg:        cfg,
 		enabled:    true,
 		scriptURLs: make(map[string]string),
+		rules:      make(map[string]*Rule),
+		coverage:   csp.NewRecorder("injector"),
+		stop:       make(chan struct{}),
+		stopped:    make(chan struct{}),
 	}
 
 	// Get database connections
@@ -39,6 +45,7 @@ func NewInjector(cfg *config.Config) (*Injector, error) {
 	if dbConnPoolErr != nil {
 		return nil, fmt.Errorf("unable to get database connection pool: %w", dbConnPoolErr)
 	}
+	metrics.RegisterDbPool("injector", dbConnPool)
 	dbConn, dbConnErr := database.GetDbConn(cfg.DbConnString)
 	if dbConnErr != nil {
 		return nil, fmt.Errorf("unable to get database connection: %w", dbConnErr)
@@ -69,20 +76,43 @@ type Injector struct {
 	cfg *config.Config
 
 	// scriptURLs holds all the script URLs used by the injector, mapped to a UUIDv5 key.
+	// They are injected into every page in scope.
 	scriptURLs map[string]string
 
+	// rules holds the injection rules, mapped to their UUID.
+	rules map[string]*Rule
+
+	// scope limits all injection to some of the proxy's targets.
+	scope Scope
+
 	// Database connection pool used for concurrency-safe connections.
 	dbConnPool *pgxpool.Pool
 
 	// Single database connection, used to listen for updates from the database,
 	// which we then use to update our injector in an event-driven manner.
 	listenDbConn *pgx.Conn
+
+	// coverage records whether injected content was allowed by the policy of each page it was injected into.
+	coverage *csp.Recorder
+
+	// stop is closed to signal the Run loop to save the injection coverage and return.
+	stop chan struct{}
+
+	// stopped is closed by the Run loop once it has returned.
+	stopped chan struct{}
+
+	// stopOnce ensures the stop channel is only closed once.
+	stopOnce sync.Once
 }
 
 // Run runs all background operations for the injector plugin; namely, the database monitor that checks
-// for configuration changes and updates the local configuration to match.
+// for configuration changes and updates the local configuration to match, and the periodic save of the injection
+// coverage to the database.
 // Any errors returned should be considered fatal.
 func (injector *Injector) Run() error {
+	// Signal Stop once the loop has returned
+	defer close(injector.stopped)
+
 	// Prepare an error channel for fatal errors
 	fatalErrChan := make(chan error, 1)
 
@@ -93,53 +123,124 @@ func (injector *Injector) Run() error {
 		}
 	}()
 
-	return <-fatalErrChan
+	coverageTicker := time.NewTicker(time.Minute)
+	defer coverageTicker.Stop()
+	for {
+		select {
+		case err := <-fatalErrChan:
+			return err
+		case <-injector.stop:
+			injector.saveCoverage()
+			return nil
+		case <-coverageTicker.C:
+			injector.saveCoverage()
+		}
+	}
+}
+
+// Stop signals the injector plugin to stop, and blocks until the injection coverage has been saved to the database.
+// It must only be called after Run has been started.
+func (injector *Injector) Stop() {
+	injector.stopOnce.Do(func() {
+		close(injector.stop)
+	})
+	<-injector.stopped
+}
+
+// saveCoverage saves the injection coverage recorded since the last save to the database.
+func (injector *Injector) saveCoverage() {
+	if saveErr := injector.coverage.Save(context.Background(), injector.dbConnPool); saveErr != nil {
+		log.WithError(saveErr).Error("unable to save injector injection coverage to database")
+	}
 }
 
 // dbMonitor listens for updates to the injector from the database, and updates the local injector
 // whenever a notification is received.
 // This method runs as a continuous listener, so it will block until an error is returned.
 func (injector *Injector) dbMonitor(ctx context.Context) error {
-	// Establish the listener
-	listenChannel := "injector_script_urls_channel"
-	_, listenErr := injector.listenDbConn.Exec(ctx, "listen "+listenChannel)
-	if listenErr != nil {
-		return fmt.Errorf("unable to listen to channel %q: %w", listenChannel, listenErr)
+	// Establish the listeners
+	for _, listenChannel := range []string{"injector_script_urls_channel", "injector_rules_channel", "injector_config_channel"} {
+		if _, listenErr := injector.listenDbConn.Exec(ctx, "listen "+listenChannel); listenErr != nil {
+			return fmt.Errorf("unable to listen to channel %q: %w", listenChannel, listenErr)
+		}
 	}
 
 	// Wait for notifications
 	for {
 		notification, notificationErr := injector.listenDbConn.WaitForNotification(ctx)
 		if notificationErr != nil {
-			return fmt.Errorf("problem with the %q channel notification listener: %w", listenChannel, notificationErr)
+			return fmt.Errorf("problem with the injector notification listener: %w", notificationErr)
 		}
 
-		// Determine the field that was updated
-		changeType, scriptPayload, separatorFound := strings.Cut(notification.Payload, ",")
-		if !separatorFound {
-			return fmt.Errorf("improperly formatted update notification payload sent from database: %q", notification.Payload)
+		switch notification.Channel {
+		case "injector_rules_channel":
+			if updateErr := injector.updateRuleFromNotification(ctx, notification.Payload); updateErr != nil {
+				return updateErr
+			}
+		case "injector_config_channel":
+			if settingsErr := injector.loadSettings(ctx); settingsErr != nil {
+				return settingsErr
+			}
+		default:
+			if updateErr := injector.updateScriptURLFromNotification(notification.Payload); updateErr != nil {
+				return updateErr
+			}
 		}
+	}
+}
 
-		// Get the script URL and ID
-		scriptId, scriptUrl, scriptSeparatorFound := strings.Cut(scriptPayload, ":")
-		if !scriptSeparatorFound {
-			return fmt.Errorf("improperly formatted script payload sent from database: %q", scriptPayload)
-		}
+// updateScriptURLFromNotification updates the local script URLs from a notification payload sent on the
+// "injector_script_urls_channel" channel.
+func (injector *Injector) updateScriptURLFromNotification(payload string) error {
+	// Determine the field that was updated
+	changeType, scriptPayload, separatorFound := strings.Cut(payload, ",")
+	if !separatorFound {
+		return fmt.Errorf("improperly formatted update notification payload sent from database: %q", payload)
+	}
 
-		injector.mu.Lock()
+	// Get the script URL and ID
+	scriptId, scriptUrl, scriptSeparatorFound := strings.Cut(scriptPayload, ":")
+	if !scriptSeparatorFound {
+		return fmt.Errorf("improperly formatted script payload sent from database: %q", scriptPayload)
+	}
 
-		// Update the local injector
-		switch changeType {
-		case "UPDATE":
-			// Add or update the script URL
-			injector.scriptURLs[scriptId] = scriptUrl
-		case "DELETE":
-			// Delete the script URL
-			delete(injector.scriptURLs, scriptId)
-		}
+	injector.mu.Lock()
+	defer injector.mu.Unlock()
+
+	// Update the local injector
+	switch changeType {
+	case "UPDATE":
+		// Add or update the script URL
+		injector.scriptURLs[scriptId] = scriptUrl
+	case "DELETE":
+		// Delete the script URL
+		delete(injector.scriptURLs, scriptId)
+	}
+
+	return nil
+}
+
+// updateRuleFromNotification updates the local injection rules from a notification payload sent on the
+// "injector_rules_channel" channel. Rule contents can be too large for a notification, so the payload only holds the
+// rule ID, and changed rules are fetched from the database.
+func (injector *Injector) updateRuleFromNotification(ctx context.Context, payload string) error {
+	changeType, ruleID, separatorFound := strings.Cut(payload, ",")
+	if !separatorFound {
+		return fmt.Errorf("improperly formatted update notification payload sent from database: %q", payload)
+	}
 
+	switch changeType {
+	case "UPDATE":
+		if reloadErr := injector.reloadRule(ctx, ruleID); reloadErr != nil {
+			return fmt.Errorf("unable to reload injection rule %q: %w", ruleID, reloadErr)
+		}
+	case "DELETE":
+		injector.mu.Lock()
+		delete(injector.rules, ruleID)
 		injector.mu.Unlock()
 	}
+
+	return nil
 }
 
 // setEnabled sets the injector's "enabled" value to the value provided.
@@ -154,6 +255,77 @@ func (injector *Injector) setEnabled(enabled bool) error {
 	return nil
 }
 
+// Settings holds the injector-wide settings saved in the config_injector table.
+type Settings struct {
+	// Enabled is false if nothing is injected.
+	Enabled bool `json:"enabled"`
+
+	// Scope limits all injection, including script URLs and rules, to some of the proxy's targets.
+	Scope
+}
+
+// getSettings returns the injector-wide settings.
+func (injector *Injector) getSettings() Settings {
+	injector.mu.RLock()
+	defer injector.mu.RUnlock()
+
+	return Settings{Enabled: injector.enabled, Scope: injector.scope.clone()}
+}
+
+// saveSettings validates the given settings, then saves them to the database and the local injector.
+// If an error is returned, the settings are unchanged.
+func (injector *Injector) saveSettings(settings Settings) error {
+	if validateErr := settings.Scope.validate(injector.cfg); validateErr != nil {
+		return validateErr
+	}
+	if settings.Targets == nil {
+		settings.Targets = make([]string, 0)
+	}
+	if settings.Ignored == nil {
+		settings.Ignored = make([]string, 0)
+	}
+
+	injector.mu.Lock()
+	defer injector.mu.Unlock()
+
+	sqlUpdateSettings := `update config_injector set enabled = $1, targets = $2::uuid[], ignored = $3::uuid[];`
+	if _, updateErr := injector.dbConnPool.Exec(context.Background(), sqlUpdateSettings, settings.Enabled, settings.Targets, settings.Ignored); updateErr != nil {
+		return fmt.Errorf("unable to save injector settings to database: %w", updateErr)
+	}
+
+	injector.enabled = settings.Enabled
+	injector.scope = settings.Scope
+
+	return nil
+}
+
+// querySettings returns the injector-wide settings saved in the database.
+func (injector *Injector) querySettings(ctx context.Context) (Settings, error) {
+	var settings Settings
+	sqlSelectSettings := `select enabled, targets::text[], ignored::text[] from config_injector limit 1;`
+	if scanErr := injector.dbConnPool.QueryRow(ctx, sqlSelectSettings).Scan(&settings.Enabled, &settings.Targets, &settings.Ignored); scanErr != nil {
+		return Settings{}, fmt.Errorf("unable to get injector settings from database: %w", scanErr)
+	}
+
+	return settings, nil
+}
+
+// loadSettings updates the local injector-wide settings from the database.
+func (injector *Injector) loadSettings(ctx context.Context) error {
+	settings, queryErr := injector.querySettings(ctx)
+	if queryErr != nil {
+		return queryErr
+	}
+
+	injector.mu.Lock()
+	defer injector.mu.Unlock()
+
+	injector.enabled = settings.Enabled
+	injector.scope = settings.Scope
+
+	return nil
+}
+
 // isEnabled returns true if the Injector plugin is enabled.
 func (injector *Injector) isEnabled() bool {
 	// Not using a mutex, because the performance impact is not worth it for this particular data (for now).
@@ -317,116 +489,96 @@ func (injector *Injector) setFromDb() error {
 		return fmt.Errorf("unexpected error returned from database rows: %w", rowsErr)
 	}
 
+	// Fetch the injector-wide settings
+	settings, settingsErr := injector.querySettings(ctx)
+	if settingsErr != nil {
+		return settingsErr
+	}
+	injector.enabled = settings.Enabled
+	injector.scope = settings.Scope
+
+	// Fetch the injection rules
+	rules, rulesErr := injector.loadRules(ctx)
+	if rulesErr != nil {
+		return rulesErr
+	}
+	injector.rules = rules
+
 	return nil
 }
 
-// JsInResponseHead injects all script URLs into the <head> field of the HTTP response.
-// If an error is returned, JavaScript was not successfully injected into the response.
-func (injector *Injector) JsInResponseHead(response *http.Response, referrerData datatypes.ReferrerData) error {
-	// Only inject if Injector plugin is enabled and there are scripts to inject
-	if !injector.isEnabled() {
-		return nil
-	}
+// InjectResponse applies the script URLs and injection rules in scope to the HTTP response. Scripts and styles are
+// injected into the <head> field of HTML responses, along with the markup of the given prepare functions from other
+// plugins (such as the mapper script), so that the body is only decoded and re-encoded once. Header rules are then
+// applied to the response headers.
+// If an error is returned, the response body was not successfully changed, and header rules were not applied.
+func (injector *Injector) InjectResponse(response *http.Response, referrerData datatypes.ReferrerData, prepares ...internalHttp.HTMLPrepareFunc) error {
+	var headerRules []*Rule
+	if injector.inScope(referrerData) {
+		// Gather the script URLs and rules to inject into the page
+		var markupRules []*Rule
+		markupRules, headerRules = injector.matchingRules(referrerData.Referer.Host, referrerData.Destination.Host)
+		var scriptURLs []string
+		injector.mu.RLock()
+		for _, script := range injector.scriptURLs {
+			// Ignored deleted (empty) script URLs
+			if script == "" {
+				continue
+			}
+			scriptURLs = append(scriptURLs, script)
+		}
+		injector.mu.RUnlock()
 
-	if response.Body == http.NoBody {
-		// This shouldn't happen with an HTML response content-type, but just in case...
-		return nil
+		if len(scriptURLs) > 0 || len(markupRules) > 0 {
+			prepares = append(prepares, injector.prepareHead(response, referrerData.Destination, scriptURLs, markupRules))
+		}
 	}
 
-	// Check that the request is a target
-	if !injector.cfg.IsTarget(referrerData.Referer.Host, referrerData.Destination.Host) {
-		return nil
+	if injectErr := internalHttp.InjectHTML(response, injector.cfg.InjectionReencode, prepares...); injectErr != nil {
+		return injectErr
 	}
 
-	// Read response body
-	respBody, bodyCopy, readErr := internalHttp.ReadBody(response.Body)
-	response.Body = bodyCopy
-	if readErr != nil {
-		return fmt.Errorf("unable to read response body: %w", readErr)
+	// Change the headers last, so that header rules can put back a content security policy
+	for _, rule := range headerRules {
+		rule.applyHeader(response.Header)
 	}
 
-	// Odd edge case, but it's happened
-	if len(respBody) == 0 {
-		return nil
+	return nil
+}
+
+// inScope returns true if the injector is enabled, and the request with the given referrer data is for a target
+// within the injector's scope.
+func (injector *Injector) inScope(referrerData datatypes.ReferrerData) bool {
+	if !injector.isEnabled() {
+		return false
 	}
 
-	switch strings.ToLower(response.Header.Get("content-encoding")) {
-	// No compression
-	case "":
-		break
-	// Gzip compression
-	case "gzip":
-		// Decode response body
-		var decodeErr error
-		respBody, decodeErr = internalHttp.DecodeGzip(respBody)
-		if decodeErr != nil {
-			return fmt.Errorf("unable to gzip-decode response body: %w", decodeErr)
-		}
-	case "br":
-		// Decode response body
-		var decodeErr error
-		respBody, decodeErr = internalHttp.DecodeBrotli(respBody)
-		if decodeErr != nil {
-			return fmt.Errorf("unable to brotli-decode response body: %w", decodeErr)
-		}
-	case "deflate":
-		// Decode response body
-		var decodeErr error
-		respBody, decodeErr = internalHttp.DecodeDeflate(respBody)
-		if decodeErr != nil {
-			return fmt.Errorf("unable to deflate-decode response body: %w", decodeErr)
-		}
-	default:
-		return fmt.Errorf("unsupported content-encoding in response: %s", response.Header.Get("content-encoding"))
+	srcHost, dstHost := referrerData.Referer.Host, referrerData.Destination.Host
+	if !injector.cfg.IsTarget(srcHost, dstHost) {
+		return false
 	}
+	injector.mu.RLock()
+	defer injector.mu.RUnlock()
 
-	// Prepare the HTML code to inject into the page, right from the DOCTYPE declaration
-	jsHeadInject := ""
-	for _, script := range injector.scriptURLs {
-		// Ignored deleted (empty) script URLs
-		if script == "" {
-			continue
+	return injector.scope.matches(injector.cfg, srcHost, dstHost)
+}
+
+// prepareHead returns the function preparing the given script URLs and markup rules for injection into the <head>
+// field of the HTTP response for the given page, changing the page's Content-Security-Policy as needed to allow them.
+func (injector *Injector) prepareHead(response *http.Response, pageURL url.URL, scriptURLs []string, markupRules []*Rule) internalHttp.HTMLPrepareFunc {
+	return func(document []byte) ([]byte, string) {
+		// Prepare the HTML code to inject into the page, allowing each element under the page's
+		// Content-Security-Policy
+		page := csp.NewPage(&pageURL, response.Header, document, injector.cfg.CSPRewrite)
+		headInject := ""
+		for _, script := range scriptURLs {
+			headInject += fmt.Sprintf(`<script type="text/javascript" src=%q%s></script>`, script, page.AllowScript(script, ""))
 		}
-		jsHeadInject += fmt.Sprintf(`<script type="text/javascript" src=%q></script>`, script)
-	}
-
-	// Find the head section of the HTML document within the first 1000 bytes (or the entire body, whichever is
-	// smaller)
-	headIndex := bytes.Index(respBody[:min(len(respBody), 1000)], []byte("<head>"))
-	if headIndex == -1 {
-		// Check for variations of the <head> tag to inject into
-		headIndex = bytes.Index(respBody[:min(len(respBody), 1000)], []byte("<HEAD>"))
-		if headIndex == -1 {
-			// "head" tag not found, so we can't inject.
-			// In many cases, this is because the response is not HTML, so we'll just ignore it.
-			return nil
+		for _, rule := range markupRules {
+			headInject += rule.markup(rule.allow(page))
 		}
-	}
-	// Create a new byte slice to hold the new response body
-	newBody := make([]byte, 0, len(respBody)+len(jsHeadInject))
-	// Copy over the response body up to and including the <head> tag
-	newBody = append(newBody, respBody[:headIndex+len("<head>")]...)
-	// Append the script elements after the <head> tag
-	newBody = append(newBody, []byte(jsHeadInject)...)
-	// Add the rest of the response body back on
-	newBody = append(newBody, respBody[headIndex+len("<head>"):]...)
-	// Replace the response body with the new one
-	respBody = newBody
-
-	// Save updated response body
-	response.Body = io.NopCloser(bytes.NewReader(respBody))
-
-	// TODO: Remove only the necessary part of the "Content-Security-Policy" header, if present, to allow the injection of scripts
-	// Remove the "Content-Security-Policy" header, if present, to allow the injection of scripts
-	response.Header.Del("Content-Security-Policy")
-
-	// Modify headers
-	response.ContentLength = int64(len(respBody))
-	response.Header.Set("content-length", fmt.Sprintf("%d", len(respBody)))
-	// TODO: Check content-type (encoding) higher up in the code, and only inject if it's "text/html; charset=utf-8",
-	// 	or change the character set of the injected content (and associated lookup) to match the content-type.
-	response.Header.Set("content-type", "text/html; charset=utf-8")
-	response.Header.Del("content-encoding") // sending it uncompressed
+		injector.coverage.Record(pageURL, page)
 
-	return nil
+		return page.Apply(response.Header), headInject
+	}
 }
@@ -0,0 +1,380 @@
+package injector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/net/http/httpguts"
+
+	"github.com/TheHackerDev/cartograph/internal/config"
+	"github.com/TheHackerDev/cartograph/internal/shared/csp"
+)
+
+// Injection rule types.
+const (
+	ruleTypeScript       string = "script"
+	ruleTypeInlineScript string = "inline_script"
+	ruleTypeStylesheet   string = "stylesheet"
+	ruleTypeInlineStyle  string = "inline_style"
+	ruleTypeHeader       string = "header"
+)
+
+// Header rule actions.
+const (
+	headerActionAdd    string = "add"
+	headerActionSet    string = "set"
+	headerActionDelete string = "delete"
+)
+
+// errRuleNotFound is returned when no injection rule exists with a given ID.
+var errRuleNotFound = errors.New("no injection rule found")
+
+// Scope limits injection to the hosts matched by rule sets from the targets table, on top of the proxy's own targets.
+type Scope struct {
+	// Targets holds the IDs of the target rule sets to inject into. If empty, every target is included.
+	Targets []string `json:"targets"`
+
+	// Ignored holds the IDs of the target rule sets to never inject into.
+	Ignored []string `json:"ignored"`
+}
+
+// matches returns true if the given hosts are within the scope.
+func (s Scope) matches(cfg *config.Config, srcHost, dstHost string) bool {
+	if cfg.MatchesTargetRules(s.Ignored, srcHost, dstHost) {
+		return false
+	}
+
+	return len(s.Targets) == 0 || cfg.MatchesTargetRules(s.Targets, srcHost, dstHost)
+}
+
+// clone returns a copy of the scope that does not share its slices.
+func (s Scope) clone() Scope {
+	return Scope{
+		Targets: append(make([]string, 0, len(s.Targets)), s.Targets...),
+		Ignored: append(make([]string, 0, len(s.Ignored)), s.Ignored...),
+	}
+}
+
+// validate returns an error if the scope refers to a rule set that does not exist, and normalizes the rule set IDs
+// for matching.
+func (s *Scope) validate(cfg *config.Config) error {
+	for _, ids := range [][]string{s.Targets, s.Ignored} {
+		for i, id := range ids {
+			ids[i] = strings.ToLower(strings.TrimSpace(id))
+			if !cfg.HasTargetRule(ids[i]) {
+				return fmt.Errorf("no target rule set found with ID %q", id)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Rule is a single injection rule: a script, stylesheet, or response header to add to the responses of the hosts in
+// its scope.
+type Rule struct {
+	// ID is the UUID of the rule.
+	ID string `json:"id"`
+
+	// Name is a description of the rule.
+	Name string `json:"name"`
+
+	// Enabled is false if the rule is saved but not applied.
+	Enabled bool `json:"enabled"`
+
+	// Priority orders the rules, from the lowest value to the highest. Rules with the same priority are applied in
+	// order of their IDs.
+	Priority int `json:"priority"`
+
+	// Type is one of "script", "inline_script", "stylesheet", "inline_style", or "header".
+	Type string `json:"type"`
+
+	// Content is the script or stylesheet URL, the body of an inline script or style, or the value of a header.
+	Content string `json:"content"`
+
+	// HeaderName and HeaderAction are the response header to change, and whether to add a value to it, set it, or
+	// delete it. They are only used by header rules.
+	HeaderName   string `json:"header_name,omitempty"`
+	HeaderAction string `json:"header_action,omitempty"`
+
+	// Scope limits the rule to some of the injector's targets.
+	Scope
+}
+
+// validate checks the rule's fields, and normalizes them for saving.
+func (rule *Rule) validate(cfg *config.Config) error {
+	rule.Name = strings.TrimSpace(rule.Name)
+	if rule.Type != ruleTypeHeader {
+		rule.HeaderName = ""
+		rule.HeaderAction = ""
+	}
+
+	switch rule.Type {
+	case ruleTypeScript, ruleTypeStylesheet:
+		rule.Content = strings.TrimSpace(rule.Content)
+		if rule.Content == "" {
+			return fmt.Errorf("a URL is required for %s rules", rule.Type)
+		}
+		if _, parseErr := url.Parse(rule.Content); parseErr != nil {
+			return fmt.Errorf("invalid URL provided (%q): %w", rule.Content, parseErr)
+		}
+	case ruleTypeInlineScript, ruleTypeInlineStyle:
+		if strings.TrimSpace(rule.Content) == "" {
+			return fmt.Errorf("content is required for %s rules", rule.Type)
+		}
+	case ruleTypeHeader:
+		rule.HeaderName = http.CanonicalHeaderKey(strings.TrimSpace(rule.HeaderName))
+		if !httpguts.ValidHeaderFieldName(rule.HeaderName) {
+			return fmt.Errorf("invalid header name provided: %q", rule.HeaderName)
+		}
+		switch rule.HeaderAction {
+		case headerActionAdd, headerActionSet:
+			if !httpguts.ValidHeaderFieldValue(rule.Content) {
+				return fmt.Errorf("invalid header value provided: %q", rule.Content)
+			}
+		case headerActionDelete:
+			rule.Content = ""
+		default:
+			return fmt.Errorf("header_action must be one of %q, %q, or %q", headerActionAdd, headerActionSet, headerActionDelete)
+		}
+	default:
+		return fmt.Errorf("type must be one of %q, %q, %q, %q, or %q", ruleTypeScript, ruleTypeInlineScript, ruleTypeStylesheet, ruleTypeInlineStyle, ruleTypeHeader)
+	}
+
+	return rule.Scope.validate(cfg)
+}
+
+// markup returns the HTML element that injects the rule into a page, with the given attributes, or an empty string
+// for header rules.
+func (rule *Rule) markup(attributes string) string {
+	switch rule.Type {
+	case ruleTypeScript:
+		return fmt.Sprintf(`<script type="text/javascript" src="%s"%s></script>`, html.EscapeString(rule.Content), attributes)
+	case ruleTypeInlineScript:
+		return fmt.Sprintf(`<script type="text/javascript"%s>%s</script>`, attributes, rule.Content)
+	case ruleTypeStylesheet:
+		return fmt.Sprintf(`<link rel="stylesheet" href="%s"%s>`, html.EscapeString(rule.Content), attributes)
+	case ruleTypeInlineStyle:
+		return fmt.Sprintf(`<style%s>%s</style>`, attributes, rule.Content)
+	}
+
+	return ""
+}
+
+// allow ensures that the rule's element is allowed by the page's Content-Security-Policy, and returns any attributes
+// to add to the element.
+func (rule *Rule) allow(page *csp.Page) string {
+	switch rule.Type {
+	case ruleTypeScript:
+		return page.AllowScript(rule.Content, "")
+	case ruleTypeInlineScript:
+		return page.AllowScript("", rule.Content)
+	case ruleTypeStylesheet:
+		return page.AllowStyle(rule.Content, "")
+	case ruleTypeInlineStyle:
+		return page.AllowStyle("", rule.Content)
+	}
+
+	return ""
+}
+
+// applyHeader changes the given response headers according to the header rule.
+func (rule *Rule) applyHeader(header http.Header) {
+	switch rule.HeaderAction {
+	case headerActionAdd:
+		header.Add(rule.HeaderName, rule.Content)
+	case headerActionSet:
+		header.Set(rule.HeaderName, rule.Content)
+	case headerActionDelete:
+		header.Del(rule.HeaderName)
+	}
+}
+
+// sortRules sorts the given rules by priority, then ID.
+func sortRules(rules []*Rule) {
+	sort.Slice(rules, func(i, j int) bool {
+		if rules[i].Priority != rules[j].Priority {
+			return rules[i].Priority < rules[j].Priority
+		}
+		return rules[i].ID < rules[j].ID
+	})
+}
+
+// sqlSelectRules selects every column of the injector_rules table, in the order scanned by scanRule.
+const sqlSelectRules string = `select id::text, name, enabled, priority, type, content, header_name, header_action, targets::text[], ignored::text[] from injector_rules`
+
+// scanRule scans a single row selected with sqlSelectRules.
+func scanRule(row pgx.Row) (*Rule, error) {
+	var rule Rule
+	if scanErr := row.Scan(&rule.ID, &rule.Name, &rule.Enabled, &rule.Priority, &rule.Type, &rule.Content, &rule.HeaderName, &rule.HeaderAction, &rule.Targets, &rule.Ignored); scanErr != nil {
+		return nil, scanErr
+	}
+
+	return &rule, nil
+}
+
+// loadRules returns every injection rule saved in the database.
+func (injector *Injector) loadRules(ctx context.Context) (map[string]*Rule, error) {
+	rows, queryErr := injector.dbConnPool.Query(ctx, sqlSelectRules+`;`)
+	if queryErr != nil {
+		return nil, fmt.Errorf("unable to get injection rules from database: %w", queryErr)
+	}
+
+	// Ensure the rows are closed; it's safe to close rows multiple times.
+	defer rows.Close()
+
+	rules := make(map[string]*Rule)
+	for rows.Next() {
+		rule, scanErr := scanRule(rows)
+		if scanErr != nil {
+			return nil, fmt.Errorf("unable to scan injection rule from database: %w", scanErr)
+		}
+		rules[rule.ID] = rule
+	}
+
+	// One final check for errors encountered by rows.Next or rows.Scan
+	if rowsErr := rows.Err(); rowsErr != nil {
+		return nil, fmt.Errorf("unexpected error returned from database rows: %w", rowsErr)
+	}
+
+	return rules, nil
+}
+
+// loadRule returns the injection rule with the given ID from the database, or errRuleNotFound if it does not exist.
+func (injector *Injector) loadRule(ctx context.Context, id string) (*Rule, error) {
+	rule, scanErr := scanRule(injector.dbConnPool.QueryRow(ctx, sqlSelectRules+` where id = $1::uuid;`, id))
+	if errors.Is(scanErr, pgx.ErrNoRows) {
+		return nil, errRuleNotFound
+	} else if scanErr != nil {
+		return nil, fmt.Errorf("unable to get injection rule from database: %w", scanErr)
+	}
+
+	return rule, nil
+}
+
+// getRules returns all injection rules, in the order they are applied.
+func (injector *Injector) getRules() []*Rule {
+	injector.mu.RLock()
+	defer injector.mu.RUnlock()
+
+	rules := make([]*Rule, 0, len(injector.rules))
+	for _, rule := range injector.rules {
+		rules = append(rules, rule)
+	}
+	sortRules(rules)
+
+	return rules
+}
+
+// getRule returns the injection rule with the given ID, or nil if it does not exist.
+func (injector *Injector) getRule(id string) *Rule {
+	injector.mu.RLock()
+	defer injector.mu.RUnlock()
+
+	return injector.rules[strings.ToLower(id)]
+}
+
+// saveRule validates the given rule, then inserts it into the database if it has no ID, or replaces the existing rule
+// with its ID. It returns the saved rule.
+func (injector *Injector) saveRule(rule *Rule) (*Rule, error) {
+	if validateErr := rule.validate(injector.cfg); validateErr != nil {
+		return nil, validateErr
+	}
+	if rule.Targets == nil {
+		rule.Targets = make([]string, 0)
+	}
+	if rule.Ignored == nil {
+		rule.Ignored = make([]string, 0)
+	}
+
+	ctx := context.Background()
+	var saveErr error
+	if rule.ID == "" {
+		sqlInsertRule := `insert into injector_rules (name, enabled, priority, type, content, header_name, header_action, targets, ignored)
+			values ($1, $2, $3, $4, $5, $6, $7, $8::uuid[], $9::uuid[]) returning id::text;`
+		saveErr = injector.dbConnPool.QueryRow(ctx, sqlInsertRule, rule.Name, rule.Enabled, rule.Priority, rule.Type, rule.Content, rule.HeaderName, rule.HeaderAction, rule.Targets, rule.Ignored).Scan(&rule.ID)
+	} else {
+		sqlUpdateRule := `update injector_rules
+			set name = $2, enabled = $3, priority = $4, type = $5, content = $6, header_name = $7, header_action = $8, targets = $9::uuid[], ignored = $10::uuid[]
+			where id = $1::uuid returning id::text;`
+		saveErr = injector.dbConnPool.QueryRow(ctx, sqlUpdateRule, rule.ID, rule.Name, rule.Enabled, rule.Priority, rule.Type, rule.Content, rule.HeaderName, rule.HeaderAction, rule.Targets, rule.Ignored).Scan(&rule.ID)
+	}
+	if errors.Is(saveErr, pgx.ErrNoRows) {
+		return nil, errRuleNotFound
+	} else if saveErr != nil {
+		return nil, fmt.Errorf("unable to save injection rule to database: %w", saveErr)
+	}
+
+	// Update the local injector straight away, rather than waiting for the database notification
+	injector.mu.Lock()
+	injector.rules[rule.ID] = rule
+	injector.mu.Unlock()
+
+	return rule, nil
+}
+
+// removeRule removes the injection rule with the given ID.
+func (injector *Injector) removeRule(id string) error {
+	result, deleteErr := injector.dbConnPool.Exec(context.Background(), `delete from injector_rules where id = $1::uuid;`, id)
+	if deleteErr != nil {
+		return fmt.Errorf("unable to delete injection rule from database: %w", deleteErr)
+	}
+	if result.RowsAffected() == 0 {
+		return errRuleNotFound
+	}
+
+	injector.mu.Lock()
+	delete(injector.rules, strings.ToLower(id))
+	injector.mu.Unlock()
+
+	return nil
+}
+
+// reloadRule updates the local copy of the injection rule with the given ID from the database.
+func (injector *Injector) reloadRule(ctx context.Context, id string) error {
+	rule, loadErr := injector.loadRule(ctx, id)
+	if errors.Is(loadErr, errRuleNotFound) {
+		// The rule was deleted again before the notification was handled
+		injector.mu.Lock()
+		delete(injector.rules, id)
+		injector.mu.Unlock()
+		return nil
+	} else if loadErr != nil {
+		return loadErr
+	}
+
+	injector.mu.Lock()
+	injector.rules[rule.ID] = rule
+	injector.mu.Unlock()
+
+	return nil
+}
+
+// matchingRules returns the enabled injection rules whose scope includes the given hosts, in the order they are
+// applied, split into rules that inject markup into the page and rules that change the response headers.
+func (injector *Injector) matchingRules(srcHost, dstHost string) (markup []*Rule, headers []*Rule) {
+	injector.mu.RLock()
+	defer injector.mu.RUnlock()
+
+	for _, rule := range injector.rules {
+		if !rule.Enabled || !rule.Scope.matches(injector.cfg, srcHost, dstHost) {
+			continue
+		}
+		if rule.Type == ruleTypeHeader {
+			headers = append(headers, rule)
+		} else {
+			markup = append(markup, rule)
+		}
+	}
+	sortRules(markup)
+	sortRules(headers)
+
+	return markup, headers
+}
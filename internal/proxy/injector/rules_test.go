@@ -0,0 +1,58 @@
+package injector
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRuleValidate(t *testing.T) {
+	valid := []Rule{
+		{Type: ruleTypeScript, Content: " https://cdn.example.com/hook.js "},
+		{Type: ruleTypeInlineStyle, Content: "body { outline: 1px solid red; }"},
+		{Type: ruleTypeHeader, HeaderName: "content-security-policy-report-only", HeaderAction: headerActionSet, Content: "default-src 'self'; report-uri /csp"},
+		{Type: ruleTypeHeader, HeaderName: "X-Frame-Options", HeaderAction: headerActionDelete, Content: "ignored"},
+	}
+	for _, rule := range valid {
+		if err := rule.validate(nil); err != nil {
+			t.Errorf("validate(%+v) returned error: %s", rule, err)
+		}
+	}
+
+	invalid := []Rule{
+		{Type: "image", Content: "https://example.com/pixel.gif"},
+		{Type: ruleTypeScript},
+		{Type: ruleTypeInlineScript, Content: "  "},
+		{Type: ruleTypeHeader, HeaderName: "Bad Header", HeaderAction: headerActionSet, Content: "x"},
+		{Type: ruleTypeHeader, HeaderName: "X-Test", HeaderAction: "replace", Content: "x"},
+		{Type: ruleTypeHeader, HeaderName: "X-Test", HeaderAction: headerActionAdd, Content: "line\r\nbreak"},
+	}
+	for _, rule := range invalid {
+		if err := rule.validate(nil); err == nil {
+			t.Errorf("validate(%+v) returned no error", rule)
+		}
+	}
+}
+
+func TestRuleApply(t *testing.T) {
+	script := Rule{Type: ruleTypeScript, Content: `https://cdn.example.com/a.js?x="1"&y=2`}
+	if got, want := script.markup(""), `<script type="text/javascript" src="https://cdn.example.com/a.js?x=&#34;1&#34;&amp;y=2"></script>`; got != want {
+		t.Errorf(`markup("") = %s, want %s`, got, want)
+	}
+
+	header := http.Header{"Content-Security-Policy": {"default-src 'self'"}}
+	rules := []Rule{
+		{ID: "2", Type: ruleTypeHeader, HeaderName: "Content-Security-Policy", HeaderAction: headerActionDelete},
+		{ID: "1", Priority: 1, Type: ruleTypeHeader, HeaderName: "Content-Security-Policy-Report-Only", HeaderAction: headerActionAdd, Content: "default-src 'self'"},
+	}
+	sorted := []*Rule{&rules[1], &rules[0]}
+	sortRules(sorted)
+	for _, rule := range sorted {
+		rule.applyHeader(header)
+	}
+	if header.Get("Content-Security-Policy") != "" || header.Get("Content-Security-Policy-Report-Only") != "default-src 'self'" {
+		t.Errorf("headers = %v, want the policy moved to report-only", header)
+	}
+	if sorted[0].ID != "2" {
+		t.Errorf("sortRules() put rule %s first, want the lower priority rule 2", sorted[0].ID)
+	}
+}
@@ -0,0 +1,86 @@
+package logger
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	internalHttp "github.com/TheHackerDev/cartograph/internal/shared/http"
+)
+
+// PathTreeAPIHandler is a http handler function that returns the tree of paths logged for the host given by the
+// "host" query parameter, as JSON.
+func PathTreeAPIHandler(logger *Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Only allow GET requests (or OPTIONS)
+		if r.Method == http.MethodOptions {
+			w.Header().Set("Allow", "GET, OPTIONS")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		} else if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET, OPTIONS")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		host := r.URL.Query().Get("host")
+		if host == "" {
+			http.Error(w, "host is required", http.StatusBadRequest)
+			return
+		}
+
+		pathTree, pathTreeErr := logger.getPathTreeForDomain(host)
+		if pathTreeErr != nil {
+			http.Error(w, fmt.Sprintf("unable to get path tree for host: %s", pathTreeErr), http.StatusInternalServerError)
+			return
+		}
+
+		internalHttp.WriteJSON(w, http.StatusOK, pathTree)
+	}
+}
+
+// ParametersAPIHandler is a http handler function that returns the parameter key-value pairs logged for the host and
+// path given by the "host" and "path" query parameters, as JSON. The results can be limited to responses with
+// particular status codes with a comma-separated "response_codes" query parameter.
+func ParametersAPIHandler(logger *Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Only allow GET requests (or OPTIONS)
+		if r.Method == http.MethodOptions {
+			w.Header().Set("Allow", "GET, OPTIONS")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		} else if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET, OPTIONS")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		query := r.URL.Query()
+		host, path := query.Get("host"), query.Get("path")
+		if host == "" || path == "" {
+			http.Error(w, "host and path are required", http.StatusBadRequest)
+			return
+		}
+
+		responseCodes := make([]int, 0)
+		if codes := query.Get("response_codes"); codes != "" {
+			for _, code := range strings.Split(codes, ",") {
+				responseCode, atoiErr := strconv.Atoi(strings.TrimSpace(code))
+				if atoiErr != nil {
+					http.Error(w, fmt.Sprintf("invalid response code %q", code), http.StatusBadRequest)
+					return
+				}
+				responseCodes = append(responseCodes, responseCode)
+			}
+		}
+
+		parameters, parametersErr := logger.getParametersForPath(host, path, responseCodes)
+		if parametersErr != nil {
+			http.Error(w, fmt.Sprintf("unable to get parameters for path: %s", parametersErr), http.StatusInternalServerError)
+			return
+		}
+
+		internalHttp.WriteJSON(w, http.StatusOK, parameters)
+	}
+}
@@ -3,6 +3,7 @@ package logger
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math/rand"
 	"net/url"
@@ -18,11 +19,12 @@ import (
 	"github.com/TheHackerDev/cartograph/internal/config"
 	"github.com/TheHackerDev/cartograph/internal/shared/database"
 	"github.com/TheHackerDev/cartograph/internal/shared/datatypes"
+	"github.com/TheHackerDev/cartograph/internal/shared/dispatch"
+	"github.com/TheHackerDev/cartograph/internal/shared/metrics"
 )
 
 const (
-	httpDataInputBufferSize int = 100
-	httpDataCacheSize       int = 40
+	httpDataCacheSize int = 40
 )
 
 // Namespace value used for all UUIDv5 functions in database, for logger-related data.
@@ -36,8 +38,12 @@ func NewLogger(cfg *config.Config) (*Logger, error) {
 		mu:            sync.RWMutex{},
 		cfg:           cfg,
 		enabled:       true,
-		httpDataInput: make(chan *datatypes.HttpReqResp, httpDataInputBufferSize),
 		httpDataCache: make([]*datatypes.HttpReqResp, 0, httpDataCacheSize),
+
+		streamEventCache: make([]*datatypes.StreamEvent, 0, streamEventCacheSize),
+
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
 	}
 
 	// Get database connections
@@ -45,10 +51,20 @@ func NewLogger(cfg *config.Config) (*Logger, error) {
 	if dbConnPoolErr != nil {
 		return nil, fmt.Errorf("unable to get database connection pool: %w", dbConnPoolErr)
 	}
+	metrics.RegisterDbPool("logger", dbConnPool)
 
 	// Set database connection values
 	logger.dbConnPool = dbConnPool
 
+	// Create the input queues
+	var queueErr error
+	if logger.httpDataInput, queueErr = dispatch.NewQueue[*datatypes.HttpReqResp]("logger-http", cfg.LoggerQueue); queueErr != nil {
+		return nil, fmt.Errorf("unable to create HTTP data input queue: %w", queueErr)
+	}
+	if logger.streamEventInput, queueErr = dispatch.NewQueue[*datatypes.StreamEvent]("logger-streams", cfg.LoggerQueue); queueErr != nil {
+		return nil, fmt.Errorf("unable to create stream event input queue: %w", queueErr)
+	}
+
 	return logger, nil
 }
 
@@ -68,16 +84,34 @@ type Logger struct {
 	cfg *config.Config
 
 	// httpDataInput is used to accept all HTTP request and response data to be logged to the database.
-	httpDataInput chan *datatypes.HttpReqResp
+	httpDataInput *dispatch.Queue[*datatypes.HttpReqResp]
 
 	// httpDataCache is used to temporarily cache HTTP data before sending it to the database in a batch copy.
 	httpDataCache []*datatypes.HttpReqResp
+
+	// streamEventInput is used to accept events parsed from streaming HTTP responses to be logged to the database.
+	streamEventInput *dispatch.Queue[*datatypes.StreamEvent]
+
+	// streamEventCache is used to temporarily cache stream events before sending them to the database in a batch copy.
+	streamEventCache []*datatypes.StreamEvent
+
+	// stop is closed to signal the Run loop to flush its caches and return.
+	stop chan struct{}
+
+	// stopped is closed by the Run loop once its caches have been flushed.
+	stopped chan struct{}
+
+	// stopOnce ensures the stop channel is only closed once.
+	stopOnce sync.Once
 }
 
 // Run will start the logger plugin.
 // This function should be called in a goroutine, as it will block indefinitely, until an error is returned.
 // Any errors returned should be considered fatal.
 func (logger *Logger) Run() error {
+	// Signal Stop once the loop has returned
+	defer close(logger.stopped)
+
 	// Prepare an error channel for fatal errors
 	fatalErrChan := make(chan error, 1)
 
@@ -90,49 +124,133 @@ func (logger *Logger) Run() error {
 	for {
 		select {
 		case err := <-fatalErrChan:
-			// Flush the local cache to the database, then return the error
-			logger.saveCacheToDb()
-			logger.clearCache()
+			// Flush the local caches to the database, then return the error
+			logger.flushCaches()
 			return err
-		case httpData := <-logger.httpDataInput:
-			// Check that the http data is a logger target
-			if !logger.cfg.IsTarget(httpData.ReferrerData.Referer.Host, httpData.Request.Url.Host) {
-				continue
-			}
+		case <-logger.stop:
+			// Stop reading spilled data back into the input queues, handle any data still waiting in memory, then
+			// flush the local caches to the database
+			logger.closeInputs()
+			logger.drainInputs()
+			logger.flushCaches()
+			return nil
+		case httpData := <-logger.httpDataInput.Items():
+			logger.handleHttpData(httpData)
+		case streamEvent := <-logger.streamEventInput.Items():
+			logger.handleStreamEvent(streamEvent)
+		case <-cacheFlushTicker.C:
+			logger.flushCaches()
+		}
+	}
+}
+
+// Stop signals the logger plugin to stop, and blocks until all cached data has been saved to the database.
+// It must only be called after Run has been started.
+func (logger *Logger) Stop() {
+	logger.stopOnce.Do(func() {
+		close(logger.stop)
+	})
+	<-logger.stopped
+}
 
-			// Create a deep copy of the data, so we can safely modify it, as this same data is also
-			// referenced elsewhere.
-			data := httpData.DeepCopy()
+// handleHttpData adds the given HTTP data to the cache, and saves the cache to the database once it is full.
+func (logger *Logger) handleHttpData(httpData *datatypes.HttpReqResp) {
+	// Check that the http data is a logger target
+	if !logger.cfg.IsTarget(httpData.ReferrerData.Referer.Host, httpData.Request.Url.Host) {
+		return
+	}
 
-			// Remove unwanted data from the HTTP data
-			cleanReqRespData(&data)
+	// Create a deep copy of the data, so we can safely modify it, as this same data is also
+	// referenced elsewhere.
+	data := httpData.DeepCopy()
 
-			// Add the data to the cache
-			logger.saveToCache(&data)
+	// Remove unwanted data from the HTTP data
+	cleanReqRespData(&data)
 
-			// Save the data
-			if !logger.cacheFull() {
-				continue
-			}
+	// Add the data to the cache
+	logger.saveToCache(&data)
 
-			// Save cache to the database
-			logger.saveCacheToDb()
+	// Save the data
+	if !logger.cacheFull() {
+		return
+	}
 
-			// Clear the cache
-			logger.clearCache()
-		case <-cacheFlushTicker.C:
-			// Save the cache to the database
-			logger.saveCacheToDb()
+	// Save cache to the database, then clear the cache
+	logger.flushHttpDataCache()
+}
 
-			// Clear the cache again
-			logger.clearCache()
+// handleStreamEvent adds the given stream event to the cache, and saves the cache to the database once it is full.
+func (logger *Logger) handleStreamEvent(streamEvent *datatypes.StreamEvent) {
+	// Check that the stream event is a logger target
+	if !logger.cfg.IsTarget(streamEvent.Referer.Host, streamEvent.Url.Host) {
+		return
+	}
+
+	// Add the event to the cache, and save the cache to the database once it is full
+	logger.saveStreamEventToCache(streamEvent)
+	if !logger.streamEventCacheFull() {
+		return
+	}
+	logger.flushStreamEventCache()
+}
+
+// drainInputs handles all data currently waiting in the input channels, without blocking.
+func (logger *Logger) drainInputs() {
+	for {
+		select {
+		case httpData := <-logger.httpDataInput.Items():
+			logger.handleHttpData(httpData)
+		case streamEvent := <-logger.streamEventInput.Items():
+			logger.handleStreamEvent(streamEvent)
+		default:
+			return
 		}
 	}
 }
 
+// closeInputs closes the input queues, keeping any spilled data on disk for the next run.
+func (logger *Logger) closeInputs() {
+	if closeErr := logger.httpDataInput.Close(); closeErr != nil {
+		log.WithError(closeErr).Error("unable to close HTTP data input queue")
+	}
+	if closeErr := logger.streamEventInput.Close(); closeErr != nil {
+		log.WithError(closeErr).Error("unable to close stream event input queue")
+	}
+}
+
+// flushCaches saves all local caches to the database, then clears them.
+func (logger *Logger) flushCaches() {
+	logger.flushHttpDataCache()
+	logger.flushStreamEventCache()
+}
+
+// flushHttpDataCache saves the HTTP data cache to the database, records the flush in the input queue statistics,
+// then clears the cache.
+func (logger *Logger) flushHttpDataCache() {
+	start := time.Now()
+	saveErr := logger.saveCacheToDb()
+	logger.httpDataInput.RecordFlush(len(logger.httpDataCache), time.Since(start), saveErr)
+	logger.clearCache()
+}
+
+// flushStreamEventCache saves the stream event cache to the database, records the flush in the input queue
+// statistics, then clears the cache.
+func (logger *Logger) flushStreamEventCache() {
+	start := time.Now()
+	saveErr := logger.saveStreamEventCacheToDb()
+	logger.streamEventInput.RecordFlush(len(logger.streamEventCache), time.Since(start), saveErr)
+	logger.clearStreamEventCache()
+}
+
+// QueueStats returns the statistics for the logger's input queues.
+func (logger *Logger) QueueStats() []dispatch.Stats {
+	return []dispatch.Stats{logger.httpDataInput.Stats(), logger.streamEventInput.Stats()}
+}
+
 // LogHttpData is used to send HTTP request and response data to the logger for processing.
+// It does not block; if the input queue is full, the data is handled according to the queue policy.
 func (logger *Logger) LogHttpData(httpData *datatypes.HttpReqResp) {
-	logger.httpDataInput <- httpData
+	logger.httpDataInput.Enqueue(httpData)
 }
 
 // saveToCache saves the given HTTP data to the local cache, which will eventually be sent to the database
@@ -167,8 +285,9 @@ func (logger *Logger) clearCache() {
 // We are deliberately making a trade-off between speed and accuracy, so malformed data will simply be skipped,
 // and a bad database connection simply results in all the data not being logged. Therefore, it is very important
 // to watch for error logs from this function, as they will not stop the logger from working, but HTTP data may
-// not be logged to the database as a result.
-func (logger *Logger) saveCacheToDb() {
+// not be logged to the database as a result. An error is returned only if a table could not be saved to after all
+// retries.
+func (logger *Logger) saveCacheToDb() error {
 	ctx := context.Background()
 
 	// Slices containing all the data we're going to copy into the database tables
@@ -354,12 +473,13 @@ func (logger *Logger) saveCacheToDb() {
 			}
 
 			// Add to the API Hunter input rows slice
-			apiHunterInputRows = append(apiHunterInputRows, []interface{}{rr.Request.Url.Scheme, rr.Request.Url.Host, rr.Request.Url.Path, rr.Request.Method, rr.Request.BodyJson, rr.Request.BodyText, rr.Response.BodyJson, rr.Response.BodyText, rr.Response.StatusCode, rr.Request.Timestamp})
+			apiHunterInputRows = append(apiHunterInputRows, []interface{}{rr.Request.Url.Scheme, rr.Request.Url.Host, rr.Request.Url.Path, rr.Request.Method, rr.Request.BodyJson, rr.Request.BodyText, rr.Response.BodyJson, rr.Response.BodyText, rr.Response.StatusCode, rr.Request.Timestamp, rr.Request.GrpcService, rr.Request.GrpcMethod})
 		}
 	}
 
 	// Perform the logger and API Hunter database transactions in goroutines
 	var wg sync.WaitGroup
+	var inventoryErr, apiHunterErr error
 
 	// Log the inventory data
 	if len(inventoryInputRows) > 0 {
@@ -488,6 +608,10 @@ func (logger *Logger) saveCacheToDb() {
 
 				txOk = true
 			}
+
+			if !txOk {
+				inventoryErr = fmt.Errorf("unable to save inventory data to database after %d attempts", maxRetries)
+			}
 		}()
 	}
 
@@ -521,7 +645,9 @@ func (logger *Logger) saveCacheToDb() {
 						resp_body_json  jsonb,
 						resp_body_plain text,
 						resp_code       integer default 0        not null,
-						timestamp       timestamp with time zone not null
+						timestamp       timestamp with time zone not null,
+						grpc_service    text    default ''::text not null,
+						grpc_method     text    default ''::text not null
 					) ON COMMIT DROP;
 				`, tmpTableName)
 
@@ -537,7 +663,7 @@ func (logger *Logger) saveCacheToDb() {
 				copyCount, copyErr := tx.CopyFrom(
 					ctx,
 					pgx.Identifier{tmpTableName},
-					[]string{"url_scheme", "url_host", "url_path", "req_method", "req_body_json", "req_body_plain", "resp_body_json", "resp_body_plain", "resp_code", "timestamp"},
+					[]string{"url_scheme", "url_host", "url_path", "req_method", "req_body_json", "req_body_plain", "resp_body_json", "resp_body_plain", "resp_code", "timestamp", "grpc_service", "grpc_method"},
 					pgx.CopyFromRows(apiHunterInputRows),
 				)
 
@@ -559,8 +685,8 @@ func (logger *Logger) saveCacheToDb() {
 
 				// Copy the data from the temporary table into the actual data_api_hunter table
 				_, insertErr := tx.Exec(ctx, fmt.Sprintf(`
-            INSERT INTO data_api_hunter (url_scheme, url_host, url_path, req_method, req_body_json, req_body_plain, resp_body_json, resp_body_plain, resp_code, timestamp)
-            SELECT url_scheme, url_host, url_path, req_method, req_body_json, req_body_plain, resp_body_json, resp_body_plain, resp_code, timestamp
+            INSERT INTO data_api_hunter (url_scheme, url_host, url_path, req_method, req_body_json, req_body_plain, resp_body_json, resp_body_plain, resp_code, timestamp, grpc_service, grpc_method)
+            SELECT url_scheme, url_host, url_path, req_method, req_body_json, req_body_plain, resp_body_json, resp_body_plain, resp_code, timestamp, grpc_service, grpc_method
             FROM %s
             ON CONFLICT DO NOTHING;
         `, tmpTableName))
@@ -583,12 +709,16 @@ func (logger *Logger) saveCacheToDb() {
 
 				txOk = true
 			}
+
+			if !txOk {
+				apiHunterErr = fmt.Errorf("unable to save API hunter data to database after %d attempts", maxRetries)
+			}
 		}()
 	}
 
 	wg.Wait()
 
-	return
+	return errors.Join(inventoryErr, apiHunterErr)
 }
 
 // saveCacheToDbPrivacyEnhanced saves the given HTTP request and response data to the database.
@@ -0,0 +1,164 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/TheHackerDev/cartograph/internal/shared/datatypes"
+)
+
+const (
+	streamEventCacheSize int = 40
+)
+
+// LogStreamEvent is used to send events parsed from streaming HTTP responses to the logger for processing.
+// It does not block; if the input queue is full, the event is handled according to the queue policy.
+func (logger *Logger) LogStreamEvent(event *datatypes.StreamEvent) {
+	logger.streamEventInput.Enqueue(event)
+}
+
+// saveStreamEventToCache saves the given stream event to the local cache, which will eventually be sent to the
+// database in a large batch transaction.
+func (logger *Logger) saveStreamEventToCache(event *datatypes.StreamEvent) {
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+
+	logger.streamEventCache = append(logger.streamEventCache, event)
+}
+
+// streamEventCacheFull returns true if the stream event cache is full, and ready to be flushed to the database.
+func (logger *Logger) streamEventCacheFull() bool {
+	logger.mu.RLock()
+	defer logger.mu.RUnlock()
+
+	return len(logger.streamEventCache) >= streamEventCacheSize
+}
+
+// clearStreamEventCache clears the stream event cache, while keeping the allocated memory.
+func (logger *Logger) clearStreamEventCache() {
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+
+	logger.streamEventCache = logger.streamEventCache[:0]
+}
+
+// saveStreamEventCacheToDb saves the cached stream events to the database.
+// All errors are logged by this function, following the same rollback and retry approach as saveCacheToDb. An error
+// is returned only if the events could not be saved after all retries.
+func (logger *Logger) saveStreamEventCacheToDb() error {
+	ctx := context.Background()
+
+	// Lock the stream event cache
+	logger.mu.RLock()
+	defer logger.mu.RUnlock()
+
+	if len(logger.streamEventCache) == 0 {
+		return nil
+	}
+
+	// Create the data structure that we will copy into the temporary table
+	inputRows := make([][]interface{}, 0, len(logger.streamEventCache))
+	for _, event := range logger.streamEventCache {
+		inputRows = append(inputRows, []interface{}{event.Url.Scheme, event.Url.Host, event.Url.Path, event.Method, event.StatusCode, event.RequestTimestamp, event.StreamType, event.Sequence, event.Name, event.ID, event.DataShape, event.DataSize, event.Timestamp})
+	}
+
+	// Handle transaction rollback with back-off and retry if unsuccessful.
+	txOk := false
+	retryCount := 0
+	maxRetries := 4
+
+	for ; retryCount < maxRetries && !txOk; retryCount++ {
+		// Start the transaction
+		tx, txErr := logger.dbConnPool.Begin(ctx)
+		if txErr != nil {
+			log.WithError(txErr).Error("unable to start database transaction")
+			continue
+		}
+
+		// Create a temporary table to copy the data into, with a random name to prevent conflicts
+		tmpTableName := fmt.Sprintf("tmp_streams_%d_%d", time.Now().UnixNano(), rand.Intn(9999))
+		sqlQueryTmpTableCreate := fmt.Sprintf(`
+			CREATE TEMPORARY TABLE %s (
+				url_scheme    text                     not null,
+				url_host      text                     not null,
+				url_path      text                     not null,
+				req_method    text                     not null,
+				resp_code     integer                  not null,
+				req_timestamp timestamp with time zone not null,
+				stream_type   text                     not null,
+				sequence      integer                  not null,
+				event_name    text                     not null,
+				event_id      text                     not null,
+				data_shape    jsonb                    not null,
+				data_size     integer                  not null,
+				timestamp     timestamp with time zone not null
+			) ON COMMIT DROP;
+		`, tmpTableName)
+		if _, tmpTableCreateErr := tx.Exec(ctx, sqlQueryTmpTableCreate); tmpTableCreateErr != nil {
+			log.WithError(tmpTableCreateErr).Error("unable to create temporary database table")
+			if rollbackErr := rollbackAndBackoff(tx); rollbackErr != nil {
+				log.WithError(rollbackErr).Error("problem with transaction rollback and backoff")
+			}
+			continue
+		}
+
+		// Copy the data into the temporary table
+		copyCount, copyErr := tx.CopyFrom(
+			ctx,
+			pgx.Identifier{tmpTableName},
+			[]string{"url_scheme", "url_host", "url_path", "req_method", "resp_code", "req_timestamp", "stream_type", "sequence", "event_name", "event_id", "data_shape", "data_size", "timestamp"},
+			pgx.CopyFromRows(inputRows),
+		)
+		if copyErr != nil {
+			log.WithError(copyErr).Error("unable to copy data into temporary database table for stream events")
+			if rollbackErr := rollbackAndBackoff(tx); rollbackErr != nil {
+				log.WithError(rollbackErr).Error("problem with transaction rollback and backoff")
+			}
+			continue
+		}
+		if int(copyCount) != len(inputRows) {
+			log.Errorf("expected to copy %d rows, but only copied %d rows into temporary database table", len(inputRows), copyCount)
+			if rollbackErr := rollbackAndBackoff(tx); rollbackErr != nil {
+				log.WithError(rollbackErr).Error("problem with transaction rollback and backoff")
+			}
+			continue
+		}
+
+		// Copy the data from the temporary table into the permanent table
+		_, insertErr := tx.Exec(ctx, fmt.Sprintf(`
+			INSERT INTO data_logger_streams (url_scheme, url_host, url_path, req_method, resp_code, req_timestamp, stream_type, sequence, event_name, event_id, data_shape, data_size, timestamp)
+			SELECT url_scheme, url_host, url_path, req_method, resp_code, req_timestamp, stream_type, sequence, event_name, event_id, data_shape, data_size, timestamp
+			FROM %s
+			ON CONFLICT DO NOTHING;
+		`, tmpTableName))
+		if insertErr != nil {
+			log.WithError(insertErr).Error("unable to insert temporary table data into data_logger_streams database")
+			if rollbackErr := rollbackAndBackoff(tx); rollbackErr != nil {
+				log.WithError(rollbackErr).Error("problem with transaction rollback and backoff")
+			}
+			continue
+		}
+
+		// Commit the transaction
+		if commitErr := tx.Commit(ctx); commitErr != nil {
+			log.WithError(commitErr).Error("unable to commit transaction to database")
+			if rollbackErr := rollbackAndBackoff(tx); rollbackErr != nil {
+				log.WithError(rollbackErr).Error("problem with transaction rollback and backoff")
+			}
+			continue
+		}
+
+		txOk = true
+	}
+
+	if !txOk {
+		return fmt.Errorf("unable to save stream events to database after %d attempts", maxRetries)
+	}
+
+	return nil
+}
@@ -11,6 +11,7 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
 	"regexp"
 	"strconv"
@@ -26,111 +27,54 @@ import (
 
 	"github.com/TheHackerDev/cartograph/internal/analyzer"
 	"github.com/TheHackerDev/cartograph/internal/config"
+	"github.com/TheHackerDev/cartograph/internal/dns"
+	"github.com/TheHackerDev/cartograph/internal/jsAnalyzer"
 	"github.com/TheHackerDev/cartograph/internal/mapper"
 	"github.com/TheHackerDev/cartograph/internal/proxy/injector"
 	"github.com/TheHackerDev/cartograph/internal/proxy/logger"
 	"github.com/TheHackerDev/cartograph/internal/shared/datatypes"
 	internalHttp "github.com/TheHackerDev/cartograph/internal/shared/http"
+	"github.com/TheHackerDev/cartograph/internal/shared/metrics"
 )
 
+// tunnelCloseTimeout is the maximum time to wait on shutdown for tunnels to return after they are closed forcefully.
+const tunnelCloseTimeout = 5 * time.Second
+
 // NewProxy returns a new, properly instantiated Proxy object.
-func NewProxy(cfg *config.Config, pluginInjector *injector.Injector, pluginLogger *logger.Logger, pluginMapper *mapper.Mapper, pluginAnalyzer *analyzer.Analyzer, pluginAPIHunter *apiHunter.APIHunter) *Proxy {
+func NewProxy(cfg *config.Config, pluginInjector *injector.Injector, pluginLogger *logger.Logger, pluginMapper *mapper.Mapper, pluginAnalyzer *analyzer.Analyzer, pluginAPIHunter *apiHunter.APIHunter, pluginJSAnalyzer *jsAnalyzer.JSAnalyzer, pluginDNS *dns.DNS) *Proxy {
 	proxy := &Proxy{
-		pluginInjector:  pluginInjector,
-		pluginLogger:    pluginLogger,
-		pluginMapper:    pluginMapper,
-		pluginAnalyzer:  pluginAnalyzer,
-		pluginAPIHunter: pluginAPIHunter,
+		cfg:              cfg,
+		pluginInjector:   pluginInjector,
+		pluginLogger:     pluginLogger,
+		pluginMapper:     pluginMapper,
+		pluginAnalyzer:   pluginAnalyzer,
+		pluginAPIHunter:  pluginAPIHunter,
+		pluginJSAnalyzer: pluginJSAnalyzer,
+		pluginDNS:        pluginDNS,
+		tunnels:          make(map[net.Conn]bool),
+	}
+
+	// Create the forward proxy server
+	proxy.server = cfg.ProxyServer.NewHTTPServer(proxy.httpHandler())
+
+	// Initialize a custom HTTP client, which resolves remote hosts with the DNS plugin, which logs every resolution.
+	// If a SOCKS5 proxy is set, it resolves the hosts of remote servers itself instead; hosts with a DNS override are
+	// sent to it as the override's address.
+	transport, transportErr := internalHttp.NewUpstreamTransport(cfg.Socks5ProxyString, pluginDNS.DialContext, pluginDNS.ProxyDialContext)
+	if transportErr != nil {
+		log.WithError(transportErr).Error("unable to use SOCKS5 proxy")
 	}
 
-	// Initialize a custom HTTP client
+	// Streaming responses (e.g. Server-Sent Events) can stay open indefinitely, so there is no overall client
+	// timeout; forwardRequest bounds the response bodies that are not streams instead.
+	transport.ResponseHeaderTimeout = cfg.ProxyServer.UpstreamTimeout
 	proxy.httpClient = &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: true, // This will get us the most coverage possible of remote servers
-				MinVersion:         tls.VersionTLS10,
-				CipherSuites: []uint16{
-					// Support older server cipher suites
-					tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
-					tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
-					tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
-					tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
-					tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
-					tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
-					tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256,
-					tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256,
-					tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA,
-					tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
-					tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA,
-					tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
-					tls.TLS_RSA_WITH_AES_128_GCM_SHA256,
-					tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
-					tls.TLS_RSA_WITH_AES_128_CBC_SHA256,
-					tls.TLS_RSA_WITH_AES_128_CBC_SHA,
-					tls.TLS_RSA_WITH_AES_256_CBC_SHA,
-					tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA,
-				},
-			},
-			MaxIdleConns:        1024,             // Large number, but not unlimited
-			MaxIdleConnsPerHost: 100,              // default is 2, this leaves a lot of flexibility for the client
-			MaxConnsPerHost:     0,                // TODO: Consider lowering this value to prevent a single client from consuming all of the proxy's connections
-			IdleConnTimeout:     90 * time.Second, // Same as the default http client
-			// TLSHandshakeTimeout:   10 * time.Second,
-			// ExpectContinueTimeout: 10 * time.Second,
-		},
+		Transport: transport,
 		// Do not follow redirects, which will allow the client/browser to handle them.
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			return http.ErrUseLastResponse
 		},
 		Jar: nil,
-
-		// Safe and sane timeouts
-		Timeout: 2 * time.Minute,
-	}
-
-	// Parse the master config for SOCKS5 proxy data
-	socks5URL := cfg.Socks5ProxyString
-	if socks5URL != "" {
-		u, socks5ParseErr := url.Parse(socks5URL)
-		if socks5ParseErr != nil {
-			log.WithError(socks5ParseErr).Errorf("unable to parse SOCKS5 URL string into URL type")
-		} else {
-			// Set the proxy's http client transport to use the SOCKS5 proxy
-			proxy.httpClient.Transport = &http.Transport{
-				Proxy: http.ProxyURL(u),
-				TLSClientConfig: &tls.Config{
-					InsecureSkipVerify: true, // This will get us the most coverage possible of remote servers
-					MinVersion:         tls.VersionTLS10,
-					CipherSuites: []uint16{
-						// Support older server cipher suites
-						tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
-						tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
-						tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
-						tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
-						tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
-						tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
-						tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256,
-						tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256,
-						tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA,
-						tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
-						tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA,
-						tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
-						tls.TLS_RSA_WITH_AES_128_GCM_SHA256,
-						tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
-						tls.TLS_RSA_WITH_AES_128_CBC_SHA256,
-						tls.TLS_RSA_WITH_AES_128_CBC_SHA,
-						tls.TLS_RSA_WITH_AES_256_CBC_SHA,
-						tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA,
-					},
-				},
-				MaxIdleConns:        1024,             // Large number, but not unlimited
-				MaxIdleConnsPerHost: 100,              // default is 2, this leaves a lot of flexibility for the client
-				MaxConnsPerHost:     0,                // TODO: Consider lowering this value to prevent a single client from consuming all of the proxy's connections
-				IdleConnTimeout:     90 * time.Second, // Same as the default http client
-				// TLSHandshakeTimeout:   10 * time.Second,
-				// ExpectContinueTimeout: 10 * time.Second,
-			}
-		}
 	}
 
 	// Instantiate the certificate manager
@@ -140,6 +84,7 @@ func NewProxy(cfg *config.Config, pluginInjector *injector.Injector, pluginLogge
 		log.WithError(newCAMgrErr).Fatal("unable to instantiate certificate manager")
 		return nil
 	}
+	metrics.RegisterCertificateCache("proxy", proxy.certificateManager.CacheSize)
 
 	// Set up the TLS config for the TLS server, with dynamic certificate generation and permissive cipher suites,
 	// to support as many clients as possible.
@@ -213,6 +158,9 @@ func NewProxy(cfg *config.Config, pluginInjector *injector.Injector, pluginLogge
 // Run method.
 // A Proxy object should *always* be instantiated via the NewProxy function.
 type Proxy struct {
+	// cfg is the configuration object for the web proxy.
+	cfg *config.Config
+
 	// pluginInjector stores the injector plugin's instance, including configuration data.
 	pluginInjector *injector.Injector
 
@@ -228,6 +176,12 @@ type Proxy struct {
 	// pluginAPIHunter stores the APIHunter plugin's instance, including configuration data.
 	pluginAPIHunter *apiHunter.APIHunter
 
+	// pluginJSAnalyzer stores the JSAnalyzer plugin's instance, including configuration data.
+	pluginJSAnalyzer *jsAnalyzer.JSAnalyzer
+
+	// pluginDNS stores the DNS plugin's instance, which resolves the hosts of remote servers.
+	pluginDNS *dns.DNS
+
 	// httpClient is used by the proxy's HTTP handler to forward traffic to remote servers.
 	httpClient *http.Client
 
@@ -239,22 +193,129 @@ type Proxy struct {
 
 	// certificateManager stores the certificate manager used to generate certificates in the proxy.
 	certificateManager *internalHttp.CertificateManager
+
+	// server is the forward proxy server.
+	server *http.Server
+
+	// tunnelsMu protects tunnels and shuttingDown.
+	tunnelsMu sync.Mutex
+
+	// tunnels holds the client connections for all active CONNECT tunnels. Each value is true while a request is
+	// being handled on the tunnel, and false while the tunnel is idle.
+	tunnels map[net.Conn]bool
+
+	// tunnelsWg tracks the active CONNECT tunnels, so they can be drained on shutdown.
+	tunnelsWg sync.WaitGroup
+
+	// shuttingDown is true once Shutdown has been called.
+	shuttingDown bool
 }
 
 // Run starts the proxy.
 // Any errors returned should be considered fatal.
 func (proxy *Proxy) Run() error {
 	// Start the forward proxy server
-	proxyServer := &http.Server{
-		Addr:    ":8080", // Default; this can always be port mapped differently to the host with Docker at runtime
-		Handler: proxy.httpHandler(),
-
-		// Sane and safe timeouts
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 30 * time.Second, // Gives us time to send a request to the remote server and receive a response
-		IdleTimeout:  40 * time.Second,
+	if serveErr := proxy.server.ListenAndServe(); serveErr != nil && !errors.Is(serveErr, http.ErrServerClosed) {
+		return serveErr
 	}
-	return proxyServer.ListenAndServe()
+
+	return nil
+}
+
+// Shutdown gracefully shuts down the proxy. It stops accepting new connections, closes idle CONNECT tunnels, and
+// waits for in-flight requests to complete. If the given context expires first, all remaining tunnels are closed,
+// and the context's error is returned once they have returned (or after a short timeout).
+func (proxy *Proxy) Shutdown(ctx context.Context) error {
+	// Close idle tunnels by interrupting their pending reads. Busy tunnels will close once their current request
+	// is complete.
+	proxy.tunnelsMu.Lock()
+	proxy.shuttingDown = true
+	for conn, busy := range proxy.tunnels {
+		if !busy {
+			if deadlineErr := conn.SetReadDeadline(time.Now()); deadlineErr != nil {
+				log.WithError(deadlineErr).Debug("unable to set read deadline on idle tunnel")
+			}
+		}
+	}
+	proxy.tunnelsMu.Unlock()
+
+	// Stop accepting new connections, and wait for in-flight (non-hijacked) requests
+	shutdownErr := proxy.server.Shutdown(ctx)
+
+	// Wait for the tunnels to drain
+	drained := make(chan struct{})
+	go func() {
+		proxy.tunnelsWg.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		return shutdownErr
+	case <-ctx.Done():
+		// Forcefully close all remaining tunnels (e.g. websockets and event streams)
+		proxy.tunnelsMu.Lock()
+		for conn := range proxy.tunnels {
+			_ = conn.Close()
+		}
+		proxy.tunnelsMu.Unlock()
+
+		// Wait briefly for the closed tunnels to return, so they don't send data to the plugins after they are stopped
+		select {
+		case <-drained:
+		case <-time.After(tunnelCloseTimeout):
+			log.Warnf("tunnels did not close within %s of being closed on shutdown", tunnelCloseTimeout)
+		}
+		return ctx.Err()
+	}
+}
+
+// trackTunnel starts tracking the given CONNECT tunnel client connection, in an idle state.
+// It returns false if the proxy is shutting down, in which case the tunnel should be closed.
+func (proxy *Proxy) trackTunnel(conn net.Conn) bool {
+	proxy.tunnelsMu.Lock()
+	defer proxy.tunnelsMu.Unlock()
+
+	if proxy.shuttingDown {
+		return false
+	}
+	proxy.tunnels[conn] = false
+	proxy.tunnelsWg.Add(1)
+	metrics.ProxyActiveTunnels.Inc()
+
+	return true
+}
+
+// untrackTunnel stops tracking the given CONNECT tunnel client connection.
+func (proxy *Proxy) untrackTunnel(conn net.Conn) {
+	proxy.tunnelsMu.Lock()
+	defer proxy.tunnelsMu.Unlock()
+
+	delete(proxy.tunnels, conn)
+	proxy.tunnelsWg.Done()
+	metrics.ProxyActiveTunnels.Dec()
+}
+
+// setTunnelBusy marks the given CONNECT tunnel as busy (handling a request) or idle (waiting for a request).
+// It returns false if the tunnel is being marked idle while the proxy is shutting down, in which case the tunnel
+// should be closed.
+func (proxy *Proxy) setTunnelBusy(conn net.Conn, busy bool) bool {
+	proxy.tunnelsMu.Lock()
+	defer proxy.tunnelsMu.Unlock()
+
+	if proxy.shuttingDown && !busy {
+		return false
+	}
+	proxy.tunnels[conn] = busy
+
+	return true
+}
+
+// isShuttingDown returns true once Shutdown has been called.
+func (proxy *Proxy) isShuttingDown() bool {
+	proxy.tunnelsMu.Lock()
+	defer proxy.tunnelsMu.Unlock()
+
+	return proxy.shuttingDown
 }
 
 // httpHandler handles all forward proxy HTTP requests.
@@ -294,13 +355,29 @@ func (proxy *Proxy) httpHandler() http.HandlerFunc {
 		// Handle mapper data sent from the browser, via the mapper injection scripts.
 		// The request will be a POST request, with the "X-Cartograph" header set to "mapper-data".
 		// The request will contain a JSON object in the body that looks like the following:
-		// { source: "https://example.com", destination: "https://example.com" }
+		// { source: "https://example.com", edges: [{ url: "https://example.com/app.js", type: "script", element: "script", attribute: "src" }] }
 		if request.Method == http.MethodPost && request.Header.Get("X-Cartograph") == "mapper-data" {
 			// Handle the mapper data
 			proxy.handleMapperData(responseWriter, request)
 			return
 		}
 
+		// Handle requests for the instrumentation script, which could be at any path (based on the requesting web
+		// page), if instrumentation is enabled.
+		if strings.HasSuffix(request.URL.Path, proxy.pluginMapper.GetInstrumentScriptName()) && proxy.pluginMapper.InstrumentEnabled() {
+			proxy.serveInstrument(responseWriter, request)
+			return
+		}
+
+		// Handle the client-side API calls sent from the browser, via the instrumentation script.
+		// The request will be a POST request, with the "X-Cartograph" header set to "instrument-data".
+		// The request will contain a JSON object in the body that looks like the following:
+		// { page: "https://example.com/", events: [{ kind: "fetch", method: "POST", url: "https://api.example.com/v1/login", script: "https://example.com/app.js", detail: "", count: 1 }] }
+		if request.Method == http.MethodPost && request.Header.Get("X-Cartograph") == "instrument-data" {
+			proxy.handleInstrumentData(responseWriter, request)
+			return
+		}
+
 		// Handle websocket connections
 		if websocket.IsWebSocketUpgrade(request) {
 			// Change the protocol
@@ -330,6 +407,7 @@ func (proxy *Proxy) httpHandler() http.HandlerFunc {
 		referrerData := &datatypes.ReferrerData{
 			Destination: *request.URL,
 			Timestamp:   time.Now(),
+			Type:        datatypes.EdgeTypeForRequest(request.Header),
 		}
 		referer := request.Header.Get("Referer")
 		if referer == "" {
@@ -356,6 +434,12 @@ func (proxy *Proxy) httpHandler() http.HandlerFunc {
 			return
 		}
 
+		// Pass streaming responses through to the client as they arrive, instead of buffering them
+		if streamType, isStream := streamTypeForContentType(resp.Header.Get("Content-Type")); isStream {
+			proxy.handleStreamingResponse(responseWriter, resp, &reqResp, referrerData, streamType)
+			return
+		}
+
 		// Handle chunked transfer encoding on the response
 		if resp.TransferEncoding != nil && len(resp.TransferEncoding) > 0 && resp.TransferEncoding[0] == "chunked" {
 			// Remove the timeout for writing the response to the client, as chunked transfer encoding can take a long
@@ -390,24 +474,27 @@ func (proxy *Proxy) httpHandler() http.HandlerFunc {
 		// Send the response data to the logger
 		proxy.pluginLogger.LogHttpData(&reqResp)
 
-		// Send the referer data to the mapper
+		// Send the referer data to the mapper, along with any redirects in the response
 		proxy.pluginMapper.LogReferredData(referrerData)
+		proxy.pluginMapper.LogRedirects(resp, referrerData)
+
+		// Send JavaScript responses to the JavaScript analyzer
+		if jsAnalyzeErr := proxy.pluginJSAnalyzer.AnalyzeResponse(resp, referrerData); jsAnalyzeErr != nil {
+			log.WithError(jsAnalyzeErr).Error("unable to analyze JavaScript response")
+		}
+
+		// Collect the host names in the response's certificate and Content-Security-Policy as candidate hosts
+		proxy.pluginDNS.ObserveResponse(resp, referrerData)
 
 		// Send the request and response data to the analyzer
 		proxy.pluginAnalyzer.LogCorpusData(&reqResp)
 
 		// Inject js, if applicable
 		if strings.Contains(resp.Header.Get("Content-Type"), "text/html") {
-			// Mapper script injection
-			if mapperInjectErr := proxy.pluginMapper.InjectMapperScript(resp, referrerData); mapperInjectErr != nil {
-				log.WithError(mapperInjectErr).Error("unable to inject mapper script into response")
-				http.Error(responseWriter, "unable to manage response", http.StatusBadGateway)
-				return
-			}
-
-			// Injector script injection
-			if injectErr := proxy.pluginInjector.JsInResponseHead(resp, *referrerData); injectErr != nil {
-				log.WithError(injectErr).Error("unable to inject JavaScript into response")
+			// Mapper script, and injector script, style and header injection, decoding the body only once
+			mapperScript := proxy.pluginMapper.PrepareMapperScript(resp, referrerData)
+			if injectErr := proxy.pluginInjector.InjectResponse(resp, *referrerData, mapperScript); injectErr != nil {
+				log.WithError(injectErr).Error("unable to inject content into response")
 				http.Error(responseWriter, "unable to manage response", http.StatusBadGateway)
 				return
 			}
@@ -464,6 +551,13 @@ func (proxy *Proxy) httpsHandler(response http.ResponseWriter, request *http.Req
 		return
 	}
 
+	// Track the tunnel, so it can be drained on shutdown
+	if !proxy.trackTunnel(clientConn) {
+		_ = clientConn.Close()
+		return
+	}
+	defer proxy.untrackTunnel(clientConn)
+
 	// Ensure the client connection is closed when the function returns
 	defer func() {
 		if err := clientConn.Close(); err != nil {
@@ -554,9 +648,18 @@ func (proxy *Proxy) httpsHandler(response http.ResponseWriter, request *http.Req
 		// // Ensure that the client context is cancelled from the last request
 		// clientCancelFunc()
 
+		// Mark the tunnel as idle while waiting for the next request, closing it instead if we are shutting down
+		if !proxy.setTunnelBusy(clientConn, false) {
+			return
+		}
+
 		// Read from the client
 		tunnelReq, reqReadErr := http.ReadRequest(readClient)
 		if reqReadErr != nil {
+			if proxy.isShuttingDown() {
+				// The idle tunnel was closed for shutdown
+				return
+			}
 			if errors.Is(reqReadErr, io.EOF) {
 				// EOF usually happens when a client (usually a browser) just opens a connection and immediately closes
 				// it with EOF.
@@ -577,6 +680,9 @@ func (proxy *Proxy) httpsHandler(response http.ResponseWriter, request *http.Req
 			return
 		}
 
+		// Mark the tunnel as busy while the request is handled
+		proxy.setTunnelBusy(clientConn, true)
+
 		// TODO: Handle CONNECT requests, which are used to establish another HTTPS forward proxy connection
 		//  nested inside this one.
 
@@ -660,7 +766,7 @@ func (proxy *Proxy) httpsHandler(response http.ResponseWriter, request *http.Req
 		// Handle mapper data sent from the browser, via the mapper injection scripts.
 		// The request will be a POST request, with the "X-Cartograph" header set to "mapper-data".
 		// The request will contain a JSON object in the body that looks like the following:
-		// { source: "https://example.com", destination: "https://example.com" }
+		// { source: "https://example.com", edges: [{ url: "https://example.com/app.js", type: "script", element: "script", attribute: "src" }] }
 		if tunnelReq.Method == http.MethodPost && tunnelReq.Header.Get("X-Cartograph") == "mapper-data" {
 			// Parse the request body into a MapperBrowserData object
 			var browserData datatypes.MapperBrowserData
@@ -669,31 +775,84 @@ func (proxy *Proxy) httpsHandler(response http.ResponseWriter, request *http.Req
 				return
 			}
 
-			// Parse the source URL
-			sourceURL, sourceParseErr := url.Parse(browserData.Source)
-			if sourceParseErr != nil {
-				log.WithError(sourceParseErr).Error("unable to parse source URL from mapper data")
+			// Add the browser data to the mapper
+			if logErr := proxy.pluginMapper.LogBrowserData(&browserData); logErr != nil {
+				log.WithError(logErr).Error("unable to log mapper browser data")
 				return
 			}
 
-			// Add the browser data to the mapper
-			for _, destination := range browserData.Destinations {
-				// Parse the destination URL
-				destinationURL, destinationParseErr := url.Parse(destination)
-				if destinationParseErr != nil {
-					log.WithError(destinationParseErr).Error("unable to parse destination URL from mapper data")
-					continue
+			// return a 200 OK response and close the connection
+			tunnelResp := http.Response{
+				StatusCode: http.StatusNoContent,
+				Request:    tunnelReq,
+				Proto:      "HTTP/1.1",
+				ProtoMajor: 1,
+				ProtoMinor: 1,
+				Status:     "204 No Content",
+			}
+			if writeErr := tunnelResp.Write(tlsConn); writeErr != nil {
+				if errors.Is(writeErr, syscall.ECONNRESET) {
+					// connection reset by peer
+					return
+				}
+				log.WithError(writeErr).Error("unable to write mapper data response to client")
+				return
+			}
+
+			// Continue to the next request
+			continue
+		}
+
+		// Handle requests for the instrumentation script, which could be at any path (based on the requesting web
+		// page), if instrumentation is enabled.
+		if strings.HasSuffix(tunnelReq.URL.Path, proxy.pluginMapper.GetInstrumentScriptName()) && proxy.pluginMapper.InstrumentEnabled() {
+			// Prepare a response to serve to the client, with the instrument.js file contents
+			tunnelResp := http.Response{
+				StatusCode: 200,
+				Header: http.Header{
+					"Content-Type":        []string{"application/javascript"},
+					"Content-Disposition": []string{fmt.Sprintf("attachment; filename=%q", proxy.pluginMapper.GetInstrumentScriptName())},
+				},
+				Body:          io.NopCloser(bytes.NewReader(proxy.pluginMapper.InstrumentScript)),
+				Request:       tunnelReq,
+				Proto:         "HTTP/1.1",
+				ProtoMajor:    1,
+				ProtoMinor:    1,
+				ContentLength: int64(len(proxy.pluginMapper.InstrumentScript)),
+				Status:        "200 OK",
+			}
+
+			// Write the response to the client
+			if writeErr := tunnelResp.Write(tlsConn); writeErr != nil {
+				if errors.Is(writeErr, syscall.ECONNRESET) {
+					// connection reset by peer
+					return
 				}
+				log.WithError(writeErr).Error("unable to write instrumentation script to client")
+				return
+			}
+
+			// Continue to the next request
+			continue
+		}
 
-				// Add the data to the mapper
-				proxy.pluginMapper.LogReferredData(&datatypes.ReferrerData{
-					Referer:     *sourceURL,
-					Destination: *destinationURL,
-					Timestamp:   time.Now(),
-				})
+		// Handle the client-side API calls sent from the browser, via the instrumentation script.
+		// The request will be a POST request, with the "X-Cartograph" header set to "instrument-data".
+		if tunnelReq.Method == http.MethodPost && tunnelReq.Header.Get("X-Cartograph") == "instrument-data" {
+			// Parse the request body into an InstrumentBrowserData object
+			var instrumentData datatypes.InstrumentBrowserData
+			if parseErr := json.NewDecoder(tunnelReq.Body).Decode(&instrumentData); parseErr != nil {
+				log.WithError(parseErr).Error("unable to parse instrumentation data")
+				return
 			}
 
-			// return a 200 OK response and close the connection
+			// Add the instrumentation data to the mapper
+			if logErr := proxy.pluginMapper.LogInstrumentData(&instrumentData); logErr != nil {
+				log.WithError(logErr).Error("unable to log instrumentation data")
+				return
+			}
+
+			// Return a 204 No Content response
 			tunnelResp := http.Response{
 				StatusCode: http.StatusNoContent,
 				Request:    tunnelReq,
@@ -707,7 +866,7 @@ func (proxy *Proxy) httpsHandler(response http.ResponseWriter, request *http.Req
 					// connection reset by peer
 					return
 				}
-				log.WithError(writeErr).Error("unable to write mapper data response to client")
+				log.WithError(writeErr).Error("unable to write instrumentation data response to client")
 				return
 			}
 
@@ -745,6 +904,7 @@ func (proxy *Proxy) httpsHandler(response http.ResponseWriter, request *http.Req
 		referrerData := &datatypes.ReferrerData{
 			Destination: *tunnelReq.URL,
 			Timestamp:   time.Now(),
+			Type:        datatypes.EdgeTypeForRequest(tunnelReq.Header),
 		}
 		referer := tunnelReq.Header.Get("Referer")
 		if referer == "" {
@@ -784,6 +944,27 @@ func (proxy *Proxy) httpsHandler(response http.ResponseWriter, request *http.Req
 		// 	timeout in the client to a very high value, and then cancel the request if it takes too long (essentially
 		//  setting our own timeout manually with every request).
 
+		// Pass streaming responses through to the client as they arrive, instead of buffering them.
+		// Response.Write copies the body directly to the TLS connection, so each event is sent as soon as it is read.
+		if streamType, isStream := streamTypeForContentType(tunnelResp.Header.Get("Content-Type")); isStream {
+			proxy.logStreamingResponse(tunnelResp, &reqResp, referrerData)
+			tunnelResp.Body = newStreamCapture(tunnelResp.Body, streamType, &reqResp, *referrerData, proxy.pluginLogger.LogStreamEvent)
+
+			if respWriteErr := tunnelResp.Write(tlsConn); respWriteErr != nil {
+				if errors.Is(respWriteErr, syscall.EPIPE) || errors.Is(respWriteErr, syscall.ECONNRESET) {
+					return
+				}
+				log.WithError(respWriteErr).Errorf("unable to write streaming response data to client for target server %s", tlsConn.ConnectionState().ServerName)
+				return
+			}
+
+			// If the header sent from the client is set to close, close the connection
+			if tunnelReq.Close {
+				return
+			}
+			continue
+		}
+
 		// Check for chunked response data, which needs to be cached fully in memory before being sent to the client,
 		// so that we can perform injection and save body data as needed.
 		if tunnelResp.TransferEncoding != nil && len(tunnelResp.TransferEncoding) > 0 && tunnelResp.TransferEncoding[0] == "chunked" {
@@ -819,26 +1000,27 @@ func (proxy *Proxy) httpsHandler(response http.ResponseWriter, request *http.Req
 		// Save the request/response data
 		proxy.pluginLogger.LogHttpData(&reqResp)
 
-		// Save the mapper data
+		// Save the mapper data, along with any redirects in the response
 		proxy.pluginMapper.LogReferredData(referrerData)
+		proxy.pluginMapper.LogRedirects(tunnelResp, referrerData)
+
+		// Send JavaScript responses to the JavaScript analyzer
+		if jsAnalyzeErr := proxy.pluginJSAnalyzer.AnalyzeResponse(tunnelResp, referrerData); jsAnalyzeErr != nil {
+			log.WithError(jsAnalyzeErr).Error("unable to analyze JavaScript response")
+		}
+
+		// Collect the host names in the response's certificate and Content-Security-Policy as candidate hosts
+		proxy.pluginDNS.ObserveResponse(tunnelResp, referrerData)
 
 		// Save the request/response data to the analyzer
 		proxy.pluginAnalyzer.LogCorpusData(&reqResp)
 
 		// Inject js into the response, if applicable
 		if strings.Contains(tunnelResp.Header.Get("Content-Type"), "text/html") {
-			// Mapper script injection
-			if mapperInjectErr := proxy.pluginMapper.InjectMapperScript(tunnelResp, referrerData); mapperInjectErr != nil {
-				log.WithError(mapperInjectErr).Error("unable to inject mapper script into response")
-				if _, writeErr := tlsConn.Write([]byte("HTTP/1.1 502 Bad Gateway\r\n\r\n")); writeErr != nil {
-					log.WithError(writeErr).Error("unable to write closing response to client")
-				}
-				return
-			}
-
-			// Injector script injection
-			if injectErr := proxy.pluginInjector.JsInResponseHead(tunnelResp, *referrerData); injectErr != nil {
-				log.WithError(injectErr).Error("unable to inject JavaScript into response")
+			// Mapper script, and injector script, style and header injection, decoding the body only once
+			mapperScript := proxy.pluginMapper.PrepareMapperScript(tunnelResp, referrerData)
+			if injectErr := proxy.pluginInjector.InjectResponse(tunnelResp, *referrerData, mapperScript); injectErr != nil {
+				log.WithError(injectErr).Error("unable to inject content into response")
 				if _, writeErr := tlsConn.Write([]byte("HTTP/1.1 502 Bad Gateway\r\n\r\n")); writeErr != nil {
 					log.WithError(writeErr).Error("unable to write closing response to client")
 				}
@@ -897,6 +1079,63 @@ func (proxy *Proxy) handleChunkedResponse(resp *http.Response) (*http.Response,
 	return cachedResponse, nil
 }
 
+// handleStreamingResponse writes a streaming response (e.g. Server-Sent Events) back to the client incrementally,
+// logging each event as it passes through. The response body is closed when the stream ends.
+func (proxy *Proxy) handleStreamingResponse(responseWriter http.ResponseWriter, resp *http.Response, reqResp *datatypes.HttpReqResp, referrerData *datatypes.ReferrerData, streamType string) {
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			log.WithError(closeErr).Error("unable to close streaming response body")
+		}
+	}()
+
+	// Remove the timeout for writing the response to the client, as streams are expected to be long-lived
+	rc := http.NewResponseController(responseWriter)
+	if writeDeadlineErr := rc.SetWriteDeadline(time.Time{}); writeDeadlineErr != nil {
+		log.WithError(writeDeadlineErr).Error("unable to remove write deadline for streaming response")
+	}
+
+	proxy.logStreamingResponse(resp, reqResp, referrerData)
+
+	// Headers
+	for key, values := range resp.Header {
+		for _, value := range values {
+			responseWriter.Header().Add(key, value)
+		}
+	}
+	// Status code
+	responseWriter.WriteHeader(resp.StatusCode)
+
+	// Body, parsing and logging each event as it is sent to the client
+	capture := newStreamCapture(resp.Body, streamType, reqResp, *referrerData, proxy.pluginLogger.LogStreamEvent)
+	if writeErr := writeStreamingResponse(responseWriter, capture); writeErr != nil {
+		if errors.Is(writeErr, syscall.EPIPE) || errors.Is(writeErr, syscall.ECONNRESET) || errors.Is(writeErr, context.Canceled) {
+			// The client closed the stream
+			return
+		}
+		log.WithError(writeErr).Error("unable to write streaming response to the client")
+	}
+}
+
+// logStreamingResponse sends the request and response data for a streaming response to the plugins.
+// The response body is not read, as it is logged as individual events while it is streamed to the client.
+func (proxy *Proxy) logStreamingResponse(resp *http.Response, reqResp *datatypes.HttpReqResp, referrerData *datatypes.ReferrerData) {
+	// Save the response data
+	reqResp.Response = datatypes.HttpResponse{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header.Clone(),
+		Cookies:    resp.Cookies(),
+	}
+
+	// Send the response data to the logger
+	proxy.pluginLogger.LogHttpData(reqResp)
+
+	// Send the referer data to the mapper
+	proxy.pluginMapper.LogReferredData(referrerData)
+
+	// Send the request and response data to the analyzer
+	proxy.pluginAnalyzer.LogCorpusData(reqResp)
+}
+
 // isEOF returns true if the given reader's next byte is an EOF.
 func isEOF(r *bufio.Reader) bool {
 	_, peekErr := r.Peek(1)
@@ -965,6 +1204,14 @@ func (proxy *Proxy) wsProxy(response http.ResponseWriter, request *http.Request)
 				tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
 			},
 		},
+		NetDialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, dialErr := proxy.pluginDNS.DialContext(ctx, network, addr)
+			if dialErr != nil {
+				return nil, dialErr
+			}
+			proxy.pluginDNS.LogOverride(conn, request.Method, request.URL)
+			return conn, nil
+		},
 		HandshakeTimeout: 10 * time.Second,
 		ReadBufferSize:   1024,
 		WriteBufferSize:  1024,
@@ -1050,6 +1297,10 @@ func (proxy *Proxy) wsProxy(response http.ResponseWriter, request *http.Request)
 		}
 	}()
 
+	// Track the open websocket connection in the metrics
+	metrics.ProxyActiveWebsockets.Inc()
+	defer metrics.ProxyActiveWebsockets.Dec()
+
 	// Prepare communication channels for concurrently proxying websocket connections between the client and
 	// remote server
 	clientDone := make(chan bool)
@@ -1104,11 +1355,12 @@ func (proxy *Proxy) wsProxyTLS(clientConn *tls.Conn, request *http.Request) {
 	// TODO: Log TLS websocket request and response data; this won't be possible until we add more fine-grained reading and writing of websocket data (like in the HTTP websocket proxy function).
 
 	// Start a websocket connection with the remote server
-	serverConn, serverConnErr := net.Dial("tcp", serverAddr)
+	serverConn, serverConnErr := proxy.pluginDNS.DialContext(context.Background(), "tcp", serverAddr)
 	if serverConnErr != nil {
 		log.WithError(serverConnErr).Error("unable to connect to remote host for websocket connection")
 		return
 	}
+	proxy.pluginDNS.LogOverride(serverConn, request.Method, request.URL)
 
 	// Convert connection to TLS connection
 	serverConnTLS := tls.Client(serverConn, proxy.tlsClientConfig)
@@ -1139,6 +1391,10 @@ func (proxy *Proxy) wsProxyTLS(clientConn *tls.Conn, request *http.Request) {
 		return
 	}
 
+	// Track the open websocket connection in the metrics
+	metrics.ProxyActiveWebsockets.Inc()
+	defer metrics.ProxyActiveWebsockets.Dec()
+
 	// Proxy websocket data between client and server
 	var wg sync.WaitGroup
 	wg.Add(1)
@@ -1276,6 +1532,12 @@ func (proxy *Proxy) forwardRequest(request *http.Request) (*http.Response, error
 		}
 	}
 
+	// Check whether the request is for a target before the Referer header is removed, for the request metrics
+	target := "false"
+	if refererUrl, refererParseErr := url.Parse(request.Header.Get("Referer")); refererParseErr == nil && proxy.cfg.IsTarget(refererUrl.Host, request.URL.Host) {
+		target = "true"
+	}
+
 	// Drop the Referer header, to prevent disclosing sensitive information.
 	// We've forced this header on every response, to better tie response data to request sources.
 	// TODO: Do this only when the mapper plugin is enabled.
@@ -1351,11 +1613,47 @@ func (proxy *Proxy) forwardRequest(request *http.Request) (*http.Response, error
 	// }
 	// request = request.WithContext(httptrace.WithClientTrace(request.Context(), trace))
 
+	// Log the request if it's sent on a connection to the address of a DNS override, which may be a new connection or
+	// one reused from the pool
+	method, requestURL := request.Method, request.URL
+	request = request.WithContext(httptrace.WithClientTrace(request.Context(), &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			proxy.pluginDNS.LogOverride(info.Conn, method, requestURL)
+		},
+	}))
+
+	// Bound the whole exchange with the remote server by the upstream timeout, unless the response is a stream, which
+	// can stay open indefinitely. The request is cancelled once the response body is closed, or the timeout expires.
+	ctx, cancel := context.WithCancel(request.Context())
+	timeout := time.AfterFunc(proxy.cfg.ProxyServer.UpstreamTimeout, cancel)
+	if proxy.cfg.ProxyServer.UpstreamTimeout == 0 {
+		timeout.Stop()
+	}
+	request = request.WithContext(ctx)
+
 	// Send the request
+	start := time.Now()
 	response, requestErr := proxy.httpClient.Do(request)
+	metrics.ProxyUpstreamLatency.WithLabelValues(request.URL.Scheme).Observe(time.Since(start).Seconds())
 	if requestErr != nil {
+		timeout.Stop()
+		cancel()
+		metrics.ProxyRequests.WithLabelValues(request.URL.Scheme, "error", target).Inc()
 		return nil, fmt.Errorf("unable to forward request: %w", requestErr)
 	}
+	metrics.ProxyRequests.WithLabelValues(request.URL.Scheme, strconv.Itoa(response.StatusCode), target).Inc()
+	if _, isStream := streamTypeForContentType(response.Header.Get("Content-Type")); isStream {
+		timeout.Stop()
+	}
+	response.Body = &cancelBody{ReadCloser: response.Body, cancel: func() {
+		timeout.Stop()
+		cancel()
+	}}
+
+	// Record the organisation that owns the remote server, for grouping hosts in the mapper
+	if response.TLS != nil {
+		proxy.pluginMapper.ObserveCertificate(request.URL.Host, response.TLS)
+	}
 
 	// Force referrer data on all requests originating from this page
 	// TODO: Only do this when the mapper plugin is enabled.
@@ -1415,28 +1713,43 @@ func (proxy *Proxy) handleMapperData(response http.ResponseWriter, request *http
 		return
 	}
 
-	// Parse the URLs
-	sourceURL, sourceURLErr := url.Parse(data.Source)
-	if sourceURLErr != nil {
-		log.WithError(sourceURLErr).Errorf("unable to parse source URL")
+	// Add the browser data to the mapper
+	if logErr := proxy.pluginMapper.LogBrowserData(&data); logErr != nil {
+		log.WithError(logErr).Errorf("unable to log mapper browser data")
 		http.Error(response, "unable to parse source URL data", http.StatusInternalServerError)
 		return
 	}
-	// Add the browser data to the mapper
-	for _, destination := range data.Destinations {
-		// Parse the destination URL
-		destinationURL, destinationParseErr := url.Parse(destination)
-		if destinationParseErr != nil {
-			log.WithError(destinationParseErr).Error("unable to parse destination URL from mapper data")
-			continue
-		}
 
-		// Add the data to the mapper
-		proxy.pluginMapper.LogReferredData(&datatypes.ReferrerData{
-			Referer:     *sourceURL,
-			Destination: *destinationURL,
-			Timestamp:   time.Now(),
-		})
+	// Return a 204 response
+	response.WriteHeader(http.StatusNoContent)
+}
+
+// serveInstrument serves the instrument.js file to the client.
+func (proxy *Proxy) serveInstrument(response http.ResponseWriter, request *http.Request) {
+	response.Header().Set("Content-Type", "application/javascript")
+	response.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", proxy.pluginMapper.GetInstrumentScriptName()))
+	response.Header().Set("Content-Length", strconv.Itoa(len(proxy.pluginMapper.InstrumentScript)))
+	response.WriteHeader(http.StatusOK)
+	if _, writeErr := response.Write(proxy.pluginMapper.InstrumentScript); writeErr != nil {
+		log.WithError(writeErr).Errorf("unable to write instrument.js to response")
+	}
+}
+
+// handleInstrumentData handles the client-side API calls sent from the instrument.js file.
+func (proxy *Proxy) handleInstrumentData(response http.ResponseWriter, request *http.Request) {
+	// Unmarshal the request body
+	var data datatypes.InstrumentBrowserData
+	if decodeErr := json.NewDecoder(request.Body).Decode(&data); decodeErr != nil {
+		log.WithError(decodeErr).Errorf("unable to unmarshal instrumentation data")
+		http.Error(response, "unable to unmarshal request body", http.StatusBadRequest)
+		return
+	}
+
+	// Add the instrumentation data to the mapper
+	if logErr := proxy.pluginMapper.LogInstrumentData(&data); logErr != nil {
+		log.WithError(logErr).Errorf("unable to log instrumentation data")
+		http.Error(response, "unable to parse page URL data", http.StatusInternalServerError)
+		return
 	}
 
 	// Return a 204 response
@@ -0,0 +1,44 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/TheHackerDev/cartograph/internal/config"
+)
+
+func TestForwardRequestUpstreamTimeout(t *testing.T) {
+	const upstreamTimeout = 100 * time.Millisecond
+
+	// Each response sends its first line, then the rest after the upstream timeout
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", r.URL.Query().Get("type"))
+		_, _ = fmt.Fprint(w, "data: 1\n\n")
+		w.(http.Flusher).Flush()
+		time.Sleep(2 * upstreamTimeout)
+		_, _ = fmt.Fprint(w, "data: 2\n\n")
+	}))
+	defer server.Close()
+
+	proxy := &Proxy{
+		cfg:        &config.Config{ProxyServer: config.ServerConfig{UpstreamTimeout: upstreamTimeout}},
+		httpClient: &http.Client{Transport: &http.Transport{ResponseHeaderTimeout: upstreamTimeout}},
+	}
+
+	// Streams are chosen by the response Content-Type, without an Accept header on the request, and are not cut off
+	for contentType, wantErr := range map[string]bool{"text/event-stream": false, "text/plain": true} {
+		response, forwardErr := proxy.forwardRequest(httptest.NewRequest(http.MethodGet, server.URL+"/?type="+contentType, nil))
+		if forwardErr != nil {
+			t.Fatalf("%s: forwardRequest() error = %v", contentType, forwardErr)
+		}
+		body, readErr := io.ReadAll(response.Body)
+		_ = response.Body.Close()
+		if gotErr := readErr != nil; gotErr != wantErr {
+			t.Errorf("%s: reading body returned %q, %v; want error %v", contentType, body, readErr, wantErr)
+		}
+	}
+}
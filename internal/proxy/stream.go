@@ -0,0 +1,319 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/TheHackerDev/cartograph/internal/shared/datatypes"
+)
+
+const (
+	// maxStreamEventsLogged is the maximum number of events logged for a single stream. Events after this are still
+	// passed through to the client, but are not logged.
+	maxStreamEventsLogged int = 1000
+
+	// maxStreamLineSize is the maximum size of a single line held in memory while parsing a stream. Longer lines are
+	// still passed through to the client, but their events are not logged.
+	maxStreamLineSize int = 1 << 20
+
+	// maxDataShapeDepth is the maximum nesting depth described by an event data shape.
+	maxDataShapeDepth int = 10
+)
+
+// streamContentTypes maps the media types of streaming responses to their stream type.
+var streamContentTypes = map[string]string{
+	"text/event-stream":       datatypes.StreamTypeSSE,
+	"application/x-ndjson":    datatypes.StreamTypeNDJSON,
+	"application/ndjson":      datatypes.StreamTypeNDJSON,
+	"application/jsonl":       datatypes.StreamTypeNDJSON,
+	"application/x-jsonlines": datatypes.StreamTypeNDJSON,
+	"application/stream+json": datatypes.StreamTypeNDJSON,
+}
+
+// streamTypeForContentType returns the stream type for the given Content-Type header value.
+// The second return value is false if the content type is not a streaming type.
+func streamTypeForContentType(contentType string) (string, bool) {
+	mediaType, _, parseErr := mime.ParseMediaType(contentType)
+	if parseErr != nil {
+		return "", false
+	}
+	streamType, ok := streamContentTypes[strings.ToLower(mediaType)]
+
+	return streamType, ok
+}
+
+// cancelBody wraps a response body, cancelling the request it was received for once it is closed.
+type cancelBody struct {
+	io.ReadCloser
+
+	// cancel cancels the request.
+	cancel context.CancelFunc
+}
+
+// Close closes the response body and cancels the request.
+func (b *cancelBody) Close() error {
+	closeErr := b.ReadCloser.Close()
+	b.cancel()
+
+	return closeErr
+}
+
+// streamCapture wraps a streaming response body, parsing each event as it is read and passed through to the client.
+// It should be created via the newStreamCapture function.
+type streamCapture struct {
+	// body is the original response body.
+	body io.ReadCloser
+
+	// event holds the request data used to link each event to its originating request.
+	event datatypes.StreamEvent
+
+	// logEvent is called with each parsed event.
+	logEvent func(*datatypes.StreamEvent)
+
+	// line holds the current, incomplete line.
+	line []byte
+
+	// lineTooLong is true if the current line has exceeded maxStreamLineSize, and should be discarded.
+	lineTooLong bool
+
+	// lastCR is true if the last line ended with a carriage return, so that a line feed read next completes the same
+	// line terminator.
+	lastCR bool
+
+	// SSE parser state: the current event name and data lines, and the last event ID.
+	sseName    string
+	sseData    []string
+	sseHasData bool
+	sseLastID  string
+}
+
+// newStreamCapture returns a new streamCapture wrapping the given response body, which calls logEvent with each
+// event parsed from the stream.
+func newStreamCapture(body io.ReadCloser, streamType string, reqResp *datatypes.HttpReqResp, referer datatypes.ReferrerData, logEvent func(*datatypes.StreamEvent)) *streamCapture {
+	return &streamCapture{
+		body: body,
+		event: datatypes.StreamEvent{
+			Method:           reqResp.Request.Method,
+			Url:              reqResp.Request.Url,
+			StatusCode:       reqResp.Response.StatusCode,
+			RequestTimestamp: reqResp.Request.Timestamp,
+			Referer:          referer.Referer,
+			StreamType:       streamType,
+		},
+		logEvent: logEvent,
+	}
+}
+
+// Read conforms to the io.Reader interface, parsing any events in the data read from the original body.
+func (s *streamCapture) Read(p []byte) (int, error) {
+	n, readErr := s.body.Read(p)
+	s.parse(p[:n])
+
+	// Handle a final NDJSON line without a trailing newline
+	if errors.Is(readErr, io.EOF) && s.event.StreamType == datatypes.StreamTypeNDJSON && len(s.line) > 0 {
+		s.handleLine(s.line)
+		s.line = s.line[:0]
+	}
+
+	return n, readErr
+}
+
+// Close conforms to the io.Closer interface, closing the original body.
+func (s *streamCapture) Close() error {
+	return s.body.Close()
+}
+
+// parse splits the given data into lines, handling each complete line. SSE lines may end with a carriage return,
+// a line feed, or both, as defined in the specification; NDJSON lines end with a line feed.
+func (s *streamCapture) parse(data []byte) {
+	terminators := "\n"
+	if s.event.StreamType == datatypes.StreamTypeSSE {
+		terminators = "\r\n"
+	}
+
+	for len(data) > 0 {
+		// Skip the line feed of a CRLF line terminator split across reads
+		if s.lastCR {
+			s.lastCR = false
+			if data[0] == '\n' {
+				data = data[1:]
+				continue
+			}
+		}
+
+		i := bytes.IndexAny(data, terminators)
+		if i == -1 {
+			// Hold on to the incomplete line, unless it is too long to keep in memory
+			if len(s.line)+len(data) > maxStreamLineSize {
+				s.line = s.line[:0]
+				s.lineTooLong = true
+				return
+			}
+			s.line = append(s.line, data...)
+			return
+		}
+
+		if !s.lineTooLong && len(s.line)+i <= maxStreamLineSize {
+			s.line = append(s.line, data[:i]...)
+			s.handleLine(bytes.TrimSuffix(s.line, []byte("\r")))
+		}
+		s.line = s.line[:0]
+		s.lineTooLong = false
+		if data[i] == '\r' {
+			if i+1 == len(data) {
+				s.lastCR = true
+			} else if data[i+1] == '\n' {
+				i++
+			}
+		}
+		data = data[i+1:]
+	}
+}
+
+// handleLine handles a single, complete line from the stream.
+func (s *streamCapture) handleLine(line []byte) {
+	if s.event.StreamType == datatypes.StreamTypeNDJSON {
+		if len(bytes.TrimSpace(line)) == 0 {
+			return
+		}
+		s.dispatch("", "", string(line))
+		return
+	}
+
+	// An empty line dispatches the current SSE event
+	if len(line) == 0 {
+		if s.sseHasData {
+			s.dispatch(s.sseName, s.sseLastID, strings.Join(s.sseData, "\n"))
+		}
+		s.sseName = ""
+		s.sseData = s.sseData[:0]
+		s.sseHasData = false
+		return
+	}
+
+	// Ignore comments
+	if line[0] == ':' {
+		return
+	}
+
+	// Split the field name and value, removing a single leading space from the value
+	field, value, _ := strings.Cut(string(line), ":")
+	value = strings.TrimPrefix(value, " ")
+	switch field {
+	case "event":
+		s.sseName = value
+	case "data":
+		s.sseData = append(s.sseData, value)
+		s.sseHasData = true
+	case "id":
+		// IDs containing NULL characters are ignored, as defined in the specification
+		if !strings.ContainsRune(value, 0) {
+			s.sseLastID = value
+		}
+	}
+}
+
+// dispatch sends a single parsed event to the logger.
+func (s *streamCapture) dispatch(name string, id string, data string) {
+	sequence := s.event.Sequence
+	s.event.Sequence++
+	if sequence >= maxStreamEventsLogged {
+		return
+	}
+
+	// Events without a name are "message" events, as defined in the SSE specification
+	if s.event.StreamType == datatypes.StreamTypeSSE && name == "" {
+		name = "message"
+	}
+
+	event := s.event
+	event.Sequence = sequence
+	event.Name = name
+	event.ID = id
+	event.DataShape = dataShape(data)
+	event.DataSize = len(data)
+	event.Timestamp = time.Now()
+
+	s.logEvent(&event)
+}
+
+// dataShape returns a JSON description of the structure of the given event data, without any of its values.
+// Objects are described by their keys and the shapes of their values, arrays by the shape of their first element,
+// and all other values by their JSON type. Data that is not valid JSON is described as "text".
+func dataShape(data string) json.RawMessage {
+	decoder := json.NewDecoder(strings.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if decodeErr := decoder.Decode(&value); decodeErr != nil || decoder.More() {
+		return json.RawMessage(`"text"`)
+	}
+
+	shape, marshalErr := json.Marshal(shapeOf(value, 0))
+	if marshalErr != nil {
+		return json.RawMessage(`"text"`)
+	}
+
+	return shape
+}
+
+// shapeOf returns the shape of the given decoded JSON value.
+func shapeOf(value interface{}, depth int) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if depth >= maxDataShapeDepth {
+			return "object"
+		}
+		shape := make(map[string]interface{}, len(v))
+		for key, val := range v {
+			shape[key] = shapeOf(val, depth+1)
+		}
+		return shape
+	case []interface{}:
+		if depth >= maxDataShapeDepth {
+			return "array"
+		}
+		if len(v) == 0 {
+			return []interface{}{}
+		}
+		return []interface{}{shapeOf(v[0], depth+1)}
+	case string:
+		return "string"
+	case json.Number:
+		return "number"
+	case bool:
+		return "boolean"
+	default:
+		return "null"
+	}
+}
+
+// writeStreamingResponse writes the given streaming response to the client, flushing each read from the remote
+// server immediately so that events are delivered as they arrive.
+func writeStreamingResponse(responseWriter http.ResponseWriter, body io.Reader) error {
+	rc := http.NewResponseController(responseWriter)
+	buf := make([]byte, 32*1024)
+	for {
+		n, readErr := body.Read(buf)
+		if n > 0 {
+			if _, writeErr := responseWriter.Write(buf[:n]); writeErr != nil {
+				return writeErr
+			}
+			if flushErr := rc.Flush(); flushErr != nil {
+				return flushErr
+			}
+		}
+		if readErr != nil {
+			if errors.Is(readErr, io.EOF) {
+				return nil
+			}
+			return readErr
+		}
+	}
+}
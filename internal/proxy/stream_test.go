@@ -0,0 +1,118 @@
+package proxy
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/TheHackerDev/cartograph/internal/shared/datatypes"
+)
+
+// chunkReader returns each of its chunks from a separate call to Read.
+type chunkReader struct {
+	chunks []string
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	if len(c.chunks) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, c.chunks[0])
+	if c.chunks[0] = c.chunks[0][n:]; c.chunks[0] == "" {
+		c.chunks = c.chunks[1:]
+	}
+
+	return n, nil
+}
+
+func TestStreamCaptureParse(t *testing.T) {
+	// parsedEvent holds the fields of a logged event that are checked.
+	type parsedEvent struct {
+		Name  string
+		ID    string
+		Size  int
+		Shape string
+	}
+
+	longLine := "data: " + strings.Repeat("x", maxStreamLineSize)
+	tests := []struct {
+		name       string
+		streamType string
+		chunks     []string
+		want       []parsedEvent
+	}{
+		{
+			name:       "event split across reads",
+			streamType: datatypes.StreamTypeSSE,
+			chunks:     []string{"event: up", "date\ndata: {\"a\"", ":1}\n", "\n"},
+			want:       []parsedEvent{{Name: "update", Size: 7, Shape: `{"a":"number"}`}},
+		},
+		{
+			name:       "CRLF line endings",
+			streamType: datatypes.StreamTypeSSE,
+			chunks:     []string{"id: 1\r\ndata: x\r", "\n\r\ndata: y\r\n\r\n"},
+			want:       []parsedEvent{{Name: "message", ID: "1", Size: 1, Shape: `"text"`}, {Name: "message", ID: "1", Size: 1, Shape: `"text"`}},
+		},
+		{
+			name:       "bare CR line endings",
+			streamType: datatypes.StreamTypeSSE,
+			chunks:     []string{"event: a\rdata: 1\r\r", "data: 2\r", "\r"},
+			want:       []parsedEvent{{Name: "a", Size: 1, Shape: `"number"`}, {Name: "message", Size: 1, Shape: `"number"`}},
+		},
+		{
+			name:       "multi-line data",
+			streamType: datatypes.StreamTypeSSE,
+			chunks:     []string{": comment\ndata: a\ndata:b\n\n"},
+			want:       []parsedEvent{{Name: "message", Size: 3, Shape: `"text"`}},
+		},
+		{
+			name:       "id containing NUL",
+			streamType: datatypes.StreamTypeSSE,
+			chunks:     []string{"id: 1\ndata: x\n\nid: 2\x003\ndata: y\n\n"},
+			want:       []parsedEvent{{Name: "message", ID: "1", Size: 1, Shape: `"text"`}, {Name: "message", ID: "1", Size: 1, Shape: `"text"`}},
+		},
+		{
+			name:       "line overflow across reads",
+			streamType: datatypes.StreamTypeSSE,
+			chunks:     []string{longLine[:maxStreamLineSize/2], longLine[maxStreamLineSize/2:], "\n\ndata: ok\n\n"},
+			want:       []parsedEvent{{Name: "message", Size: 2, Shape: `"text"`}},
+		},
+		{
+			name:       "line overflow within a read",
+			streamType: datatypes.StreamTypeSSE,
+			chunks:     []string{"data: a\n" + longLine + "\n\ndata: ok\n\n"},
+			want:       []parsedEvent{{Name: "message", Size: 1, Shape: `"text"`}, {Name: "message", Size: 2, Shape: `"text"`}},
+		},
+		{
+			name:       "NDJSON final line without a newline",
+			streamType: datatypes.StreamTypeNDJSON,
+			chunks:     []string{"{\"a\":1}\r\n\n{\"b\":", "[true]}"},
+			want:       []parsedEvent{{Size: 7, Shape: `{"a":"number"}`}, {Size: 12, Shape: `{"b":["boolean"]}`}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := make([]parsedEvent, 0)
+			capture := newStreamCapture(io.NopCloser(&chunkReader{chunks: test.chunks}), test.streamType, &datatypes.HttpReqResp{}, datatypes.ReferrerData{}, func(event *datatypes.StreamEvent) {
+				got = append(got, parsedEvent{Name: event.Name, ID: event.ID, Size: event.DataSize, Shape: string(event.DataShape)})
+			})
+
+			buf := make([]byte, 2*maxStreamLineSize)
+			for {
+				_, readErr := capture.Read(buf)
+				if errors.Is(readErr, io.EOF) {
+					break
+				} else if readErr != nil {
+					t.Fatalf("Read() error = %v", readErr)
+				}
+			}
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("parsed events = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
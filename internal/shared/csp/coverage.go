@@ -0,0 +1,99 @@
+package csp
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Coverage is the injection status of a single page, for a single plugin.
+type Coverage struct {
+	Scheme     string    `json:"scheme"`
+	Host       string    `json:"host"`
+	Path       string    `json:"path"`
+	Plugin     string    `json:"plugin"`
+	Status     string    `json:"status"`
+	Directives []string  `json:"directives"`
+	Policy     string    `json:"policy"`
+	FirstSeen  time.Time `json:"firstSeen"`
+	LastSeen   time.Time `json:"lastSeen"`
+}
+
+// coverageKey identifies a page's coverage for a single plugin. Query strings are ignored, so that each page is only
+// recorded once.
+type coverageKey struct {
+	scheme, host, path, plugin string
+}
+
+// Recorder holds the injection status of pages until they are saved to the database. It is safe for concurrent use.
+type Recorder struct {
+	mu      sync.Mutex
+	plugin  string
+	pending map[coverageKey]*Coverage
+}
+
+// NewRecorder returns a new Recorder for the given plugin name.
+func NewRecorder(plugin string) *Recorder {
+	return &Recorder{
+		plugin:  plugin,
+		pending: make(map[coverageKey]*Coverage),
+	}
+}
+
+// Record records the injection status of the given page.
+func (r *Recorder) Record(pageURL url.URL, page *Page) {
+	status, directives := page.Status()
+	key := coverageKey{scheme: pageURL.Scheme, host: pageURL.Host, path: pageURL.Path, plugin: r.plugin}
+	now := time.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing, ok := r.pending[key]; ok {
+		existing.Status, existing.Directives, existing.Policy, existing.LastSeen = status, directives, page.Policy(), now
+		return
+	}
+	r.pending[key] = &Coverage{
+		Scheme:     pageURL.Scheme,
+		Host:       pageURL.Host,
+		Path:       pageURL.Path,
+		Plugin:     r.plugin,
+		Status:     status,
+		Directives: directives,
+		Policy:     page.Policy(),
+		FirstSeen:  now,
+		LastSeen:   now,
+	}
+}
+
+// Save saves the injection status of all pages recorded since the last save to the database, in a single batch.
+// The status of each page is replaced with the latest one recorded.
+func (r *Recorder) Save(ctx context.Context, dbConnPool *pgxpool.Pool) error {
+	r.mu.Lock()
+	pending := r.pending
+	r.pending = make(map[coverageKey]*Coverage)
+	r.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	batch := &pgx.Batch{}
+	for _, c := range pending {
+		directives := c.Directives
+		if directives == nil {
+			directives = []string{}
+		}
+		batch.Queue(`INSERT INTO data_injection_coverage (url_scheme, url_host, url_path, plugin, status, directives, policy, first_seen, last_seen) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) ON CONFLICT ON CONSTRAINT data_injection_coverage_pk DO UPDATE SET status = excluded.status, directives = excluded.directives, policy = excluded.policy, last_seen = excluded.last_seen;`,
+			c.Scheme, c.Host, c.Path, c.Plugin, c.Status, directives, c.Policy, c.FirstSeen, c.LastSeen)
+	}
+	if batchErr := dbConnPool.SendBatch(ctx, batch).Close(); batchErr != nil {
+		return fmt.Errorf("unable to save injection coverage for %d pages to database: %w", len(pending), batchErr)
+	}
+
+	return nil
+}
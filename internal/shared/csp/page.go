@@ -0,0 +1,325 @@
+package csp
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"html"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Injection statuses recorded for each page.
+const (
+	// StatusInjected means the injected content is allowed by the page's policy as it was served.
+	StatusInjected = "injected"
+
+	// StatusModified means the page's policy was rewritten to allow the injected content.
+	StatusModified = "csp_modified"
+
+	// StatusBlocked means the page's policy blocks the injected content, and rewriting it was disabled.
+	StatusBlocked = "blocked"
+)
+
+// Directive fallback lists, in the order browsers check them for each kind of request.
+var (
+	scriptFallbacks  = []string{"script-src-elem", "script-src", "default-src"}
+	styleFallbacks   = []string{"style-src-elem", "style-src", "default-src"}
+	workerFallbacks  = []string{"worker-src", "child-src", "script-src", "default-src"}
+	connectFallbacks = []string{"connect-src", "default-src"}
+)
+
+// metaRegex matches <meta> tags that set an enforced policy, capturing the quoted content attribute value.
+var metaRegex = regexp.MustCompile(`(?is)<meta\s[^>]*http-equiv\s*=\s*["']?content-security-policy["'\s>][^>]*>`)
+
+// metaContentRegex matches the content attribute in a <meta> tag, capturing its value without the quotes.
+var metaContentRegex = regexp.MustCompile(`(?is)\scontent\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+
+// metaPolicy is a policy set in a <meta> tag, and the position of its content attribute value in the page body.
+type metaPolicy struct {
+	policy     *Policy
+	start, end int
+}
+
+// Page plans the changes needed to a single page's policies for injected content to be allowed.
+//
+// Create one with NewPage, call the Allow methods for each piece of content to be injected, then call Apply to
+// write any rewritten policies back to the response.
+type Page struct {
+	url     *url.URL
+	rewrite bool
+	headers []*Policy
+	metas   []metaPolicy
+	body    []byte
+
+	// The nonces added to injected script and style tags, reused from the page's policy where possible
+	scriptNonce string
+	styleNonce  string
+
+	modified map[string]bool
+	blocked  map[string]bool
+}
+
+// NewPage returns a new Page for the response to the given page URL, parsing the enforced policies from its headers
+// and any <meta> tags in its decoded body. If rewrite is false, the policies are never changed, and content they
+// block is only reported.
+func NewPage(pageURL *url.URL, header http.Header, body []byte, rewrite bool) *Page {
+	page := &Page{
+		url:      pageURL,
+		rewrite:  rewrite,
+		headers:  ParsePolicies(header.Values("Content-Security-Policy")),
+		body:     body,
+		modified: make(map[string]bool),
+		blocked:  make(map[string]bool),
+	}
+
+	for _, tag := range metaRegex.FindAllIndex(body, -1) {
+		content := metaContentRegex.FindSubmatchIndex(body[tag[0]:tag[1]])
+		if content == nil {
+			continue
+		}
+		start, end := content[2], content[3]
+		if start < 0 {
+			start, end = content[4], content[5]
+		}
+		page.metas = append(page.metas, metaPolicy{
+			policy: ParsePolicy(html.UnescapeString(string(body[tag[0]+start : tag[0]+end]))),
+			start:  tag[0] + start,
+			end:    tag[0] + end,
+		})
+	}
+
+	page.scriptNonce = page.findNonce(scriptFallbacks)
+	page.styleNonce = page.findNonce(styleFallbacks)
+
+	return page
+}
+
+// policies returns all of the page's enforced policies.
+func (page *Page) policies() []*Policy {
+	policies := append([]*Policy(nil), page.headers...)
+	for _, meta := range page.metas {
+		policies = append(policies, meta.policy)
+	}
+
+	return policies
+}
+
+// findNonce returns the first nonce in the effective directive of any of the page's policies, for the given
+// fallback list, or an empty string if there are none.
+func (page *Page) findNonce(fallbacks []string) string {
+	for _, policy := range page.policies() {
+		if directive := policy.effective(fallbacks); directive != nil {
+			if nonce := directive.nonce(); nonce != "" {
+				return nonce
+			}
+		}
+	}
+
+	return ""
+}
+
+// AllowScript ensures that an injected script is allowed, either inline with the given content, or loaded from the
+// given src URL. It returns any attributes to add to the script tag, starting with a space.
+func (page *Page) AllowScript(src string, inline string) string {
+	return page.allowElement(scriptFallbacks, &page.scriptNonce, src, inline)
+}
+
+// AllowStyle ensures that an injected stylesheet is allowed, either inline with the given content, or loaded from
+// the given href URL. It returns any attributes to add to the style or link tag, starting with a space.
+func (page *Page) AllowStyle(href string, inline string) string {
+	return page.allowElement(styleFallbacks, &page.styleNonce, href, inline)
+}
+
+// allowElement ensures that an injected script or style element is allowed by each of the page's policies, using
+// the given directive fallback list and nonce. It returns the nonce attribute to add to the element, if any.
+func (page *Page) allowElement(fallbacks []string, nonce *string, src string, inline string) string {
+	var target *url.URL
+	if src != "" {
+		parsed, parseErr := page.url.Parse(src)
+		if parseErr != nil {
+			return ""
+		}
+		target = parsed
+	}
+
+	for _, policy := range page.policies() {
+		directive := policy.effective(fallbacks)
+		if directive == nil {
+			continue
+		}
+
+		// Check whether the element is already allowed
+		if *nonce != "" && directive.has("'nonce-"+*nonce+"'") {
+			continue
+		}
+		hash := "'sha256-" + hashOf(inline) + "'"
+		if target == nil && (directive.allowsInline() || directive.has(hash)) {
+			continue
+		}
+		if target != nil && !directive.strictDynamic() && directive.allowsURL(target, page.url) {
+			continue
+		}
+
+		if !page.rewrite {
+			page.blocked[directive.Name] = true
+			continue
+		}
+
+		// Allow the element with the least change to the policy: a hash for inline content, a nonce where host
+		// sources are ignored or nonces are already used, and otherwise the source's origin
+		writable := policy.writable(fallbacks)
+		page.modified[writable.Name] = true
+		switch {
+		case target == nil:
+			writable.add(hash)
+		case directive.strictDynamic() || directive.nonce() != "":
+			if *nonce == "" {
+				*nonce = newNonce()
+			}
+			writable.add("'nonce-" + *nonce + "'")
+		default:
+			writable.add(origin(target, page.url))
+		}
+	}
+
+	if *nonce == "" {
+		return ""
+	}
+
+	return ` nonce="` + *nonce + `"`
+}
+
+// AllowWorker ensures that the page is allowed to start workers from URLs with the given scheme, such as "blob".
+func (page *Page) AllowWorker(scheme string) {
+	for _, policy := range page.policies() {
+		directive := policy.effective(workerFallbacks)
+		if directive == nil || directive.has(scheme+":") || directive.has("*") && scheme != "blob" && scheme != "data" {
+			continue
+		}
+
+		// Workers are not parser-inserted, so 'strict-dynamic' in script-src allows them
+		if directive.Name == "script-src" && directive.strictDynamic() {
+			continue
+		}
+
+		if !page.rewrite {
+			page.blocked[directive.Name] = true
+			continue
+		}
+		writable := policy.writable(workerFallbacks)
+		page.modified[writable.Name] = true
+		writable.add(scheme + ":")
+	}
+}
+
+// AllowConnect ensures that the page is allowed to send requests with fetch, XHR, and WebSockets to the given URL,
+// relative to the page.
+func (page *Page) AllowConnect(target string) {
+	parsed, parseErr := page.url.Parse(target)
+	if parseErr != nil {
+		return
+	}
+
+	for _, policy := range page.policies() {
+		directive := policy.effective(connectFallbacks)
+		if directive == nil || directive.allowsURL(parsed, page.url) {
+			continue
+		}
+
+		if !page.rewrite {
+			page.blocked[directive.Name] = true
+			continue
+		}
+		writable := policy.writable(connectFallbacks)
+		page.modified[writable.Name] = true
+		writable.add(origin(parsed, page.url))
+	}
+}
+
+// Status returns the page's injection status, and the names of the directives that were rewritten, or that block
+// the injected content.
+func (page *Page) Status() (string, []string) {
+	switch {
+	case len(page.blocked) > 0:
+		return StatusBlocked, sortedKeys(page.blocked)
+	case len(page.modified) > 0:
+		return StatusModified, sortedKeys(page.modified)
+	}
+
+	return StatusInjected, nil
+}
+
+// Policy returns the page's enforced policies, as rewritten, joined with commas.
+func (page *Page) Policy() string {
+	serialized := make([]string, 0, len(page.headers)+len(page.metas))
+	for _, policy := range page.policies() {
+		serialized = append(serialized, policy.String())
+	}
+
+	return strings.Join(serialized, ", ")
+}
+
+// Apply writes any rewritten policies to the given response headers, and returns the page body with any rewritten
+// <meta> policies. The body is returned unchanged if no policies were rewritten.
+func (page *Page) Apply(header http.Header) []byte {
+	if len(page.modified) == 0 {
+		return page.body
+	}
+
+	if len(page.headers) > 0 {
+		header.Del("Content-Security-Policy")
+		for _, policy := range page.headers {
+			header.Add("Content-Security-Policy", policy.String())
+		}
+	}
+
+	if len(page.metas) == 0 {
+		return page.body
+	}
+	body := make([]byte, 0, len(page.body))
+	last := 0
+	for _, meta := range page.metas {
+		body = append(body, page.body[last:meta.start]...)
+		body = append(body, html.EscapeString(meta.policy.String())...)
+		last = meta.end
+	}
+
+	return append(body, page.body[last:]...)
+}
+
+// hashOf returns the base64-encoded SHA-256 hash of the given content, as used in hash sources.
+func hashOf(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// newNonce returns a new random nonce.
+func newNonce() string {
+	nonce := make([]byte, 16)
+	_, _ = rand.Read(nonce)
+	return base64.StdEncoding.EncodeToString(nonce)
+}
+
+// origin returns the source expression for the given URL's origin, or 'self' if it is the page's own origin.
+func origin(target *url.URL, page *url.URL) string {
+	if sourceMatches("'self'", target, page) {
+		return "'self'"
+	}
+
+	return strings.ToLower(target.Scheme) + "://" + strings.ToLower(target.Host)
+}
+
+// sortedKeys returns the keys of the given set, sorted.
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
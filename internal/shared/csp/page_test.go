@@ -0,0 +1,59 @@
+package csp
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestPageAllowScript(t *testing.T) {
+	pageURL, _ := url.Parse("https://example.com/app/index.html")
+
+	// An existing nonce is reused, and the policy is left alone
+	header := http.Header{"Content-Security-Policy": {"script-src 'nonce-abc123' 'strict-dynamic'; object-src 'none'"}}
+	page := NewPage(pageURL, header, nil, true)
+	if got := page.AllowScript("mapper.js", ""); got != ` nonce="abc123"` {
+		t.Errorf(`AllowScript() = %q, want nonce="abc123"`, got)
+	}
+	page.Apply(header)
+	if status, _ := page.Status(); status != StatusInjected || header.Get("Content-Security-Policy") != "script-src 'nonce-abc123' 'strict-dynamic'; object-src 'none'" {
+		t.Errorf("status = %s, policy = %q, want the policy unchanged", status, header.Get("Content-Security-Policy"))
+	}
+
+	// Inline scripts get a hash in a new script-src directive, leaving default-src alone
+	header = http.Header{"Content-Security-Policy": {"default-src 'self'"}}
+	page = NewPage(pageURL, header, nil, true)
+	page.AllowScript("", "alert(1)")
+	page.AllowScript("https://cdn.example.net/hook.js", "")
+	page.Apply(header)
+	want := "default-src 'self'; script-src 'self' 'sha256-bhHHL3z2vDgxUt0W3dWQOrprscmda2Y5pLsLg4GF+pI=' https://cdn.example.net"
+	if status, directives := page.Status(); status != StatusModified || len(directives) != 1 || header.Get("Content-Security-Policy") != want {
+		t.Errorf("status = %s %v, policy = %q, want %s [script-src], %q", status, directives, header.Get("Content-Security-Policy"), StatusModified, want)
+	}
+
+	// Nothing changes when rewriting is disabled
+	header = http.Header{"Content-Security-Policy": {"script-src 'none'"}}
+	page = NewPage(pageURL, header, nil, false)
+	page.AllowScript("mapper.js", "")
+	page.Apply(header)
+	if status, _ := page.Status(); status != StatusBlocked || header.Get("Content-Security-Policy") != "script-src 'none'" {
+		t.Errorf("status = %s, policy = %q, want %s and the policy unchanged", status, header.Get("Content-Security-Policy"), StatusBlocked)
+	}
+}
+
+func TestPageMetaPolicy(t *testing.T) {
+	pageURL, _ := url.Parse("https://example.com/")
+	body := []byte(`<html><head><meta http-equiv="Content-Security-Policy" content="default-src &#39;self&#39;; connect-src &#39;none&#39;"></head></html>`)
+
+	page := NewPage(pageURL, http.Header{}, body, true)
+	page.AllowScript("/mapper.js", "")
+	page.AllowWorker("blob")
+	page.AllowConnect("/")
+	got := string(page.Apply(http.Header{}))
+
+	want := `content="default-src &#39;self&#39;; connect-src &#39;self&#39;; worker-src &#39;self&#39; blob:"`
+	if !strings.Contains(got, want) {
+		t.Errorf("Apply() = %s, want it to contain %s", got, want)
+	}
+}
@@ -0,0 +1,269 @@
+// Package csp parses and rewrites Content-Security-Policy headers and <meta> tags, so that injected scripts and
+// styles can run without weakening the rest of the page's policy.
+package csp
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Directive is a single policy directive, such as "script-src 'self' https://cdn.example.com".
+type Directive struct {
+	// Name is the directive name, in lowercase.
+	Name string
+
+	// Sources holds the directive's source expressions, in order.
+	Sources []string
+}
+
+// Policy is a single Content-Security-Policy.
+type Policy struct {
+	// Directives holds the policy's directives, in order.
+	Directives []*Directive
+}
+
+// ParsePolicy parses a single serialized policy. Directives after the first with the same name are ignored, as they
+// are by browsers.
+func ParsePolicy(serialized string) *Policy {
+	policy := &Policy{}
+	for _, token := range strings.Split(serialized, ";") {
+		fields := strings.Fields(token)
+		if len(fields) == 0 {
+			continue
+		}
+		name := strings.ToLower(fields[0])
+		if policy.Directive(name) != nil {
+			continue
+		}
+		policy.Directives = append(policy.Directives, &Directive{Name: name, Sources: fields[1:]})
+	}
+
+	return policy
+}
+
+// ParsePolicies parses the given header values, each of which may hold several comma-separated policies.
+func ParsePolicies(values []string) []*Policy {
+	policies := make([]*Policy, 0, len(values))
+	for _, value := range values {
+		for _, serialized := range strings.Split(value, ",") {
+			if strings.TrimSpace(serialized) == "" {
+				continue
+			}
+			policies = append(policies, ParsePolicy(serialized))
+		}
+	}
+
+	return policies
+}
+
+// String returns the serialized policy.
+func (p *Policy) String() string {
+	directives := make([]string, 0, len(p.Directives))
+	for _, directive := range p.Directives {
+		directives = append(directives, strings.Join(append([]string{directive.Name}, directive.Sources...), " "))
+	}
+
+	return strings.Join(directives, "; ")
+}
+
+// Directive returns the directive with the given name, or nil if the policy does not have one.
+func (p *Policy) Directive(name string) *Directive {
+	for _, directive := range p.Directives {
+		if directive.Name == name {
+			return directive
+		}
+	}
+
+	return nil
+}
+
+// effective returns the first directive in the given fallback list that the policy has, or nil if it has none of
+// them, in which case the policy does not restrict that kind of request.
+func (p *Policy) effective(fallbacks []string) *Directive {
+	for _, name := range fallbacks {
+		if directive := p.Directive(name); directive != nil {
+			return directive
+		}
+	}
+
+	return nil
+}
+
+// writable returns the directive to change to allow a request governed by the given fallback list. This is the
+// effective directive if it only governs that kind of request, or otherwise a new copy of it, so that the other kinds
+// of request it governs are not affected. New copies skip the "-elem" directives, which older browsers do not
+// support.
+func (p *Policy) writable(fallbacks []string) *Directive {
+	effective := p.effective(fallbacks)
+	for _, name := range fallbacks {
+		if effective.Name == name {
+			return effective
+		}
+		if strings.HasSuffix(name, "-elem") {
+			continue
+		}
+
+		directive := &Directive{Name: name, Sources: append([]string(nil), effective.Sources...)}
+		p.Directives = append(p.Directives, directive)
+
+		return directive
+	}
+
+	return effective
+}
+
+// has returns true if the directive has the given source expression, ignoring case.
+func (d *Directive) has(source string) bool {
+	for _, s := range d.Sources {
+		if strings.EqualFold(s, source) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// add adds the given source expression to the directive, dropping 'none', which is ignored alongside other sources.
+func (d *Directive) add(source string) {
+	sources := d.Sources[:0]
+	for _, s := range d.Sources {
+		if !strings.EqualFold(s, "'none'") {
+			sources = append(sources, s)
+		}
+	}
+	d.Sources = append(sources, source)
+}
+
+// nonce returns the value of the directive's first nonce source, or an empty string if it has none.
+func (d *Directive) nonce() string {
+	for _, s := range d.Sources {
+		if len(s) > len("'nonce-'") && strings.HasPrefix(strings.ToLower(s), "'nonce-") && strings.HasSuffix(s, "'") {
+			return s[len("'nonce-") : len(s)-1]
+		}
+	}
+
+	return ""
+}
+
+// hasNonceOrHash returns true if the directive has any nonce or hash sources.
+func (d *Directive) hasNonceOrHash() bool {
+	for _, s := range d.Sources {
+		lower := strings.ToLower(s)
+		if strings.HasPrefix(lower, "'nonce-") || strings.HasPrefix(lower, "'sha256-") || strings.HasPrefix(lower, "'sha384-") || strings.HasPrefix(lower, "'sha512-") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// strictDynamic returns true if the directive has the 'strict-dynamic' keyword, which makes browsers ignore its
+// host and scheme sources, and 'unsafe-inline'.
+func (d *Directive) strictDynamic() bool {
+	return d.has("'strict-dynamic'")
+}
+
+// allowsInline returns true if the directive allows all inline content with 'unsafe-inline'. Browsers ignore
+// 'unsafe-inline' alongside nonces, hashes, or 'strict-dynamic', so adding any of those would block the page's own
+// inline content.
+func (d *Directive) allowsInline() bool {
+	return d.has("'unsafe-inline'") && !d.hasNonceOrHash() && !d.strictDynamic()
+}
+
+// allowsURL returns true if one of the directive's sources matches the given URL, loaded from the given page.
+func (d *Directive) allowsURL(target *url.URL, page *url.URL) bool {
+	for _, source := range d.Sources {
+		if sourceMatches(strings.ToLower(source), target, page) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sourceMatches returns true if the given lowercase source expression matches the URL, loaded from the given page.
+// Paths in host sources are matched by prefix if they end in a slash, and exactly otherwise.
+func sourceMatches(source string, target *url.URL, page *url.URL) bool {
+	scheme := strings.ToLower(target.Scheme)
+	switch {
+	case source == "*":
+		// The wildcard only matches network schemes, and the page's own scheme
+		return scheme == "http" || scheme == "https" || scheme == "ws" || scheme == "wss" || scheme == strings.ToLower(page.Scheme)
+	case source == "'self'":
+		return schemeMatches(strings.ToLower(page.Scheme), scheme) && strings.EqualFold(target.Hostname(), page.Hostname()) && port(target) == port(page)
+	case strings.HasPrefix(source, "'"):
+		return false
+	case strings.HasSuffix(source, ":") && !strings.Contains(source, "/"):
+		return schemeMatches(strings.TrimSuffix(source, ":"), scheme)
+	}
+
+	// Host source: [scheme://]host[:port][/path]
+	sourceScheme, rest, hasScheme := strings.Cut(source, "://")
+	if !hasScheme {
+		sourceScheme, rest = strings.ToLower(page.Scheme), source
+	}
+	if !schemeMatches(sourceScheme, scheme) {
+		return false
+	}
+	hostPort, path, hasPath := strings.Cut(rest, "/")
+	host, sourcePort, hasPort := strings.Cut(hostPort, ":")
+	targetHost := strings.ToLower(target.Hostname())
+	if strings.HasPrefix(host, "*.") {
+		if !strings.HasSuffix(targetHost, host[1:]) {
+			return false
+		}
+	} else if host != "*" && host != targetHost {
+		return false
+	}
+	if hasPort {
+		if sourcePort != "*" && sourcePort != port(target) {
+			return false
+		}
+	} else if port(target) != defaultPort(sourceScheme) && port(target) != defaultPort(scheme) {
+		return false
+	}
+	if hasPath && path != "" {
+		if strings.HasSuffix(path, "/") {
+			return strings.HasPrefix(target.EscapedPath(), "/"+path)
+		}
+		return target.EscapedPath() == "/"+path
+	}
+
+	return true
+}
+
+// schemeMatches returns true if a source with the given scheme matches a URL with the given scheme, allowing
+// upgrades from insecure schemes to secure ones.
+func schemeMatches(sourceScheme, scheme string) bool {
+	switch sourceScheme {
+	case scheme:
+		return true
+	case "http":
+		return scheme == "https"
+	case "ws":
+		return scheme == "wss" || scheme == "https"
+	}
+
+	return false
+}
+
+// port returns the URL's port, or the default port for its scheme.
+func port(u *url.URL) string {
+	if p := u.Port(); p != "" {
+		return p
+	}
+
+	return defaultPort(strings.ToLower(u.Scheme))
+}
+
+// defaultPort returns the default port for the given scheme.
+func defaultPort(scheme string) string {
+	switch scheme {
+	case "http", "ws":
+		return "80"
+	case "https", "wss":
+		return "443"
+	}
+
+	return ""
+}
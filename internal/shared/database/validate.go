@@ -57,6 +57,21 @@ func ValidateDB(dbConn *pgx.Conn) error {
 		return fmt.Errorf("unable to create crawler data table in database: %w", err)
 	}
 
+	// data_crawler_urls table
+	if err := createTableDataCrawlerURLs(dbConn); err != nil {
+		return fmt.Errorf("unable to create crawler URLs table in database: %w", err)
+	}
+
+	// data_crawler_navigation table
+	if err := createTableDataCrawlerNavigation(dbConn); err != nil {
+		return fmt.Errorf("unable to create crawler navigation table in database: %w", err)
+	}
+
+	// data_crawler_screenshots table
+	if err := createTableDataCrawlerScreenshots(dbConn); err != nil {
+		return fmt.Errorf("unable to create crawler screenshots table in database: %w", err)
+	}
+
 	// config_dns table
 	if err := createTableConfigDNS(dbConn); err != nil {
 		return fmt.Errorf("unable to create dns config table in database: %w", err)
@@ -67,6 +82,21 @@ func ValidateDB(dbConn *pgx.Conn) error {
 		return fmt.Errorf("unable to create dns data table in database: %w", err)
 	}
 
+	// data_dns_candidates table
+	if err := createTableDataDNSCandidates(dbConn); err != nil {
+		return fmt.Errorf("unable to create dns candidates table in database: %w", err)
+	}
+
+	// dns_overrides table
+	if err := createTableDNSOverrides(dbConn); err != nil {
+		return fmt.Errorf("unable to create dns overrides table in database: %w", err)
+	}
+
+	// data_dns_overrides table
+	if err := createTableDataDNSOverrides(dbConn); err != nil {
+		return fmt.Errorf("unable to create dns overrides data table in database: %w", err)
+	}
+
 	// config_injector table
 	if err := createTableConfigInjector(dbConn); err != nil {
 		return fmt.Errorf("unable to create injector config table in database: %w", err)
@@ -97,11 +127,51 @@ func ValidateDB(dbConn *pgx.Conn) error {
 		return fmt.Errorf("unable to create mapper data table in database: %w", err)
 	}
 
+	// Logger stream events table
+	if err := createTableDataLoggerStreams(dbConn); err != nil {
+		return fmt.Errorf("unable to create logger stream events table in database: %w", err)
+	}
+
 	// API Hunter data table
 	if err := createTableDataApiHunter(dbConn); err != nil {
 		return fmt.Errorf("unable to create API hunter table in database: %w", err)
 	}
 
+	// API Hunter gRPC descriptor sets table
+	if err := createTableApiHunterGrpcDescriptors(dbConn); err != nil {
+		return fmt.Errorf("unable to create API hunter gRPC descriptors table in database: %w", err)
+	}
+
+	// Mapper organisations table
+	if err := createTableMapperOrganisations(dbConn); err != nil {
+		return fmt.Errorf("unable to create mapper organisations table in database: %w", err)
+	}
+
+	// Mapper snapshots table
+	if err := createTableMapperSnapshots(dbConn); err != nil {
+		return fmt.Errorf("unable to create mapper snapshots table in database: %w", err)
+	}
+
+	// Mapper snapshot edges table
+	if err := createTableMapperSnapshotEdges(dbConn); err != nil {
+		return fmt.Errorf("unable to create mapper snapshot edges table in database: %w", err)
+	}
+
+	// JavaScript analyzer endpoints table
+	if err := createTableDataJSEndpoints(dbConn); err != nil {
+		return fmt.Errorf("unable to create JavaScript analyzer endpoints table in database: %w", err)
+	}
+
+	// JavaScript analyzer source maps table
+	if err := createTableDataJSSourceMaps(dbConn); err != nil {
+		return fmt.Errorf("unable to create JavaScript analyzer source maps table in database: %w", err)
+	}
+
+	// Browser instrumentation events table
+	if err := createTableDataBrowserEvents(dbConn); err != nil {
+		return fmt.Errorf("unable to create browser instrumentation events table in database: %w", err)
+	}
+
 	// targets table
 	if err := createTableTargets(dbConn); err != nil {
 		return fmt.Errorf("unable to create targets table in database: %w", err)
@@ -112,6 +182,16 @@ func ValidateDB(dbConn *pgx.Conn) error {
 		return fmt.Errorf("unable to create injector script URLs table in database: %w", err)
 	}
 
+	// injector rules table
+	if err := createTableInjectorRules(dbConn); err != nil {
+		return fmt.Errorf("unable to create injector rules table in database: %w", err)
+	}
+
+	// Injection coverage table
+	if err := createTableDataInjectionCoverage(dbConn); err != nil {
+		return fmt.Errorf("unable to create injection coverage table in database: %w", err)
+	}
+
 	// Corpus data - http header keys table
 	if err := createTableCorpusHttpHeaderKeys(dbConn); err != nil {
 		return fmt.Errorf("unable to create corpus http header keys table in database: %w", err)
@@ -374,16 +454,52 @@ func createTableConfigCrawler(dbConn *pgx.Conn) error {
 	}
 	if !exists {
 		// Create table
-		sqlTableCreate := `CREATE TABLE IF NOT EXISTS config_crawler ();`
+		sqlTableCreate := `create table if not exists config_crawler
+			(
+				max_depth           integer          default 3                      not null,
+				max_pages           integer          default 1000                   not null,
+				requests_per_second double precision default 2                      not null,
+				concurrency         integer          default 4                      not null,
+				respect_robots      boolean          default true                   not null,
+				user_agent          text             default 'Cartograph Crawler'::text not null,
+				mode                text             default 'http'::text           not null
+			);
+			
+			comment on column config_crawler.max_depth is 'Maximum number of links followed from the start of a crawl.';
+			
+			comment on column config_crawler.max_pages is 'Maximum number of URLs requested by a single crawl job.';
+			
+			comment on column config_crawler.requests_per_second is 'Maximum number of requests sent to each host every second.';
+			
+			comment on column config_crawler.concurrency is 'Maximum number of requests a single crawl job has in flight at once.';
+			
+			comment on column config_crawler.mode is 'Crawl mode: "http" (plain HTTP requests), or "browser" (a headless Chromium driven over the DevTools protocol).';`
 		if _, err := dbConn.Exec(context.Background(), sqlTableCreate); err != nil {
 			return err
 		}
+	} else {
+		// Add the settings columns to the placeholder table created before the crawler was implemented
+		sqlTableAlter := `alter table config_crawler
+				add column if not exists max_depth integer default 3 not null,
+				add column if not exists max_pages integer default 1000 not null,
+				add column if not exists requests_per_second double precision default 2 not null,
+				add column if not exists concurrency integer default 4 not null,
+				add column if not exists respect_robots boolean default true not null,
+				add column if not exists user_agent text default 'Cartograph Crawler'::text not null,
+				add column if not exists mode text default 'http'::text not null;`
+		if _, alterErr := dbConn.Exec(context.Background(), sqlTableAlter); alterErr != nil {
+			return fmt.Errorf("unable to add settings columns to %s table: %w", tableName, alterErr)
+		}
+	}
 
-		return nil
+	// Insert the default values, if there are none yet
+	sqlTableInsertDefaultValues := `insert into config_crawler select where not exists (select 1 from config_crawler);`
+	if _, err := dbConn.Exec(context.Background(), sqlTableInsertDefaultValues); err != nil {
+		return fmt.Errorf("unable to insert default table values: %w", err)
 	}
 
 	// Validate the schema
-	sqlTableSelect := `SELECT * from config_crawler LIMIT 1;`
+	sqlTableSelect := `SELECT max_depth, max_pages, requests_per_second, concurrency, respect_robots, user_agent, mode from config_crawler LIMIT 1;`
 	rows, queryErr := dbConn.Query(context.Background(), sqlTableSelect)
 	if queryErr != nil {
 		return fmt.Errorf("%s table is misconfigured; please backup your data from the database and remove the table: %w", tableName, queryErr)
@@ -407,7 +523,210 @@ func createTableDataCrawler(dbConn *pgx.Conn) error {
 	}
 	if !exists {
 		// Create table
-		sqlTableCreate := `create table if not exists data_crawler ();`
+		sqlTableCreate := `create table if not exists data_crawler
+			(
+				id       uuid                                 not null
+					constraint data_crawler_pk
+						primary key,
+				status   text                                 not null,
+				hosts    text[]  default '{}'::text[]         not null,
+				settings jsonb                                not null,
+				visited  integer default 0                    not null,
+				skipped  integer default 0                    not null,
+				errors   integer default 0                    not null,
+				error    text    default ''::text             not null,
+				created  timestamp with time zone             not null,
+				updated  timestamp with time zone             not null,
+				finished timestamp with time zone
+			);
+			
+			comment on table data_crawler is 'Crawl jobs started by the crawler plugin, and their progress.';
+			
+			comment on column data_crawler.status is 'Job status: "running", "paused" (stopped by a shutdown, and resumed on the next start), "finished", "cancelled", or "failed".';
+			
+			comment on column data_crawler.hosts is 'Target hosts the crawl started from.';
+			
+			comment on column data_crawler.settings is 'Crawler settings the job was started with.';`
+		if _, err := dbConn.Exec(context.Background(), sqlTableCreate); err != nil {
+			return err
+		}
+	} else {
+		// Add the job columns to the placeholder table created before the crawler was implemented
+		sqlTableAlter := `alter table data_crawler
+				add column if not exists id uuid not null,
+				add column if not exists status text not null,
+				add column if not exists hosts text[] default '{}'::text[] not null,
+				add column if not exists settings jsonb not null,
+				add column if not exists visited integer default 0 not null,
+				add column if not exists skipped integer default 0 not null,
+				add column if not exists errors integer default 0 not null,
+				add column if not exists error text default ''::text not null,
+				add column if not exists created timestamp with time zone not null,
+				add column if not exists updated timestamp with time zone not null,
+				add column if not exists finished timestamp with time zone;
+			
+			do
+			$$
+			begin
+				if not exists (select 1
+							   from information_schema.table_constraints
+							   where table_name = 'data_crawler'
+								 and constraint_name = 'data_crawler_pk') then
+					alter table data_crawler add constraint data_crawler_pk primary key (id);
+				end if;
+			end
+			$$;`
+		if _, alterErr := dbConn.Exec(context.Background(), sqlTableAlter); alterErr != nil {
+			return fmt.Errorf("unable to add job columns to %s table: %w", tableName, alterErr)
+		}
+	}
+
+	// Validate the schema
+	sqlTableSelect := `SELECT id, status, hosts, settings, visited, skipped, errors, error, created, updated, finished from data_crawler LIMIT 1;`
+	rows, queryErr := dbConn.Query(context.Background(), sqlTableSelect)
+	if queryErr != nil {
+		return fmt.Errorf("%s table is misconfigured; please backup your data from the database and remove the table: %w", tableName, queryErr)
+	}
+	// Rows must be called and closed for the connection to be used again.
+	rows.Close()
+
+	return nil
+}
+
+// createTableDataCrawlerURLs first checks whether the data_crawler_urls table exists, and
+// creates the table if it does not.
+// Any errors returned should be considered fatal.
+func createTableDataCrawlerURLs(dbConn *pgx.Conn) error {
+	tableName := "data_crawler_urls"
+
+	// Check if table exists
+	exists, existsErr := tableExists(dbConn, tableName)
+	if existsErr != nil {
+		return existsErr
+	}
+	if !exists {
+		// Create table
+		sqlTableCreate := `create table if not exists data_crawler_urls
+			(
+				job_id     uuid                             not null
+					constraint data_crawler_urls_job_id_fk
+						references data_crawler
+						on delete cascade,
+				template   text                             not null,
+				url        text                             not null,
+				referer    text    default ''::text         not null,
+				depth      integer                          not null,
+				status     text                             not null,
+				resp_code  integer default 0                not null,
+				error      text    default ''::text         not null,
+				discovered timestamp with time zone         not null,
+				visited    timestamp with time zone,
+				constraint data_crawler_urls_pk
+					primary key (job_id, template)
+			);
+			
+			comment on table data_crawler_urls is 'URLs found by each crawl job, deduplicated on their templated path and query parameter names.';
+			
+			comment on column data_crawler_urls.template is 'URL with numeric, UUID, hexadecimal, and token path segments replaced by placeholders, and only the query parameter names kept.';
+			
+			comment on column data_crawler_urls.status is 'URL status: "queued", "visited", "robots" (disallowed by robots.txt), or "error".';`
+		if _, err := dbConn.Exec(context.Background(), sqlTableCreate); err != nil {
+			return err
+		}
+		return nil
+	}
+
+	// Validate the schema
+	sqlTableSelect := `SELECT job_id, template, url, referer, depth, status, resp_code, error, discovered, visited FROM data_crawler_urls LIMIT 1;`
+	rows, queryErr := dbConn.Query(context.Background(), sqlTableSelect)
+	if queryErr != nil {
+		return fmt.Errorf("%s table is misconfigured; please backup your data from the database and remove the table: %w", tableName, queryErr)
+	}
+	// Rows must be called and closed for the connection to be used again.
+	rows.Close()
+
+	return nil
+}
+
+// createTableDataCrawlerNavigation first checks whether the data_crawler_navigation table exists, and
+// creates the table if it does not.
+// Any errors returned should be considered fatal.
+func createTableDataCrawlerNavigation(dbConn *pgx.Conn) error {
+	tableName := "data_crawler_navigation"
+
+	// Check if table exists
+	exists, existsErr := tableExists(dbConn, tableName)
+	if existsErr != nil {
+		return existsErr
+	}
+	if !exists {
+		// Create table
+		sqlTableCreate := `create table if not exists data_crawler_navigation
+			(
+				job_id     uuid                         not null
+					constraint data_crawler_navigation_job_id_fk
+						references data_crawler
+						on delete cascade,
+				from_url   text                         not null,
+				to_url     text                         not null,
+				action     text                         not null,
+				element    text default ''::text        not null,
+				discovered timestamp with time zone     not null,
+				constraint data_crawler_navigation_pk
+					primary key (job_id, from_url, to_url, action)
+			);
+			
+			comment on table data_crawler_navigation is 'Navigation graph of the pages rendered by browser crawl jobs.';
+			
+			comment on column data_crawler_navigation.action is 'How the page led to the URL: "link", "click", "form", or "redirect".';
+			
+			comment on column data_crawler_navigation.element is 'Element the navigation started from, such as "button#save".';`
+		if _, err := dbConn.Exec(context.Background(), sqlTableCreate); err != nil {
+			return err
+		}
+		return nil
+	}
+
+	// Validate the schema
+	sqlTableSelect := `SELECT job_id, from_url, to_url, action, element, discovered FROM data_crawler_navigation LIMIT 1;`
+	rows, queryErr := dbConn.Query(context.Background(), sqlTableSelect)
+	if queryErr != nil {
+		return fmt.Errorf("%s table is misconfigured; please backup your data from the database and remove the table: %w", tableName, queryErr)
+	}
+	// Rows must be called and closed for the connection to be used again.
+	rows.Close()
+
+	return nil
+}
+
+// createTableDataCrawlerScreenshots first checks whether the data_crawler_screenshots table exists, and
+// creates the table if it does not.
+// Any errors returned should be considered fatal.
+func createTableDataCrawlerScreenshots(dbConn *pgx.Conn) error {
+	tableName := "data_crawler_screenshots"
+
+	// Check if table exists
+	exists, existsErr := tableExists(dbConn, tableName)
+	if existsErr != nil {
+		return existsErr
+	}
+	if !exists {
+		// Create table
+		sqlTableCreate := `create table if not exists data_crawler_screenshots
+			(
+				job_id     uuid                     not null
+					constraint data_crawler_screenshots_job_id_fk
+						references data_crawler
+						on delete cascade,
+				template   text                     not null,
+				url        text                     not null,
+				screenshot bytea                    not null,
+				taken      timestamp with time zone not null,
+				constraint data_crawler_screenshots_pk
+					primary key (job_id, template)
+			);
+			
+			comment on table data_crawler_screenshots is 'PNG screenshots of the pages rendered by browser crawl jobs, once loaded.';`
 		if _, err := dbConn.Exec(context.Background(), sqlTableCreate); err != nil {
 			return err
 		}
@@ -415,7 +734,7 @@ func createTableDataCrawler(dbConn *pgx.Conn) error {
 	}
 
 	// Validate the schema
-	sqlTableSelect := `SELECT * from data_crawler LIMIT 1;`
+	sqlTableSelect := `SELECT job_id, template, url, screenshot, taken FROM data_crawler_screenshots LIMIT 1;`
 	rows, queryErr := dbConn.Query(context.Background(), sqlTableSelect)
 	if queryErr != nil {
 		return fmt.Errorf("%s table is misconfigured; please backup your data from the database and remove the table: %w", tableName, queryErr)
@@ -439,16 +758,36 @@ func createTableConfigDNS(dbConn *pgx.Conn) error {
 	}
 	if !exists {
 		// Create table
-		sqlTableCreate := `CREATE TABLE IF NOT EXISTS config_dns ();`
+		sqlTableCreate := `create table if not exists config_dns
+			(
+				log_resolutions    boolean default true not null,
+				collect_candidates boolean default true not null
+			);
+			
+			comment on column config_dns.log_resolutions is 'Whether the records of every DNS resolution are saved to the data_dns table.';
+			
+			comment on column config_dns.collect_candidates is 'Whether the host names found in proxied traffic and DNS data are saved as candidate hosts.';`
 		if _, err := dbConn.Exec(context.Background(), sqlTableCreate); err != nil {
 			return err
 		}
+	} else {
+		// Add the settings columns to the placeholder table created before the DNS plugin was implemented
+		sqlTableAlter := `alter table config_dns
+				add column if not exists log_resolutions boolean default true not null,
+				add column if not exists collect_candidates boolean default true not null;`
+		if _, alterErr := dbConn.Exec(context.Background(), sqlTableAlter); alterErr != nil {
+			return fmt.Errorf("unable to add settings columns to %s table: %w", tableName, alterErr)
+		}
+	}
 
-		return nil
+	// Insert the default values, if there are none yet
+	sqlTableInsertDefaultValues := `insert into config_dns select where not exists (select 1 from config_dns);`
+	if _, err := dbConn.Exec(context.Background(), sqlTableInsertDefaultValues); err != nil {
+		return fmt.Errorf("unable to insert default table values: %w", err)
 	}
 
 	// Validate the schema
-	sqlTableSelect := `SELECT * from config_dns LIMIT 1;`
+	sqlTableSelect := `SELECT log_resolutions, collect_candidates from config_dns LIMIT 1;`
 	rows, queryErr := dbConn.Query(context.Background(), sqlTableSelect)
 	if queryErr != nil {
 		return fmt.Errorf("%s table is misconfigured; please backup your data from the database and remove the table: %w", tableName, queryErr)
@@ -472,7 +811,190 @@ func createTableDataDNS(dbConn *pgx.Conn) error {
 	}
 	if !exists {
 		// Create table
-		sqlTableCreate := `create table if not exists data_dns ();`
+		sqlTableCreate := `create table if not exists data_dns
+			(
+				host        text                             not null,
+				name        text                             not null,
+				record_type text                             not null,
+				value       text    default ''::text         not null,
+				ttl         bigint  default 0                not null,
+				resolver    text    default ''::text         not null,
+				rcode       text    default ''::text         not null,
+				source      text                             not null,
+				timestamp   timestamp with time zone         not null
+			);
+			
+			comment on table data_dns is 'DNS records of the resolutions performed by the proxy, seen by the DNS listener, or imported from passive DNS data.';
+			
+			comment on column data_dns.name is 'Owner name of the record, which differs from the host for records following a CNAME.';
+			
+			comment on column data_dns.value is 'Address, or canonical name for CNAME records; empty if the resolution had no answer.';
+			
+			comment on column data_dns.resolver is 'DNS server that answered, "/etc/hosts", or the passive DNS input the record was read from.';
+			
+			comment on column data_dns.source is 'Where the resolution was seen: "proxy", "listener", or "passive".';
+			
+			create index if not exists data_dns_host_index
+				on data_dns (host, timestamp);`
+		if _, err := dbConn.Exec(context.Background(), sqlTableCreate); err != nil {
+			return err
+		}
+	} else {
+		// Add the record columns to the placeholder table created before the DNS plugin was implemented
+		sqlTableAlter := `alter table data_dns
+				add column if not exists host text not null,
+				add column if not exists name text not null,
+				add column if not exists record_type text not null,
+				add column if not exists value text default ''::text not null,
+				add column if not exists ttl bigint default 0 not null,
+				add column if not exists resolver text default ''::text not null,
+				add column if not exists rcode text default ''::text not null,
+				add column if not exists source text not null,
+				add column if not exists timestamp timestamp with time zone not null;
+			
+			create index if not exists data_dns_host_index
+				on data_dns (host, timestamp);`
+		if _, alterErr := dbConn.Exec(context.Background(), sqlTableAlter); alterErr != nil {
+			return fmt.Errorf("unable to add record columns to %s table: %w", tableName, alterErr)
+		}
+	}
+
+	// Validate the schema
+	sqlTableSelect := `SELECT host, name, record_type, value, ttl, resolver, rcode, source, timestamp from data_dns LIMIT 1;`
+	rows, queryErr := dbConn.Query(context.Background(), sqlTableSelect)
+	if queryErr != nil {
+		return fmt.Errorf("%s table is misconfigured; please backup your data from the database and remove the table: %w", tableName, queryErr)
+	}
+	// Rows must be called and closed for the connection to be used again.
+	rows.Close()
+
+	return nil
+}
+
+// createTableDataDNSCandidates first checks whether the data_dns_candidates table exists, and
+// creates the table if it does not.
+// Any errors returned should be considered fatal.
+func createTableDataDNSCandidates(dbConn *pgx.Conn) error {
+	tableName := "data_dns_candidates"
+
+	// Check if table exists
+	exists, existsErr := tableExists(dbConn, tableName)
+	if existsErr != nil {
+		return existsErr
+	}
+	if !exists {
+		// Create table
+		sqlTableCreate := `create table if not exists data_dns_candidates
+			(
+				host       text                          not null,
+				source     text                          not null,
+				found_in   text default ''::text         not null,
+				first_seen timestamp with time zone      not null,
+				last_seen  timestamp with time zone      not null,
+				constraint data_dns_candidates_pk
+					primary key (host, source)
+			);
+			
+			comment on table data_dns_candidates is 'Host names found in proxied traffic and DNS data, which may be worth adding to the targets.';
+			
+			comment on column data_dns_candidates.source is 'Where the host name was found: "san" (certificate subject alternative names), "csp" (Content-Security-Policy headers), "js" (script bodies), "listener", or "passive".';
+			
+			comment on column data_dns_candidates.found_in is 'URL or resolver the host name was first found in.';`
+		if _, err := dbConn.Exec(context.Background(), sqlTableCreate); err != nil {
+			return err
+		}
+		return nil
+	}
+
+	// Validate the schema
+	sqlTableSelect := `SELECT host, source, found_in, first_seen, last_seen FROM data_dns_candidates LIMIT 1;`
+	rows, queryErr := dbConn.Query(context.Background(), sqlTableSelect)
+	if queryErr != nil {
+		return fmt.Errorf("%s table is misconfigured; please backup your data from the database and remove the table: %w", tableName, queryErr)
+	}
+	// Rows must be called and closed for the connection to be used again.
+	rows.Close()
+
+	return nil
+}
+
+// createTableDNSOverrides first checks whether the dns_overrides table exists, and
+// creates it if it doesn't.
+// Any errors returned should be considered fatal.
+func createTableDNSOverrides(dbConn *pgx.Conn) error {
+	tableName := "dns_overrides"
+
+	// Check if table exists
+	exists, existsErr := tableExists(dbConn, tableName)
+	if existsErr != nil {
+		return existsErr
+	}
+	if !exists {
+		// Create table
+		sqlTableCreate := `create table if not exists dns_overrides
+			(
+				id      uuid        default uuid_generate_v4() not null
+					constraint dns_overrides_pk
+						primary key,
+				target  uuid                                   not null,
+				host    text                                   not null,
+				address text                                   not null,
+				enabled boolean     default true               not null,
+				created timestamptz default now()              not null
+			);
+			
+			comment on table dns_overrides is 'Addresses connected to by the proxy instead of resolving target host names, such as to test staging servers.';
+			
+			comment on column dns_overrides.target is 'UUID value referencing the ID of the target rule set in the "targets" table the override applies to.';
+			
+			comment on column dns_overrides.host is 'Host name overridden, or a wildcard such as "*.example.com" for every subdomain.';`
+		if _, err := dbConn.Exec(context.Background(), sqlTableCreate); err != nil {
+			return err
+		}
+		return nil
+	}
+
+	// Validate the schema
+	sqlTableSelect := `SELECT id, target, host, address, enabled, created FROM dns_overrides LIMIT 1;`
+	rows, queryErr := dbConn.Query(context.Background(), sqlTableSelect)
+	if queryErr != nil {
+		return fmt.Errorf("%s table is misconfigured; please backup your data from the database and remove the table: %w", tableName, queryErr)
+	}
+	// Rows must be called and closed for the connection to be used again.
+	rows.Close()
+
+	return nil
+}
+
+// createTableDataDNSOverrides first checks whether the data_dns_overrides table exists, and
+// creates it if it doesn't.
+// Any errors returned should be considered fatal.
+func createTableDataDNSOverrides(dbConn *pgx.Conn) error {
+	tableName := "data_dns_overrides"
+
+	// Check if table exists
+	exists, existsErr := tableExists(dbConn, tableName)
+	if existsErr != nil {
+		return existsErr
+	}
+	if !exists {
+		// Create table
+		sqlTableCreate := `create table if not exists data_dns_overrides
+			(
+				override_id uuid                     not null,
+				host        text                     not null,
+				address     text                     not null,
+				method      text                     not null,
+				url         text                     not null,
+				timestamp   timestamp with time zone not null
+			);
+			
+			comment on table data_dns_overrides is 'Requests sent by the proxy to the address of a DNS override.';
+			
+			comment on column data_dns_overrides.override_id is 'UUID value referencing the ID of the override applied in the "dns_overrides" table.';
+			
+			create index if not exists data_dns_overrides_override_id_index
+				on data_dns_overrides (override_id, timestamp);`
 		if _, err := dbConn.Exec(context.Background(), sqlTableCreate); err != nil {
 			return err
 		}
@@ -480,7 +1002,7 @@ func createTableDataDNS(dbConn *pgx.Conn) error {
 	}
 
 	// Validate the schema
-	sqlTableSelect := `SELECT * from data_dns LIMIT 1;`
+	sqlTableSelect := `SELECT override_id, host, address, method, url, timestamp FROM data_dns_overrides LIMIT 1;`
 	rows, queryErr := dbConn.Query(context.Background(), sqlTableSelect)
 	if queryErr != nil {
 		return fmt.Errorf("%s table is misconfigured; please backup your data from the database and remove the table: %w", tableName, queryErr)
@@ -597,17 +1119,407 @@ func createTableConfigLogger(dbConn *pgx.Conn) error {
 		if _, err := dbConn.Exec(context.Background(), sqlTableCreate); err != nil {
 			return err
 		}
-
-		// Insert default values
-		sqlTableInsert := `INSERT INTO config_logger default values;`
-		if _, err := dbConn.Exec(context.Background(), sqlTableInsert); err != nil {
-			return err
-		}
-
+
+		// Insert default values
+		sqlTableInsert := `INSERT INTO config_logger default values;`
+		if _, err := dbConn.Exec(context.Background(), sqlTableInsert); err != nil {
+			return err
+		}
+
+		return nil
+	}
+
+	sqlTableSelect := `SELECT enabled, targets, ignored FROM config_logger LIMIT 1;`
+	rows, queryErr := dbConn.Query(context.Background(), sqlTableSelect)
+	if queryErr != nil {
+		return fmt.Errorf("%s table is misconfigured; please backup your data from the database and remove the table: %w", tableName, queryErr)
+	}
+	// Rows must be called and closed for the connection to be used again.
+	rows.Close()
+
+	return nil
+}
+
+// createTableDataLogger first checks whether the data_logger table exists, and
+// creates the table if it does not.
+// Any errors returned should be considered fatal.
+func createTableDataLogger(dbConn *pgx.Conn) error {
+	tableName := "data_logger"
+
+	// Check if table exists
+	exists, existsErr := tableExists(dbConn, tableName)
+	if existsErr != nil {
+		return existsErr
+	}
+	if !exists {
+		// Create table
+		sqlTableCreate := `create table if not exists data_logger
+			(
+				url_scheme           text    default ''::text     not null,
+				url_host             text                         not null,
+				url_path             text    default ''::text     not null,
+				date_found           timestamp with time zone     not null,
+				req_method           text    default ''::text     not null,
+				param_keys           text[]  default '{}'::text[] not null,
+				header_keys_req      text[]  default '{}'::text[] not null,
+				header_keys_resp     text[]  default '{}'::text[] not null,
+				cookie_keys          text[]  default '{}'::text[] not null,
+				resp_code            integer default 0            not null,
+				param_key_vals       text[]  default '{}'::text[] not null,
+				header_key_vals_req  text[]  default '{}'::text[] not null,
+				header_key_vals_resp text[]  default '{}'::text[] not null,
+				cookie_key_vals      text[]  default '{}'::text[] not null,
+				last_seen            timestamp with time zone     not null,
+				constraint data_logger_pk
+					primary key (url_scheme, url_host, url_path, req_method, resp_code)
+			);`
+		if _, err := dbConn.Exec(context.Background(), sqlTableCreate); err != nil {
+			return err
+		}
+		return nil
+	}
+
+	// Validate the schema
+	sqlTableSelect := `SELECT url_scheme, url_host, url_path, date_found, req_method, param_keys, header_keys_req, header_keys_resp, cookie_keys, resp_code, param_key_vals, header_key_vals_req, header_key_vals_resp, cookie_key_vals, last_seen FROM data_logger LIMIT 1;`
+	rows, queryErr := dbConn.Query(context.Background(), sqlTableSelect)
+	if queryErr != nil {
+		return fmt.Errorf("%s table is misconfigured; please backup your data from the database and remove the table: %w", tableName, queryErr)
+	}
+	// Rows must be called and closed for the connection to be used again.
+	rows.Close()
+
+	return nil
+}
+
+// createTableDataLoggerStreams first checks whether the data_logger_streams table exists, and
+// creates the table if it does not.
+// Any errors returned should be considered fatal.
+func createTableDataLoggerStreams(dbConn *pgx.Conn) error {
+	tableName := "data_logger_streams"
+
+	// Check if table exists
+	exists, existsErr := tableExists(dbConn, tableName)
+	if existsErr != nil {
+		return existsErr
+	}
+	if !exists {
+		// Create table
+		sqlTableCreate := `create table if not exists data_logger_streams
+			(
+				url_scheme    text                     not null,
+				url_host      text                     not null,
+				url_path      text                     not null,
+				req_method    text                     not null,
+				resp_code     integer                  not null,
+				req_timestamp timestamp with time zone not null,
+				stream_type   text                     not null,
+				sequence      integer                  not null,
+				event_name    text default ''::text    not null,
+				event_id      text default ''::text    not null,
+				data_shape    jsonb                    not null,
+				data_size     integer                  not null,
+				timestamp     timestamp with time zone not null,
+				constraint data_logger_streams_pk
+					primary key (url_scheme, url_host, url_path, req_method, req_timestamp, sequence)
+			);
+			
+			comment on table data_logger_streams is 'Events parsed from streaming (Server-Sent Events and NDJSON) HTTP responses. Linked to the originating request in data_logger by URL scheme, host, path, request method, and response code.';
+			
+			comment on column data_logger_streams.req_timestamp is 'Timestamp of the originating request, identifying the individual stream.';
+			
+			comment on column data_logger_streams.stream_type is 'Type of stream (e.g. "sse", "ndjson").';
+			
+			comment on column data_logger_streams.sequence is 'Position of the event in the stream, starting from 0.';
+			
+			comment on column data_logger_streams.data_shape is 'Structure of the event data (JSON types only, no values).';`
+		if _, err := dbConn.Exec(context.Background(), sqlTableCreate); err != nil {
+			return err
+		}
+		return nil
+	}
+
+	// Validate the schema
+	sqlTableSelect := `SELECT url_scheme, url_host, url_path, req_method, resp_code, req_timestamp, stream_type, sequence, event_name, event_id, data_shape, data_size, timestamp FROM data_logger_streams LIMIT 1;`
+	rows, queryErr := dbConn.Query(context.Background(), sqlTableSelect)
+	if queryErr != nil {
+		return fmt.Errorf("%s table is misconfigured; please backup your data from the database and remove the table: %w", tableName, queryErr)
+	}
+	// Rows must be called and closed for the connection to be used again.
+	rows.Close()
+
+	return nil
+}
+
+// createTableConfigMapper first checks for the existence of the config_mapper table,
+// then creates the table and populates it with default values if it does
+// not exist.
+// Any errors returned should be considered fatal.
+func createTableConfigMapper(dbConn *pgx.Conn) error {
+	tableName := "config_mapper"
+
+	// Check if table exists
+	exists, existsErr := tableExists(dbConn, tableName)
+	if existsErr != nil {
+		return existsErr
+	}
+	if !exists {
+		// Create table
+		sqlTableCreate := `create table if not exists config_mapper
+			(
+				enabled boolean default true             not null,
+				targets uuid[]  default ARRAY []::uuid[] not null,
+				ignored uuid[]  default ARRAY []::uuid[] not null
+			);`
+		if _, err := dbConn.Exec(context.Background(), sqlTableCreate); err != nil {
+			return err
+		}
+
+		// Insert default values
+		sqlTableInsert := `INSERT INTO config_mapper default values;`
+		if _, err := dbConn.Exec(context.Background(), sqlTableInsert); err != nil {
+			return err
+		}
+
+		return nil
+	}
+
+	sqlTableSelect := `SELECT enabled, targets, ignored FROM config_mapper LIMIT 1;`
+	rows, queryErr := dbConn.Query(context.Background(), sqlTableSelect)
+	if queryErr != nil {
+		return fmt.Errorf("%s table is misconfigured; please backup your data from the database and remove the table: %w", tableName, queryErr)
+	}
+	// Rows must be called and closed for the connection to be used again.
+	rows.Close()
+
+	return nil
+}
+
+// createTableDataMapper first checks whether the data_mapper table exists, and
+// creates the table if it does not.
+// Any errors returned should be considered fatal.
+func createTableDataMapper(dbConn *pgx.Conn) error {
+	tableName := "data_mapper"
+
+	// Check if table exists
+	exists, existsErr := tableExists(dbConn, tableName)
+	if existsErr != nil {
+		return existsErr
+	}
+	if !exists {
+		// Create table
+		sqlTableCreate := `create table if not exists data_mapper
+			(
+				referer_scheme     text default ''::text    not null,
+				referer_host       text default ''::text    not null,
+				referer_path       text default ''::text    not null,
+				destination_scheme text                     not null,
+				destination_host   text                     not null,
+				destination_path   text                     not null,
+				edge_type          text default 'link'::text not null,
+				element            text default ''::text    not null,
+				attribute          text default ''::text    not null,
+				first_seen         timestamp with time zone not null,
+				last_seen          timestamp with time zone not null,
+				constraint data_mapper_pk
+					primary key (referer_scheme, referer_host, referer_path, destination_scheme, destination_host, destination_path, edge_type)
+			);
+			
+			comment on column data_mapper.edge_type is 'How the referer led to the destination: "link", "redirect", "script", "iframe", "fetch", "form", "image", "media", "resource", or "discovered".';
+			
+			comment on column data_mapper.element is 'HTML element the destination was found in (e.g. "script"), or the script API used to request it (e.g. "fetch"). Contains empty text if unknown.';
+			
+			comment on column data_mapper.attribute is 'HTML attribute the destination was found in (e.g. "src"). Contains empty text if unknown.';
+			
+			create index if not exists data_mapper_referer_host_index
+				on data_mapper (referer_host);
+			
+			create index if not exists data_mapper_destination_host_index
+				on data_mapper (destination_host);
+			
+			create index if not exists data_mapper_last_seen_index
+				on data_mapper (last_seen);`
+		if _, err := dbConn.Exec(context.Background(), sqlTableCreate); err != nil {
+			return err
+		}
+		return nil
+	}
+
+	// Add the edge type, element and attribute columns to tables created before they existed, and make the edge type
+	// part of the primary key, so that the same pair of URLs can be connected in more than one way. The host indexes
+	// are used to follow connections from a host, and the last seen index to limit connections to a time window.
+	sqlTableAlter := `alter table data_mapper
+			add column if not exists edge_type text default 'link'::text not null,
+			add column if not exists element text default ''::text not null,
+			add column if not exists attribute text default ''::text not null;
+		
+		do
+		$$
+		begin
+			if not exists (select 1
+						   from information_schema.key_column_usage
+						   where table_name = 'data_mapper'
+							 and constraint_name = 'data_mapper_pk'
+							 and column_name = 'edge_type') then
+				alter table data_mapper drop constraint data_mapper_pk;
+				alter table data_mapper add constraint data_mapper_pk
+					primary key (referer_scheme, referer_host, referer_path, destination_scheme, destination_host, destination_path, edge_type);
+			end if;
+		end
+		$$;
+		
+		create index if not exists data_mapper_referer_host_index
+			on data_mapper (referer_host);
+		
+		create index if not exists data_mapper_destination_host_index
+			on data_mapper (destination_host);
+		
+		create index if not exists data_mapper_last_seen_index
+			on data_mapper (last_seen);`
+	if _, alterErr := dbConn.Exec(context.Background(), sqlTableAlter); alterErr != nil {
+		return fmt.Errorf("unable to add edge type columns to %s table: %w", tableName, alterErr)
+	}
+
+	// Validate the schema
+	sqlTableSelect := `SELECT referer_scheme, referer_host, referer_path, destination_scheme, destination_host, destination_path, edge_type, element, attribute, first_seen, last_seen FROM data_mapper LIMIT 1;`
+	rows, queryErr := dbConn.Query(context.Background(), sqlTableSelect)
+	if queryErr != nil {
+		return fmt.Errorf("%s table is misconfigured; please backup your data from the database and remove the table: %w", tableName, queryErr)
+	}
+	// Rows must be called and closed for the connection to be used again.
+	rows.Close()
+
+	return nil
+}
+
+// createTableMapperOrganisations first checks whether the mapper_organisations table exists, and
+// creates the table if it does not.
+// Any errors returned should be considered fatal.
+func createTableMapperOrganisations(dbConn *pgx.Conn) error {
+	tableName := "mapper_organisations"
+
+	// Check if table exists
+	exists, existsErr := tableExists(dbConn, tableName)
+	if existsErr != nil {
+		return existsErr
+	}
+	if !exists {
+		// Create table
+		sqlTableCreate := `create table if not exists mapper_organisations
+			(
+				domain       text                     not null
+					constraint mapper_organisations_pk
+						primary key,
+				organisation text                     not null,
+				source       text                     not null default 'user',
+				updated      timestamp with time zone not null default now()
+			);
+			
+			comment on table mapper_organisations is 'Organisations that own registrable domains, used to tell first-party from third-party connections.';
+			comment on column mapper_organisations.source is 'Where the mapping came from: "user" for user-supplied mappings, or "certificate" for mappings derived from TLS certificate subjects.';`
+		if _, err := dbConn.Exec(context.Background(), sqlTableCreate); err != nil {
+			return err
+		}
+		return nil
+	}
+
+	// Validate the schema
+	sqlTableSelect := `SELECT domain, organisation, source, updated FROM mapper_organisations LIMIT 1;`
+	rows, queryErr := dbConn.Query(context.Background(), sqlTableSelect)
+	if queryErr != nil {
+		return fmt.Errorf("%s table is misconfigured; please backup your data from the database and remove the table: %w", tableName, queryErr)
+	}
+	// Rows must be called and closed for the connection to be used again.
+	rows.Close()
+
+	return nil
+}
+
+// createTableMapperSnapshots first checks whether the mapper_snapshots table exists, and
+// creates the table if it does not.
+// Any errors returned should be considered fatal.
+func createTableMapperSnapshots(dbConn *pgx.Conn) error {
+	tableName := "mapper_snapshots"
+
+	// Check if table exists
+	exists, existsErr := tableExists(dbConn, tableName)
+	if existsErr != nil {
+		return existsErr
+	}
+	if !exists {
+		// Create table
+		sqlTableCreate := `create table if not exists mapper_snapshots
+			(
+				name        text                     not null
+					constraint mapper_snapshots_pk
+						primary key,
+				description text default ''::text    not null,
+				since       timestamp with time zone,
+				until       timestamp with time zone,
+				created     timestamp with time zone not null default now()
+			);
+			
+			comment on table mapper_snapshots is 'Named copies of the mapper data, used to compare the map over time.';
+			comment on column mapper_snapshots.since is 'Start of the time window the snapshot was limited to, or null if unbounded.';
+			comment on column mapper_snapshots.until is 'End of the time window the snapshot was limited to, or null if unbounded.';`
+		if _, err := dbConn.Exec(context.Background(), sqlTableCreate); err != nil {
+			return err
+		}
+		return nil
+	}
+
+	// Validate the schema
+	sqlTableSelect := `SELECT name, description, since, until, created FROM mapper_snapshots LIMIT 1;`
+	rows, queryErr := dbConn.Query(context.Background(), sqlTableSelect)
+	if queryErr != nil {
+		return fmt.Errorf("%s table is misconfigured; please backup your data from the database and remove the table: %w", tableName, queryErr)
+	}
+	// Rows must be called and closed for the connection to be used again.
+	rows.Close()
+
+	return nil
+}
+
+// createTableMapperSnapshotEdges first checks whether the mapper_snapshot_edges table exists, and
+// creates the table if it does not.
+// Any errors returned should be considered fatal.
+func createTableMapperSnapshotEdges(dbConn *pgx.Conn) error {
+	tableName := "mapper_snapshot_edges"
+
+	// Check if table exists
+	exists, existsErr := tableExists(dbConn, tableName)
+	if existsErr != nil {
+		return existsErr
+	}
+	if !exists {
+		// Create table
+		sqlTableCreate := `create table if not exists mapper_snapshot_edges
+			(
+				snapshot           text                     not null
+					constraint mapper_snapshot_edges_snapshot_fk
+						references mapper_snapshots
+						on delete cascade,
+				referer_scheme     text                     not null,
+				referer_host       text                     not null,
+				referer_path       text                     not null,
+				destination_scheme text                     not null,
+				destination_host   text                     not null,
+				destination_path   text                     not null,
+				edge_type          text                     not null,
+				first_seen         timestamp with time zone not null,
+				last_seen          timestamp with time zone not null,
+				constraint mapper_snapshot_edges_pk
+					primary key (snapshot, referer_scheme, referer_host, referer_path, destination_scheme, destination_host, destination_path, edge_type)
+			);
+			
+			comment on table mapper_snapshot_edges is 'The mapper data (data_mapper rows) copied into each snapshot.';`
+		if _, err := dbConn.Exec(context.Background(), sqlTableCreate); err != nil {
+			return err
+		}
 		return nil
 	}
 
-	sqlTableSelect := `SELECT enabled, targets, ignored FROM config_logger LIMIT 1;`
+	// Validate the schema
+	sqlTableSelect := `SELECT snapshot, referer_scheme, referer_host, referer_path, destination_scheme, destination_host, destination_path, edge_type, first_seen, last_seen FROM mapper_snapshot_edges LIMIT 1;`
 	rows, queryErr := dbConn.Query(context.Background(), sqlTableSelect)
 	if queryErr != nil {
 		return fmt.Errorf("%s table is misconfigured; please backup your data from the database and remove the table: %w", tableName, queryErr)
@@ -618,11 +1530,11 @@ func createTableConfigLogger(dbConn *pgx.Conn) error {
 	return nil
 }
 
-// createTableDataLogger first checks whether the data_logger table exists, and
+// createTableDataJSEndpoints first checks whether the data_js_endpoints table exists, and
 // creates the table if it does not.
 // Any errors returned should be considered fatal.
-func createTableDataLogger(dbConn *pgx.Conn) error {
-	tableName := "data_logger"
+func createTableDataJSEndpoints(dbConn *pgx.Conn) error {
+	tableName := "data_js_endpoints"
 
 	// Check if table exists
 	exists, existsErr := tableExists(dbConn, tableName)
@@ -631,26 +1543,31 @@ func createTableDataLogger(dbConn *pgx.Conn) error {
 	}
 	if !exists {
 		// Create table
-		sqlTableCreate := `create table if not exists data_logger
+		sqlTableCreate := `create table if not exists data_js_endpoints
 			(
-				url_scheme           text    default ''::text     not null,
-				url_host             text                         not null,
-				url_path             text    default ''::text     not null,
-				date_found           timestamp with time zone     not null,
-				req_method           text    default ''::text     not null,
-				param_keys           text[]  default '{}'::text[] not null,
-				header_keys_req      text[]  default '{}'::text[] not null,
-				header_keys_resp     text[]  default '{}'::text[] not null,
-				cookie_keys          text[]  default '{}'::text[] not null,
-				resp_code            integer default 0            not null,
-				param_key_vals       text[]  default '{}'::text[] not null,
-				header_key_vals_req  text[]  default '{}'::text[] not null,
-				header_key_vals_resp text[]  default '{}'::text[] not null,
-				cookie_key_vals      text[]  default '{}'::text[] not null,
-				last_seen            timestamp with time zone     not null,
-				constraint data_logger_pk
-					primary key (url_scheme, url_host, url_path, req_method, resp_code)
-			);`
+				script_url  text                     not null,
+				url_scheme  text                     not null,
+				url_host    text                     not null,
+				url_path    text                     not null,
+				kind        text                     not null,
+				method      text default ''::text    not null,
+				source_file text default ''::text    not null,
+				first_seen  timestamp with time zone not null,
+				last_seen   timestamp with time zone not null,
+				constraint data_js_endpoints_pk
+					primary key (script_url, url_scheme, url_host, url_path, kind)
+			);
+			
+			comment on table data_js_endpoints is 'Endpoints referenced in JavaScript responses, which may not have been visited yet.';
+			
+			comment on column data_js_endpoints.kind is 'How the endpoint was found: "literal", "fetch", "axios", "jquery", "xhr", or "route".';
+			
+			comment on column data_js_endpoints.method is 'HTTP method of the call the endpoint was found in, if known.';
+			
+			comment on column data_js_endpoints.source_file is 'Original source file the endpoint was found in, if it was found through a source map.';
+			
+			create index if not exists data_js_endpoints_url_index
+				on data_js_endpoints (url_host, url_path);`
 		if _, err := dbConn.Exec(context.Background(), sqlTableCreate); err != nil {
 			return err
 		}
@@ -658,7 +1575,7 @@ func createTableDataLogger(dbConn *pgx.Conn) error {
 	}
 
 	// Validate the schema
-	sqlTableSelect := `SELECT url_scheme, url_host, url_path, date_found, req_method, param_keys, header_keys_req, header_keys_resp, cookie_keys, resp_code, param_key_vals, header_key_vals_req, header_key_vals_resp, cookie_key_vals, last_seen FROM data_logger LIMIT 1;`
+	sqlTableSelect := `SELECT script_url, url_scheme, url_host, url_path, kind, method, source_file, first_seen, last_seen FROM data_js_endpoints LIMIT 1;`
 	rows, queryErr := dbConn.Query(context.Background(), sqlTableSelect)
 	if queryErr != nil {
 		return fmt.Errorf("%s table is misconfigured; please backup your data from the database and remove the table: %w", tableName, queryErr)
@@ -669,12 +1586,11 @@ func createTableDataLogger(dbConn *pgx.Conn) error {
 	return nil
 }
 
-// createTableConfigMapper first checks for the existence of the config_mapper table,
-// then creates the table and populates it with default values if it does
-// not exist.
+// createTableDataJSSourceMaps first checks whether the data_js_sourcemaps table exists, and
+// creates the table if it does not.
 // Any errors returned should be considered fatal.
-func createTableConfigMapper(dbConn *pgx.Conn) error {
-	tableName := "config_mapper"
+func createTableDataJSSourceMaps(dbConn *pgx.Conn) error {
+	tableName := "data_js_sourcemaps"
 
 	// Check if table exists
 	exists, existsErr := tableExists(dbConn, tableName)
@@ -683,26 +1599,28 @@ func createTableConfigMapper(dbConn *pgx.Conn) error {
 	}
 	if !exists {
 		// Create table
-		sqlTableCreate := `create table if not exists config_mapper
+		sqlTableCreate := `create table if not exists data_js_sourcemaps
 			(
-				enabled boolean default true             not null,
-				targets uuid[]  default ARRAY []::uuid[] not null,
-				ignored uuid[]  default ARRAY []::uuid[] not null
-			);`
+				map_url    text                         not null
+					constraint data_js_sourcemaps_pk
+						primary key,
+				script_url text                         not null,
+				sources    text[]  default '{}'::text[] not null,
+				endpoints  integer default 0            not null,
+				fetched    timestamp with time zone     not null
+			);
+			
+			comment on table data_js_sourcemaps is 'Source maps fetched for JavaScript responses, and the original source files they contain.';
+			
+			comment on column data_js_sourcemaps.endpoints is 'Number of endpoints found in the original source files.';`
 		if _, err := dbConn.Exec(context.Background(), sqlTableCreate); err != nil {
 			return err
 		}
-
-		// Insert default values
-		sqlTableInsert := `INSERT INTO config_mapper default values;`
-		if _, err := dbConn.Exec(context.Background(), sqlTableInsert); err != nil {
-			return err
-		}
-
 		return nil
 	}
 
-	sqlTableSelect := `SELECT enabled, targets, ignored FROM config_mapper LIMIT 1;`
+	// Validate the schema
+	sqlTableSelect := `SELECT map_url, script_url, sources, endpoints, fetched FROM data_js_sourcemaps LIMIT 1;`
 	rows, queryErr := dbConn.Query(context.Background(), sqlTableSelect)
 	if queryErr != nil {
 		return fmt.Errorf("%s table is misconfigured; please backup your data from the database and remove the table: %w", tableName, queryErr)
@@ -713,11 +1631,11 @@ func createTableConfigMapper(dbConn *pgx.Conn) error {
 	return nil
 }
 
-// createTableDataMapper first checks whether the data_mapper table exists, and
+// createTableDataBrowserEvents first checks whether the data_browser_events table exists, and
 // creates the table if it does not.
 // Any errors returned should be considered fatal.
-func createTableDataMapper(dbConn *pgx.Conn) error {
-	tableName := "data_mapper"
+func createTableDataBrowserEvents(dbConn *pgx.Conn) error {
+	tableName := "data_browser_events"
 
 	// Check if table exists
 	exists, existsErr := tableExists(dbConn, tableName)
@@ -726,19 +1644,37 @@ func createTableDataMapper(dbConn *pgx.Conn) error {
 	}
 	if !exists {
 		// Create table
-		sqlTableCreate := `create table if not exists data_mapper
+		sqlTableCreate := `create table if not exists data_browser_events
 			(
-				referer_scheme     text default ''::text    not null,
-				referer_host       text default ''::text    not null,
-				referer_path       text default ''::text    not null,
-				destination_scheme text                     not null,
-				destination_host   text                     not null,
-				destination_path   text                     not null,
-				first_seen         timestamp with time zone not null,
-				last_seen          timestamp with time zone not null,
-				constraint data_mapper_pk
-					primary key (referer_scheme, referer_host, referer_path, destination_scheme, destination_host, destination_path)
-			);`
+				page_scheme text                     not null,
+				page_host   text                     not null,
+				page_path   text                     not null,
+				kind        text                     not null,
+				method      text default ''::text    not null,
+				url         text default ''::text    not null,
+				script      text default ''::text    not null,
+				detail      text default ''::text    not null,
+				count       bigint default 1         not null,
+				first_seen  timestamp with time zone not null,
+				last_seen   timestamp with time zone not null,
+				constraint data_browser_events_pk
+					primary key (page_scheme, page_host, page_path, kind, method, url, script, detail)
+			);
+			
+			comment on table data_browser_events is 'Client-side API calls made on target pages, recorded by the mapper instrumentation script.';
+			
+			comment on column data_browser_events.kind is 'The API called: "fetch", "xhr", "websocket", "postmessage", or "storage".';
+			
+			comment on column data_browser_events.method is 'The HTTP method of requests, or the action for other kinds, such as "SEND" or "SET".';
+			
+			comment on column data_browser_events.url is 'The URL called, the origin of the sender of a received message, or the page origin for storage writes.';
+			
+			comment on column data_browser_events.script is 'The URL of the script that made the call, or the page URL for inline scripts.';
+			
+			comment on column data_browser_events.detail is 'The storage key written, or the top-level keys of a received message.';
+			
+			create index if not exists data_browser_events_url_index
+				on data_browser_events (url);`
 		if _, err := dbConn.Exec(context.Background(), sqlTableCreate); err != nil {
 			return err
 		}
@@ -746,7 +1682,7 @@ func createTableDataMapper(dbConn *pgx.Conn) error {
 	}
 
 	// Validate the schema
-	sqlTableSelect := `SELECT referer_scheme, referer_host, referer_path, destination_scheme, destination_host, destination_path, first_seen, last_seen FROM data_mapper LIMIT 1;`
+	sqlTableSelect := `SELECT page_scheme, page_host, page_path, kind, method, url, script, detail, count, first_seen, last_seen FROM data_browser_events LIMIT 1;`
 	rows, queryErr := dbConn.Query(context.Background(), sqlTableSelect)
 	if queryErr != nil {
 		return fmt.Errorf("%s table is misconfigured; please backup your data from the database and remove the table: %w", tableName, queryErr)
@@ -844,6 +1780,123 @@ func createTableInjectorScriptURLs(dbConn *pgx.Conn) error {
 	return nil
 }
 
+// createTableInjectorRules first checks whether the injector_rules table exists, and
+// creates the table if it does not.
+// Any errors returned should be considered fatal.
+func createTableInjectorRules(dbConn *pgx.Conn) error {
+	tableName := "injector_rules"
+
+	// Check if table exists
+	exists, existsErr := tableExists(dbConn, tableName)
+	if existsErr != nil {
+		return existsErr
+	}
+	if !exists {
+		// Create table
+		sqlTableCreate := `create table if not exists injector_rules
+			(
+				id            uuid        default uuid_generate_v4() not null
+					constraint injector_rules_pk
+						primary key,
+				name          text        default ''                 not null,
+				enabled       boolean     default true               not null,
+				priority      integer     default 0                  not null,
+				type          text                                   not null,
+				content       text        default ''                 not null,
+				header_name   text        default ''                 not null,
+				header_action text        default ''                 not null,
+				targets       uuid[]      default ARRAY []::uuid[]   not null,
+				ignored       uuid[]      default ARRAY []::uuid[]   not null,
+				created       timestamptz default now()              not null
+			);
+
+			comment on table injector_rules is 'Content injected into the responses of target hosts by the injector.';
+
+			comment on column injector_rules.type is 'One of "script", "inline_script", "stylesheet", "inline_style", or "header".';
+
+			comment on column injector_rules.content is 'The script or stylesheet URL, the inline script or style body, or the header value.';
+
+			comment on column injector_rules.header_action is 'One of "add", "set", or "delete", for header rules.';
+
+			comment on column injector_rules.targets is 'An array of UUID values referencing the IDs in the "targets" table. Empty for all targets.';
+
+			comment on column injector_rules.ignored is 'An array of UUID values referencing the IDs in the "targets" table.';`
+		if _, err := dbConn.Exec(context.Background(), sqlTableCreate); err != nil {
+			return err
+		}
+		return nil
+	}
+
+	// Validate the schema
+	sqlTableSelect := `SELECT id, name, enabled, priority, type, content, header_name, header_action, targets, ignored, created FROM injector_rules LIMIT 1;`
+	rows, queryErr := dbConn.Query(context.Background(), sqlTableSelect)
+	if queryErr != nil {
+		return fmt.Errorf("%s table is misconfigured; please backup your data from the database and remove the table: %w", tableName, queryErr)
+	}
+	// Rows must be called and closed for the connection to be used again.
+	rows.Close()
+
+	return nil
+}
+
+// createTableDataInjectionCoverage first checks whether the data_injection_coverage table exists, and
+// creates the table if it does not.
+// Any errors returned should be considered fatal.
+func createTableDataInjectionCoverage(dbConn *pgx.Conn) error {
+	tableName := "data_injection_coverage"
+
+	// Check if table exists
+	exists, existsErr := tableExists(dbConn, tableName)
+	if existsErr != nil {
+		return existsErr
+	}
+	if !exists {
+		// Create table
+		sqlTableCreate := `create table if not exists data_injection_coverage
+			(
+				url_scheme text                         not null,
+				url_host   text                         not null,
+				url_path   text                         not null,
+				plugin     text                         not null,
+				status     text                         not null,
+				directives text[]  default '{}'::text[] not null,
+				policy     text    default ''::text     not null,
+				first_seen timestamp with time zone     not null,
+				last_seen  timestamp with time zone     not null,
+				constraint data_injection_coverage_pk
+					primary key (url_scheme, url_host, url_path, plugin)
+			);
+			
+			comment on table data_injection_coverage is 'Whether content injected into each page by the mapper and injector plugins is allowed by its Content-Security-Policy.';
+			
+			comment on column data_injection_coverage.plugin is 'The plugin that injected content into the page: "mapper" or "injector".';
+			
+			comment on column data_injection_coverage.status is 'One of "injected" (allowed as served), "csp_modified" (allowed by rewriting the policy), or "blocked".';
+			
+			comment on column data_injection_coverage.directives is 'The directives that were rewritten, or that block the injected content.';
+			
+			comment on column data_injection_coverage.policy is 'The enforced policies, as rewritten, joined with commas.';
+			
+			create index if not exists data_injection_coverage_status_index
+				on data_injection_coverage (status, url_host);`
+		if _, err := dbConn.Exec(context.Background(), sqlTableCreate); err != nil {
+			return err
+		}
+		return nil
+	}
+
+	// Validate the schema
+	sqlTableSelect := `SELECT url_scheme, url_host, url_path, plugin, status, directives, policy, first_seen, last_seen FROM data_injection_coverage LIMIT 1;`
+	rows, queryErr := dbConn.Query(context.Background(), sqlTableSelect)
+	if queryErr != nil {
+		return fmt.Errorf("%s table is misconfigured; please backup your data from the database and remove the table: %w", tableName, queryErr)
+	}
+	// Rows must be called and closed for the connection to be used again.
+	rows.Close()
+
+	return nil
+}
+
 // createTableDataApiHunter first checks whether the table exists, and
 // creates the table if it does not.
 // Any errors returned should be considered fatal.
@@ -868,11 +1921,17 @@ func createTableDataApiHunter(dbConn *pgx.Conn) error {
 				resp_body_json  jsonb,
 				resp_body_plain text,
 				resp_code       integer default 0        not null,
-				timestamp       timestamp with time zone not null
+				timestamp       timestamp with time zone not null,
+				grpc_service    text    default ''::text not null,
+				grpc_method     text    default ''::text not null
 			);
 			
 			comment on table data_api_hunter is 'API data observed in HTTP requests and responses.';
 			
+			comment on column data_api_hunter.grpc_service is 'Fully-qualified gRPC service name (e.g. "helloworld.Greeter"), if the request was a gRPC or gRPC-Web call.';
+			
+			comment on column data_api_hunter.grpc_method is 'gRPC method name (e.g. "SayHello"), if the request was a gRPC or gRPC-Web call.';
+			
 			create index if not exists data_api_hunter_index
 				on data_api_hunter (url_scheme, url_host, url_path, req_method, resp_code);`
 		if _, err := dbConn.Exec(context.Background(), sqlTableCreate); err != nil {
@@ -881,8 +1940,58 @@ func createTableDataApiHunter(dbConn *pgx.Conn) error {
 		return nil
 	}
 
+	// Add the gRPC columns to tables created before they existed
+	sqlTableAlter := `alter table data_api_hunter
+			add column if not exists grpc_service text default ''::text not null,
+			add column if not exists grpc_method text default ''::text not null;`
+	if _, alterErr := dbConn.Exec(context.Background(), sqlTableAlter); alterErr != nil {
+		return fmt.Errorf("unable to add gRPC columns to %s table: %w", tableName, alterErr)
+	}
+
+	// Validate the schema
+	sqlTableSelect := `SELECT url_scheme, url_scheme, url_host, url_path, req_method, req_body_json, req_body_plain, resp_body_json, resp_body_plain, resp_code, timestamp, grpc_service, grpc_method FROM data_api_hunter LIMIT 1;`
+	rows, queryErr := dbConn.Query(context.Background(), sqlTableSelect)
+	if queryErr != nil {
+		return fmt.Errorf("%s table is misconfigured; please backup your data from the database and remove the table: %w", tableName, queryErr)
+	}
+	// Rows must be called and closed for the connection to be used again.
+	rows.Close()
+
+	return nil
+}
+
+// createTableApiHunterGrpcDescriptors first checks whether the api_hunter_grpc_descriptors table exists, and
+// creates the table if it does not.
+// Any errors returned should be considered fatal.
+func createTableApiHunterGrpcDescriptors(dbConn *pgx.Conn) error {
+	tableName := "api_hunter_grpc_descriptors"
+
+	// Check if table exists
+	exists, existsErr := tableExists(dbConn, tableName)
+	if existsErr != nil {
+		return existsErr
+	}
+	if !exists {
+		// Create table
+		sqlTableCreate := `create table if not exists api_hunter_grpc_descriptors
+			(
+				id             uuid                     not null
+					constraint api_hunter_grpc_descriptors_pk
+						primary key,
+				name           text                     not null,
+				descriptor_set bytea                    not null,
+				uploaded       timestamp with time zone not null default now()
+			);
+			
+			comment on table api_hunter_grpc_descriptors is 'Protobuf FileDescriptorSet uploads, used to fully decode gRPC messages.';`
+		if _, err := dbConn.Exec(context.Background(), sqlTableCreate); err != nil {
+			return err
+		}
+		return nil
+	}
+
 	// Validate the schema
-	sqlTableSelect := `SELECT url_scheme, url_scheme, url_host, url_path, req_method, req_body_json, req_body_plain, resp_body_json, resp_body_plain, resp_code, timestamp FROM data_api_hunter LIMIT 1;`
+	sqlTableSelect := `SELECT id, name, descriptor_set, uploaded FROM api_hunter_grpc_descriptors LIMIT 1;`
 	rows, queryErr := dbConn.Query(context.Background(), sqlTableSelect)
 	if queryErr != nil {
 		return fmt.Errorf("%s table is misconfigured; please backup your data from the database and remove the table: %w", tableName, queryErr)
@@ -1718,192 +2827,136 @@ func createFunctions(dbConn *pgx.Conn) error {
 		return err
 	}
 
-	// Find host connections up to two degrees of separation from a given host.
-	sqlCreateFunctionHostConnectionsTwoDegrees := `CREATE OR REPLACE FUNCTION get_referer_destination_host_pairs_within_two_degrees(p_host TEXT)
-			RETURNS TABLE
-					(
-						referer_host          TEXT,
-						destination_host      TEXT,
-						degrees_of_separation INT
-					)
-		AS
-		$$
-		WITH RECURSIVE cte(referer_host, destination_host, depth) AS (
-			-- Base case: 1st degree hosts
-			SELECT referer_host, destination_host, 1
-			FROM data_mapper
-			WHERE referer_host = p_host
-			   OR destination_host = p_host
-		
-			UNION
-		
-			-- Recursive case: up to 3rd degree hosts
-			SELECT dm.referer_host,
-				   dm.destination_host,
-				   cte.depth + 1
-			FROM data_mapper dm
-					 JOIN cte ON (
-						cte.destination_host = dm.referer_host OR cte.destination_host = dm.destination_host OR
-						cte.referer_host = dm.referer_host OR cte.referer_host = dm.destination_host
-				)
-			WHERE cte.depth < 2)
-		SELECT DISTINCT referer_host, destination_host, depth as degrees_of_separation
-		FROM cte
-		where referer_host != ''
-		  and destination_host != ''
-		  and referer_host != destination_host;
-		$$ LANGUAGE sql;`
-	if _, err := dbConn.Exec(context.Background(), sqlCreateFunctionHostConnectionsTwoDegrees); err != nil {
-		return err
-	}
-
-	// Find host connections up to three degrees of separation from a given host.
-	sqlCreateFunctionHostConnectionsThreeDegrees := `CREATE OR REPLACE FUNCTION get_referer_destination_host_pairs_within_three_degrees(p_host TEXT)
-			RETURNS TABLE
-					(
-						referer_host          TEXT,
-						destination_host      TEXT,
-						degrees_of_separation INT
-					)
-		AS
-		$$
-		WITH RECURSIVE cte(referer_host, destination_host, depth) AS (
-			-- Base case: 1st degree hosts
-			SELECT referer_host, destination_host, 1
-			FROM data_mapper
-			WHERE referer_host = p_host
-			   OR destination_host = p_host
-		
-			UNION
-		
-			-- Recursive case: up to 3rd degree hosts
-			SELECT dm.referer_host,
-				   dm.destination_host,
-				   cte.depth + 1
-			FROM data_mapper dm
-					 JOIN cte ON (
-						cte.destination_host = dm.referer_host OR cte.destination_host = dm.destination_host OR
-						cte.referer_host = dm.referer_host OR cte.referer_host = dm.destination_host
-				)
-			WHERE cte.depth < 3)
-		SELECT DISTINCT referer_host, destination_host, depth as degrees_of_separation
-		FROM cte
-		where referer_host != ''
-		  and destination_host != ''
-		  and referer_host != destination_host;
-		$$ LANGUAGE sql;`
-	if _, err := dbConn.Exec(context.Background(), sqlCreateFunctionHostConnectionsThreeDegrees); err != nil {
+	// Remove mapper functions that have been replaced: the fixed-depth host connection functions by
+	// get_host_neighbourhood, the connected hosts functions by versions that take a time window, and
+	// get_host_neighbourhood by a version that takes a maximum number of hosts.
+	sqlDropReplacedMapperFunctions := `DROP FUNCTION IF EXISTS get_referer_destination_host_pairs_within_two_degrees(TEXT);
+		DROP FUNCTION IF EXISTS get_referer_destination_host_pairs_within_three_degrees(TEXT);
+		DROP FUNCTION IF EXISTS get_referer_destination_host_pairs_within_four_degrees(TEXT);
+		DROP FUNCTION IF EXISTS get_referer_destination_pairs_within_four_degrees(TEXT);
+		DROP FUNCTION IF EXISTS get_hosts_within_three_degrees(TEXT);
+		DROP FUNCTION IF EXISTS get_connected_hosts(TEXT[]);
+		DROP FUNCTION IF EXISTS get_paths_and_connected_hosts(TEXT[]);
+		DROP FUNCTION IF EXISTS get_host_neighbourhood(TEXT, INT, TEXT, TIMESTAMPTZ, TIMESTAMPTZ);`
+	if _, err := dbConn.Exec(context.Background(), sqlDropReplacedMapperFunctions); err != nil {
 		return err
 	}
 
-	// Find host connections up to four degrees of separation from a given host.
-	sqlCreateFunctionHostConnectionsFourDegrees := `CREATE OR REPLACE FUNCTION get_referer_destination_host_pairs_within_four_degrees(p_host TEXT)
+	// Find host connections up to the given number of degrees of separation from a given host, following connections
+	// in the given direction ('outbound', 'inbound', or 'both'). Only connections seen within the given time window
+	// are followed; null window bounds are unbounded. The hosts are reached one degree at a time, in host name order
+	// within each degree, and no more than the given maximum number of hosts (including the given host) are reached;
+	// only connections between reached hosts are returned.
+	sqlCreateFunctionHostNeighbourhood := `CREATE OR REPLACE FUNCTION get_host_neighbourhood(p_host TEXT, p_depth INT,
+																   p_direction TEXT,
+																   p_since TIMESTAMPTZ,
+																   p_until TIMESTAMPTZ,
+																   p_max_hosts INT)
 			RETURNS TABLE
 					(
 						referer_host          TEXT,
 						destination_host      TEXT,
-						degrees_of_separation INT
+						degrees_of_separation INT,
+						first_seen            TIMESTAMPTZ,
+						last_seen             TIMESTAMPTZ
 					)
 		AS
 		$$
-		WITH RECURSIVE cte(referer_host, destination_host, depth) AS (
-			-- Base case: 1st degree hosts
-			SELECT referer_host, destination_host, 1
-			FROM data_mapper
-			WHERE referer_host = p_host
-			   OR destination_host = p_host
+		WITH RECURSIVE levels(depth, frontier, reached) AS (
+			-- Base case: the given host
+			SELECT 0, ARRAY [p_host], ARRAY [p_host]
 		
-			UNION
+			UNION ALL
 		
-			-- Recursive case: up to 3rd degree hosts
-			SELECT dm.referer_host,
-				   dm.destination_host,
-				   cte.depth + 1
-			FROM data_mapper dm
-					 JOIN cte ON (
-						cte.destination_host = dm.referer_host OR cte.destination_host = dm.destination_host OR
-						cte.referer_host = dm.referer_host OR cte.referer_host = dm.destination_host
-				)
-			WHERE cte.depth < 4)
-		SELECT DISTINCT referer_host, destination_host, depth as degrees_of_separation
-		FROM cte
-		where referer_host != ''
-		  and destination_host != ''
-		  and referer_host != destination_host;
-		$$ LANGUAGE sql;`
-	if _, err := dbConn.Exec(context.Background(), sqlCreateFunctionHostConnectionsFourDegrees); err != nil {
+			-- Recursive case: the hosts connected to the previous degree in the given direction that have not been
+			-- reached yet, up to the maximum number of hosts
+			SELECT l.depth + 1, n.hosts, l.reached || n.hosts
+			FROM levels l
+					 CROSS JOIN LATERAL (
+				SELECT array_agg(c.host ORDER BY c.host) AS hosts
+				FROM (SELECT connected.host
+					  FROM (SELECT DISTINCT CASE
+												WHEN p_direction IN ('outbound', 'both') AND dm.referer_host = ANY (l.frontier)
+													THEN dm.destination_host
+												ELSE dm.referer_host END AS host
+							FROM data_mapper dm
+							WHERE ((p_direction IN ('outbound', 'both') AND dm.referer_host = ANY (l.frontier)) OR
+								   (p_direction IN ('inbound', 'both') AND dm.destination_host = ANY (l.frontier)))
+							  AND dm.referer_host != ''
+							  AND dm.destination_host != ''
+							  AND dm.referer_host != dm.destination_host
+							  AND (p_since IS NULL OR dm.last_seen >= p_since)
+							  AND (p_until IS NULL OR dm.first_seen <= p_until)) connected
+					  WHERE connected.host != ALL (l.reached)
+					  ORDER BY connected.host
+					  LIMIT p_max_hosts - cardinality(l.reached)) c) n
+			WHERE l.depth < p_depth
+			  AND cardinality(l.reached) < p_max_hosts
+			  AND n.hosts IS NOT NULL),
+		hosts AS (SELECT unnest(frontier) AS host, depth FROM levels)
+		SELECT dm.referer_host,
+			   dm.destination_host,
+			   CASE p_direction
+				   WHEN 'outbound' THEN r.depth
+				   WHEN 'inbound' THEN d.depth
+				   ELSE least(r.depth, d.depth) END + 1,
+			   min(dm.first_seen),
+			   max(dm.last_seen)
+		FROM data_mapper dm
+				 JOIN hosts r ON r.host = dm.referer_host
+				 JOIN hosts d ON d.host = dm.destination_host
+		WHERE dm.referer_host != dm.destination_host
+		  AND (p_since IS NULL OR dm.last_seen >= p_since)
+		  AND (p_until IS NULL OR dm.first_seen <= p_until)
+		  AND ((p_direction IN ('outbound', 'both') AND r.depth < p_depth) OR
+			   (p_direction IN ('inbound', 'both') AND d.depth < p_depth))
+		GROUP BY dm.referer_host, dm.destination_host, r.depth, d.depth
+		ORDER BY 3, 1, 2;
+		$$ LANGUAGE sql STABLE;`
+	if _, err := dbConn.Exec(context.Background(), sqlCreateFunctionHostNeighbourhood); err != nil {
 		return err
 	}
 
-	// Get all directly connected hosts for a given array of hosts
-	sqlCreateFunctionConnectedHosts := `CREATE OR REPLACE FUNCTION get_paths_and_connected_hosts(p_hosts TEXT[])
+	// Get all paths and directly connected hosts for a given array of hosts, seen within the given time window.
+	// Paths are only included for the given hosts; other hosts are collapsed into a single node.
+	sqlCreateFunctionPathsAndConnectedHosts := `CREATE OR REPLACE FUNCTION get_paths_and_connected_hosts(p_hosts TEXT[],
+																		  p_since TIMESTAMPTZ,
+																		  p_until TIMESTAMPTZ)
 			RETURNS TABLE
 					(
 						source      TEXT,
-						destination TEXT
+						destination TEXT,
+						first_seen  TIMESTAMPTZ,
+						last_seen   TIMESTAMPTZ
 					)
 		AS
 		$$
 		BEGIN
 			RETURN QUERY
-				SELECT DISTINCT ON (sub.source, sub.destination) sub.source, sub.destination
+				SELECT sub.source, sub.destination, min(sub.first_seen), max(sub.last_seen)
 				FROM (SELECT CASE
-								 WHEN referer_host = ANY (p_hosts)
-									 THEN referer_host || CASE WHEN referer_path = '/' THEN '' ELSE referer_path END
-								 ELSE referer_host
+								 WHEN dm.referer_host = ANY (p_hosts)
+									 THEN dm.referer_host || CASE WHEN dm.referer_path = '/' THEN '' ELSE dm.referer_path END
+								 ELSE dm.referer_host
 								 END AS source,
 							 CASE
-								 WHEN destination_host = ANY (p_hosts) THEN destination_host || CASE
-																									WHEN destination_path = '/'
-																										THEN ''
-																									ELSE destination_path END
-								 ELSE destination_host
-								 END AS destination
-					  FROM data_mapper
-					  WHERE referer_host = ANY (p_hosts)
-						 OR destination_host = ANY (p_hosts)
-						  AND referer_host != '') AS sub
+								 WHEN dm.destination_host = ANY (p_hosts)
+									 THEN dm.destination_host || CASE WHEN dm.destination_path = '/' THEN '' ELSE dm.destination_path END
+								 ELSE dm.destination_host
+								 END AS destination,
+							 dm.first_seen,
+							 dm.last_seen
+					  FROM data_mapper dm
+					  WHERE (dm.referer_host = ANY (p_hosts) OR dm.destination_host = ANY (p_hosts))
+						AND dm.referer_host != ''
+						AND dm.destination_host != ''
+						AND (p_since IS NULL OR dm.last_seen >= p_since)
+						AND (p_until IS NULL OR dm.first_seen <= p_until)) AS sub
 				WHERE sub.source != sub.destination
+				GROUP BY sub.source, sub.destination
 				ORDER BY sub.source, sub.destination;
 		END;
 		$$ LANGUAGE plpgsql;`
-	if _, err := dbConn.Exec(context.Background(), sqlCreateFunctionConnectedHosts); err != nil {
-		return err
-	}
-
-	// Get all paths and directly connected hosts for a given array of hosts
-	sqlCreateFunctionPathsAndConnectedHosts := `CREATE OR REPLACE FUNCTION get_paths_and_connected_hosts(p_hosts TEXT[])
-			RETURNS TABLE
-					(
-						source      TEXT,
-						destination TEXT
-					)
-		AS
-		$$
-		BEGIN
-			RETURN QUERY
-				-- When the given host is the referer_host
-				SELECT DISTINCT ON (source, destination) CASE
-															 WHEN referer_host = ANY (p_hosts)
-																 THEN referer_host || CASE WHEN referer_path = '/' THEN '' ELSE referer_path END
-															 ELSE referer_host
-															 END AS source,
-														 CASE
-															 WHEN destination_host = ANY (p_hosts) THEN destination_host || CASE
-																																WHEN destination_path = '/'
-																																	THEN ''
-																																ELSE destination_path END
-															 ELSE destination_host
-															 END AS destination
-				FROM data_mapper
-				WHERE referer_host = ANY (p_hosts)
-				   OR destination_host = ANY (p_hosts)
-					AND referer_host != destination_host
-					AND destination != ''
-					AND source != ''
-				ORDER BY source, destination;
-		END;
-		$$ LANGUAGE plpgsql;`
 	if _, err := dbConn.Exec(context.Background(), sqlCreateFunctionPathsAndConnectedHosts); err != nil {
 		return err
 	}
@@ -1941,35 +2994,34 @@ func createFunctions(dbConn *pgx.Conn) error {
 		return err
 	}
 
-	// Get connected hosts - one degree of separation
-	sqlCreateFunctionGetConnectedHosts := `CREATE OR REPLACE FUNCTION get_connected_hosts(p_hosts TEXT[])
+	// Get connected hosts - one degree of separation - seen within the given time window
+	sqlCreateFunctionGetConnectedHosts := `CREATE OR REPLACE FUNCTION get_connected_hosts(p_hosts TEXT[],
+															 p_since TIMESTAMPTZ,
+															 p_until TIMESTAMPTZ)
 				RETURNS TABLE
 						(
-							ref_host  TEXT,
-							dest_host TEXT
+							ref_host   TEXT,
+							dest_host  TEXT,
+							first_seen TIMESTAMPTZ,
+							last_seen  TIMESTAMPTZ
 						)
 			AS
 			$$
 			BEGIN
 				RETURN QUERY
-					(
-						-- When the given host is the referer_host
-						SELECT referer_host     AS ref_host,
-							   destination_host AS dest_host
-						FROM data_mapper
-						WHERE referer_host = ANY (p_hosts)
-						  AND destination_host <> ''
-						  AND referer_host <> destination_host)
-					UNION
-					(
-						-- When the given host is the destination_host
-						SELECT referer_host     AS ref_host,
-							   destination_host AS dest_host
-						FROM data_mapper
-						WHERE destination_host = ANY (p_hosts)
-						  AND referer_host <> ''
-						  AND referer_host <> destination_host)
-					ORDER BY ref_host, dest_host;
+					SELECT dm.referer_host     AS ref_host,
+						   dm.destination_host AS dest_host,
+						   min(dm.first_seen),
+						   max(dm.last_seen)
+					FROM data_mapper dm
+					WHERE (dm.referer_host = ANY (p_hosts) OR dm.destination_host = ANY (p_hosts))
+					  AND dm.referer_host <> ''
+					  AND dm.destination_host <> ''
+					  AND dm.referer_host <> dm.destination_host
+					  AND (p_since IS NULL OR dm.last_seen >= p_since)
+					  AND (p_until IS NULL OR dm.first_seen <= p_until)
+					GROUP BY dm.referer_host, dm.destination_host
+					ORDER BY 1, 2;
 			END;
 			$$ LANGUAGE plpgsql;`
 	if _, err := dbConn.Exec(context.Background(), sqlCreateFunctionGetConnectedHosts); err != nil {
@@ -2021,6 +3073,48 @@ func createTriggers(dbConn *pgx.Conn) error {
 		return err
 	}
 
+	// Rule contents can be larger than a notification payload, so only the rule ID is sent
+	sqlCreateTriggerInjectorRules := `CREATE OR REPLACE FUNCTION notify_change_on_injector_rules()
+			RETURNS TRIGGER AS
+		$$
+		BEGIN
+			IF TG_OP = 'DELETE' THEN
+				PERFORM pg_notify('injector_rules_channel', 'DELETE,' || OLD.id::text);
+				RETURN OLD;
+			END IF;
+
+			PERFORM pg_notify('injector_rules_channel', 'UPDATE,' || NEW.id::text);
+			RETURN NEW;
+		END;
+		$$ LANGUAGE plpgsql;
+
+		CREATE OR REPLACE TRIGGER injector_rules_trigger
+			AFTER INSERT OR UPDATE OR DELETE
+			ON injector_rules
+			FOR EACH ROW
+		EXECUTE FUNCTION notify_change_on_injector_rules();`
+	if _, err := dbConn.Exec(context.Background(), sqlCreateTriggerInjectorRules); err != nil {
+		return err
+	}
+
+	sqlCreateTriggerConfigInjector := `CREATE OR REPLACE FUNCTION notify_change_on_config_injector()
+			RETURNS TRIGGER AS
+		$$
+		BEGIN
+			PERFORM pg_notify('injector_config_channel', 'UPDATE');
+			RETURN NEW;
+		END;
+		$$ LANGUAGE plpgsql;
+
+		CREATE OR REPLACE TRIGGER config_injector_trigger
+			AFTER UPDATE
+			ON config_injector
+			FOR EACH ROW
+		EXECUTE FUNCTION notify_change_on_config_injector();`
+	if _, err := dbConn.Exec(context.Background(), sqlCreateTriggerConfigInjector); err != nil {
+		return err
+	}
+
 	sqlCreateTriggerTargets := `CREATE OR REPLACE FUNCTION notify_change_on_targets()
 			RETURNS TRIGGER AS
 		$$
@@ -11,6 +11,7 @@ type Gexf struct {
 	XMLName   xml.Name `xml:"gexf"`
 	Xmlns     string   `xml:"xmlns,attr"`
 	Xsi       string   `xml:"xmlns:xsi,attr"`
+	Viz       string   `xml:"xmlns:viz,attr"`
 	SchemaLoc string   `xml:"xsi:schemaLocation,attr"`
 	Version   string   `xml:"version,attr"`
 	Meta      Meta
@@ -26,12 +27,13 @@ type Meta struct {
 }
 
 type Graph struct {
-	XMLName    xml.Name `xml:"graph"`
-	Mode       string   `xml:"mode,attr"`
-	TimeFormat string   `xml:"timeformat,attr,omitempty"`
-	Attributes Attributes
-	Nodes      Nodes
-	Edges      Edges
+	XMLName         xml.Name     `xml:"graph"`
+	Mode            string       `xml:"mode,attr"`
+	TimeFormat      string       `xml:"timeformat,attr,omitempty"`
+	DefaultEdgeType string       `xml:"defaultedgetype,attr,omitempty"`
+	Attributes      []Attributes `xml:"attributes"`
+	Nodes           Nodes
+	Edges           Edges
 }
 
 type Attributes struct {
@@ -45,21 +47,23 @@ type Attribute struct {
 	Id      string   `xml:"id,attr"`
 	Title   string   `xml:"title,attr"`
 	Type    string   `xml:"type,attr"`
+	Default string   `xml:"default,omitempty"`
 }
 
 type Nodes struct {
 	XMLName xml.Name `xml:"nodes"`
+	Count   int      `xml:"count,attr"`
 	Nodes   []Node   `xml:"node"`
 }
 
 type Node struct {
-	XMLName   xml.Name  `xml:"node"`
-	Id        string    `xml:"id,attr"`
-	Pid       string    `xml:"pid,attr,omitempty"`
-	Label     string    `xml:"label,attr"`
-	Start     string    `xml:"start,attr,omitempty"`
-	End       string    `xml:"end,attr,omitempty"`
-	Attvalues Attvalues `xml:"attvalues"`
+	XMLName   xml.Name   `xml:"node"`
+	Id        string     `xml:"id,attr"`
+	Pid       string     `xml:"pid,attr,omitempty"`
+	Label     string     `xml:"label,attr"`
+	Start     string     `xml:"start,attr,omitempty"`
+	End       string     `xml:"end,attr,omitempty"`
+	Attvalues *Attvalues `xml:"attvalues,omitempty"`
 }
 
 type Attvalues struct {
@@ -75,6 +79,7 @@ type Attvalue struct {
 
 type Edges struct {
 	XMLName xml.Name `xml:"edges"`
+	Count   int      `xml:"count,attr"`
 	Edges   []Edge   `xml:"edge"`
 }
 
@@ -85,12 +90,24 @@ type Edge struct {
 	Target  string   `xml:"target,attr"`
 	Start   string   `xml:"start,attr,omitempty"`
 	End     string   `xml:"end,attr,omitempty"`
+
+	Attvalues *Attvalues `xml:"attvalues,omitempty"`
+	Color     *Color     `xml:"viz:color,omitempty"`
+}
+
+// Color is the display color of a node or edge, from the GEXF viz module.
+type Color struct {
+	R uint8 `xml:"r,attr"`
+	G uint8 `xml:"g,attr"`
+	B uint8 `xml:"b,attr"`
 }
 
+// CreateXML fills out the default header and metadata values, and writes the Gexf struct as XML to the given writer.
 func (g *Gexf) CreateXML(w io.Writer, description, keywords string) error {
 	// Fill out the Gexf struct with default values
 	g.Xmlns = "http://gexf.net/1.3"
 	g.Xsi = "http://www.w3.org/2001/XMLSchema-instance"
+	g.Viz = "http://gexf.net/1.3/viz"
 	g.SchemaLoc = "http://gexf.net/1.3 http://gexf.net/1.3/gexf.xsd"
 	g.Version = "1.3"
 
@@ -106,7 +123,7 @@ func (g *Gexf) CreateXML(w io.Writer, description, keywords string) error {
 	e := xml.NewEncoder(w)
 
 	// Start with the XML processing instructions
-	if err := e.EncodeToken(xml.ProcInst{"xml", []byte(`version="1.0" encoding="UTF-8"`)}); err != nil {
+	if err := e.EncodeToken(xml.ProcInst{Target: "xml", Inst: []byte(`version="1.0" encoding="UTF-8"`)}); err != nil {
 		return fmt.Errorf("unable to encode XML processing instructions: %w", err)
 	}
 
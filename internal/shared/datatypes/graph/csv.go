@@ -0,0 +1,63 @@
+package graph
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+)
+
+// csvSerializer writes graphs as a CSV edge list, with one column for each declared edge attribute, and first_seen and
+// last_seen columns if the graph has time spells.
+// Nodes without any edges are not included.
+type csvSerializer struct{}
+
+// Format conforms to the Serializer interface.
+func (csvSerializer) Format() string { return FormatCSV }
+
+// ContentType conforms to the Serializer interface.
+func (csvSerializer) ContentType() string { return "text/csv" }
+
+// Extension conforms to the Serializer interface.
+func (csvSerializer) Extension() string { return "csv" }
+
+// Serialize conforms to the Serializer interface.
+func (csvSerializer) Serialize(w io.Writer, g *Graph) error {
+	cw := csv.NewWriter(w)
+
+	dynamic := g.Dynamic()
+	header := []string{"source", "target"}
+	for _, def := range g.EdgeAttributes {
+		header = append(header, def.Key)
+	}
+	if dynamic {
+		header = append(header, "first_seen", "last_seen")
+	}
+	if err := cw.Write(header); err != nil {
+		return fmt.Errorf("unable to write CSV header: %w", err)
+	}
+
+	for _, edge := range g.Edges() {
+		record := []string{edge.Source, edge.Target}
+		for _, def := range g.EdgeAttributes {
+			value, ok := attributeValue(edge.Attributes, def)
+			if !ok {
+				record = append(record, "")
+				continue
+			}
+			record = append(record, formatValue(value))
+		}
+		if dynamic {
+			record = append(record, formatTime(edge.Start), formatTime(edge.End))
+		}
+		if err := cw.Write(record); err != nil {
+			return fmt.Errorf("unable to write CSV record: %w", err)
+		}
+	}
+
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("unable to write CSV edge list: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package graph
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// dotSerializer writes graphs in the Graphviz DOT language.
+type dotSerializer struct{}
+
+// Format conforms to the Serializer interface.
+func (dotSerializer) Format() string { return FormatDOT }
+
+// ContentType conforms to the Serializer interface.
+func (dotSerializer) ContentType() string { return "text/vnd.graphviz" }
+
+// Extension conforms to the Serializer interface.
+func (dotSerializer) Extension() string { return "dot" }
+
+// dotEscaper escapes characters that are not allowed in quoted DOT identifiers.
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", "")
+
+// Serialize conforms to the Serializer interface.
+func (dotSerializer) Serialize(w io.Writer, g *Graph) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintf(bw, "digraph %s {\n", dotID(g.Description))
+	for _, node := range g.Nodes() {
+		fmt.Fprintf(bw, "  %s [%s];\n", dotID(node.ID), dotAttributes(node.Label, node.Attributes, g.NodeAttributes))
+	}
+	for _, edge := range g.Edges() {
+		fmt.Fprintf(bw, "  %s -> %s", dotID(edge.Source), dotID(edge.Target))
+		attributes := dotAttributes("", edge.Attributes, g.EdgeAttributes)
+		if edge.Color != "" {
+			attributes = strings.TrimPrefix(attributes+", color="+dotID(edge.Color), ", ")
+		}
+		if attributes != "" {
+			fmt.Fprintf(bw, " [%s]", attributes)
+		}
+		bw.WriteString(";\n")
+	}
+	bw.WriteString("}\n")
+
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("unable to write DOT graph: %w", err)
+	}
+
+	return nil
+}
+
+// dotID returns the given string as a quoted DOT identifier.
+func dotID(s string) string {
+	return `"` + dotEscaper.Replace(s) + `"`
+}
+
+// dotAttributes returns the DOT attribute list for a node or edge, including the label if it is not empty.
+func dotAttributes(label string, values map[string]interface{}, defs []AttributeDef) string {
+	var attributes []string
+	if label != "" {
+		attributes = append(attributes, "label="+dotID(label))
+	}
+	for _, def := range defs {
+		if value, ok := attributeValue(values, def); ok {
+			attributes = append(attributes, dotID(def.Key)+"="+dotID(formatValue(value)))
+		}
+	}
+
+	return strings.Join(attributes, ", ")
+}
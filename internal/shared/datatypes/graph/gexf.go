@@ -0,0 +1,120 @@
+package graph
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/TheHackerDev/cartograph/internal/shared/datatypes/gexf"
+)
+
+// gexfSerializer writes graphs in the GEXF 1.3 format, used by Gephi.
+type gexfSerializer struct{}
+
+// Format conforms to the Serializer interface.
+func (gexfSerializer) Format() string { return FormatGEXF }
+
+// ContentType conforms to the Serializer interface.
+func (gexfSerializer) ContentType() string { return "application/gexf+xml" }
+
+// Extension conforms to the Serializer interface.
+func (gexfSerializer) Extension() string { return "gexf" }
+
+// Serialize conforms to the Serializer interface.
+func (gexfSerializer) Serialize(w io.Writer, g *Graph) error {
+	nodes := g.Nodes()
+	edges := g.Edges()
+
+	doc := gexf.Gexf{
+		Graph: gexf.Graph{
+			Mode:            "static",
+			DefaultEdgeType: "directed",
+			Nodes:           gexf.Nodes{Count: len(nodes), Nodes: make([]gexf.Node, 0, len(nodes))},
+			Edges:           gexf.Edges{Count: len(edges), Edges: make([]gexf.Edge, 0, len(edges))},
+		},
+	}
+
+	// Use a dynamic graph if there are time spells, so that they can be replayed on a timeline
+	if g.Dynamic() {
+		doc.Graph.Mode = "dynamic"
+		doc.Graph.TimeFormat = "dateTime"
+	}
+
+	// Declare the attribute classes
+	if len(g.NodeAttributes) > 0 {
+		doc.Graph.Attributes = append(doc.Graph.Attributes, gexfAttributes("node", g.NodeAttributes))
+	}
+	if len(g.EdgeAttributes) > 0 {
+		doc.Graph.Attributes = append(doc.Graph.Attributes, gexfAttributes("edge", g.EdgeAttributes))
+	}
+
+	for _, node := range nodes {
+		doc.Graph.Nodes.Nodes = append(doc.Graph.Nodes.Nodes, gexf.Node{
+			Id:        node.ID,
+			Label:     node.Label,
+			Start:     formatTime(node.Start),
+			End:       formatTime(node.End),
+			Attvalues: gexfAttvalues(node.Attributes, g.NodeAttributes),
+		})
+	}
+	for _, edge := range edges {
+		doc.Graph.Edges.Edges = append(doc.Graph.Edges.Edges, gexf.Edge{
+			Id:        edge.Source + "-" + edge.Target,
+			Source:    edge.Source,
+			Target:    edge.Target,
+			Start:     formatTime(edge.Start),
+			End:       formatTime(edge.End),
+			Attvalues: gexfAttvalues(edge.Attributes, g.EdgeAttributes),
+			Color:     gexfColor(edge.Color),
+		})
+	}
+
+	if err := doc.CreateXML(w, g.Description, g.Keywords); err != nil {
+		return fmt.Errorf("unable to write GEXF document: %w", err)
+	}
+
+	return nil
+}
+
+// gexfAttributes returns the GEXF attribute declarations for the given class ("node" or "edge").
+func gexfAttributes(class string, defs []AttributeDef) gexf.Attributes {
+	attributes := gexf.Attributes{Class: class}
+	for _, def := range defs {
+		attribute := gexf.Attribute{
+			Id:    def.Key,
+			Title: def.Title,
+			Type:  def.Type,
+		}
+		if def.Default != nil {
+			attribute.Default = formatValue(def.Default)
+		}
+		attributes.Attributes = append(attributes.Attributes, attribute)
+	}
+
+	return attributes
+}
+
+// gexfAttvalues returns the GEXF attribute values for a node or edge, or nil if it has none.
+// Unset values are left out, so that readers use the declared default.
+func gexfAttvalues(values map[string]interface{}, defs []AttributeDef) *gexf.Attvalues {
+	var attvalues []gexf.Attvalue
+	for _, def := range defs {
+		if value, ok := values[def.Key]; ok && value != nil {
+			attvalues = append(attvalues, gexf.Attvalue{For: def.Key, Value: formatValue(value)})
+		}
+	}
+	if len(attvalues) == 0 {
+		return nil
+	}
+
+	return &gexf.Attvalues{Attvalues: attvalues}
+}
+
+// gexfColor returns the GEXF color for the given "#rrggbb" hex string, or nil if it is empty or invalid.
+func gexfColor(color string) *gexf.Color {
+	var c gexf.Color
+	if _, err := fmt.Sscanf(color, "#%02x%02x%02x", &c.R, &c.G, &c.B); err != nil {
+		return nil
+	}
+
+	return &c
+}
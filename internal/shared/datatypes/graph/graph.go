@@ -0,0 +1,335 @@
+package graph
+
+import (
+	"sync"
+	"time"
+)
+
+// Attribute types, used when declaring node and edge attributes.
+const (
+	AttributeString  string = "string"
+	AttributeInteger string = "integer"
+	AttributeDouble  string = "double"
+	AttributeBoolean string = "boolean"
+)
+
+// NewGraph returns a new, empty directed graph with the given description and keywords, which are included in the
+// metadata of formats that support it.
+func NewGraph(description string, keywords string) *Graph {
+	return &Graph{
+		Description: description,
+		Keywords:    keywords,
+		nodeIndex:   make(map[string]int),
+		edgeIndex:   make(map[[2]string]int),
+	}
+}
+
+// Graph is a format-agnostic directed graph, which can be written in any of the supported formats using a
+// Serializer. Nodes and edges are kept in the order they were added.
+// A Graph should always be created via the NewGraph function.
+type Graph struct {
+	mu sync.RWMutex
+
+	// Description and Keywords describe the graph.
+	Description string
+	Keywords    string
+
+	// dynamic is true if any node or edge has a time spell.
+	dynamic bool
+
+	// NodeAttributes and EdgeAttributes declare the attributes that nodes and edges may have.
+	NodeAttributes []AttributeDef
+	EdgeAttributes []AttributeDef
+
+	nodes     []*Node
+	nodeIndex map[string]int
+	edges     []*Edge
+	edgeIndex map[[2]string]int
+}
+
+// AttributeDef declares an attribute that nodes or edges may have.
+type AttributeDef struct {
+	// Key identifies the attribute.
+	Key string
+
+	// Title is the human-readable name of the attribute.
+	Title string
+
+	// Type is one of the Attribute type constants.
+	Type string
+
+	// Default is the value used for nodes or edges that do not have the attribute set. A nil default means the
+	// attribute is omitted for those nodes or edges.
+	Default interface{}
+}
+
+// Node is a single node in a graph.
+type Node struct {
+	// ID uniquely identifies the node.
+	ID string
+
+	// Label is the display name of the node.
+	Label string
+
+	// Attributes holds the node's attribute values, by attribute key.
+	Attributes map[string]interface{}
+
+	// Start and End are the times the node was first and last seen. Zero values mean the node has no time spell.
+	Start time.Time
+	End   time.Time
+}
+
+// Edge is a single directed edge in a graph.
+type Edge struct {
+	// Source and Target are the IDs of the nodes the edge connects.
+	Source string
+	Target string
+
+	// Attributes holds the edge's attribute values, by attribute key.
+	Attributes map[string]interface{}
+
+	// Color is the display color of the edge, as a "#rrggbb" hex string, or empty for the viewer's default.
+	Color string
+
+	// Start and End are the times the edge was first and last seen. Zero values mean the edge has no time spell.
+	Start time.Time
+	End   time.Time
+}
+
+// DeclareNodeAttribute declares an attribute that nodes may have.
+func (g *Graph) DeclareNodeAttribute(def AttributeDef) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.NodeAttributes = append(g.NodeAttributes, def)
+}
+
+// DeclareEdgeAttribute declares an attribute that edges may have.
+func (g *Graph) DeclareEdgeAttribute(def AttributeDef) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.EdgeAttributes = append(g.EdgeAttributes, def)
+}
+
+// AddNode adds a node with the given ID to the graph, using the ID as its label, and returns it.
+// If the node already exists, the existing node is returned. Empty IDs are ignored, and return nil.
+func (g *Graph) AddNode(id string) *Node {
+	if id == "" {
+		return nil
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.addNode(id)
+}
+
+// addNode adds a node to the graph. The caller must hold the lock.
+func (g *Graph) addNode(id string) *Node {
+	if i, ok := g.nodeIndex[id]; ok {
+		return g.nodes[i]
+	}
+
+	node := &Node{
+		ID:         id,
+		Label:      id,
+		Attributes: make(map[string]interface{}),
+	}
+	g.nodeIndex[id] = len(g.nodes)
+	g.nodes = append(g.nodes, node)
+
+	return node
+}
+
+// SetNodeAttribute sets the value of an attribute on the node with the given ID, adding the node if it does not
+// exist. Empty IDs are ignored.
+func (g *Graph) SetNodeAttribute(id string, key string, value interface{}) {
+	if id == "" {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.addNode(id).Attributes[key] = value
+}
+
+// AddEdge adds a directed edge between the nodes with the given IDs, adding the nodes if they do not exist, and
+// returns it. If the edge already exists, the existing edge is returned. Edges with an empty source or target are
+// ignored, and return nil.
+func (g *Graph) AddEdge(source string, target string) *Edge {
+	if source == "" || target == "" {
+		return nil
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.addNode(source)
+	g.addNode(target)
+
+	key := [2]string{source, target}
+	if i, ok := g.edgeIndex[key]; ok {
+		return g.edges[i]
+	}
+
+	edge := &Edge{
+		Source:     source,
+		Target:     target,
+		Attributes: make(map[string]interface{}),
+	}
+	g.edgeIndex[key] = len(g.edges)
+	g.edges = append(g.edges, edge)
+
+	return edge
+}
+
+// AddEdgeSpell adds a directed edge between the nodes with the given IDs, like AddEdge, and widens the time spells of
+// the edge and both nodes to include the given first and last seen times. It returns the edge, or nil if either ID is
+// empty.
+func (g *Graph) AddEdgeSpell(source string, target string, start time.Time, end time.Time) *Edge {
+	edge := g.AddEdge(source, target)
+	if edge == nil {
+		return nil
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.dynamic = true
+	WidenSpell(&edge.Start, &edge.End, start, end)
+	WidenSpell(&g.nodes[g.nodeIndex[source]].Start, &g.nodes[g.nodeIndex[source]].End, start, end)
+	WidenSpell(&g.nodes[g.nodeIndex[target]].Start, &g.nodes[g.nodeIndex[target]].End, start, end)
+
+	return edge
+}
+
+// WidenSpell widens the spell between spellStart and spellEnd to include the given start and end times.
+func WidenSpell(spellStart *time.Time, spellEnd *time.Time, start time.Time, end time.Time) {
+	if !start.IsZero() && (spellStart.IsZero() || start.Before(*spellStart)) {
+		*spellStart = start
+	}
+	if !end.IsZero() && (spellEnd.IsZero() || end.After(*spellEnd)) {
+		*spellEnd = end
+	}
+}
+
+// Dynamic returns true if any node or edge in the graph has a time spell.
+func (g *Graph) Dynamic() bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	return g.dynamic
+}
+
+// SetEdgeAttribute sets the value of an attribute on the edge between the nodes with the given IDs. Edges that do not
+// exist are ignored.
+func (g *Graph) SetEdgeAttribute(source string, target string, key string, value interface{}) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if i, ok := g.edgeIndex[[2]string{source, target}]; ok {
+		g.edges[i].Attributes[key] = value
+	}
+}
+
+// SetEdgeColor sets the display color ("#rrggbb") of the edge between the nodes with the given IDs. Edges that do not
+// exist are ignored.
+func (g *Graph) SetEdgeColor(source string, target string, color string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if i, ok := g.edgeIndex[[2]string{source, target}]; ok {
+		g.edges[i].Color = color
+	}
+}
+
+// Group returns a new graph in which the nodes of this graph are merged by the given key function, such as rolling
+// hosts up to their registrable domains. Edges between merged nodes are merged, and edges within a merged node are
+// dropped. Merged nodes and edges keep the attribute values of the first node or edge merged into them, and time
+// spells are widened to cover all of them. Nodes with an empty key are dropped.
+func (g *Graph) Group(key func(id string) string) *Graph {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	grouped := NewGraph(g.Description, g.Keywords)
+	grouped.NodeAttributes = append([]AttributeDef(nil), g.NodeAttributes...)
+	grouped.EdgeAttributes = append([]AttributeDef(nil), g.EdgeAttributes...)
+	grouped.dynamic = g.dynamic
+
+	groups := make(map[string]string, len(g.nodes))
+	for _, node := range g.nodes {
+		groupID := key(node.ID)
+		if groupID == "" {
+			continue
+		}
+		groups[node.ID] = groupID
+
+		groupNode := grouped.addNode(groupID)
+		for k, v := range node.Attributes {
+			if _, ok := groupNode.Attributes[k]; !ok {
+				groupNode.Attributes[k] = v
+			}
+		}
+		WidenSpell(&groupNode.Start, &groupNode.End, node.Start, node.End)
+	}
+
+	for _, edge := range g.edges {
+		source, target := groups[edge.Source], groups[edge.Target]
+		if source == "" || target == "" || source == target {
+			continue
+		}
+
+		edgeKey := [2]string{source, target}
+		i, exists := grouped.edgeIndex[edgeKey]
+		if !exists {
+			i = len(grouped.edges)
+			grouped.edgeIndex[edgeKey] = i
+			grouped.edges = append(grouped.edges, &Edge{
+				Source:     source,
+				Target:     target,
+				Attributes: make(map[string]interface{}, len(edge.Attributes)),
+				Color:      edge.Color,
+			})
+		}
+		groupEdge := grouped.edges[i]
+		for k, v := range edge.Attributes {
+			if _, ok := groupEdge.Attributes[k]; !ok {
+				groupEdge.Attributes[k] = v
+			}
+		}
+		WidenSpell(&groupEdge.Start, &groupEdge.End, edge.Start, edge.End)
+	}
+
+	return grouped
+}
+
+// Nodes returns all nodes in the graph, in the order they were added.
+func (g *Graph) Nodes() []*Node {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	return append([]*Node(nil), g.nodes...)
+}
+
+// Edges returns all edges in the graph, in the order they were added.
+func (g *Graph) Edges() []*Edge {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	return append([]*Edge(nil), g.edges...)
+}
+
+// attributeValue returns the value of the given attribute from the given values, or the attribute's default if it
+// is not set. The second return value is false if there is no value or default.
+func attributeValue(values map[string]interface{}, def AttributeDef) (interface{}, bool) {
+	if value, ok := values[def.Key]; ok && value != nil {
+		return value, true
+	}
+	if def.Default != nil {
+		return def.Default, true
+	}
+
+	return nil, false
+}
@@ -0,0 +1,124 @@
+package graph
+
+import (
+	"bytes"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSerializerForRequest(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		accept string
+		want   string
+	}{
+		{name: "default", target: "/", want: FormatGEXF},
+		{name: "any type", target: "/", accept: "*/*", want: FormatGEXF},
+		{name: "query parameter", target: "/?format=dot", accept: "text/csv", want: FormatDOT},
+		{name: "accept header", target: "/", accept: "application/graphml+xml", want: FormatGraphML},
+		{name: "quality values", target: "/", accept: "text/csv;q=0.5, application/vnd.cytoscape+json", want: FormatCytoscape},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", tt.target, nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			serializer, err := SerializerForRequest(r, FormatGEXF)
+			if err != nil {
+				t.Fatalf("SerializerForRequest() returned error: %s", err)
+			}
+			if serializer.Format() != tt.want {
+				t.Errorf("format = %q, want %q", serializer.Format(), tt.want)
+			}
+		})
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept", "image/png")
+	if _, err := SerializerForRequest(r, FormatGEXF); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("SerializerForRequest() error = %v, want ErrUnsupportedFormat", err)
+	}
+}
+
+func TestSerializers(t *testing.T) {
+	g := NewGraph("test", "test")
+	g.DeclareNodeAttribute(AttributeDef{Key: "classification", Title: "Classification", Type: AttributeInteger, Default: -1})
+	g.AddEdge("a.example.com", `b"quoted".example.com`)
+	g.AddEdge("a.example.com", "")
+	g.SetNodeAttribute("a.example.com", "classification", 3)
+
+	want := map[string]string{
+		FormatGEXF:      `<attvalue for="classification" value="3"></attvalue>`,
+		FormatGraphML:   `<data key="node_classification">3</data>`,
+		FormatDOT:       `"a.example.com" -> "b\"quoted\".example.com";`,
+		FormatCytoscape: `"classification":-1`,
+		FormatD3:        `"source":"a.example.com"`,
+		FormatCSV:       "a.example.com,\"b\"\"quoted\"\".example.com\"\n",
+	}
+	for format, substr := range want {
+		serializer, err := SerializerForFormat(format)
+		if err != nil {
+			t.Fatalf("SerializerForFormat(%q) returned error: %s", format, err)
+		}
+		buf := new(bytes.Buffer)
+		if err := serializer.Serialize(buf, g); err != nil {
+			t.Fatalf("%s: Serialize() returned error: %s", format, err)
+		}
+		if !strings.Contains(buf.String(), substr) {
+			t.Errorf("%s output does not contain %q:\n%s", format, substr, buf.String())
+		}
+	}
+}
+
+func TestDynamicGEXF(t *testing.T) {
+	g := NewGraph("test", "test")
+	first := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	last := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	g.AddEdgeSpell("a", "b", first, first)
+	g.AddEdgeSpell("a", "b", last, last)
+
+	buf := new(bytes.Buffer)
+	if err := (gexfSerializer{}).Serialize(buf, g); err != nil {
+		t.Fatalf("Serialize() returned error: %s", err)
+	}
+	for _, substr := range []string{
+		`mode="dynamic"`,
+		`timeformat="dateTime"`,
+		`<edge id="a-b" source="a" target="b" start="2024-01-01T00:00:00Z" end="2024-02-01T00:00:00Z">`,
+	} {
+		if !strings.Contains(buf.String(), substr) {
+			t.Errorf("GEXF output does not contain %q:\n%s", substr, buf.String())
+		}
+	}
+}
+
+func TestGroup(t *testing.T) {
+	g := NewGraph("test", "test")
+	g.AddEdge("www.example.com", "cdn.example.com")
+	g.AddEdge("www.example.com", "tracker.example.net")
+	g.AddEdge("cdn.example.com", "static.example.net")
+	g.SetEdgeColor("www.example.com", "tracker.example.net", "#e91e63")
+
+	grouped := g.Group(func(id string) string {
+		return id[strings.Index(id, ".")+1:]
+	})
+
+	if nodes := grouped.Nodes(); len(nodes) != 2 {
+		t.Fatalf("got %d nodes, want 2", len(nodes))
+	}
+	edges := grouped.Edges()
+	if len(edges) != 1 {
+		t.Fatalf("got %d edges, want 1", len(edges))
+	}
+	if edges[0].Source != "example.com" || edges[0].Target != "example.net" {
+		t.Errorf("edge = %s -> %s, want example.com -> example.net", edges[0].Source, edges[0].Target)
+	}
+	if edges[0].Color != "#e91e63" {
+		t.Errorf("edge color = %q, want %q", edges[0].Color, "#e91e63")
+	}
+}
@@ -0,0 +1,207 @@
+package graph
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+)
+
+// graphmlSerializer writes graphs in the GraphML format, used by yEd, NetworkX, and igraph.
+type graphmlSerializer struct{}
+
+// Format conforms to the Serializer interface.
+func (graphmlSerializer) Format() string { return FormatGraphML }
+
+// ContentType conforms to the Serializer interface.
+func (graphmlSerializer) ContentType() string { return "application/graphml+xml" }
+
+// Extension conforms to the Serializer interface.
+func (graphmlSerializer) Extension() string { return "graphml" }
+
+type graphml struct {
+	XMLName   xml.Name     `xml:"graphml"`
+	Xmlns     string       `xml:"xmlns,attr"`
+	Xsi       string       `xml:"xmlns:xsi,attr"`
+	SchemaLoc string       `xml:"xsi:schemaLocation,attr"`
+	Keys      []graphmlKey `xml:"key"`
+	Graph     graphmlGraph `xml:"graph"`
+}
+
+type graphmlKey struct {
+	Id      string  `xml:"id,attr"`
+	For     string  `xml:"for,attr"`
+	Name    string  `xml:"attr.name,attr"`
+	Type    string  `xml:"attr.type,attr"`
+	Desc    string  `xml:"desc,omitempty"`
+	Default *string `xml:"default,omitempty"`
+}
+
+type graphmlGraph struct {
+	Id          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Desc        string        `xml:"desc,omitempty"`
+	Nodes       []graphmlNode `xml:"node"`
+	Edges       []graphmlEdge `xml:"edge"`
+}
+
+type graphmlNode struct {
+	Id   string        `xml:"id,attr"`
+	Data []graphmlData `xml:"data"`
+}
+
+type graphmlEdge struct {
+	Id     string        `xml:"id,attr"`
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphmlData `xml:"data"`
+}
+
+type graphmlData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// graphmlTypes maps attribute types to GraphML attribute types.
+var graphmlTypes = map[string]string{
+	AttributeString:  "string",
+	AttributeInteger: "long",
+	AttributeDouble:  "double",
+	AttributeBoolean: "boolean",
+}
+
+// Serialize conforms to the Serializer interface.
+func (graphmlSerializer) Serialize(w io.Writer, g *Graph) error {
+	nodes := g.Nodes()
+	edges := g.Edges()
+
+	doc := graphml{
+		Xmlns:     "http://graphml.graphdrawing.org/xmlns",
+		Xsi:       "http://www.w3.org/2001/XMLSchema-instance",
+		SchemaLoc: "http://graphml.graphdrawing.org/xmlns http://graphml.graphdrawing.org/xmlns/1.0/graphml.xsd",
+		Keys: []graphmlKey{
+			{Id: "label", For: "node", Name: "label", Type: "string"},
+		},
+		Graph: graphmlGraph{
+			Id:          "G",
+			EdgeDefault: "directed",
+			Desc:        g.Description,
+			Nodes:       make([]graphmlNode, 0, len(nodes)),
+			Edges:       make([]graphmlEdge, 0, len(edges)),
+		},
+	}
+
+	// Declare the attribute keys, prefixed by their class to keep node and edge keys distinct
+	doc.Keys = append(doc.Keys, graphmlKeys("node", g.NodeAttributes)...)
+	doc.Keys = append(doc.Keys, graphmlKeys("edge", g.EdgeAttributes)...)
+
+	// Declare the edge color key, if there are any colors
+	colored := false
+	for _, edge := range edges {
+		if edge.Color != "" {
+			colored = true
+			break
+		}
+	}
+	if colored {
+		doc.Keys = append(doc.Keys, graphmlKey{Id: "edge_color", For: "edge", Name: "color", Type: "string"})
+	}
+
+	// Declare the time spell keys, if there are any
+	dynamic := g.Dynamic()
+	if dynamic {
+		for _, class := range []string{"node", "edge"} {
+			doc.Keys = append(doc.Keys,
+				graphmlKey{Id: class + "_start", For: class, Name: "start", Type: "string", Desc: "First seen"},
+				graphmlKey{Id: class + "_end", For: class, Name: "end", Type: "string", Desc: "Last seen"},
+			)
+		}
+	}
+
+	for _, node := range nodes {
+		data := []graphmlData{{Key: "label", Value: node.Label}}
+		data = append(data, graphmlValues("node", node.Attributes, g.NodeAttributes)...)
+		if dynamic {
+			data = append(data, graphmlSpell("node", node.Start, node.End)...)
+		}
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphmlNode{
+			Id:   node.ID,
+			Data: data,
+		})
+	}
+	for _, edge := range edges {
+		data := graphmlValues("edge", edge.Attributes, g.EdgeAttributes)
+		if edge.Color != "" {
+			data = append(data, graphmlData{Key: "edge_color", Value: edge.Color})
+		}
+		if dynamic {
+			data = append(data, graphmlSpell("edge", edge.Start, edge.End)...)
+		}
+		doc.Graph.Edges = append(doc.Graph.Edges, graphmlEdge{
+			Id:     edge.Source + "-" + edge.Target,
+			Source: edge.Source,
+			Target: edge.Target,
+			Data:   data,
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return fmt.Errorf("unable to write XML header: %w", err)
+	}
+	e := xml.NewEncoder(w)
+	if err := e.Encode(doc); err != nil {
+		return fmt.Errorf("unable to encode GraphML document: %w", err)
+	}
+
+	return nil
+}
+
+// graphmlKeys returns the GraphML key declarations for the given class ("node" or "edge").
+func graphmlKeys(class string, defs []AttributeDef) []graphmlKey {
+	keys := make([]graphmlKey, 0, len(defs))
+	for _, def := range defs {
+		key := graphmlKey{
+			Id:   class + "_" + def.Key,
+			For:  class,
+			Name: def.Key,
+			Type: graphmlTypes[def.Type],
+			Desc: def.Title,
+		}
+		if key.Type == "" {
+			key.Type = "string"
+		}
+		if def.Default != nil {
+			value := formatValue(def.Default)
+			key.Default = &value
+		}
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+// graphmlValues returns the GraphML data elements for a node or edge. Unset values are left out, so that readers use
+// the declared default.
+func graphmlValues(class string, values map[string]interface{}, defs []AttributeDef) []graphmlData {
+	var data []graphmlData
+	for _, def := range defs {
+		if value, ok := values[def.Key]; ok && value != nil {
+			data = append(data, graphmlData{Key: class + "_" + def.Key, Value: formatValue(value)})
+		}
+	}
+
+	return data
+}
+
+// graphmlSpell returns the GraphML data elements for the time spell of a node or edge. Unset times are left out.
+func graphmlSpell(class string, start time.Time, end time.Time) []graphmlData {
+	var data []graphmlData
+	if !start.IsZero() {
+		data = append(data, graphmlData{Key: class + "_start", Value: formatTime(start)})
+	}
+	if !end.IsZero() {
+		data = append(data, graphmlData{Key: class + "_end", Value: formatTime(end)})
+	}
+
+	return data
+}
@@ -0,0 +1,143 @@
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// cytoscapeSerializer writes graphs in the Cytoscape.js elements JSON format.
+type cytoscapeSerializer struct{}
+
+// Format conforms to the Serializer interface.
+func (cytoscapeSerializer) Format() string { return FormatCytoscape }
+
+// ContentType conforms to the Serializer interface.
+func (cytoscapeSerializer) ContentType() string { return "application/vnd.cytoscape+json" }
+
+// Extension conforms to the Serializer interface.
+func (cytoscapeSerializer) Extension() string { return "cyjs" }
+
+type cytoscapeElement struct {
+	Data map[string]interface{} `json:"data"`
+}
+
+// Serialize conforms to the Serializer interface.
+func (cytoscapeSerializer) Serialize(w io.Writer, g *Graph) error {
+	nodes := g.Nodes()
+	edges := g.Edges()
+
+	var doc struct {
+		Data     map[string]interface{} `json:"data"`
+		Elements struct {
+			Nodes []cytoscapeElement `json:"nodes"`
+			Edges []cytoscapeElement `json:"edges"`
+		} `json:"elements"`
+	}
+	doc.Data = map[string]interface{}{"description": g.Description, "keywords": g.Keywords}
+	doc.Elements.Nodes = make([]cytoscapeElement, 0, len(nodes))
+	doc.Elements.Edges = make([]cytoscapeElement, 0, len(edges))
+
+	for _, node := range nodes {
+		data := jsonAttributes(node.Attributes, g.NodeAttributes)
+		data["id"] = node.ID
+		data["label"] = node.Label
+		jsonSpell(data, node.Start, node.End)
+		doc.Elements.Nodes = append(doc.Elements.Nodes, cytoscapeElement{Data: data})
+	}
+	for _, edge := range edges {
+		data := jsonAttributes(edge.Attributes, g.EdgeAttributes)
+		data["id"] = edge.Source + "-" + edge.Target
+		data["source"] = edge.Source
+		data["target"] = edge.Target
+		jsonSpell(data, edge.Start, edge.End)
+		if edge.Color != "" {
+			data["color"] = edge.Color
+		}
+		doc.Elements.Edges = append(doc.Elements.Edges, cytoscapeElement{Data: data})
+	}
+
+	if err := json.NewEncoder(w).Encode(doc); err != nil {
+		return fmt.Errorf("unable to encode Cytoscape JSON: %w", err)
+	}
+
+	return nil
+}
+
+// d3Serializer writes graphs in the node-link JSON format used by D3.js force layouts and NetworkX.
+type d3Serializer struct{}
+
+// Format conforms to the Serializer interface.
+func (d3Serializer) Format() string { return FormatD3 }
+
+// ContentType conforms to the Serializer interface.
+func (d3Serializer) ContentType() string { return "application/vnd.d3.node-link+json" }
+
+// Extension conforms to the Serializer interface.
+func (d3Serializer) Extension() string { return "json" }
+
+// Serialize conforms to the Serializer interface.
+func (d3Serializer) Serialize(w io.Writer, g *Graph) error {
+	nodes := g.Nodes()
+	edges := g.Edges()
+
+	doc := struct {
+		Directed bool                     `json:"directed"`
+		Graph    map[string]interface{}   `json:"graph"`
+		Nodes    []map[string]interface{} `json:"nodes"`
+		Links    []map[string]interface{} `json:"links"`
+	}{
+		Directed: true,
+		Graph:    map[string]interface{}{"description": g.Description, "keywords": g.Keywords},
+		Nodes:    make([]map[string]interface{}, 0, len(nodes)),
+		Links:    make([]map[string]interface{}, 0, len(edges)),
+	}
+
+	for _, node := range nodes {
+		data := jsonAttributes(node.Attributes, g.NodeAttributes)
+		data["id"] = node.ID
+		data["label"] = node.Label
+		jsonSpell(data, node.Start, node.End)
+		doc.Nodes = append(doc.Nodes, data)
+	}
+	for _, edge := range edges {
+		data := jsonAttributes(edge.Attributes, g.EdgeAttributes)
+		data["source"] = edge.Source
+		data["target"] = edge.Target
+		jsonSpell(data, edge.Start, edge.End)
+		if edge.Color != "" {
+			data["color"] = edge.Color
+		}
+		doc.Links = append(doc.Links, data)
+	}
+
+	if err := json.NewEncoder(w).Encode(doc); err != nil {
+		return fmt.Errorf("unable to encode D3 JSON: %w", err)
+	}
+
+	return nil
+}
+
+// jsonAttributes returns a new map holding the declared attribute values of a node or edge, with defaults applied.
+func jsonAttributes(values map[string]interface{}, defs []AttributeDef) map[string]interface{} {
+	data := make(map[string]interface{}, len(defs)+5)
+	for _, def := range defs {
+		if value, ok := attributeValue(values, def); ok {
+			data[def.Key] = value
+		}
+	}
+
+	return data
+}
+
+// jsonSpell adds the time spell of a node or edge to the given data, as "start" and "end" values. Unset times are left
+// out.
+func jsonSpell(data map[string]interface{}, start time.Time, end time.Time) {
+	if !start.IsZero() {
+		data["start"] = formatTime(start)
+	}
+	if !end.IsZero() {
+		data["end"] = formatTime(end)
+	}
+}
@@ -0,0 +1,147 @@
+package graph
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Graph formats, as used in the "format" query parameter.
+const (
+	FormatGEXF      string = "gexf"
+	FormatGraphML   string = "graphml"
+	FormatDOT       string = "dot"
+	FormatCytoscape string = "cytoscape"
+	FormatD3        string = "d3"
+	FormatCSV       string = "csv"
+)
+
+// ErrUnsupportedFormat is returned when a request asks for a graph format that is not supported.
+var ErrUnsupportedFormat = errors.New("unsupported graph format")
+
+// Serializer writes a graph in a single format.
+type Serializer interface {
+	// Format returns the format name, as used in the "format" query parameter.
+	Format() string
+
+	// ContentType returns the media type of the serialized graph.
+	ContentType() string
+
+	// Extension returns the file extension for the serialized graph, without a leading dot.
+	Extension() string
+
+	// Serialize writes the given graph to the given writer.
+	Serialize(w io.Writer, g *Graph) error
+}
+
+// serializers holds all supported serializers, by format name.
+var serializers = map[string]Serializer{
+	FormatGEXF:      gexfSerializer{},
+	FormatGraphML:   graphmlSerializer{},
+	FormatDOT:       dotSerializer{},
+	FormatCytoscape: cytoscapeSerializer{},
+	FormatD3:        d3Serializer{},
+	FormatCSV:       csvSerializer{},
+}
+
+// mediaTypeFormats maps the media types accepted in the Accept header to their format names.
+var mediaTypeFormats = map[string]string{
+	"application/gexf+xml":              FormatGEXF,
+	"application/graphml+xml":           FormatGraphML,
+	"text/vnd.graphviz":                 FormatDOT,
+	"application/vnd.cytoscape+json":    FormatCytoscape,
+	"application/vnd.d3.node-link+json": FormatD3,
+	"application/json":                  FormatD3,
+	"text/csv":                          FormatCSV,
+}
+
+// SerializerForFormat returns the serializer for the given format name.
+func SerializerForFormat(format string) (Serializer, error) {
+	serializer, ok := serializers[strings.ToLower(format)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedFormat, format)
+	}
+
+	return serializer, nil
+}
+
+// SerializerForRequest returns the serializer for the graph format requested by the given HTTP request.
+// The "format" query parameter takes precedence over the Accept header. If neither specifies a format, or the Accept
+// header allows any type, the serializer for the given default format is returned.
+func SerializerForRequest(r *http.Request, defaultFormat string) (Serializer, error) {
+	// Check the query parameter first
+	if format := r.URL.Query().Get("format"); format != "" {
+		return SerializerForFormat(format)
+	}
+
+	// Parse the Accept header, ordering the media ranges by their quality values
+	type mediaRange struct {
+		mediaType string
+		quality   float64
+	}
+	var ranges []mediaRange
+	for _, accept := range r.Header.Values("Accept") {
+		for _, value := range strings.Split(accept, ",") {
+			mediaType, params, parseErr := mime.ParseMediaType(strings.TrimSpace(value))
+			if parseErr != nil {
+				continue
+			}
+			quality := 1.0
+			if q, ok := params["q"]; ok {
+				if parsed, qErr := strconv.ParseFloat(q, 64); qErr == nil {
+					quality = parsed
+				}
+			}
+			if quality > 0 {
+				ranges = append(ranges, mediaRange{mediaType: strings.ToLower(mediaType), quality: quality})
+			}
+		}
+	}
+	if len(ranges) == 0 {
+		return SerializerForFormat(defaultFormat)
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].quality > ranges[j].quality
+	})
+
+	// Use the first supported media type
+	for _, mr := range ranges {
+		if format, ok := mediaTypeFormats[mr.mediaType]; ok {
+			return SerializerForFormat(format)
+		}
+		if mr.mediaType == "*/*" {
+			return SerializerForFormat(defaultFormat)
+		}
+	}
+
+	return nil, fmt.Errorf("%w: no supported type in Accept header %q", ErrUnsupportedFormat, r.Header.Get("Accept"))
+}
+
+// formatValue returns the string representation of the given attribute value.
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// formatTime returns the given time in RFC 3339 format, in UTC, or an empty string for the zero time.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.UTC().Format(time.RFC3339)
+}
@@ -65,6 +65,34 @@ type HttpRequest struct {
 
 	// Include the body of the request, if the content-type is text/plain
 	BodyText string
+
+	// GrpcService and GrpcMethod hold the service and method names, if the request is a gRPC or gRPC-Web call
+	GrpcService string
+	GrpcMethod  string
+}
+
+// MarshalJSON encodes the request as JSON, with its URL as a string, as the user information of a url.URL is lost
+// when it is encoded as a struct.
+func (req HttpRequest) MarshalJSON() ([]byte, error) {
+	type httpRequest HttpRequest
+	return json.Marshal(struct {
+		httpRequest
+		Url string
+	}{httpRequest(req), req.Url.String()})
+}
+
+// UnmarshalJSON decodes the request from the JSON encoding produced by MarshalJSON.
+func (req *HttpRequest) UnmarshalJSON(data []byte) error {
+	type httpRequest HttpRequest
+	decoded := struct {
+		*httpRequest
+		Url string
+	}{httpRequest: (*httpRequest)(req)}
+	if unmarshalErr := json.Unmarshal(data, &decoded); unmarshalErr != nil {
+		return unmarshalErr
+	}
+
+	return parseURL(decoded.Url, &req.Url)
 }
 
 // deepCopy returns a deep copy of the HttpRequest struct, which can be safely modified without
@@ -85,12 +113,14 @@ func (req *HttpRequest) deepCopy() HttpRequest {
 	}
 
 	return HttpRequest{
-		Method:    req.Method,
-		Url:       copiedUrl,
-		Header:    copiedHeader,
-		Timestamp: req.Timestamp,
-		Cookies:   copiedCookies,
-		BodyJson:  copiedBodyJson,
+		Method:      req.Method,
+		Url:         copiedUrl,
+		Header:      copiedHeader,
+		Timestamp:   req.Timestamp,
+		Cookies:     copiedCookies,
+		BodyJson:    copiedBodyJson,
+		GrpcService: req.GrpcService,
+		GrpcMethod:  req.GrpcMethod,
 	}
 }
 
@@ -135,3 +165,19 @@ func (resp *HttpResponse) deepCopy() HttpResponse {
 type IPData struct {
 	Destination net.IP
 }
+
+// parseURL parses the given URL string, as encoded by MarshalJSON, into u. An empty string is an empty URL.
+func parseURL(rawURL string, u *url.URL) error {
+	if rawURL == "" {
+		*u = url.URL{}
+		return nil
+	}
+
+	parsed, parseErr := url.Parse(rawURL)
+	if parseErr != nil {
+		return fmt.Errorf("unable to parse URL %q: %w", rawURL, parseErr)
+	}
+	*u = *parsed
+
+	return nil
+}
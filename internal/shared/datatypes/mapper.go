@@ -1,19 +1,211 @@
 package datatypes
 
 import (
+	"encoding/json"
+	"net/http"
 	"net/url"
 	"time"
 )
 
+// Mapper edge types, describing how a referer led to a destination.
+const (
+	// EdgeTypeLink is a navigation to the destination, such as following a link or submitting a form.
+	EdgeTypeLink string = "link"
+
+	// EdgeTypeRedirect is a redirect to the destination, through a 3xx Location header, a Refresh header, or a
+	// meta refresh tag.
+	EdgeTypeRedirect string = "redirect"
+
+	// EdgeTypeScript is a script loaded from the destination.
+	EdgeTypeScript string = "script"
+
+	// EdgeTypeIframe is a frame or iframe loaded from the destination.
+	EdgeTypeIframe string = "iframe"
+
+	// EdgeTypeFetch is a request made by a script, such as fetch, XMLHttpRequest, or sendBeacon.
+	EdgeTypeFetch string = "fetch"
+
+	// EdgeTypeForm is a form that submits to the destination.
+	EdgeTypeForm string = "form"
+
+	// EdgeTypeImage is an image loaded from the destination.
+	EdgeTypeImage string = "image"
+
+	// EdgeTypeMedia is a video, audio, or text track loaded from the destination.
+	EdgeTypeMedia string = "media"
+
+	// EdgeTypeResource is another resource loaded from the destination, such as a stylesheet, font, or manifest.
+	EdgeTypeResource string = "resource"
+
+	// EdgeTypeDiscovered is a destination referenced in the source of a script, which may not have been visited yet.
+	EdgeTypeDiscovered string = "discovered"
+)
+
+// edgeTypes holds all valid edge types.
+var edgeTypes = map[string]bool{
+	EdgeTypeLink:       true,
+	EdgeTypeRedirect:   true,
+	EdgeTypeScript:     true,
+	EdgeTypeIframe:     true,
+	EdgeTypeFetch:      true,
+	EdgeTypeForm:       true,
+	EdgeTypeImage:      true,
+	EdgeTypeMedia:      true,
+	EdgeTypeResource:   true,
+	EdgeTypeDiscovered: true,
+}
+
+// IsEdgeType returns true if the given string is one of the EdgeType constants.
+func IsEdgeType(edgeType string) bool {
+	return edgeTypes[edgeType]
+}
+
 // ReferrerData is a struct that holds the referer and destination URLs from a single HTTP request.
 type ReferrerData struct {
 	Referer     url.URL
 	Destination url.URL
 	Timestamp   time.Time
+
+	// Type is one of the EdgeType constants. An empty type is saved as EdgeTypeLink.
+	Type string
+
+	// Element and Attribute are the HTML element and attribute that the destination was found in, such as "script"
+	// and "src", if it was found by the browser scripts. Requests made by scripts have the API used as the element,
+	// such as "fetch", and no attribute.
+	Element   string
+	Attribute string
+}
+
+// MarshalJSON encodes the referrer data as JSON, with its URLs as strings, as the user information of a url.URL is
+// lost when it is encoded as a struct.
+func (referrerData ReferrerData) MarshalJSON() ([]byte, error) {
+	type referrer ReferrerData
+	return json.Marshal(struct {
+		referrer
+		Referer     string
+		Destination string
+	}{referrer(referrerData), referrerData.Referer.String(), referrerData.Destination.String()})
+}
+
+// UnmarshalJSON decodes the referrer data from the JSON encoding produced by MarshalJSON.
+func (referrerData *ReferrerData) UnmarshalJSON(data []byte) error {
+	type referrer ReferrerData
+	decoded := struct {
+		*referrer
+		Referer     string
+		Destination string
+	}{referrer: (*referrer)(referrerData)}
+	if unmarshalErr := json.Unmarshal(data, &decoded); unmarshalErr != nil {
+		return unmarshalErr
+	}
+	if parseErr := parseURL(decoded.Referer, &referrerData.Referer); parseErr != nil {
+		return parseErr
+	}
+
+	return parseURL(decoded.Destination, &referrerData.Destination)
+}
+
+// EdgeTypeForRequest returns the edge type for a request with the given headers, using the Sec-Fetch-Dest header
+// sent by browsers. Requests without the header are treated as links.
+func EdgeTypeForRequest(header http.Header) string {
+	switch header.Get("Sec-Fetch-Dest") {
+	case "script", "worker", "sharedworker", "serviceworker":
+		return EdgeTypeScript
+	case "iframe", "frame", "embed", "object":
+		return EdgeTypeIframe
+	case "empty":
+		return EdgeTypeFetch
+	case "image":
+		return EdgeTypeImage
+	case "audio", "video", "track":
+		return EdgeTypeMedia
+	case "style", "font", "manifest", "report", "xslt":
+		return EdgeTypeResource
+	default:
+		return EdgeTypeLink
+	}
 }
 
 // MapperBrowserData holds mapper data sent from our browser scripts.
 type MapperBrowserData struct {
-	Source       string   `json:"source"`
-	Destinations []string `json:"destinations"`
+	Source string `json:"source"`
+
+	// Destinations are untyped destination URLs, sent by older versions of the browser scripts. They are treated as
+	// links.
+	Destinations []string `json:"destinations,omitempty"`
+
+	// Edges are the typed destinations found on the page.
+	Edges []MapperBrowserEdge `json:"edges,omitempty"`
+}
+
+// MapperBrowserEdge is a single destination found by our browser scripts, with how it was found.
+type MapperBrowserEdge struct {
+	URL       string `json:"url"`
+	Type      string `json:"type"`
+	Element   string `json:"element"`
+	Attribute string `json:"attribute"`
+}
+
+// Instrumentation event kinds, describing the browser API observed by the instrumentation script.
+const (
+	// InstrumentKindFetch is a request made with fetch.
+	InstrumentKindFetch string = "fetch"
+
+	// InstrumentKindXHR is a request made with XMLHttpRequest.
+	InstrumentKindXHR string = "xhr"
+
+	// InstrumentKindWebSocket is a WebSocket connection being opened ("CONNECT"), or a message sent on one ("SEND").
+	InstrumentKindWebSocket string = "websocket"
+
+	// InstrumentKindPostMessage is a message received from another window or frame, with the sender's origin as the
+	// URL.
+	InstrumentKindPostMessage string = "postmessage"
+
+	// InstrumentKindStorage is a write to localStorage ("SET", "REMOVE", or "CLEAR"), with the key as the detail.
+	InstrumentKindStorage string = "storage"
+)
+
+// instrumentKinds holds all valid instrumentation event kinds.
+var instrumentKinds = map[string]bool{
+	InstrumentKindFetch:       true,
+	InstrumentKindXHR:         true,
+	InstrumentKindWebSocket:   true,
+	InstrumentKindPostMessage: true,
+	InstrumentKindStorage:     true,
+}
+
+// IsInstrumentKind returns true if the given string is one of the InstrumentKind constants.
+func IsInstrumentKind(kind string) bool {
+	return instrumentKinds[kind]
+}
+
+// InstrumentBrowserData holds the client-side API calls observed on a single page by our instrumentation script.
+type InstrumentBrowserData struct {
+	// Page is the URL of the page the calls were made on.
+	Page string `json:"page"`
+
+	Events []InstrumentBrowserEvent `json:"events"`
+}
+
+// InstrumentBrowserEvent is a single client-side API call, or a number of identical calls, observed by our
+// instrumentation script.
+type InstrumentBrowserEvent struct {
+	// Kind is one of the InstrumentKind constants.
+	Kind string `json:"kind"`
+
+	// Method is the HTTP method of requests, or the action for other kinds, such as "SEND".
+	Method string `json:"method"`
+
+	// URL is the URL the call was made to, or the sender's origin for received messages.
+	URL string `json:"url"`
+
+	// Script is the URL of the script that made the call, if it could be found. Inline scripts are attributed to
+	// the page.
+	Script string `json:"script"`
+
+	// Detail is extra information about the call: the storage key, or the top-level keys of a message's data.
+	Detail string `json:"detail"`
+
+	// Count is the number of identical calls observed.
+	Count int `json:"count"`
 }
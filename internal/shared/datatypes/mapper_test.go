@@ -0,0 +1,35 @@
+package datatypes
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestEdgeTypeForRequest(t *testing.T) {
+	tests := []struct {
+		dest string
+		want string
+	}{
+		{dest: "", want: EdgeTypeLink},
+		{dest: "document", want: EdgeTypeLink},
+		{dest: "script", want: EdgeTypeScript},
+		{dest: "iframe", want: EdgeTypeIframe},
+		{dest: "empty", want: EdgeTypeFetch},
+		{dest: "image", want: EdgeTypeImage},
+		{dest: "video", want: EdgeTypeMedia},
+		{dest: "style", want: EdgeTypeResource},
+	}
+	for _, tt := range tests {
+		header := http.Header{}
+		if tt.dest != "" {
+			header.Set("Sec-Fetch-Dest", tt.dest)
+		}
+		got := EdgeTypeForRequest(header)
+		if got != tt.want {
+			t.Errorf("EdgeTypeForRequest(%q) = %q, want %q", tt.dest, got, tt.want)
+		}
+		if !IsEdgeType(got) {
+			t.Errorf("IsEdgeType(%q) = false, want true", got)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package datatypes
+
+import (
+	"encoding/json"
+	"net/url"
+	"time"
+)
+
+// Stream types for streaming HTTP responses.
+const (
+	// StreamTypeSSE represents a Server-Sent Events (text/event-stream) response.
+	StreamTypeSSE string = "sse"
+
+	// StreamTypeNDJSON represents a newline-delimited JSON response, where each line is a separate event.
+	StreamTypeNDJSON string = "ndjson"
+)
+
+// StreamEvent represents a single event parsed from a streaming HTTP response.
+// It is linked to the originating request by the request URL, method, response status code, and request timestamp.
+type StreamEvent struct {
+	// Method, Url, StatusCode and RequestTimestamp identify the originating request.
+	Method           string
+	Url              url.URL
+	StatusCode       int
+	RequestTimestamp time.Time
+
+	// Referer holds the referring URL of the originating request, used for target matching.
+	Referer url.URL
+
+	// StreamType is one of the StreamType constants.
+	StreamType string
+
+	// Sequence is the position of this event in the stream, starting from 0.
+	Sequence int
+
+	// Name is the event name (the SSE "event" field), and is empty for NDJSON events.
+	Name string
+
+	// ID is the last event ID (the SSE "id" field), and is empty for NDJSON events.
+	ID string
+
+	// DataShape describes the structure of the event data, without including any of the values.
+	DataShape json.RawMessage
+
+	// DataSize is the length of the event data, in bytes.
+	DataSize int
+
+	// Timestamp is the time the event was received.
+	Timestamp time.Time
+}
+
+// MarshalJSON encodes the event as JSON, with its URLs as strings, as the user information of a url.URL is lost when
+// it is encoded as a struct.
+func (event StreamEvent) MarshalJSON() ([]byte, error) {
+	type streamEvent StreamEvent
+	return json.Marshal(struct {
+		streamEvent
+		Url     string
+		Referer string
+	}{streamEvent(event), event.Url.String(), event.Referer.String()})
+}
+
+// UnmarshalJSON decodes the event from the JSON encoding produced by MarshalJSON.
+func (event *StreamEvent) UnmarshalJSON(data []byte) error {
+	type streamEvent StreamEvent
+	decoded := struct {
+		*streamEvent
+		Url     string
+		Referer string
+	}{streamEvent: (*streamEvent)(event)}
+	if unmarshalErr := json.Unmarshal(data, &decoded); unmarshalErr != nil {
+		return unmarshalErr
+	}
+	if parseErr := parseURL(decoded.Url, &event.Url); parseErr != nil {
+		return parseErr
+	}
+
+	return parseURL(decoded.Referer, &event.Referer)
+}
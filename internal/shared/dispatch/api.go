@@ -0,0 +1,62 @@
+package dispatch
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// StatsSource is implemented by plugins that receive data through input queues.
+type StatsSource interface {
+	// QueueStats returns the statistics for each of the plugin's input queues.
+	QueueStats() []Stats
+}
+
+// NewStatsAPIHandler returns a new StatsAPIHandler, which reports the queue statistics of the given plugins.
+func NewStatsAPIHandler(sources ...StatsSource) *StatsAPIHandler {
+	return &StatsAPIHandler{
+		sources: sources,
+	}
+}
+
+// StatsAPIHandler returns the input queue statistics for all plugins.
+//
+// It conforms to the http.Handler interface, and should thus be used in a http.ServeMux instance.
+type StatsAPIHandler struct {
+	// sources are the plugins to report statistics for.
+	sources []StatsSource
+}
+
+// ServeHTTP conforms to the http.Handler interface, returning the statistics for all queues as a JSON array.
+func (h StatsAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET requests (or OPTIONS)
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Allow", "GET, OPTIONS")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	} else if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET, OPTIONS")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Collect the statistics for all queues
+	stats := make([]Stats, 0)
+	for _, source := range h.sources {
+		stats = append(stats, source.QueueStats()...)
+	}
+
+	// Convert the statistics to JSON to return to client
+	statsJson, marshalErr := json.Marshal(stats)
+	if marshalErr != nil {
+		http.Error(w, fmt.Sprintf("unable to convert queue statistics to JSON: %s", marshalErr.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	// Write the response
+	w.Header().Set("Content-Type", "application/json")
+	if _, writeErr := w.Write(statsJson); writeErr != nil {
+		http.Error(w, fmt.Sprintf("problem writing JSON response back: %s", writeErr.Error()), http.StatusInternalServerError)
+		return
+	}
+}
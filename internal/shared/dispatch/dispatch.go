@@ -0,0 +1,270 @@
+package dispatch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/TheHackerDev/cartograph/internal/config"
+	"github.com/TheHackerDev/cartograph/internal/shared/metrics"
+)
+
+// NewQueue returns a new plugin input queue with the given name, using the given settings.
+// The name is used to identify the queue in its statistics, and as the name of its spill file.
+//
+// Any errors returned should be considered fatal.
+func NewQueue[T any](name string, cfg config.QueueConfig) (*Queue[T], error) {
+	queue := &Queue[T]{
+		name:   name,
+		policy: cfg.Policy,
+		items:  make(chan T, cfg.Size),
+		done:   make(chan struct{}),
+
+		refillDone: make(chan struct{}),
+	}
+
+	// Open the spill file, which may still hold items from a previous run
+	if cfg.Policy == config.QueuePolicySpill {
+		spill, spillErr := openSpillFile(filepath.Join(cfg.SpillDir, name+".jsonl"), cfg.SpillMaxBytes)
+		if spillErr != nil {
+			return nil, fmt.Errorf("unable to open spill file for %s queue: %w", name, spillErr)
+		}
+		queue.spill = spill
+		if pending := spill.pendingItems(); pending > 0 {
+			log.WithField("queue", name).Infof("recovering %d spilled items from a previous run", pending)
+		}
+		go queue.refill()
+	} else {
+		close(queue.refillDone)
+	}
+
+	return queue, nil
+}
+
+// Queue is a bounded input queue for a plugin, which decouples the senders (the proxy handlers) from the plugin's
+// database flushes. When the queue is full, items are handled according to the queue's policy, so that a slow
+// database does not stall every proxied request.
+type Queue[T any] struct {
+	// name identifies the queue.
+	name string
+
+	// policy is one of the config.QueuePolicy constants.
+	policy string
+
+	// items holds the queued items in memory.
+	items chan T
+
+	// spill holds the items that did not fit in memory, when using the spill policy.
+	spill *spillFile
+
+	// done is closed when the queue is closed, to stop the refill goroutine.
+	done chan struct{}
+
+	// refillDone is closed once the refill goroutine has returned.
+	refillDone chan struct{}
+
+	// Counters for the queue statistics.
+	enqueued          atomic.Int64
+	dropped           atomic.Int64
+	spilled           atomic.Int64
+	flushes           atomic.Int64
+	flushedItems      atomic.Int64
+	flushErrors       atomic.Int64
+	lastFlushLatency  atomic.Int64
+	totalFlushLatency atomic.Int64
+}
+
+// Enqueue sends the given item to the queue. If the queue is full, the item is handled according to the queue's
+// policy. It returns false if the item was dropped.
+func (q *Queue[T]) Enqueue(item T) bool {
+	switch q.policy {
+	case config.QueuePolicyBlock:
+		q.items <- item
+		q.enqueued.Add(1)
+		return true
+	case config.QueuePolicySpill:
+		// Keep items in order by spilling while there are still items waiting on disk
+		if q.spill.pendingItems() == 0 {
+			select {
+			case q.items <- item:
+				q.enqueued.Add(1)
+				return true
+			default:
+			}
+		}
+		if spillErr := q.spill.write(item); errors.Is(spillErr, errSpillClosed) {
+			log.WithField("queue", q.name).Warn("item sent to closed queue; dropping item")
+			q.dropped.Add(1)
+			return false
+		} else if spillErr != nil {
+			log.WithError(spillErr).WithField("queue", q.name).Debug("unable to spill item to disk; dropping item")
+			q.dropped.Add(1)
+			return false
+		}
+		q.enqueued.Add(1)
+		q.spilled.Add(1)
+		return true
+	default:
+		select {
+		case q.items <- item:
+			q.enqueued.Add(1)
+			return true
+		default:
+			q.dropped.Add(1)
+			return false
+		}
+	}
+}
+
+// Items returns the channel from which the plugin receives queued items.
+func (q *Queue[T]) Items() <-chan T {
+	return q.items
+}
+
+// RecordFlush records a flush of the given number of items to the database, which took the given duration and
+// returned the given error. Empty, successful flushes are not recorded.
+func (q *Queue[T]) RecordFlush(count int, latency time.Duration, err error) {
+	if count == 0 && err == nil {
+		return
+	}
+
+	q.flushes.Add(1)
+	q.flushedItems.Add(int64(count))
+	q.lastFlushLatency.Store(int64(latency))
+	q.totalFlushLatency.Add(int64(latency))
+	metrics.PluginFlushItems.WithLabelValues(q.name).Observe(float64(count))
+	metrics.PluginFlushSeconds.WithLabelValues(q.name).Observe(latency.Seconds())
+	if err != nil {
+		q.flushErrors.Add(1)
+		metrics.PluginFlushErrors.WithLabelValues(q.name).Inc()
+	}
+}
+
+// Close stops reading spilled items back into the queue. Any items still on disk are kept, and are recovered the
+// next time the queue is created. Items already in memory can still be received after the queue is closed, but items
+// that would be spilled to disk after it is closed are dropped.
+func (q *Queue[T]) Close() error {
+	close(q.done)
+	<-q.refillDone
+	if q.spill == nil {
+		return nil
+	}
+
+	if pending := q.spill.pendingItems(); pending > 0 {
+		log.WithField("queue", q.name).Infof("keeping %d spilled items on disk until the next run", pending)
+	}
+
+	return q.spill.close()
+}
+
+// refill reads spilled items back into the queue as room becomes available, until the queue is closed.
+func (q *Queue[T]) refill() {
+	defer close(q.refillDone)
+
+	for {
+		select {
+		case <-q.done:
+			return
+		case <-q.spill.notify:
+		}
+
+		for q.spill.pendingItems() > 0 {
+			line, readErr := q.spill.next()
+			if readErr != nil {
+				// The file can no longer be trusted, so discard everything in it
+				discarded := q.spill.discard()
+				log.WithError(readErr).WithField("queue", q.name).Errorf("unable to read spilled items from disk; dropping %d items", discarded)
+				q.dropped.Add(discarded)
+				break
+			}
+
+			var item T
+			if unmarshalErr := json.Unmarshal(line, &item); unmarshalErr != nil {
+				log.WithError(unmarshalErr).WithField("queue", q.name).Error("unable to decode spilled item; dropping item")
+				q.dropped.Add(1)
+				q.spill.consumed()
+				continue
+			}
+
+			select {
+			case q.items <- item:
+			case <-q.done:
+				// Put the item back, so it is kept on disk
+				q.spill.unread(len(line))
+				return
+			}
+			q.spill.consumed()
+		}
+	}
+}
+
+// Stats returns the current statistics for the queue.
+func (q *Queue[T]) Stats() Stats {
+	stats := Stats{
+		Name:        q.name,
+		Policy:      q.policy,
+		Capacity:    cap(q.items),
+		Queued:      len(q.items),
+		Enqueued:    q.enqueued.Load(),
+		Dropped:     q.dropped.Load(),
+		Spilled:     q.spilled.Load(),
+		Flushes:     q.flushes.Load(),
+		Flushed:     q.flushedItems.Load(),
+		FlushErrors: q.flushErrors.Load(),
+
+		LastFlushLatencyMs:  time.Duration(q.lastFlushLatency.Load()).Seconds() * 1000,
+		TotalFlushLatencyMs: time.Duration(q.totalFlushLatency.Load()).Seconds() * 1000,
+	}
+	if q.spill != nil {
+		stats.SpillPending = q.spill.pendingItems()
+	}
+
+	return stats
+}
+
+// Stats holds the statistics for a single plugin input queue.
+type Stats struct {
+	// Name identifies the queue.
+	Name string `json:"name"`
+
+	// Policy is the policy used when the queue is full.
+	Policy string `json:"policy"`
+
+	// Capacity is the number of items the queue holds in memory.
+	Capacity int `json:"capacity"`
+
+	// Queued is the number of items currently held in memory.
+	Queued int `json:"queued"`
+
+	// SpillPending is the number of items currently waiting on disk.
+	SpillPending int64 `json:"spill_pending"`
+
+	// Enqueued is the total number of items accepted by the queue, including spilled items.
+	Enqueued int64 `json:"enqueued"`
+
+	// Dropped is the total number of items discarded because the queue was full.
+	Dropped int64 `json:"dropped"`
+
+	// Spilled is the total number of items written to disk because the queue was full.
+	Spilled int64 `json:"spilled"`
+
+	// Flushes is the total number of non-empty database flushes.
+	Flushes int64 `json:"flushes"`
+
+	// Flushed is the total number of items included in database flushes.
+	Flushed int64 `json:"flushed"`
+
+	// FlushErrors is the total number of database flushes that failed, either fully or partially.
+	FlushErrors int64 `json:"flush_errors"`
+
+	// LastFlushLatencyMs is the duration of the most recent database flush, in milliseconds.
+	LastFlushLatencyMs float64 `json:"last_flush_latency_ms"`
+
+	// TotalFlushLatencyMs is the total duration of all database flushes, in milliseconds.
+	TotalFlushLatencyMs float64 `json:"total_flush_latency_ms"`
+}
@@ -0,0 +1,54 @@
+package dispatch
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	queueQueued = prometheus.NewDesc("cartograph_plugin_queue_items",
+		"Number of items currently held in memory by a plugin input queue.", []string{"queue"}, nil)
+	queueSpillPending = prometheus.NewDesc("cartograph_plugin_queue_spill_pending",
+		"Number of items currently waiting on disk for a plugin input queue.", []string{"queue"}, nil)
+	queueCapacity = prometheus.NewDesc("cartograph_plugin_queue_capacity",
+		"Number of items a plugin input queue holds in memory.", []string{"queue"}, nil)
+	queueEnqueued = prometheus.NewDesc("cartograph_plugin_queue_enqueued_total",
+		"Total number of items accepted by a plugin input queue, including spilled items.", []string{"queue"}, nil)
+	queueDropped = prometheus.NewDesc("cartograph_plugin_queue_dropped_total",
+		"Total number of items discarded because a plugin input queue was full.", []string{"queue"}, nil)
+	queueSpilled = prometheus.NewDesc("cartograph_plugin_queue_spilled_total",
+		"Total number of items written to disk because a plugin input queue was full.", []string{"queue"}, nil)
+)
+
+// RegisterMetrics registers the input queue statistics of the given plugins with the default Prometheus registry.
+func RegisterMetrics(sources ...StatsSource) error {
+	return prometheus.Register(&statsCollector{sources: sources})
+}
+
+// statsCollector is a prometheus.Collector that reports the input queue statistics of a set of plugins.
+type statsCollector struct {
+	sources []StatsSource
+}
+
+// Describe conforms to the prometheus.Collector interface.
+func (c *statsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- queueQueued
+	ch <- queueSpillPending
+	ch <- queueCapacity
+	ch <- queueEnqueued
+	ch <- queueDropped
+	ch <- queueSpilled
+}
+
+// Collect conforms to the prometheus.Collector interface.
+func (c *statsCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, source := range c.sources {
+		for _, stats := range source.QueueStats() {
+			ch <- prometheus.MustNewConstMetric(queueQueued, prometheus.GaugeValue, float64(stats.Queued), stats.Name)
+			ch <- prometheus.MustNewConstMetric(queueSpillPending, prometheus.GaugeValue, float64(stats.SpillPending), stats.Name)
+			ch <- prometheus.MustNewConstMetric(queueCapacity, prometheus.GaugeValue, float64(stats.Capacity), stats.Name)
+			ch <- prometheus.MustNewConstMetric(queueEnqueued, prometheus.CounterValue, float64(stats.Enqueued), stats.Name)
+			ch <- prometheus.MustNewConstMetric(queueDropped, prometheus.CounterValue, float64(stats.Dropped), stats.Name)
+			ch <- prometheus.MustNewConstMetric(queueSpilled, prometheus.CounterValue, float64(stats.Spilled), stats.Name)
+		}
+	}
+}
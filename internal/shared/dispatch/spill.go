@@ -0,0 +1,233 @@
+package dispatch
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// errSpillFull is returned when a spill file has reached its maximum size.
+var errSpillFull = errors.New("spill file is full")
+
+// errSpillClosed is returned when writing to a spill file after it has been closed.
+var errSpillClosed = errors.New("spill file is closed")
+
+// openSpillFile opens the spill file at the given path, creating it if it does not exist. Any complete items left in
+// the file from a previous run are kept, and any partially-written item at the end of the file is discarded.
+func openSpillFile(path string, maxBytes int64) (*spillFile, error) {
+	if mkdirErr := os.MkdirAll(filepath.Dir(path), 0o700); mkdirErr != nil {
+		return nil, fmt.Errorf("unable to create spill directory: %w", mkdirErr)
+	}
+
+	file, openErr := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if openErr != nil {
+		return nil, fmt.Errorf("unable to open spill file: %w", openErr)
+	}
+
+	spill := &spillFile{
+		path:     path,
+		file:     file,
+		maxBytes: maxBytes,
+		notify:   make(chan struct{}, 1),
+	}
+
+	// Count the complete items in the file, each of which ends with a newline
+	reader := bufio.NewReader(file)
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if readErr != nil {
+			if errors.Is(readErr, io.EOF) {
+				break
+			}
+			_ = file.Close()
+			return nil, fmt.Errorf("unable to read spill file: %w", readErr)
+		}
+		spill.size += int64(len(line))
+		spill.pending++
+	}
+
+	// Discard any partially-written item
+	if truncateErr := file.Truncate(spill.size); truncateErr != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("unable to truncate spill file: %w", truncateErr)
+	}
+
+	if spill.pending > 0 {
+		spill.notify <- struct{}{}
+	}
+
+	return spill, nil
+}
+
+// spillFile is an append-only file of JSON-encoded items, one per line, which are read back in the order they were
+// written. The file is truncated whenever all of its items have been read.
+// It should be created via the openSpillFile function.
+type spillFile struct {
+	// mu protects all the fields below, except notify.
+	mu sync.Mutex
+
+	// path is the path of the underlying file.
+	path string
+
+	// file is the underlying file.
+	file *os.File
+
+	// maxBytes is the maximum size of the file. Zero means no limit.
+	maxBytes int64
+
+	// size is the number of bytes written to the file.
+	size int64
+
+	// readOffset is the offset of the next item to read.
+	readOffset int64
+
+	// pending is the number of items written, but not yet consumed.
+	pending int64
+
+	// notify is signalled whenever an item is written to the file.
+	notify chan struct{}
+
+	// closed is true once the file has been closed, after which no more items can be written.
+	closed bool
+}
+
+// write appends the given item to the file.
+func (s *spillFile) write(item interface{}) error {
+	data, marshalErr := json.Marshal(item)
+	if marshalErr != nil {
+		return fmt.Errorf("unable to encode item: %w", marshalErr)
+	}
+	data = append(data, '\n')
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return errSpillClosed
+	}
+	if s.maxBytes > 0 && s.size+int64(len(data)) > s.maxBytes {
+		s.mu.Unlock()
+		return errSpillFull
+	}
+	if _, writeErr := s.file.WriteAt(data, s.size); writeErr != nil {
+		s.mu.Unlock()
+		return fmt.Errorf("unable to write to spill file: %w", writeErr)
+	}
+	s.size += int64(len(data))
+	s.pending++
+	s.mu.Unlock()
+
+	// Wake up the reader, if it isn't already awake
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// next returns the next unread item in the file, and advances the read offset past it.
+// It must only be called by a single reader, while there are pending items.
+func (s *spillFile) next() ([]byte, error) {
+	s.mu.Lock()
+	offset, size := s.readOffset, s.size
+	s.mu.Unlock()
+
+	// Written data is never modified, so it is safe to read without holding the lock
+	line, readErr := bufio.NewReader(io.NewSectionReader(s.file, offset, size-offset)).ReadBytes('\n')
+	if readErr != nil {
+		return nil, fmt.Errorf("unable to read from spill file: %w", readErr)
+	}
+
+	s.mu.Lock()
+	s.readOffset += int64(len(line))
+	s.mu.Unlock()
+
+	return line, nil
+}
+
+// unread moves the read offset back over an item of the given length, so that it is returned again by next.
+func (s *spillFile) unread(length int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.readOffset -= int64(length)
+}
+
+// consumed marks the last item returned by next as consumed, truncating the file once all items are consumed.
+func (s *spillFile) consumed() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pending--
+	if s.pending == 0 {
+		s.truncate()
+	}
+}
+
+// discard removes all pending items from the file, returning the number of items removed.
+func (s *spillFile) discard() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	discarded := s.pending
+	s.pending = 0
+	s.truncate()
+
+	return discarded
+}
+
+// truncate empties the file. The caller must hold the lock.
+func (s *spillFile) truncate() {
+	// Truncation failures are safe to ignore here, as new items are written at the tracked size rather than the end
+	// of the file.
+	_ = s.file.Truncate(0)
+	s.size = 0
+	s.readOffset = 0
+}
+
+// pendingItems returns the number of items waiting in the file.
+func (s *spillFile) pendingItems() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.pending
+}
+
+// close closes the file. Any items that have already been consumed are removed first, so that they are not read
+// again when the file is next opened. Items written after the file is closed are rejected.
+func (s *spillFile) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	if s.readOffset == 0 || s.pending == 0 {
+		return s.file.Close()
+	}
+
+	// Copy the pending items to a new file, and replace the old file with it
+	tmpPath := s.path + ".tmp"
+	tmpFile, createErr := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if createErr != nil {
+		_ = s.file.Close()
+		return fmt.Errorf("unable to create temporary spill file: %w", createErr)
+	}
+	if _, copyErr := io.Copy(tmpFile, io.NewSectionReader(s.file, s.readOffset, s.size-s.readOffset)); copyErr != nil {
+		_ = tmpFile.Close()
+		_ = s.file.Close()
+		return fmt.Errorf("unable to copy pending items to temporary spill file: %w", copyErr)
+	}
+	if closeErr := tmpFile.Close(); closeErr != nil {
+		_ = s.file.Close()
+		return fmt.Errorf("unable to close temporary spill file: %w", closeErr)
+	}
+	if closeErr := s.file.Close(); closeErr != nil {
+		return fmt.Errorf("unable to close spill file: %w", closeErr)
+	}
+
+	return os.Rename(tmpPath, s.path)
+}
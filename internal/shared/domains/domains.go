@@ -0,0 +1,50 @@
+// Package domains groups hosts by registrable domain (eTLD+1), using the Public Suffix List embedded in
+// golang.org/x/net/publicsuffix.
+package domains
+
+import (
+	"net"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// Registrable returns the registrable domain (eTLD+1) of the given host, such as "example.co.uk" for
+// "cdn.example.co.uk". Ports are removed, and hosts are lower-cased.
+// IP addresses, single-label hosts such as "localhost", and hosts that are themselves public suffixes are returned
+// unchanged, as they have no registrable domain.
+func Registrable(host string) string {
+	host = normalize(host)
+	if host == "" || net.ParseIP(host) != nil || !strings.Contains(host, ".") {
+		return host
+	}
+
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return host
+	}
+
+	return domain
+}
+
+// PublicSuffix returns the public suffix (eTLD) of the given host, such as "co.uk" for "cdn.example.co.uk".
+// It returns an empty string for IP addresses.
+func PublicSuffix(host string) string {
+	host = normalize(host)
+	if host == "" || net.ParseIP(host) != nil {
+		return ""
+	}
+
+	suffix, _ := publicsuffix.PublicSuffix(host)
+	return suffix
+}
+
+// normalize lower-cases the given host, and removes any port, brackets around IPv6 addresses, and trailing dot.
+func normalize(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.Trim(host, "[]"), ".")
+
+	return strings.ToLower(host)
+}
@@ -0,0 +1,22 @@
+package domains
+
+import "testing"
+
+func TestRegistrable(t *testing.T) {
+	tests := map[string]string{
+		"cdn1.example.com":     "example.com",
+		"API.Example.com:8443": "example.com",
+		"static.example.co.uk": "example.co.uk",
+		"user.github.io":       "user.github.io",
+		"example.com.":         "example.com",
+		"localhost":            "localhost",
+		"127.0.0.1:8080":       "127.0.0.1",
+		"[2001:db8::1]:443":    "2001:db8::1",
+		"co.uk":                "co.uk",
+	}
+	for host, want := range tests {
+		if got := Registrable(host); got != want {
+			t.Errorf("Registrable(%q) = %q, want %q", host, got, want)
+		}
+	}
+}
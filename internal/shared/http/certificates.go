@@ -22,6 +22,8 @@ import (
 	"time"
 
 	log "github.com/sirupsen/logrus"
+
+	"github.com/TheHackerDev/cartograph/internal/shared/metrics"
 )
 
 //go:embed certificates/*
@@ -313,7 +315,9 @@ func (c *CertificateManager) GetCertificateDynamic() func(info *tls.ClientHelloI
 		c.certMap.RUnlock()
 
 		// Generate a new ECDSA leaf certificate for the host and wildcards
+		start := time.Now()
 		leafCert, newLeafCertErr := c.generateLeafCertificateEcdsa(sans)
+		metrics.CertificateGenerationSeconds.WithLabelValues("ecdsa").Observe(time.Since(start).Seconds())
 		if newLeafCertErr != nil {
 			return nil, fmt.Errorf("unable to generate ECDSA leaf certificate for parent host (%s): %w", sans.parent, newLeafCertErr)
 		}
@@ -322,7 +326,9 @@ func (c *CertificateManager) GetCertificateDynamic() func(info *tls.ClientHelloI
 		if certSupportErr := info.SupportsCertificate(leafCert); certSupportErr != nil {
 			// ECDSA certificate not supported; generate an RSA certificate
 			var newRsaLeafCertErr error
+			start = time.Now()
 			leafCert, newRsaLeafCertErr = c.generateLeafCertificateRsa(sans)
+			metrics.CertificateGenerationSeconds.WithLabelValues("rsa").Observe(time.Since(start).Seconds())
 			if newRsaLeafCertErr != nil {
 				return nil, fmt.Errorf("unable to generate RSA leaf certificate for parent host (%s): %w", sans.parent, newRsaLeafCertErr)
 			}
@@ -342,6 +348,14 @@ func (c *CertificateManager) GetCertificateDynamic() func(info *tls.ClientHelloI
 	}
 }
 
+// CacheSize returns the number of generated leaf certificates held in the cache.
+func (c *CertificateManager) CacheSize() int {
+	c.certMap.RLock()
+	defer c.certMap.RUnlock()
+
+	return len(c.certMap.certs)
+}
+
 // wildcards holds the wildcard host information for use with generated TLS certificates.
 type wildcards struct {
 	parent  string
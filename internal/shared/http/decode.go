@@ -6,8 +6,10 @@ import (
 	"compress/gzip"
 	"fmt"
 	"io"
+	"strings"
 
 	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
 )
 
 // DecodeGzip returns a decoded version of the given gzip-encoded contents.
@@ -45,3 +47,94 @@ func DecodeDeflate(contents []byte) ([]byte, error) {
 	}
 	return decoded, nil
 }
+
+// DecodeZstd returns a decoded version of the given zstd-encoded contents
+func DecodeZstd(contents []byte) ([]byte, error) {
+	decompressor, newReaderErr := zstd.NewReader(bytes.NewReader(contents))
+	if newReaderErr != nil {
+		return nil, fmt.Errorf("unable to create new zstd reader to read contents: %w", newReaderErr)
+	}
+	defer decompressor.Close()
+	decoded, decodeErr := io.ReadAll(decompressor)
+	if decodeErr != nil {
+		return nil, fmt.Errorf("unable to decode zstd-encoded contents: %w", decodeErr)
+	}
+	return decoded, nil
+}
+
+// DecodeBody returns a decoded version of the given contents, according to the given Content-Encoding header value.
+// Multiple encodings are decoded in the reverse order to which they were applied.
+func DecodeBody(contents []byte, contentEncoding string) ([]byte, error) {
+	encodings := contentEncodings(contentEncoding)
+	for i := len(encodings) - 1; i >= 0; i-- {
+		var decodeErr error
+		switch encodings[i] {
+		case "identity":
+			continue
+		case "gzip", "x-gzip":
+			contents, decodeErr = DecodeGzip(contents)
+		case "br":
+			contents, decodeErr = DecodeBrotli(contents)
+		case "deflate":
+			contents, decodeErr = DecodeDeflate(contents)
+		case "zstd":
+			contents, decodeErr = DecodeZstd(contents)
+		default:
+			return nil, fmt.Errorf("unsupported content-encoding: %s", encodings[i])
+		}
+		if decodeErr != nil {
+			return nil, decodeErr
+		}
+	}
+
+	return contents, nil
+}
+
+// EncodeBody returns an encoded version of the given contents, according to the given Content-Encoding header
+// value. It is the reverse of DecodeBody.
+func EncodeBody(contents []byte, contentEncoding string) ([]byte, error) {
+	for _, encoding := range contentEncodings(contentEncoding) {
+		var buf bytes.Buffer
+		var compressor io.WriteCloser
+		switch encoding {
+		case "identity":
+			continue
+		case "gzip", "x-gzip":
+			compressor = gzip.NewWriter(&buf)
+		case "br":
+			compressor = brotli.NewWriter(&buf)
+		case "deflate":
+			// NewWriter only fails for invalid compression levels
+			compressor, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+		case "zstd":
+			var newWriterErr error
+			if compressor, newWriterErr = zstd.NewWriter(&buf); newWriterErr != nil {
+				return nil, fmt.Errorf("unable to create new zstd writer: %w", newWriterErr)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported content-encoding: %s", encoding)
+		}
+		if _, writeErr := compressor.Write(contents); writeErr != nil {
+			return nil, fmt.Errorf("unable to %s-encode contents: %w", encoding, writeErr)
+		}
+		if closeErr := compressor.Close(); closeErr != nil {
+			return nil, fmt.Errorf("unable to %s-encode contents: %w", encoding, closeErr)
+		}
+		contents = buf.Bytes()
+	}
+
+	return contents, nil
+}
+
+// contentEncodings returns the encodings in the given Content-Encoding header value, in lowercase, in the order they
+// were applied.
+func contentEncodings(contentEncoding string) []string {
+	var encodings []string
+	for _, encoding := range strings.Split(contentEncoding, ",") {
+		if encoding = strings.ToLower(strings.TrimSpace(encoding)); encoding != "" {
+			encodings = append(encodings, encoding)
+		}
+	}
+
+	return encodings
+}
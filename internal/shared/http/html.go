@@ -0,0 +1,179 @@
+package http
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+
+	"golang.org/x/net/html"
+)
+
+var (
+	// bomUTF8 is the UTF-8 byte order mark, which is skipped when looking for the injection point.
+	bomUTF8 = []byte{0xEF, 0xBB, 0xBF}
+
+	// bomUTF16BE and bomUTF16LE are the UTF-16 byte order marks. Documents starting with these are not injected into,
+	// as the injected markup is ASCII.
+	bomUTF16BE = []byte{0xFE, 0xFF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+)
+
+// FindInjectionPoint returns the offset in the given decoded HTML document where injected elements should be
+// inserted, or -1 if they can't be.
+//
+// The document is tokenized from the start, stopping as soon as the body content begins, so that tags in comments,
+// scripts and attribute values are ignored. Elements are injected straight after the <head> start tag, or if there
+// is none, after the <html> start tag, after the <body> start tag, or at the start of the document (after any byte
+// order mark and doctype), in that order. Documents that don't start with markup are not injected into.
+func FindInjectionPoint(document []byte) int {
+	if bytes.HasPrefix(document, bomUTF16BE) || bytes.HasPrefix(document, bomUTF16LE) {
+		return -1
+	}
+	start := 0
+	if bytes.HasPrefix(document, bomUTF8) {
+		start = len(bomUTF8)
+	}
+	if trimmed := bytes.TrimLeft(document[start:], " \t\r\n\f"); len(trimmed) == 0 || trimmed[0] != '<' {
+		return -1
+	}
+
+	htmlEnd, bodyEnd := -1, -1
+	offset := start
+	rawText := false
+	tokenizer := html.NewTokenizer(bytes.NewReader(document[start:]))
+tokens:
+	for {
+		tokenType := tokenizer.Next()
+		offset += len(tokenizer.Raw())
+
+		switch tokenType {
+		case html.ErrorToken:
+			break tokens
+		case html.DoctypeToken:
+			start = offset
+		case html.TextToken:
+			// Text outside of head elements, other than whitespace, starts the body content
+			if !rawText && len(bytes.TrimSpace(tokenizer.Raw())) > 0 {
+				break tokens
+			}
+		case html.EndTagToken:
+			rawText = false
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, _ := tokenizer.TagName()
+			switch string(name) {
+			case "head":
+				return offset
+			case "html":
+				htmlEnd = offset
+			case "body":
+				bodyEnd = offset
+				break tokens
+			case "title", "script", "style", "noscript":
+				// The text in these elements is not body content
+				rawText = tokenType == html.StartTagToken
+			case "meta", "link", "base":
+				// Head elements may come before the <head> tag, or without one
+			default:
+				// Any other element starts the body content
+				break tokens
+			}
+		}
+	}
+
+	switch {
+	case htmlEnd != -1:
+		return htmlEnd
+	case bodyEnd != -1:
+		return bodyEnd
+	}
+
+	return start
+}
+
+// HTMLPrepareFunc prepares the markup injected into an HTML document by InjectHTML. It is given the decoded
+// document, and returns the document to inject into, which it may have changed, and the markup to inject.
+type HTMLPrepareFunc func(document []byte) ([]byte, string)
+
+// InjectHTML injects markup into the HTML document in the given response, at the point found by
+// FindInjectionPoint. Responses that can't be injected into are left unchanged.
+//
+// The body is read and decoded once, then given to each of the non-nil prepare functions in turn, each seeing the
+// document returned by the one before it. Their markup is injected in the same order, and the body is re-encoded
+// with its original Content-Encoding if reencode is true, or otherwise sent decoded.
+func InjectHTML(response *http.Response, reencode bool, prepares ...HTMLPrepareFunc) error {
+	// Skip reading the body if there is nothing to inject
+	hasPrepare := false
+	for _, prepare := range prepares {
+		hasPrepare = hasPrepare || prepare != nil
+	}
+	if !hasPrepare {
+		return nil
+	}
+
+	if response.Body == http.NoBody || response.Body == nil {
+		// This shouldn't happen with an HTML response content-type, but just in case...
+		return nil
+	}
+
+	// Read response body
+	body, bodyCopy, readErr := ReadBody(response.Body)
+	response.Body = bodyCopy
+	if readErr != nil {
+		return fmt.Errorf("unable to read response body: %w", readErr)
+	}
+
+	// Odd edge case, but it's happened
+	if len(body) == 0 {
+		return nil
+	}
+
+	contentEncoding := response.Header.Get("Content-Encoding")
+	document, decodeErr := DecodeBody(body, contentEncoding)
+	if decodeErr != nil {
+		return fmt.Errorf("unable to decode response body: %w", decodeErr)
+	}
+
+	if FindInjectionPoint(document) == -1 {
+		return nil
+	}
+	markup := ""
+	for _, prepare := range prepares {
+		if prepare == nil {
+			continue
+		}
+		var prepared string
+		document, prepared = prepare(document)
+		markup += prepared
+	}
+	if markup == "" {
+		return nil
+	}
+
+	// Find the injection point again, as the document may have changed
+	injectionPoint := FindInjectionPoint(document)
+	if injectionPoint == -1 {
+		return nil
+	}
+	injected := make([]byte, 0, len(document)+len(markup))
+	injected = append(injected, document[:injectionPoint]...)
+	injected = append(injected, markup...)
+	injected = append(injected, document[injectionPoint:]...)
+
+	if reencode && contentEncoding != "" {
+		encoded, encodeErr := EncodeBody(injected, contentEncoding)
+		if encodeErr != nil {
+			return fmt.Errorf("unable to re-encode response body: %w", encodeErr)
+		}
+		injected = encoded
+	} else {
+		response.Header.Del("Content-Encoding") // sending it uncompressed
+	}
+
+	// Save updated response body, and modify headers
+	response.Body = io.NopCloser(bytes.NewReader(injected))
+	response.ContentLength = int64(len(injected))
+	response.Header.Set("Content-Length", fmt.Sprintf("%d", len(injected)))
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package http
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestFindInjectionPoint(t *testing.T) {
+	tests := []struct {
+		document string
+		after    string
+	}{
+		{`<!DOCTYPE html><html lang="en"><HEAD data-x="1"><title>t</title>`, `<HEAD data-x="1">`},
+		{`<!-- <head> --><html><head>`, `<html><head>`},
+		{"\xEF\xBB\xBF<!doctype html><html><body><p>hi</p>", `<!doctype html><html>`},
+		{`<meta charset="utf-8"><title><head></title><body onload="x()">`, `<body onload="x()">`},
+		{"<!DOCTYPE html>\n<div>fragment</div>", `<!DOCTYPE html>`},
+	}
+	for _, test := range tests {
+		got := FindInjectionPoint([]byte(test.document))
+		if got == -1 || !bytes.HasSuffix([]byte(test.document[:got]), []byte(test.after)) {
+			t.Errorf("FindInjectionPoint(%q) = %d, want the offset after %q", test.document, got, test.after)
+		}
+	}
+
+	for _, document := range []string{`{"json": true}`, "\xFF\xFE<\x00h\x00", ""} {
+		if got := FindInjectionPoint([]byte(document)); got != -1 {
+			t.Errorf("FindInjectionPoint(%q) = %d, want -1", document, got)
+		}
+	}
+}
+
+func TestInjectHTMLReencode(t *testing.T) {
+	for _, encoding := range []string{"gzip", "br", "deflate", "zstd"} {
+		encoded, encodeErr := EncodeBody([]byte(`<html><head></head></html>`), encoding)
+		if encodeErr != nil {
+			t.Fatalf("EncodeBody(%s) returned error: %s", encoding, encodeErr)
+		}
+		response := &http.Response{
+			Header: http.Header{"Content-Encoding": {encoding}},
+			Body:   io.NopCloser(bytes.NewReader(encoded)),
+		}
+		injectErr := InjectHTML(response, true, func(document []byte) ([]byte, string) {
+			return document, `<script src="a.js"></script>`
+		})
+		if injectErr != nil {
+			t.Fatalf("InjectHTML(%s) returned error: %s", encoding, injectErr)
+		}
+
+		body, _ := io.ReadAll(response.Body)
+		decoded, decodeErr := DecodeBody(body, response.Header.Get("Content-Encoding"))
+		if want := `<html><head><script src="a.js"></script></head></html>`; decodeErr != nil || string(decoded) != want {
+			t.Errorf("InjectHTML(%s) body = %q (%v), want %q", encoding, decoded, decodeErr, want)
+		}
+	}
+}
+
+func TestInjectHTMLPrepares(t *testing.T) {
+	encoded, encodeErr := EncodeBody([]byte(`<html><head><meta name="a"></head></html>`), "gzip")
+	if encodeErr != nil {
+		t.Fatalf("EncodeBody() returned error: %s", encodeErr)
+	}
+	response := &http.Response{
+		Header: http.Header{"Content-Encoding": {"gzip"}},
+		Body:   io.NopCloser(bytes.NewReader(encoded)),
+	}
+
+	// Each function sees the document returned by the one before it, and their markup is injected in order
+	var seen string
+	injectErr := InjectHTML(response, false,
+		func(document []byte) ([]byte, string) {
+			return bytes.Replace(document, []byte(`name="a"`), []byte(`name="b"`), 1), `<script src="first.js"></script>`
+		},
+		nil,
+		func(document []byte) ([]byte, string) {
+			seen = string(document)
+			return document, `<script src="second.js"></script>`
+		},
+	)
+	if injectErr != nil {
+		t.Fatalf("InjectHTML() returned error: %s", injectErr)
+	}
+	if want := `<html><head><meta name="b"></head></html>`; seen != want {
+		t.Errorf("second prepare function was given %q, want %q", seen, want)
+	}
+
+	body, _ := io.ReadAll(response.Body)
+	if want := `<html><head><script src="first.js"></script><script src="second.js"></script><meta name="b"></head></html>`; string(body) != want || response.Header.Get("Content-Encoding") != "" {
+		t.Errorf("InjectHTML() body = %q with Content-Encoding %q, want %q decoded", body, response.Header.Get("Content-Encoding"), want)
+	}
+}
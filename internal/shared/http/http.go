@@ -2,8 +2,12 @@ package http
 
 import (
 	"bytes"
+	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
+
+	log "github.com/sirupsen/logrus"
 )
 
 // ReadBody safely reads the HTTP request or response body, returning a byte slice of the body contents, a copy of the
@@ -47,3 +51,21 @@ func BodyAllowedForStatus(status int) bool {
 	}
 	return true
 }
+
+// WriteJSON writes the given value to the response as JSON, with the given status code.
+func WriteJSON(w http.ResponseWriter, status int, v interface{}) {
+	data, marshalErr := json.Marshal(v)
+	if marshalErr != nil {
+		http.Error(w, fmt.Sprintf("unable to convert response to JSON: %s", marshalErr.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	// Set the appropriate header for the content type in the response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	// Write the response; the status has already been sent, so errors can only be logged
+	if _, writeErr := w.Write(data); writeErr != nil {
+		log.WithError(writeErr).Error("unable to write JSON response")
+	}
+}
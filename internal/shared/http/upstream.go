@@ -0,0 +1,75 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	netProxy "golang.org/x/net/proxy"
+)
+
+// NewUpstreamTransport returns a transport for requests to remote servers. If a SOCKS5 proxy URL is given, it connects
+// through the SOCKS5 proxy with the dial function returned by proxyDial for the proxy's dialer; otherwise, it connects
+// with the given dial function.
+// If the SOCKS5 proxy can't be used, an error is returned along with a transport that connects with the given dial
+// function.
+func NewUpstreamTransport(socks5URL string, dial func(ctx context.Context, network, address string) (net.Conn, error), proxyDial func(dialer netProxy.ContextDialer) func(ctx context.Context, network, address string) (net.Conn, error)) (*http.Transport, error) {
+	transport := &http.Transport{
+		DialContext: dial,
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: true, // This will get us the most coverage possible of remote servers
+			MinVersion:         tls.VersionTLS10,
+			CipherSuites: []uint16{
+				// Support older server cipher suites
+				tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+				tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+				tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+				tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+				tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+				tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+				tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256,
+				tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256,
+				tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA,
+				tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+				tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA,
+				tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
+				tls.TLS_RSA_WITH_AES_128_GCM_SHA256,
+				tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
+				tls.TLS_RSA_WITH_AES_128_CBC_SHA256,
+				tls.TLS_RSA_WITH_AES_128_CBC_SHA,
+				tls.TLS_RSA_WITH_AES_256_CBC_SHA,
+				tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA,
+			},
+		},
+		MaxIdleConns:        1024,             // Large number, but not unlimited
+		MaxIdleConnsPerHost: 100,              // default is 2, this leaves a lot of flexibility for the client
+		MaxConnsPerHost:     0,                // TODO: Consider lowering this value to prevent a single client from consuming all of the proxy's connections
+		IdleConnTimeout:     90 * time.Second, // Same as the default http client
+		// TLSHandshakeTimeout:   10 * time.Second,
+		// ExpectContinueTimeout: 10 * time.Second,
+	}
+	if socks5URL == "" {
+		return transport, nil
+	}
+
+	// Connect through the SOCKS5 proxy, which resolves the hosts of remote servers itself
+	u, parseErr := url.Parse(socks5URL)
+	if parseErr != nil {
+		return transport, fmt.Errorf("unable to parse SOCKS5 URL string into URL type: %w", parseErr)
+	}
+	socks5Dialer, dialerErr := netProxy.FromURL(u, netProxy.Direct)
+	if dialerErr != nil {
+		return transport, fmt.Errorf("unable to create SOCKS5 dialer: %w", dialerErr)
+	}
+	socks5ContextDialer, isContextDialer := socks5Dialer.(netProxy.ContextDialer)
+	if !isContextDialer {
+		return transport, fmt.Errorf("unable to use SOCKS5 proxy with scheme %q", u.Scheme)
+	}
+	transport.DialContext = proxyDial(socks5ContextDialer)
+
+	return transport, nil
+}
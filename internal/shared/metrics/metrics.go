@@ -0,0 +1,205 @@
+package metrics
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace is the prefix for all Cartograph metric names.
+const namespace string = "cartograph"
+
+// Proxy metrics.
+var (
+	// ProxyRequests counts the requests forwarded by the proxy, by URL scheme, response status code (or "error"
+	// if no response was received), and whether the request matched a target.
+	ProxyRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "proxy",
+		Name:      "requests_total",
+		Help:      "Requests forwarded by the proxy, by URL scheme, response status code, and target match.",
+	}, []string{"scheme", "status", "target"})
+
+	// ProxyUpstreamLatency measures the time taken for remote servers to return response headers, by URL scheme.
+	ProxyUpstreamLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "proxy",
+		Name:      "upstream_latency_seconds",
+		Help:      "Time taken for remote servers to return response headers, by URL scheme.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"scheme"})
+
+	// ProxyActiveTunnels is the number of open CONNECT tunnels.
+	ProxyActiveTunnels = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "proxy",
+		Name:      "active_tunnels",
+		Help:      "Number of open CONNECT tunnels.",
+	})
+
+	// ProxyActiveWebsockets is the number of open proxied websocket connections.
+	ProxyActiveWebsockets = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "proxy",
+		Name:      "active_websockets",
+		Help:      "Number of open proxied websocket connections.",
+	})
+)
+
+// Certificate metrics.
+var (
+	// CertificateGenerationSeconds measures the time taken to generate leaf certificates, by key type.
+	CertificateGenerationSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "certificates",
+		Name:      "generation_seconds",
+		Help:      "Time taken to generate leaf TLS certificates, by key type.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"key_type"})
+)
+
+// Plugin metrics.
+var (
+	// PluginFlushItems measures the number of items saved to the database in each plugin cache flush, by queue.
+	PluginFlushItems = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "plugin",
+		Name:      "flush_items",
+		Help:      "Number of items saved to the database in each plugin cache flush, by queue.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 8),
+	}, []string{"queue"})
+
+	// PluginFlushSeconds measures the time taken by each plugin cache flush, by queue.
+	PluginFlushSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "plugin",
+		Name:      "flush_seconds",
+		Help:      "Time taken by each plugin cache flush, by queue.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"queue"})
+
+	// PluginFlushErrors counts the plugin cache flushes that failed, either fully or partially, by queue.
+	PluginFlushErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "plugin",
+		Name:      "flush_errors_total",
+		Help:      "Plugin cache flushes that failed, either fully or partially, by queue.",
+	}, []string{"queue"})
+)
+
+// Handler returns the HTTP handler that serves all metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// dbPools reports the statistics of registered database connection pools.
+var dbPools = &dbPoolCollector{pools: make(map[string]*pgxpool.Pool)}
+
+// certCaches reports the sizes of registered certificate caches.
+var certCaches = &certCacheCollector{caches: make(map[string]func() int)}
+
+func init() {
+	prometheus.MustRegister(dbPools, certCaches)
+}
+
+// RegisterDbPool adds the given database connection pool to the metrics, using the given name as its "pool" label.
+// Registering another pool with the same name replaces the previous one.
+func RegisterDbPool(name string, pool *pgxpool.Pool) {
+	dbPools.mu.Lock()
+	defer dbPools.mu.Unlock()
+
+	dbPools.pools[name] = pool
+}
+
+// RegisterCertificateCache adds a certificate cache to the metrics, using the given name as its "cache" label.
+// The given function is called on each scrape to get the number of cached certificates.
+// Registering another cache with the same name replaces the previous one.
+func RegisterCertificateCache(name string, size func() int) {
+	certCaches.mu.Lock()
+	defer certCaches.mu.Unlock()
+
+	certCaches.caches[name] = size
+}
+
+// dbPoolCollector is a prometheus.Collector that reports pgxpool.Pool statistics for each registered pool.
+type dbPoolCollector struct {
+	mu    sync.RWMutex
+	pools map[string]*pgxpool.Pool
+}
+
+var (
+	dbPoolAcquiredConns = prometheus.NewDesc(prometheus.BuildFQName(namespace, "db_pool", "acquired_conns"),
+		"Number of currently acquired connections in the pool.", []string{"pool"}, nil)
+	dbPoolIdleConns = prometheus.NewDesc(prometheus.BuildFQName(namespace, "db_pool", "idle_conns"),
+		"Number of currently idle connections in the pool.", []string{"pool"}, nil)
+	dbPoolTotalConns = prometheus.NewDesc(prometheus.BuildFQName(namespace, "db_pool", "total_conns"),
+		"Total number of connections currently in the pool.", []string{"pool"}, nil)
+	dbPoolMaxConns = prometheus.NewDesc(prometheus.BuildFQName(namespace, "db_pool", "max_conns"),
+		"Maximum size of the pool.", []string{"pool"}, nil)
+	dbPoolAcquires = prometheus.NewDesc(prometheus.BuildFQName(namespace, "db_pool", "acquires_total"),
+		"Total number of successful connection acquisitions from the pool.", []string{"pool"}, nil)
+	dbPoolEmptyAcquires = prometheus.NewDesc(prometheus.BuildFQName(namespace, "db_pool", "empty_acquires_total"),
+		"Total number of acquisitions that had to wait for a connection because the pool was empty.", []string{"pool"}, nil)
+	dbPoolCanceledAcquires = prometheus.NewDesc(prometheus.BuildFQName(namespace, "db_pool", "canceled_acquires_total"),
+		"Total number of acquisitions that were canceled by a context.", []string{"pool"}, nil)
+	dbPoolAcquireSeconds = prometheus.NewDesc(prometheus.BuildFQName(namespace, "db_pool", "acquire_seconds_total"),
+		"Total time spent waiting to acquire connections from the pool.", []string{"pool"}, nil)
+)
+
+// Describe conforms to the prometheus.Collector interface.
+func (c *dbPoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- dbPoolAcquiredConns
+	ch <- dbPoolIdleConns
+	ch <- dbPoolTotalConns
+	ch <- dbPoolMaxConns
+	ch <- dbPoolAcquires
+	ch <- dbPoolEmptyAcquires
+	ch <- dbPoolCanceledAcquires
+	ch <- dbPoolAcquireSeconds
+}
+
+// Collect conforms to the prometheus.Collector interface.
+func (c *dbPoolCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for name, pool := range c.pools {
+		stat := pool.Stat()
+		ch <- prometheus.MustNewConstMetric(dbPoolAcquiredConns, prometheus.GaugeValue, float64(stat.AcquiredConns()), name)
+		ch <- prometheus.MustNewConstMetric(dbPoolIdleConns, prometheus.GaugeValue, float64(stat.IdleConns()), name)
+		ch <- prometheus.MustNewConstMetric(dbPoolTotalConns, prometheus.GaugeValue, float64(stat.TotalConns()), name)
+		ch <- prometheus.MustNewConstMetric(dbPoolMaxConns, prometheus.GaugeValue, float64(stat.MaxConns()), name)
+		ch <- prometheus.MustNewConstMetric(dbPoolAcquires, prometheus.CounterValue, float64(stat.AcquireCount()), name)
+		ch <- prometheus.MustNewConstMetric(dbPoolEmptyAcquires, prometheus.CounterValue, float64(stat.EmptyAcquireCount()), name)
+		ch <- prometheus.MustNewConstMetric(dbPoolCanceledAcquires, prometheus.CounterValue, float64(stat.CanceledAcquireCount()), name)
+		ch <- prometheus.MustNewConstMetric(dbPoolAcquireSeconds, prometheus.CounterValue, stat.AcquireDuration().Seconds(), name)
+	}
+}
+
+// certCacheCollector is a prometheus.Collector that reports the size of each registered certificate cache.
+type certCacheCollector struct {
+	mu     sync.RWMutex
+	caches map[string]func() int
+}
+
+var certCacheSize = prometheus.NewDesc(prometheus.BuildFQName(namespace, "certificates", "cache_size"),
+	"Number of generated leaf certificates held in the cache.", []string{"cache"}, nil)
+
+// Describe conforms to the prometheus.Collector interface.
+func (c *certCacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- certCacheSize
+}
+
+// Collect conforms to the prometheus.Collector interface.
+func (c *certCacheCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for name, size := range c.caches {
+		ch <- prometheus.MustNewConstMetric(certCacheSize, prometheus.GaugeValue, float64(size()), name)
+	}
+}
@@ -0,0 +1,71 @@
+package webui
+
+import (
+	"embed"
+	"fmt"
+	"html/template"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/TheHackerDev/cartograph/internal/shared/users"
+)
+
+//go:embed templates/map/map.gohtml
+var mapFS embed.FS
+
+var mapTmpl *template.Template
+
+func init() {
+	var err error
+	mapTmpl, err = template.ParseFS(mapFS, "templates/map/map.gohtml")
+	if err != nil {
+		panic(fmt.Errorf("unable to parse map template: %w", err))
+	}
+}
+
+// mapExplorer is an HTTP handler for the /map endpoint.
+//
+// This handler is used to render the map explorer page, which draws the host graph in the browser using the
+// /map/api/* endpoints.
+func (webUI *WebUI) mapExplorer() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Reject if not GET request, and return valid methods with OPTIONS request
+		if r.Method != http.MethodGet {
+			if r.Method == http.MethodOptions {
+				w.Header().Set("Allow", "GET")
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+			w.Header().Set("Allow", "GET")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		// Get the user role from the request context's claims
+		claims, jwtClaimsOk := r.Context().Value("claims").(*users.JWTClaims)
+		if !jwtClaimsOk {
+			log.WithField("claims", r.Context().Value("claims")).Error("unable to get claims from context")
+			http.Error(w, "problem getting user role", http.StatusInternalServerError)
+			return
+		}
+
+		// Convert the roles to a string slice
+		roles := make([]string, len(claims.Roles))
+		for i, role := range claims.Roles {
+			roles[i] = users.ConvertToRole(role).String()
+		}
+
+		// Render map explorer page
+		if err := mapTmpl.Execute(w, struct {
+			UserRoles []string
+		}{
+			UserRoles: roles,
+		}); err != nil {
+			log.WithError(err).Error("unable to render map explorer page")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		return
+	}
+}
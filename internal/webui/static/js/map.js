@@ -0,0 +1,532 @@
+// Map explorer: draws the mapper's host graph with a force layout, and shows the paths and parameters logged for
+// each host. Graph data comes from /map/api/hosts and /map/api/neighbourhood in the D3 node-link format, and path
+// data from /map/api/paths and /map/api/parameters.
+(function () {
+	"use strict";
+
+	// Layout constants
+	const linkDistance = 60;
+	const linkStrength = 0.05;
+	const repulsion = 900;
+	const gravity = 0.01;
+	const velocityDecay = 0.6;
+	const alphaDecay = 0.985;
+	const alphaMin = 0.005;
+
+	// Community colors, cycled for graphs with more communities
+	const palette = ["#1f77b4", "#ff7f0e", "#2ca02c", "#d62728", "#9467bd", "#8c564b", "#e377c2", "#7f7f7f", "#bcbd22", "#17becf"];
+
+	const canvas = document.getElementById("map-canvas");
+	const context = canvas.getContext("2d");
+	const filters = document.getElementById("map-filters");
+	const search = document.getElementById("map-search");
+	const status = document.getElementById("map-status");
+	const details = document.getElementById("map-details");
+
+	const state = {
+		nodes: [],
+		links: [],
+		nodesByID: new Map(),
+		linkKeys: new Set(),
+		selected: null,
+		matches: new Set(),
+		view: {x: 0, y: 0, scale: 1},
+		alpha: 0,
+		running: false,
+	};
+
+	// windowParams returns the time window query parameters from the filter form.
+	function windowParams() {
+		const params = new URLSearchParams();
+		for (const name of ["since", "until"]) {
+			const value = filters.elements[name].value.trim();
+			if (value !== "") {
+				params.set(name, value);
+			}
+		}
+		params.set("format", "d3");
+		return params;
+	}
+
+	// fetchJSON fetches the given URL as JSON, sending the user back to the login page if their session has expired.
+	async function fetchJSON(url) {
+		const response = await fetch(url, {credentials: "same-origin", headers: {Accept: "application/json"}});
+		if (response.redirected && new URL(response.url).pathname === "/login") {
+			window.location.assign("/login");
+			throw new Error("session expired");
+		}
+		if (!response.ok) {
+			throw new Error((await response.text()).trim() || response.statusText);
+		}
+		return response.json();
+	}
+
+	// setStatus shows the given message above the graph.
+	function setStatus(message) {
+		status.textContent = message;
+	}
+
+	// reset removes every node and link from the graph.
+	function reset() {
+		state.nodes = [];
+		state.links = [];
+		state.nodesByID.clear();
+		state.linkKeys.clear();
+		state.selected = null;
+		state.matches.clear();
+		state.view = {x: 0, y: 0, scale: 1};
+	}
+
+	// merge adds the nodes and links of the given D3 graph, placing new nodes around the given position.
+	function merge(graph, around) {
+		let added = 0;
+		for (const data of graph.nodes) {
+			const existing = state.nodesByID.get(data.id);
+			if (existing) {
+				Object.assign(existing.data, data);
+				continue;
+			}
+			const angle = Math.random() * 2 * Math.PI;
+			const distance = linkDistance * (0.5 + Math.random());
+			const node = {
+				id: data.id,
+				data: data,
+				x: around.x + Math.cos(angle) * distance,
+				y: around.y + Math.sin(angle) * distance,
+				vx: 0,
+				vy: 0,
+				fixed: false,
+			};
+			state.nodes.push(node);
+			state.nodesByID.set(node.id, node);
+			added++;
+		}
+		for (const data of graph.links) {
+			const key = data.source + "\n" + data.target;
+			const source = state.nodesByID.get(data.source);
+			const target = state.nodesByID.get(data.target);
+			if (state.linkKeys.has(key) || !source || !target) {
+				continue;
+			}
+			state.linkKeys.add(key);
+			state.links.push({source: source, target: target, data: data});
+		}
+		updateMatches();
+		restart();
+		return added;
+	}
+
+	// load replaces the graph with all hosts, or with the neighbourhood of the host given in the filter form.
+	async function load() {
+		const params = windowParams();
+		const host = filters.elements.host.value.trim();
+		let url = "/map/api/hosts?";
+		if (host !== "") {
+			params.set("host", host);
+			url = "/map/api/neighbourhood?";
+		}
+
+		setStatus("Loading…");
+		try {
+			const graph = await fetchJSON(url + params.toString());
+			reset();
+			merge(graph, {x: 0, y: 0});
+			setStatus(state.nodes.length + " hosts, " + state.links.length + " connections");
+			if (host !== "" && state.nodesByID.has(host)) {
+				select(state.nodesByID.get(host));
+			}
+		} catch (err) {
+			setStatus("Unable to load the map: " + err.message);
+		}
+	}
+
+	// expand adds the hosts directly connected to the given node.
+	async function expand(node) {
+		const params = windowParams();
+		params.set("host", node.id);
+		params.set("depth", "1");
+
+		setStatus("Expanding " + node.id + "…");
+		try {
+			const added = merge(await fetchJSON("/map/api/neighbourhood?" + params.toString()), node);
+			setStatus("Added " + added + " hosts around " + node.id + " (" + state.nodes.length + " hosts, " + state.links.length + " connections)");
+		} catch (err) {
+			setStatus("Unable to expand " + node.id + ": " + err.message);
+		}
+	}
+
+	// restart wakes the layout up after the graph changes.
+	function restart() {
+		state.alpha = 1;
+		if (!state.running) {
+			state.running = true;
+			window.requestAnimationFrame(frame);
+		}
+	}
+
+	// frame advances the layout by a single step and redraws the graph, until the layout settles.
+	function frame() {
+		tick();
+		draw();
+		state.alpha *= alphaDecay;
+		if (state.alpha > alphaMin) {
+			window.requestAnimationFrame(frame);
+		} else {
+			state.running = false;
+		}
+	}
+
+	// tick moves the nodes: they repel each other, linked nodes pull together, and everything drifts to the centre.
+	function tick() {
+		const nodes = state.nodes;
+		const alpha = state.alpha;
+
+		for (let i = 0; i < nodes.length; i++) {
+			const a = nodes[i];
+			for (let j = i + 1; j < nodes.length; j++) {
+				const b = nodes[j];
+				let dx = b.x - a.x;
+				let dy = b.y - a.y;
+				let distanceSquared = dx * dx + dy * dy;
+				if (distanceSquared === 0) {
+					dx = Math.random() - 0.5;
+					dy = Math.random() - 0.5;
+					distanceSquared = dx * dx + dy * dy;
+				}
+				const force = repulsion * alpha / distanceSquared;
+				a.vx -= dx * force;
+				a.vy -= dy * force;
+				b.vx += dx * force;
+				b.vy += dy * force;
+			}
+		}
+
+		for (const link of state.links) {
+			const dx = link.target.x - link.source.x;
+			const dy = link.target.y - link.source.y;
+			const distance = Math.sqrt(dx * dx + dy * dy) || 1;
+			const force = (distance - linkDistance) * linkStrength * alpha / distance;
+			link.source.vx += dx * force;
+			link.source.vy += dy * force;
+			link.target.vx -= dx * force;
+			link.target.vy -= dy * force;
+		}
+
+		for (const node of nodes) {
+			node.vx -= node.x * gravity * alpha;
+			node.vy -= node.y * gravity * alpha;
+			if (node.fixed) {
+				node.vx = 0;
+				node.vy = 0;
+				continue;
+			}
+			node.vx *= velocityDecay;
+			node.vy *= velocityDecay;
+			node.x += node.vx;
+			node.y += node.vy;
+		}
+	}
+
+	// radius returns the drawn radius of a node, scaled by its PageRank.
+	function radius(node) {
+		const pageRank = node.data.pagerank || 0;
+		return 4 + Math.sqrt(pageRank * state.nodes.length) * 4;
+	}
+
+	// draw redraws the whole graph.
+	function draw() {
+		const ratio = window.devicePixelRatio || 1;
+		const width = canvas.clientWidth;
+		const height = canvas.clientHeight;
+		if (canvas.width !== width * ratio || canvas.height !== height * ratio) {
+			canvas.width = width * ratio;
+			canvas.height = height * ratio;
+		}
+
+		context.setTransform(ratio, 0, 0, ratio, 0, 0);
+		context.clearRect(0, 0, width, height);
+		context.translate(width / 2 + state.view.x, height / 2 + state.view.y);
+		context.scale(state.view.scale, state.view.scale);
+
+		const focused = state.selected !== null || state.matches.size > 0;
+
+		context.lineWidth = 1 / state.view.scale;
+		for (const link of state.links) {
+			const highlighted = link.source === state.selected || link.target === state.selected;
+			context.globalAlpha = focused && !highlighted ? 0.15 : 0.6;
+			context.strokeStyle = link.data.color || "#999999";
+			context.beginPath();
+			context.moveTo(link.source.x, link.source.y);
+			context.lineTo(link.target.x, link.target.y);
+			context.stroke();
+		}
+
+		const neighbours = new Set();
+		if (state.selected) {
+			for (const link of state.links) {
+				if (link.source === state.selected) {
+					neighbours.add(link.target);
+				} else if (link.target === state.selected) {
+					neighbours.add(link.source);
+				}
+			}
+		}
+
+		context.font = 12 / state.view.scale + "px sans-serif";
+		for (const node of state.nodes) {
+			const highlighted = node === state.selected || neighbours.has(node) || state.matches.has(node);
+			context.globalAlpha = focused && !highlighted ? 0.25 : 1;
+			context.fillStyle = palette[(node.data.community || 0) % palette.length];
+			context.beginPath();
+			context.arc(node.x, node.y, radius(node), 0, 2 * Math.PI);
+			context.fill();
+			if (node === state.selected || state.matches.has(node)) {
+				context.lineWidth = 3 / state.view.scale;
+				context.strokeStyle = node === state.selected ? "#000000" : "#ffc107";
+				context.stroke();
+			}
+			if (highlighted || state.view.scale > 1.5) {
+				context.fillStyle = "#212529";
+				context.fillText(node.data.label || node.id, node.x + radius(node) + 2, node.y + 4);
+			}
+		}
+		context.globalAlpha = 1;
+	}
+
+	// toGraph converts a mouse event's position to graph coordinates.
+	function toGraph(event) {
+		const bounds = canvas.getBoundingClientRect();
+		return {
+			x: (event.clientX - bounds.left - bounds.width / 2 - state.view.x) / state.view.scale,
+			y: (event.clientY - bounds.top - bounds.height / 2 - state.view.y) / state.view.scale,
+		};
+	}
+
+	// nodeAt returns the node under the given graph position, if any.
+	function nodeAt(point) {
+		for (let i = state.nodes.length - 1; i >= 0; i--) {
+			const node = state.nodes[i];
+			const dx = node.x - point.x;
+			const dy = node.y - point.y;
+			const r = radius(node) + 2 / state.view.scale;
+			if (dx * dx + dy * dy <= r * r) {
+				return node;
+			}
+		}
+		return null;
+	}
+
+	// updateMatches finds the nodes matching the search box.
+	function updateMatches() {
+		state.matches.clear();
+		const term = search.value.trim().toLowerCase();
+		if (term === "") {
+			return;
+		}
+		for (const node of state.nodes) {
+			if (node.id.toLowerCase().includes(term)) {
+				state.matches.add(node);
+			}
+		}
+	}
+
+	// centreOn moves the view so that the given node is in the middle of the canvas.
+	function centreOn(node) {
+		state.view.x = -node.x * state.view.scale;
+		state.view.y = -node.y * state.view.scale;
+		draw();
+	}
+
+	// element creates an element with the given tag, class and text.
+	function element(tag, className, text) {
+		const el = document.createElement(tag);
+		if (className) {
+			el.className = className;
+		}
+		if (text !== undefined) {
+			el.textContent = text;
+		}
+		return el;
+	}
+
+	// select shows the details, paths and parameters of the given node in the side panel.
+	async function select(node) {
+		state.selected = node;
+		draw();
+		details.replaceChildren();
+		if (!node) {
+			details.appendChild(element("p", "text-muted", "Select a host to see its paths and parameters."));
+			return;
+		}
+
+		details.appendChild(element("h5", "text-break", node.id));
+
+		const scores = element("dl", "row small");
+		for (const [key, title] of [["in_degree", "In-degree"], ["out_degree", "Out-degree"], ["pagerank", "PageRank"], ["betweenness", "Betweenness"], ["community", "Community"], ["domain", "Domain"], ["organisation", "Organisation"]]) {
+			if (node.data[key] === undefined || node.data[key] === "") {
+				continue;
+			}
+			const value = typeof node.data[key] === "number" && !Number.isInteger(node.data[key]) ? node.data[key].toFixed(4) : String(node.data[key]);
+			scores.appendChild(element("dt", "col-6", title));
+			scores.appendChild(element("dd", "col-6", value));
+		}
+		details.appendChild(scores);
+
+		const expandButton = element("button", "btn btn-sm btn-outline-primary mb-3", "Expand neighbourhood");
+		expandButton.type = "button";
+		expandButton.addEventListener("click", function () {
+			expand(node);
+		});
+		details.appendChild(expandButton);
+
+		details.appendChild(element("h6", "", "Paths"));
+		const tree = element("div", "small");
+		tree.id = "map-path-tree";
+		tree.textContent = "Loading…";
+		details.appendChild(tree);
+
+		details.appendChild(element("h6", "mt-3", "Parameters"));
+		const parameters = element("div", "small text-muted", "Select a path to see its parameters.");
+		details.appendChild(parameters);
+
+		try {
+			const pathTree = await fetchJSON("/map/api/paths?" + new URLSearchParams({host: node.id}).toString());
+			if (state.selected !== node) {
+				return;
+			}
+			tree.replaceChildren(renderPathTree(pathTree, "", function (path) {
+				showParameters(node, path, parameters);
+			}));
+		} catch (err) {
+			tree.textContent = "Unable to load paths: " + err.message;
+		}
+	}
+
+	// renderPathTree renders a path tree as nested lists, calling onSelect with the full path of a clicked segment.
+	function renderPathTree(pathTree, prefix, onSelect) {
+		const list = element("ul", "mb-0");
+		const item = element("li");
+		const path = prefix + (pathTree.path_segment === "/" && prefix === "" ? "" : pathTree.path_segment);
+		const link = element("a", "", pathTree.path_segment);
+		link.href = "#";
+		link.addEventListener("click", function (event) {
+			event.preventDefault();
+			onSelect(path === "" ? "/" : path);
+		});
+		item.appendChild(link);
+
+		const children = (pathTree.children || []).slice().sort(function (a, b) {
+			return a.path_segment.localeCompare(b.path_segment);
+		});
+		for (const child of children) {
+			item.appendChild(renderPathTree(child, path, onSelect));
+		}
+		list.appendChild(item);
+		return list;
+	}
+
+	// showParameters lists the parameters logged for the given host and path.
+	async function showParameters(node, path, container) {
+		container.className = "small";
+		container.textContent = "Loading…";
+		try {
+			const parameters = await fetchJSON("/map/api/parameters?" + new URLSearchParams({host: node.id, path: path}).toString());
+			container.replaceChildren(element("div", "fw-bold text-break", path));
+			if (parameters.length === 0) {
+				container.appendChild(element("div", "text-muted", "No parameters logged."));
+				return;
+			}
+			const list = element("ul", "list-unstyled mb-0");
+			for (const parameter of parameters) {
+				list.appendChild(element("li", "font-monospace text-break", parameter.key_value));
+			}
+			container.appendChild(list);
+		} catch (err) {
+			container.textContent = "Unable to load parameters: " + err.message;
+		}
+	}
+
+	// Mouse interaction: drag nodes or pan, scroll to zoom, click to select, and double-click to expand.
+	let drag = null;
+	canvas.addEventListener("mousedown", function (event) {
+		const point = toGraph(event);
+		const node = nodeAt(point);
+		drag = {node: node, startX: event.clientX, startY: event.clientY, viewX: state.view.x, viewY: state.view.y, moved: false};
+		if (node) {
+			node.fixed = true;
+		}
+		canvas.style.cursor = "grabbing";
+	});
+	window.addEventListener("mousemove", function (event) {
+		if (!drag) {
+			return;
+		}
+		if (Math.abs(event.clientX - drag.startX) + Math.abs(event.clientY - drag.startY) > 3) {
+			drag.moved = true;
+		}
+		if (drag.node) {
+			const point = toGraph(event);
+			drag.node.x = point.x;
+			drag.node.y = point.y;
+			state.alpha = Math.max(state.alpha, 0.3);
+			restart();
+		} else {
+			state.view.x = drag.viewX + event.clientX - drag.startX;
+			state.view.y = drag.viewY + event.clientY - drag.startY;
+			draw();
+		}
+	});
+	window.addEventListener("mouseup", function () {
+		if (!drag) {
+			return;
+		}
+		if (drag.node) {
+			drag.node.fixed = false;
+		}
+		if (!drag.moved) {
+			select(drag.node);
+		}
+		drag = null;
+		canvas.style.cursor = "grab";
+	});
+	canvas.addEventListener("dblclick", function (event) {
+		const node = nodeAt(toGraph(event));
+		if (node) {
+			expand(node);
+		}
+	});
+	canvas.addEventListener("wheel", function (event) {
+		event.preventDefault();
+		const before = toGraph(event);
+		state.view.scale = Math.min(8, Math.max(0.05, state.view.scale * Math.exp(-event.deltaY * 0.001)));
+		const after = toGraph(event);
+		state.view.x += (after.x - before.x) * state.view.scale;
+		state.view.y += (after.y - before.y) * state.view.scale;
+		draw();
+	}, {passive: false});
+
+	// Search highlights matching hosts as the user types, and Enter selects the first match
+	search.addEventListener("input", function () {
+		updateMatches();
+		draw();
+	});
+	search.addEventListener("keydown", function (event) {
+		if (event.key !== "Enter") {
+			return;
+		}
+		event.preventDefault();
+		const first = state.matches.values().next().value;
+		if (first) {
+			centreOn(first);
+			select(first);
+		}
+	});
+
+	filters.addEventListener("submit", function (event) {
+		event.preventDefault();
+		load();
+	});
+	window.addEventListener("resize", draw);
+
+	load();
+})();
@@ -1,16 +1,21 @@
 package webui
 
 import (
+	"context"
 	"crypto/tls"
 	"embed"
 	_ "embed"
+	"errors"
 	"net/http"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 
 	"github.com/TheHackerDev/cartograph/internal/config"
+	"github.com/TheHackerDev/cartograph/internal/mapper"
+	"github.com/TheHackerDev/cartograph/internal/proxy/logger"
 	"github.com/TheHackerDev/cartograph/internal/shared/database"
 	internalHttp "github.com/TheHackerDev/cartograph/internal/shared/http"
+	"github.com/TheHackerDev/cartograph/internal/shared/metrics"
 	"github.com/TheHackerDev/cartograph/internal/shared/users"
 )
 
@@ -20,21 +25,24 @@ var staticCSS embed.FS
 //go:embed static/js/*.js static/js/*.map
 var staticJS embed.FS
 
-// NewWebUI returns a new web UI object using the given configuration.
+// NewWebUI returns a new web UI object using the given configuration. The mapper and logger plugins provide the data
+// for the map explorer.
 //
 // Any errors returned should be considered fatal.
-func NewWebUI(cfg *config.Config) (*WebUI, error) {
+func NewWebUI(cfg *config.Config, pluginMapper *mapper.Mapper, pluginLogger *logger.Logger) (*WebUI, error) {
 	// Get a database connection pool
 	dbConnPool, dbConnPoolErr := database.GetDbConnPool(cfg.DbConnString)
 	if dbConnPoolErr != nil {
 		return nil, dbConnPoolErr
 	}
+	metrics.RegisterDbPool("webui", dbConnPool)
 
 	// Get a certificate manager
 	certificateManager, certificateManagerErr := internalHttp.NewCertificateManager()
 	if certificateManagerErr != nil {
 		return nil, certificateManagerErr
 	}
+	metrics.RegisterCertificateCache("webui", certificateManager.CacheSize)
 
 	// Create a new web UI object
 	webUI := &WebUI{
@@ -58,25 +66,24 @@ func NewWebUI(cfg *config.Config) (*WebUI, error) {
 
 	// Set up the web UI routes
 	serveMux.HandleFunc("/review/bag-of-words", webUI.authenticated(webUI.reviewBagOfWords()))
+	serveMux.HandleFunc("/map", webUI.authenticated(webUI.mapExplorer()))
+	serveMux.HandleFunc("/map/api/hosts", webUI.authenticated(pluginMapper.AllHostsGraph))
+	serveMux.HandleFunc("/map/api/neighbourhood", webUI.authenticated(pluginMapper.HostNeighbourhoodGraph))
+	serveMux.HandleFunc("/map/api/paths", webUI.authenticated(logger.PathTreeAPIHandler(pluginLogger)))
+	serveMux.HandleFunc("/map/api/parameters", webUI.authenticated(logger.ParametersAPIHandler(pluginLogger)))
 	serveMux.HandleFunc("/login", webUI.login())
 	serveMux.HandleFunc("/", webUI.authenticated(webUI.home()))
 
 	// Create a new HTTPS server
-	webUI.tlsServer = &http.Server{
-		Addr:    ":443",
-		Handler: serveMux,
-		TLSConfig: &tls.Config{
-			GetCertificate: webUI.certificateManager.GetCertificateDynamic(),
-		},
+	webUI.tlsServer = cfg.WebUIHTTPSServer.NewHTTPServer(serveMux)
+	webUI.tlsServer.TLSConfig = &tls.Config{
+		GetCertificate: webUI.certificateManager.GetCertificateDynamic(),
 	}
 
 	// Create a new HTTP server
-	webUI.httpServer = &http.Server{
-		Addr: ":80",
-		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			http.Redirect(w, r, "https://"+r.Host+r.URL.String(), http.StatusMovedPermanently)
-		}),
-	}
+	webUI.httpServer = cfg.WebUIHTTPServer.NewHTTPServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://"+r.Host+r.URL.String(), http.StatusMovedPermanently)
+	}))
 
 	return webUI, nil
 }
@@ -117,6 +124,18 @@ func (webUI *WebUI) Run() error {
 		errChan <- webUI.tlsServer.ListenAndServeTLS("", "")
 	}()
 
-	// Wait for an error
-	return <-errChan
+	// Wait for an error, ignoring the error returned when the servers are shut down
+	if serveErr := <-errChan; !errors.Is(serveErr, http.ErrServerClosed) {
+		return serveErr
+	}
+
+	return nil
+}
+
+// Shutdown gracefully shuts down the web UI servers, waiting for in-flight requests to complete.
+func (webUI *WebUI) Shutdown(ctx context.Context) error {
+	httpErr := webUI.httpServer.Shutdown(ctx)
+	tlsErr := webUI.tlsServer.Shutdown(ctx)
+
+	return errors.Join(httpErr, tlsErr)
 }